@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jomei/notionapi"
+)
+
+// runAppend appends Markdown or JSON block definitions read from stdin to a
+// page or block, so that scripts can push logs, reports or generated tables
+// into Notion.
+func runAppend(args []string) {
+	fs := flag.NewFlagSet("append", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	format := fs.String("format", "markdown", "input format: markdown or json (Notion API block objects)")
+	after := fs.String("after", "", "insert the blocks after this child block instead of at the end")
+	dryRun := fs.Bool("dry-run", false, "print the Notion API requests that would append the blocks instead of sending them")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs append [flags] <page-or-block-id> < input")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(1)
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fatalf("Error reading input: %v", err)
+	}
+	var blocks []notionapi.Block
+	switch *format {
+	case "markdown":
+		blocks = parseMarkdown(string(data))
+	case "json":
+		blocks, err = parseBlocksJSON(data)
+		if err != nil {
+			fatalf("Error parsing blocks: %v", err)
+		}
+	default:
+		fatalf("unknown input format: %s", *format)
+	}
+	if len(blocks) == 0 {
+		fatal("no blocks to append")
+	}
+
+	if *dryRun {
+		enableDryRun()
+	}
+	var afterID notionapi.BlockID
+	if *after != "" {
+		afterID = notionapi.BlockID(formatPageID(*after))
+	}
+	created, err := appendBlockTree(context.Background(), newNotionClient(), notionapi.BlockID(formatPageID(fs.Arg(0))), afterID, blocks)
+	if err != nil {
+		exitWithNotionError("Error appending blocks", err)
+	}
+	// 追加したブロックのIDを出力し、続けて --after で挿入したり更新したりできるようにする
+	for _, block := range created {
+		fmt.Println(block.GetID())
+	}
+}
+
+// parseBlocksJSON reads block objects as accepted by the Notion API: an array
+// of blocks, a single block, or a request body with a "children" array.
+// Children may be nested to any depth.
+func parseBlocksJSON(data []byte) ([]notionapi.Block, error) {
+	data = bytes.TrimSpace(data)
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var list []any
+	switch v := raw.(type) {
+	case []any:
+		list = v
+	case map[string]any:
+		if children, ok := v["children"].([]any); ok && v["type"] == nil {
+			list = children
+		} else {
+			list = []any{v}
+		}
+	default:
+		return nil, fmt.Errorf("expected a block object or an array of blocks")
+	}
+	if err := normalizeBlocksJSON(list, "blocks"); err != nil {
+		return nil, err
+	}
+
+	normalized, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	var blocks notionapi.Blocks
+	if err := json.Unmarshal(normalized, &blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// decodableBlockTypes は notionapi が読み込めるブロックの種類（それ以外は中身が失われる）
+var decodableBlockTypes = map[notionapi.BlockType]bool{
+	notionapi.BlockTypeParagraph: true, notionapi.BlockTypeHeading1: true, notionapi.BlockTypeHeading2: true,
+	notionapi.BlockTypeHeading3: true, notionapi.BlockCallout: true, notionapi.BlockQuote: true,
+	notionapi.BlockTypeBulletedListItem: true, notionapi.BlockTypeNumberedListItem: true, notionapi.BlockTypeToDo: true,
+	notionapi.BlockTypeCode: true, notionapi.BlockTypeToggle: true, notionapi.BlockTypeEmbed: true,
+	notionapi.BlockTypeImage: true, notionapi.BlockTypeVideo: true, notionapi.BlockTypeFile: true,
+	notionapi.BlockTypePdf: true, notionapi.BlockTypeBookmark: true, notionapi.BlockTypeTableOfContents: true,
+	notionapi.BlockTypeDivider: true, notionapi.BlockTypeEquation: true, notionapi.BlockTypeBreadcrumb: true,
+	notionapi.BlockTypeColumn: true, notionapi.BlockTypeColumnList: true, notionapi.BlockTypeLinkToPage: true,
+	notionapi.BlockTypeSyncedBlock: true, notionapi.BlockTypeTableBlock: true, notionapi.BlockTypeTableRowBlock: true,
+}
+
+// normalizeBlocksJSON は各ブロックの type が notionapi で扱えるものか確かめ
+// （type のないブロックは読み込み時に panic する）、省略されがちな "object": "block" を補います
+func normalizeBlocksJSON(list []any, path string) error {
+	for i, item := range list {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		block, ok := item.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected a block object", p)
+		}
+		typ, ok := block["type"].(string)
+		if !ok {
+			return fmt.Errorf("%s: missing block type", p)
+		}
+		if !decodableBlockTypes[notionapi.BlockType(typ)] {
+			return fmt.Errorf("%s: unsupported block type: %s", p, typ)
+		}
+		block["object"] = "block"
+		body, ok := block[typ].(map[string]any)
+		if !ok {
+			if block[typ] != nil {
+				return fmt.Errorf("%s: %s must be an object", p, typ)
+			}
+			// divider などの中身のないブロックは {} を省略できる
+			block[typ] = map[string]any{}
+			continue
+		}
+		if children, ok := body["children"].([]any); ok {
+			if err := normalizeBlocksJSON(children, p+"."+typ+".children"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jomei/notionapi"
+)
+
+// runArchive moves pages to the trash (archive) or restores them from it
+// (restore).
+func runArchive(name string, args []string, archived bool) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "print the Notion API requests that would archive or restore the pages instead of sending them")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: notion-dfs %s [--dry-run] <page-id>...\n", name)
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		exit(1)
+	}
+
+	if *dryRun {
+		enableDryRun()
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	for _, arg := range fs.Args() {
+		// properties を省略すると null が送られてしまうため、空のオブジェクトにする
+		page, err := client.Page.Update(ctx, notionapi.PageID(formatPageID(arg)), &notionapi.PageUpdateRequest{
+			Properties: notionapi.Properties{},
+			Archived:   archived,
+		})
+		if err != nil {
+			exitWithNotionError("Error updating page", err)
+		}
+		fmt.Println(page.URL)
+	}
+}
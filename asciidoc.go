@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// asciidocRenderer renders a block tree as AsciiDoc (for Antora/Asciidoctor).
+// AsciiDoc has no indentation, so blocks nested in list items are attached
+// with list continuations and other nested blocks follow their parent.
+type asciidocRenderer struct {
+	stripVolatile bool
+	// nest は区切りブロック（====）の入れ子の深さ。内側のブロックほど区切りを長くする
+	nest int
+}
+
+// writeAsciiDoc writes the page title, the page's blocks and the summary if
+// given as an AsciiDoc document.
+func writeAsciiDoc(w io.Writer, title string, tree *PageTree, summary string, stripVolatile bool) error {
+	r := &asciidocRenderer{stripVolatile: stripVolatile}
+	fmt.Fprintf(w, "= %s\n\n", asciidocEscape(title))
+	r.blocks(w, tree.Root.Children, 0)
+	if summary != "" {
+		fmt.Fprint(w, "\n== AI による要約\n")
+		for _, para := range strings.Split(strings.TrimSpace(summary), "\n\n") {
+			fmt.Fprintf(w, "\n%s\n", asciidocParagraph(asciidocEscape(para)))
+		}
+	}
+	return nil
+}
+
+// asciidocListMarker はリスト項目の記号を返します（リスト項目でなければ空文字列）
+func asciidocListMarker(block notionapi.Block) string {
+	switch block.(type) {
+	case *notionapi.BulletedListItemBlock, *notionapi.ToDoBlock:
+		return "*"
+	case *notionapi.NumberedListItemBlock:
+		return "."
+	}
+	return ""
+}
+
+// asciidocFlow は子ブロックを入れ子にできないブロック（段落・見出し・カラムなど）の
+// 子ブロックを、そのブロックの直後の兄弟として並べ直します
+func asciidocFlow(nodes []*BlockNode) []*BlockNode {
+	var flow []*BlockNode
+	for _, node := range nodes {
+		switch node.Block.(type) {
+		case *notionapi.BulletedListItemBlock, *notionapi.NumberedListItemBlock, *notionapi.ToDoBlock,
+			*notionapi.ToggleBlock, *notionapi.QuoteBlock, *notionapi.CalloutBlock, *notionapi.TableBlock:
+			flow = append(flow, node)
+			continue
+		case *notionapi.ParagraphBlock:
+			if len(node.Block.(*notionapi.ParagraphBlock).Paragraph.RichText) > 0 {
+				flow = append(flow, node)
+			}
+		case *notionapi.ColumnListBlock, *notionapi.ColumnBlock:
+		default:
+			flow = append(flow, node)
+		}
+		flow = append(flow, asciidocFlow(node.Children)...)
+	}
+	return flow
+}
+
+// blocks は兄弟ブロックを出力します。listDepth はリスト項目の入れ子の深さ（0ならリストの外）
+func (r *asciidocRenderer) blocks(w io.Writer, nodes []*BlockNode, listDepth int) {
+	prev := ""
+	for i, node := range asciidocFlow(nodes) {
+		marker := asciidocListMarker(node.Block)
+		if listDepth == 0 {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			// 種類の違うリストが続くと入れ子と解釈されるため、空のコメントで区切る
+			if marker != "" && prev != "" && marker != prev {
+				fmt.Fprint(w, "//-\n\n")
+			}
+		} else if marker == "" {
+			// リスト項目の中のブロックはリスト継続（+）でつなぐ
+			fmt.Fprintln(w, "+")
+		}
+		r.block(w, node, listDepth)
+		prev = marker
+	}
+}
+
+func (r *asciidocRenderer) block(w io.Writer, node *BlockNode, listDepth int) {
+	switch b := node.Block.(type) {
+	case *notionapi.ParagraphBlock:
+		fmt.Fprintln(w, asciidocParagraph(r.richText(b.Paragraph.RichText)))
+
+	case *notionapi.Heading1Block:
+		r.heading(w, 2, b.Heading1.RichText, listDepth)
+
+	case *notionapi.Heading2Block:
+		r.heading(w, 3, b.Heading2.RichText, listDepth)
+
+	case *notionapi.Heading3Block:
+		r.heading(w, 4, b.Heading3.RichText, listDepth)
+
+	case *notionapi.BulletedListItemBlock:
+		r.listItem(w, "*", "", b.BulletedListItem.RichText, node.Children, listDepth)
+
+	case *notionapi.NumberedListItemBlock:
+		r.listItem(w, ".", "", b.NumberedListItem.RichText, node.Children, listDepth)
+
+	case *notionapi.ToDoBlock:
+		checkbox := "[ ] "
+		if b.ToDo.Checked {
+			checkbox = "[x] "
+		}
+		r.listItem(w, "*", checkbox, b.ToDo.RichText, node.Children, listDepth)
+
+	case *notionapi.ImageBlock:
+		src := ""
+		if b.Image.Type == "external" {
+			src = b.Image.External.URL
+		} else if b.Image.Type == "file" {
+			src = b.Image.File.URL
+			if r.stripVolatile {
+				src = renderer.StripURLSignature(src)
+			}
+		}
+		fmt.Fprintf(w, "image::%s[%s]\n", src, asciidocAttribute(renderer.PlainText(b.Image.Caption)))
+
+	case *notionapi.CodeBlock:
+		// キャプションはブロックのタイトル（.タイトル）にする
+		if caption := strings.TrimSpace(renderer.PlainText(b.Code.Caption)); caption != "" {
+			fmt.Fprintf(w, ".%s\n", caption)
+		}
+		// 図は Asciidoctor Diagram のブロックにする
+		if typ := renderer.DiagramType(b.Code); typ != "" {
+			fmt.Fprintf(w, "[%s]\n....\n%s\n....\n", typ, renderer.PlainText(b.Code.RichText))
+			break
+		}
+		fmt.Fprintf(w, "[source,%s]\n----\n%s\n----\n", codeLanguage(b.Code.Language), renderer.PlainText(b.Code.RichText))
+
+	case *notionapi.QuoteBlock:
+		r.delimited(w, "[quote]", "_", asciidocParagraph(r.richText(b.Quote.RichText)), node.Children)
+
+	case *notionapi.CalloutBlock:
+		icon := "💡"
+		if b.Callout.Icon != nil && b.Callout.Icon.Type == "emoji" {
+			icon = string(*b.Callout.Icon.Emoji)
+		}
+		r.delimited(w, "["+strings.ToUpper(calloutKind(b.Callout))+"]", "=", asciidocParagraph(icon+" "+r.richText(b.Callout.RichText)), node.Children)
+
+	case *notionapi.DividerBlock:
+		fmt.Fprintln(w, "'''")
+
+	case *notionapi.ToggleBlock:
+		// 折りたたみブロック（Asciidoctor 2.0 以降）としてタイトルに見出しの文を使う
+		header := "." + strings.ReplaceAll(r.richText(b.Toggle.RichText), "\n", " ") + "\n[%collapsible]"
+		r.delimited(w, header, "=", "", node.Children)
+
+	case *notionapi.TableBlock:
+		r.table(w, node.Children, b.Table.TableWidth, b.Table.HasColumnHeader)
+
+	case *notionapi.ChildPageBlock:
+		r.heading(w, 2, []notionapi.RichText{{PlainText: b.ChildPage.Title}}, listDepth)
+	}
+}
+
+// heading は見出しを出力します。リストや区切りブロックの中では見出しを置けないため、太字の段落にする
+func (r *asciidocRenderer) heading(w io.Writer, level int, richText []notionapi.RichText, listDepth int) {
+	if listDepth > 0 || r.nest > 0 {
+		fmt.Fprintf(w, "**%s**\n", r.richText(richText))
+		return
+	}
+	fmt.Fprintf(w, "%s %s\n", strings.Repeat("=", level), r.richText(richText))
+}
+
+func (r *asciidocRenderer) listItem(w io.Writer, marker, prefix string, richText []notionapi.RichText, children []*BlockNode, listDepth int) {
+	fmt.Fprintf(w, "%s %s%s\n", strings.Repeat(marker, listDepth+1), prefix, asciidocParagraph(r.richText(richText)))
+	r.blocks(w, children, listDepth+1)
+}
+
+// delimited は見出し行（header）と区切り記号（delim）で囲んだブロックを出力します
+func (r *asciidocRenderer) delimited(w io.Writer, header, delim, text string, children []*BlockNode) {
+	fence := strings.Repeat(delim, 4+r.nest)
+	fmt.Fprintf(w, "%s\n%s\n", header, fence)
+	if text != "" {
+		fmt.Fprintln(w, text)
+		if len(children) > 0 {
+			fmt.Fprintln(w)
+		}
+	}
+	r.nest++
+	r.blocks(w, children, 0)
+	r.nest--
+	fmt.Fprintln(w, fence)
+}
+
+func (r *asciidocRenderer) table(w io.Writer, rows []*BlockNode, width int, hasHeader bool) {
+	options := ""
+	if hasHeader {
+		options = `,options="header"`
+	}
+	fmt.Fprintf(w, "[cols=\"%d*\"%s]\n|===\n", max(width, 1), options)
+	for i, row := range rows {
+		tr, ok := row.Block.(*notionapi.TableRowBlock)
+		if !ok {
+			continue
+		}
+		for _, cell := range tr.TableRow.Cells {
+			fmt.Fprintf(w, "|%s\n", strings.ReplaceAll(r.richText(cell), "|", `\|`))
+		}
+		// 行の区切りが分かるように空行を入れる
+		if i < len(rows)-1 {
+			fmt.Fprintln(w)
+		}
+	}
+	fmt.Fprintln(w, "|===")
+}
+
+// richText はリッチテキストを装飾（太字・斜体・取り消し線・下線・コード）とリンクを含むAsciiDocにします
+func (r *asciidocRenderer) richText(richText []notionapi.RichText) string {
+	var sb strings.Builder
+	for _, text := range richText {
+		s := asciidocEscape(text.PlainText)
+		if s == "" {
+			continue
+		}
+		// リンクのテキストの中では属性の ] をエスケープする必要がある
+		link := text.Href != "" && !strings.HasPrefix(text.Href, "/")
+		bracket := "]"
+		if link {
+			bracket = `\]`
+		}
+		// 単語の途中でも効くように、二重の記号（unconstrained）を使う
+		if a := text.Annotations; a != nil {
+			if a.Code {
+				s = "``" + s + "``"
+			}
+			if a.Bold {
+				s = "**" + s + "**"
+			}
+			if a.Italic {
+				s = "__" + s + "__"
+			}
+			if a.Strikethrough {
+				s = "[.line-through" + bracket + "##" + s + "##"
+			}
+			if a.Underline {
+				s = "[.underline" + bracket + "##" + s + "##"
+			}
+		}
+		// ワークスペース内へのリンク（"/" で始まる）は外部からは開けないため、テキストのみにする
+		if link {
+			s = "link:++" + text.Href + "++[" + s + "]"
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+// asciidocEscape は書式として解釈される記号を含むテキストを pass:c[] で囲み、そのまま表示されるようにします
+func asciidocEscape(s string) string {
+	if !strings.ContainsAny(s, "*_`#^~+{[]") {
+		return s
+	}
+	return "pass:c[" + strings.ReplaceAll(s, "]", `\]`) + "]"
+}
+
+// asciidocAttribute はブロックマクロの属性（画像の代替テキストなど）に使える値にします
+func asciidocAttribute(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if strings.ContainsAny(s, ",=]\"") {
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+	return s
+}
+
+// asciidocBlockStart は行頭にあるとリスト・見出し・ブロックの開始などと解釈される記法
+var asciidocBlockStart = regexp.MustCompile(`^(\s|[*.=\-/|:<>'"+]|\d+\.|[A-Z]+:)`)
+
+// asciidocParagraph は段落の各行を、行頭の記号がブロックの記法と解釈されないようにし、
+// 改行を強制改行（+）にします
+func asciidocParagraph(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if asciidocBlockStart.MatchString(line) {
+			line = "{empty}" + line
+		}
+		if line == "" {
+			line = "{empty}"
+		}
+		if i < len(lines)-1 {
+			line += " +"
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
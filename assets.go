@@ -0,0 +1,450 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	_ "golang.org/x/image/webp"
+
+	"notion-dfs/renderer"
+)
+
+// assetDownloader saves files hosted by Notion (whose URLs expire) next to
+// the exported Markdown and returns links to the local copies.
+type assetDownloader struct {
+	ctx context.Context
+	// dir は保存先のディレクトリ
+	dir string
+	// link は Markdown ファイルから dir への相対パス（同じディレクトリなら空）
+	link string
+
+	store *assetStore
+	// files は保存したファイルのパス（アップロード用）
+	files []string
+	// refs はリンクを返したファイルのパス（ページが参照するファイルとして manifest.json に書く）
+	refs []string
+}
+
+// assetStore is the file names used in a directory, shared by the
+// downloaders of all pages saving into it, which may run concurrently.
+type assetStore struct {
+	mu sync.Mutex
+	// names は署名を除いたURL（save では名前）から保存したファイル名への対応
+	names map[string]string
+	used  map[string]bool
+	// pending はダウンロード中のURL。終わると閉じる（同じファイルを同時に2回ダウンロードしない）
+	pending map[string]chan struct{}
+	// hashNames は内容のハッシュをファイル名にする（--asset-names hash）。同じ内容のファイルは1つだけ保存する
+	hashNames bool
+	// optimizer はダウンロードした画像を縮小・変換する（--image-*）。nil なら何もしない
+	optimizer *imageOptimizer
+}
+
+func newAssetDownloader(ctx context.Context, dir, link string) *assetDownloader {
+	return &assetDownloader{
+		ctx:  ctx,
+		dir:  dir,
+		link: link,
+		store: &assetStore{
+			names:   make(map[string]string),
+			used:    make(map[string]bool),
+			pending: make(map[string]chan struct{}),
+		},
+	}
+}
+
+// useContentHashes は内容のSHA-256（先頭16文字）と拡張子をファイル名にします。URLが違っても内容が同じ画像は1つのファイルになる
+func (a *assetDownloader) useContentHashes() {
+	a.store.mu.Lock()
+	defer a.store.mu.Unlock()
+	a.store.hashNames = true
+}
+
+// optimizeImages はダウンロードした画像を o で縮小・変換してから保存するようにします
+func (a *assetDownloader) optimizeImages(o *imageOptimizer) {
+	a.store.mu.Lock()
+	defer a.store.mu.Unlock()
+	a.store.optimizer = o
+}
+
+// forPage は保存先とファイル名の対応を共有し、リンクと保存・参照したファイルの記録はページごとに分けたダウンローダーを返します
+func (a *assetDownloader) forPage(link string) *assetDownloader {
+	return &assetDownloader{ctx: a.ctx, dir: a.dir, link: link, store: a.store}
+}
+
+// fileNames は保存したファイル名の対応のコピーを返します（チェックポイント用）
+func (a *assetDownloader) fileNames() map[string]string {
+	a.store.mu.Lock()
+	defer a.store.mu.Unlock()
+	names := make(map[string]string, len(a.store.names))
+	for key, name := range a.store.names {
+		names[key] = name
+	}
+	return names
+}
+
+// restoreFileNames は前回の実行で保存したファイル名を使うようにします
+func (a *assetDownloader) restoreFileNames(names map[string]string) {
+	a.store.mu.Lock()
+	defer a.store.mu.Unlock()
+	for key, name := range names {
+		a.store.names[key] = name
+		a.store.used[name] = true
+	}
+}
+
+// localize downloads the file once and returns the link to use in Markdown.
+// On failure it logs a warning and falls back to the original URL.
+func (a *assetDownloader) localize(rawURL string) string {
+	key := renderer.StripURLSignature(rawURL)
+	s := a.store
+	s.mu.Lock()
+	name, ok := s.names[key]
+	for !ok {
+		done, busy := s.pending[key]
+		if !busy {
+			break
+		}
+		// ほかのページがダウンロードしているので終わるのを待つ
+		s.mu.Unlock()
+		<-done
+		s.mu.Lock()
+		name, ok = s.names[key]
+	}
+	if !ok {
+		done := make(chan struct{})
+		s.pending[key] = done
+		s.mu.Unlock()
+		var err error
+		name, err = a.download(rawURL, key)
+		s.mu.Lock()
+		delete(s.pending, key)
+		close(done)
+		if err != nil {
+			s.mu.Unlock()
+			log.Printf("warning: failed to download %s: %v", key, err)
+			return rawURL
+		}
+		s.names[key] = name
+	}
+	s.mu.Unlock()
+	a.ref(name)
+	return (&url.URL{Path: path.Join(a.link, name)}).String()
+}
+
+// ref はページが参照するファイルとして記録します
+func (a *assetDownloader) ref(name string) {
+	p := filepath.Join(a.dir, name)
+	for _, r := range a.refs {
+		if r == p {
+			return
+		}
+	}
+	a.refs = append(a.refs, p)
+}
+
+func (a *assetDownloader) download(rawURL, key string) (string, error) {
+	req, err := http.NewRequestWithContext(a.ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	a.store.mu.Lock()
+	hashNames, optimizer := a.store.hashNames, a.store.optimizer
+	a.store.mu.Unlock()
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return "", err
+	}
+	var body io.Reader = resp.Body
+	name := assetFileName(key, resp.Header.Get("Content-Type"))
+	if optimizer != nil {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", err
+		}
+		optimized, optimizedName, err := optimizer.optimize(data, name)
+		if err != nil {
+			log.Printf("warning: could not optimize the image %s: %v; saving it as it is", name, err)
+		} else {
+			data, name = optimized, optimizedName
+		}
+		body = bytes.NewReader(data)
+	}
+	if hashNames {
+		return a.saveHashed(body, name)
+	}
+	a.store.mu.Lock()
+	name = a.uniqueName(name)
+	a.store.mu.Unlock()
+	p := filepath.Join(a.dir, name)
+	f, err := os.Create(p)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	a.files = append(a.files, p)
+	return name, nil
+}
+
+// saveHashed は内容を一時ファイルに書きながらハッシュを計算し、<ハッシュ><nameの拡張子> として保存します。
+// 同じ内容のファイルを保存済みなら一時ファイルを消してそれを使う
+func (a *assetDownloader) saveHashed(r io.Reader, name string) (string, error) {
+	tmp, err := os.CreateTemp(a.dir, ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	file := hex.EncodeToString(h.Sum(nil))[:16] + strings.ToLower(path.Ext(name))
+
+	a.store.mu.Lock()
+	defer a.store.mu.Unlock()
+	if a.store.used[file] {
+		return file, nil
+	}
+	p := filepath.Join(a.dir, file)
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", err
+	}
+	a.store.used[file] = true
+	a.files = append(a.files, p)
+	return file, nil
+}
+
+// saved は save で保存済みのファイルへのリンクを返します
+func (a *assetDownloader) saved(name string) (string, bool) {
+	a.store.mu.Lock()
+	file, ok := a.store.names[name]
+	a.store.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	a.ref(file)
+	return (&url.URL{Path: path.Join(a.link, file)}).String(), true
+}
+
+// save はダウンロードしたものでないファイル（図のSVGなど）を name で保存し、リンクを返します。
+// 同じ名前で保存済みなら（並行して書き出したほかのページが保存した場合）それを使う
+func (a *assetDownloader) save(name string, data []byte) (string, error) {
+	s := a.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.names[name]
+	if !ok {
+		write := true
+		if s.hashNames {
+			sum := sha256.Sum256(data)
+			file = hex.EncodeToString(sum[:])[:16] + strings.ToLower(path.Ext(name))
+			write = !s.used[file]
+			s.used[file] = true
+		} else {
+			file = a.uniqueName(name)
+		}
+		if write {
+			if err := os.MkdirAll(a.dir, 0o755); err != nil {
+				return "", err
+			}
+			p := filepath.Join(a.dir, file)
+			if err := os.WriteFile(p, data, 0o644); err != nil {
+				return "", err
+			}
+			a.files = append(a.files, p)
+		}
+		s.names[name] = file
+	}
+	a.ref(file)
+	return (&url.URL{Path: path.Join(a.link, file)}).String(), nil
+}
+
+// fetchURL はファイルをメモリに読み込み、内容と Content-Type を返します（ファイルに保存しない出力形式で使う）
+func fetchURL(ctx context.Context, rawURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// urlFileName はURLのファイル名です（署名などのクエリは除く）。ファイル名がなければ fallback を返す
+func urlFileName(rawURL, fallback string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if name := path.Base(u.Path); name != "." && name != "/" {
+			if unescaped, err := url.PathUnescape(name); err == nil {
+				return unescaped
+			}
+			return name
+		}
+	}
+	return fallback
+}
+
+// fetchRasterImage は画像をダウンロードし、PDFやWordに埋め込める形式（JPEGはそのまま、それ以外は8bitのPNG）にして、
+// 形式（"JPG" または "PNG"）と幅・高さ（ピクセル）とともに返します
+func fetchRasterImage(ctx context.Context, rawURL string) ([]byte, string, int, int, error) {
+	data, _, err := fetchURL(ctx, rawURL)
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	if config.Width == 0 || config.Height == 0 {
+		return nil, "", 0, 0, fmt.Errorf("empty image")
+	}
+	if format == "jpeg" {
+		return data, "JPG", config.Width, config.Height, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, 0, err
+	}
+	rgba := image.NewNRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, rgba); err != nil {
+		return nil, "", 0, 0, err
+	}
+	return buf.Bytes(), "PNG", config.Width, config.Height, nil
+}
+
+// uniqueName は同じ名前のファイルが既にあれば連番を付けて重複を避けます。store.mu を持って呼ぶ
+func (a *assetDownloader) uniqueName(name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; a.store.used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	a.store.used[candidate] = true
+	return candidate
+}
+
+// assetFileName はURLの末尾からファイル名を決め、拡張子がなければ Content-Type から補います
+func assetFileName(rawURL, contentType string) string {
+	name := "asset"
+	if u, err := url.Parse(rawURL); err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			name = base
+		}
+	}
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if path.Ext(name) == "" {
+		if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+			if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+				name += exts[0]
+			}
+		}
+	}
+	return name
+}
+
+// embeddedImages は出力ファイル（EPUB・Confluence の添付ファイルなど）に埋め込む画像を集めます
+type embeddedImages struct {
+	ctx context.Context
+	// prefix は埋め込んだ画像を参照するパスの前に付ける文字列（EPUB なら "images/"）
+	prefix string
+	items  []embeddedImage
+	// byURL は署名を除いたURLから参照するパスへの対応
+	byURL map[string]string
+}
+
+type embeddedImage struct {
+	id, href, mediaType string
+	data                []byte
+}
+
+func newEmbeddedImages(ctx context.Context, prefix string) *embeddedImages {
+	return &embeddedImages{ctx: ctx, prefix: prefix, byURL: make(map[string]string)}
+}
+
+// add は画像をダウンロードして参照するパスを返します。失敗した場合は警告を表示して元のURLを返す
+func (e *embeddedImages) add(rawURL string) string {
+	key := renderer.StripURLSignature(rawURL)
+	if href, ok := e.byURL[key]; ok {
+		return href
+	}
+	data, contentType, err := fetchURL(e.ctx, rawURL)
+	if err == nil {
+		contentType, _, err = mime.ParseMediaType(contentType)
+		if err != nil || !strings.HasPrefix(contentType, "image/") {
+			contentType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+		}
+		if !strings.HasPrefix(contentType, "image/") {
+			err = fmt.Errorf("not an image (%s)", contentType)
+		}
+	}
+	if err != nil {
+		log.Printf("warning: failed to embed image %s: %v", key, err)
+		return rawURL
+	}
+
+	ext := ".img"
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		ext = exts[0]
+	}
+	id := fmt.Sprintf("image%03d", len(e.items)+1)
+	href := e.prefix + id + ext
+	e.items = append(e.items, embeddedImage{id: id, href: href, mediaType: contentType, data: data})
+	e.byURL[key] = href
+	return href
+}
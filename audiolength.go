@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// fallbackAudioBitrate は長さを読み取れない形式の音声の、長さの見積もりに使うビットレート（bps）。
+// 音声のメモとしては低めの値にして、--max-cost の見積もりが実際より少なくならないようにする
+const fallbackAudioBitrate = 32000
+
+// audioDuration returns the length of an audio file, which the transcription
+// API bills by. It is read from the headers of WAV, MP3, MP4/M4A, Ogg
+// (Opus and Vorbis) and FLAC files; for other formats, or files it cannot
+// parse, it is estimated from the size at fallbackAudioBitrate and exact is
+// false.
+func audioDuration(data []byte) (d time.Duration, exact bool) {
+	var ok bool
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		d, ok = wavDuration(data)
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		d, ok = mp4Duration(data)
+	case bytes.HasPrefix(data, []byte("OggS")):
+		d, ok = oggDuration(data)
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		d, ok = flacDuration(data)
+	default:
+		d, ok = mp3Duration(data)
+	}
+	if ok && d > 0 {
+		return d, true
+	}
+	return time.Duration(float64(len(data)) * 8 / fallbackAudioBitrate * float64(time.Second)), false
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// wavDuration は fmt チャンクの1秒あたりのバイト数と data チャンクの大きさから長さを求めます
+func wavDuration(data []byte) (time.Duration, bool) {
+	var byteRate uint32
+	for p := 12; p+8 <= len(data); {
+		id, size := string(data[p:p+4]), binary.LittleEndian.Uint32(data[p+4:p+8])
+		body := data[p+8:]
+		switch id {
+		case "fmt ":
+			if len(body) < 12 {
+				return 0, false
+			}
+			byteRate = binary.LittleEndian.Uint32(body[8:12])
+		case "data":
+			if byteRate == 0 {
+				return 0, false
+			}
+			// 書き込み中のファイルなどでは大きさが実際より大きいため、ファイルの残りまでにする
+			n := min(int64(size), int64(len(body)))
+			return secondsDuration(float64(n) / float64(byteRate)), true
+		}
+		p += 8 + int(size) + int(size&1)
+	}
+	return 0, false
+}
+
+// mp4Duration は moov の mvhd の duration と timescale から長さを求めます
+func mp4Duration(data []byte) (time.Duration, bool) {
+	moov, ok := mp4Box(data, "moov")
+	if !ok {
+		return 0, false
+	}
+	mvhd, ok := mp4Box(moov, "mvhd")
+	if !ok || len(mvhd) < 20 {
+		return 0, false
+	}
+	var timescale uint32
+	var duration uint64
+	if mvhd[0] == 1 {
+		if len(mvhd) < 32 {
+			return 0, false
+		}
+		timescale, duration = binary.BigEndian.Uint32(mvhd[20:24]), binary.BigEndian.Uint64(mvhd[24:32])
+	} else {
+		timescale, duration = binary.BigEndian.Uint32(mvhd[12:16]), uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	}
+	if timescale == 0 {
+		return 0, false
+	}
+	return secondsDuration(float64(duration) / float64(timescale)), true
+}
+
+// mp4Box は data の中の typ のボックスの中身を返します
+func mp4Box(data []byte, typ string) ([]byte, bool) {
+	for p := 0; p+8 <= len(data); {
+		size, header := uint64(binary.BigEndian.Uint32(data[p:p+4])), uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data) - p)
+		case 1:
+			if p+16 > len(data) {
+				return nil, false
+			}
+			size, header = binary.BigEndian.Uint64(data[p+8:p+16]), 16
+		}
+		if size < header || size > uint64(len(data)-p) {
+			return nil, false
+		}
+		if string(data[p+4:p+8]) == typ {
+			return data[p+int(header) : p+int(size)], true
+		}
+		p += int(size)
+	}
+	return nil, false
+}
+
+// oggDuration は最後のページのグラニュール位置（サンプル数）とサンプリングレートから長さを求めます
+func oggDuration(data []byte) (time.Duration, bool) {
+	var rate, preSkip float64
+	if i := bytes.Index(data, []byte("OpusHead")); i >= 0 && i+12 <= len(data) {
+		// Opus のグラニュール位置は常に48kHzで数える
+		rate, preSkip = 48000, float64(binary.LittleEndian.Uint16(data[i+10:i+12]))
+	} else if i := bytes.Index(data, []byte("\x01vorbis")); i >= 0 && i+16 <= len(data) {
+		rate = float64(binary.LittleEndian.Uint32(data[i+12 : i+16]))
+	}
+	last := bytes.LastIndex(data, []byte("OggS"))
+	if rate == 0 || last < 0 || last+14 > len(data) {
+		return 0, false
+	}
+	granule := float64(binary.LittleEndian.Uint64(data[last+6 : last+14]))
+	return secondsDuration((granule - preSkip) / rate), granule > preSkip
+}
+
+// flacDuration は STREAMINFO のサンプリングレートと総サンプル数から長さを求めます
+func flacDuration(data []byte) (time.Duration, bool) {
+	// "fLaC"、メタデータのブロックのヘッダー（4バイト）の後の STREAMINFO の10バイト目から
+	if len(data) < 8+18 || data[4]&0x7f != 0 {
+		return 0, false
+	}
+	info := data[8:]
+	rate := uint64(info[10])<<12 | uint64(info[11])<<4 | uint64(info[12])>>4
+	total := uint64(info[13]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(info[14:18]))
+	if rate == 0 || total == 0 {
+		return 0, false
+	}
+	return secondsDuration(float64(total) / float64(rate)), true
+}
+
+// MP3 のフレームのヘッダーのビットレート（kbps）。[MPEG-1か][レイヤー1〜3][ビットレートの番号]
+var mp3Bitrates = [2][3][16]int{
+	{ // MPEG-2・2.5
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+	{ // MPEG-1
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+}
+
+// MP3 のサンプリングレート（Hz）。[バージョンのビット][サンプリングレートの番号]
+var mp3SampleRates = [4][3]int{
+	{11025, 12000, 8000},  // MPEG-2.5
+	{},                    // 予約
+	{22050, 24000, 16000}, // MPEG-2
+	{44100, 48000, 32000}, // MPEG-1
+}
+
+// mp3Duration は ID3v2 タグの後のフレームをたどり、フレームごとのサンプル数を合計して長さを求めます。
+// ほかの形式のデータをMP3と誤らないよう、フレームがファイルのほぼ全体を占める場合だけ ok にする
+func mp3Duration(data []byte) (time.Duration, bool) {
+	start := 0
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+		start = 10 + size
+		if data[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+	// タグの後の詰め物は読み飛ばす
+	for limit := min(start+4096, len(data)-1); start < limit && !(data[start] == 0xff && data[start+1]&0xe0 == 0xe0); start++ {
+	}
+	var total float64
+	p := start
+	for p+4 <= len(data) {
+		samples, length, rate := mp3Frame(data[p : p+4])
+		if length == 0 {
+			break
+		}
+		total += float64(samples) / float64(rate)
+		p += length
+	}
+	// 末尾の ID3v1 などのタグの分だけ残るのはかまわない
+	if p <= start || float64(min(p, len(data))-start) < 0.9*float64(len(data)-start) {
+		return 0, false
+	}
+	return secondsDuration(total), true
+}
+
+// mp3Frame はフレームのヘッダーからサンプル数・フレームの長さ・サンプリングレートを返します。フレームでなければ長さは0
+func mp3Frame(h []byte) (samples, length, rate int) {
+	if h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return 0, 0, 0
+	}
+	version, layer := int(h[1]>>3&3), 4-int(h[1]>>1&3)
+	bitrateIndex, rateIndex, padding := int(h[2]>>4), int(h[2]>>2&3), int(h[2]>>1&1)
+	if version == 1 || layer == 4 || rateIndex == 3 || bitrateIndex == 0 || bitrateIndex == 15 {
+		return 0, 0, 0
+	}
+	mpeg1 := 0
+	if version == 3 {
+		mpeg1 = 1
+	}
+	bitrate := mp3Bitrates[mpeg1][layer-1][bitrateIndex] * 1000
+	rate = mp3SampleRates[version][rateIndex]
+	switch {
+	case layer == 1:
+		return 384, (12*bitrate/rate + padding) * 4, rate
+	case layer == 3 && mpeg1 == 0:
+		return 576, 72*bitrate/rate + padding, rate
+	}
+	return 1152, 144*bitrate/rate + padding, rate
+}
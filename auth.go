@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// credential is a secret that is read from an environment variable or,
+// when the variable is not set, from the OS keychain. The environment
+// variable always wins so that CI can inject tokens without a keychain.
+type credential struct {
+	env     string
+	account string
+	label   string
+}
+
+var (
+	notionTokenCredential = credential{env: "NOTION_API_TOKEN", account: "notion", label: "Notion API token"}
+	openAIKeyCredential   = credential{env: "OPENAI_API_KEY", account: "openai", label: "OpenAI API key"}
+	credentials           = map[string]credential{"notion": notionTokenCredential, "openai": openAIKeyCredential}
+)
+
+// keychainService はキーチェーンに保存する項目のサービス名
+const keychainService = "notion-dfs"
+
+// keychainValues はキーチェーンから読み込んだ値（1回の実行で何度もコマンドを起動しないようにする）
+var (
+	keychainMu     sync.Mutex
+	keychainValues = make(map[string]string)
+)
+
+// get は値と、その取得元（"environment" または "keychain"）を返します。どちらにもなければ空文字列
+func (c credential) get() (value, source string) {
+	if v := os.Getenv(c.env); v != "" {
+		return v, "environment"
+	}
+	keychainMu.Lock()
+	defer keychainMu.Unlock()
+	v, ok := keychainValues[c.account]
+	if !ok {
+		// キーチェーンが使えない環境では、設定されていないものとして扱う
+		v, _ = keychainGet(c.account)
+		keychainValues[c.account] = v
+	}
+	if v == "" {
+		return "", ""
+	}
+	return v, "keychain"
+}
+
+// runAuth stores tokens in the OS keychain (login), removes them (logout) or
+// shows where each token is read from (status).
+func runAuth(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs auth login [notion|openai]")
+		fmt.Fprintln(os.Stderr, "       notion-dfs auth logout [notion|openai]")
+		fmt.Fprintln(os.Stderr, "       notion-dfs auth status")
+		fmt.Fprintln(os.Stderr, "\nlogin reads the token from stdin. NOTION_API_TOKEN and OPENAI_API_KEY take precedence over the keychain.")
+		fmt.Fprintln(os.Stderr, "The token is saved in the macOS keychain, the Windows Credential Manager or the Secret Service (secret-tool) elsewhere.")
+	}
+	if len(args) < 1 || len(args) > 2 || (args[0] == "status" && len(args) != 1) {
+		usage()
+		exit(1)
+	}
+	names := []string{"notion", "openai"}
+	if len(args) == 2 {
+		if _, ok := credentials[args[1]]; !ok {
+			usage()
+			exit(1)
+		}
+		names = []string{args[1]}
+	}
+
+	switch args[0] {
+	case "login":
+		if len(args) == 1 {
+			names = []string{"notion"}
+		}
+		authLogin(credentials[names[0]])
+	case "logout":
+		for _, name := range names {
+			c := credentials[name]
+			if err := keychainDelete(c.account); err != nil {
+				fatalf("Error removing %s from the keychain: %v", c.label, err)
+			}
+			fmt.Printf("removed %s from the keychain\n", c.label)
+		}
+	case "status":
+		for _, name := range names {
+			c := credentials[name]
+			switch _, source := c.get(); source {
+			case "environment":
+				fmt.Printf("✓ %s: %s\n", c.label, c.env)
+			case "keychain":
+				fmt.Printf("✓ %s: keychain\n", c.label)
+			default:
+				fmt.Printf("✗ %s: not set\n", c.label)
+			}
+		}
+	default:
+		usage()
+		exit(1)
+	}
+}
+
+// authLogin はトークンを標準入力から読み込み、キーチェーンに保存します。
+// Notion のトークンは保存する前に有効か確かめる
+func authLogin(c credential) {
+	if isTerminal(os.Stdin) {
+		fmt.Fprintf(os.Stderr, "%s: ", c.label)
+		// 入力したトークンを画面に表示しない
+		if err := stty("-echo"); err == nil {
+			defer func() {
+				stty("echo")
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		fatalf("Error reading token: %v", err)
+	}
+	token := strings.TrimSpace(line)
+	if token == "" {
+		fatal("the token is empty")
+	}
+
+	if c == notionTokenCredential {
+		me, err := newNotionClientWithToken(token).User.Me(context.Background())
+		if err != nil {
+			exitWithNotionError("Error validating token", err)
+		}
+		fmt.Fprintf(os.Stderr, "token is valid: %s\n", me.Name)
+	}
+	if err := keychainSet(c.account, c.label, token); err != nil {
+		fatalf("Error saving %s to the keychain: %v", c.label, err)
+	}
+	fmt.Fprintf(os.Stderr, "saved %s to the keychain", c.label)
+	if os.Getenv(c.env) != "" {
+		fmt.Fprintf(os.Stderr, " (%s is set and takes precedence)", c.env)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func stty(arg string) error {
+	if runtime.GOOS == "windows" {
+		return errors.ErrUnsupported
+	}
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// errKeychainUnsupported はキーチェーンに対応していないOSで返されます
+var errKeychainUnsupported = fmt.Errorf("the keychain is not supported on %s; set the environment variables instead", runtime.GOOS)
+
+// keychainGet はキーチェーンから値を読み込みます。macOS では security コマンド、Windows では
+// 資格情報マネージャー、それ以外では libsecret の secret-tool コマンド（GNOME Keyring や KWallet）を使う
+func keychainGet(account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keychainService, "-a", account, "-w")
+	case "windows":
+		return credentialManagerGet(account)
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "service", keychainService, "account", account)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func keychainSet(account, label, secret string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// -w の値をコマンドライン引数で渡すと ps から見えてしまうため、security -i に標準入力でコマンドを渡す
+		if strings.ContainsAny(secret, " \t\r\n\"'\\") {
+			return errors.New("the token contains whitespace or quotes")
+		}
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -l \"%s (%s)\" -w %s\n", keychainService, account, keychainService, label, secret))
+	case "windows":
+		return credentialManagerSet(account, label, secret)
+	default:
+		cmd = exec.Command("secret-tool", "store", "--label", keychainService+" ("+label+")", "service", keychainService, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	}
+	if err := runKeychain(cmd); err != nil {
+		return err
+	}
+	// security -i ではコマンドの失敗が終了コードに表れないことがあるため、読み戻して確かめる
+	if got, err := keychainGet(account); err != nil || got != secret {
+		return errors.New("the token could not be read back from the keychain")
+	}
+	return nil
+}
+
+// keychainDelete はキーチェーンから値を削除します。保存されていなければ何もしない
+func keychainDelete(account string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := keychainGet(account); err != nil {
+			return nil
+		}
+		cmd = exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", account)
+	case "windows":
+		return credentialManagerDelete(account)
+	default:
+		cmd = exec.Command("secret-tool", "clear", "service", keychainService, "account", account)
+	}
+	return runKeychain(cmd)
+}
+
+func runKeychain(cmd *exec.Cmd) error {
+	out, err := cmd.CombinedOutput()
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%s was not found; install it or set the environment variables instead", cmd.Args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// backupFilePattern はバックアップが管理するファイル名（ハイフンなしのページID）
+var backupFilePattern = regexp.MustCompile(`^[0-9a-f]{32}\.md$`)
+
+// backupPage is one exported page and the sub-pages found under it.
+type backupPage struct {
+	ID       string
+	Title    string
+	Children []*backupPage
+}
+
+func (p *backupPage) fileName() string {
+	return strings.ReplaceAll(p.ID, "-", "") + ".md"
+}
+
+// runBackup exports pages into a git repository and commits the result, so
+// that a scheduled run keeps the full history of the Notion content.
+func runBackup(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	repo := fs.String("repo", "./notion-backup", "git repository to export into (created if missing)")
+	recursive := fs.Bool("recursive", true, "also export sub-pages")
+	upload := fs.String("upload", "", "also upload the exported files to s3://bucket/prefix or gs://bucket/prefix")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs backup [flags] <page-id>...")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		exit(1)
+	}
+
+	var target *uploadTarget
+	if *upload != "" {
+		t, err := parseUploadTarget(*upload)
+		if err != nil {
+			fatal(err)
+		}
+		target = t
+	}
+
+	if err := ensureGitRepo(*repo); err != nil {
+		fatalf("Error preparing repository: %v", err)
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	b := &backupRun{client: client, dir: *repo, recursive: *recursive, written: make(map[string]string)}
+
+	var roots []*backupPage
+	for _, arg := range fs.Args() {
+		page, err := b.exportPage(ctx, notionapi.BlockID(formatPageID(arg)), "")
+		if err != nil {
+			exitWithNotionError("Error exporting page", err)
+		}
+		roots = append(roots, page)
+	}
+
+	removed, err := b.removeStale()
+	if err != nil {
+		fatalf("Error removing stale files: %v", err)
+	}
+	if err := writeBackupIndex(*repo, roots); err != nil {
+		fatalf("Error writing index: %v", err)
+	}
+
+	committed, err := b.commit(removed)
+	if err != nil {
+		fatalf("Error committing backup: %v", err)
+	}
+	if !committed {
+		fmt.Println("No changes since the last backup.")
+	}
+
+	if target != nil {
+		files := []string{filepath.Join(*repo, "index.md")}
+		for name := range b.written {
+			files = append(files, filepath.Join(*repo, name))
+		}
+		sort.Strings(files)
+		if err := target.upload(ctx, *repo, files); err != nil {
+			fatalf("Error uploading: %v", err)
+		}
+	}
+}
+
+// backupRun は1回のバックアップで書き出したファイルを記録します
+type backupRun struct {
+	client    *notionapi.Client
+	dir       string
+	recursive bool
+	// written はファイル名からページタイトルへの対応
+	written map[string]string
+}
+
+func (b *backupRun) exportPage(ctx context.Context, pageID notionapi.BlockID, title string) (*backupPage, error) {
+	if title == "" {
+		t, err := fetchPageTitle(ctx, b.client, pageID)
+		if err != nil {
+			return nil, err
+		}
+		title = t
+	}
+
+	page := &backupPage{ID: string(pageID), Title: title}
+	if _, done := b.written[page.fileName()]; done {
+		return page, nil
+	}
+
+	tree, err := fetchPageTree(ctx, b.client, pageID, fetchLimits{SkipChildPages: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", title)
+	r := newMarkdownRenderer()
+	r.StripVolatile = true
+	r.PrintBlocks(&sb, tree.Root.Children, 0)
+	if err := os.WriteFile(filepath.Join(b.dir, page.fileName()), []byte(sb.String()), 0o644); err != nil {
+		return nil, err
+	}
+	b.written[page.fileName()] = title
+
+	if b.recursive {
+		for _, child := range tree.ChildPages() {
+			childPage, err := b.exportPage(ctx, child.ID, child.ChildPage.Title)
+			if err != nil {
+				return nil, err
+			}
+			page.Children = append(page.Children, childPage)
+		}
+	}
+	return page, nil
+}
+
+// removeStale は今回書き出さなかった（削除・移動された）ページのファイルを消し、
+// コミットメッセージ用にファイル名とタイトルの対応を返します
+func (b *backupRun) removeStale() (map[string]string, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	removed := make(map[string]string)
+	for _, e := range entries {
+		name := e.Name()
+		if !backupFilePattern.MatchString(name) {
+			continue
+		}
+		if _, ok := b.written[name]; ok {
+			continue
+		}
+		path := filepath.Join(b.dir, name)
+		removed[name] = readBackupTitle(path)
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// readBackupTitle はバックアップファイルの1行目（# タイトル）からタイトルを読み取ります
+func readBackupTitle(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	if sc.Scan() {
+		return strings.TrimPrefix(sc.Text(), "# ")
+	}
+	return ""
+}
+
+func writeBackupIndex(dir string, roots []*backupPage) error {
+	var sb strings.Builder
+	sb.WriteString("# Notion backup\n\n")
+	var write func(pages []*backupPage, depth int)
+	write = func(pages []*backupPage, depth int) {
+		for _, p := range pages {
+			fmt.Fprintf(&sb, "%s- [%s](%s)\n", strings.Repeat("  ", depth), p.Title, p.fileName())
+			write(p.Children, depth+1)
+		}
+	}
+	write(roots, 0)
+	return os.WriteFile(filepath.Join(dir, "index.md"), []byte(sb.String()), 0o644)
+}
+
+// commit はすべての変更をステージし、変更内容の要約をメッセージにしてコミットします。
+// 変更がなければ何もせず false を返します
+func (b *backupRun) commit(removed map[string]string) (bool, error) {
+	if _, err := runGit(b.dir, "add", "-A"); err != nil {
+		return false, err
+	}
+	status, err := runGit(b.dir, "diff", "--cached", "--name-status", "--no-renames")
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(status) == "" {
+		return false, nil
+	}
+
+	var added, updated, deleted []string
+	for _, line := range strings.Split(strings.TrimSpace(status), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !backupFilePattern.MatchString(fields[len(fields)-1]) {
+			continue
+		}
+		name := fields[len(fields)-1]
+		switch fields[0][0] {
+		case 'A':
+			added = append(added, b.written[name])
+		case 'M':
+			updated = append(updated, b.written[name])
+		case 'D':
+			deleted = append(deleted, removed[name])
+		}
+	}
+
+	msg := backupCommitMessage(time.Now(), added, updated, deleted)
+	if _, err := runGit(b.dir, "commit", "-q", "-m", msg); err != nil {
+		return false, err
+	}
+	fmt.Println(strings.SplitN(msg, "\n", 2)[0])
+	return true, nil
+}
+
+func backupCommitMessage(now time.Time, added, updated, deleted []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Notion backup %s: %d added, %d updated, %d removed\n",
+		now.Format("2006-01-02 15:04"), len(added), len(updated), len(deleted))
+
+	section := func(label string, titles []string) {
+		if len(titles) == 0 {
+			return
+		}
+		sort.Strings(titles)
+		fmt.Fprintf(&sb, "\n%s:\n", label)
+		for _, t := range titles {
+			fmt.Fprintf(&sb, "- %s\n", t)
+		}
+	}
+	section("Added", added)
+	section("Updated", updated)
+	section("Removed", deleted)
+	return sb.String()
+}
+
+// ensureGitRepo は dir がなければ作成し、gitリポジトリでなければ初期化します
+func ensureGitRepo(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	_, err := runGit(dir, "init", "-q")
+	return err
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// benchRenderers は bench で計測できる出力形式。画像を埋め込む pdf・docx は画像のダウンロードも含む
+var benchRenderers = map[string]func(ctx context.Context, w io.Writer, title string, tree *PageTree) error{
+	"markdown": func(ctx context.Context, w io.Writer, title string, tree *PageTree) error {
+		newMarkdownRenderer().PrintBlocks(w, tree.Root.Children, 0)
+		return nil
+	},
+	"asciidoc": func(ctx context.Context, w io.Writer, title string, tree *PageTree) error {
+		return writeAsciiDoc(w, title, tree, "", false)
+	},
+	"rst": func(ctx context.Context, w io.Writer, title string, tree *PageTree) error {
+		return writeRST(w, title, tree, "", false)
+	},
+	"slack": func(ctx context.Context, w io.Writer, title string, tree *PageTree) error {
+		return writeSlack(w, title, tree, "", false)
+	},
+	"confluence": func(ctx context.Context, w io.Writer, title string, tree *PageTree) error {
+		writeConfluence(w, tree, "", nil, "flatten")
+		return nil
+	},
+	"pdf": func(ctx context.Context, w io.Writer, title string, tree *PageTree) error {
+		return writePDF(ctx, w, title, tree, "")
+	},
+	"docx": func(ctx context.Context, w io.Writer, title string, tree *PageTree) error {
+		return writeDOCX(ctx, w, title, tree, "")
+	},
+}
+
+// benchResult は1つの段階の計測結果（1回あたり）
+type benchResult struct {
+	Name        string  `json:"name"`
+	Runs        int     `json:"runs"`
+	NsPerOp     int64   `json:"ns_per_op"`
+	BytesPerOp  uint64  `json:"bytes_per_op"`
+	AllocsPerOp uint64  `json:"allocs_per_op"`
+	BlocksPerS  float64 `json:"blocks_per_second"`
+}
+
+// runBench measures the fetch and render pipeline on one page: the time,
+// the bytes and the number of allocations of fetching the block tree and of
+// rendering it to each format, like a Go benchmark. Run it on responses
+// recorded with NOTION_DFS_RECORD and replayed with NOTION_DFS_REPLAY to
+// leave the network and the rate limit out of the fetch, and compare the
+// numbers before and after a change; with NOTION_DFS_CPUPROFILE or
+// NOTION_DFS_MEMPROFILE it also shows where the time and memory go.
+func runBench(args []string) {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	count := fs.Int("count", 10, "number of times to run each step")
+	formats := fs.String("formats", "markdown,asciidoc,rst,slack,confluence", "comma-separated output formats to render (also pdf and docx)")
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs bench [--count 10] [--formats markdown,...] [--json] <page-id>")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	if fs.NArg() != 1 || *count < 1 {
+		fs.Usage()
+		exit(1)
+	}
+	var names []string
+	for _, name := range strings.Split(*formats, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if benchRenderers[name] == nil {
+			fatalf("unknown format %q (expected markdown, asciidoc, rst, slack, confluence, pdf or docx)", name)
+		}
+		names = append(names, name)
+	}
+	if !replaying {
+		fmt.Fprintln(os.Stderr, "note: the fetch includes the network and the rate limit; record the page with --record and run with NOTION_DFS_REPLAY=<dir> for stable numbers")
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	pageID := notionapi.BlockID(formatPageID(fs.Arg(0)))
+	title, err := fetchPageTitle(ctx, client, pageID)
+	if err != nil {
+		exitWithNotionError("Error fetching page", err)
+	}
+
+	var tree *PageTree
+	fetch, err := benchmark("fetch", *count, func() error {
+		// 同期ブロックの一覧を使い回さず、毎回すべて取得する
+		childListsMu.Lock()
+		clear(childLists)
+		childListsMu.Unlock()
+		var err error
+		tree, err = fetchPageTree(ctx, client, pageID, fetchLimits{})
+		return err
+	})
+	if err != nil {
+		exitWithNotionError("Error fetching blocks", err)
+	}
+	blocks := len(tree.nodes)
+	results := []benchResult{fetch}
+	for _, name := range names {
+		render := benchRenderers[name]
+		r, err := benchmark("render "+name, *count, func() error {
+			return render(ctx, io.Discard, title, tree)
+		})
+		if err != nil {
+			fatalf("render %s: %v", name, err)
+		}
+		results = append(results, r)
+	}
+	for i := range results {
+		if results[i].NsPerOp > 0 {
+			results[i].BlocksPerS = float64(blocks) / (float64(results[i].NsPerOp) / float64(time.Second))
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(map[string]any{"page": pageID, "title": title, "blocks": blocks, "results": results}); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	fmt.Printf("page: %s (%s), %d blocks\n\n", title, pageID, blocks)
+	for _, r := range results {
+		fmt.Printf("%-18s %4d runs %14s/op %12d B/op %10d allocs/op %12.0f blocks/s\n",
+			r.Name, r.Runs, time.Duration(r.NsPerOp), r.BytesPerOp, r.AllocsPerOp, r.BlocksPerS)
+	}
+}
+
+// benchmark は fn を runs 回実行し、1回あたりの時間・割り当てたバイト数・割り当ての回数を返します
+func benchmark(name string, runs int, fn func() error) (benchResult, error) {
+	// 前の段階のゴミを片付けてから測る
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < runs; i++ {
+		if err := fn(); err != nil {
+			return benchResult{}, err
+		}
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	n := uint64(runs)
+	return benchResult{
+		Name:        name,
+		Runs:        runs,
+		NsPerOp:     elapsed.Nanoseconds() / int64(runs),
+		BytesPerOp:  (after.TotalAlloc - before.TotalAlloc) / n,
+		AllocsPerOp: (after.Mallocs - before.Mallocs) / n,
+	}, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// cacheDir returns the directory where local data such as previous renderings
+// is kept. NOTION_DFS_CACHE_DIR overrides the default under the user cache dir.
+func cacheDir() (string, error) {
+	if dir := os.Getenv("NOTION_DFS_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+	return filepath.Join(base, "notion-dfs"), nil
+}
+
+// responseCacheDir はメインコマンドが取得したNotion APIの応答を保存するディレクトリ（--offline で使う）
+func responseCacheDir() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "responses"), nil
+}
+
+// resultCache keeps the results of slow or paid API calls, such as image
+// descriptions and transcripts, in the cache directory, keyed by the model
+// and the hash of the input, so that the same input is not sent again on the
+// next run. Each result is a file of its own, named after the hash of its
+// key and replaced atomically, so that saving a result does not rewrite the
+// others, processes running at the same time do not drop each other's
+// results, and a file left broken by a killed process only loses that one
+// result.
+type resultCache struct {
+	dir string
+}
+
+// resultCacheEntry は1つの結果のファイルの内容。キーも保存し、ハッシュの衝突で別の結果を返さないようにする
+type resultCacheEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// openResultCache はキャッシュディレクトリの name のディレクトリを開きます。以前の形式の
+// name.json（すべての結果を1つにまとめたファイル）があれば、結果を1つずつのファイルに移す
+func openResultCache(name string) (*resultCache, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	c := &resultCache{dir: filepath.Join(dir, name)}
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return nil, err
+	}
+	legacy := filepath.Join(dir, name+".json")
+	data, err := os.ReadFile(legacy)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries map[string]string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Printf("warning: ignoring the broken cache file %s: %v", legacy, err)
+	}
+	for key, value := range entries {
+		if err := c.put(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Remove(legacy); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// file はキーの結果のファイル。1つのディレクトリにファイルが増えすぎないよう、ハッシュの先頭2文字で分ける
+func (c *resultCache) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name[:2], name+".json")
+}
+
+// get はキーの結果を返します。読めないファイルは警告を出して、結果がないものとして扱う
+func (c *resultCache) get(key string) (string, bool) {
+	path := c.file(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("warning: cache: %v", err)
+		}
+		return "", false
+	}
+	var entry resultCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Printf("warning: ignoring the broken cache file %s: %v", path, err)
+		return "", false
+	}
+	if entry.Key != key {
+		return "", false
+	}
+	return entry.Value, true
+}
+
+// put は結果をファイルに保存します
+func (c *resultCache) put(key, value string) error {
+	data, err := json.Marshal(resultCacheEntry{Key: key, Value: value})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.file(key), data)
+}
+
+// writeFileAtomic は同じディレクトリの一時ファイルに書いてから名前を変え、書き込みの途中で
+// 止まっても壊れたファイルが残らないようにします
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
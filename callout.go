@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// confluenceCalloutMacros はコールアウトの種類ごとの、Confluence のパネルのマクロ名
+var confluenceCalloutMacros = map[string]string{
+	"note": "info", "tip": "tip", "important": "note", "warning": "note", "caution": "warning",
+}
+
+var (
+	calloutConfigOnce sync.Once
+	calloutConfig     map[string]string
+)
+
+// calloutKind returns the kind of a callout from its icon, then its color,
+// looked up first in the callouts section of the config file and then in the
+// default tables. Keys are emoji or Notion color names such as red, which
+// also match the background variant (red_background).
+func calloutKind(callout notionapi.Callout) string {
+	calloutConfigOnce.Do(func() {
+		callouts := userConfig().Callouts
+		calloutConfig = make(map[string]string, len(callouts))
+		for key, kind := range callouts {
+			kind = strings.ToLower(kind)
+			if !isCalloutKind(kind) {
+				log.Printf("warning: invalid callout kind %q for %q in the config file (expected %s)", kind, key, strings.Join(renderer.CalloutKinds, ", "))
+				continue
+			}
+			calloutConfig[renderer.CalloutKey(key)] = kind
+		}
+	})
+	return renderer.CalloutKind(callout, calloutConfig)
+}
+
+func isCalloutKind(kind string) bool {
+	for _, k := range renderer.CalloutKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// checkpointFile は出力先ディレクトリに置くチェックポイントのファイル名
+const checkpointFile = ".notion-dfs-checkpoint.json"
+
+// checkpointInterval はチェックポイントを保存する最短の間隔（ページごとに大きなファイルを書き直さないため）
+const checkpointInterval = 2 * time.Second
+
+// exportCheckpoint records the progress of a site export (--preset) in the
+// output directory: the pages collected so far with their sub-pages, the
+// queue of pages still to write, and the files already written. An
+// interrupted export run again with --resume skips the API calls for
+// everything recorded here. The file is removed when the export finishes.
+type exportCheckpoint struct {
+	path string
+	// mu は並行して書き出すページの間で記録を守る
+	mu    sync.Mutex
+	saved time.Time
+	// stores は画像などの保存先ごとのダウンローダー（保存するときに Assets に写す）
+	stores map[string]*assetDownloader
+
+	exportSettings
+	// Roots は書き出すページ（データベースなら全行）のID。nil ならまだ集めていない
+	Roots []notionapi.BlockID                   `json:"roots"`
+	Pages map[notionapi.BlockID]*checkpointPage `json:"pages"`
+	// Pending はすべてのページを集めた後の、まだ書き出していないページ（書き出す順）。nil ならまだ集めている途中
+	Pending []notionapi.BlockID `json:"pending"`
+	// Files は書き出したファイル（画像などを含む）
+	Files []string `json:"files"`
+	// Assets は画像などの保存先ごとの、署名を除いたURLから保存したファイル名への対応
+	Assets map[string]map[string]string `json:"assets"`
+}
+
+// exportSettings はエクスポートの設定のうち、ファイル名が変わるため再開するときに同じでなければならないもの
+type exportSettings struct {
+	Root   string `json:"root"`
+	Preset string `json:"preset"`
+	// FilenameTemplate は --filename-template
+	FilenameTemplate string `json:"filename_template,omitempty"`
+	// AssetNames は --asset-names（"original" は空）
+	AssetNames string `json:"asset_names,omitempty"`
+	// Image* は --image-max-width・--image-max-height・--image-format・--image-quality
+	ImageMaxWidth  int    `json:"image_max_width,omitempty"`
+	ImageMaxHeight int    `json:"image_max_height,omitempty"`
+	ImageFormat    string `json:"image_format,omitempty"`
+	ImageQuality   int    `json:"image_quality,omitempty"`
+	// Filters は --filter（データベースの行の条件）
+	Filters []propertyCondition `json:"filters,omitempty"`
+}
+
+// imageOptions は --image-* の設定を表示用にまとめます
+func (s exportSettings) imageOptions() string {
+	if s.ImageMaxWidth == 0 && s.ImageMaxHeight == 0 && s.ImageFormat == "" {
+		return "none"
+	}
+	return fmt.Sprintf("max %dx%d, format %s, quality %d", s.ImageMaxWidth, s.ImageMaxHeight, firstNonEmpty(s.ImageFormat, "keep"), s.ImageQuality)
+}
+
+// checkpointPage は集めたページ。Expanded が true なら子ページを探し終えていて、Children がその順序
+type checkpointPage struct {
+	Title    string              `json:"title"`
+	Page     *notionapi.Page     `json:"page"`
+	Expanded bool                `json:"expanded,omitempty"`
+	Children []notionapi.BlockID `json:"children,omitempty"`
+	// Assets は書き出したページが参照する画像などのファイル（manifest.json 用）
+	Assets []string `json:"assets,omitempty"`
+	// Missing は子ブロックを取得しきれなかったブロック（manifest.json 用）
+	Missing []notionapi.BlockID `json:"missing,omitempty"`
+}
+
+// openExportCheckpoint は outDir のチェックポイントを開きます。resume でなければ前回のチェックポイントは使わない
+func openExportCheckpoint(outDir string, settings exportSettings, resume bool) (*exportCheckpoint, error) {
+	cp := &exportCheckpoint{
+		path:           filepath.Join(outDir, checkpointFile),
+		exportSettings: settings,
+		Pages:          make(map[notionapi.BlockID]*checkpointPage),
+		Assets:         make(map[string]map[string]string),
+	}
+	data, err := os.ReadFile(cp.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !resume {
+		fmt.Fprintf(os.Stderr, "note: starting over; pass --resume to continue the interrupted export recorded in %s\n", cp.path)
+		return cp, nil
+	}
+	var saved exportCheckpoint
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", cp.path, err)
+	}
+	if saved.Root != cp.Root || saved.Preset != cp.Preset {
+		return nil, fmt.Errorf("the checkpoint %s is of another export (%s with --preset %s); remove it or run without --resume", cp.path, saved.Root, saved.Preset)
+	}
+	if saved.FilenameTemplate != cp.FilenameTemplate {
+		return nil, fmt.Errorf("the checkpoint %s was written with --filename-template %q; resume with the same template or run without --resume", cp.path, saved.FilenameTemplate)
+	}
+	if saved.AssetNames != cp.AssetNames {
+		return nil, fmt.Errorf("the checkpoint %s was written with --asset-names %s; resume with the same option or run without --resume", cp.path, firstNonEmpty(saved.AssetNames, "original"))
+	}
+	if fmt.Sprint(saved.Filters) != fmt.Sprint(cp.Filters) {
+		return nil, fmt.Errorf("the checkpoint %s was written with other --filter conditions %v; resume with the same conditions or run without --resume", cp.path, saved.Filters)
+	}
+	if saved.imageOptions() != cp.imageOptions() {
+		return nil, fmt.Errorf("the checkpoint %s was written with other --image-* options (%s); resume with the same options or run without --resume", cp.path, saved.imageOptions())
+	}
+	saved.path = cp.path
+	if saved.Pages == nil {
+		saved.Pages = cp.Pages
+	}
+	if saved.Assets == nil {
+		saved.Assets = cp.Assets
+	}
+	if saved.Pending == nil {
+		fmt.Fprintf(os.Stderr, "resuming the export: %d pages collected so far\n", len(saved.Pages))
+	} else {
+		fmt.Fprintf(os.Stderr, "resuming the export: %d of %d pages left to write\n", len(saved.Pending), len(saved.Pages))
+	}
+	return &saved, nil
+}
+
+// addPage はページを記録します
+func (cp *exportCheckpoint) addPage(p *sitePage) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.Pages[p.ID] = &checkpointPage{Title: p.Title, Page: p.Page}
+}
+
+// setPage は子ページを探すときに取得したページを記録します
+func (cp *exportCheckpoint) setPage(p *sitePage) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if c, ok := cp.Pages[p.ID]; ok {
+		c.Page = p.Page
+	}
+}
+
+// sitePage は記録したページを sitePage に戻します。記録がなければ nil
+func (cp *exportCheckpoint) sitePage(id notionapi.BlockID, parent *sitePage) *sitePage {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	c, ok := cp.Pages[id]
+	if !ok {
+		return nil
+	}
+	return &sitePage{ID: id, Title: c.Title, Page: c.Page, Parent: parent}
+}
+
+// expanded はページの子ページを探し終えていれば、その子ページのIDを返します
+func (cp *exportCheckpoint) expanded(id notionapi.BlockID) ([]notionapi.BlockID, bool) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	c, ok := cp.Pages[id]
+	if !ok || !c.Expanded {
+		return nil, false
+	}
+	return c.Children, true
+}
+
+// setChildren はページの子ページを記録します
+func (cp *exportCheckpoint) setChildren(p *sitePage) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	c := cp.Pages[p.ID]
+	c.Expanded = true
+	c.Children = make([]notionapi.BlockID, len(p.Children))
+	for i, child := range p.Children {
+		c.Children[i] = child.ID
+		cp.Pages[child.ID] = &checkpointPage{Title: child.Title, Page: child.Page}
+	}
+}
+
+// assets は保存先の、前回の実行で保存したファイル名の対応を返します
+func (cp *exportCheckpoint) assets(dir string) map[string]string {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.Assets[dir]
+}
+
+// trackAssets は保存先のダウンローダーが保存したファイル名を、チェックポイントを保存するたびに記録するようにします
+func (cp *exportCheckpoint) trackAssets(dir string, a *assetDownloader) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if cp.stores == nil {
+		cp.stores = make(map[string]*assetDownloader)
+	}
+	cp.stores[dir] = a
+}
+
+// written はページとその画像などを書き出し済みにします。refs はページが参照するファイル、
+// missing は子ブロックを取得しきれなかったブロック
+func (cp *exportCheckpoint) written(id notionapi.BlockID, files, refs []string, missing []notionapi.BlockID) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	for i, pending := range cp.Pending {
+		if pending == id {
+			cp.Pending = append(cp.Pending[:i], cp.Pending[i+1:]...)
+			break
+		}
+	}
+	cp.Files = append(cp.Files, files...)
+	if c, ok := cp.Pages[id]; ok {
+		c.Assets = refs
+		c.Missing = missing
+	}
+}
+
+// incomplete は書き出したページのうち、ブロックが欠けているページの数を返します
+func (cp *exportCheckpoint) incomplete() int {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	n := 0
+	for _, c := range cp.Pages {
+		if len(c.Missing) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// save はチェックポイントを書き込みます。force でなければ前回から checkpointInterval 経っていない場合は何もしない
+func (cp *exportCheckpoint) save(force bool) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if !force && time.Since(cp.saved) < checkpointInterval {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cp.path), 0o755); err != nil {
+		return err
+	}
+	for dir, a := range cp.stores {
+		cp.Assets[dir] = a.fileNames()
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	// 書き込み中に中断されても前のチェックポイントを壊さない
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, cp.path); err != nil {
+		return err
+	}
+	cp.saved = time.Now()
+	return nil
+}
+
+// remove は書き出しが終わったチェックポイントを削除します
+func (cp *exportCheckpoint) remove() error {
+	if err := os.Remove(cp.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// notionAPIVersion は Notion-Version ヘッダーの値（--notion-version または NOTION_DFS_NOTION_VERSION）。
+// 空なら notionapi の既定のバージョンを使う
+var notionAPIVersion = os.Getenv("NOTION_DFS_NOTION_VERSION")
+
+// newNotionClient creates a Notion API client using NOTION_API_TOKEN, or the
+// token saved with `auth login`, and exits when neither is set.
+// replayToken はトークンがないときに --replay・--offline で使うトークン
+const replayToken = "replay"
+
+func newNotionClient(opts ...notionapi.ClientOption) *notionapi.Client {
+	token, _ := notionTokenCredential.get()
+	if token == "" && replaying {
+		// 記録・キャッシュした応答を再生するとき（--replay・--offline）はトークンは不要
+		token = replayToken
+	}
+	if token == "" {
+		fatal("NOTION_API_TOKEN is not set (set it, or save the token with `notion-dfs auth login`)")
+	}
+	return newNotionClientWithToken(token, opts...)
+}
+
+func newNotionClientWithToken(token string, opts ...notionapi.ClientOption) *notionapi.Client {
+	if notionAPIVersion != "" {
+		opts = append([]notionapi.ClientOption{notionapi.WithVersion(notionAPIVersion)}, opts...)
+	}
+	return notionapi.NewClient(notionapi.Token(token), opts...)
+}
+
+// validateNotionVersion はAPIのバージョンが "2022-06-28" のような日付の形式か確かめます
+func validateNotionVersion(version string) error {
+	if _, err := time.Parse("2006-01-02", version); err != nil {
+		return fmt.Errorf("invalid Notion API version %q (expected a date such as 2022-06-28)", version)
+	}
+	return nil
+}
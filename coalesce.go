@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// childListTTL は取得した同期ブロックの子の一覧を使い回す時間。serve のように長く動くプロセスで
+// 同期元の編集がいつまでも反映されないことがないよう、1回のエクスポートの間だけ使い回す
+const childListTTL = 5 * time.Minute
+
+// childList is the list of the children of a block inside a synced block,
+// fetched once and shared by every copy of the synced block in the trees
+// being fetched at the same time, so that pages built from templates with
+// the same synced blocks do not download their content again for each copy.
+// The children are kept as JSON and decoded for each use, so that the walks
+// sharing them do not modify the same blocks (when resolving mentions).
+type childList struct {
+	done    chan struct{}
+	data    []byte
+	err     error
+	expires time.Time
+}
+
+type childListKey struct {
+	token notionapi.Token
+	block notionapi.BlockID
+}
+
+var (
+	childListsMu sync.Mutex
+	// childLists は実行全体で共有する一覧。ワークスペースの間で混ざらないようトークンごとに分ける
+	childLists = make(map[childListKey]*childList)
+)
+
+type syncedOriginKey struct{}
+
+// syncedOrigin は同期ブロック（のコピー）とその同期元のブロック
+type syncedOrigin struct {
+	block, original notionapi.BlockID
+}
+
+// withSyncedBlock は ctx で同期ブロックの中を走査することを設定します
+func withSyncedBlock(ctx context.Context, block *notionapi.SyncedBlock) context.Context {
+	origin := syncedOrigin{block: block.ID, original: block.ID}
+	if block.SyncedBlock.SyncedFrom != nil {
+		origin.original = block.SyncedBlock.SyncedFrom.BlockID
+	}
+	return context.WithValue(ctx, syncedOriginKey{}, origin)
+}
+
+// sharedListKey は同期ブロックの中のブロックなら、子の一覧を共有するためのブロックIDを返します。
+// 同期ブロックのコピーの子は同期元の子と同じなので、同期元のIDで共有する
+func sharedListKey(ctx context.Context, blockID notionapi.BlockID) (notionapi.BlockID, bool) {
+	origin, ok := ctx.Value(syncedOriginKey{}).(syncedOrigin)
+	if !ok {
+		return "", false
+	}
+	if origin.block == blockID {
+		return origin.original, true
+	}
+	return blockID, true
+}
+
+// eachSharedChildBlock は eachChildBlock と同じく子ブロックを fn に渡します。
+// 同じ一覧をほかの走査が取得中か取得済みなら、それを待って使う
+func eachSharedChildBlock(ctx context.Context, client *notionapi.Client, blockID, key notionapi.BlockID, fn func(block notionapi.Block) error) error {
+	k := childListKey{token: client.Token, block: key}
+	for {
+		childListsMu.Lock()
+		now := time.Now()
+		for k, l := range childLists {
+			if !l.expires.IsZero() && now.After(l.expires) {
+				delete(childLists, k)
+			}
+		}
+		l, ok := childLists[k]
+		if !ok {
+			l = &childList{done: make(chan struct{})}
+			childLists[k] = l
+		}
+		childListsMu.Unlock()
+
+		if !ok {
+			l.fetch(ctx, client, blockID)
+			childListsMu.Lock()
+			if l.err != nil {
+				// 失敗した一覧は使い回さない
+				delete(childLists, k)
+			} else {
+				l.expires = time.Now().Add(childListTTL)
+			}
+			childListsMu.Unlock()
+			close(l.done)
+		} else {
+			select {
+			case <-l.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			if l.err != nil && ctx.Err() == nil && (errors.Is(l.err, context.Canceled) || errors.Is(l.err, context.DeadlineExceeded)) {
+				// 取得していた走査が中断されただけなので、取得し直す
+				continue
+			}
+		}
+		return l.each(blockID, fn)
+	}
+}
+
+// fetch は一覧を取得します。途中で失敗した場合はそれまでの子とエラーを記録する
+func (l *childList) fetch(ctx context.Context, client *notionapi.Client, blockID notionapi.BlockID) {
+	var blocks []notionapi.Block
+	l.err = eachChildBlock(ctx, client, blockID, func(block notionapi.Block) error {
+		blocks = append(blocks, block)
+		return nil
+	})
+	if blocks == nil {
+		blocks = []notionapi.Block{}
+	}
+	data, err := json.Marshal(blocks)
+	if err != nil && l.err == nil {
+		l.err = err
+	}
+	l.data = data
+}
+
+func (l *childList) each(blockID notionapi.BlockID, fn func(block notionapi.Block) error) error {
+	var blocks notionapi.Blocks
+	if len(l.data) > 0 {
+		if err := json.Unmarshal(l.data, &blocks); err != nil {
+			return err
+		}
+	}
+	for _, block := range blocks {
+		if err := fn(block); err != nil {
+			return err
+		}
+	}
+	var fetchErr *blockFetchError
+	if errors.As(l.err, &fetchErr) {
+		// 一覧を取得したのはほかのコピーかもしれないため、このブロックの失敗として返す
+		return &blockFetchError{block: blockID, err: fetchErr.err}
+	}
+	return l.err
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"notion-dfs/renderer"
+)
+
+var (
+	codeLanguagesOnce sync.Once
+	codeLanguages     map[string]string
+)
+
+// codeLanguage returns the identifier to write for the language of a Notion
+// code block, looked up first in the code_languages section of the config
+// file, so that a site can match its own highlighter, and then in the
+// default table.
+func codeLanguage(language string) string {
+	codeLanguagesOnce.Do(func() {
+		aliases := userConfig().CodeLanguages
+		codeLanguages = make(map[string]string, len(aliases))
+		for name, id := range aliases {
+			codeLanguages[strings.ToLower(name)] = id
+		}
+	})
+	return renderer.CodeLanguage(language, codeLanguages)
+}
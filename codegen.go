@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jomei/notionapi"
+)
+
+// codegenField is a struct field generated for a database property. GoType
+// is the type of the field, and the unmarshal and marshal code are the
+// statements that convert between the field and the notionapi property.
+type codegenField struct {
+	Name     string
+	Property schemaProperty
+	GoType   string
+	// unmarshal は p（プロパティ）からフィールドに値を設定する文、marshal はフィールドを props に入れる文。
+	// marshal が空のプロパティ（数式・ロールアップなど）は書き込めない
+	unmarshal string
+	marshal   string
+}
+
+// codegenTypes はプロパティの種類ごとの、フィールドの型・notionapi のプロパティの型と変換の文。
+// 文の中の $f はフィールド、$n はプロパティ名に置き換える（p はプロパティ）
+var codegenTypes = map[string]struct {
+	goType, propType, unmarshal, marshal string
+}{
+	"title": {"string", "TitleProperty",
+		"$f = \"\"\nfor _, t := range p.Title {\n$f += t.PlainText\n}",
+		"props[$n] = notionapi.TitleProperty{Title: []notionapi.RichText{{Text: &notionapi.Text{Content: $f}}}}"},
+	"rich_text": {"string", "RichTextProperty",
+		"$f = \"\"\nfor _, t := range p.RichText {\n$f += t.PlainText\n}",
+		"props[$n] = notionapi.RichTextProperty{RichText: []notionapi.RichText{{Text: &notionapi.Text{Content: $f}}}}"},
+	"number":   {"float64", "NumberProperty", "$f = p.Number", "props[$n] = notionapi.NumberProperty{Number: $f}"},
+	"checkbox": {"bool", "CheckboxProperty", "$f = p.Checkbox", "props[$n] = notionapi.CheckboxProperty{Checkbox: $f}"},
+	"select": {"string", "SelectProperty", "$f = p.Select.Name",
+		"if $f != \"\" {\nprops[$n] = notionapi.SelectProperty{Select: notionapi.Option{Name: $f}}\n}"},
+	"status": {"string", "StatusProperty", "$f = p.Status.Name",
+		"if $f != \"\" {\nprops[$n] = notionapi.StatusProperty{Status: notionapi.Status{Name: $f}}\n}"},
+	"multi_select": {"[]string", "MultiSelectProperty",
+		"$f = nil\nfor _, o := range p.MultiSelect {\n$f = append($f, o.Name)\n}",
+		"{\noptions := make([]notionapi.Option, 0, len($f))\nfor _, name := range $f {\noptions = append(options, notionapi.Option{Name: name})\n}\nprops[$n] = notionapi.MultiSelectProperty{MultiSelect: options}\n}"},
+	"date": {"*notionapi.DateObject", "DateProperty", "$f = p.Date",
+		"if $f != nil {\nprops[$n] = notionapi.DateProperty{Date: $f}\n}"},
+	"url": {"string", "URLProperty", "$f = p.URL",
+		"if $f != \"\" {\nprops[$n] = notionapi.URLProperty{URL: $f}\n}"},
+	"email": {"string", "EmailProperty", "$f = p.Email",
+		"if $f != \"\" {\nprops[$n] = notionapi.EmailProperty{Email: $f}\n}"},
+	"phone_number": {"string", "PhoneNumberProperty", "$f = p.PhoneNumber",
+		"if $f != \"\" {\nprops[$n] = notionapi.PhoneNumberProperty{PhoneNumber: $f}\n}"},
+	"people": {"[]notionapi.UserID", "PeopleProperty",
+		"$f = nil\nfor _, u := range p.People {\n$f = append($f, u.ID)\n}",
+		"{\nusers := make([]notionapi.User, 0, len($f))\nfor _, id := range $f {\nusers = append(users, notionapi.User{ID: id})\n}\nprops[$n] = notionapi.PeopleProperty{People: users}\n}"},
+	"relation": {"[]notionapi.PageID", "RelationProperty",
+		"$f = nil\nfor _, rel := range p.Relation {\n$f = append($f, rel.ID)\n}",
+		"{\nrelations := make([]notionapi.Relation, 0, len($f))\nfor _, id := range $f {\nrelations = append(relations, notionapi.Relation{ID: id})\n}\nprops[$n] = notionapi.RelationProperty{Relation: relations}\n}"},
+	// 以下は Notion が計算する、または API から書き込めないため読み取り専用
+	"files":            {"[]notionapi.File", "FilesProperty", "$f = p.Files", ""},
+	"formula":          {"notionapi.Formula", "FormulaProperty", "$f = p.Formula", ""},
+	"rollup":           {"notionapi.Rollup", "RollupProperty", "$f = p.Rollup", ""},
+	"unique_id":        {"notionapi.UniqueID", "UniqueIDProperty", "$f = p.UniqueID", ""},
+	"created_time":     {"time.Time", "CreatedTimeProperty", "$f = p.CreatedTime", ""},
+	"last_edited_time": {"time.Time", "LastEditedTimeProperty", "$f = p.LastEditedTime", ""},
+	"created_by":       {"notionapi.User", "CreatedByProperty", "$f = p.CreatedBy", ""},
+	"last_edited_by":   {"notionapi.User", "LastEditedByProperty", "$f = p.LastEditedBy", ""},
+}
+
+// runDBCodegen generates Go structs for the rows of a database.
+func runDBCodegen(args []string, usage func()) {
+	fs := flag.NewFlagSet("db codegen", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	pkg := fs.String("package", "models", "package name of the generated file")
+	typeName := fs.String("type", "", "name of the generated struct (default: derived from the database title)")
+	output := fs.String("o", "", "write the generated code to this file instead of stdout")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fs.Usage()
+		exit(1)
+	}
+	if !token.IsIdentifier(*pkg) {
+		fatalf("invalid --package %q (expected a Go identifier)", *pkg)
+	}
+	if *typeName != "" && (!token.IsIdentifier(*typeName) || !token.IsExported(*typeName)) {
+		fatalf("invalid --type %q (expected an exported Go identifier)", *typeName)
+	}
+
+	client := newNotionClient()
+	schema, err := fetchDatabaseSchema(context.Background(), client, notionapi.DatabaseID(formatPageID(positional[0])))
+	if err != nil {
+		exitWithNotionError("Error fetching database", err)
+	}
+	src, err := generateDatabaseStruct(schema, *pkg, firstNonEmpty(*typeName, goIdentifier(schema.Title)))
+	if err != nil {
+		fatal(err)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		fatalf("Error writing output file: %v", err)
+	}
+}
+
+// generateDatabaseStruct は行の構造体と、ページとの変換のメソッドのGoのソースを作ります。
+// 対応していない種類のプロパティ（ボタンなど）はフィールドにしない
+func generateDatabaseStruct(schema *databaseSchema, pkg, typeName string) ([]byte, error) {
+	used := map[string]bool{"ID": true}
+	var fields []codegenField
+	var skipped []string
+	needsTime := false
+	for _, p := range schema.Properties {
+		t, ok := codegenTypes[p.Type]
+		if !ok {
+			skipped = append(skipped, fmt.Sprintf("%q (%s)", p.Name, p.Type))
+			continue
+		}
+		name := goIdentifier(p.Name)
+		for i := 2; used[name]; i++ {
+			name = goIdentifier(p.Name) + strconv.Itoa(i)
+		}
+		used[name] = true
+		needsTime = needsTime || strings.HasPrefix(t.goType, "time.")
+		f := codegenField{Name: name, Property: p, GoType: t.goType, unmarshal: t.unmarshal, marshal: t.marshal}
+		fields = append(fields, f)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// Code generated by notion-dfs db codegen from the Notion database %q (%s); DO NOT EDIT.\n\n", schema.Title, schema.ID)
+	fmt.Fprintf(&sb, "package %s\n\nimport (\n\"fmt\"\n", pkg)
+	if needsTime {
+		sb.WriteString("\"time\"\n")
+	}
+	sb.WriteString("\n\"github.com/jomei/notionapi\"\n)\n\n")
+
+	fmt.Fprintf(&sb, "// %s is a row of the Notion database %q.\n", typeName, schema.Title)
+	for _, s := range skipped {
+		fmt.Fprintf(&sb, "// The property %s is not supported and has no field.\n", s)
+	}
+	fmt.Fprintf(&sb, "type %s struct {\n// ID is the ID of the row's page.\nID notionapi.PageID\n", typeName)
+	for _, f := range fields {
+		note := ""
+		if f.marshal == "" {
+			note = ", read-only"
+		}
+		fmt.Fprintf(&sb, "// %s is the %q property (%s%s).\n%s %s\n", f.Name, f.Property.Name, f.Property.Type, note, f.Name, f.GoType)
+	}
+	sb.WriteString("}\n\n")
+
+	fmt.Fprintf(&sb, "// %sFromPage converts a page of the database to a %s.\n", typeName, typeName)
+	fmt.Fprintf(&sb, "func %sFromPage(page *notionapi.Page) (*%s, error) {\nr := &%s{}\n", typeName, typeName, typeName)
+	sb.WriteString("if err := r.UnmarshalPage(page); err != nil {\nreturn nil, err\n}\nreturn r, nil\n}\n\n")
+
+	sb.WriteString("// UnmarshalPage sets the fields from the properties of a page of the database.\n")
+	sb.WriteString("// It fails if a property has another type than when the code was generated.\n")
+	fmt.Fprintf(&sb, "func (r *%s) UnmarshalPage(page *notionapi.Page) error {\nr.ID = notionapi.PageID(page.ID)\n", typeName)
+	for _, f := range fields {
+		t := codegenTypes[f.Property.Type]
+		fmt.Fprintf(&sb, "switch p := page.Properties[%q].(type) {\ncase nil:\ncase *notionapi.%s:\n%s\n", f.Property.Name, t.propType, codegenStatement(f.unmarshal, f))
+		fmt.Fprintf(&sb, "default:\nreturn fmt.Errorf(\"property %%q is %%s, want %s\", %q, p.GetType())\n}\n", f.Property.Type, f.Property.Name)
+	}
+	sb.WriteString("return nil\n}\n\n")
+
+	sb.WriteString("// Properties returns the properties to create or update the row with, for\n")
+	sb.WriteString("// client.Page.Create and client.Page.Update. Read-only properties are left out,\n")
+	sb.WriteString("// and so are empty selects, statuses, dates, URLs, emails and phone numbers,\n")
+	sb.WriteString("// which Notion does not accept as values.\n")
+	fmt.Fprintf(&sb, "func (r *%s) Properties() notionapi.Properties {\nprops := notionapi.Properties{}\n", typeName)
+	for _, f := range fields {
+		if f.marshal != "" {
+			sb.WriteString(codegenStatement(f.marshal, f) + "\n")
+		}
+	}
+	sb.WriteString("return props\n}\n")
+
+	src, err := format.Source([]byte(sb.String()))
+	if err != nil {
+		return nil, fmt.Errorf("generated code does not compile: %w", err)
+	}
+	return src, nil
+}
+
+// codegenStatement は変換の文の $f・$n をフィールドとプロパティ名に置き換えます
+func codegenStatement(stmt string, f codegenField) string {
+	return strings.NewReplacer("$f", "r."+f.Name, "$n", strconv.Quote(f.Property.Name)).Replace(stmt)
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// codegenInitialisms は Go の慣習どおり大文字で書く単語
+var codegenInitialisms = map[string]bool{"id": true, "url": true, "api": true, "html": true, "http": true, "json": true, "uuid": true}
+
+// goIdentifier はプロパティ名などを、単語ごとに先頭を大文字にした公開の識別子にします。
+// 先頭が大文字にならない名前（日本語など）には X を付ける
+func goIdentifier(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool { return !isIdentRune(r) || r == '_' })
+	var sb strings.Builder
+	for _, w := range words {
+		if codegenInitialisms[strings.ToLower(w)] {
+			sb.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		sb.WriteString(string(unicode.ToUpper(r[0])) + string(r[1:]))
+	}
+	id := sb.String()
+	if id == "" {
+		return "Property"
+	}
+	if first := []rune(id)[0]; !unicode.IsUpper(first) {
+		id = "X" + id
+	}
+	return id
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jomei/notionapi"
+)
+
+// columnLayouts は --columns で選べるカラムの出力方法。flatten はカラムの内容を順に並べる
+var columnLayouts = map[string]bool{"flatten": true, "sections": true, "html": true, "table": true}
+
+// columnList はカラムのリストを、columns に従ってHTMLにします
+func (r *htmlRenderer) columnList(w io.Writer, node *BlockNode) {
+	var columns []*BlockNode
+	for _, child := range node.Children {
+		if _, ok := child.Block.(*notionapi.ColumnBlock); ok {
+			columns = append(columns, child)
+		}
+	}
+
+	var open, close, openColumn, closeColumn string
+	switch {
+	case r.columns == "html" && r.storageFormat:
+		// Confluence のページのレイアウトと同じく、section マクロの中に column マクロを並べる
+		open, close = `<ac:structured-macro ac:name="section"><ac:rich-text-body>`, "</ac:rich-text-body></ac:structured-macro>"
+		openColumn, closeColumn = `<ac:structured-macro ac:name="column"><ac:rich-text-body>`, "</ac:rich-text-body></ac:structured-macro>"
+	case r.columns == "html":
+		open, close = `<div class="columns" style="display: flex; gap: 1em;">`, "</div>"
+		openColumn, closeColumn = `<div class="column" style="flex: 1; min-width: 0;">`, "</div>"
+	case r.columns == "table":
+		open, close = `<table class="columns"><tr>`, "</tr></table>"
+		openColumn, closeColumn = `<td style="vertical-align: top;">`, "</td>"
+	}
+
+	if open != "" {
+		fmt.Fprintln(w, open)
+	}
+	for i, column := range columns {
+		if r.columns == "sections" {
+			if i > 0 {
+				fmt.Fprintln(w, "<hr/>")
+			}
+			fmt.Fprintf(w, "<!-- column %d -->\n", i+1)
+		}
+		if openColumn != "" {
+			fmt.Fprintln(w, openColumn)
+		}
+		r.renderBlocks(w, column.Children)
+		if closeColumn != "" {
+			fmt.Fprintln(w, closeColumn)
+		}
+	}
+	if close != "" {
+		fmt.Fprintln(w, close)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+// runComment adds a comment to a page, or a reply to an existing discussion,
+// so that automation can leave review notes on the pages it processes.
+func runComment(args []string) {
+	fs := flag.NewFlagSet("comment", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	reply := fs.String("reply", "", "reply to this discussion ID instead of starting a new comment on a page")
+	dryRun := fs.Bool("dry-run", false, "print the Notion API request that would create the comment instead of sending it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs comment <page-id> <text|->")
+		fmt.Fprintln(os.Stderr, "       notion-dfs comment --reply <discussion-id> <text|->")
+		fmt.Fprintln(os.Stderr, "\nThe text may use inline Markdown (**bold**, *italic*, `code`, [links](https://...)). Use - to read it from stdin.")
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+	want := 2
+	if *reply != "" {
+		want = 1
+	}
+	if len(positional) != want {
+		fs.Usage()
+		exit(1)
+	}
+
+	text := positional[len(positional)-1]
+	if text == "-" {
+		data, err := readInputFile(text)
+		if err != nil {
+			fatalf("Error reading comment: %v", err)
+		}
+		text = string(data)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		fatal("the comment is empty")
+	}
+
+	// omitEmptyParent が包む前に有効にし、parent を取り除いた後の本文を表示する
+	if *dryRun {
+		enableDryRun()
+	}
+	request := &notionapi.CommentCreateRequest{RichText: parseInlineMarkdown(text)}
+	var opts []notionapi.ClientOption
+	if *reply != "" {
+		request.DiscussionID = notionapi.DiscussionID(*reply)
+		opts = append(opts, notionapi.WithHTTPClient(&http.Client{Transport: omitEmptyParent{http.DefaultTransport}}))
+	} else {
+		request.Parent = notionapi.Parent{Type: notionapi.ParentTypePageID, PageID: notionapi.PageID(formatPageID(positional[0]))}
+	}
+	comment, err := newNotionClient(opts...).Comment.Create(context.Background(), request)
+	if err != nil {
+		exitWithNotionError("Error creating comment", err)
+	}
+	// ディスカッションのIDを出力し、続けて --reply で返信できるようにする
+	fmt.Println(comment.DiscussionID)
+}
+
+// omitEmptyParent はリクエストの本文から空の "parent": {} を取り除きます。
+// notionapi の CommentCreateRequest は parent を省略できないが、APIは parent と discussion_id の
+// どちらか一方だけを受け付ける
+type omitEmptyParent struct {
+	next http.RoundTripper
+}
+
+func (t omitEmptyParent) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil {
+		return t.next.RoundTrip(req)
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]json.RawMessage
+	if json.Unmarshal(data, &body) == nil && string(body["parent"]) == "{}" {
+		delete(body, "parent")
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	return t.next.RoundTrip(req)
+}
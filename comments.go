@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// commentThread is one discussion on a page or a block: a comment and its
+// replies, oldest first.
+type commentThread struct {
+	blockID  notionapi.BlockID
+	comments []pageComment
+}
+
+type pageComment struct {
+	author  string
+	created time.Time
+	text    string
+}
+
+// pageComments はページ自体とブロックごとの未解決のコメント
+type pageComments struct {
+	page   []commentThread
+	blocks map[notionapi.BlockID][]commentThread
+}
+
+// fetchComments retrieves the unresolved comments on the page and on every
+// block of the tree. The Comments API has no way to list a whole page at
+// once, so this makes one request per block.
+func fetchComments(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, tree *PageTree) (*pageComments, error) {
+	result := &pageComments{blocks: make(map[notionapi.BlockID][]commentThread)}
+
+	page, err := fetchCommentThreads(ctx, client, pageID)
+	if err != nil {
+		return nil, err
+	}
+	result.page = page
+
+	var walk func(nodes []*BlockNode) error
+	walk = func(nodes []*BlockNode) error {
+		for _, node := range nodes {
+			id := node.Block.GetID()
+			threads, err := fetchCommentThreads(ctx, client, id)
+			if err != nil {
+				return err
+			}
+			if len(threads) > 0 {
+				result.blocks[id] = threads
+			}
+			if err := walk(node.Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(tree.Root.Children); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// fetchCommentThreads はブロックのコメントをページネーションしながら取得し、ディスカッションごとにまとめます
+func fetchCommentThreads(ctx context.Context, client *notionapi.Client, blockID notionapi.BlockID) ([]commentThread, error) {
+	var threads []commentThread
+	index := make(map[notionapi.DiscussionID]int)
+	var cursor notionapi.Cursor
+	for {
+		resp, err := client.Comment.Get(ctx, blockID, &notionapi.Pagination{StartCursor: cursor, PageSize: 100})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get comments: %w", err)
+		}
+		for _, c := range resp.Results {
+			i, ok := index[c.DiscussionID]
+			if !ok {
+				i = len(threads)
+				index[c.DiscussionID] = i
+				threads = append(threads, commentThread{blockID: blockID})
+			}
+			threads[i].comments = append(threads[i].comments, pageComment{
+				author:  workspaceUsers(client).name(ctx, client, c.CreatedBy),
+				created: c.CreatedTime,
+				text:    renderer.PlainText(c.RichText),
+			})
+		}
+		if !resp.HasMore {
+			return threads, nil
+		}
+		cursor = notionapi.Cursor(resp.NextCursor)
+	}
+}
+
+// commentNotes writes comments into the Markdown output, either as footnotes
+// referenced from the commented block or, with appendix (and for comments on
+// the page itself or on blocks without text), in a section after the page.
+type commentNotes struct {
+	comments *pageComments
+	appendix bool
+
+	// pending は出力中のブロックのスレッドで、まだ脚注の参照を書いていないもの
+	pending   []commentThread
+	footnotes []commentThread
+	// unanchored は末尾のコメント欄に書くスレッドと、引用するブロックのテキスト
+	unanchored []quotedThread
+}
+
+type quotedThread struct {
+	quote  string
+	thread commentThread
+}
+
+// Begin はブロックの出力前に呼び出し、そのブロックのスレッドを参照待ちにします
+func (n *commentNotes) Begin(block notionapi.Block) {
+	if n == nil {
+		return
+	}
+	n.pending = n.comments.blocks[block.GetID()]
+}
+
+// End はブロックの出力後に呼び出します。参照を書けなかったスレッドは末尾のコメント欄に回す
+func (n *commentNotes) End(block notionapi.Block) {
+	if n == nil {
+		return
+	}
+	for _, thread := range n.pending {
+		n.unanchored = append(n.unanchored, quotedThread{quote: commentQuote(block), thread: thread})
+	}
+	n.pending = nil
+}
+
+// Refs は参照待ちのスレッドへの脚注の参照（[^1] など）を返します
+func (n *commentNotes) Refs() string {
+	if n == nil || n.appendix || len(n.pending) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, thread := range n.pending {
+		n.footnotes = append(n.footnotes, thread)
+		fmt.Fprintf(&sb, "[^c%d]", len(n.footnotes))
+	}
+	n.pending = nil
+	return sb.String()
+}
+
+// write はページへのコメントと脚注にできなかったコメントの欄、続いて脚注の定義を書き出します
+func (n *commentNotes) write(w io.Writer) {
+	if len(n.comments.page) > 0 || len(n.unanchored) > 0 {
+		fmt.Fprint(w, "## コメント\n\n")
+		for _, thread := range n.comments.page {
+			writeCommentList(w, thread)
+		}
+		for _, q := range n.unanchored {
+			for _, line := range strings.Split(q.quote, "\n") {
+				fmt.Fprintf(w, "> %s\n", line)
+			}
+			fmt.Fprintln(w)
+			writeCommentList(w, q.thread)
+		}
+	}
+	for i, thread := range n.footnotes {
+		for j, c := range thread.comments {
+			if j == 0 {
+				fmt.Fprintf(w, "[^c%d]: %s\n", i+1, formatComment(c))
+			} else {
+				// 返信は脚注の続きの段落にする
+				fmt.Fprintf(w, "\n    %s\n", formatComment(c))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func writeCommentList(w io.Writer, thread commentThread) {
+	for _, c := range thread.comments {
+		fmt.Fprintf(w, "- %s\n", formatComment(c))
+	}
+	fmt.Fprintln(w)
+}
+
+// formatComment は "**作成者** (2006-01-02 15:04): 本文" の形式にします。改行は空白にして1行に収める
+func formatComment(c pageComment) string {
+	text := strings.Join(strings.Fields(strings.ReplaceAll(c.text, "\n", " ")), " ")
+	return fmt.Sprintf("**%s** (%s): %s", c.author, dateDisplay.timestamp(c.created.Local(), "2006-01-02 15:04"), text)
+}
+
+// commentQuote はコメント欄で引用するブロックのテキストを返します。長いテキストは先頭だけにする
+func commentQuote(block notionapi.Block) string {
+	text := strings.TrimSpace(blockText(block))
+	if text == "" {
+		return fmt.Sprintf("（%s ブロック）", block.GetType())
+	}
+	if r := []rune(text); len(r) > 80 {
+		text = string(r[:80]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// pageValidators remembers, for each page whose blocks were all fetched into
+// the response cache, the page's last_edited_time at that moment. The Notion
+// API has no ETags or conditional requests, but editing any block of a page
+// updates the page's last_edited_time, so when it has not changed the next
+// run reads the page's block lists from the cache instead of downloading
+// them again. Child pages and blocks synced from other pages have their own
+// last_edited_time and are checked separately.
+type pageValidators struct {
+	dir string
+}
+
+// subtreeCache は応答をキャッシュしているとき（メインコマンドの --cache）だけ設定される。--refresh では nil
+var subtreeCache *pageValidators
+
+// pageValidator は1ページ分の記録。FetchedAt はブロックを取得し始めた時刻
+type pageValidator struct {
+	LastEditedTime time.Time `json:"last_edited_time"`
+	FetchedAt      time.Time `json:"fetched_at"`
+}
+
+func (v *pageValidators) file(pageID notionapi.BlockID) string {
+	return filepath.Join(v.dir, compactPageID(string(pageID))+".json")
+}
+
+// unchanged はページが前回すべてのブロックを取得してから更新されていないかを返します
+func (v *pageValidators) unchanged(pageID notionapi.BlockID, edited time.Time) bool {
+	data, err := os.ReadFile(v.file(pageID))
+	if err != nil {
+		return false
+	}
+	var saved pageValidator
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return false
+	}
+	// last_edited_time は分単位に丸められるため、同じ分のうちに取得した後の編集は区別できない。
+	// その分が終わってから取得した記録だけを信用する
+	return saved.LastEditedTime.Equal(edited) && !saved.FetchedAt.Before(edited.Add(time.Minute))
+}
+
+// validated はページのすべてのブロックを取得してキャッシュしたことを記録します
+func (v *pageValidators) validated(pageID notionapi.BlockID, edited, fetchedAt time.Time) {
+	data, err := json.Marshal(pageValidator{LastEditedTime: edited, FetchedAt: fetchedAt})
+	if err != nil {
+		return
+	}
+	// 記録できなくても次回すべて取得し直すだけなので、失敗は無視する
+	if err := os.MkdirAll(v.dir, 0o700); err == nil {
+		tmp := v.file(pageID) + ".tmp"
+		if os.WriteFile(tmp, data, 0o600) == nil {
+			os.Rename(tmp, v.file(pageID))
+		}
+	}
+}
+
+type cachedSubtreeKey struct{}
+
+// withCachedSubtree は ctx のリクエストでブロックの一覧をキャッシュから読んでよいかを設定します
+func withCachedSubtree(ctx context.Context, ok bool) context.Context {
+	return context.WithValue(ctx, cachedSubtreeKey{}, ok)
+}
+
+func useCachedSubtree(ctx context.Context) bool {
+	ok, _ := ctx.Value(cachedSubtreeKey{}).(bool)
+	return ok
+}
+
+// walkPage はページの子ブロックを走査します。前回から更新されていないページはキャッシュから読み、
+// そうでなければ取得し直して、すべて取得できたら記録します
+func (w *blockWalker) walkPage(ctx context.Context, pageID notionapi.BlockID, depth int) error {
+	if subtreeCache == nil {
+		return w.walk(ctx, pageID, depth)
+	}
+	ctx = withCachedSubtree(ctx, false)
+	// 子ページの last_edited_time もキャッシュした一覧のものは古いことがあるため、ページごとに取得し直す
+	block, err := w.client.Block.Get(ctx, pageID)
+	if err != nil {
+		// ページを取得できない理由は続く子ブロックの取得で報告する
+		return w.walk(ctx, pageID, depth)
+	}
+	page, ok := block.(*notionapi.ChildPageBlock)
+	if !ok || page.LastEditedTime == nil {
+		return w.walk(ctx, pageID, depth)
+	}
+	edited := *page.LastEditedTime
+	if subtreeCache.unchanged(pageID, edited) {
+		return w.walk(withCachedSubtree(ctx, true), pageID, depth)
+	}
+
+	start := time.Now()
+	missing, depthLimited := len(w.missing), w.depthLimited
+	if err := w.walk(ctx, pageID, depth); err != nil {
+		return err
+	}
+	if len(w.missing) == missing && w.depthLimited == depthLimited {
+		subtreeCache.validated(pageID, edited, start)
+	}
+	return nil
+}
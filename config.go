@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// config is the optional configuration file. It holds settings that are
+// awkward to pass as flags on every run, such as the SMTP server.
+type config struct {
+	SMTP   smtpConfig   `json:"smtp"`
+	Digest digestConfig `json:"digest"`
+	HTTP   httpConfig   `json:"http"`
+	// CodeLanguages はコードブロックの言語名（Notion の "c++" など）から出力する言語名への対応表で、既定の対応より優先される
+	CodeLanguages map[string]string `json:"code_languages"`
+	// Callouts はコールアウトのアイコンの絵文字や色の名前から種類（note・tip など）への対応表で、既定の対応より優先される
+	Callouts map[string]string `json:"callouts"`
+	// Jobs は daemon で定期的に実行するジョブ（名前からジョブ）
+	Jobs map[string]jobConfig `json:"jobs"`
+}
+
+// smtpConfig はメールの送信に使うSMTPサーバーの設定
+type smtpConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	// Password は NOTION_DFS_SMTP_PASSWORD が設定されていればそちらが優先される
+	Password string `json:"password"`
+	From     string `json:"from"`
+	// TLS は "starttls"（デフォルト）、"tls"（ポート465など最初からTLSで接続する場合）、"none" のいずれか
+	TLS string `json:"tls"`
+}
+
+// digestConfig は digest サブコマンドのデフォルト
+type digestConfig struct {
+	To      []string `json:"to"`
+	Subject string   `json:"subject"`
+}
+
+// jobConfig は daemon のジョブの設定。Args は notion-dfs に渡す引数（サブコマンドとその引数）
+type jobConfig struct {
+	Schedule string   `json:"schedule"`
+	Args     []string `json:"args"`
+}
+
+// configPath returns the path of the configuration file. NOTION_DFS_CONFIG
+// overrides the default under the user config dir.
+func configPath() (string, error) {
+	if path := os.Getenv("NOTION_DFS_CONFIG"); path != "" {
+		return path, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %w", err)
+	}
+	return filepath.Join(base, "notion-dfs", "config.json"), nil
+}
+
+// loadConfig reads the configuration file at path, or at configPath() if path
+// is empty. A missing file at the default location is not an error.
+func loadConfig(path string) (*config, error) {
+	explicit := path != ""
+	if !explicit {
+		p, err := configPath()
+		if err != nil {
+			return nil, err
+		}
+		path = p
+	}
+
+	cfg := &config{}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !explicit && os.Getenv("NOTION_DFS_CONFIG") == "":
+		// 既定の場所に設定ファイルがなければ空の設定を使う
+	case err != nil:
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	default:
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+	if password := os.Getenv("NOTION_DFS_SMTP_PASSWORD"); password != "" {
+		cfg.SMTP.Password = password
+	}
+	return cfg, nil
+}
+
+var (
+	userConfigOnce sync.Once
+	userConfigData *config
+)
+
+// userConfig returns the configuration file at the default location, read
+// once, for settings such as mapping tables that renderers look up while
+// writing. If the file cannot be read it warns and returns an empty config.
+func userConfig() *config {
+	userConfigOnce.Do(func() {
+		cfg, err := loadConfig("")
+		if err != nil {
+			log.Printf("warning: %v; ignoring the config file", err)
+			cfg = &config{}
+		}
+		userConfigData = cfg
+	})
+	return userConfigData
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"notion-dfs/renderer"
+)
+
+// writeConfluence writes the page's blocks and the summary if given in
+// Confluence storage format. The title is not included, because Confluence
+// keeps it separately from the body.
+// https://confluence.atlassian.com/doc/confluence-storage-format-790796544.html
+func writeConfluence(w io.Writer, tree *PageTree, summary string, images *embeddedImages, columns string) {
+	r := &htmlRenderer{storageFormat: true, columns: columns}
+	if images != nil {
+		r.image = images.add
+	}
+	r.renderBlocks(w, tree.Root.Children)
+	if summary != "" {
+		fmt.Fprintln(w, "<h1>AI による要約</h1>")
+		for _, para := range strings.Split(strings.TrimSpace(summary), "\n\n") {
+			fmt.Fprintf(w, "<p>%s</p>\n", strings.ReplaceAll(renderer.EscapeHTML(para), "\n", "<br/>"))
+		}
+	}
+}
+
+// confluenceClient calls the Confluence REST API. CONFLUENCE_URL is the base
+// URL of the site (https://example.atlassian.net/wiki for Confluence Cloud).
+// With CONFLUENCE_EMAIL the API token is sent with basic authentication
+// (Cloud); otherwise it is sent as a personal access token (Data Center).
+type confluenceClient struct {
+	baseURL string
+	email   string
+	token   string
+}
+
+func newConfluenceClient() (*confluenceClient, error) {
+	c := &confluenceClient{
+		baseURL: strings.TrimSuffix(os.Getenv("CONFLUENCE_URL"), "/"),
+		email:   os.Getenv("CONFLUENCE_EMAIL"),
+		token:   os.Getenv("CONFLUENCE_API_TOKEN"),
+	}
+	if c.baseURL == "" || c.token == "" {
+		return nil, fmt.Errorf("CONFLUENCE_URL and CONFLUENCE_API_TOKEN must be set")
+	}
+	return c, nil
+}
+
+// do はリクエストを送信し、レスポンスの JSON を out に読み込みます（out が nil なら読み捨てる）
+func (c *confluenceClient) do(ctx context.Context, method, apiPath, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+apiPath, body)
+	if err != nil {
+		return err
+	}
+	if c.email != "" {
+		req.SetBasicAuth(c.email, c.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	// 添付ファイルのアップロードには XSRF チェックを無効にするヘッダーが必要
+	req.Header.Set("X-Atlassian-Token", "no-check")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, apiPath, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// confluenceContent は REST API のページ（content）のうち使用する項目
+type confluenceContent struct {
+	ID      string `json:"id"`
+	Version struct {
+		Number int `json:"number"`
+	} `json:"version"`
+	Links struct {
+		Base  string `json:"base"`
+		WebUI string `json:"webui"`
+	} `json:"_links"`
+}
+
+// findPage はスペース内の同じタイトルのページを探します（なければ nil）
+func (c *confluenceClient) findPage(ctx context.Context, space, title string) (*confluenceContent, error) {
+	query := url.Values{"spaceKey": {space}, "title": {title}, "type": {"page"}, "expand": {"version"}}
+	var result struct {
+		Results []confluenceContent `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/rest/api/content?"+query.Encode(), "", nil, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Results) == 0 {
+		return nil, nil
+	}
+	return &result.Results[0], nil
+}
+
+// publish creates the page in the space, or updates the page with the same
+// title, and uploads the images it references as attachments. It returns
+// the URL of the page.
+func (c *confluenceClient) publish(ctx context.Context, space, parentID, title, body string, images []embeddedImage) (string, error) {
+	existing, err := c.findPage(ctx, space, title)
+	if err != nil {
+		return "", err
+	}
+
+	content := map[string]any{
+		"type":  "page",
+		"title": title,
+		"space": map[string]string{"key": space},
+		"body":  map[string]any{"storage": map[string]string{"value": body, "representation": "storage"}},
+	}
+	if parentID != "" {
+		content["ancestors"] = []map[string]string{{"id": parentID}}
+	}
+	method, apiPath := http.MethodPost, "/rest/api/content"
+	if existing != nil {
+		content["version"] = map[string]int{"number": existing.Version.Number + 1}
+		method, apiPath = http.MethodPut, "/rest/api/content/"+existing.ID
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	var page confluenceContent
+	if err := c.do(ctx, method, apiPath, "application/json", bytes.NewReader(data), &page); err != nil {
+		return "", err
+	}
+
+	// 本文は添付ファイルをファイル名で参照するため、ページを作成した後にアップロードしてよい
+	for _, img := range images {
+		if err := c.attach(ctx, page.ID, path.Base(img.href), img.mediaType, img.data); err != nil {
+			return "", err
+		}
+	}
+	return page.Links.Base + page.Links.WebUI, nil
+}
+
+// attach はファイルを添付します。同じ名前の添付ファイルがあれば新しいバージョンとして更新される
+func (c *confluenceClient) attach(ctx context.Context, pageID, name, mediaType string, data []byte) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, name))
+	header.Set("Content-Type", mediaType)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	part.Write(data)
+	mw.WriteField("minorEdit", "true")
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	if err := c.do(ctx, http.MethodPut, "/rest/api/content/"+pageID+"/child/attachment", mw.FormDataContentType(), &body, nil); err != nil {
+		return fmt.Errorf("failed to attach %s: %w", name, err)
+	}
+	return nil
+}
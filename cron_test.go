@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"0 6 * * *", false},
+		{"*/15 9-17 * * mon-fri", false},
+		{"0 0 1,15 jan,jul *", false},
+		{"5/15 * * * *", false},
+		{"0 0 * * 7", false},
+		{"@daily", false},
+		{"@HOURLY", false},
+		{"@every 30m", false},
+		{"  0 6 * * *  ", false},
+		{"", true},
+		{"0 6 * *", true},
+		{"0 6 * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"*/0 * * * *", true},
+		{"5-1 * * * *", true},
+		{"a * * * *", true},
+		{"* * * foo *", true},
+		{"@every 30s", true},
+		{"@every soon", true},
+		{"@weekdays", true},
+	}
+	for _, tt := range tests {
+		_, err := parseCron(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-01-01 は月曜日
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"0 6 * * *", at(1, 1, 5, 0), at(1, 1, 6, 0)},
+		{"0 6 * * *", at(1, 1, 6, 0), at(1, 2, 6, 0)},
+		{"0 6 * * *", at(1, 1, 6, 0).Add(30 * time.Second), at(1, 2, 6, 0)},
+		{"*/15 * * * *", at(1, 1, 10, 1), at(1, 1, 10, 15)},
+		{"5/15 * * * *", at(1, 1, 10, 21), at(1, 1, 10, 35)},
+		{"30 9 * * mon-fri", at(1, 5, 10, 0), at(1, 8, 9, 30)},
+		{"0 0 * * 0", at(1, 1, 0, 0), at(1, 7, 0, 0)},
+		{"0 0 * * 7", at(1, 1, 0, 0), at(1, 7, 0, 0)},
+		{"0 0 1 * *", at(1, 15, 0, 0), at(2, 1, 0, 0)},
+		{"0 0 29 feb *", at(3, 1, 0, 0), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// 日と曜日の両方を制限すると、どちらかに一致する日
+		{"0 0 15 * fri", at(1, 1, 0, 0), at(1, 5, 0, 0)},
+		{"0 0 15 * fri", at(1, 13, 0, 0), at(1, 15, 0, 0)},
+		// * で始まるフィールドは制限しないものとして扱い、両方に一致する日にする
+		{"0 0 */2 * 1", at(1, 1, 0, 0), at(1, 15, 0, 0)},
+		{"0 0 1 * *", at(1, 1, 0, 0), at(2, 1, 0, 0)},
+		{"@every 90m", at(1, 1, 10, 7), at(1, 1, 11, 37)},
+		{"@weekly", at(1, 1, 0, 0), at(1, 7, 0, 0)},
+		{"0 0 30 feb *", at(1, 1, 0, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		if got := s.next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("parseCron(%q).next(%v) = %v, want %v", tt.expr, tt.after, got, tt.want)
+		}
+	}
+}
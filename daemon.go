@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// daemonLockHeartbeat はジョブの実行中にロックファイルの更新日時を更新する間隔
+	daemonLockHeartbeat = time.Minute
+	// daemonLockStale はロックファイルを残したまま異常終了したとみなすまでの時間（更新されていないロックは奪う）
+	daemonLockStale = 5 * daemonLockHeartbeat
+	// daemonStopTimeout は終了するときに、実行中のジョブに中断を伝えてから強制終了するまでの待ち時間
+	daemonStopTimeout = 30 * time.Second
+)
+
+// daemonJob is one recurring job: the arguments of a notion-dfs command run
+// on a cron schedule.
+type daemonJob struct {
+	name     string
+	schedule *cronSchedule
+	args     []string
+	state    *daemonJobState
+}
+
+// daemonJobState is the state of a job kept across daemon restarts in
+// daemon/<job>.json in the cache dir, so that a restarted daemon knows which
+// run it missed.
+type daemonJobState struct {
+	path      string
+	LastStart time.Time `json:"last_start"`
+	LastEnd   time.Time `json:"last_end"`
+	// LastError は前回の実行が失敗した場合のエラー。成功した場合は空
+	LastError string `json:"last_error,omitempty"`
+	Runs      int    `json:"runs"`
+	Failures  int    `json:"failures"`
+}
+
+// runDaemon runs the jobs of the config file (or one job given on the command
+// line) on their cron schedules until interrupted. Each run is a separate
+// notion-dfs process, so a failing job does not stop the daemon, and a lock
+// file per job keeps two daemons from running the same job at the same time.
+func runDaemon(args []string) {
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	configFile := fs.String("config", "", "config file with the jobs (default: $NOTION_DFS_CONFIG or the user config dir)")
+	var only []string
+	fs.Func("job", "run only this job of the config (repeatable); with a command after the flags, the name of that job", func(v string) error {
+		only = append(only, v)
+		return nil
+	})
+	schedule := fs.String("schedule", "", `cron schedule such as "0 6 * * *", @daily or "@every 30m"; overrides the schedule of the --job`)
+	runNow := fs.Bool("run-now", false, "also run the jobs once at startup")
+	noCatchUp := fs.Bool("no-catch-up", false, "do not run the jobs whose scheduled run was missed while the daemon was not running")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs daemon [flags]")
+		fmt.Fprintln(os.Stderr, "       notion-dfs daemon --job <name> --schedule <cron> [flags] -- <command> [args]...")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fatal(err)
+	}
+	jobs, err := daemonJobs(cfg.Jobs, only, *schedule, fs.Args())
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *daemonJob) {
+			defer wg.Done()
+			job.loop(ctx, *runNow, !*noCatchUp)
+		}(job)
+	}
+	wg.Wait()
+	log.Print("daemon stopped")
+}
+
+// daemonJobs は設定ファイルのジョブと --job・--schedule・コマンドの引数から実行するジョブを決めます
+func daemonJobs(configured map[string]jobConfig, only []string, schedule string, command []string) ([]*daemonJob, error) {
+	if len(command) > 0 {
+		// コマンドラインで指定した1つのジョブ
+		if len(only) != 1 || schedule == "" {
+			return nil, errors.New("a command needs one --job name and a --schedule")
+		}
+		configured = map[string]jobConfig{only[0]: {Schedule: schedule, Args: command}}
+	}
+	if schedule != "" && len(only) != 1 {
+		return nil, errors.New("--schedule needs exactly one --job")
+	}
+	names := only
+	if len(names) == 0 {
+		for name := range configured {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no jobs: add jobs to the config or pass --job, --schedule and a command")
+	}
+	var jobs []*daemonJob
+	for _, name := range names {
+		jc, ok := configured[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown job %q (not in the jobs of the config)", name)
+		}
+		if schedule != "" {
+			jc.Schedule = schedule
+		}
+		s, err := parseCron(jc.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", name, err)
+		}
+		if len(jc.Args) == 0 {
+			return nil, fmt.Errorf("job %s: no args", name)
+		}
+		if jc.Args[0] == "daemon" {
+			return nil, fmt.Errorf("job %s: a job cannot run the daemon", name)
+		}
+		if strings.ContainsAny(name, `/\:*?"<>|`) {
+			return nil, fmt.Errorf("invalid job name %q", name)
+		}
+		state, err := openDaemonJobState(name)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &daemonJob{name: name, schedule: s, args: jc.Args, state: state})
+	}
+	return jobs, nil
+}
+
+// loop は ctx がキャンセルされるまで、スケジュールの時刻ごとにジョブを実行します
+func (j *daemonJob) loop(ctx context.Context, runNow, catchUp bool) {
+	last := *j.state
+	now := time.Now()
+	if runNow {
+		log.Printf("[%s] running at startup", j.name)
+		j.run(ctx)
+	} else if catchUp && !last.LastStart.IsZero() {
+		// 前回の実行の次の予定時刻を過ぎていれば、停止中に逃した実行として1回だけ実行する
+		if missed := j.schedule.next(last.LastStart); !missed.IsZero() && !missed.After(now) {
+			log.Printf("[%s] running the run scheduled at %s that was missed", j.name, missed.Format(time.RFC3339))
+			j.run(ctx)
+		}
+	}
+	for {
+		next := j.schedule.next(time.Now())
+		if next.IsZero() {
+			log.Printf("[%s] the schedule never matches; not scheduling the job", j.name)
+			return
+		}
+		log.Printf("[%s] next run at %s", j.name, next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		j.run(ctx)
+	}
+}
+
+// run はジョブを notion-dfs の別のプロセスとして1回実行し、結果を状態に記録します。
+// ほかのプロセスが同じジョブを実行中ならスキップする
+func (j *daemonJob) run(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+	unlock, err := acquireJobLock(j.name)
+	if err != nil {
+		log.Printf("[%s] skipped: %v", j.name, err)
+		return
+	}
+	defer unlock()
+
+	exe, err := os.Executable()
+	if err != nil {
+		log.Printf("[%s] %v", j.name, err)
+		return
+	}
+	cmd := exec.CommandContext(ctx, exe, j.args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// 停止するときはまず中断を伝え、実行中の書き込みなどが終わるのを待ってから（WaitDelay の後に）強制終了する
+	prepareJobProcess(cmd)
+	cmd.Cancel = func() error {
+		if err := interruptJob(cmd.Process); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+	cmd.WaitDelay = daemonStopTimeout
+
+	start := time.Now()
+	log.Printf("[%s] started: notion-dfs %s", j.name, strings.Join(j.args, " "))
+	err = cmd.Run()
+	end := time.Now()
+	if err != nil {
+		log.Printf("[%s] failed after %s: %v", j.name, end.Sub(start).Round(time.Second), err)
+	} else {
+		log.Printf("[%s] finished in %s", j.name, end.Sub(start).Round(time.Second))
+	}
+	if err := j.state.record(start, end, err); err != nil {
+		log.Printf("[%s] error saving the state: %v", j.name, err)
+	}
+}
+
+// acquireJobLock はジョブのロックファイル（キャッシュディレクトリの daemon/<job>.lock）を作ります。
+// 実行中はロックファイルの更新日時を定期的に更新し、daemonLockStale の間更新されていないロックは異常終了の残りとして奪う
+func acquireJobLock(name string) (unlock func(), err error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "daemon", name+".lock")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		info, statErr := os.Stat(path)
+		if statErr == nil && time.Since(info.ModTime()) < daemonLockStale {
+			holder, _ := os.ReadFile(path)
+			return nil, fmt.Errorf("the job is already running (pid %s, lock %s)", strings.TrimSpace(string(holder)), path)
+		}
+		log.Printf("warning: removing the stale lock %s", path)
+		os.Remove(path)
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(f, strconv.Itoa(os.Getpid()))
+	f.Close()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(daemonLockHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case t := <-ticker.C:
+				os.Chtimes(path, t, t)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		os.Remove(path)
+	}, nil
+}
+
+func openDaemonJobState(name string) (*daemonJobState, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	state := &daemonJobState{path: filepath.Join(dir, "daemon", name+".json")}
+	data, err := os.ReadFile(state.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", state.path, err)
+	}
+	return state, nil
+}
+
+// record はジョブの実行結果を記録してファイルに保存します
+func (s *daemonJobState) record(start, end time.Time, runErr error) error {
+	s.LastStart, s.LastEnd = start, end
+	s.Runs++
+	s.LastError = ""
+	if runErr != nil {
+		s.Failures++
+		s.LastError = runErr.Error()
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// prepareJobProcess は Windows 以外では何もしません（daemon_windows.go）
+func prepareJobProcess(cmd *exec.Cmd) {}
+
+// interruptJob はジョブのプロセスに os.Interrupt（SIGINT）を送ります
+func interruptJob(p *os.Process) error {
+	return p.Signal(os.Interrupt)
+}
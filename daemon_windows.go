@@ -0,0 +1,32 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Windows では os.Interrupt を別のプロセスに送れないため、ジョブを新しいプロセスグループで起動し、
+// そのグループに CTRL_BREAK_EVENT を送って中断を伝える（Go のプログラムでは os.Interrupt として届く）
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+)
+
+const ctrlBreakEvent = 1
+
+// prepareJobProcess はジョブのプロセスを、中断を送れるよう新しいプロセスグループで起動するようにします
+func prepareJobProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// interruptJob はジョブのプロセスグループに CTRL_BREAK_EVENT を送ります。デーモンがコンソールを持たない場合
+// （サービスとして実行している場合など）は失敗し、呼び出し元が強制終了する
+func interruptJob(p *os.Process) error {
+	if ok, _, err := procGenerateConsoleCtrlEvent.Call(ctrlBreakEvent, uintptr(p.Pid)); ok == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jomei/notionapi"
+)
+
+// queryDatabase returns every row of a database in the order of sorts (the
+// database's default order if empty), following pagination. Users in people
+// properties are given their names where the API left them out.
+func queryDatabase(ctx context.Context, client *notionapi.Client, databaseID notionapi.DatabaseID, sorts []notionapi.SortObject) ([]notionapi.Page, error) {
+	return queryDatabaseFiltered(ctx, client, databaseID, nil, sorts)
+}
+
+// queryDatabaseFiltered は queryDatabase と同じですが、filter に一致する行だけを返します
+func queryDatabaseFiltered(ctx context.Context, client *notionapi.Client, databaseID notionapi.DatabaseID, filter notionapi.Filter, sorts []notionapi.SortObject) ([]notionapi.Page, error) {
+	var pages []notionapi.Page
+	err := queryDatabasePages(ctx, client, databaseID, filter, sorts, func(rows []notionapi.Page) error {
+		pages = append(pages, rows...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// queryDatabasePages は filter に一致する行を、APIの応答のページ（最大100行）ごとに取得したそばから fn に渡します。
+// すべての行を保持しないため、行の多いデータベースでもメモリを使わない
+func queryDatabasePages(ctx context.Context, client *notionapi.Client, databaseID notionapi.DatabaseID, filter notionapi.Filter, sorts []notionapi.SortObject, fn func(rows []notionapi.Page) error) error {
+	var cursor notionapi.Cursor
+	for {
+		resp, err := client.Database.Query(ctx, databaseID, &notionapi.DatabaseQueryRequest{
+			Filter:      filter,
+			Sorts:       sorts,
+			StartCursor: cursor,
+			PageSize:    100,
+		})
+		if err != nil {
+			return err
+		}
+		for i := range resp.Results {
+			workspaceUsers(client).resolvePeople(ctx, client, &resp.Results[i])
+		}
+		if err := fn(resp.Results); err != nil {
+			return err
+		}
+		if !resp.HasMore {
+			return nil
+		}
+		cursor = resp.NextCursor
+	}
+}
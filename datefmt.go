@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// dateDisplay は日付・日時を出力するときのタイムゾーンと書式（--timezone・--date-format）
+var dateDisplay dateFormat
+
+// dateFormat converts the dates and times written into the output: date
+// properties, date mentions, created and last edited times, and front matter
+// dates. Times are shown in loc and formatted with layout; dates without a
+// time use the part of the layout before the time of day, and are never
+// moved to another day by the time zone. The zero value keeps the values
+// the API returns (UTC, ISO 8601).
+type dateFormat struct {
+	// loc は --timezone。nil なら変換しない
+	loc *time.Location
+	// layout は --date-format（Go の書式）。空なら出力形式ごとの既定の書式
+	layout string
+}
+
+// configureDates は --timezone と --date-format（サブコマンドでは NOTION_DFS_TIMEZONE・NOTION_DFS_DATE_FORMAT）を設定します
+func configureDates(timezone, layout string) error {
+	timezone = firstNonEmpty(timezone, os.Getenv("NOTION_DFS_TIMEZONE"))
+	layout = firstNonEmpty(layout, os.Getenv("NOTION_DFS_DATE_FORMAT"))
+	var f dateFormat
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("invalid --timezone %q (expected an IANA time zone such as Asia/Tokyo, UTC or Local)", timezone)
+		}
+		f.loc = loc
+	}
+	if layout != "" {
+		// 書式の要素を含まない文字列は、そのまま出力されてしまう
+		if time.Date(2001, 11, 22, 10, 30, 40, 0, time.UTC).Format(layout) == layout {
+			return fmt.Errorf(`invalid --date-format %q (expected a Go layout such as "2006/01/02 15:04")`, layout)
+		}
+		f.layout = layout
+	}
+	dateDisplay = f
+	return nil
+}
+
+// in は t を --timezone の時刻にします。指定がないか、時刻のない日付なら t のまま
+func (f dateFormat) in(t time.Time) time.Time {
+	if f.loc == nil || dateOnly(t) {
+		return t
+	}
+	return t.In(f.loc)
+}
+
+// timestamp は作成日時・最終更新日時などの時刻を整形します。--date-format がなければ fallback の書式
+func (f dateFormat) timestamp(t time.Time, fallback string) string {
+	return f.in(t).Format(firstNonEmpty(f.layout, fallback))
+}
+
+// date は日付プロパティや日付のメンションの値を整形します。時刻のない日付（UTC の0時）はタイムゾーンで日付をずらさない
+func (f dateFormat) date(d notionapi.Date) string {
+	t := time.Time(d)
+	if dateOnly(t) {
+		return t.Format(firstNonEmpty(dateOnlyLayout(f.layout), "2006-01-02"))
+	}
+	return f.timestamp(t, time.RFC3339)
+}
+
+// dateOnly は時刻のない日付（API の "2024-05-06" は UTC の0時になる）かどうかを返します
+func dateOnly(t time.Time) bool {
+	return t.Location() == time.UTC && t.Equal(t.Truncate(24*time.Hour))
+}
+
+// dateRange は開始と（あれば）終了の日付を "開始 → 終了" の形にします
+func (f dateFormat) dateRange(start, end *notionapi.Date) string {
+	if start == nil {
+		return ""
+	}
+	if end != nil {
+		return f.date(*start) + " → " + f.date(*end)
+	}
+	return f.date(*start)
+}
+
+// dateOnlyLayout は書式から時刻の部分（最初の時・分・秒・午前午後・タイムゾーンの要素以降）を除きます
+func dateOnlyLayout(layout string) string {
+	cut := len(layout)
+	for _, token := range []string{"15", "03", "3:", "04", "05", "PM", "pm", "MST", "Z07", "-07"} {
+		if i := strings.Index(layout, token); i >= 0 && i < cut {
+			cut = i
+		}
+	}
+	if cut == 0 {
+		// 時刻だけの書式は日付に使えないので既定に戻す
+		return ""
+	}
+	return strings.TrimRight(layout[:cut], " T,")
+}
+
+// formatDateMentions は --timezone か --date-format が指定されていれば、日付のメンションの表示テキストを整形し直します
+func formatDateMentions(block notionapi.Block) {
+	if dateDisplay == (dateFormat{}) {
+		return
+	}
+	for _, rt := range blockRichTexts(block) {
+		for i := range rt {
+			m := rt[i].Mention
+			if m == nil || m.Type != "date" || m.Date == nil || m.Date.Start == nil {
+				continue
+			}
+			rt[i].PlainText = dateDisplay.dateRange(m.Date.Start, m.Date.End)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/jomei/notionapi"
+)
+
+// runDB handles the database subcommands.
+func runDB(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs db add <database-id> [--prop 'Name=value']... [--json row.json] [--dry-run]")
+		fmt.Fprintln(os.Stderr, "       notion-dfs db summarize <database-id> (--property <name> | --block) [--concurrency 4] [--force] [--dry-run]")
+		fmt.Fprintln(os.Stderr, "       notion-dfs db schema <database-id> [--format json|yaml]")
+		fmt.Fprintln(os.Stderr, "       notion-dfs db codegen <database-id> [--package models] [--type Task] [-o task.go]")
+		fmt.Fprintln(os.Stderr, "       notion-dfs db export <database-id> [--format jsonl] [--stream] [--filter 'Property=value']... [-o rows.jsonl]")
+		fmt.Fprintln(os.Stderr, "       notion-dfs db export --format xlsx -o rows.xlsx <database-id>...")
+		fmt.Fprintln(os.Stderr, "\nValues are converted according to the property type in the database schema.")
+	}
+	if len(args) < 1 {
+		usage()
+		exit(1)
+	}
+
+	switch args[0] {
+	case "add":
+		runDBAdd(args[1:], usage)
+	case "summarize":
+		runDBSummarize(args[1:], usage)
+	case "schema":
+		runDBSchema(args[1:], usage)
+	case "codegen":
+		runDBCodegen(args[1:], usage)
+	case "export":
+		runDBExport(args[1:], usage)
+	default:
+		usage()
+		exit(1)
+	}
+}
+
+// runDBAdd inserts a page into a database with the given property values.
+func runDBAdd(args []string, usage func()) {
+	fs := flag.NewFlagSet("db add", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	var props stringList
+	fs.Var(&props, "prop", "property value as Name=value (repeatable; lists such as multi-select are comma-separated)")
+	jsonFile := fs.String("json", "", "JSON file with an object of property names to values (- for stdin)")
+	dryRun := fs.Bool("dry-run", false, "print the Notion API request that would create the row instead of sending it")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 || (len(props) == 0 && *jsonFile == "") {
+		fs.Usage()
+		exit(1)
+	}
+	if *dryRun {
+		enableDryRun()
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	databaseID := notionapi.DatabaseID(formatPageID(positional[0]))
+	db, err := client.Database.Get(ctx, databaseID)
+	if err != nil {
+		exitWithNotionError("Error fetching database", err)
+	}
+
+	types := schemaPropertyTypes(db.Properties)
+	properties := notionapi.Properties{}
+	if *jsonFile != "" {
+		if err := rowPropertiesFromJSON(types, *jsonFile, properties); err != nil {
+			fatal(err)
+		}
+	}
+	// --prop は JSON の値より優先する
+	if err := types.setProperties(props, properties); err != nil {
+		fatal(err)
+	}
+
+	page, err := client.Page.Create(ctx, &notionapi.PageCreateRequest{
+		Parent:     notionapi.Parent{Type: notionapi.ParentTypeDatabaseID, DatabaseID: databaseID},
+		Properties: properties,
+	})
+	if err != nil {
+		exitWithNotionError("Error creating row", err)
+	}
+	fmt.Println(page.URL)
+}
+
+// rowPropertiesFromJSON は {"Name": "Foo", "Tags": ["a", "b"], "Done": true} のようなJSONを読み込みます。
+// 文字列・数値・真偽値・配列はスキーマに従って変換し、オブジェクトはAPIのプロパティ値としてそのまま送る
+func rowPropertiesFromJSON(types propertyTypes, file string, properties notionapi.Properties) error {
+	data, err := readInputFile(file)
+	if err != nil {
+		return err
+	}
+	var row map[string]any
+	if err := json.Unmarshal(data, &row); err != nil {
+		return fmt.Errorf("invalid JSON in %s: %w", file, err)
+	}
+	names := make([]string, 0, len(row))
+	for name := range row {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key, typ, ok := types.lookup(name)
+		if !ok {
+			return types.unknownPropertyError(name)
+		}
+		var values []string
+		switch v := row[name].(type) {
+		case map[string]any:
+			// {"select": {"name": "Done"}} のような値、または中身の {"name": "Done"} だけ
+			value := any(v)
+			if inner, ok := v[string(typ)]; ok {
+				value = inner
+			}
+			properties[key] = propertyValue{typ: notionapi.PropertyType(typ), value: value}
+			continue
+		case []any:
+			for _, item := range v {
+				values = append(values, fmt.Sprint(item))
+			}
+		case nil:
+			values = []string{""}
+		case string:
+			values = splitPropertyValues(typ, v)
+		default:
+			values = []string{fmt.Sprint(v)}
+		}
+		p, err := parsePropertyValue(typ, values)
+		if err != nil {
+			return fmt.Errorf("property %q: %w", key, err)
+		}
+		properties[key] = p
+	}
+	return nil
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// databaseRow is a row of a database as written by db export. Property
+// values are resolved for data pipelines: relations carry the titles of the
+// related pages, people their names, and numbers, checkboxes and lists keep
+// their JSON types instead of being joined into text.
+type databaseRow struct {
+	ID             string         `json:"id"`
+	URL            string         `json:"url"`
+	CreatedTime    string         `json:"created_time"`
+	LastEditedTime string         `json:"last_edited_time"`
+	Properties     map[string]any `json:"properties"`
+}
+
+// runDBExport writes the rows of a database, one JSON object per line, or
+// the rows of one or more databases as an Excel workbook.
+func runDBExport(args []string, usage func()) {
+	fs := flag.NewFlagSet("db export", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "jsonl", "output format: jsonl (one JSON object per row and line) or xlsx (an Excel workbook with a sheet per database)")
+	stream := fs.Bool("stream", false, "write the rows as they are fetched instead of after fetching all of them, keeping only one page of results in memory")
+	output := fs.String("o", "", "write the rows to this file instead of stdout")
+	var filters stringList
+	fs.Var(&filters, "filter", "export only the rows matching this condition, e.g. 'Status=Published' or 'Date>=2024-01-01' (repeatable; rows must match all)")
+	var opts relationOptions
+	fs.IntVar(&opts.depth, "resolve-relations-depth", defaultRelationDepth, "fetch the pages that relation properties point to, to show their titles; 0 to show IDs without fetching")
+	positional := parseInterspersed(fs, args)
+	if len(positional) == 0 {
+		fs.Usage()
+		exit(1)
+	}
+	switch {
+	case *format != "jsonl" && *format != "xlsx":
+		fatalf("invalid --format %q (expected jsonl or xlsx)", *format)
+	case *format == "jsonl" && len(positional) > 1:
+		fatal("--format jsonl exports one database at a time (use --format xlsx for a sheet per database)")
+	case *stream && *format != "jsonl":
+		fatal("--stream can only be used with --format jsonl")
+	}
+	if opts.depth < 0 {
+		fatal("--resolve-relations-depth must not be negative")
+	}
+	conds, err := parsePropertyConditions(filters)
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	if *format == "xlsx" {
+		exportDatabasesXLSX(ctx, client, positional, conds, *output, opts)
+		return
+	}
+	databaseID := notionapi.DatabaseID(formatPageID(positional[0]))
+	filter, err := databaseFilter(ctx, client, databaseID, conds)
+	if err != nil {
+		exitWithNotionError("Error fetching database", err)
+	}
+	var rows []notionapi.Page
+	if !*stream {
+		// 取得に失敗したときに途中までの出力を残さないよう、すべての行を取得してから書く
+		if rows, err = queryDatabaseFiltered(ctx, client, databaseID, filter, nil); err != nil {
+			exitWithNotionError("Error querying database", err)
+		}
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatalf("Error creating output file: %v", err)
+		}
+		out = f
+	}
+	w := newRowWriter(out, client, opts)
+	if *stream {
+		if err := queryDatabasePages(ctx, client, databaseID, filter, nil, func(rows []notionapi.Page) error {
+			return w.write(ctx, rows)
+		}); err != nil {
+			exitWithNotionError("Error querying database", err)
+		}
+	} else if err := w.write(ctx, rows); err != nil {
+		fatalf("Error writing output file: %v", err)
+	}
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			fatalf("Error writing output file: %v", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d rows\n", w.count)
+}
+
+// exportDatabasesXLSX はデータベースごとに1つのシートにした Excel のブックを書きます
+func exportDatabasesXLSX(ctx context.Context, client *notionapi.Client, ids []string, conds []propertyCondition, output string, opts relationOptions) {
+	sheets := make([]xlsxSheet, 0, len(ids))
+	rows := 0
+	for _, id := range ids {
+		sheet, err := databaseSheet(ctx, client, notionapi.DatabaseID(formatPageID(id)), conds, opts)
+		if err != nil {
+			exitWithNotionError("Error querying database", err)
+		}
+		sheets = append(sheets, sheet)
+		rows += len(sheet.rows)
+	}
+	out := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			fatalf("Error creating output file: %v", err)
+		}
+		out = f
+	}
+	if err := writeXLSX(out, sheets); err != nil {
+		fatalf("Error writing output file: %v", err)
+	}
+	if output != "" {
+		if err := out.Close(); err != nil {
+			fatalf("Error writing output file: %v", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "exported %d rows\n", rows)
+}
+
+// databaseSheet はデータベースのすべての行（conds があれば一致する行）をシートにします。列はタイトル、残りのプロパティの名前順で、
+// 終了日のある日付のプロパティには「（終了）」の列を加える
+func databaseSheet(ctx context.Context, client *notionapi.Client, databaseID notionapi.DatabaseID, conds []propertyCondition, opts relationOptions) (xlsxSheet, error) {
+	schema, err := fetchDatabaseSchema(ctx, client, databaseID)
+	if err != nil {
+		return xlsxSheet{}, err
+	}
+	filter, err := databaseFilter(ctx, client, databaseID, conds)
+	if err != nil {
+		return xlsxSheet{}, err
+	}
+	pages, err := queryDatabaseFiltered(ctx, client, databaseID, filter, nil)
+	if err != nil {
+		return xlsxSheet{}, err
+	}
+	d := workspacePages(client)
+	ranges := make(map[string]bool)
+	for i := range pages {
+		d.resolve(ctx, client, &pages[i], opts.depth)
+		for name, prop := range pages[i].Properties {
+			if p, ok := prop.(*notionapi.DateProperty); ok && p.Date != nil && p.Date.End != nil {
+				ranges[name] = true
+			}
+		}
+	}
+
+	var names []string
+	for _, p := range schema.Properties {
+		if p.Type == string(notionapi.PropertyConfigTypeTitle) {
+			names = append([]string{p.Name}, names...)
+		} else {
+			names = append(names, p.Name)
+		}
+	}
+	sheet := xlsxSheet{name: schema.Title, rows: make([][]any, 0, len(pages))}
+	for _, name := range names {
+		sheet.columns = append(sheet.columns, name)
+		if ranges[name] {
+			sheet.columns = append(sheet.columns, name+"（終了）")
+		}
+	}
+	for i := range pages {
+		row := make([]any, 0, len(sheet.columns))
+		for _, name := range names {
+			prop := pages[i].Properties[name]
+			row = append(row, d.cellValue(prop, opts))
+			if ranges[name] {
+				var end any
+				if p, ok := prop.(*notionapi.DateProperty); ok && p.Date != nil && p.Date.End != nil {
+					end = time.Time(*p.Date.End)
+				}
+				row = append(row, end)
+			}
+		}
+		sheet.rows = append(sheet.rows, row)
+	}
+	return sheet, nil
+}
+
+// cellValue はプロパティの値をシートのセルにします。数値・チェックボックス・日付（開始）・作成日時などは型のある値、
+// それ以外はテキスト（リレーションは関連先のタイトル）にする
+func (d *pageDirectory) cellValue(prop notionapi.Property, opts relationOptions) any {
+	switch p := prop.(type) {
+	case nil:
+		return nil
+	case *notionapi.NumberProperty:
+		return p.Number
+	case *notionapi.CheckboxProperty:
+		return p.Checkbox
+	case *notionapi.DateProperty:
+		return dateCell(p.Date)
+	case *notionapi.FormulaProperty:
+		switch p.Formula.Type {
+		case notionapi.FormulaTypeNumber:
+			return p.Formula.Number
+		case notionapi.FormulaTypeBoolean:
+			return p.Formula.Boolean
+		case notionapi.FormulaTypeDate:
+			return dateCell(p.Formula.Date)
+		}
+	case *notionapi.RollupProperty:
+		switch p.Rollup.Type {
+		case "number":
+			return p.Rollup.Number
+		case "date":
+			return dateCell(p.Rollup.Date)
+		}
+	case *notionapi.CreatedTimeProperty:
+		return p.CreatedTime
+	case *notionapi.LastEditedTimeProperty:
+		return p.LastEditedTime
+	}
+	if text := d.propertyText(prop, opts); text != "" {
+		return text
+	}
+	return nil
+}
+
+// dateCell は日付の開始をセルにします
+func dateCell(date *notionapi.DateObject) any {
+	if date == nil || date.Start == nil {
+		return nil
+	}
+	return time.Time(*date.Start)
+}
+
+// rowWriter は行を JSON Lines として書きます
+type rowWriter struct {
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	client *notionapi.Client
+	opts   relationOptions
+	count  int
+}
+
+func newRowWriter(w io.Writer, client *notionapi.Client, opts relationOptions) *rowWriter {
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	return &rowWriter{buf: buf, enc: enc, client: client, opts: opts}
+}
+
+// write は行のリレーションを解決して書き、パイプの先がすぐに読めるよう書き出します
+func (w *rowWriter) write(ctx context.Context, rows []notionapi.Page) error {
+	d := workspacePages(w.client)
+	for i := range rows {
+		page := &rows[i]
+		d.resolve(ctx, w.client, page, w.opts.depth)
+		if err := w.enc.Encode(d.databaseRow(page, w.opts)); err != nil {
+			return err
+		}
+		w.count++
+	}
+	return w.buf.Flush()
+}
+
+// databaseRow は行を出力する形にします（リレーションは resolve で取得したページだけを使う）
+func (d *pageDirectory) databaseRow(page *notionapi.Page, opts relationOptions) databaseRow {
+	row := databaseRow{
+		ID:             formatPageID(string(page.ID)),
+		URL:            page.URL,
+		CreatedTime:    page.CreatedTime.UTC().Format(time.RFC3339),
+		LastEditedTime: page.LastEditedTime.UTC().Format(time.RFC3339),
+		Properties:     make(map[string]any, len(page.Properties)),
+	}
+	for name, prop := range page.Properties {
+		row.Properties[name] = d.propertyValue(prop, opts)
+	}
+	return row
+}
+
+// propertyValue はプロパティの値を JSON の値にします。数値・チェックボックスはそのまま、
+// マルチセレクト・人物・リレーション・ファイルは文字列の配列、日付は start と end のオブジェクトにし、
+// 値のないプロパティやテキストにできない種類は nil
+func (d *pageDirectory) propertyValue(prop notionapi.Property, opts relationOptions) any {
+	switch p := prop.(type) {
+	case *notionapi.NumberProperty:
+		return p.Number
+	case *notionapi.CheckboxProperty:
+		return p.Checkbox
+	case *notionapi.MultiSelectProperty:
+		names := make([]string, 0, len(p.MultiSelect))
+		for _, opt := range p.MultiSelect {
+			names = append(names, opt.Name)
+		}
+		return names
+	case *notionapi.PeopleProperty:
+		names := make([]string, 0, len(p.People))
+		for _, user := range p.People {
+			names = append(names, firstNonEmpty(user.Name, string(user.ID)))
+		}
+		return names
+	case *notionapi.RelationProperty:
+		titles := make([]string, 0, len(p.Relation))
+		for _, r := range p.Relation {
+			if opts.depth <= 0 {
+				titles = append(titles, formatPageID(string(r.ID)))
+			} else {
+				titles = append(titles, d.relationTitle(r.ID, false))
+			}
+		}
+		return titles
+	case *notionapi.FilesProperty:
+		urls := make([]string, 0, len(p.Files))
+		for _, file := range p.Files {
+			if file.File != nil {
+				urls = append(urls, file.File.URL)
+			} else if file.External != nil {
+				urls = append(urls, file.External.URL)
+			}
+		}
+		return urls
+	case *notionapi.DateProperty:
+		return dateValue(p.Date)
+	case *notionapi.FormulaProperty:
+		switch p.Formula.Type {
+		case notionapi.FormulaTypeNumber:
+			return p.Formula.Number
+		case notionapi.FormulaTypeBoolean:
+			return p.Formula.Boolean
+		case notionapi.FormulaTypeDate:
+			return dateValue(p.Formula.Date)
+		}
+		return p.Formula.String
+	case *notionapi.RollupProperty:
+		switch p.Rollup.Type {
+		case "number":
+			return p.Rollup.Number
+		case "date":
+			return dateValue(p.Rollup.Date)
+		case "array":
+			items := make([]any, 0, len(p.Rollup.Array))
+			for _, item := range p.Rollup.Array {
+				items = append(items, d.propertyValue(item, opts))
+			}
+			return items
+		}
+		return nil
+	case *notionapi.CreatedTimeProperty:
+		return p.CreatedTime.UTC().Format(time.RFC3339)
+	case *notionapi.LastEditedTimeProperty:
+		return p.LastEditedTime.UTC().Format(time.RFC3339)
+	}
+	if text := propertyText(prop); text != "" {
+		return text
+	}
+	return nil
+}
+
+// dateValue は日付を {"start": ..., "end": ...} にします。時刻のない日付は "2006-01-02"、時刻があれば RFC 3339
+func dateValue(date *notionapi.DateObject) any {
+	if date == nil || date.Start == nil {
+		return nil
+	}
+	value := map[string]any{"start": isoDate(*date.Start), "end": nil}
+	if date.End != nil {
+		value["end"] = isoDate(*date.End)
+	}
+	return value
+}
+
+func isoDate(d notionapi.Date) string {
+	t := time.Time(d)
+	if dateOnly(t) {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// propertyCondition is one --filter condition on the rows of a database, such
+// as Status=Published or Date>=2024-01-01. It is turned into a Notion filter
+// once the type of the property is known (databaseFilter), so that the API
+// only returns the matching rows.
+type propertyCondition struct {
+	Property string `json:"property"`
+	Op       string `json:"op"`
+	Value    string `json:"value"`
+}
+
+func (c propertyCondition) String() string {
+	return c.Property + c.Op + c.Value
+}
+
+// filterOperators は --filter の比較演算子。同じ位置から始まるものは長いほうを優先する
+var filterOperators = []string{">=", "<=", "!=", "!~", "=", "~", ">", "<"}
+
+// parsePropertyConditions は "Property=value" などの --filter の指定を条件にします。
+// プロパティ名と値は最初の演算子で分ける
+func parsePropertyConditions(values []string) ([]propertyCondition, error) {
+	var conds []propertyCondition
+	for _, v := range values {
+		c, ok := propertyCondition{}, false
+		for i := 0; i < len(v) && !ok; i++ {
+			for _, op := range filterOperators {
+				if strings.HasPrefix(v[i:], op) {
+					c = propertyCondition{Property: strings.TrimSpace(v[:i]), Op: op, Value: strings.TrimSpace(v[i+len(op):])}
+					ok = true
+					break
+				}
+			}
+		}
+		if !ok || c.Property == "" {
+			return nil, fmt.Errorf("invalid filter %q (expected Property=value, with =, !=, ~, !~, >, >=, < or <=)", v)
+		}
+		if c.Value == "" && c.Op != "=" && c.Op != "!=" {
+			return nil, fmt.Errorf("invalid filter %q: %s needs a value", v, c.Op)
+		}
+		conds = append(conds, c)
+	}
+	return conds, nil
+}
+
+// databaseFilter はすべての条件に一致する行だけを返す、データベースのプロパティの種類に合わせたフィルターを作ります。
+// 条件がなければ nil。データベースにない created_time・last_edited_time はページの作成日時・最終更新日時で比べる
+func databaseFilter(ctx context.Context, client *notionapi.Client, databaseID notionapi.DatabaseID, conds []propertyCondition) (notionapi.Filter, error) {
+	if len(conds) == 0 {
+		return nil, nil
+	}
+	db, err := client.Database.Get(ctx, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	filters := make(notionapi.AndCompoundFilter, 0, len(conds))
+	for _, c := range conds {
+		var f notionapi.Filter
+		if config, ok := db.Properties[c.Property]; ok {
+			f, err = c.filter(config.GetType())
+		} else if c.Property == string(notionapi.TimestampCreated) || c.Property == string(notionapi.TimestampLastEdited) {
+			f, err = c.filter(notionapi.PropertyConfigType(c.Property))
+		} else {
+			err = fmt.Errorf("the database %q has no property %q", renderer.PlainText(db.Title), c.Property)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("--filter %q: %w", c.String(), err)
+		}
+		filters = append(filters, f)
+	}
+	if len(filters) == 1 {
+		return filters[0], nil
+	}
+	return filters, nil
+}
+
+// filter は条件を kind の種類のプロパティのフィルターにします
+func (c propertyCondition) filter(kind notionapi.PropertyConfigType) (notionapi.Filter, error) {
+	f := notionapi.PropertyFilter{Property: c.Property}
+	var err error
+	switch kind {
+	case notionapi.PropertyConfigTypeTitle, notionapi.PropertyConfigTypeRichText, notionapi.PropertyConfigTypeURL,
+		notionapi.PropertyConfigTypeEmail, notionapi.PropertyConfigTypePhoneNumber:
+		f.RichText, err = c.text(kind)
+	case notionapi.PropertyConfigTypeNumber:
+		f.Number, err = c.number(kind)
+	case notionapi.PropertyConfigTypeCheckbox:
+		f.Checkbox, err = c.checkbox(kind)
+	case notionapi.PropertyConfigTypeSelect:
+		f.Select, err = c.choice(kind)
+	case notionapi.PropertyConfigStatus:
+		var s *notionapi.SelectFilterCondition
+		if s, err = c.choice(kind); err == nil {
+			f.Status = &notionapi.StatusFilterCondition{Equals: s.Equals, DoesNotEqual: s.DoesNotEqual, IsEmpty: s.IsEmpty, IsNotEmpty: s.IsNotEmpty}
+		}
+	case notionapi.PropertyConfigTypeMultiSelect:
+		var m *notionapi.MultiSelectFilterCondition
+		if m, err = c.contains(kind, c.Value); err == nil {
+			f.MultiSelect = m
+		}
+	case notionapi.PropertyConfigTypePeople:
+		var m *notionapi.MultiSelectFilterCondition
+		if m, err = c.contains(kind, c.Value); err == nil {
+			f.People = &notionapi.PeopleFilterCondition{Contains: m.Contains, DoesNotContain: m.DoesNotContain, IsEmpty: m.IsEmpty, IsNotEmpty: m.IsNotEmpty}
+		}
+	case notionapi.PropertyConfigTypeRelation:
+		var m *notionapi.MultiSelectFilterCondition
+		id := c.Value
+		if id != "" {
+			id = formatPageID(id)
+		}
+		if m, err = c.contains(kind, id); err == nil {
+			f.Relation = &notionapi.RelationFilterCondition{Contains: m.Contains, DoesNotContain: m.DoesNotContain, IsEmpty: m.IsEmpty, IsNotEmpty: m.IsNotEmpty}
+		}
+	case notionapi.PropertyConfigTypeDate:
+		f.Date, err = c.date(kind)
+	case notionapi.PropertyConfigTypeFormula:
+		f.Formula, err = c.formula()
+	case notionapi.PropertyConfigTypeRollup:
+		// ロールアップは値が数値なら数値、日付なら日付として比べる
+		f.Rollup = &notionapi.RollupFilterCondition{}
+		if _, numErr := strconv.ParseFloat(c.Value, 64); numErr == nil {
+			f.Rollup.Number, err = c.number(kind)
+		} else {
+			f.Rollup.Date, err = c.date(kind)
+		}
+	case notionapi.PropertyConfigCreatedTime, notionapi.PropertyConfigLastEditedTime:
+		var d *notionapi.DateFilterCondition
+		if d, err = c.date(kind); err != nil {
+			return nil, err
+		}
+		t := notionapi.TimestampFilter{Timestamp: notionapi.TimestampType(kind)}
+		if kind == notionapi.PropertyConfigCreatedTime {
+			t.CreatedTime = d
+		} else {
+			t.LastEditedTime = d
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("%s properties cannot be filtered", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c propertyCondition) unsupported(kind notionapi.PropertyConfigType) error {
+	return fmt.Errorf("%s properties cannot be compared with %s", kind, c.Op)
+}
+
+func (c propertyCondition) text(kind notionapi.PropertyConfigType) (*notionapi.TextFilterCondition, error) {
+	t := &notionapi.TextFilterCondition{}
+	switch c.Op {
+	case "=":
+		t.Equals, t.IsEmpty = c.Value, c.Value == ""
+	case "!=":
+		t.DoesNotEqual, t.IsNotEmpty = c.Value, c.Value == ""
+	case "~":
+		t.Contains = c.Value
+	case "!~":
+		t.DoesNotContain = c.Value
+	default:
+		return nil, c.unsupported(kind)
+	}
+	return t, nil
+}
+
+func (c propertyCondition) number(kind notionapi.PropertyConfigType) (*notionapi.NumberFilterCondition, error) {
+	n := &notionapi.NumberFilterCondition{}
+	if c.Value == "" {
+		n.IsEmpty, n.IsNotEmpty = c.Op == "=", c.Op == "!="
+		return n, nil
+	}
+	v, err := strconv.ParseFloat(c.Value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not a number", c.Value)
+	}
+	switch c.Op {
+	case "=":
+		n.Equals = &v
+	case "!=":
+		n.DoesNotEqual = &v
+	case ">":
+		n.GreaterThan = &v
+	case ">=":
+		n.GreaterThanOrEqualTo = &v
+	case "<":
+		n.LessThan = &v
+	case "<=":
+		n.LessThanOrEqualTo = &v
+	default:
+		return nil, c.unsupported(kind)
+	}
+	return n, nil
+}
+
+// checkbox は true・false との比較にします。API は false との一致を表せないため、反対の値との不一致にする
+func (c propertyCondition) checkbox(kind notionapi.PropertyConfigType) (*notionapi.CheckboxFilterCondition, error) {
+	v, err := strconv.ParseBool(c.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not true or false", c.Value)
+	}
+	switch c.Op {
+	case "=":
+	case "!=":
+		v = !v
+	default:
+		return nil, c.unsupported(kind)
+	}
+	if v {
+		return &notionapi.CheckboxFilterCondition{Equals: true}, nil
+	}
+	return &notionapi.CheckboxFilterCondition{DoesNotEqual: true}, nil
+}
+
+// choice はセレクト・ステータスの選択肢との一致にします。値が空なら未選択かどうか
+func (c propertyCondition) choice(kind notionapi.PropertyConfigType) (*notionapi.SelectFilterCondition, error) {
+	s := &notionapi.SelectFilterCondition{}
+	switch c.Op {
+	case "=":
+		s.Equals, s.IsEmpty = c.Value, c.Value == ""
+	case "!=":
+		s.DoesNotEqual, s.IsNotEmpty = c.Value, c.Value == ""
+	default:
+		return nil, c.unsupported(kind)
+	}
+	return s, nil
+}
+
+// contains はマルチセレクト・人物・リレーションが value を含むかどうかにします。値が空なら空かどうか
+func (c propertyCondition) contains(kind notionapi.PropertyConfigType, value string) (*notionapi.MultiSelectFilterCondition, error) {
+	m := &notionapi.MultiSelectFilterCondition{}
+	switch c.Op {
+	case "=", "~":
+		m.Contains, m.IsEmpty = value, value == ""
+	case "!=", "!~":
+		m.DoesNotContain, m.IsNotEmpty = value, value == ""
+	default:
+		return nil, c.unsupported(kind)
+	}
+	return m, nil
+}
+
+// date は日付（2006-01-02）または日時（RFC 3339）との比較にします
+func (c propertyCondition) date(kind notionapi.PropertyConfigType) (*notionapi.DateFilterCondition, error) {
+	d := &notionapi.DateFilterCondition{}
+	if c.Value == "" {
+		d.IsEmpty, d.IsNotEmpty = c.Op == "=", c.Op == "!="
+		return d, nil
+	}
+	t, err := parseFilterDate(c.Value)
+	if err != nil {
+		return nil, err
+	}
+	v := notionapi.Date(t)
+	switch c.Op {
+	case "=":
+		d.Equals = &v
+	case ">":
+		d.After = &v
+	case ">=":
+		d.OnOrAfter = &v
+	case "<":
+		d.Before = &v
+	case "<=":
+		d.OnOrBefore = &v
+	default:
+		return nil, c.unsupported(kind)
+	}
+	return d, nil
+}
+
+// formula は数式の結果の種類を値から決めます。true・false はチェックボックス、数値は数値、日付は日付、それ以外はテキスト
+func (c propertyCondition) formula() (*notionapi.FormulaFilterCondition, error) {
+	kind := notionapi.PropertyConfigTypeFormula
+	f := &notionapi.FormulaFilterCondition{}
+	var err error
+	if c.Value == "true" || c.Value == "false" {
+		f.Checkbox, err = c.checkbox(kind)
+	} else if _, numErr := strconv.ParseFloat(c.Value, 64); numErr == nil {
+		f.Number, err = c.number(kind)
+	} else if _, dateErr := parseFilterDate(c.Value); dateErr == nil {
+		f.Date, err = c.date(kind)
+	} else {
+		f.String, err = c.text(kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseFilterDate(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date (2006-01-02) or a time (RFC 3339)", s)
+	}
+	return t, nil
+}
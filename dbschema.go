@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// databaseSchema is the property definitions of a database as printed by
+// db schema. Properties are sorted by name so that the output of a database
+// whose schema did not change stays the same, and it can be diffed to catch
+// changes that break a pipeline.
+type databaseSchema struct {
+	ID         string           `json:"id"`
+	Title      string           `json:"title"`
+	URL        string           `json:"url,omitempty"`
+	Properties []schemaProperty `json:"properties"`
+}
+
+// schemaProperty は1つのプロパティの定義。種類ごとの設定は該当する種類の場合だけ設定する
+type schemaProperty struct {
+	Name string `json:"name"`
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type"`
+	// NumberFormat は数値の表示形式（"number"・"yen" など）
+	NumberFormat string `json:"number_format,omitempty"`
+	// Options はセレクト・マルチセレクト・ステータスの選択肢、Groups はステータスのグループ
+	Options []schemaOption `json:"options,omitempty"`
+	Groups  []schemaGroup  `json:"groups,omitempty"`
+	// Expression は数式
+	Expression string          `json:"expression,omitempty"`
+	Relation   *schemaRelation `json:"relation,omitempty"`
+	Rollup     *schemaRollup   `json:"rollup,omitempty"`
+	// Prefix は ID（unique_id）のプロパティの接頭辞
+	Prefix string `json:"prefix,omitempty"`
+}
+
+type schemaOption struct {
+	Name  string `json:"name"`
+	ID    string `json:"id,omitempty"`
+	Color string `json:"color,omitempty"`
+}
+
+// schemaGroup はステータスのグループと、それに属する選択肢の名前
+type schemaGroup struct {
+	Name    string   `json:"name"`
+	Color   string   `json:"color,omitempty"`
+	Options []string `json:"options"`
+}
+
+// schemaRelation は関連先のデータベースと、双方向のリレーションなら関連先の対になるプロパティ
+type schemaRelation struct {
+	DatabaseID     string `json:"database_id"`
+	Type           string `json:"type,omitempty"`
+	SyncedProperty string `json:"synced_property,omitempty"`
+}
+
+// schemaRollup は集計するリレーションとその関連先のプロパティ、集計の方法
+type schemaRollup struct {
+	RelationProperty string `json:"relation_property"`
+	RollupProperty   string `json:"rollup_property"`
+	Function         string `json:"function"`
+}
+
+// runDBSchema prints the property definitions of a database as JSON or YAML.
+func runDBSchema(args []string, usage func()) {
+	fs := flag.NewFlagSet("db schema", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "json", "output format: json or yaml")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fs.Usage()
+		exit(1)
+	}
+	if *format != "json" && *format != "yaml" {
+		fatalf("invalid --format %q (expected json or yaml)", *format)
+	}
+
+	client := newNotionClient()
+	schema, err := fetchDatabaseSchema(context.Background(), client, notionapi.DatabaseID(formatPageID(positional[0])))
+	if err != nil {
+		exitWithNotionError("Error fetching database", err)
+	}
+	if *format == "yaml" {
+		writeSchemaYAML(os.Stdout, schema)
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(schema); err != nil {
+		fatal(err)
+	}
+}
+
+// fetchDatabaseSchema はデータベースを取得し、プロパティの定義を名前順にまとめます
+func fetchDatabaseSchema(ctx context.Context, client *notionapi.Client, databaseID notionapi.DatabaseID) (*databaseSchema, error) {
+	db, err := client.Database.Get(ctx, databaseID)
+	if err != nil {
+		return nil, err
+	}
+	schema := &databaseSchema{
+		ID:         formatPageID(string(db.ID)),
+		Title:      renderer.PlainText(db.Title),
+		URL:        db.URL,
+		Properties: make([]schemaProperty, 0, len(db.Properties)),
+	}
+	names := make([]string, 0, len(db.Properties))
+	for name := range db.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema.Properties = append(schema.Properties, newSchemaProperty(name, db.Properties[name]))
+	}
+	return schema, nil
+}
+
+// newSchemaProperty はプロパティの定義から、種類ごとの設定を取り出します
+func newSchemaProperty(name string, config notionapi.PropertyConfig) schemaProperty {
+	p := schemaProperty{Name: name, ID: propertyConfigID(config), Type: string(config.GetType())}
+	switch c := config.(type) {
+	case *notionapi.NumberPropertyConfig:
+		p.NumberFormat = string(c.Number.Format)
+	case *notionapi.SelectPropertyConfig:
+		p.Options = schemaOptions(c.Select.Options)
+	case *notionapi.MultiSelectPropertyConfig:
+		p.Options = schemaOptions(c.MultiSelect.Options)
+	case *notionapi.StatusPropertyConfig:
+		p.Options = schemaOptions(c.Status.Options)
+		names := make(map[string]string, len(c.Status.Options))
+		for _, opt := range c.Status.Options {
+			names[string(opt.ID)] = opt.Name
+		}
+		for _, group := range c.Status.Groups {
+			g := schemaGroup{Name: group.Name, Color: group.Color, Options: []string{}}
+			for _, id := range group.OptionIDs {
+				g.Options = append(g.Options, firstNonEmpty(names[string(id)], string(id)))
+			}
+			p.Groups = append(p.Groups, g)
+		}
+	case *notionapi.FormulaPropertyConfig:
+		p.Expression = c.Formula.Expression
+	case *notionapi.RelationPropertyConfig:
+		p.Relation = &schemaRelation{
+			DatabaseID:     formatPageID(string(c.Relation.DatabaseID)),
+			Type:           string(c.Relation.Type),
+			SyncedProperty: c.Relation.SyncedPropertyName,
+		}
+	case *notionapi.RollupPropertyConfig:
+		p.Rollup = &schemaRollup{
+			RelationProperty: c.Rollup.RelationPropertyName,
+			RollupProperty:   c.Rollup.RollupPropertyName,
+			Function:         string(c.Rollup.Function),
+		}
+	case *notionapi.UniqueIDPropertyConfig:
+		p.Prefix = c.UniqueID.Prefix
+	}
+	return p
+}
+
+// propertyConfigID はプロパティのIDを返します。ID の型が種類ごとにまちまちで、リレーションの定義には
+// ID のフィールドがないため、JSON から取り出す
+func propertyConfigID(config notionapi.PropertyConfig) string {
+	var common struct {
+		ID string `json:"id"`
+	}
+	if data, err := json.Marshal(config); err == nil {
+		json.Unmarshal(data, &common)
+	}
+	return common.ID
+}
+
+func schemaOptions(options []notionapi.Option) []schemaOption {
+	out := make([]schemaOption, 0, len(options))
+	for _, opt := range options {
+		out = append(out, schemaOption{Name: opt.Name, ID: string(opt.ID), Color: string(opt.Color)})
+	}
+	return out
+}
+
+// writeSchemaYAML はスキーマを JSON と同じキーの YAML として書きます。
+// 文字列は常にクォートし、YAMLとして解釈が変わらないようにします
+func writeSchemaYAML(w io.Writer, schema *databaseSchema) {
+	q := strconv.Quote
+	fmt.Fprintf(w, "id: %s\ntitle: %s\n", q(schema.ID), q(schema.Title))
+	if schema.URL != "" {
+		fmt.Fprintf(w, "url: %s\n", q(schema.URL))
+	}
+	if len(schema.Properties) == 0 {
+		fmt.Fprintln(w, "properties: []")
+		return
+	}
+	fmt.Fprintln(w, "properties:")
+	for _, p := range schema.Properties {
+		fmt.Fprintf(w, "  - name: %s\n", q(p.Name))
+		if p.ID != "" {
+			fmt.Fprintf(w, "    id: %s\n", q(p.ID))
+		}
+		fmt.Fprintf(w, "    type: %s\n", q(p.Type))
+		if p.NumberFormat != "" {
+			fmt.Fprintf(w, "    number_format: %s\n", q(p.NumberFormat))
+		}
+		if len(p.Options) > 0 {
+			fmt.Fprintln(w, "    options:")
+			for _, opt := range p.Options {
+				fmt.Fprintf(w, "      - name: %s\n", q(opt.Name))
+				if opt.ID != "" {
+					fmt.Fprintf(w, "        id: %s\n", q(opt.ID))
+				}
+				if opt.Color != "" {
+					fmt.Fprintf(w, "        color: %s\n", q(opt.Color))
+				}
+			}
+		}
+		if len(p.Groups) > 0 {
+			fmt.Fprintln(w, "    groups:")
+			for _, g := range p.Groups {
+				fmt.Fprintf(w, "      - name: %s\n", q(g.Name))
+				if g.Color != "" {
+					fmt.Fprintf(w, "        color: %s\n", q(g.Color))
+				}
+				options := make([]string, len(g.Options))
+				for i, name := range g.Options {
+					options[i] = q(name)
+				}
+				fmt.Fprintf(w, "        options: [%s]\n", strings.Join(options, ", "))
+			}
+		}
+		if p.Expression != "" {
+			fmt.Fprintf(w, "    expression: %s\n", q(p.Expression))
+		}
+		if r := p.Relation; r != nil {
+			fmt.Fprintf(w, "    relation:\n      database_id: %s\n", q(r.DatabaseID))
+			if r.Type != "" {
+				fmt.Fprintf(w, "      type: %s\n", q(r.Type))
+			}
+			if r.SyncedProperty != "" {
+				fmt.Fprintf(w, "      synced_property: %s\n", q(r.SyncedProperty))
+			}
+		}
+		if r := p.Rollup; r != nil {
+			fmt.Fprintf(w, "    rollup:\n      relation_property: %s\n      rollup_property: %s\n      function: %s\n",
+				q(r.RelationProperty), q(r.RollupProperty), q(r.Function))
+		}
+		if p.Prefix != "" {
+			fmt.Fprintf(w, "    prefix: %s\n", q(p.Prefix))
+		}
+	}
+}
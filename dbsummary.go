@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// summaryCalloutIcon はページに書き込む要約のコールアウトの絵文字
+const summaryCalloutIcon = "📝"
+
+// dbSummaryState records the rows that `db summarize` has written, with the
+// last edited time of each row right after its summary was written, so that
+// an interrupted or repeated run skips the rows that have not changed since.
+type dbSummaryState struct {
+	path string
+	mu   sync.Mutex
+	Rows map[notionapi.ObjectID]time.Time `json:"rows"`
+}
+
+func openDBSummaryState(databaseID notionapi.DatabaseID) (*dbSummaryState, error) {
+	return openSummaryState(compactPageID(string(databaseID)))
+}
+
+// openSummaryState は db-summaries/<name>.json の状態を開きます（serve --webhook-summarize は "webhook"）
+func openSummaryState(name string) (*dbSummaryState, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	state := &dbSummaryState{path: filepath.Join(dir, "db-summaries", name+".json"), Rows: make(map[notionapi.ObjectID]time.Time)}
+	data, err := os.ReadFile(state.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", state.path, err)
+	}
+	return state, nil
+}
+
+// done は行が要約を書き込んだ後から編集されていないかを返します
+func (s *dbSummaryState) done(row *notionapi.Page) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	written, ok := s.Rows[row.ID]
+	return ok && !row.LastEditedTime.After(written)
+}
+
+// record は行を書き込み済みにし、中断しても続きから再開できるよう、そのつどファイルに保存します
+func (s *dbSummaryState) record(id notionapi.ObjectID, lastEdited time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dryRunning {
+		// 書き込んでいないので、次に実行したときも要約の対象にする
+		return nil
+	}
+	s.Rows[id] = lastEdited
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o644)
+}
+
+// dbSummarizer writes the summary of each row either into a rich text
+// property or into a callout block appended to the row's page.
+type dbSummarizer struct {
+	client *notionapi.Client
+	// property は要約を書き込むプロパティ名。空ならページにコールアウトとして書き込む
+	property string
+	// blockTitle はコールアウトの見出しのテキスト（前回の要約のコールアウトを見つけるのにも使う）
+	blockTitle string
+	// perSection は見出しのセクションごとに要約してから全体を要約する（--summarize-per-section）
+	perSection bool
+	state      *dbSummaryState
+}
+
+// runDBSummarize summarizes the page of every row in a database and writes
+// the summary back to the row. Rows are processed concurrently, and rows that
+// were summarized by an earlier run and not edited since are skipped, so a
+// large database can be summarized over several runs.
+func runDBSummarize(args []string, usage func()) {
+	fs := flag.NewFlagSet("db summarize", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	addLLMFlags(fs)
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	property := fs.String("property", "", "write the summary into this rich text property of each row")
+	block := fs.Bool("block", false, "write the summary as a callout block at the end of each row's page instead of a property")
+	blockTitle := fs.String("block-title", "AI summary", "text of the summary callout; an existing callout with this text is replaced")
+	concurrency := fs.Int("concurrency", 4, "number of rows to summarize at the same time")
+	force := fs.Bool("force", false, "summarize every row again, not only the rows changed since the last run")
+	dryRun := fs.Bool("dry-run", false, "print the Notion API requests that would write the summaries instead of sending them (the summaries are still generated)")
+	perSection := fs.Bool("summarize-per-section", false, "summarize each H1/H2 section of a page separately and compose the page summary from the section summaries")
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 || (*property == "") == !*block {
+		fs.Usage()
+		exit(1)
+	}
+	if *concurrency < 1 {
+		fatal("--concurrency must be at least 1")
+	}
+	if *dryRun {
+		enableDryRun()
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	databaseID := notionapi.DatabaseID(formatPageID(positional[0]))
+	db, err := client.Database.Get(ctx, databaseID)
+	if err != nil {
+		exitWithNotionError("Error fetching database", err)
+	}
+	if *property != "" {
+		key, typ, ok := schemaPropertyTypes(db.Properties).lookup(*property)
+		if !ok {
+			fatalf("unknown property %q in the database", *property)
+		}
+		if typ != notionapi.PropertyConfigTypeRichText {
+			fatalf("property %q is a %s property (the summary needs a text property)", key, typ)
+		}
+		*property = key
+	}
+	state, err := openDBSummaryState(databaseID)
+	if err != nil {
+		fatal(err)
+	}
+	rows, err := queryDatabase(ctx, client, databaseID, nil)
+	if err != nil {
+		exitWithNotionError("Error querying database", err)
+	}
+
+	s := &dbSummarizer{client: client, property: *property, blockTitle: *blockTitle, perSection: *perSection, state: state}
+	var pending []*notionapi.Page
+	for i := range rows {
+		if *force || !state.done(&rows[i]) {
+			pending = append(pending, &rows[i])
+		}
+	}
+	log.Printf("%d rows, %d to summarize (%d unchanged since the last run)", len(rows), len(pending), len(rows)-len(pending))
+
+	// --max-cost の上限に達したら、残りの行はページを取得せずに打ち切る
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	var budgetErr error
+	sem := make(chan struct{}, *concurrency)
+	for i, row := range pending {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(n int, row *notionapi.Page) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			title := propertyTitle(row)
+			if err := s.summarizeRow(ctx, row); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if errors.Is(err, errLLMBudget) {
+					if budgetErr == nil {
+						budgetErr = err
+					}
+					cancel()
+					return
+				}
+				if ctx.Err() == nil {
+					failed++
+					log.Printf("[%d/%d] %s: %v", n, len(pending), title, err)
+				}
+				return
+			}
+			log.Printf("[%d/%d] %s", n, len(pending), title)
+		}(i+1, row)
+	}
+	wg.Wait()
+	if budgetErr != nil {
+		// 要約した行は記録済みのため、上限を上げて再実行すると残りの行から続けられる
+		fatalf("stopped: %v (run again to summarize the remaining rows)", budgetErr)
+	}
+	if failed > 0 {
+		// 失敗した行は状態に記録されないため、再実行すると続きから処理される
+		fatalf("%d rows failed (run again to retry them)", failed)
+	}
+}
+
+// summarizeRow は行のページを要約して書き込み、状態に記録します
+func (s *dbSummarizer) summarizeRow(ctx context.Context, row *notionapi.Page) error {
+	pageID := notionapi.BlockID(row.ID)
+	tree, err := fetchPageTree(ctx, s.client, pageID, fetchLimits{SkipChildPages: true})
+	if err != nil {
+		return err
+	}
+	// 前回書き込んだ要約のコールアウトは要約の対象に含めない
+	var previous []notionapi.BlockID
+	var nodes []*BlockNode
+	for _, node := range tree.Root.Children {
+		if s.property == "" && s.isSummaryCallout(node.Block) {
+			previous = append(previous, node.Block.GetID())
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	var content strings.Builder
+	collectContent(nodes, &content)
+	if strings.TrimSpace(content.String()) == "" {
+		return fmt.Errorf("the page has no text to summarize")
+	}
+	input, err := summaryInput(nodes, s.perSection)
+	if err != nil {
+		return err
+	}
+	summary, err := summarizeContent(input)
+	if err != nil {
+		return err
+	}
+
+	if s.property != "" {
+		page, err := s.client.Page.Update(ctx, notionapi.PageID(row.ID), &notionapi.PageUpdateRequest{
+			Properties: notionapi.Properties{s.property: notionapi.RichTextProperty{RichText: plainRichText(summary)}},
+		})
+		if err != nil {
+			return err
+		}
+		return s.state.record(row.ID, page.LastEditedTime)
+	}
+
+	for _, id := range previous {
+		if _, err := s.client.Block.Delete(ctx, id); err != nil {
+			return err
+		}
+	}
+	callout := quoteBlock(summaryCalloutIcon + " " + s.blockTitle).(*notionapi.CalloutBlock)
+	callout.Callout.Children = parseMarkdown(summary)
+	if _, err := appendBlockTree(ctx, s.client, pageID, "", []notionapi.Block{callout}); err != nil {
+		return err
+	}
+	// ブロックの追加で変わった最終編集日時を記録する
+	page, err := s.client.Page.Get(ctx, notionapi.PageID(row.ID))
+	if err != nil {
+		return err
+	}
+	return s.state.record(row.ID, page.LastEditedTime)
+}
+
+// isSummaryCallout は前回書き込んだ要約のコールアウトかを返します
+func (s *dbSummarizer) isSummaryCallout(block notionapi.Block) bool {
+	c, ok := block.(*notionapi.CalloutBlock)
+	if !ok || c.Callout.Icon == nil || c.Callout.Icon.Emoji == nil || string(*c.Callout.Icon.Emoji) != summaryCalloutIcon {
+		return false
+	}
+	return strings.TrimSpace(renderer.PlainText(c.Callout.RichText)) == s.blockTitle
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultKrokiURL は --kroki-url を指定しない場合の Kroki の公開サーバー
+const defaultKrokiURL = "https://kroki.io"
+
+// diagramRenderer renders diagram code blocks to SVG with a Kroki server
+// (--render-diagrams), for Markdown viewers that do not draw Mermaid or
+// PlantUML themselves.
+type diagramRenderer struct {
+	ctx context.Context
+	// krokiURL は Kroki のサーバーのURL（末尾の / なし）
+	krokiURL string
+}
+
+func newDiagramRenderer(ctx context.Context, krokiURL string) *diagramRenderer {
+	return &diagramRenderer{ctx: ctx, krokiURL: strings.TrimSuffix(krokiURL, "/")}
+}
+
+// imageURL は図をSVGとして返す Kroki のURLです。図の内容は zlib で圧縮してURLに入れる
+// （Kroki の GET の形式）。ファイルに保存しない出力では、画像としてこのURLを参照する
+func (d *diagramRenderer) imageURL(typ, source string) string {
+	var buf bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	zw.Write([]byte(source))
+	zw.Close()
+	return d.krokiURL + "/" + typ + "/svg/" + base64.URLEncoding.EncodeToString(buf.Bytes())
+}
+
+// renderSVG は図を Kroki でSVGにします
+func (d *diagramRenderer) renderSVG(typ, source string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, d.krokiURL+"/"+typ+"/svg", strings.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// 図の構文の誤りは本文にメッセージが入る
+		return nil, fmt.Errorf("kroki returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// linker returns the link function for renderer.Markdown.Diagram, or nil
+// without --render-diagrams.
+func (d *diagramRenderer) linker(assets *assetDownloader) func(typ, source string) (string, error) {
+	if d == nil {
+		return nil
+	}
+	return func(typ, source string) (string, error) {
+		return d.link(typ, source, assets)
+	}
+}
+
+// link returns the image link for a diagram. With assets the diagram is
+// rendered now and saved next to the other files, named after a hash of its
+// source so that unchanged diagrams keep their file; otherwise the link is
+// the Kroki URL that renders it when viewed.
+func (d *diagramRenderer) link(typ, source string, assets *assetDownloader) (string, error) {
+	if assets == nil {
+		return d.imageURL(typ, source), nil
+	}
+	sum := sha256.Sum256([]byte(typ + "\n" + source))
+	name := typ + "-" + hex.EncodeToString(sum[:6]) + ".svg"
+	if link, ok := assets.saved(name); ok {
+		return link, nil
+	}
+	svg, err := d.renderSVG(typ, source)
+	if err != nil {
+		return "", err
+	}
+	return assets.save(name, svg)
+}
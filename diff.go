@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jomei/notionapi"
+)
+
+// runDiff prints a unified diff between the current rendering of a page and
+// its latest snapshot (or an exported Markdown file).
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	against := fs.String("against", "", "compare against this exported Markdown file instead of the latest snapshot")
+	noSave := fs.Bool("no-save", false, "do not save the current rendering as a new snapshot")
+	exitCode := fs.Bool("exit-code", false, "exit with status 1 when the page has changed")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs diff [flags] <page-id>")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(1)
+	}
+
+	pageID := formatPageID(fs.Arg(0))
+	client := newNotionClient()
+
+	// 差分が内容の変更だけを表すよう、実行ごとに変わる値は除いて描画する
+	r := newMarkdownRenderer()
+	r.StripVolatile = true
+	current, err := renderPageMarkdown(context.Background(), client, notionapi.BlockID(pageID), r, fetchLimits{})
+	if err != nil {
+		exitWithNotionError("Error fetching blocks", err)
+	}
+
+	store, err := openSnapshotStore(pageID)
+	if err != nil {
+		fatal(err)
+	}
+
+	changed := false
+	if *against != "" {
+		previous, err := os.ReadFile(*against)
+		if err != nil {
+			fatalf("Error reading previous rendering: %v", err)
+		}
+		fromName := *against
+		if info, err := os.Stat(*against); err == nil {
+			fromName = fmt.Sprintf("%s\t%s", *against, info.ModTime().Format("2006-01-02 15:04:05"))
+		}
+		changed = printDiff(fromName, pageID, string(previous), current)
+	} else {
+		last, err := store.latest()
+		if err != nil {
+			fatalf("Error reading snapshots: %v", err)
+		}
+		if last == nil {
+			fmt.Fprintln(os.Stderr, "No previous snapshot found; saving the current rendering for the next diff.")
+		} else {
+			previous, err := store.read(last)
+			if err != nil {
+				fatalf("Error reading snapshot: %v", err)
+			}
+			fromName := fmt.Sprintf("%s\t%s", last.ID, last.Time.Local().Format("2006-01-02 15:04:05"))
+			changed = printDiff(fromName, pageID, previous, current)
+		}
+	}
+
+	if !*noSave {
+		if _, _, err := saveSnapshotIfChanged(store, current); err != nil {
+			fatalf("Error saving snapshot: %v", err)
+		}
+	}
+
+	if changed && *exitCode {
+		exit(1)
+	}
+}
+
+func printDiff(fromName, pageID, previous, current string) bool {
+	diff := unifiedDiff(fromName, pageID+"\t(current)", previous, current, 3)
+	if diff == "" {
+		fmt.Fprintln(os.Stderr, "No changes.")
+		return false
+	}
+	fmt.Print(diff)
+	return true
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// digestPage is one page included in a digest email.
+type digestPage struct {
+	ID      notionapi.BlockID
+	Title   string
+	tree    *PageTree
+	summary string
+	// lastEdited はデータベースの行の最終編集日時（--database の場合だけ）
+	lastEdited time.Time
+}
+
+// runDigest renders pages (or only their AI summaries) into one HTML email
+// and sends it with the SMTP settings in the config file. With --database the
+// pages are the rows of a database edited in the --since window, and the
+// digest can also be written as Markdown or published as a new Notion page.
+func runDigest(args []string) {
+	fs := flag.NewFlagSet("digest", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	addLLMFlags(fs)
+	configFile := fs.String("config", "", "config file with the smtp settings (default: $NOTION_DFS_CONFIG or the user config dir)")
+	to := fs.String("to", "", "comma-separated recipients (default: digest.to in the config)")
+	subject := fs.String("subject", "", "email subject (default: digest.subject in the config, or the page title)")
+	summaryOnly := fs.Bool("summary-only", false, "include only the AI summary of each page instead of the whole page")
+	noSummary := fs.Bool("no-summary", false, "include the pages without AI summaries")
+	output := fs.String("o", "", "write the email (or the Markdown with --format markdown) to this file instead of sending it")
+	database := fs.String("database", "", "digest the rows of this database edited in the --since window instead of the given pages")
+	since := fs.String("since", "7d", "with --database, include the rows edited within this window: 7d, 2w, 36h or a date such as 2024-05-01")
+	format := fs.String("format", "email", "digest format: email or markdown")
+	publish := fs.String("publish", "", "also create the digest as a new page under this parent page")
+	dryRun := fs.Bool("dry-run", false, "with --publish, print the Notion API requests that would create the page instead of sending them (the email and -o are not affected)")
+	var filters stringList
+	fs.Var(&filters, "filter", "with --database, include only the rows matching this condition, e.g. 'Status=Published' or 'Date>=2024-01-01' (repeatable; rows must match all)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs digest [flags] <page-id>...")
+		fmt.Fprintln(os.Stderr, "       notion-dfs digest --database <database-id> [--since 7d] [flags]")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+	if (len(positional) == 0) == (*database == "") {
+		fs.Usage()
+		exit(1)
+	}
+	if *dryRun && *publish == "" {
+		fatal("--dry-run needs --publish")
+	}
+	if *summaryOnly && *noSummary {
+		fatal("--summary-only cannot be used with --no-summary")
+	}
+	if *format != "email" && *format != "markdown" {
+		fatalf("invalid --format %q: must be email or markdown", *format)
+	}
+	sinceSet := false
+	fs.Visit(func(f *flag.Flag) { sinceSet = sinceSet || f.Name == "since" })
+	if sinceSet && *database == "" {
+		fatal("--since can only be used with --database")
+	}
+	if len(filters) > 0 && *database == "" {
+		fatal("--filter can only be used with --database")
+	}
+	conds, err := parsePropertyConditions(filters)
+	if err != nil {
+		fatal(err)
+	}
+	if *database != "" {
+		// データベースの更新のダイジェストは各行の要約をまとめたもの
+		if *noSummary {
+			fatal("--no-summary cannot be used with --database")
+		}
+		*summaryOnly = true
+	}
+	windowStart, err := parseSince(*since, time.Now())
+	if err != nil {
+		fatal(err)
+	}
+	// --publish だけを指定した場合はメールを送らない
+	sendEmail := *format == "email" && (*publish == "" || *to != "" || *output != "")
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fatal(err)
+	}
+	recipients := cfg.Digest.To
+	if *to != "" {
+		recipients = strings.Split(*to, ",")
+	}
+	for i := range recipients {
+		recipients[i] = strings.TrimSpace(recipients[i])
+	}
+	if sendEmail {
+		if len(recipients) == 0 && *output == "" {
+			fatal("no recipients: pass --to or set digest.to in the config")
+		}
+		if cfg.SMTP.From == "" {
+			fatal("smtp.from must be set in the config")
+		}
+	}
+	if *dryRun {
+		enableDryRun()
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	var pages []*digestPage
+	intro := ""
+	if *database != "" {
+		var dbTitle string
+		pages, dbTitle, err = fetchDigestRows(ctx, client, notionapi.DatabaseID(formatPageID(*database)), windowStart, conds)
+		if err != nil {
+			exitWithNotionError("Error fetching database", err)
+		}
+		period := fmt.Sprintf("%s〜%s", windowStart.Format("2006-01-02"), time.Now().Format("2006-01-02"))
+		if len(pages) == 0 {
+			fmt.Fprintf(os.Stderr, "no rows of %s were edited since %s\n", dbTitle, windowStart.Format(time.RFC3339))
+			return
+		}
+		intro = fmt.Sprintf("%s で %s に編集された %d ページ", dbTitle, period, len(pages))
+		if *subject == "" && cfg.Digest.Subject == "" {
+			*subject = fmt.Sprintf("%s の更新（%s）", dbTitle, period)
+		}
+	} else {
+		for _, arg := range positional {
+			page, err := fetchDigestPage(ctx, client, notionapi.BlockID(formatPageID(arg)), !*noSummary)
+			if err != nil {
+				exitWithNotionError("Error fetching page", err)
+			}
+			pages = append(pages, page)
+		}
+	}
+
+	if *subject == "" {
+		*subject = cfg.Digest.Subject
+	}
+	if *subject == "" {
+		*subject = pages[0].Title
+		if len(pages) > 1 {
+			*subject = fmt.Sprintf("%s ほか%dページ", pages[0].Title, len(pages)-1)
+		}
+	}
+
+	if *publish != "" {
+		page, err := publishDigest(ctx, client, notionapi.PageID(formatPageID(*publish)), *subject, digestMarkdown("", intro, pages, *summaryOnly))
+		if err != nil {
+			exitWithNotionError("Error publishing digest", err)
+		}
+		fmt.Fprintf(os.Stderr, "published digest to %s\n", page.URL)
+	}
+	if *format == "markdown" {
+		md := digestMarkdown(*subject, intro, pages, *summaryOnly)
+		if *output == "" {
+			if *publish == "" {
+				fmt.Print(md)
+			}
+			return
+		}
+		if err := os.WriteFile(*output, []byte(md), 0o644); err != nil {
+			fatalf("Error writing output file: %v", err)
+		}
+		return
+	}
+	if !sendEmail {
+		return
+	}
+
+	msg, err := composeDigest(ctx, cfg.SMTP.From, recipients, *subject, intro, pages, *summaryOnly)
+	if err != nil {
+		fatalf("Error composing email: %v", err)
+	}
+	if *output != "" {
+		if err := os.WriteFile(*output, msg, 0o644); err != nil {
+			fatalf("Error writing output file: %v", err)
+		}
+		return
+	}
+	if err := sendMail(cfg.SMTP, recipients, msg); err != nil {
+		fatalf("Error sending email: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "sent digest to %s\n", strings.Join(recipients, ", "))
+}
+
+func fetchDigestPage(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, summarize bool) (*digestPage, error) {
+	title, err := fetchPageTitle(ctx, client, pageID)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := fetchPageTree(ctx, client, pageID, fetchLimits{})
+	if err != nil {
+		return nil, err
+	}
+	page := &digestPage{ID: pageID, Title: title, tree: tree}
+	if summarize {
+		var contentBuilder strings.Builder
+		collectContent(tree.Root.Children, &contentBuilder)
+		page.summary, err = summarizeContent(contentBuilder.String())
+		if err != nil {
+			log.Printf("Error generating summary for %s: %v", title, err)
+		}
+	}
+	return page, nil
+}
+
+// fetchDigestRows は since より後に編集された（conds があれば一致する）データベースの行を新しい順に取得して要約し、
+// データベースのタイトルとともに返します。本文のない行と要約に失敗した行は警告を出して省く
+func fetchDigestRows(ctx context.Context, client *notionapi.Client, databaseID notionapi.DatabaseID, since time.Time, conds []propertyCondition) ([]*digestPage, string, error) {
+	db, err := client.Database.Get(ctx, databaseID)
+	if err != nil {
+		return nil, "", err
+	}
+	after := notionapi.Date(since)
+	var filter notionapi.Filter = notionapi.TimestampFilter{
+		Timestamp:      notionapi.TimestampLastEdited,
+		LastEditedTime: &notionapi.DateFilterCondition{OnOrAfter: &after},
+	}
+	if props, err := databaseFilter(ctx, client, databaseID, conds); err != nil {
+		return nil, "", err
+	} else if props != nil {
+		filter = notionapi.AndCompoundFilter{filter, props}
+	}
+	rows, err := queryDatabaseFiltered(ctx, client, databaseID, filter,
+		[]notionapi.SortObject{{Timestamp: notionapi.TimestampLastEdited, Direction: notionapi.SortOrderDESC}})
+	if err != nil {
+		return nil, "", err
+	}
+	var pages []*digestPage
+	for i := range rows {
+		row := &rows[i]
+		title := propertyTitle(row)
+		log.Printf("[%d/%d] %s", i+1, len(rows), title)
+		tree, err := fetchPageTree(ctx, client, notionapi.BlockID(row.ID), fetchLimits{SkipChildPages: true})
+		if err != nil {
+			return nil, "", err
+		}
+		var content strings.Builder
+		collectContent(tree.Root.Children, &content)
+		if strings.TrimSpace(content.String()) == "" {
+			log.Printf("warning: skipping %s: the page has no text to summarize", title)
+			continue
+		}
+		summary, err := summarizeContent(content.String())
+		if err != nil {
+			if errors.Is(err, errLLMBudget) {
+				return nil, "", err
+			}
+			log.Printf("warning: skipping %s: %v", title, err)
+			continue
+		}
+		pages = append(pages, &digestPage{ID: notionapi.BlockID(row.ID), Title: title, tree: tree, summary: summary, lastEdited: row.LastEditedTime})
+	}
+	return pages, renderer.PlainText(db.Title), nil
+}
+
+// parseSince は --since の期間（7d・2w・36h のような長さ、または 2024-05-01 のような日付）を開始日時にします
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	var d time.Duration
+	if n, unit := strings.TrimRight(s, "dw"), strings.TrimLeft(s, "0123456789"); n != s && (unit == "d" || unit == "w") {
+		days, err := strconv.Atoi(n)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid --since %q", s)
+		}
+		if unit == "w" {
+			days *= 7
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return time.Time{}, fmt.Errorf("invalid --since %q (expected 7d, 2w, 36h or a date such as 2024-05-01)", s)
+		}
+	}
+	if d <= 0 {
+		return time.Time{}, fmt.Errorf("invalid --since %q: must be positive", s)
+	}
+	return now.Add(-d), nil
+}
+
+// digestMarkdown はダイジェストをMarkdownの文書にします。title が空なら見出しを付けない（Notionのページに書き込む場合）
+func digestMarkdown(title, intro string, pages []*digestPage, summaryOnly bool) string {
+	var b strings.Builder
+	if title != "" {
+		fmt.Fprintf(&b, "# %s\n\n", title)
+	}
+	if intro != "" {
+		fmt.Fprintf(&b, "%s\n\n", intro)
+	}
+	for _, page := range pages {
+		pageURL := "https://www.notion.so/" + compactPageID(string(page.ID))
+		fmt.Fprintf(&b, "## [%s](%s)\n\n", page.Title, pageURL)
+		if !page.lastEdited.IsZero() {
+			fmt.Fprintf(&b, "最終更新: %s\n\n", dateDisplay.timestamp(page.lastEdited.Local(), "2006-01-02 15:04"))
+		}
+		if page.summary != "" {
+			fmt.Fprintf(&b, "%s\n\n", strings.TrimSpace(page.summary))
+		}
+		if !summaryOnly {
+			r := newMarkdownRenderer()
+			r.HeadingShift = 2
+			r.PrintBlocks(&b, page.tree.Root.Children, 0)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// publishDigest はダイジェストを parentID の下の新しいページとして作成します
+func publishDigest(ctx context.Context, client *notionapi.Client, parentID notionapi.PageID, title, markdown string) (*notionapi.Page, error) {
+	page, err := createChildPage(ctx, client, parentID, title)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := appendBlockTree(ctx, client, notionapi.BlockID(page.ID), "", parseMarkdown(markdown)); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// digestStyle はメールクライアントで表示が崩れにくいよう、控えめに指定したスタイル
+const digestStyle = `body { font-family: sans-serif; line-height: 1.6; color: #222; }
+pre { white-space: pre-wrap; background: #f5f5f5; padding: 0.5em; }
+blockquote { border-left: 3px solid #ccc; margin-left: 0; padding-left: 1em; color: #555; }
+.callout, .summary { background: #f1f1ef; padding: 0.5em 1em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 0.2em 0.5em; }
+img { max-width: 100%; }`
+
+// composeDigest builds a MIME message with a plain text part and an HTML
+// part, with the images of the pages attached inline.
+func composeDigest(ctx context.Context, from string, to []string, subject, intro string, pages []*digestPage, summaryOnly bool) ([]byte, error) {
+	images := newEmbeddedImages(ctx, "cid:")
+	r := &htmlRenderer{headingShift: 1, image: images.add}
+
+	var html, text strings.Builder
+	fmt.Fprintf(&html, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"/><style>\n%s\n</style></head><body>\n", digestStyle)
+	if intro != "" {
+		fmt.Fprintf(&html, "<p>%s</p>\n", renderer.EscapeHTML(intro))
+		fmt.Fprintf(&text, "%s\n\n", intro)
+	}
+	for i, page := range pages {
+		if i > 0 {
+			html.WriteString("<hr/>\n")
+			text.WriteString("\n\n")
+		}
+		pageURL := "https://www.notion.so/" + compactPageID(string(page.ID))
+		fmt.Fprintf(&html, "<h1><a href=\"%s\">%s</a></h1>\n", pageURL, renderer.EscapeHTML(page.Title))
+		fmt.Fprintf(&text, "%s\n%s\n\n", page.Title, pageURL)
+		if !page.lastEdited.IsZero() {
+			edited := dateDisplay.timestamp(page.lastEdited.Local(), "2006-01-02 15:04")
+			fmt.Fprintf(&html, "<p>最終更新: %s</p>\n", edited)
+			fmt.Fprintf(&text, "最終更新: %s\n\n", edited)
+		}
+		if page.summary != "" {
+			html.WriteString("<div class=\"summary\"><h2>AI による要約</h2>\n")
+			for _, para := range strings.Split(strings.TrimSpace(page.summary), "\n\n") {
+				fmt.Fprintf(&html, "<p>%s</p>\n", strings.ReplaceAll(renderer.EscapeHTML(para), "\n", "<br/>"))
+			}
+			html.WriteString("</div>\n")
+			fmt.Fprintf(&text, "%s\n\n", strings.TrimSpace(page.summary))
+		}
+		if !summaryOnly {
+			r.renderBlocks(&html, page.tree.Root.Children)
+			collectContent(page.tree.Root.Children, &text)
+		}
+	}
+	html.WriteString("</body></html>\n")
+
+	var msg bytes.Buffer
+	alternative := multipart.NewWriter(&msg)
+	headers := []string{
+		"From: " + headerAddress(from),
+		"To: " + headerAddresses(to),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: " + messageID(from),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + alternative.Boundary(),
+	}
+	msg.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+
+	if err := writeQuotedPrintablePart(alternative, "text/plain; charset=utf-8", text.String()); err != nil {
+		return nil, err
+	}
+	// HTML と画像は multipart/related にまとめ、画像は cid: で参照する
+	var related bytes.Buffer
+	relatedWriter := multipart.NewWriter(&related)
+	if err := writeQuotedPrintablePart(relatedWriter, "text/html; charset=utf-8", html.String()); err != nil {
+		return nil, err
+	}
+	for _, img := range images.items {
+		name := strings.TrimPrefix(img.href, "cid:")
+		part, err := relatedWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {img.mediaType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + name + ">"},
+			"Content-Disposition":       {"inline; filename=\"" + name + "\""},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64Lines(part, img.data)
+	}
+	if err := relatedWriter.Close(); err != nil {
+		return nil, err
+	}
+	part, err := alternative.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/related; boundary=" + relatedWriter.Boundary()}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(related.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+func writeQuotedPrintablePart(w *multipart.Writer, contentType, body string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	qp := quotedprintable.NewWriter(part)
+	if _, err := io.WriteString(qp, body); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeBase64Lines は76文字ごとに改行したBase64を書き込みます（メールの1行の長さの制限のため）
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
+
+// headerAddress は表示名に日本語などを含むアドレスをヘッダーに使える形にエンコードします
+func headerAddress(s string) string {
+	if addr, err := mail.ParseAddress(s); err == nil {
+		return addr.String()
+	}
+	return s
+}
+
+func headerAddresses(list []string) string {
+	encoded := make([]string, len(list))
+	for i, s := range list {
+		encoded[i] = headerAddress(s)
+	}
+	return strings.Join(encoded, ", ")
+}
+
+// messageID は送信者のドメインを使って一意な Message-ID を作ります
+func messageID(from string) string {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if _, d, ok := strings.Cut(addr.Address, "@"); ok {
+			domain = d
+		}
+	}
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+// sendMail sends msg through the configured SMTP server. Authentication is
+// only attempted when a username is set, and requires TLS unless the server
+// is on localhost.
+func sendMail(cfg smtpConfig, to []string, msg []byte) error {
+	if cfg.Host == "" {
+		return fmt.Errorf("smtp.host must be set in the config")
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+		if cfg.TLS == "tls" {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+
+	var c *smtp.Client
+	switch cfg.TLS {
+	case "tls":
+		conn, err := tls.Dial("tcp", addr, tlsConfig)
+		if err != nil {
+			return err
+		}
+		if c, err = smtp.NewClient(conn, cfg.Host); err != nil {
+			return err
+		}
+	case "", "starttls", "none":
+		var err error
+		if c, err = smtp.Dial(addr); err != nil {
+			return err
+		}
+		if cfg.TLS != "none" {
+			if ok, _ := c.Extension("STARTTLS"); !ok {
+				c.Close()
+				return fmt.Errorf("%s does not support STARTTLS (set smtp.tls to \"none\" to send without TLS)", addr)
+			}
+			if err := c.StartTLS(tlsConfig); err != nil {
+				c.Close()
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid smtp.tls %q: must be starttls, tls or none", cfg.TLS)
+	}
+	defer c.Close()
+
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+	from := cfg.From
+	if addr, err := mail.ParseAddress(cfg.From); err == nil {
+		from = addr.Address
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if addr, err := mail.ParseAddress(rcpt); err == nil {
+			rcpt = addr.Address
+		}
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"notion-dfs/renderer"
+)
+
+// docsLayout is the layout shared by the documentation site presets. Pages go
+// below docs/, a page with sub-pages becomes <slug>/index.md with its
+// sub-pages in the same folder, and links between pages are relative.
+type docsLayout struct {
+	pageNames
+	slugs map[*sitePage]string
+	files map[string]string
+}
+
+func (d *docsLayout) prepare(pages []*sitePage) {
+	d.slugs = d.assign(pages, func(p *sitePage) string {
+		return renderer.Slugify(p.Title)
+	}, fileNameText)
+	d.files = make(map[string]string, len(pages))
+	for _, p := range pages {
+		d.files[compactPageID(string(p.ID))] = d.pageFile(p)
+	}
+}
+
+func (d *docsLayout) subPages() bool {
+	return true
+}
+
+// docPath は docs/ からのパスを拡張子なしで返します（Docusaurus のドキュメントIDと同じ）
+func (d *docsLayout) docPath(p *sitePage) string {
+	name := d.slugs[p]
+	if len(p.Children) > 0 {
+		name = path.Join(name, "index")
+	}
+	for parent := p.Parent; parent != nil; parent = parent.Parent {
+		name = path.Join(d.slugs[parent], name)
+	}
+	return name
+}
+
+func (d *docsLayout) pageFile(p *sitePage) string {
+	return filepath.Join("docs", filepath.FromSlash(d.docPath(p))+".md")
+}
+
+func (d *docsLayout) assetDir(p *sitePage) string {
+	return filepath.Join("docs", "assets")
+}
+
+// frontMatter はアイコンの絵文字付きの title を書き、カバー画像・アイコンの画像は本文の先頭に置きます
+func (d *docsLayout) frontMatter(p *sitePage) string {
+	return "---\ntitle: " + strconv.Quote(p.displayTitle()) + "\n---\n\n" + pageBanner(p)
+}
+
+func (d *docsLayout) configureRenderer(r *renderer.Markdown, p *sitePage) {
+	from := filepath.Dir(d.pageFile(p))
+	r.HeadingAnchors = true
+	r.PageLink = func(pageID, text string) (string, bool) {
+		file, ok := d.files[pageID]
+		if !ok {
+			return "", false
+		}
+		rel, err := filepath.Rel(from, file)
+		if err != nil {
+			return "", false
+		}
+		return "[" + text + "](" + (&url.URL{Path: filepath.ToSlash(rel)}).String() + ")", true
+	}
+}
+
+// docusaurusPreset writes a Docusaurus docs tree and a sidebars.js that
+// follows the page hierarchy.
+// https://docusaurus.io/docs/sidebar
+type docusaurusPreset struct {
+	docsLayout
+}
+
+func (d *docusaurusPreset) configureRenderer(r *renderer.Markdown, p *sitePage) {
+	d.docsLayout.configureRenderer(r, p)
+	r.CalloutStyle = "docusaurus"
+}
+
+// docusaurusCategory は sidebars.js のカテゴリ（子ページを持つページ）
+type docusaurusCategory struct {
+	Type  string            `json:"type"`
+	Label string            `json:"label"`
+	Link  map[string]string `json:"link"`
+	Items []any             `json:"items"`
+}
+
+func (d *docusaurusPreset) finish(outDir string, pages []*sitePage) ([]string, error) {
+	var items func(pages []*sitePage) []any
+	items = func(pages []*sitePage) []any {
+		list := []any{}
+		for _, p := range pages {
+			if len(p.Children) == 0 {
+				list = append(list, d.docPath(p))
+				continue
+			}
+			list = append(list, docusaurusCategory{
+				Type:  "category",
+				Label: p.Title,
+				Link:  map[string]string{"type": "doc", "id": d.docPath(p)},
+				Items: items(p.Children),
+			})
+		}
+		return list
+	}
+
+	data, err := json.MarshalIndent(map[string]any{"docs": items(siteRoots(pages))}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(outDir, "sidebars.js")
+	content := "// Generated by notion-dfs. Do not edit.\nmodule.exports = " + string(data) + ";\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		return nil, err
+	}
+	return []string{file}, nil
+}
+
+// mkdocsPreset writes a MkDocs docs tree and an mkdocs.yml whose nav follows
+// the page hierarchy.
+// https://www.mkdocs.org/user-guide/writing-your-docs/#configure-pages-and-navigation
+type mkdocsPreset struct {
+	docsLayout
+}
+
+func (m *mkdocsPreset) configureRenderer(r *renderer.Markdown, p *sitePage) {
+	m.docsLayout.configureRenderer(r, p)
+	r.CalloutStyle = "mkdocs"
+}
+
+func (m *mkdocsPreset) finish(outDir string, pages []*sitePage) ([]string, error) {
+	roots := siteRoots(pages)
+	siteName := "Notion"
+	if len(roots) == 1 {
+		siteName = roots[0].Title
+	}
+
+	var sb strings.Builder
+	sb.WriteString("# Generated by notion-dfs. Do not edit.\n")
+	sb.WriteString("site_name: " + strconv.Quote(siteName) + "\n")
+	// attr_list は見出しの {#anchor}、admonition はコールアウトの !!! を解釈するために必要
+	sb.WriteString("markdown_extensions:\n  - attr_list\n  - admonition\n")
+	sb.WriteString("nav:\n")
+	var nav func(pages []*sitePage, depth int)
+	nav = func(pages []*sitePage, depth int) {
+		indent := strings.Repeat("    ", depth+1)
+		for _, p := range pages {
+			file := m.docPath(p) + ".md"
+			if len(p.Children) == 0 {
+				sb.WriteString(indent + "- " + strconv.Quote(p.Title) + ": " + strconv.Quote(file) + "\n")
+				continue
+			}
+			// セクションの先頭に置いたページがセクションのトップページになる
+			sb.WriteString(indent + "- " + strconv.Quote(p.Title) + ":\n")
+			sb.WriteString(indent + "    - " + strconv.Quote(file) + "\n")
+			nav(p.Children, depth+1)
+		}
+	}
+	nav(roots, 0)
+
+	file := filepath.Join(outDir, "mkdocs.yml")
+	if err := os.WriteFile(file, []byte(sb.String()), 0o644); err != nil {
+		return nil, err
+	}
+	return []string{file}, nil
+}
+
+// siteRoots は階層の最上位のページ（親を持たないページ）を返します
+func siteRoots(pages []*sitePage) []*sitePage {
+	var roots []*sitePage
+	for _, p := range pages {
+		if p.Parent == nil {
+			roots = append(roots, p)
+		}
+	}
+	return roots
+}
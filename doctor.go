@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jomei/notionapi"
+)
+
+// runDoctor validates the token and, when a page ID is given, checks that the
+// page can be read before starting a long run.
+func runDoctor(args []string) {
+	if len(args) > 1 {
+		fmt.Println("Usage: notion-dfs doctor [page-id]")
+		exit(1)
+	}
+
+	ctx := context.Background()
+	ok := true
+
+	token, source := notionTokenCredential.get()
+	switch source {
+	case "environment":
+		fmt.Println("✓ NOTION_API_TOKEN is set")
+	case "keychain":
+		fmt.Println("✓ Notion API token is saved in the keychain")
+	default:
+		fmt.Println("✗ NOTION_API_TOKEN is not set (or save the token with `notion-dfs auth login`)")
+		exit(1)
+	}
+
+	client := newNotionClientWithToken(token)
+
+	me, err := client.User.Me(ctx)
+	if err != nil {
+		printDoctorFailure("token validation failed", err)
+		exit(1)
+	}
+	workspace := ""
+	if me.Bot != nil && me.Bot.WorkspaceName != "" {
+		workspace = fmt.Sprintf(" (workspace: %s)", me.Bot.WorkspaceName)
+	}
+	fmt.Printf("✓ token is valid: %s%s\n", me.Name, workspace)
+
+	if len(args) == 1 {
+		pageID := notionapi.BlockID(formatPageID(args[0]))
+
+		block, err := client.Block.Get(ctx, pageID)
+		if err != nil {
+			printDoctorFailure("page is not accessible", err)
+			ok = false
+		} else {
+			title := ""
+			if page, isPage := block.(*notionapi.ChildPageBlock); isPage {
+				title = fmt.Sprintf(": %s", page.ChildPage.Title)
+			}
+			fmt.Printf("✓ page is accessible%s\n", title)
+
+			// 本文の読み取りにはブロック子要素の取得権限が別途必要になる
+			if _, err := client.Block.GetChildren(ctx, pageID, &notionapi.Pagination{PageSize: 1}); err != nil {
+				printDoctorFailure("page content is not readable", err)
+				ok = false
+			} else {
+				fmt.Println("✓ page content is readable")
+			}
+		}
+	}
+
+	switch _, source := openAIKeyCredential.get(); source {
+	case "environment":
+		fmt.Println("✓ OPENAI_API_KEY is set")
+	case "keychain":
+		fmt.Println("✓ OpenAI API key is saved in the keychain")
+	default:
+		fmt.Println("! OPENAI_API_KEY is not set (summary will be skipped)")
+	}
+
+	if !ok {
+		exit(1)
+	}
+}
+
+func printDoctorFailure(msg string, err error) {
+	fmt.Printf("✗ %s: %v\n", msg, err)
+	if hint := notionErrorHint(err); hint != "" {
+		fmt.Printf("\n%s\n\n", hint)
+	}
+}
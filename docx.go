@@ -0,0 +1,450 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+const (
+	// docxTextWidth は本文の幅（A4、左右の余白 1 インチ）を EMU で表したもの
+	docxTextWidth = 5760720
+	// docxIndent は入れ子1段あたりのインデント（twip）
+	docxIndent = 720
+)
+
+// docxRenderer builds word/document.xml from a page tree, collecting the
+// images, hyperlinks and numbered lists it needs along the way.
+type docxRenderer struct {
+	ctx  context.Context
+	body strings.Builder
+	// rels は document.xml.rels に追加する関係（画像とハイパーリンク）
+	rels []docxRel
+	// media は word/media/ に置く画像
+	media map[string][]byte
+	// numbered は番号付きリストごとに作った番号定義のID（番号を1から振り直すため）
+	numbered []int
+	images   int
+}
+
+type docxRel struct {
+	id, typ, target string
+	external        bool
+}
+
+const (
+	docxRelImage     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+	docxRelHyperlink = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink"
+	// docxBulletNumID は箇条書きに使う番号定義のID（番号付きリストは2以降）
+	docxBulletNumID = 1
+)
+
+// writeDOCX writes a Word document with the page title, the page's blocks
+// and the summary if given.
+func writeDOCX(ctx context.Context, w io.Writer, title string, tree *PageTree, summary string) error {
+	r := &docxRenderer{ctx: ctx, media: make(map[string][]byte)}
+	r.paragraph("Title", "", docxPlainRun(title))
+	r.blocks(tree.Root.Children, 0)
+	if summary != "" {
+		r.paragraph("Heading1", "", docxPlainRun("AI による要約"))
+		for _, para := range strings.Split(strings.TrimSpace(summary), "\n\n") {
+			r.paragraph("", "", docxPlainRun(para))
+		}
+	}
+
+	zw := zip.NewWriter(w)
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxPackageRels},
+		{"docProps/core.xml", docxCoreProperties(title)},
+		{"word/document.xml", docxDocumentStart + r.body.String() + docxDocumentEnd},
+		{"word/styles.xml", docxStyles},
+		{"word/numbering.xml", r.numberingXML()},
+		{"word/_rels/document.xml.rels", r.relsXML()},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	for _, rel := range r.rels {
+		if rel.typ != docxRelImage {
+			continue
+		}
+		fw, err := zw.Create("word/" + rel.target)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(r.media[rel.target]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// blocks は兄弟ブロックを出力します。番号付きリストは連続する項目ごとに番号を振り直す
+func (r *docxRenderer) blocks(nodes []*BlockNode, depth int) {
+	numID := 0
+	for _, node := range nodes {
+		if _, ok := node.Block.(*notionapi.NumberedListItemBlock); ok {
+			if numID == 0 {
+				numID = r.newNumbering(depth)
+			}
+		} else {
+			numID = 0
+		}
+		if r.block(node, depth, numID) {
+			r.blocks(node.Children, depth+1)
+		}
+	}
+}
+
+// block は1つのブロックを出力し、子ブロックを続けて出力すべきかを返します
+func (r *docxRenderer) block(node *BlockNode, depth, numID int) bool {
+	indent := docxIndentProps(depth)
+	switch b := node.Block.(type) {
+	case *notionapi.ParagraphBlock:
+		r.paragraph("", indent, r.runs(b.Paragraph.RichText))
+
+	case *notionapi.Heading1Block:
+		r.paragraph("Heading1", "", docxPlainRun(toggleMarker(b, "▸ "))+r.runs(b.Heading1.RichText))
+
+	case *notionapi.Heading2Block:
+		r.paragraph("Heading2", "", docxPlainRun(toggleMarker(b, "▸ "))+r.runs(b.Heading2.RichText))
+
+	case *notionapi.Heading3Block:
+		r.paragraph("Heading3", "", docxPlainRun(toggleMarker(b, "▸ "))+r.runs(b.Heading3.RichText))
+
+	case *notionapi.BulletedListItemBlock:
+		r.paragraph("ListParagraph", docxNumProps(depth, docxBulletNumID), r.runs(b.BulletedListItem.RichText))
+
+	case *notionapi.NumberedListItemBlock:
+		r.paragraph("ListParagraph", docxNumProps(depth, numID), r.runs(b.NumberedListItem.RichText))
+
+	case *notionapi.ToDoBlock:
+		checkbox := "☐ "
+		if b.ToDo.Checked {
+			checkbox = "☒ "
+		}
+		r.paragraph("", indent, docxPlainRun(checkbox)+r.runs(b.ToDo.RichText))
+
+	case *notionapi.ToggleBlock:
+		r.paragraph("", indent, docxPlainRun("▸ ")+r.runs(b.Toggle.RichText))
+
+	case *notionapi.ImageBlock:
+		if b.Image.Type == "external" {
+			r.image(b.Image.External.URL, indent)
+		} else if b.Image.Type == "file" {
+			r.image(b.Image.File.URL, indent)
+		}
+
+	case *notionapi.CodeBlock:
+		// 改行は段落を分けずに改行として出力し、コードを1つのまとまりにする
+		r.paragraph("Code", indent, docxPlainRun(renderer.PlainText(b.Code.RichText)))
+		if len(b.Code.Caption) > 0 {
+			r.paragraph("Caption", indent, r.runs(b.Code.Caption))
+		}
+
+	case *notionapi.QuoteBlock:
+		r.paragraph("Quote", indent, r.runs(b.Quote.RichText))
+
+	case *notionapi.CalloutBlock:
+		icon := "💡"
+		if b.Callout.Icon != nil && b.Callout.Icon.Type == "emoji" {
+			icon = string(*b.Callout.Icon.Emoji)
+		}
+		r.paragraph("Callout", indent, docxPlainRun(icon+" ")+r.runs(b.Callout.RichText))
+
+	case *notionapi.DividerBlock:
+		r.paragraph("", `<w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="auto"/></w:pBdr>`, "")
+
+	case *notionapi.TableBlock:
+		r.table(node.Children, b.Table.HasColumnHeader)
+		return false
+
+	case *notionapi.ChildPageBlock:
+		// 子ページの中身は見出しを付けて字下げせずに続ける
+		r.paragraph("Heading1", "", docxPlainRun(b.ChildPage.Title))
+		r.blocks(node.Children, depth)
+		return false
+	}
+	return true
+}
+
+func (r *docxRenderer) paragraph(style, props, runs string) {
+	r.body.WriteString("<w:p>")
+	if style != "" || props != "" {
+		r.body.WriteString("<w:pPr>")
+		if style != "" {
+			fmt.Fprintf(&r.body, `<w:pStyle w:val="%s"/>`, style)
+		}
+		r.body.WriteString(props)
+		r.body.WriteString("</w:pPr>")
+	}
+	r.body.WriteString(runs)
+	r.body.WriteString("</w:p>\n")
+}
+
+func docxIndentProps(depth int) string {
+	if depth == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`<w:ind w:left="%d"/>`, depth*docxIndent)
+}
+
+func docxNumProps(depth, numID int) string {
+	return fmt.Sprintf(`<w:numPr><w:ilvl w:val="%d"/><w:numId w:val="%d"/></w:numPr>`, min(depth, 8), numID)
+}
+
+// runs はリッチテキストを装飾とハイパーリンクを含む run の並びにします
+func (r *docxRenderer) runs(richText []notionapi.RichText) string {
+	return r.styledRuns(richText, false)
+}
+
+// styledRuns は runs と同じですが、bold ならすべての run を太字にします（表の見出し行用）
+func (r *docxRenderer) styledRuns(richText []notionapi.RichText, bold bool) string {
+	var sb strings.Builder
+	for _, text := range richText {
+		// rPr の子要素はスキーマの順序（rFonts, b, i, strike, u）で並べる必要がある
+		var props strings.Builder
+		a := text.Annotations
+		if a == nil {
+			a = &notionapi.Annotations{}
+		}
+		if a.Code {
+			props.WriteString(`<w:rFonts w:ascii="Consolas" w:hAnsi="Consolas"/>`)
+		}
+		if a.Bold || bold {
+			props.WriteString("<w:b/>")
+		}
+		if a.Italic {
+			props.WriteString("<w:i/>")
+		}
+		if a.Strikethrough {
+			props.WriteString("<w:strike/>")
+		}
+		if a.Underline {
+			props.WriteString(`<w:u w:val="single"/>`)
+		}
+		// ワークスペース内へのリンク（"/" で始まる）は外部からは開けないため、テキストのみにする
+		if text.Href != "" && !strings.HasPrefix(text.Href, "/") {
+			id := r.addRel(docxRelHyperlink, text.Href, true)
+			fmt.Fprintf(&sb, `<w:hyperlink r:id="%s">`, id)
+			sb.WriteString(docxRun(`<w:rStyle w:val="Hyperlink"/>`+props.String(), text.PlainText))
+			sb.WriteString("</w:hyperlink>")
+			continue
+		}
+		sb.WriteString(docxRun(props.String(), text.PlainText))
+	}
+	return sb.String()
+}
+
+func docxPlainRun(text string) string {
+	return docxRun("", text)
+}
+
+// docxRun はテキストの改行を <w:br/> にした run を返します
+func docxRun(props, text string) string {
+	var sb strings.Builder
+	sb.WriteString("<w:r>")
+	if props != "" {
+		sb.WriteString("<w:rPr>" + props + "</w:rPr>")
+	}
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			sb.WriteString("<w:br/>")
+		}
+		fmt.Fprintf(&sb, `<w:t xml:space="preserve">%s</w:t>`, renderer.EscapeHTML(line))
+	}
+	sb.WriteString("</w:r>")
+	return sb.String()
+}
+
+func (r *docxRenderer) table(rows []*BlockNode, hasHeader bool) {
+	r.body.WriteString(`<w:tbl><w:tblPr><w:tblStyle w:val="TableGrid"/><w:tblW w:w="5000" w:type="pct"/></w:tblPr>`)
+	for i, row := range rows {
+		tr, ok := row.Block.(*notionapi.TableRowBlock)
+		if !ok {
+			continue
+		}
+		header := hasHeader && i == 0
+		r.body.WriteString("<w:tr>")
+		if header {
+			r.body.WriteString("<w:trPr><w:tblHeader/></w:trPr>")
+		}
+		for _, cell := range tr.TableRow.Cells {
+			runs := r.runs(cell)
+			if header {
+				runs = r.styledRuns(cell, true)
+			}
+			// セルには少なくとも1つの段落が必要
+			r.body.WriteString("<w:tc><w:p>" + runs + "</w:p></w:tc>")
+		}
+		r.body.WriteString("</w:tr>\n")
+	}
+	r.body.WriteString("</w:tbl>\n")
+	// 表が続く場合に結合されないよう、空の段落で区切る
+	r.paragraph("", "", "")
+}
+
+// image は画像をダウンロードして埋め込みます。失敗した場合は警告を表示し、URLを本文として出力します
+func (r *docxRenderer) image(rawURL, props string) {
+	data, imageType, width, height, err := fetchRasterImage(r.ctx, rawURL)
+	if err != nil {
+		log.Printf("warning: failed to embed image %s: %v", renderer.StripURLSignature(rawURL), err)
+		r.paragraph("", props, docxPlainRun("[Image] "+renderer.StripURLSignature(rawURL)))
+		return
+	}
+	r.images++
+	ext := ".png"
+	if imageType == "JPG" {
+		ext = ".jpeg"
+	}
+	target := fmt.Sprintf("media/image%d%s", r.images, ext)
+	r.media[target] = data
+	id := r.addRel(docxRelImage, target, false)
+
+	// 96dpiとして実寸を求め、本文の幅に収まるよう縮小する
+	cx, cy := width*9525, height*9525
+	if cx > docxTextWidth {
+		cx, cy = docxTextWidth, cy*docxTextWidth/cx
+	}
+	r.paragraph("", props, fmt.Sprintf(docxDrawing, cx, cy, r.images, r.images, r.images, r.images, id, cx, cy))
+}
+
+func (r *docxRenderer) addRel(typ, target string, external bool) string {
+	// rId1 と rId2 はスタイルと番号定義に使う
+	id := fmt.Sprintf("rId%d", len(r.rels)+3)
+	r.rels = append(r.rels, docxRel{id: id, typ: typ, target: target, external: external})
+	return id
+}
+
+// newNumbering は番号付きリストのために、指定した階層から1で始まる番号定義を作ります
+func (r *docxRenderer) newNumbering(depth int) int {
+	id := docxBulletNumID + 1 + len(r.numbered)
+	r.numbered = append(r.numbered, min(depth, 8))
+	return id
+}
+
+func (r *docxRenderer) numberingXML() string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+`)
+	bullets := []string{"•", "◦", "▪"}
+	for abstract, format := range []string{"bullet", "decimal"} {
+		fmt.Fprintf(&sb, `<w:abstractNum w:abstractNumId="%d"><w:multiLevelType w:val="hybridMultilevel"/>`, abstract)
+		for lvl := 0; lvl < 9; lvl++ {
+			text := bullets[lvl%len(bullets)]
+			if format == "decimal" {
+				text = fmt.Sprintf("%%%d.", lvl+1)
+			}
+			fmt.Fprintf(&sb, `<w:lvl w:ilvl="%d"><w:start w:val="1"/><w:numFmt w:val="%s"/><w:lvlText w:val="%s"/><w:lvlJc w:val="left"/><w:pPr><w:ind w:left="%d" w:hanging="360"/></w:pPr></w:lvl>`,
+				lvl, format, text, (lvl+1)*docxIndent)
+		}
+		sb.WriteString("</w:abstractNum>\n")
+	}
+	fmt.Fprintf(&sb, `<w:num w:numId="%d"><w:abstractNumId w:val="0"/></w:num>`+"\n", docxBulletNumID)
+	for i, lvl := range r.numbered {
+		fmt.Fprintf(&sb, `<w:num w:numId="%d"><w:abstractNumId w:val="1"/><w:lvlOverride w:ilvl="%d"><w:startOverride w:val="1"/></w:lvlOverride></w:num>`+"\n",
+			docxBulletNumID+1+i, lvl)
+	}
+	sb.WriteString("</w:numbering>\n")
+	return sb.String()
+}
+
+func (r *docxRenderer) relsXML() string {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>
+`)
+	for _, rel := range r.rels {
+		mode := ""
+		if rel.external {
+			mode = ` TargetMode="External"`
+		}
+		fmt.Fprintf(&sb, `<Relationship Id="%s" Type="%s" Target="%s"%s/>`+"\n", rel.id, rel.typ, renderer.EscapeHTML(rel.target), mode)
+	}
+	sb.WriteString("</Relationships>\n")
+	return sb.String()
+}
+
+func docxCoreProperties(title string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>%s</dc:title>
+<dc:creator>notion-dfs</dc:creator>
+<dcterms:created xsi:type="dcterms:W3CDTF">%s</dcterms:created>
+</cp:coreProperties>
+`, renderer.EscapeHTML(title), time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+}
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Default Extension="png" ContentType="image/png"/>
+<Default Extension="jpeg" ContentType="image/jpeg"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+</Types>
+`
+
+const docxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>
+`
+
+const docxDocumentStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture">
+<w:body>
+`
+
+// docxDocumentEnd は A4・余白 1 インチのページ設定で本文を閉じます
+const docxDocumentEnd = `<w:sectPr><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="708" w:footer="708" w:gutter="0"/></w:sectPr>
+</w:body>
+</w:document>
+`
+
+// docxDrawing は埋め込み画像（インライン）の描画要素。
+// 引数は幅・高さ（EMU）、docPr のID・名前の番号、cNvPr のID・名前の番号、関係ID、幅・高さ
+const docxDrawing = `<w:r><w:drawing><wp:inline distT="0" distB="0" distL="0" distR="0"><wp:extent cx="%d" cy="%d"/><wp:docPr id="%d" name="Picture %d"/><a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:pic><pic:nvPicPr><pic:cNvPr id="%d" name="image%d"/><pic:cNvPicPr/></pic:nvPicPr><pic:blipFill><a:blip r:embed="%s"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill><pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%d" cy="%d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr></pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r>`
+
+const docxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:docDefaults>
+<w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:eastAsia="Yu Gothic" w:cs="Calibri"/><w:sz w:val="21"/><w:szCs w:val="21"/><w:lang w:val="en-US" w:eastAsia="ja-JP"/></w:rPr></w:rPrDefault>
+<w:pPrDefault><w:pPr><w:spacing w:after="120" w:line="276" w:lineRule="auto"/></w:pPr></w:pPrDefault>
+</w:docDefaults>
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:qFormat/></w:style>
+<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:spacing w:after="240"/></w:pPr><w:rPr><w:b/><w:sz w:val="48"/><w:szCs w:val="48"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:spacing w:before="360" w:after="120"/><w:outlineLvl w:val="0"/></w:pPr><w:rPr><w:b/><w:sz w:val="36"/><w:szCs w:val="36"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:spacing w:before="280" w:after="100"/><w:outlineLvl w:val="1"/></w:pPr><w:rPr><w:b/><w:sz w:val="30"/><w:szCs w:val="30"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading3"><w:name w:val="heading 3"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:spacing w:before="240" w:after="80"/><w:outlineLvl w:val="2"/></w:pPr><w:rPr><w:b/><w:sz w:val="26"/><w:szCs w:val="26"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="ListParagraph"><w:name w:val="List Paragraph"/><w:basedOn w:val="Normal"/><w:qFormat/><w:pPr><w:spacing w:after="40"/><w:contextualSpacing/></w:pPr></w:style>
+<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:qFormat/><w:pPr><w:pBdr><w:left w:val="single" w:sz="18" w:space="8" w:color="BBBBBB"/></w:pBdr><w:ind w:left="284"/></w:pPr><w:rPr><w:color w:val="555555"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:qFormat/><w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F5F5F5"/><w:spacing w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="18"/><w:szCs w:val="18"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Caption"><w:name w:val="caption"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:spacing w:after="200"/></w:pPr><w:rPr><w:i/><w:color w:val="555555"/><w:sz w:val="18"/><w:szCs w:val="18"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Callout"><w:name w:val="Callout"/><w:basedOn w:val="Normal"/><w:qFormat/><w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F1F1EF"/></w:pPr></w:style>
+<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:rPr><w:color w:val="0563C1"/><w:u w:val="single"/></w:rPr></w:style>
+<w:style w:type="table" w:styleId="TableGrid"><w:name w:val="Table Grid"/><w:tblPr><w:tblBorders><w:top w:val="single" w:sz="4" w:space="0" w:color="999999"/><w:left w:val="single" w:sz="4" w:space="0" w:color="999999"/><w:bottom w:val="single" w:sz="4" w:space="0" w:color="999999"/><w:right w:val="single" w:sz="4" w:space="0" w:color="999999"/><w:insideH w:val="single" w:sz="4" w:space="0" w:color="999999"/><w:insideV w:val="single" w:sz="4" w:space="0" w:color="999999"/></w:tblBorders><w:tblCellMar><w:left w:w="108" w:type="dxa"/><w:right w:w="108" w:type="dxa"/></w:tblCellMar></w:tblPr></w:style>
+</w:styles>
+`
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// dryRunning は --dry-run（または NOTION_DFS_DRY_RUN）が有効なことを表します。
+// 書き込みが行われないため、db summarize などの状態も保存しない
+var dryRunning bool
+
+// dryRunTransport prints the requests that would change something in Notion
+// (creating, updating and deleting pages, blocks and comments) instead of
+// sending them, and answers them with a made-up response shaped like the
+// real one, so that a command runs to the end and prints every mutation it
+// would perform. Reads, including database queries and searches, are sent
+// as usual. Blocks "created" by the dry run get placeholder IDs, and their
+// children are kept so that reading them back (as appendBlockTree does for
+// columns) works.
+type dryRunTransport struct {
+	next http.RoundTripper
+	w    io.Writer
+
+	mu sync.Mutex
+	// n は払い出したプレースホルダーのIDの数
+	n int
+	// children はプレースホルダーのIDのブロックに追加したことにした子ブロック
+	children map[string][]map[string]any
+}
+
+// enableDryRun はこれ以降の Notion への書き込みを送らずに標準出力へ表示するようにします
+func enableDryRun() {
+	dryRunning = true
+	if _, ok := http.DefaultTransport.(*dryRunTransport); ok {
+		return
+	}
+	http.DefaultTransport = &dryRunTransport{next: http.DefaultTransport, w: os.Stdout, children: make(map[string][]map[string]any)}
+}
+
+func (t *dryRunTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != notionAPIHost {
+		return t.next.RoundTrip(req)
+	}
+	path := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/v1/"), "/"), "/")
+	if req.Method == http.MethodGet {
+		// 作成したことにしたブロックの子ブロックは、実際には存在しないためここで返す
+		if len(path) == 3 && path[0] == "blocks" && path[2] == "children" {
+			t.mu.Lock()
+			kids, ok := t.children[path[1]]
+			t.mu.Unlock()
+			if ok {
+				return dryRunResponse(req, map[string]any{"object": "list", "results": kids, "has_more": false, "next_cursor": nil})
+			}
+		}
+		return t.next.RoundTrip(req)
+	}
+	if !isNotionMutation(req.Method, path) {
+		return t.next.RoundTrip(req)
+	}
+
+	var data []byte
+	if req.Body != nil {
+		var err error
+		if data, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.print(req, data); err != nil {
+		return nil, err
+	}
+	var body map[string]any
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			return nil, fmt.Errorf("dry run: invalid request body for %s %s: %w", req.Method, req.URL.Path, err)
+		}
+	}
+	return dryRunResponse(req, t.response(req.Method, path, body))
+}
+
+// isNotionMutation は Notion API のリクエストが書き込みかを返します。データベースの問い合わせ・検索・
+// OAuth のトークンの取得は POST でも読み取りとして扱う
+func isNotionMutation(method string, path []string) bool {
+	switch {
+	case method == http.MethodGet || method == http.MethodHead:
+		return false
+	case len(path) == 3 && path[0] == "databases" && path[2] == "query":
+		return false
+	case len(path) >= 1 && (path[0] == "search" || path[0] == "oauth"):
+		return false
+	}
+	return true
+}
+
+// print はリクエストのメソッド・パスと本文（字下げしたJSON）を書きます
+func (t *dryRunTransport) print(req *http.Request, data []byte) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\n", req.Method, req.URL.RequestURI())
+	if len(bytes.TrimSpace(data)) > 0 {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err != nil {
+			indented.Reset()
+			indented.Write(data)
+		}
+		sb.Write(bytes.TrimRight(indented.Bytes(), "\n"))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	_, err := io.WriteString(t.w, sb.String())
+	return err
+}
+
+// response は書き込みのリクエストに対して、APIが返すものと同じ形の応答を作ります
+func (t *dryRunTransport) response(method string, path []string, body map[string]any) map[string]any {
+	id := ""
+	if len(path) >= 2 {
+		id = path[1]
+	}
+	switch {
+	case path[0] == "pages":
+		if id == "" {
+			id = t.newID()
+		}
+		page := map[string]any{"object": "page", "id": id, "url": "https://www.notion.so/" + compactPageID(id), "properties": map[string]any{}}
+		for _, key := range []string{"parent", "archived", "in_trash", "icon", "cover"} {
+			if v, ok := body[key]; ok {
+				page[key] = v
+			}
+		}
+		return page
+
+	case path[0] == "blocks" && len(path) == 3 && path[2] == "children":
+		results := []map[string]any{}
+		if kids, ok := body["children"].([]any); ok {
+			results = t.createBlocks(kids)
+		}
+		return map[string]any{"object": "list", "results": results, "has_more": false, "next_cursor": nil}
+
+	case path[0] == "blocks" && method == http.MethodDelete:
+		return map[string]any{"object": "block", "id": id, "type": "paragraph", "paragraph": map[string]any{"rich_text": []any{}}, "archived": true}
+
+	case path[0] == "comments":
+		// 返信でなければ新しいディスカッションが始まる
+		comment := map[string]any{"object": "comment", "id": t.newID(), "discussion_id": t.newID()}
+		for _, key := range []string{"discussion_id", "parent", "rich_text"} {
+			if v, ok := body[key]; ok {
+				comment[key] = v
+			}
+		}
+		return comment
+	}
+
+	// ブロックやデータベースの更新などは、送った内容にIDを付けて返す
+	resp := copyJSONObject(body)
+	resp["object"] = strings.TrimSuffix(path[0], "s")
+	resp["id"] = firstNonEmpty(id, t.newID())
+	return resp
+}
+
+// createBlocks は追加するブロックにプレースホルダーのIDを付け、子ブロックを取り外して children に保存します
+func (t *dryRunTransport) createBlocks(blocks []any) []map[string]any {
+	created := make([]map[string]any, 0, len(blocks))
+	for _, b := range blocks {
+		src, ok := b.(map[string]any)
+		if !ok {
+			continue
+		}
+		block := copyJSONObject(src)
+		id := t.newID()
+		block["object"], block["id"], block["has_children"] = "block", id, false
+		typ, _ := block["type"].(string)
+		if content, ok := block[typ].(map[string]any); ok {
+			content = copyJSONObject(content)
+			if kids, ok := content["children"].([]any); ok && len(kids) > 0 {
+				t.children[id] = t.createBlocks(kids)
+				block["has_children"] = true
+			}
+			delete(content, "children")
+			block[typ] = content
+		}
+		if _, ok := t.children[id]; !ok {
+			t.children[id] = []map[string]any{}
+		}
+		created = append(created, block)
+	}
+	return created
+}
+
+// newID はプレースホルダーのID（00000000-0000-0000-0000-000000000001 から順に）を返します
+func (t *dryRunTransport) newID() string {
+	t.n++
+	return fmt.Sprintf("00000000-0000-0000-0000-%012x", t.n)
+}
+
+func copyJSONObject(m map[string]any) map[string]any {
+	c := make(map[string]any, len(m))
+	for key, v := range m {
+		c[key] = v
+	}
+	return c
+}
+
+func dryRunResponse(req *http.Request, v any) (*http.Response, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
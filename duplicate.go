@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// runDuplicate copies a page, its blocks and its sub-pages under a new
+// parent. Without --parent the copy is created next to the original, as a
+// new row with the same properties if the original is a database row.
+func runDuplicate(args []string) {
+	fs := flag.NewFlagSet("duplicate", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	parent := fs.String("parent", "", "create the copy under this page (default: the parent of the original)")
+	title := fs.String("title", "", "title of the copy (default: the title of the original)")
+	dryRun := fs.Bool("dry-run", false, "print the Notion API requests that would create the copy instead of sending them")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs duplicate [flags] <page-id>")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(1)
+	}
+
+	if *dryRun {
+		enableDryRun()
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	pageID := notionapi.PageID(formatPageID(fs.Arg(0)))
+	original, err := client.Page.Get(ctx, pageID)
+	if err != nil {
+		exitWithNotionError("Error fetching page", err)
+	}
+	if *title == "" {
+		*title = propertyTitle(original)
+	}
+	tree, err := fetchPageTree(ctx, client, notionapi.BlockID(pageID), fetchLimits{})
+	if err != nil {
+		exitWithNotionError("Error fetching blocks", err)
+	}
+
+	request := &notionapi.PageCreateRequest{Icon: copyableIcon(original.Icon), Cover: copyableCover(original.Cover)}
+	switch {
+	case *parent != "":
+		request.Parent = notionapi.Parent{Type: notionapi.ParentTypePageID, PageID: notionapi.PageID(formatPageID(*parent))}
+	case original.Parent.Type == notionapi.ParentTypePageID || original.Parent.Type == notionapi.ParentTypeDatabaseID:
+		request.Parent = original.Parent
+	default:
+		fatalf("the page is at the top level of the workspace (parent type %s); pass --parent", original.Parent.Type)
+	}
+	if request.Parent.Type == notionapi.ParentTypeDatabaseID {
+		request.Properties = copyableProperties(original)
+		for name, prop := range original.Properties {
+			if prop.GetType() == notionapi.PropertyTypeTitle {
+				request.Properties[name] = propertyValue{typ: notionapi.PropertyTypeTitle, value: plainRichText(*title)}
+			}
+		}
+	} else {
+		request.Properties = notionapi.Properties{"title": notionapi.TitleProperty{Title: plainRichText(*title)}}
+	}
+
+	page, err := client.Page.Create(ctx, request)
+	if err != nil {
+		exitWithNotionError("Error creating page", err)
+	}
+	if err := copyBlocks(ctx, client, tree.Root.Children, notionapi.BlockID(page.ID)); err != nil {
+		exitWithNotionError("Error copying blocks", err)
+	}
+	fmt.Println(page.URL)
+}
+
+// copyBlocks re-creates nodes under the page pageID. Sub-pages are created
+// as new pages after the other blocks. Sub-pages nested inside other blocks
+// (a toggle, for example) are moved to the top level of the copy, because a
+// page can only be created under another page.
+func copyBlocks(ctx context.Context, client *notionapi.Client, nodes []*BlockNode, pageID notionapi.BlockID) error {
+	var subPages []*BlockNode
+	raw := cloneBlocksJSON(nodes, &subPages)
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	var blocks notionapi.Blocks
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return err
+	}
+	if _, err := appendBlockTree(ctx, client, pageID, "", blocks); err != nil {
+		return err
+	}
+
+	for _, node := range subPages {
+		sub := node.Block.(*notionapi.ChildPageBlock)
+		page, err := createChildPage(ctx, client, notionapi.PageID(pageID), sub.ChildPage.Title)
+		if err != nil {
+			return err
+		}
+		if err := copyBlocks(ctx, client, node.Children, notionapi.BlockID(page.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cloneBlocksJSON はブロックを、IDや作成日時などの読み取り専用の項目を除いた作成用のJSONにします。
+// 子ページは subPages に集め、APIで作成できないブロックは警告を出して省く
+func cloneBlocksJSON(nodes []*BlockNode, subPages *[]*BlockNode) []any {
+	list := []any{}
+	for _, node := range nodes {
+		switch b := node.Block.(type) {
+		case *notionapi.ChildPageBlock:
+			*subPages = append(*subPages, node)
+			continue
+		case *notionapi.ChildDatabaseBlock:
+			log.Printf("warning: skipping database %q; databases cannot be copied", b.ChildDatabase.Title)
+			continue
+		case *notionapi.UnsupportedBlock, *notionapi.LinkPreviewBlock, *notionapi.TemplateBlock:
+			log.Printf("warning: skipping %s block %s; it cannot be created through the API", node.Block.GetType(), node.Block.GetID())
+			continue
+		}
+
+		data, err := json.Marshal(node.Block)
+		if err != nil {
+			log.Printf("warning: skipping block %s: %v", node.Block.GetID(), err)
+			continue
+		}
+		var block map[string]any
+		json.Unmarshal(data, &block)
+		typ, _ := block["type"].(string)
+		body, _ := block[typ].(map[string]any)
+		if body == nil {
+			body = map[string]any{}
+		}
+		// Notionにアップロードされたファイルは、APIからは作り直せない（URLも1時間で失効する）
+		if body["type"] == "file" {
+			log.Printf("warning: skipping %s block %s; files uploaded to Notion cannot be copied", typ, node.Block.GetID())
+			continue
+		}
+		if icon, ok := body["icon"].(map[string]any); ok && icon["type"] == "file" {
+			delete(body, "icon")
+		}
+		// 同期ブロックの参照先の中身は、元のブロックにあるので複製しない
+		if synced, ok := node.Block.(*notionapi.SyncedBlock); !ok || synced.SyncedBlock.SyncedFrom == nil {
+			if children := cloneBlocksJSON(node.Children, subPages); len(children) > 0 {
+				body["children"] = children
+			}
+		}
+		list = append(list, map[string]any{"object": "block", "type": typ, typ: body})
+	}
+	return list
+}
+
+// copyableIcon はアイコンのうち、ページの作成時に指定できるもの（絵文字と外部URL）を返します
+func copyableIcon(icon *notionapi.Icon) *notionapi.Icon {
+	if icon == nil || icon.Type == "file" {
+		return nil
+	}
+	return icon
+}
+
+func copyableCover(cover *notionapi.Image) *notionapi.Image {
+	if cover == nil || cover.Type != "external" {
+		return nil
+	}
+	return cover
+}
+
+// copyableProperties は、データベースの行のプロパティのうち書き込めるものを作成用の値にします
+func copyableProperties(page *notionapi.Page) notionapi.Properties {
+	properties := notionapi.Properties{}
+	for name, prop := range page.Properties {
+		var value any
+		switch p := prop.(type) {
+		case *notionapi.TitleProperty:
+			value = p.Title
+		case *notionapi.RichTextProperty:
+			value = p.RichText
+		case *notionapi.NumberProperty:
+			value = p.Number
+		case *notionapi.SelectProperty:
+			if p.Select.Name != "" {
+				value = map[string]string{"name": p.Select.Name}
+			}
+		case *notionapi.StatusProperty:
+			value = map[string]string{"name": p.Status.Name}
+		case *notionapi.MultiSelectProperty:
+			options := []map[string]string{}
+			for _, opt := range p.MultiSelect {
+				options = append(options, map[string]string{"name": opt.Name})
+			}
+			value = options
+		case *notionapi.DateProperty:
+			if p.Date != nil && p.Date.Start != nil {
+				date := map[string]any{"start": propertyDate(*p.Date.Start)}
+				if p.Date.End != nil {
+					date["end"] = propertyDate(*p.Date.End)
+				}
+				value = date
+			}
+		case *notionapi.CheckboxProperty:
+			value = p.Checkbox
+		case *notionapi.URLProperty:
+			value = nilIfEmpty(p.URL)
+		case *notionapi.EmailProperty:
+			value = nilIfEmpty(p.Email)
+		case *notionapi.PhoneNumberProperty:
+			value = nilIfEmpty(p.PhoneNumber)
+		case *notionapi.PeopleProperty:
+			people := []map[string]string{}
+			for _, user := range p.People {
+				people = append(people, map[string]string{"object": "user", "id": string(user.ID)})
+			}
+			value = people
+		case *notionapi.RelationProperty:
+			pages := []map[string]string{}
+			for _, rel := range p.Relation {
+				pages = append(pages, map[string]string{"id": string(rel.ID)})
+			}
+			value = pages
+		case *notionapi.FilesProperty:
+			files := []notionapi.File{}
+			for _, f := range p.Files {
+				if f.Type == "external" {
+					files = append(files, f)
+				}
+			}
+			value = files
+		default:
+			// 数式・ロールアップ・作成日時などは自動で計算される
+			continue
+		}
+		properties[name] = propertyValue{typ: prop.GetType(), value: value}
+	}
+	return properties
+}
+
+// propertyDate は日付を、時刻のない日付なら "2006-01-02" の形式にします。
+// notionapi は日付と日時を区別せずに読み込むため、UTCの0時ちょうどは日付とみなす
+func propertyDate(d notionapi.Date) string {
+	t := time.Time(d)
+	if dateOnly(t) {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(time.RFC3339)
+}
+
+func nilIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
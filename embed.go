@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// defaultEmbeddingModel は --model を指定しない場合の埋め込みのモデル
+const defaultEmbeddingModel = openai.EmbeddingModelTextEmbedding3Small
+
+// embedChunkTokens は1つの埋め込みにするテキストのトークン数の目安の上限。長いセクションは段落の区切りで分ける
+const embedChunkTokens = 800
+
+// embedBatchSize は1回のリクエストで埋め込むテキストの数
+const embedBatchSize = 100
+
+// embeddingStore is the local store of section embeddings written by `embed`
+// and searched by `semsearch`. Chunks keep a hash of their text so that a
+// rebuild only sends the text that changed since the last run.
+type embeddingStore struct {
+	Model  string          `json:"model"`
+	Built  time.Time       `json:"built"`
+	Chunks []embeddedChunk `json:"chunks"`
+}
+
+// embeddedChunk はページのセクション（またはその一部）と、その埋め込み
+type embeddedChunk struct {
+	Path    string    `json:"path"`
+	PageID  string    `json:"page_id,omitempty"`
+	Title   string    `json:"title"`
+	Heading string    `json:"heading,omitempty"`
+	Text    string    `json:"text"`
+	Hash    string    `json:"hash"`
+	Vector  []float32 `json:"vector"`
+}
+
+// defaultEmbeddingStorePath はキャッシュディレクトリの埋め込みのファイル
+func defaultEmbeddingStorePath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "embeddings.json.gz"), nil
+}
+
+// runEmbed computes OpenAI embeddings for the sections of the same local
+// pages that `index` reads, exported Markdown files and the latest
+// snapshots, and stores them for `semsearch`. Unchanged sections keep their
+// stored embedding, so re-running after a backup only pays for the changes.
+func runEmbed(args []string) {
+	fs := flag.NewFlagSet("embed", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	addLLMFlags(fs)
+	storePath := fs.String("store", "", "embeddings file to write (default: embeddings.json.gz in the cache directory)")
+	model := fs.String("model", string(defaultEmbeddingModel), "OpenAI embedding model")
+	noSnapshots := fs.Bool("no-snapshots", false, "do not embed the latest snapshot of each page")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs embed [--store file] [--model name] [--no-snapshots] [<dir-or-file>...]")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	if fs.NArg() == 0 && *noSnapshots {
+		fs.Usage()
+		exit(1)
+	}
+	if *storePath == "" {
+		path, err := defaultEmbeddingStorePath()
+		if err != nil {
+			fatal(err)
+		}
+		*storePath = path
+	}
+
+	pages, err := loadLocalPages(fs.Args(), !*noSnapshots)
+	if err != nil {
+		fatalf("Error reading pages: %v", err)
+	}
+	previous, err := readEmbeddingStore(*storePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("warning: ignoring the existing embeddings: %v", err)
+	}
+
+	store, embedded, err := buildEmbeddingStore(context.Background(), pages, *model, previous)
+	if err != nil {
+		fatalf("Error computing embeddings: %v", err)
+	}
+	if err := writeEmbeddingStore(*storePath, store); err != nil {
+		fatalf("Error writing embeddings: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "%d chunks from %d pages (%d embedded, %d unchanged) in %s\n", len(store.Chunks), len(pages), embedded, len(store.Chunks)-embedded, *storePath)
+}
+
+// buildEmbeddingStore はセクションを分けて埋め込みます。previous に同じモデル・同じテキストの埋め込みがあれば再利用し、新しく埋め込んだ数を返す
+func buildEmbeddingStore(ctx context.Context, pages []localPage, model string, previous *embeddingStore) (*embeddingStore, int, error) {
+	reuse := make(map[string][]float32)
+	if previous != nil && previous.Model == model {
+		for _, c := range previous.Chunks {
+			reuse[c.Hash] = c.Vector
+		}
+	}
+
+	store := &embeddingStore{Model: model, Built: time.Now().UTC(), Chunks: []embeddedChunk{}}
+	var pending []int
+	for _, page := range pages {
+		for _, section := range page.Sections {
+			for _, text := range chunkSectionText(section.Text) {
+				chunk := embeddedChunk{Path: page.Path, PageID: page.PageID, Title: page.Title, Heading: section.Heading, Text: text}
+				sum := sha256.Sum256([]byte(chunk.input()))
+				chunk.Hash = hex.EncodeToString(sum[:])
+				if v, ok := reuse[chunk.Hash]; ok {
+					chunk.Vector = v
+				} else {
+					pending = append(pending, len(store.Chunks))
+				}
+				store.Chunks = append(store.Chunks, chunk)
+			}
+		}
+	}
+	if len(pending) == 0 {
+		return store, 0, nil
+	}
+
+	client, err := newEmbeddingClient()
+	if err != nil {
+		return nil, 0, err
+	}
+	for start := 0; start < len(pending); start += embedBatchSize {
+		batch := pending[start:min(start+embedBatchSize, len(pending))]
+		inputs := make([]string, len(batch))
+		for i, idx := range batch {
+			inputs[i] = store.Chunks[idx].input()
+		}
+		vectors, err := embedTexts(ctx, client, model, inputs)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i, idx := range batch {
+			store.Chunks[idx].Vector = vectors[i]
+		}
+	}
+	return store, len(pending), nil
+}
+
+// input は埋め込むテキストです。タイトルと見出しも含め、本文だけでは分からない文脈を持たせる
+func (c embeddedChunk) input() string {
+	return strings.TrimSpace(c.Title + "\n" + c.Heading + "\n" + c.Text)
+}
+
+// chunkSectionText はセクションの本文を、embedChunkTokens を超えないよう段落（行）の区切りで分けます
+func chunkSectionText(text string) []string {
+	var chunks []string
+	var current []string
+	var stats textStats
+	for _, line := range strings.Split(text, "\n") {
+		var s textStats
+		s.add(line)
+		if len(current) > 0 && stats.estimatedTokens()+s.estimatedTokens() > embedChunkTokens {
+			chunks = append(chunks, strings.Join(current, "\n"))
+			current, stats = nil, textStats{}
+		}
+		current = append(current, line)
+		stats.merge(s)
+	}
+	if joined := strings.TrimSpace(strings.Join(current, "\n")); joined != "" || len(chunks) == 0 {
+		chunks = append(chunks, joined)
+	}
+	return chunks
+}
+
+func newEmbeddingClient() (*openai.Client, error) {
+	apiKey, _ := openAIKeyCredential.get()
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is not set")
+	}
+	client := newOpenAIClient(apiKey)
+	return &client, nil
+}
+
+// embedTexts はテキストを埋め込み、入力と同じ順にベクトルを返します
+func embedTexts(ctx context.Context, client *openai.Client, model string, texts []string) ([][]float32, error) {
+	reserved, err := llmUsage.reserve(model, strings.Join(texts, "\n"), 0)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+		Model: openai.EmbeddingModel(model),
+	})
+	if err != nil {
+		llmUsage.release(reserved)
+		return nil, fmt.Errorf("embedding failed: %v", err)
+	}
+	llmUsage.record(model, resp.Usage.PromptTokens, 0, reserved)
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding failed: got %d embeddings for %d texts", len(resp.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, e := range resp.Data {
+		if e.Index < 0 || int(e.Index) >= len(texts) {
+			return nil, fmt.Errorf("embedding failed: unexpected index %d", e.Index)
+		}
+		v := make([]float32, len(e.Embedding))
+		for i, x := range e.Embedding {
+			v[i] = float32(x)
+		}
+		vectors[e.Index] = v
+	}
+	return vectors, nil
+}
+
+func writeEmbeddingStore(path string, store *embeddingStore) error {
+	return writeGzipJSON(path, store)
+}
+
+func readEmbeddingStore(path string) (*embeddingStore, error) {
+	var store embeddingStore
+	if err := readGzipJSON(path, &store); err != nil {
+		return nil, err
+	}
+	return &store, nil
+}
+
+// semanticHit は semsearch の結果の1件
+type semanticHit struct {
+	Path    string  `json:"path"`
+	PageID  string  `json:"page_id,omitempty"`
+	URL     string  `json:"url,omitempty"`
+	Title   string  `json:"title"`
+	Heading string  `json:"heading,omitempty"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+// rank はベクトルとの cosine 類似度の高い順に、limit 件のチャンクを返します。
+// perPage なら同じページのチャンクは最もスコアの高い1件だけにする
+func (s *embeddingStore) rank(query []float32, limit int, perPage bool) []semanticHit {
+	var hits []semanticHit
+	for _, c := range s.Chunks {
+		hit := semanticHit{Path: c.Path, PageID: c.PageID, Title: c.Title, Heading: c.Heading, Score: cosineSimilarity(query, c.Vector), Snippet: searchSnippet(c.Text, 0)}
+		if c.PageID != "" {
+			hit.URL = "https://www.notion.so/" + compactPageID(c.PageID)
+		}
+		hits = append(hits, hit)
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if perPage {
+		seen := make(map[string]bool)
+		unique := hits[:0]
+		for _, hit := range hits {
+			if !seen[hit.Path] {
+				seen[hit.Path] = true
+				unique = append(unique, hit)
+			}
+		}
+		hits = unique
+	}
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		hits[i].Score = math.Round(hits[i].Score*1000) / 1000
+	}
+	return hits
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// runSemsearch embeds the query with the model of the store written by
+// `embed` and prints the most similar sections, to find the page that talked
+// about something without knowing the words it used.
+func runSemsearch(args []string) {
+	fs := flag.NewFlagSet("semsearch", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	storePath := fs.String("store", "", "embeddings file to search (default: embeddings.json.gz in the cache directory)")
+	limit := fs.Int("limit", 5, "maximum number of results (0 = all)")
+	sections := fs.Bool("sections", false, "list every matching section instead of the best section of each page")
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs semsearch [--store file] [--limit 5] [--sections] [--json] \"<query>\"")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	if fs.NArg() == 0 {
+		fs.Usage()
+		exit(1)
+	}
+	if *storePath == "" {
+		path, err := defaultEmbeddingStorePath()
+		if err != nil {
+			fatal(err)
+		}
+		*storePath = path
+	}
+
+	store, err := readEmbeddingStore(*storePath)
+	if errors.Is(err, os.ErrNotExist) {
+		fatalf("no embeddings at %s (run `notion-dfs embed` first)", *storePath)
+	}
+	if err != nil {
+		fatalf("Error reading embeddings: %v", err)
+	}
+	client, err := newEmbeddingClient()
+	if err != nil {
+		fatal(err)
+	}
+	vectors, err := embedTexts(context.Background(), client, store.Model, []string{strings.Join(fs.Args(), " ")})
+	if err != nil {
+		fatal(err)
+	}
+	hits := store.rank(vectors[0], *limit, !*sections)
+
+	if *asJSON {
+		if hits == nil {
+			hits = []semanticHit{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(hits); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	for _, hit := range hits {
+		title := hit.Title
+		if hit.Heading != "" && hit.Heading != hit.Title {
+			title += " › " + hit.Heading
+		}
+		fmt.Printf("%5.3f  %s\n", hit.Score, title)
+		fmt.Printf("       %s\n", hit.Path)
+		if hit.URL != "" {
+			fmt.Printf("       %s\n", hit.URL)
+		}
+		if hit.Snippet != "" {
+			fmt.Printf("       %s\n", hit.Snippet)
+		}
+	}
+}
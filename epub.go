@@ -0,0 +1,256 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// epubChapter is one page in an EPUB. With --recursive, sub-pages become
+// nested chapters.
+type epubChapter struct {
+	ID       notionapi.BlockID
+	Title    string
+	Children []*epubChapter
+
+	tree *PageTree
+	// file は EPUB 内の XHTML ファイル名
+	file string
+	// body は要約の章のように、ブロックツリーではなく本文を直接持つ場合に使う
+	body string
+}
+
+// fetchEPUBChapters はページを取得し、recursive なら子ページも章として取得します
+func fetchEPUBChapters(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, title string, limits fetchLimits, recursive bool) (*epubChapter, error) {
+	if title == "" {
+		t, err := fetchPageTitle(ctx, client, pageID)
+		if err != nil {
+			return nil, err
+		}
+		title = t
+	}
+	limits.SkipChildPages = recursive
+	tree, err := fetchPageTree(ctx, client, pageID, limits)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := &epubChapter{ID: pageID, Title: title, tree: tree}
+	if recursive {
+		for _, child := range tree.ChildPages() {
+			sub, err := fetchEPUBChapters(ctx, client, child.ID, child.ChildPage.Title, limits, recursive)
+			if err != nil {
+				return nil, err
+			}
+			ch.Children = append(ch.Children, sub)
+		}
+	}
+	return ch, nil
+}
+
+// flatten は章を読む順（親の後に子）に並べます
+func (ch *epubChapter) flatten() []*epubChapter {
+	chapters := []*epubChapter{ch}
+	for _, child := range ch.Children {
+		chapters = append(chapters, child.flatten()...)
+	}
+	return chapters
+}
+
+// writeEPUB writes an EPUB 3 book with one XHTML file per chapter, the
+// images it references, and both a navigation document and an NCX table of
+// contents for older readers. Toggles become collapsible <details> elements
+// unless flattenToggles is set.
+func writeEPUB(ctx context.Context, w io.Writer, root *epubChapter, summary string, flattenToggles bool, columns string) error {
+	chapters := root.flatten()
+	if summary != "" {
+		var body strings.Builder
+		for _, para := range strings.Split(strings.TrimSpace(summary), "\n\n") {
+			fmt.Fprintf(&body, "<p>%s</p>\n", strings.ReplaceAll(renderer.EscapeHTML(para), "\n", "<br/>"))
+		}
+		chapters = append(chapters, &epubChapter{Title: "AI による要約", body: body.String()})
+	}
+
+	var text strings.Builder
+	for i, ch := range chapters {
+		ch.file = fmt.Sprintf("chapter%03d.xhtml", i+1)
+		if ch.tree != nil {
+			text.WriteString(ch.Title)
+			collectContent(ch.tree.Root.Children, &text)
+		}
+	}
+	lang := "en"
+	if hasCJK(text.String()) {
+		lang = "ja"
+	}
+
+	images := newEmbeddedImages(ctx, "images/")
+	r := &htmlRenderer{headingShift: 1, image: images.add, flattenToggles: flattenToggles, columns: columns}
+	zw := zip.NewWriter(w)
+
+	// mimetype は先頭に無圧縮で置く必要がある
+	mt, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	io.WriteString(mt, "application/epub+zip")
+
+	files := []struct{ name, content string }{
+		{"META-INF/container.xml", epubContainer},
+		{"OEBPS/style.css", epubStyle},
+	}
+	for _, ch := range chapters {
+		body := ch.body
+		if ch.tree != nil {
+			var sb strings.Builder
+			r.renderBlocks(&sb, ch.tree.Root.Children)
+			body = sb.String()
+		}
+		files = append(files, struct{ name, content string }{"OEBPS/" + ch.file, epubXHTML(lang, ch.Title, "<h1>"+renderer.EscapeHTML(ch.Title)+"</h1>\n"+body)})
+	}
+
+	tocTitle := "Contents"
+	if lang == "ja" {
+		tocTitle = "目次"
+	}
+	// ナビゲーションは章の階層（要約の章は最上位）に従う
+	tocRoots := []*epubChapter{root}
+	if summary != "" {
+		tocRoots = append(tocRoots, chapters[len(chapters)-1])
+	}
+	files = append(files,
+		struct{ name, content string }{"OEBPS/nav.xhtml", epubXHTML(lang, root.Title, "<nav epub:type=\"toc\" id=\"toc\">\n<h1>"+tocTitle+"</h1>\n"+epubNavList(tocRoots)+"</nav>\n")},
+		struct{ name, content string }{"OEBPS/toc.ncx", epubNCX(root, tocRoots)},
+		struct{ name, content string }{"OEBPS/content.opf", epubPackage(root, lang, chapters, images.items)},
+	)
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	for _, item := range images.items {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: "OEBPS/" + item.href, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(item.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+const epubContainer = `<?xml version="1.0" encoding="utf-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const epubStyle = `body { line-height: 1.6; }
+pre { white-space: pre-wrap; background: #f5f5f5; padding: 0.5em; font-size: 0.9em; }
+blockquote { border-left: 3px solid #ccc; margin-left: 0; padding-left: 1em; color: #555; }
+.callout { background: #f1f1ef; padding: 0.5em 1em; }
+.children, details > :not(summary) { margin-left: 1.5em; }
+summary > h1, summary > h2, summary > h3, summary > h4, summary > h5, summary > h6 { display: inline; }
+ul.todo { list-style: none; padding-left: 0.5em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #999; padding: 0.2em 0.5em; }
+th { background: #f0f0f0; }
+img { max-width: 100%; }
+`
+
+func epubXHTML(lang, title, body string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="%[1]s" lang="%[1]s">
+<head>
+<meta charset="utf-8"/>
+<title>%[2]s</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+%[3]s</body>
+</html>
+`, lang, renderer.EscapeHTML(title), body)
+}
+
+func epubNavList(chapters []*epubChapter) string {
+	var sb strings.Builder
+	sb.WriteString("<ol>\n")
+	for _, ch := range chapters {
+		fmt.Fprintf(&sb, "<li><a href=\"%s\">%s</a>", ch.file, renderer.EscapeHTML(ch.Title))
+		if len(ch.Children) > 0 {
+			sb.WriteString("\n" + epubNavList(ch.Children))
+		}
+		sb.WriteString("</li>\n")
+	}
+	sb.WriteString("</ol>\n")
+	return sb.String()
+}
+
+func epubNCX(root *epubChapter, chapters []*epubChapter) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<?xml version="1.0" encoding="utf-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+<head><meta name="dtb:uid" content="urn:uuid:%s"/></head>
+<docTitle><text>%s</text></docTitle>
+<navMap>
+`, formatPageID(compactPageID(string(root.ID))), renderer.EscapeHTML(root.Title))
+	order := 0
+	var points func(chapters []*epubChapter)
+	points = func(chapters []*epubChapter) {
+		for _, ch := range chapters {
+			order++
+			fmt.Fprintf(&sb, "<navPoint id=\"nav%d\" playOrder=\"%d\"><navLabel><text>%s</text></navLabel><content src=\"%s\"/>\n", order, order, renderer.EscapeHTML(ch.Title), ch.file)
+			points(ch.Children)
+			sb.WriteString("</navPoint>\n")
+		}
+	}
+	points(chapters)
+	sb.WriteString("</navMap>\n</ncx>\n")
+	return sb.String()
+}
+
+func epubPackage(root *epubChapter, lang string, chapters []*epubChapter, images []embeddedImage) string {
+	var manifest, spine strings.Builder
+	for _, ch := range chapters {
+		id := strings.TrimSuffix(ch.file, ".xhtml")
+		fmt.Fprintf(&manifest, "    <item id=\"%s\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", id, ch.file)
+		fmt.Fprintf(&spine, "    <itemref idref=\"%s\"/>\n", id)
+	}
+	for _, item := range images {
+		fmt.Fprintf(&manifest, "    <item id=\"%s\" href=\"%s\" media-type=\"%s\"/>\n", item.id, item.href, renderer.EscapeHTML(item.mediaType))
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="%[1]s">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">urn:uuid:%[2]s</dc:identifier>
+    <dc:title>%[3]s</dc:title>
+    <dc:language>%[1]s</dc:language>
+    <meta property="dcterms:modified">%[4]s</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+%[5]s  </manifest>
+  <spine toc="ncx">
+%[6]s  </spine>
+</package>
+`, lang, formatPageID(compactPageID(string(root.ID))), renderer.EscapeHTML(root.Title), time.Now().UTC().Format("2006-01-02T15:04:05Z"), manifest.String(), spine.String())
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jomei/notionapi"
+)
+
+// Notion API が返すエラーコードのうち、利用者の操作で解決できるもの
+// https://developers.notion.com/reference/status-codes
+const (
+	errCodeObjectNotFound     notionapi.ErrorCode = "object_not_found"
+	errCodeRestrictedResource notionapi.ErrorCode = "restricted_resource"
+	errCodeUnauthorized       notionapi.ErrorCode = "unauthorized"
+	errCodeValidation         notionapi.ErrorCode = "validation_error"
+)
+
+// notionErrorHint returns actionable guidance for well-known Notion API errors.
+// It returns an empty string when there is nothing useful to add.
+func notionErrorHint(err error) string {
+	var rateLimited *notionapi.RateLimitedError
+	if errors.As(err, &rateLimited) {
+		return "Notion API のレート制限に達しました。しばらく待ってから再実行してください。"
+	}
+
+	var apiErr *notionapi.Error
+	if !errors.As(err, &apiErr) {
+		return ""
+	}
+
+	switch apiErr.Code {
+	case errCodeObjectNotFound:
+		return "ページが見つからないか、インテグレーションと共有されていません。\n" +
+			"  - Notionでページを開き、右上の「•••」→「コネクト」からインテグレーションを追加してください\n" +
+			"  - ページIDがURLの末尾32文字と一致しているか確認してください"
+	case errCodeRestrictedResource:
+		return "インテグレーションにこの操作の権限がありません。\n" +
+			"  - https://www.notion.so/my-integrations で「コンテンツを読み取る」機能が有効か確認してください\n" +
+			"  - --include-comments や comment を使う場合は「コメントを読み取る」「コメントを挿入する」機能も必要です\n" +
+			"  - 親ページではなく対象ページ自体がインテグレーションと共有されているか確認してください"
+	case errCodeUnauthorized:
+		return "NOTION_API_TOKEN が無効です。\n" +
+			"  - https://www.notion.so/my-integrations からシークレットを再取得して設定してください"
+	case errCodeValidation:
+		return "リクエストが不正です。ページIDの形式（32文字の16進数、またはUUID）を確認してください。"
+	}
+	return ""
+}
+
+// exitWithNotionError prints the error with guidance to stderr and exits.
+func exitWithNotionError(msg string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", msg, err)
+	if hint := notionErrorHint(err); hint != "" {
+		fmt.Fprintf(os.Stderr, "\n%s\n", hint)
+		fmt.Fprintln(os.Stderr, "\n`notion-dfs doctor <page-id>` でトークンとページへのアクセスを確認できます。")
+	}
+	exit(1)
+}
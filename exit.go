@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// exitHooks are run before the process ends, both when main returns and when
+// a command gives up with fatal or exit, so that the OpenAI usage report,
+// the profiles and the spans of a failed run are not lost. log.Fatal and
+// os.Exit skip deferred calls, so the commands use fatal, fatalf and exit
+// instead.
+var (
+	exitMu    sync.Mutex
+	exitHooks []func()
+)
+
+// atExit は終了前に実行する処理を登録します。登録と逆の順に実行する
+func atExit(f func()) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitHooks = append(exitHooks, f)
+}
+
+// runExitHooks は登録された処理を一度だけ実行します。処理の中から exit が呼ばれても、残りは実行しない
+func runExitHooks() {
+	exitMu.Lock()
+	hooks := exitHooks
+	exitHooks = nil
+	exitMu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
+	}
+}
+
+// exit は終了前の処理を実行してから、ステータス code で終了します
+func exit(code int) {
+	runExitHooks()
+	os.Exit(code)
+}
+
+// fatal は log.Fatal と同じくメッセージを記録して終了しますが、その前に終了前の処理を実行します
+func fatal(v ...any) {
+	log.Output(2, fmt.Sprint(v...))
+	exit(1)
+}
+
+// fatalf は log.Fatalf の代わりに使う fatal です
+func fatalf(format string, v ...any) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	exit(1)
+}
+
+// parseFlags は fs.Parse と同じですが、フラグが間違っている場合も終了前の処理を実行してから終了します。
+// flag.ExitOnError は os.Exit を呼ぶため、フラグセットは flag.ContinueOnError で作る
+func parseFlags(fs *flag.FlagSet, args []string) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			exit(0)
+		}
+		exit(2)
+	}
+}
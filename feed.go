@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// feedItem is one database row in a feed.
+type feedItem struct {
+	ID        string
+	Title     string
+	Link      string
+	Published time.Time
+	Updated   time.Time
+	Tags      []string
+	// HTML は本文をレンダリングしたHTML（フィードの description / content）
+	HTML string
+}
+
+// runFeed generates an RSS or Atom feed from the rows of a database of posts.
+func runFeed(args []string) {
+	fs := flag.NewFlagSet("feed", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	format := fs.String("format", "rss", "feed format: rss or atom")
+	output := fs.String("o", "", "write the feed to this file instead of stdout")
+	siteURL := fs.String("site-url", "", "link items to <site-url>/<slug>/ (as exported by --preset hugo) instead of their Notion URLs")
+	title := fs.String("title", "", "feed title (default: the database title)")
+	limit := fs.Int("limit", 20, "maximum number of items, newest first (0 = all)")
+	var filters stringList
+	fs.Var(&filters, "filter", "include only the rows matching this condition, e.g. 'Status=Published' or 'Date>=2024-01-01' (repeatable; rows must match all)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs feed [flags] <database-id>")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(1)
+	}
+	if *format != "rss" && *format != "atom" {
+		fatalf("unknown feed format: %s", *format)
+	}
+	conds, err := parsePropertyConditions(filters)
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	databaseID := notionapi.DatabaseID(formatPageID(fs.Arg(0)))
+	db, err := client.Database.Get(ctx, databaseID)
+	if err != nil {
+		exitWithNotionError("Error fetching database", err)
+	}
+	if *title == "" {
+		*title = renderer.PlainText(db.Title)
+	}
+	link := db.PublicURL
+	if link == "" {
+		link = db.URL
+	}
+	if *siteURL != "" {
+		link = strings.TrimSuffix(*siteURL, "/") + "/"
+	}
+
+	items, err := fetchFeedItems(ctx, client, notionapi.BlockID(databaseID), conds, *siteURL, *limit)
+	if err != nil {
+		exitWithNotionError("Error fetching posts", err)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatalf("Error creating output file: %v", err)
+		}
+		out = f
+	}
+	feed := feedInfo{ID: compactPageID(string(databaseID)), Title: *title, Link: link, Description: renderer.PlainText(db.Description)}
+	if *format == "atom" {
+		err = writeAtom(out, feed, items)
+	} else {
+		err = writeRSS(out, feed, items)
+	}
+	if err != nil {
+		fatalf("Error writing feed: %v", err)
+	}
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			fatalf("Error writing output file: %v", err)
+		}
+	}
+}
+
+// fetchFeedItems は下書きを除いた（conds があれば一致する）行を新しい順に limit 件取得し、本文をHTMLにします
+func fetchFeedItems(ctx context.Context, client *notionapi.Client, databaseID notionapi.BlockID, conds []propertyCondition, siteURL string, limit int) ([]feedItem, error) {
+	pages, err := collectSitePages(ctx, client, databaseID, conds)
+	if err != nil {
+		return nil, err
+	}
+	var posts []*sitePage
+	for _, p := range pages {
+		if !pageDraft(p.Page) {
+			posts = append(posts, p)
+		}
+	}
+	sort.SliceStable(posts, func(i, j int) bool { return pageDate(posts[i].Page).After(pageDate(posts[j].Page)) })
+	if limit > 0 && len(posts) > limit {
+		posts = posts[:limit]
+	}
+
+	// スラッグは --preset hugo と同じ規則で、すべての行から決める（件数を絞っても変わらないように）
+	hugo := &hugoPreset{}
+	hugo.prepare(pages)
+
+	r := &htmlRenderer{headingShift: 1}
+	items := make([]feedItem, 0, len(posts))
+	for _, p := range posts {
+		tree, err := fetchPageTree(ctx, client, p.ID, fetchLimits{})
+		if err != nil {
+			return nil, err
+		}
+		var html strings.Builder
+		r.renderBlocks(&html, tree.Root.Children)
+
+		link := p.Page.PublicURL
+		if link == "" {
+			link = p.Page.URL
+		}
+		if siteURL != "" {
+			link = strings.TrimSuffix(siteURL, "/") + "/" + url.PathEscape(hugo.slugs[p]) + "/"
+		}
+		items = append(items, feedItem{
+			ID:        compactPageID(string(p.ID)),
+			Title:     p.Title,
+			Link:      link,
+			Published: pageDate(p.Page),
+			Updated:   p.Page.LastEditedTime,
+			Tags:      pageTags(p.Page),
+			HTML:      html.String(),
+		})
+	}
+	return items, nil
+}
+
+// feedInfo はフィード全体の情報
+type feedInfo struct {
+	ID, Title, Link, Description string
+}
+
+// RSS 2.0 https://www.rssboard.org/rss-specification
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	GUID        rssGUID   `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	Categories  []string  `xml:"category"`
+	Description feedCDATA `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func writeRSS(w io.Writer, feed feedInfo, items []feedItem) error {
+	channel := rssChannel{
+		Title:         feed.Title,
+		Link:          feed.Link,
+		Description:   firstNonEmpty(feed.Description, feed.Title),
+		LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+		Generator:     "notion-dfs",
+	}
+	for _, item := range items {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{Value: "urn:uuid:" + formatPageID(item.ID)},
+			PubDate:     item.Published.Format(time.RFC1123Z),
+			Categories:  item.Tags,
+			Description: feedCDATA{item.HTML},
+		})
+	}
+	return writeFeedXML(w, rssFeed{Version: "2.0", Channel: channel})
+}
+
+// Atom https://www.rfc-editor.org/rfc/rfc4287
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",cdata"`
+}
+
+func writeAtom(w io.Writer, feed feedInfo, items []feedItem) error {
+	atom := atomFeed{
+		Title: feed.Title,
+		ID:    "urn:uuid:" + formatPageID(feed.ID),
+		Link:  atomLink{Href: feed.Link},
+	}
+	// フィードの更新日時は最も新しく編集された記事の日時
+	var updated time.Time
+	for _, item := range items {
+		if item.Updated.After(updated) {
+			updated = item.Updated
+		}
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        "urn:uuid:" + formatPageID(item.ID),
+			Link:      atomLink{Href: item.Link},
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Updated:   item.Updated.UTC().Format(time.RFC3339),
+			Content:   atomContent{Type: "html", Value: item.HTML},
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		atom.Entries = append(atom.Entries, entry)
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	atom.Updated = updated.UTC().Format(time.RFC3339)
+	return writeFeedXML(w, atom)
+}
+
+// feedCDATA は本文のHTMLを、エスケープするより読みやすい CDATA セクションとして出力します
+type feedCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+func writeFeedXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
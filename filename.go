@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"notion-dfs/renderer"
+)
+
+// filenameFuncs は --filename-template で使える関数（--template の関数に slug を加えたもの）
+var filenameFuncs = template.FuncMap{
+	// slug はタイトルなどをファイル名・URLに使える形にする
+	"slug": renderer.Slugify,
+}
+
+func init() {
+	for name, fn := range templateFuncs {
+		filenameFuncs[name] = fn
+	}
+}
+
+// filenamePage is the data passed to a --filename-template.
+type filenamePage struct {
+	ID    string
+	Title string
+	// Slug はプリセットが付けるはずだった名前（Hugo ならプロパティ Slug、なければタイトルから作ったもの）
+	Slug string
+	// Date は公開日（Date・Published などの日付プロパティ、なければ作成日時）。そのまま書くと 2006-01-02 の形になる
+	Date           fileDate
+	CreatedTime    fileDate
+	LastEditedTime fileDate
+	// Properties はプロパティの値をプレーンテキストにしたもの（名前がキー）
+	Properties map[string]string
+	// Parent は親ページのタイトル（--preset obsidian などで子ページを書き出すとき）。なければ空
+	Parent string
+}
+
+// fileDate は {{.Date}} と書けば日付だけを、{{.Date.Format "2006/01"}} と書けば任意の形を出力する時刻
+type fileDate struct{ time.Time }
+
+func (d fileDate) String() string {
+	return d.Format("2006-01-02")
+}
+
+// Prop は名前が（大文字小文字を区別せずに）一致するプロパティの値をプレーンテキストで返します。なければ空
+func (p *filenamePage) Prop(name string) string {
+	for key, value := range p.Properties {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseFilenameTemplate は --filename-template を解析し、フィールド名の誤りなどを見つけるためにサンプルのページで一度実行します
+func parseFilenameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("filename").Funcs(filenameFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --filename-template: %w", err)
+	}
+	sample := &filenamePage{Title: "Title", Slug: "title", Properties: map[string]string{}}
+	if err := tmpl.Execute(new(bytes.Buffer), sample); err != nil {
+		return nil, fmt.Errorf("invalid --filename-template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// pageNames assigns the name each page is written under: the base of its
+// file or folder, before the preset adds its extension or index.md. Without
+// a --filename-template the preset's own slug is used. The names are made
+// unique, ignoring case for case-insensitive file systems, by numbering the
+// later pages.
+type pageNames struct {
+	tmpl *template.Template
+}
+
+// setNameTemplate は --filename-template を設定します
+func (n *pageNames) setNameTemplate(tmpl *template.Template) {
+	n.tmpl = tmpl
+}
+
+// siteNameTemplater はファイル名のテンプレートを使えるプリセット
+type siteNameTemplater interface {
+	setNameTemplate(tmpl *template.Template)
+}
+
+// assign はページごとの名前を返します。slugOf はプリセットの既定の名前、clean はファイル名に使えない文字を除く関数
+func (n *pageNames) assign(pages []*sitePage, slugOf func(p *sitePage) string, clean func(string) string) map[*sitePage]string {
+	if n.tmpl == nil {
+		return uniqueSlugs(pages, slugOf)
+	}
+	return uniqueSlugs(pages, func(p *sitePage) string {
+		slug := slugOf(p)
+		var buf bytes.Buffer
+		if err := n.tmpl.Execute(&buf, newFilenamePage(p, slug)); err != nil {
+			log.Printf("warning: --filename-template failed for %q (%v); using %q", p.Title, err, slug)
+			return slug
+		}
+		if name := cleanTemplateName(buf.String(), clean); name != "" {
+			return name
+		}
+		return slug
+	})
+}
+
+func newFilenamePage(p *sitePage, slug string) *filenamePage {
+	data := &filenamePage{ID: compactPageID(string(p.ID)), Title: p.Title, Slug: slug, Properties: map[string]string{}}
+	if p.Parent != nil {
+		data.Parent = p.Parent.Title
+	}
+	if p.Page != nil {
+		data.Date = fileDate{dateDisplay.in(pageDate(p.Page))}
+		data.CreatedTime = fileDate{dateDisplay.in(p.Page.CreatedTime)}
+		data.LastEditedTime = fileDate{dateDisplay.in(p.Page.LastEditedTime)}
+		for name, prop := range p.Page.Properties {
+			data.Properties[name] = propertyText(prop)
+		}
+	}
+	return data
+}
+
+// cleanTemplateName はテンプレートの出力を / で区切った各部分に clean をかけ、.md の拡張子と空の部分・".."などを除きます
+func cleanTemplateName(name string, clean func(string) string) string {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".md")
+	var parts []string
+	for _, part := range strings.Split(strings.ReplaceAll(name, `\`, "/"), "/") {
+		part = strings.Trim(clean(part), " .")
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return path.Join(parts...)
+}
+
+// fileNameText はファイル名に使えない文字（Windows を含む）と制御文字を除きます
+func fileNameText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"|?*`, r) {
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
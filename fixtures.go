@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jomei/notionapi"
+)
+
+// notionAPIHost は記録・再生の対象にするホスト。Slack の Webhook URL のように
+// URL自体が秘密情報のリクエストは記録しない
+const notionAPIHost = "api.notion.com"
+
+// replaying は --replay が有効なことを表します（トークンがなくてもクライアントを作れるようにする）
+var replaying bool
+
+// fixtureTransport records Notion API responses into dir, or with replay
+// answers requests from the recorded files without touching the network, so
+// that renderer changes can be tested deterministically. Only the responses
+// and the request method, URL and body are saved; request headers, and so
+// the token, are not. Requests to other hosts (OpenAI, Slack, asset
+// downloads) always go to next.
+type fixtureTransport struct {
+	dir    string
+	replay bool
+	next   http.RoundTripper
+	// cache は --offline のためのキャッシュへの保存で、保存に失敗しても応答を返す（警告は1回だけ）
+	cache     bool
+	cacheWarn sync.Once
+	// perToken は応答をトークン（Authorization ヘッダー）のハッシュのディレクトリに分ける（キャッシュと --offline）。
+	// ほかのトークンで取得した、そのトークンでは読めないかもしれないページの応答を返さないため
+	perToken bool
+}
+
+// recordedResponse は記録した1つの応答。本文がJSONならそのまま、それ以外はBase64で保存する
+type recordedResponse struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	RequestBody json.RawMessage `json:"request_body,omitempty"`
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	BodyBase64  string          `json:"body_base64,omitempty"`
+}
+
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != notionAPIHost {
+		return t.next.RoundTrip(req)
+	}
+	var reqBody []byte
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		reqBody = data
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	dir := t.dir
+	if t.perToken {
+		dir = filepath.Join(dir, tokenKey(req.Header.Get("Authorization")))
+	}
+	file := filepath.Join(dir, fixtureName(req, reqBody))
+
+	if t.replay {
+		resp, err := readRecordedResponse(file, req)
+		if err != nil {
+			return nil, fmt.Errorf("replay: %w", err)
+		}
+		return resp, nil
+	}
+	if t.cache && req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/children") && useCachedSubtree(req.Context()) {
+		// 前回から更新されていないページのブロックは、キャッシュした応答があればそれを返す
+		if resp, err := readRecordedResponse(file, req); err == nil && resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	// レート制限の応答は再試行の後の応答で上書きされるので記録しない
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return resp, nil
+	}
+
+	f := recordedResponse{Method: req.Method, URL: req.URL.String(), Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type")}
+	if json.Valid(reqBody) {
+		f.RequestBody = reqBody
+	}
+	if json.Valid(body) {
+		f.Body = body
+	} else {
+		f.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// 応答には非公開のページの内容が含まれるため、ほかのユーザーが読めないようにする
+	if err := os.MkdirAll(dir, 0o700); err == nil {
+		err = os.WriteFile(file, append(data, '\n'), 0o600)
+	}
+	if err != nil {
+		if !t.cache {
+			return nil, fmt.Errorf("record: %w", err)
+		}
+		t.cacheWarn.Do(func() { log.Printf("warning: failed to cache responses for --offline: %v", err) })
+	}
+	return resp, nil
+}
+
+// readRecordedResponse は記録した応答を読み込み、HTTPの応答に戻します
+func readRecordedResponse(file string, req *http.Request) (*http.Response, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("no recorded response for %s %s (%s)", req.Method, req.URL, file)
+	}
+	var f recordedResponse
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", file, err)
+	}
+	body := []byte(f.Body)
+	if f.BodyBase64 != "" {
+		if body, err = base64.StdEncoding.DecodeString(f.BodyBase64); err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %w", file, err)
+		}
+	}
+	header := http.Header{}
+	if f.ContentType != "" {
+		header.Set("Content-Type", f.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+var fixtureNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// fixtureName はリクエストのメソッド・URL・本文から記録のファイル名を決めます。
+// 読みやすいようにパスの一部を含め、同じパスでもクエリや本文が違えば別のファイルにする
+func fixtureName(req *http.Request, body []byte) string {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s %s\n", req.Method, req.URL.String())
+	sum.Write(body)
+	path := strings.Trim(fixtureNameUnsafe.ReplaceAllString(strings.TrimPrefix(req.URL.Path, "/v1/"), "_"), "_")
+	if len(path) > 80 {
+		path = path[:80]
+	}
+	return fmt.Sprintf("%s_%s_%s.json", strings.ToLower(req.Method), path, hex.EncodeToString(sum.Sum(nil))[:12])
+}
+
+// offlineTransport は --offline のときに Notion 以外へのリクエスト（OpenAI・画像のダウンロードなど）を拒否します
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("offline: not sending %s %s", req.Method, req.URL.Redacted())
+}
+
+// tokenKey は Authorization ヘッダーの値から、キャッシュでトークンごとに分けるディレクトリの名前を作ります
+func tokenKey(authorization string) string {
+	sum := sha256.Sum256([]byte(authorization))
+	return hex.EncodeToString(sum[:8])
+}
+
+// hasRecordedPage はページのブロックの最初の取得が dir に記録されているか確かめます
+func hasRecordedPage(dir string, pageID notionapi.BlockID) bool {
+	req, err := http.NewRequest(http.MethodGet, "https://"+notionAPIHost+"/v1/blocks/"+string(pageID)+"/children?page_size=100", nil)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(dir, fixtureName(req, nil)))
+	return err == nil
+}
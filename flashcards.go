@@ -0,0 +1,293 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+
+	"notion-dfs/renderer"
+)
+
+// flashcardDifficulties は --difficulty ごとにプロンプトに加える指示
+var flashcardDifficulties = map[string]string{
+	"easy":   "用語の定義や基本的な事実を確認する、答えが短い問題にしてください。",
+	"medium": "重要な概念の理解を確認する問題にしてください。用語の定義だけでなく、理由や違いを問う問題も含めてください。",
+	"hard":   "複数の内容を組み合わせて考える、応用や比較、因果関係を問う問題にしてください。",
+}
+
+// flashcard は1枚のカード（問題と答え）
+type flashcard struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// runFlashcards generates question and answer pairs from a page with the LLM
+// and writes them as a file that Anki can import: a TSV file, or an .apkg
+// package with its own deck.
+func runFlashcards(args []string) {
+	fs := flag.NewFlagSet("flashcards", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	addLLMFlags(fs)
+	count := fs.Int("count", 20, "number of cards to generate")
+	difficulty := fs.String("difficulty", "medium", "difficulty of the questions: easy, medium or hard")
+	format := fs.String("format", "", "output format: tsv or apkg (default: from the -o extension, or tsv)")
+	output := fs.String("o", "", "output file (default: stdout for tsv)")
+	deck := fs.String("deck", "", "Anki deck name (default: the page title)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs flashcards [--count 20] [--difficulty medium] [--format tsv|apkg] [-o file] <page-id>")
+		fs.PrintDefaults()
+	}
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fs.Usage()
+		exit(1)
+	}
+	if *count < 1 {
+		fatal("--count must be at least 1")
+	}
+	if _, ok := flashcardDifficulties[*difficulty]; !ok {
+		fatalf("unknown --difficulty %q (use easy, medium or hard)", *difficulty)
+	}
+	if *format == "" {
+		*format = "tsv"
+		if strings.EqualFold(filepath.Ext(*output), ".apkg") {
+			*format = "apkg"
+		}
+	}
+	if *format != "tsv" && *format != "apkg" {
+		fatalf("unknown --format %q (use tsv or apkg)", *format)
+	}
+	if *format == "apkg" && *output == "" {
+		fatal("--format apkg needs an output file (-o)")
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	pageID := notionapi.BlockID(formatPageID(positional[0]))
+	title, err := fetchPageTitle(ctx, client, pageID)
+	if err != nil {
+		exitWithNotionError("Error fetching page", err)
+	}
+	tree, err := fetchPageTree(ctx, client, pageID, fetchLimits{SkipChildPages: true})
+	if err != nil {
+		exitWithNotionError("Error fetching page", err)
+	}
+	var content strings.Builder
+	collectContent(tree.Root.Children, &content)
+	if strings.TrimSpace(content.String()) == "" {
+		fatal("the page has no text to make flashcards from")
+	}
+
+	cards, err := generateFlashcards(ctx, title, content.String(), *count, *difficulty)
+	if err != nil {
+		fatal(err)
+	}
+	if *deck == "" {
+		*deck = title
+	}
+
+	var buf bytes.Buffer
+	if *format == "apkg" {
+		err = writeAnkiPackage(&buf, string(pageID), *deck, cards, time.Now())
+	} else {
+		err = writeFlashcardsTSV(&buf, *deck, cards)
+	}
+	if err != nil {
+		fatalf("Error writing flashcards: %v", err)
+	}
+	if *output == "" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := os.WriteFile(*output, buf.Bytes(), 0o644); err != nil {
+		fatalf("Error writing output file: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d cards to %s\n", len(cards), *output)
+}
+
+// generateFlashcards はページの内容から問題と答えの組をLLMに作らせます
+func generateFlashcards(ctx context.Context, title, content string, count int, difficulty string) ([]flashcard, error) {
+	apiKey, _ := openAIKeyCredential.get()
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is not set")
+	}
+	llm := newOpenAIClient(apiKey)
+	prompt := fmt.Sprintf(`あなたは学習用の暗記カードを作る専門家です。与えられたノートの内容から、問題と答えの組を%d個作ってください。
+%s
+答えはノートに書かれている内容だけから作り、問題だけを読んで何を答えればよいかわかるようにしてください。問題と答えはノートと同じ言語で書いてください。
+次の形のJSONのオブジェクトだけを返してください。
+{"cards": [{"question": "問題", "answer": "答え"}]}`, count, flashcardDifficulties[difficulty])
+
+	resp, err := createChatCompletion(ctx, &llm, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(prompt),
+			openai.UserMessage("タイトル: " + title + "\n\n" + content),
+		},
+		Model:          shared.ChatModelGPT4o,
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{OfJSONObject: &shared.ResponseFormatJSONObjectParam{}},
+	}, prompt+title+content, 0)
+	if err != nil {
+		return nil, fmt.Errorf("generating flashcards failed: %v", err)
+	}
+	var result struct {
+		Cards []flashcard `json:"cards"`
+	}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &result); err != nil {
+		return nil, fmt.Errorf("generating flashcards failed: invalid JSON in the response: %v", err)
+	}
+	var cards []flashcard
+	for _, c := range result.Cards {
+		c.Question, c.Answer = strings.TrimSpace(c.Question), strings.TrimSpace(c.Answer)
+		if c.Question != "" && c.Answer != "" {
+			cards = append(cards, c)
+		}
+	}
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("generating flashcards failed: no cards in the response")
+	}
+	return cards, nil
+}
+
+// flashcardHTML はカードのテキストをAnkiのフィールド（HTML）にします
+func flashcardHTML(s string) string {
+	return strings.ReplaceAll(renderer.EscapeHTML(s), "\n", "<br>")
+}
+
+// writeFlashcardsTSV はAnkiの「ノートを取り込む」で読めるTSVを書きます。
+// 先頭のヘッダー行で区切り文字・HTML・ノートタイプ（標準の Basic）・デッキを指定する
+func writeFlashcardsTSV(w io.Writer, deck string, cards []flashcard) error {
+	fmt.Fprintln(w, "#separator:tab")
+	fmt.Fprintln(w, "#html:true")
+	fmt.Fprintln(w, "#notetype:Basic")
+	fmt.Fprintf(w, "#deck:%s\n", strings.NewReplacer("\t", " ", "\n", " ").Replace(deck))
+	for _, c := range cards {
+		q := strings.ReplaceAll(flashcardHTML(c.Question), "\t", " ")
+		a := strings.ReplaceAll(flashcardHTML(c.Answer), "\t", " ")
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", q, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ankiID は名前から決まるIDを返します。同じページのデッキを取り込み直すと、新しいデッキを作らず同じデッキが更新される
+func ankiID(name string) int64 {
+	sum := sha1.Sum([]byte(name))
+	return 1<<40 + int64(binary.BigEndian.Uint64(sum[:8])%(1<<40))
+}
+
+// ankiChecksum はAnkiが重複の検出に使う、最初のフィールドのチェックサム
+func ankiChecksum(field string) int64 {
+	sum := sha1.Sum([]byte(field))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
+
+// ankiSchema は .apkg の collection.anki2 のテーブル（Ankiのスキーマ11）
+var ankiSchema = []sqliteTable{
+	{Name: "col", Key: 0, SQL: "CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null, ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null, models text not null, decks text not null, dconf text not null, tags text not null)"},
+	{Name: "notes", Key: 0, SQL: "CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null, usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null, flags integer not null, data text not null)"},
+	{Name: "cards", Key: 0, SQL: "CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null, mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null, ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null, odue integer not null, odid integer not null, flags integer not null, data text not null)"},
+	{Name: "revlog", Key: 0, SQL: "CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null)"},
+	{Name: "graves", Key: -1, SQL: "CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null)"},
+}
+
+// writeAnkiPackage writes the cards as an Anki package: a zip file with the
+// collection database (the cards in a deck of their own, with a two-field
+// note type) and an empty media list. The deck and note IDs are derived from
+// the page, so importing a regenerated package updates the same deck.
+func writeAnkiPackage(w io.Writer, pageID, deck string, cards []flashcard, now time.Time) error {
+	mod := now.Unix()
+	did := ankiID("deck:" + compactPageID(pageID))
+	mid := ankiID("notion-dfs flashcard")
+
+	model := map[string]any{
+		"id": mid, "name": "notion-dfs Flashcard", "type": 0, "mod": mod, "usn": -1, "sortf": 0, "did": did,
+		"tmpls": []map[string]any{{
+			"name": "Card 1", "ord": 0, "qfmt": "{{Question}}", "afmt": "{{FrontSide}}<hr id=answer>{{Answer}}",
+			"did": nil, "bqfmt": "", "bafmt": "",
+		}},
+		"flds": []map[string]any{
+			{"name": "Question", "ord": 0, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []string{}},
+			{"name": "Answer", "ord": 1, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []string{}},
+		},
+		"css":       ".card { font-family: sans-serif; font-size: 20px; text-align: center; color: black; background-color: white; }",
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+		"tags":      []string{}, "vers": []any{}, "req": []any{[]any{0, "all", []int{0}}},
+	}
+	newDeck := func(id int64, name string) map[string]any {
+		return map[string]any{
+			"id": id, "name": name, "desc": "", "mod": mod, "usn": -1, "collapsed": false,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+			"dyn": 0, "conf": 1, "extendNew": 10, "extendRev": 50,
+		}
+	}
+	decks := map[string]any{"1": newDeck(1, "Default"), strconv.FormatInt(did, 10): newDeck(did, deck)}
+	dconf := map[string]any{"1": map[string]any{
+		"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+		"new":   map[string]any{"delays": []int{1, 10}, "ints": []int{1, 4, 7}, "initialFactor": 2500, "order": 1, "perDay": 20, "bury": true, "separate": true},
+		"rev":   map[string]any{"perDay": 100, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1, "maxIvl": 36500, "minSpace": 1, "bury": true},
+		"lapse": map[string]any{"delays": []int{10}, "mult": 0, "minInt": 1, "leechFails": 8, "leechAction": 0},
+	}}
+	conf := map[string]any{
+		"nextPos": len(cards) + 1, "estTimes": true, "activeDecks": []int64{1}, "sortType": "noteFld", "timeLim": 0,
+		"sortBackwards": false, "addToCur": true, "curDeck": 1, "newSpread": 0, "dueCounts": true, "curModel": mid, "collapseTime": 1200,
+	}
+	jsonText := func(v any) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	tables := append([]sqliteTable(nil), ankiSchema...)
+	tables[0].Rows = [][]any{{int64(1), mod, now.UnixMilli(), now.UnixMilli(), int64(11), int64(0), int64(0), int64(0),
+		jsonText(conf), jsonText(map[string]any{strconv.FormatInt(mid, 10): model}), jsonText(decks), jsonText(dconf), "{}"}}
+	base := now.UnixMilli()
+	for i, c := range cards {
+		id := base + int64(i)
+		// guid もページと問題から決め、取り込み直したときに同じノートが更新されるようにする
+		sum := sha1.Sum([]byte(pageID + "\x00" + c.Question))
+		guid := hex.EncodeToString(sum[:5])
+		fields := flashcardHTML(c.Question) + "\x1f" + flashcardHTML(c.Answer)
+		tables[1].Rows = append(tables[1].Rows, []any{id, guid, mid, mod, int64(-1), "", fields, c.Question, ankiChecksum(c.Question), int64(0), ""})
+		tables[2].Rows = append(tables[2].Rows, []any{id, id, did, int64(0), mod, int64(-1), int64(0), int64(0), int64(i + 1),
+			int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), ""})
+	}
+
+	var db bytes.Buffer
+	if err := writeSQLite(&db, tables); err != nil {
+		return err
+	}
+	zw := zip.NewWriter(w)
+	fw, err := zw.Create("collection.anki2")
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(db.Bytes()); err != nil {
+		return err
+	}
+	// 画像などのメディアは含めない
+	fw, err = zw.Create("media")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(fw, "{}"); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// graphNode はリンクのグラフの頂点（ページ1つ）
+type graphNode struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	// Scanned はページの本文を調べたか。調べた範囲の外からリンクされているだけのページは false
+	Scanned bool `json:"scanned"`
+	// Backlinks はほかのページからのリンクの数（子ページであることは含まない）
+	Backlinks int `json:"backlinks"`
+	// Orphan は調べたページのうち、どのページからもリンクされていないもの（起点のページを除く）
+	Orphan bool `json:"orphan,omitempty"`
+}
+
+// graphEdge はリンクのグラフの辺。Kind は link（本文中のリンク・メンション）か child（子ページ）
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// pageGraph はページ間のリンクのグラフ
+type pageGraph struct {
+	Nodes []*graphNode `json:"nodes"`
+	Edges []graphEdge  `json:"edges"`
+
+	nodes map[string]*graphNode
+	edges map[graphEdge]bool
+}
+
+func newPageGraph() *pageGraph {
+	return &pageGraph{Nodes: []*graphNode{}, Edges: []graphEdge{}, nodes: make(map[string]*graphNode), edges: make(map[graphEdge]bool)}
+}
+
+// node はページの頂点を返します。まだなければ追加する。title はタイトルが分からない場合だけ使う（リンクのテキストなど）
+func (g *pageGraph) node(id, title string) *graphNode {
+	id = formatPageID(compactPageID(id))
+	n, ok := g.nodes[id]
+	if !ok {
+		n = &graphNode{ID: id, URL: "https://www.notion.so/" + compactPageID(id)}
+		g.nodes[id] = n
+		g.Nodes = append(g.Nodes, n)
+	}
+	if n.Title == "" {
+		n.Title = title
+	}
+	return n
+}
+
+func (g *pageGraph) addEdge(from, to *graphNode, kind string) {
+	e := graphEdge{From: from.ID, To: to.ID, Kind: kind}
+	// 自分自身へのリンク（目次のアンカーなど）は辺にしない
+	if from == to || g.edges[e] {
+		return
+	}
+	g.edges[e] = true
+	g.Edges = append(g.Edges, e)
+	if kind == "link" {
+		to.Backlinks++
+	}
+}
+
+// graphFormats は --format で選べる形式
+var graphFormats = map[string]func(w io.Writer, g *pageGraph) error{
+	"dot":     writeGraphDOT,
+	"graphml": writeGraphML,
+	"json": func(w io.Writer, g *pageGraph) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(g)
+	},
+}
+
+// runGraph walks a page and its sub-pages, or the pages matching a search,
+// and writes the page-to-page link graph (links and mentions in the text,
+// "link to page" blocks and the sub-page hierarchy) as Graphviz DOT, GraphML
+// or JSON, to see how a wiki is connected. Scanned pages that no other page
+// links to are marked as orphans and listed on stderr.
+func runGraph(args []string) {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	format := fs.String("format", "dot", "graph format: dot, graphml or json")
+	output := fs.String("o", "", "write the graph to this file instead of stdout")
+	search := fs.String("search", "", "scan the pages whose title matches this search query instead of a page tree")
+	searchAll := fs.Bool("search-all", false, "scan every page shared with the integration")
+	depth := fs.Int("depth", 0, "maximum depth of sub-pages to scan below the page (0 = unlimited)")
+	noChildEdges := fs.Bool("no-child-edges", false, "leave out the edges from pages to their sub-pages")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs graph [--format dot|graphml|json] [-o file] (<page-id> | --search <query> | --search-all)")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	searching := *search != "" || *searchAll
+	if fs.NArg() > 1 || (fs.NArg() == 1) == searching {
+		fs.Usage()
+		exit(1)
+	}
+	write, ok := graphFormats[*format]
+	if !ok {
+		fatalf("unknown graph format: %s (expected dot, graphml or json)", *format)
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	graph := newPageGraph()
+	var roots []*graphNode
+	var err error
+	if searching {
+		var pages []*notionapi.Page
+		if pages, err = searchPages(ctx, client, *search); err != nil {
+			exitWithNotionError("Error searching pages", err)
+		}
+		for _, page := range pages {
+			n := graph.node(string(page.ID), "")
+			n.Title = propertyTitle(page)
+			if err = scanGraphPage(ctx, client, graph, n, 1, 1, !*noChildEdges); err != nil {
+				break
+			}
+		}
+	} else {
+		pageID := notionapi.BlockID(formatPageID(fs.Arg(0)))
+		var page *notionapi.Page
+		if page, err = client.Page.Get(ctx, notionapi.PageID(pageID)); err != nil {
+			exitWithNotionError("Error fetching page", err)
+		}
+		root := graph.node(string(pageID), propertyTitle(page))
+		roots = append(roots, root)
+		err = scanGraphPage(ctx, client, graph, root, 0, *depth, !*noChildEdges)
+	}
+	if err != nil {
+		exitWithNotionError("Error fetching blocks", err)
+	}
+
+	orphans := graph.markOrphans(roots)
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatalf("Error creating output file: %v", err)
+		}
+		out = f
+	}
+	if err := write(out, graph); err != nil {
+		fatalf("Error writing graph: %v", err)
+	}
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			fatalf("Error writing output file: %v", err)
+		}
+	}
+
+	scanned := 0
+	for _, n := range graph.Nodes {
+		if n.Scanned {
+			scanned++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d pages scanned, %d pages, %d edges\n", scanned, len(graph.Nodes), len(graph.Edges))
+	if len(orphans) > 0 {
+		fmt.Fprintf(os.Stderr, "orphaned pages (no links from other pages):\n")
+		for _, n := range orphans {
+			fmt.Fprintf(os.Stderr, "  %s  %s\n", n.ID, n.Title)
+		}
+	}
+}
+
+// scanGraphPage はページの本文からリンクと子ページを辺にし、maxDepth まで子ページを再帰的に調べます（0 は無制限）
+func scanGraphPage(ctx context.Context, client *notionapi.Client, g *pageGraph, n *graphNode, depth, maxDepth int, childEdges bool) error {
+	if n.Scanned {
+		return nil
+	}
+	n.Scanned = true
+	tree, err := fetchPageTree(ctx, client, notionapi.BlockID(n.ID), fetchLimits{SkipChildPages: true})
+	if err != nil {
+		return err
+	}
+	for _, link := range collectLinks(tree) {
+		if link.Kind == "page" {
+			g.addEdge(n, g.node(link.Target, link.Text), "link")
+		}
+	}
+	for _, child := range tree.ChildPages() {
+		sub := g.node(string(child.ID), "")
+		sub.Title = child.ChildPage.Title
+		if childEdges {
+			g.addEdge(n, sub, "child")
+		}
+		if maxDepth == 0 || depth < maxDepth {
+			if err := scanGraphPage(ctx, client, g, sub, depth+1, maxDepth, childEdges); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// markOrphans は起点以外の調べたページのうち、リンクされていないものに印を付けて返します
+func (g *pageGraph) markOrphans(roots []*graphNode) []*graphNode {
+	root := make(map[*graphNode]bool, len(roots))
+	for _, n := range roots {
+		root[n] = true
+	}
+	var orphans []*graphNode
+	for _, n := range g.Nodes {
+		if n.Scanned && n.Backlinks == 0 && !root[n] {
+			n.Orphan = true
+			orphans = append(orphans, n)
+		}
+	}
+	sort.SliceStable(orphans, func(i, j int) bool { return orphans[i].Title < orphans[j].Title })
+	return orphans
+}
+
+// searchPages はタイトルが query にマッチするページを、インテグレーションと共有されている範囲から取得します（空なら全ページ）
+func searchPages(ctx context.Context, client *notionapi.Client, query string) ([]*notionapi.Page, error) {
+	var pages []*notionapi.Page
+	var cursor notionapi.Cursor
+	for {
+		resp, err := client.Search.Do(ctx, &notionapi.SearchRequest{
+			Query:       query,
+			Filter:      notionapi.SearchFilter{Property: "object", Value: "page"},
+			StartCursor: cursor,
+			PageSize:    100,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range resp.Results {
+			if page, ok := obj.(*notionapi.Page); ok && !page.Archived {
+				pages = append(pages, page)
+			}
+		}
+		if !resp.HasMore {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+	return pages, nil
+}
+
+// writeGraphDOT は Graphviz の DOT 形式で書き出します。調べていないページは破線、孤立したページは赤で表示する
+func writeGraphDOT(w io.Writer, g *pageGraph) error {
+	var sb strings.Builder
+	sb.WriteString("digraph notion {\n  rankdir=LR;\n  node [shape=box, style=rounded];\n")
+	for _, n := range g.Nodes {
+		attrs := []string{"label=" + strconv.Quote(graphLabel(n)), "URL=" + strconv.Quote(n.URL)}
+		if !n.Scanned {
+			attrs = append(attrs, `style="rounded,dashed"`)
+		}
+		if n.Orphan {
+			attrs = append(attrs, "color=red")
+		}
+		fmt.Fprintf(&sb, "  %s [%s];\n", strconv.Quote(n.ID), strings.Join(attrs, ", "))
+	}
+	for _, e := range g.Edges {
+		attrs := ""
+		if e.Kind == "child" {
+			attrs = " [style=dotted, color=gray]"
+		}
+		fmt.Fprintf(&sb, "  %s -> %s%s;\n", strconv.Quote(e.From), strconv.Quote(e.To), attrs)
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeGraphML は GraphML 形式で書き出します（Gephi・yEd・Cytoscape などで開ける）
+func writeGraphML(w io.Writer, g *pageGraph) error {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="title" for="node" attr.name="title" attr.type="string"/>
+  <key id="url" for="node" attr.name="url" attr.type="string"/>
+  <key id="scanned" for="node" attr.name="scanned" attr.type="boolean"/>
+  <key id="backlinks" for="node" attr.name="backlinks" attr.type="int"/>
+  <key id="orphan" for="node" attr.name="orphan" attr.type="boolean"/>
+  <key id="kind" for="edge" attr.name="kind" attr.type="string"/>
+  <graph id="notion" edgedefault="directed">
+`)
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&sb, "    <node id=\"%s\">\n", renderer.EscapeHTML(n.ID))
+		fmt.Fprintf(&sb, "      <data key=\"title\">%s</data>\n", renderer.EscapeHTML(n.Title))
+		fmt.Fprintf(&sb, "      <data key=\"url\">%s</data>\n", renderer.EscapeHTML(n.URL))
+		fmt.Fprintf(&sb, "      <data key=\"scanned\">%t</data>\n", n.Scanned)
+		fmt.Fprintf(&sb, "      <data key=\"backlinks\">%d</data>\n", n.Backlinks)
+		fmt.Fprintf(&sb, "      <data key=\"orphan\">%t</data>\n", n.Orphan)
+		sb.WriteString("    </node>\n")
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(&sb, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\"><data key=\"kind\">%s</data></edge>\n", i, renderer.EscapeHTML(e.From), renderer.EscapeHTML(e.To), e.Kind)
+	}
+	sb.WriteString("  </graph>\n</graphml>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// graphLabel はページのタイトル。タイトルが分からない（調べていない、リンクのテキストもない）ページはIDにする
+func graphLabel(n *graphNode) string {
+	if n.Title != "" {
+		return n.Title
+	}
+	return n.ID
+}
@@ -0,0 +1,240 @@
+package main
+
+//go:generate protoc -I proto --go_out=proto/retrieverpb --go_opt=paths=source_relative --go-grpc_out=proto/retrieverpb --go-grpc_opt=paths=source_relative retriever.proto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/encoding/gzip" // gzip で圧縮したリクエストを受け付ける
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	"notion-dfs/proto/retrieverpb"
+)
+
+// maxGRPCMessage は受け付けるリクエストのメッセージの最大サイズ
+const maxGRPCMessage = 4 << 20
+
+// newGRPCServer returns the gRPC server of serve --grpc: the Retriever
+// service of proto/retriever.proto, the standard health service
+// (grpc.health.v1.Health) and server reflection, so that grpcurl and the
+// like can call it without the .proto file. Only the Retriever calls are
+// authenticated; health checks, like GET /healthz, and reflection are open.
+func newGRPCServer(auth serveAuth) *grpc.Server {
+	s := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxGRPCMessage),
+		grpc.ChainUnaryInterceptor(grpcUnaryStatus),
+		grpc.ChainStreamInterceptor(grpcStreamStatus),
+	)
+	retrieverpb.RegisterRetrieverServer(s, &retrieverServer{auth: auth})
+	hs := health.NewServer()
+	hs.SetServingStatus(retrieverpb.Retriever_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, hs)
+	reflection.Register(s)
+	return s
+}
+
+// withGRPC serves gRPC requests with s and the other requests with next, so
+// that both share the address of serve. net/http speaks HTTP/2 only over
+// TLS, so serve --grpc needs a certificate.
+func withGRPC(s *grpc.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			s.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// retrieverServer implements the Retriever service with the generated code
+// in proto/retrieverpb.
+type retrieverServer struct {
+	retrieverpb.UnimplementedRetrieverServer
+	// auth は authorization メタデータのシークレット、または --multi-tenant のNotionのトークンを確かめる
+	auth serveAuth
+}
+
+// options は呼び出しを認証し、ページの取得に使う設定と、リクエストのページIDを返します
+func (s *retrieverServer) options(ctx context.Context, pageID string) (exportOptions, notionapi.BlockID, error) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			authorization = v[0]
+		}
+	}
+	token, reason := s.auth.authorize(authorization)
+	if reason != "" {
+		return exportOptions{}, "", status.Error(codes.Unauthenticated, reason)
+	}
+	id := notionapi.BlockID(formatPageID(pageID))
+	if id == "" {
+		return exportOptions{}, "", status.Error(codes.InvalidArgument, "page_id is required")
+	}
+	return exportOptions{token: token, relations: relationOptions{depth: defaultRelationDepth}}, id, nil
+}
+
+func (s *retrieverServer) GetPage(ctx context.Context, req *retrieverpb.GetPageRequest) (*retrieverpb.Page, error) {
+	opts, pageID, err := s.options(ctx, req.GetPageId())
+	if err != nil {
+		return nil, err
+	}
+	client := opts.notionClient()
+	page, err := client.Page.Get(ctx, notionapi.PageID(pageID))
+	if err != nil {
+		return nil, err
+	}
+	return &retrieverpb.Page{
+		Id:             string(pageID),
+		Title:          propertyTitle(page),
+		Url:            page.URL,
+		CreatedTime:    page.CreatedTime.Format(time.RFC3339),
+		LastEditedTime: page.LastEditedTime.Format(time.RFC3339),
+		Properties:     pageProperties(ctx, client, page, opts.relations),
+	}, nil
+}
+
+func (s *retrieverServer) RenderPage(ctx context.Context, req *retrieverpb.RenderPageRequest) (*retrieverpb.RenderPageResponse, error) {
+	opts, pageID, err := s.options(ctx, req.GetPageId())
+	if err != nil {
+		return nil, err
+	}
+	format := req.GetFormat()
+	if format == "" {
+		format = "markdown"
+	}
+	contentType, ok := serveFormats[format]
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported format %q", format)
+	}
+	opts.format, opts.noSummary, opts.summaryFormat = format, !req.GetSummary(), "text"
+	var buf bytes.Buffer
+	if err := writePage(ctx, &buf, pageID, opts); err != nil {
+		return nil, err
+	}
+	return &retrieverpb.RenderPageResponse{Content: buf.String(), ContentType: contentType}, nil
+}
+
+func (s *retrieverServer) SummarizePage(ctx context.Context, req *retrieverpb.SummarizePageRequest) (*retrieverpb.SummarizePageResponse, error) {
+	opts, pageID, err := s.options(ctx, req.GetPageId())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := fetchPageTree(ctx, opts.notionClient(), pageID, fetchLimits{})
+	if err != nil {
+		return nil, err
+	}
+	input, err := summaryInput(tree.Root.Children, req.GetPerSection())
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(input) == "" {
+		return nil, status.Error(codes.InvalidArgument, "the page has no text to summarize")
+	}
+	summary, err := summarizeContent(input)
+	if err != nil {
+		return nil, err
+	}
+	return &retrieverpb.SummarizePageResponse{Summary: summary}, nil
+}
+
+func (s *retrieverServer) ExportTree(req *retrieverpb.ExportTreeRequest, stream retrieverpb.Retriever_ExportTreeServer) error {
+	ctx := stream.Context()
+	opts, pageID, err := s.options(ctx, req.GetPageId())
+	if err != nil {
+		return err
+	}
+	return exportGRPCTree(ctx, stream, opts.notionClient(), pageID, "", "", 0, int(req.GetMaxDepth()))
+}
+
+// exportGRPCTree はページをMarkdownにして送り、子ページを再帰的に送ります。maxDepth が0なら深さの制限なし
+func exportGRPCTree(ctx context.Context, stream retrieverpb.Retriever_ExportTreeServer, client *notionapi.Client, pageID notionapi.BlockID, title, parentID string, depth, maxDepth int) error {
+	tree, err := fetchPageTree(ctx, client, pageID, fetchLimits{SkipChildPages: true})
+	if err != nil {
+		return err
+	}
+	if title == "" {
+		if title, err = fetchPageTitle(ctx, client, pageID); err != nil {
+			return err
+		}
+	}
+	var content strings.Builder
+	newMarkdownRenderer().PrintBlocks(&content, tree.Root.Children, 0)
+	err = stream.Send(&retrieverpb.ExportedPage{
+		Id:       string(pageID),
+		Title:    title,
+		ParentId: parentID,
+		Depth:    int32(depth),
+		Content:  content.String(),
+	})
+	if err != nil {
+		return err
+	}
+	if maxDepth > 0 && depth+1 >= maxDepth {
+		return nil
+	}
+	for _, child := range tree.ChildPages() {
+		if err := exportGRPCTree(ctx, stream, client, child.ID, child.ChildPage.Title, string(pageID), depth+1, maxDepth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// grpcUnaryStatus と grpcStreamStatus は、メソッドが返したエラーを grpcStatus で gRPC のステータスにします
+func grpcUnaryStatus(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	return resp, grpcStatus(err)
+}
+
+func grpcStreamStatus(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return grpcStatus(handler(srv, ss))
+}
+
+// grpcStatus はエラーを gRPC のステータスのエラーにします。Notion API のエラーはHTTPのステータスに対応するコードにする
+func grpcStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var apiErr *notionapi.Error
+	var rateLimited *notionapi.RateLimitedError
+	code := codes.Unknown
+	switch {
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, errLLMBudget), errors.As(err, &rateLimited):
+		code = codes.ResourceExhausted
+	case errors.As(err, &apiErr):
+		switch apiErr.Status {
+		case http.StatusBadRequest:
+			code = codes.InvalidArgument
+		case http.StatusUnauthorized:
+			code = codes.Unauthenticated
+		case http.StatusForbidden:
+			code = codes.PermissionDenied
+		case http.StatusNotFound:
+			code = codes.NotFound
+		case http.StatusTooManyRequests:
+			code = codes.ResourceExhausted
+		default:
+			code = codes.Unavailable
+		}
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpccredentials "google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+
+	"notion-dfs/proto/retrieverpb"
+)
+
+const (
+	grpcTestPage  = "11111111-1111-1111-1111-111111111111"
+	grpcTestChild = "22222222-2222-2222-2222-222222222222"
+)
+
+// grpcTestNotion は Notion API の代わりに、親ページ・子ページとエラーを返します
+func grpcTestNotion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Header.Get("Authorization") == "Bearer bad":
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"object":"error","status":401,"code":"unauthorized","message":"API token is invalid."}`)
+	case r.URL.Path == "/v1/blocks/"+grpcTestPage+"/children":
+		io.WriteString(w, `{"object":"list","results":[{"object":"block","id":"b1","type":"paragraph","has_children":false,"paragraph":{"rich_text":[{"type":"text","text":{"content":"本文"},"plain_text":"本文"}]}},{"object":"block","id":"`+grpcTestChild+`","type":"child_page","has_children":true,"child_page":{"title":"子"}}],"has_more":false}`)
+	case r.URL.Path == "/v1/blocks/"+grpcTestChild+"/children":
+		io.WriteString(w, `{"object":"list","results":[{"object":"block","id":"b2","type":"paragraph","has_children":false,"paragraph":{"rich_text":[{"type":"text","text":{"content":"子の本文"},"plain_text":"子の本文"}]}}],"has_more":false}`)
+	case r.URL.Path == "/v1/blocks/"+grpcTestPage:
+		io.WriteString(w, `{"object":"block","id":"`+grpcTestPage+`","type":"child_page","child_page":{"title":"P"}}`)
+	case r.URL.Path == "/v1/pages/"+grpcTestPage:
+		io.WriteString(w, `{"object":"page","id":"`+grpcTestPage+`","url":"https://www.notion.so/P-11111111111111111111111111111111","created_time":"2026-10-01T10:00:00.000Z","last_edited_time":"2026-10-13T10:00:00.000Z","properties":{"title":{"id":"title","type":"title","title":[{"type":"text","text":{"content":"P"},"plain_text":"P"}]}}}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"object":"error","status":404,"code":"object_not_found","message":"Could not find the page."}`)
+	}
+}
+
+// grpcTestTransport は Notion API へのリクエストをテストのサーバーに送ります
+type grpcTestTransport struct{ host string }
+
+func (t grpcTestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = "http", t.host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// startGRPCTest は serve --grpc と同じく、TLS の HTTP/2 サーバーで gRPC を提供し、つないだクライアントを返します
+func startGRPCTest(t *testing.T, auth serveAuth) *grpc.ClientConn {
+	t.Helper()
+	t.Setenv("NOTION_DFS_CACHE_DIR", t.TempDir())
+	t.Setenv("NOTION_API_TOKEN", "secret_server")
+	notion := httptest.NewServer(http.HandlerFunc(grpcTestNotion))
+	t.Cleanup(notion.Close)
+	defaultClient := http.DefaultClient
+	http.DefaultClient = &http.Client{Transport: grpcTestTransport{host: strings.TrimPrefix(notion.URL, "http://")}}
+	t.Cleanup(func() { http.DefaultClient = defaultClient })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok\n")
+	})
+	srv := httptest.NewUnstartedServer(withGRPC(newGRPCServer(auth), mux))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	// gRPC 以外のリクエストは元のハンドラーに届く
+	resp, err := srv.Client().Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /healthz = %s", resp.Status)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	conn, err := grpc.NewClient(srv.Listener.Addr().String(), grpc.WithTransportCredentials(grpccredentials.NewClientTLSFromCert(pool, "example.com")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func withBearer(token string) context.Context {
+	ctx := context.Background()
+	if token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func TestGRPCRetriever(t *testing.T) {
+	tests := []struct {
+		name  string
+		auth  serveAuth
+		token string
+		call  func(ctx context.Context, c retrieverpb.RetrieverClient) error
+		want  codes.Code
+	}{
+		{
+			name: "GetPage",
+			auth: serveAuth{secret: "s3cret"}, token: "s3cret",
+			call: func(ctx context.Context, c retrieverpb.RetrieverClient) error {
+				page, err := c.GetPage(ctx, &retrieverpb.GetPageRequest{PageId: strings.ReplaceAll(grpcTestPage, "-", "")})
+				if err == nil && (page.GetId() != grpcTestPage || page.GetTitle() != "P" || page.GetCreatedTime() != "2026-10-01T10:00:00Z") {
+					t.Errorf("GetPage() = %v", page)
+				}
+				return err
+			},
+			want: codes.OK,
+		},
+		{
+			name: "GetPage without the secret",
+			auth: serveAuth{secret: "s3cret"},
+			call: func(ctx context.Context, c retrieverpb.RetrieverClient) error {
+				_, err := c.GetPage(ctx, &retrieverpb.GetPageRequest{PageId: grpcTestPage})
+				return err
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "GetPage with a wrong secret",
+			auth: serveAuth{secret: "s3cret"}, token: "guess",
+			call: func(ctx context.Context, c retrieverpb.RetrieverClient) error {
+				_, err := c.GetPage(ctx, &retrieverpb.GetPageRequest{PageId: grpcTestPage})
+				return err
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "GetPage without page_id",
+			auth: serveAuth{secret: "s3cret"}, token: "s3cret",
+			call: func(ctx context.Context, c retrieverpb.RetrieverClient) error {
+				_, err := c.GetPage(ctx, &retrieverpb.GetPageRequest{})
+				return err
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "GetPage of a missing page",
+			auth: serveAuth{secret: "s3cret"}, token: "s3cret",
+			call: func(ctx context.Context, c retrieverpb.RetrieverClient) error {
+				_, err := c.GetPage(ctx, &retrieverpb.GetPageRequest{PageId: "33333333333333333333333333333333"})
+				return err
+			},
+			want: codes.NotFound,
+		},
+		{
+			name: "GetPage with an invalid Notion token",
+			auth: serveAuth{multiTenant: true}, token: "bad",
+			call: func(ctx context.Context, c retrieverpb.RetrieverClient) error {
+				_, err := c.GetPage(ctx, &retrieverpb.GetPageRequest{PageId: grpcTestPage})
+				return err
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "RenderPage",
+			auth: serveAuth{multiTenant: true}, token: "secret_user",
+			call: func(ctx context.Context, c retrieverpb.RetrieverClient) error {
+				resp, err := c.RenderPage(ctx, &retrieverpb.RenderPageRequest{PageId: grpcTestPage})
+				if err == nil && (!strings.Contains(resp.GetContent(), "本文") || resp.GetContentType() != serveFormats["markdown"]) {
+					t.Errorf("RenderPage() = %v", resp)
+				}
+				return err
+			},
+			want: codes.OK,
+		},
+		{
+			name: "RenderPage in an unsupported format",
+			auth: serveAuth{secret: "s3cret"}, token: "s3cret",
+			call: func(ctx context.Context, c retrieverpb.RetrieverClient) error {
+				_, err := c.RenderPage(ctx, &retrieverpb.RenderPageRequest{PageId: grpcTestPage, Format: "pdf"})
+				return err
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "ExportTree",
+			auth: serveAuth{secret: "s3cret"}, token: "s3cret",
+			call: func(ctx context.Context, c retrieverpb.RetrieverClient) error {
+				stream, err := c.ExportTree(ctx, &retrieverpb.ExportTreeRequest{PageId: grpcTestPage})
+				if err != nil {
+					return err
+				}
+				var got []string
+				for {
+					page, err := stream.Recv()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						return err
+					}
+					got = append(got, page.GetTitle()+"@"+page.GetParentId()+":"+strings.TrimSpace(page.GetContent()))
+				}
+				want := []string{"P@:本文", "子@" + grpcTestPage + ":子の本文"}
+				if strings.Join(got, "\n") != strings.Join(want, "\n") {
+					t.Errorf("ExportTree() = %q, want %q", got, want)
+				}
+				return nil
+			},
+			want: codes.OK,
+		},
+		{
+			name: "ExportTree without the secret",
+			auth: serveAuth{secret: "s3cret"},
+			call: func(ctx context.Context, c retrieverpb.RetrieverClient) error {
+				stream, err := c.ExportTree(ctx, &retrieverpb.ExportTreeRequest{PageId: grpcTestPage})
+				if err != nil {
+					return err
+				}
+				_, err = stream.Recv()
+				return err
+			},
+			want: codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := startGRPCTest(t, tt.auth)
+			err := tt.call(withBearer(tt.token), retrieverpb.NewRetrieverClient(conn))
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("code = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestGRPCHealthAndReflection(t *testing.T) {
+	conn := startGRPCTest(t, serveAuth{secret: "s3cret"})
+	// どちらも認証なしで呼び出せる
+	ctx := context.Background()
+
+	tests := []struct {
+		service string
+		want    healthpb.HealthCheckResponse_ServingStatus
+		code    codes.Code
+	}{
+		{"", healthpb.HealthCheckResponse_SERVING, codes.OK},
+		{"notiondfs.v1.Retriever", healthpb.HealthCheckResponse_SERVING, codes.OK},
+		{"notiondfs.v1.Unknown", healthpb.HealthCheckResponse_SERVICE_UNKNOWN, codes.NotFound},
+	}
+	for _, tt := range tests {
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: tt.service})
+		if status.Code(err) != tt.code || (err == nil && resp.GetStatus() != tt.want) {
+			t.Errorf("Check(%q) = %v, %v; want %v, %v", tt.service, resp.GetStatus(), err, tt.want, tt.code)
+		}
+	}
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	services := make(map[string]bool)
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		services[s.GetName()] = true
+	}
+	for _, name := range []string{"notiondfs.v1.Retriever", "grpc.health.v1.Health"} {
+		if !services[name] {
+			t.Errorf("reflection lists %v, want %s", services, name)
+		}
+	}
+	stream.CloseSend()
+}
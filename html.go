@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// htmlRenderer renders a block tree as XHTML, so the output is also valid in
+// EPUB documents and, with storageFormat, as Confluence storage format.
+type htmlRenderer struct {
+	// headingShift は見出しのレベルに加える数（ページタイトルを h1 にする場合は 1）
+	headingShift int
+	// image は画像のURLを受け取り、src に使うパスを返す（nil ならURLをそのまま使う）
+	image func(rawURL string) string
+	// storageFormat が true の場合、コード・コールアウト・トグル・画像を Confluence のマクロとして出力する。
+	// このとき image が元のURL以外を返した場合は、ページの添付ファイル名として扱う
+	storageFormat bool
+	// flattenToggles が true の場合、トグルを <details> にせず、見出しの段落と内容をそのまま並べる
+	flattenToggles bool
+	// columns はカラムの出力方法（--columns）。空なら内容を順に並べる
+	columns string
+}
+
+// htmlListTags は連続した項目をまとめるリストの種類ごとの開始・終了タグ
+var htmlListTags = map[string][2]string{
+	"bulleted_list_item": {"<ul>", "</ul>"},
+	"numbered_list_item": {"<ol>", "</ol>"},
+	"to_do":              {`<ul class="todo">`, "</ul>"},
+}
+
+// renderBlocks は兄弟ブロックを出力し、連続するリスト項目を1つのリストにまとめます
+func (r *htmlRenderer) renderBlocks(w io.Writer, nodes []*BlockNode) {
+	list := ""
+	for _, node := range nodes {
+		typ := string(node.Block.GetType())
+		if _, ok := htmlListTags[typ]; !ok {
+			typ = ""
+		}
+		if typ != list {
+			if list != "" {
+				fmt.Fprintln(w, htmlListTags[list][1])
+			}
+			if typ != "" {
+				fmt.Fprintln(w, htmlListTags[typ][0])
+			}
+			list = typ
+		}
+		r.renderBlock(w, node)
+	}
+	if list != "" {
+		fmt.Fprintln(w, htmlListTags[list][1])
+	}
+}
+
+func (r *htmlRenderer) renderBlock(w io.Writer, node *BlockNode) {
+	switch b := node.Block.(type) {
+	case *notionapi.ParagraphBlock:
+		fmt.Fprintf(w, "<p>%s</p>\n", htmlRichText(b.Paragraph.RichText))
+
+	case *notionapi.Heading1Block:
+		if b.Heading1.IsToggleable {
+			r.toggle(w, r.headingHTML(1, b.Heading1.RichText), true, node.Children)
+			return
+		}
+		r.heading(w, 1, b.Heading1.RichText)
+
+	case *notionapi.Heading2Block:
+		if b.Heading2.IsToggleable {
+			r.toggle(w, r.headingHTML(2, b.Heading2.RichText), true, node.Children)
+			return
+		}
+		r.heading(w, 2, b.Heading2.RichText)
+
+	case *notionapi.Heading3Block:
+		if b.Heading3.IsToggleable {
+			r.toggle(w, r.headingHTML(3, b.Heading3.RichText), true, node.Children)
+			return
+		}
+		r.heading(w, 3, b.Heading3.RichText)
+
+	case *notionapi.BulletedListItemBlock:
+		r.listItem(w, "", b.BulletedListItem.RichText, node.Children)
+		return
+
+	case *notionapi.NumberedListItemBlock:
+		r.listItem(w, "", b.NumberedListItem.RichText, node.Children)
+		return
+
+	case *notionapi.ToDoBlock:
+		checkbox := "☐ "
+		if b.ToDo.Checked {
+			checkbox = "☑ "
+		}
+		r.listItem(w, checkbox, b.ToDo.RichText, node.Children)
+		return
+
+	case *notionapi.ImageBlock:
+		src := ""
+		if b.Image.Type == "external" {
+			src = b.Image.External.URL
+		} else if b.Image.Type == "file" {
+			src = b.Image.File.URL
+		}
+		if src == "" {
+			break
+		}
+		if r.storageFormat {
+			r.confluenceImage(w, src, b.Image.Caption)
+			break
+		}
+		if r.image != nil {
+			src = r.image(src)
+		}
+		fmt.Fprintf(w, "<figure><img src=\"%s\" alt=\"%s\"/>", renderer.EscapeHTML(src), renderer.EscapeHTML(renderer.PlainText(b.Image.Caption)))
+		if len(b.Image.Caption) > 0 {
+			fmt.Fprintf(w, "<figcaption>%s</figcaption>", htmlRichText(b.Image.Caption))
+		}
+		fmt.Fprintln(w, "</figure>")
+
+	case *notionapi.CodeBlock:
+		if r.storageFormat {
+			// キャプションは code マクロのタイトルにする
+			title := ""
+			if caption := strings.TrimSpace(renderer.PlainText(b.Code.Caption)); caption != "" {
+				title = "<ac:parameter ac:name=\"title\">" + renderer.EscapeHTML(caption) + "</ac:parameter>"
+			}
+			fmt.Fprintf(w, "<ac:structured-macro ac:name=\"code\"><ac:parameter ac:name=\"language\">%s</ac:parameter>%s<ac:plain-text-body><![CDATA[%s]]></ac:plain-text-body></ac:structured-macro>\n",
+				renderer.EscapeHTML(codeLanguage(b.Code.Language)), title, strings.ReplaceAll(renderer.PlainText(b.Code.RichText), "]]>", "]]]]><![CDATA[>"))
+			break
+		}
+		code := fmt.Sprintf("<pre><code class=\"language-%s\">%s</code></pre>", renderer.EscapeHTML(codeLanguage(b.Code.Language)), renderer.EscapeHTML(renderer.PlainText(b.Code.RichText)))
+		if renderer.DiagramType(b.Code) == "mermaid" {
+			// mermaid.js が図にする形式
+			code = fmt.Sprintf("<pre class=\"mermaid\">%s</pre>", renderer.EscapeHTML(renderer.PlainText(b.Code.RichText)))
+		}
+		if len(b.Code.Caption) > 0 {
+			code = "<figure>" + code + "<figcaption>" + htmlRichText(b.Code.Caption) + "</figcaption></figure>"
+		}
+		fmt.Fprintln(w, code)
+
+	case *notionapi.QuoteBlock:
+		fmt.Fprintf(w, "<blockquote><p>%s</p>\n", htmlRichText(b.Quote.RichText))
+		r.renderBlocks(w, node.Children)
+		fmt.Fprintln(w, "</blockquote>")
+		return
+
+	case *notionapi.CalloutBlock:
+		icon := "💡"
+		if b.Callout.Icon != nil && b.Callout.Icon.Type == "emoji" {
+			icon = string(*b.Callout.Icon.Emoji)
+		}
+		if r.storageFormat {
+			fmt.Fprintf(w, "<ac:structured-macro ac:name=\"%s\"><ac:rich-text-body><p>%s %s</p>\n", confluenceCalloutMacros[calloutKind(b.Callout)], renderer.EscapeHTML(icon), htmlRichText(b.Callout.RichText))
+			r.renderBlocks(w, node.Children)
+			fmt.Fprintln(w, "</ac:rich-text-body></ac:structured-macro>")
+			return
+		}
+		fmt.Fprintf(w, "<div class=\"callout callout-%s\"><p>%s %s</p>\n", calloutKind(b.Callout), renderer.EscapeHTML(icon), htmlRichText(b.Callout.RichText))
+		r.renderBlocks(w, node.Children)
+		fmt.Fprintln(w, "</div>")
+		return
+
+	case *notionapi.DividerBlock:
+		fmt.Fprintln(w, "<hr/>")
+
+	case *notionapi.ToggleBlock:
+		title := htmlRichText(b.Toggle.RichText)
+		if r.storageFormat {
+			// マクロのパラメーターには書式を使えない
+			title = renderer.EscapeHTML(renderer.PlainText(b.Toggle.RichText))
+		}
+		r.toggle(w, title, false, node.Children)
+		return
+
+	case *notionapi.TableBlock:
+		r.table(w, node.Children, b.Table.HasColumnHeader)
+		return
+
+	case *notionapi.ColumnListBlock:
+		r.columnList(w, node)
+		return
+
+	case *notionapi.ColumnBlock:
+		r.renderBlocks(w, node.Children)
+		return
+
+	case *notionapi.ChildPageBlock:
+		// 子ページの中身を取得している場合は見出しを付けてそのまま続け、
+		// 取得していない場合（別の章として扱う場合）は何も出力しない
+		if len(node.Children) > 0 {
+			r.heading(w, 1, []notionapi.RichText{{PlainText: b.ChildPage.Title}})
+			r.renderBlocks(w, node.Children)
+		}
+		return
+	}
+
+	// 段落などの子ブロックは Notion と同様に字下げして表示する
+	if len(node.Children) > 0 {
+		fmt.Fprintln(w, `<div class="children">`)
+		r.renderBlocks(w, node.Children)
+		fmt.Fprintln(w, "</div>")
+	}
+}
+
+// confluenceImage は画像を添付ファイル（image が添付ファイル名を返した場合）またはURLとして参照します
+func (r *htmlRenderer) confluenceImage(w io.Writer, src string, caption []notionapi.RichText) {
+	resource := fmt.Sprintf("<ri:url ri:value=\"%s\"/>", renderer.EscapeHTML(src))
+	if r.image != nil {
+		if name := r.image(src); name != src {
+			resource = fmt.Sprintf("<ri:attachment ri:filename=\"%s\"/>", renderer.EscapeHTML(name))
+		}
+	}
+	fmt.Fprintf(w, "<ac:image ac:alt=\"%s\">%s", renderer.EscapeHTML(renderer.PlainText(caption)), resource)
+	if len(caption) > 0 {
+		fmt.Fprintf(w, "<ac:caption><p>%s</p></ac:caption>", htmlRichText(caption))
+	}
+	fmt.Fprintln(w, "</ac:image>")
+}
+
+func (r *htmlRenderer) heading(w io.Writer, level int, richText []notionapi.RichText) {
+	fmt.Fprintln(w, r.headingHTML(level, richText))
+}
+
+func (r *htmlRenderer) headingHTML(level int, richText []notionapi.RichText) string {
+	level = min(level+r.headingShift, 6)
+	return fmt.Sprintf("<h%d>%s</h%d>", level, htmlRichText(richText), level)
+}
+
+// toggle はトグル（heading ならトグル見出し）を、title を <summary> にした <details> として出力します。
+// flattenToggles の場合は title（トグルなら段落にして）と内容をそのまま並べ、storageFormat では expand マクロにする
+func (r *htmlRenderer) toggle(w io.Writer, title string, heading bool, children []*BlockNode) {
+	if r.storageFormat {
+		// トグルは expand マクロにする。トグル見出しは目次に残すため、見出しの後にタイトルのないマクロを置く
+		if heading {
+			fmt.Fprintln(w, title)
+			title = ""
+		}
+		fmt.Fprint(w, "<ac:structured-macro ac:name=\"expand\">")
+		if title != "" {
+			fmt.Fprintf(w, "<ac:parameter ac:name=\"title\">%s</ac:parameter>", title)
+		}
+		fmt.Fprintln(w, "<ac:rich-text-body>")
+		r.renderBlocks(w, children)
+		fmt.Fprintln(w, "</ac:rich-text-body></ac:structured-macro>")
+		return
+	}
+	if r.flattenToggles {
+		if !heading {
+			title = "<p>" + title + "</p>"
+		}
+		fmt.Fprintln(w, title)
+		r.renderBlocks(w, children)
+		return
+	}
+	fmt.Fprintf(w, "<details><summary>%s</summary>\n", title)
+	r.renderBlocks(w, children)
+	fmt.Fprintln(w, "</details>")
+}
+
+func (r *htmlRenderer) listItem(w io.Writer, prefix string, richText []notionapi.RichText, children []*BlockNode) {
+	fmt.Fprintf(w, "<li>%s%s", prefix, htmlRichText(richText))
+	if len(children) > 0 {
+		fmt.Fprintln(w)
+		r.renderBlocks(w, children)
+	}
+	fmt.Fprintln(w, "</li>")
+}
+
+func (r *htmlRenderer) table(w io.Writer, rows []*BlockNode, hasHeader bool) {
+	fmt.Fprintln(w, "<table>")
+	for i, row := range rows {
+		tr, ok := row.Block.(*notionapi.TableRowBlock)
+		if !ok {
+			continue
+		}
+		cell := "td"
+		if hasHeader && i == 0 {
+			cell = "th"
+		}
+		fmt.Fprint(w, "<tr>")
+		for _, c := range tr.TableRow.Cells {
+			fmt.Fprintf(w, "<%s>%s</%s>", cell, htmlRichText(c), cell)
+		}
+		fmt.Fprintln(w, "</tr>")
+	}
+	fmt.Fprintln(w, "</table>")
+}
+
+// htmlRichText はリッチテキストを装飾（太字・斜体・取り消し線・下線・コード）とリンクを含むHTMLにします
+func htmlRichText(richText []notionapi.RichText) string {
+	return renderer.HTMLText(richText, true)
+}
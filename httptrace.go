@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpTracer logs every request that goes through it, for diagnosing slow or
+// failing exports. The Notion and OpenAI clients retry rate-limited and
+// failed requests on their own, so a request to the same URL right after a
+// 429 or 5xx response is logged as a retry.
+type httpTracer struct {
+	next http.RoundTripper
+	w    io.Writer
+
+	mu sync.Mutex
+	// retries は直前の応答が 429 または 5xx だったリクエスト（メソッドとURL）ごとの再試行の回数
+	retries map[string]int
+}
+
+func (t *httpTracer) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + req.URL.String()
+	t.mu.Lock()
+	attempt := t.retries[key] + 1
+	t.mu.Unlock()
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s http: %s %s%s", start.Format("15:04:05.000"), req.Method, req.URL.Host, req.URL.RequestURI())
+	if err != nil {
+		fmt.Fprintf(&sb, " -> error: %v (%s)", err, elapsed)
+	} else {
+		fmt.Fprintf(&sb, " -> %d (%s)", resp.StatusCode, elapsed)
+		for _, h := range rateLimitHeaders(resp.Header) {
+			fmt.Fprintf(&sb, " %s", h)
+		}
+	}
+	if attempt > 1 {
+		fmt.Fprintf(&sb, " [retry %d]", attempt-1)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500) {
+		t.retries[key] = attempt
+	} else {
+		delete(t.retries, key)
+	}
+	fmt.Fprintln(t.w, sb.String())
+	return resp, err
+}
+
+// rateLimitHeaders はレート制限に関するヘッダー（Retry-After と x-ratelimit-*）を "name=value" の形式で返します
+func rateLimitHeaders(h http.Header) []string {
+	var list []string
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		if lower == "retry-after" || strings.HasPrefix(lower, "x-ratelimit-") {
+			list = append(list, lower+"="+strings.Join(values, ","))
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// httpTraceFiles は開いたログファイル（configureHTTP が複数回呼ばれても同じファイルを開き直さない）
+var httpTraceFiles = make(map[string]*os.File)
+
+// openHTTPTrace はトレースの出力先を開きます。"1"・"true"・"stderr" なら標準エラー出力、それ以外はファイルに追記する
+func openHTTPTrace(dest string) (io.Writer, error) {
+	switch strings.ToLower(dest) {
+	case "1", "true", "stderr":
+		return os.Stderr, nil
+	}
+	if f, ok := httpTraceFiles[dest]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open HTTP trace file: %w", err)
+	}
+	httpTraceFiles[dest] = f
+	return f, nil
+}
+
+// enableHTTPTrace はサブコマンドの --debug-http・--debug-http-file で、これ以降のリクエストを dest に記録します。
+// NOTION_DFS_DEBUG_HTTP ですでに記録している場合は何もしない
+func enableHTTPTrace(dest string) error {
+	if _, ok := http.DefaultTransport.(*httpTracer); ok {
+		return nil
+	}
+	w, err := openHTTPTrace(dest)
+	if err != nil {
+		return err
+	}
+	http.DefaultTransport = &httpTracer{next: http.DefaultTransport, w: w, retries: make(map[string]int)}
+	return nil
+}
+
+// addDiagnosticFlags adds the flags for diagnosing a subcommand, which the
+// main command has too: --debug-http, --debug-http-file and the profiling
+// flags (addProfilingFlags). Each takes effect as soon as it is parsed.
+func addDiagnosticFlags(fs *flag.FlagSet) {
+	fs.BoolFunc("debug-http", "log every HTTP request (method, URL, status, latency, rate-limit headers, retries) to stderr (default: NOTION_DFS_DEBUG_HTTP=1)", func(v string) error {
+		if on, err := strconv.ParseBool(v); err != nil || !on {
+			return err
+		}
+		return enableHTTPTrace("stderr")
+	})
+	fs.Func("debug-http-file", "like --debug-http, but append the log to this file (default: NOTION_DFS_DEBUG_HTTP=<file>)", enableHTTPTrace)
+	addProfilingFlags(fs)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// hugoPreset writes each page as a Hugo page bundle: <slug>/index.md with the
+// page's images stored in the same folder.
+// https://gohugo.io/content-management/page-bundles/
+type hugoPreset struct {
+	pageNames
+	slugs map[*sitePage]string
+}
+
+func (h *hugoPreset) prepare(pages []*sitePage) {
+	h.slugs = h.assign(pages, func(p *sitePage) string {
+		if prop, ok := findProperty(p.Page, "slug").(*notionapi.RichTextProperty); ok {
+			if s := renderer.Slugify(renderer.PlainText(prop.RichText)); s != "" {
+				return s
+			}
+		}
+		return renderer.Slugify(p.Title)
+	}, fileNameText)
+}
+
+// subPages は false。指定したページ（またはデータベースの各行）だけを書き出す
+func (h *hugoPreset) subPages() bool {
+	return false
+}
+
+func (h *hugoPreset) pageFile(p *sitePage) string {
+	return filepath.Join(h.slugs[p], "index.md")
+}
+
+func (h *hugoPreset) assetDir(p *sitePage) string {
+	return h.slugs[p]
+}
+
+// frontMatter は title（アイコンの絵文字付き）・date・lastmod・draft・tags と、
+// カバー画像の featured_image・アイコンの画像の icon をYAMLで出力します。
+// 文字列は常にクォートし、YAMLとして解釈が変わらないようにします
+func (h *hugoPreset) frontMatter(p *sitePage) string {
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	sb.WriteString("title: " + strconv.Quote(p.displayTitle()) + "\n")
+	// Hugo が解釈できるよう、--date-format にかかわらず RFC 3339 で書く（--timezone は反映する）
+	sb.WriteString("date: " + dateDisplay.in(pageDate(p.Page)).Format(time.RFC3339) + "\n")
+	sb.WriteString("lastmod: " + dateDisplay.in(p.Page.LastEditedTime).Format(time.RFC3339) + "\n")
+	sb.WriteString("draft: " + strconv.FormatBool(pageDraft(p.Page)) + "\n")
+	if tags := pageTags(p.Page); len(tags) > 0 {
+		sb.WriteString("tags:\n")
+		for _, tag := range tags {
+			sb.WriteString("  - " + strconv.Quote(tag) + "\n")
+		}
+	}
+	if p.Cover != "" {
+		sb.WriteString("featured_image: " + strconv.Quote(p.Cover) + "\n")
+	}
+	if p.Icon != "" {
+		sb.WriteString("icon: " + strconv.Quote(p.Icon) + "\n")
+	}
+	sb.WriteString("---\n\n")
+	return sb.String()
+}
+
+// pageDate は公開日を表す日付プロパティを優先し、なければページの作成日時を返します
+func pageDate(page *notionapi.Page) time.Time {
+	// "Published" はチェックボックスのこともあるので、名前ごとに型を確かめる
+	for _, name := range []string{"date", "published", "publish date", "公開日", "日付"} {
+		prop, ok := findProperty(page, name).(*notionapi.DateProperty)
+		if ok && prop.Date != nil && prop.Date.Start != nil {
+			return time.Time(*prop.Date.Start)
+		}
+	}
+	return page.CreatedTime
+}
+
+// pageDraft は "Draft"/"下書き" チェックボックスを、なければ "Published"/"公開" の反対を返します
+func pageDraft(page *notionapi.Page) bool {
+	if prop, ok := findProperty(page, "draft", "下書き").(*notionapi.CheckboxProperty); ok {
+		return prop.Checkbox
+	}
+	if prop, ok := findProperty(page, "published", "公開").(*notionapi.CheckboxProperty); ok {
+		return !prop.Checkbox
+	}
+	return false
+}
+
+// pageTags はすべてのマルチセレクトプロパティの値を重複なく返します（プロパティ名順、各プロパティ内はNotion上の順）
+func pageTags(page *notionapi.Page) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, name := range sortedPropertyNames(page) {
+		if prop, ok := page.Properties[name].(*notionapi.MultiSelectProperty); ok {
+			for _, opt := range prop.MultiSelect {
+				if !seen[opt.Name] {
+					seen[opt.Name] = true
+					tags = append(tags, opt.Name)
+				}
+			}
+		}
+	}
+	return tags
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jomei/notionapi"
+	"github.com/openai/openai-go"
+
+	"notion-dfs/renderer"
+)
+
+// defaultVisionModel は --vision-model を指定しない場合に画像の説明に使うモデル
+const defaultVisionModel = "gpt-4o-mini"
+
+// imageTokenEstimate は --max-cost の判定で1枚の画像の入力として見込むトークン数
+const imageTokenEstimate = 1105
+
+// imageDescriptionPrompt は画像の説明（代替テキスト）を作るプロンプト
+const imageDescriptionPrompt = `あなたは画像の代替テキストを書く専門家です。画像を見られない人や検索のために、画像に写っているものと、図・グラフ・スクリーンショットならその内容（読み取れる文字や数値を含む）を1〜3文で説明してください。
+「この画像は」などの前置きは付けず、説明だけを返してください。`
+
+// imageDescriber fills in the caption of image blocks that have none with a
+// description written by a vision model (--describe-images), so that the
+// alt text of the exported page, its summary and search cover the images.
+// Descriptions are cached by the hash of the image, since the URLs of
+// uploaded files change on every fetch.
+type imageDescriber struct {
+	client *openai.Client
+	model  string
+	cache  *resultCache
+}
+
+func newImageDescriber(model string) (*imageDescriber, error) {
+	apiKey, _ := openAIKeyCredential.get()
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is not set (--describe-images describes the images with the OpenAI API)")
+	}
+	cache, err := openResultCache("image-descriptions")
+	if err != nil {
+		return nil, err
+	}
+	client := newOpenAIClient(apiKey)
+	return &imageDescriber{client: &client, model: model, cache: cache}, nil
+}
+
+// describeTree はキャプションのない画像ブロックに説明をキャプションとして設定します。
+// 説明できなかった画像はログに出してそのままにする
+func (d *imageDescriber) describeTree(ctx context.Context, tree *PageTree) {
+	var walk func(nodes []*BlockNode)
+	walk = func(nodes []*BlockNode) {
+		for _, node := range nodes {
+			if b, ok := node.Block.(*notionapi.ImageBlock); ok && strings.TrimSpace(renderer.PlainText(b.Image.Caption)) == "" {
+				description, err := d.describe(ctx, b.Image.GetURL())
+				if err != nil {
+					log.Printf("Error describing image %s: %v", b.ID, err)
+				} else if description != "" {
+					b.Image.Caption = displayRichText(description, "")
+				}
+			}
+			walk(node.Children)
+		}
+	}
+	walk(tree.Root.Children)
+}
+
+// describe は画像をダウンロードしてモデルに送り、説明を返します
+func (d *imageDescriber) describe(ctx context.Context, rawURL string) (string, error) {
+	if rawURL == "" {
+		return "", nil
+	}
+	data, contentType, err := fetchURL(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	key := d.model + ":" + hex.EncodeToString(sum[:])
+	if cached, ok := d.cache.get(key); ok {
+		return cached, nil
+	}
+
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+	contentType, _, _ = strings.Cut(contentType, ";")
+	// 画像はURLではなくデータとして送る（アップロードされたファイルの署名付きURLは期限が短いため）
+	dataURL := "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	// 画像のトークン数は大きさで変わるため、--max-cost では高解像度の画像の上限（約1100トークン）で見積もる
+	resp, err := createChatCompletion(ctx, d.client, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(imageDescriptionPrompt),
+			openai.UserMessage([]openai.ChatCompletionContentPartUnionParam{
+				openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{URL: dataURL}),
+			}),
+		},
+		Model: d.model,
+	}, imageDescriptionPrompt, imageTokenEstimate)
+	if err != nil {
+		return "", fmt.Errorf("image description failed: %v", err)
+	}
+	description := strings.Join(strings.Fields(resp.Choices[0].Message.Content), " ")
+	if err := d.cache.put(key, description); err != nil {
+		return "", err
+	}
+	return description, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// imageEncoders は WebP・AVIF に変換するときに使う外部コマンド（Go の標準ライブラリにはエンコーダーがない）
+var imageEncoders = map[string]string{"webp": "cwebp", "avif": "avifenc"}
+
+// imageOptimizer shrinks the images downloaded by a site export: images
+// larger than the maximum width or height are scaled down, keeping the
+// aspect ratio, and images are converted to another format when asked to.
+// JPEG and PNG are encoded in Go; WebP and AVIF need cwebp or avifenc from
+// libwebp and libavif. Animated GIFs, SVGs and files that are not images are
+// kept as they are.
+type imageOptimizer struct {
+	maxWidth, maxHeight int
+	// format は変換する形式（jpeg・png・webp・avif）。空なら元の形式のまま
+	format  string
+	quality int
+
+	mu              sync.Mutex
+	count           int
+	before, after   int64
+	encoderWarnOnce sync.Once
+}
+
+// newImageOptimizer は --image-* の設定から imageOptimizer を作ります。何も指定しなければ nil
+func newImageOptimizer(s exportSettings) *imageOptimizer {
+	if s.ImageMaxWidth == 0 && s.ImageMaxHeight == 0 && s.ImageFormat == "" {
+		return nil
+	}
+	return &imageOptimizer{maxWidth: s.ImageMaxWidth, maxHeight: s.ImageMaxHeight, format: s.ImageFormat, quality: s.ImageQuality}
+}
+
+// checkImageEncoder は形式に外部コマンドが必要なら、それがあるか確かめます
+func checkImageEncoder(format string) error {
+	tool, ok := imageEncoders[format]
+	if !ok {
+		return nil
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return fmt.Errorf("--image-format %s needs %s on the PATH (install libwebp or libavif)", format, tool)
+	}
+	return nil
+}
+
+// optimize は画像を縮小・変換し、内容とファイル名（拡張子を変えたもの）を返します。対象外なら data と name をそのまま返す
+func (o *imageOptimizer) optimize(data []byte, name string) ([]byte, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format == "gif" {
+		// 画像でない（SVGなど）か、アニメーションかもしれないGIF
+		return data, name, nil
+	}
+	target := o.format
+	if target == "" {
+		target = format
+	}
+	width, height := fitImage(config.Width, config.Height, o.maxWidth, o.maxHeight)
+	resize := width != config.Width || height != config.Height
+	if !resize && target == format {
+		return data, name, nil
+	}
+	if _, external := imageEncoders[target]; external {
+		if err := checkImageEncoder(target); err != nil {
+			// 元の形式のまま縮小する場合（WebP の画像など）は、コマンドがなければそのまま保存する
+			o.encoderWarnOnce.Do(func() { log.Printf("warning: %v; keeping such images as they are", err) })
+			return data, name, nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if resize {
+		dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+		xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+		img = dst
+	}
+	out, err := o.encode(img, target)
+	if err != nil {
+		return nil, "", err
+	}
+
+	o.mu.Lock()
+	o.count++
+	o.before += int64(len(data))
+	o.after += int64(len(out))
+	o.mu.Unlock()
+	ext := "." + target
+	if target == "jpeg" {
+		ext = ".jpg"
+	}
+	return out, strings.TrimSuffix(name, path.Ext(name)) + ext, nil
+}
+
+func (o *imageOptimizer) encode(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		// JPEG には透明度がないため、白い背景に重ねる
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), &image.Uniform{C: color.White}, image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: o.quality}); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "png":
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := enc.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	// WebP・AVIF は PNG を一時ファイルに書いて外部コマンドで変換する
+	dir, err := os.MkdirTemp("", "notion-dfs-image-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in.png"), filepath.Join(dir, "out."+format)
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(in, buf.Bytes(), 0o600); err != nil {
+		return nil, err
+	}
+	quality := strconv.Itoa(o.quality)
+	var cmd *exec.Cmd
+	if format == "webp" {
+		cmd = exec.Command(imageEncoders[format], "-quiet", "-q", quality, in, "-o", out)
+	} else {
+		cmd = exec.Command(imageEncoders[format], "-q", quality, in, out)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", cmd.Args[0], err, strings.TrimSpace(string(output)))
+	}
+	return os.ReadFile(out)
+}
+
+// fitImage は幅と高さを上限に収まるよう、縦横比を保って縮小した大きさを返します（拡大はしない。0 は上限なし）
+func fitImage(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = min(scale, float64(maxWidth)/float64(width))
+	}
+	if maxHeight > 0 && height > maxHeight {
+		scale = min(scale, float64(maxHeight)/float64(height))
+	}
+	if scale == 1 {
+		return width, height
+	}
+	return max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5))
+}
+
+// summary は縮小・変換した画像の数と、合計の大きさの変化を返します。何もしなければ空
+func (o *imageOptimizer) summary() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("optimized %d images: %d KB -> %d KB", o.count, (o.before+999)/1000, (o.after+999)/1000)
+}
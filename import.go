@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+// runImport creates a Notion page from a Markdown file, or appends the file
+// to an existing page, so that content can make the round trip back into
+// Notion.
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	parent := fs.String("parent", "", "create a new page under this page")
+	appendTo := fs.String("append", "", "append the blocks to this existing page or block instead of creating a page")
+	title := fs.String("title", "", "title of the new page (default: the leading # heading, or the file name)")
+	dryRun := fs.Bool("dry-run", false, "print the Notion API requests that would create the page or append the blocks instead of sending them")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs import (--parent <page-id> | --append <page-id>) [flags] <file.md|->")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() != 1 || (*parent == "") == (*appendTo == "") {
+		fs.Usage()
+		exit(1)
+	}
+	if *appendTo != "" && *title != "" {
+		fatal("--title can only be used with --parent")
+	}
+
+	file := fs.Arg(0)
+	data, err := readInputFile(file)
+	if err != nil {
+		fatalf("Error reading Markdown: %v", err)
+	}
+	blocks := parseMarkdown(string(data))
+
+	if *dryRun {
+		enableDryRun()
+	}
+	ctx := context.Background()
+	client := newNotionClient()
+	if *appendTo != "" {
+		if _, err := appendBlockTree(ctx, client, notionapi.BlockID(formatPageID(*appendTo)), "", blocks); err != nil {
+			exitWithNotionError("Error appending blocks", err)
+		}
+		log.Printf("appended %d blocks", len(blocks))
+		return
+	}
+
+	if *title == "" {
+		// 先頭が見出し1ならページのタイトルにする
+		if h, ok := firstBlock(blocks).(*notionapi.Heading1Block); ok {
+			*title = richTextContent(h.Heading1.RichText)
+			blocks = blocks[1:]
+		} else if file != "-" {
+			*title = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+	}
+	page, err := createChildPage(ctx, client, notionapi.PageID(formatPageID(*parent)), *title)
+	if err != nil {
+		exitWithNotionError("Error creating page", err)
+	}
+	if _, err := appendBlockTree(ctx, client, notionapi.BlockID(page.ID), "", blocks); err != nil {
+		exitWithNotionError("Error appending blocks", err)
+	}
+	fmt.Println(page.URL)
+}
+
+// readInputFile はファイルを読み込みます。"-" の場合は標準入力から読み込む
+func readInputFile(file string) ([]byte, error) {
+	if file == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(file)
+}
+
+func firstBlock(blocks []notionapi.Block) notionapi.Block {
+	if len(blocks) == 0 {
+		return nil
+	}
+	return blocks[0]
+}
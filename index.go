@@ -0,0 +1,651 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/token/porter"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"github.com/jomei/notionapi"
+)
+
+// searchIndexVersion は索引の形式（マッピングとアナライザー）のバージョン。形式を変えたら上げ、古い索引は作り直してもらう
+const searchIndexVersion = 2
+
+// searchIndexVersionKey は索引のバージョンを保存する内部のキー
+var searchIndexVersionKey = []byte("notion-dfs-version")
+
+// titleBoost はタイトルと見出しでの一致を本文の何倍に数えるか
+const titleBoost = 3
+
+// searchAnalyzer is the analyzer of the indexed text: words are lowercased
+// and stemmed (Porter) so that "release" also finds "released" and
+// "releases", and Japanese, Chinese or Korean text, which is not separated
+// by spaces, is split into overlapping pairs of characters (bigrams) so that
+// any word of two or more characters can be found.
+const searchAnalyzer = "notion_text"
+
+// localPage is an exported or snapshotted page read back from disk, split
+// into sections at its headings.
+type localPage struct {
+	Path string
+	// PageID はファイル名やスナップショットのディレクトリから分かるページID（分からなければ空）
+	PageID   string
+	Title    string
+	Sections []localSection
+}
+
+// localSection はページの見出しから次の見出しまで。Heading はページの先頭では空
+type localSection struct {
+	Heading string
+	Text    string
+}
+
+// searchIndex is the local full-text index written by `index` and read by
+// `query`: a bleve index with one document per section.
+type searchIndex struct {
+	index bleve.Index
+}
+
+// indexDoc は索引の文書（ページのセクション1つ）。フィールド名は json のタグ
+type indexDoc struct {
+	Path    string `json:"path"`
+	PageID  string `json:"page_id,omitempty"`
+	Title   string `json:"title"`
+	Heading string `json:"heading,omitempty"`
+	Text    string `json:"text"`
+}
+
+// searchFields は検索するフィールドと、その一致の重み
+var searchFields = []struct {
+	name  string
+	boost float64
+}{{"title", titleBoost}, {"heading", titleBoost}, {"text", 1}}
+
+// defaultSearchIndexPath はキャッシュディレクトリの索引（bleve のディレクトリ）
+func defaultSearchIndexPath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "search-index.bleve"), nil
+}
+
+// runIndex builds the local full-text index from Markdown files exported by
+// the main command, backup or a site preset, and from the latest snapshot of
+// every page in the snapshot store, for fast offline search with `query`.
+// The index is rebuilt from scratch on every run.
+func runIndex(args []string) {
+	fs := flag.NewFlagSet("index", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	indexPath := fs.String("index", "", "index directory to write (default: search-index.bleve in the cache directory)")
+	noSnapshots := fs.Bool("no-snapshots", false, "do not index the latest snapshot of each page")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs index [--index dir] [--no-snapshots] [<dir-or-file>...]")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	if fs.NArg() == 0 && *noSnapshots {
+		fs.Usage()
+		exit(1)
+	}
+	if *indexPath == "" {
+		path, err := defaultSearchIndexPath()
+		if err != nil {
+			fatal(err)
+		}
+		*indexPath = path
+	}
+
+	pages, err := loadLocalPages(fs.Args(), !*noSnapshots)
+	if err != nil {
+		fatalf("Error reading pages: %v", err)
+	}
+	sections, err := writeSearchIndex(*indexPath, pages)
+	if err != nil {
+		fatalf("Error writing index: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "indexed %d pages (%d sections) into %s\n", len(pages), sections, *indexPath)
+}
+
+// loadLocalPages は Markdown ファイル（ディレクトリは再帰的に *.md を探す）と、snapshots ならスナップショットの最新版を読み込みます
+func loadLocalPages(paths []string, snapshots bool) ([]localPage, error) {
+	var pages []localPage
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				// .git などの隠しディレクトリは調べない
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.EqualFold(filepath.Ext(path), ".md") {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			pages = append(pages, parseLocalPage(path, pageIDFromFileName(path), name, string(data)))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !snapshots {
+		return pages, nil
+	}
+
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "snapshots"))
+	if errors.Is(err, os.ErrNotExist) {
+		return pages, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		store := &snapshotStore{dir: filepath.Join(dir, "snapshots", e.Name())}
+		snap, err := store.latest()
+		if err != nil {
+			return nil, err
+		}
+		if snap == nil {
+			continue
+		}
+		content, err := store.read(snap)
+		if err != nil {
+			return nil, err
+		}
+		// スナップショットにはページのタイトルがないため、ページIDを表示する
+		pageID := formatPageID(e.Name())
+		pages = append(pages, parseLocalPage(snap.path, pageID, pageID, content))
+	}
+	return pages, nil
+}
+
+// fileNamePageID はファイル名の末尾のページID（"<ID>.md"、"Title-<ID>.md" など）にマッチします
+var fileNamePageID = regexp.MustCompile(`(?:^|[-_ ])([0-9a-f]{32})$`)
+
+// pageIDFromFileName はファイル名からページIDを返します（バックアップのファイル名など）。分からなければ空
+func pageIDFromFileName(path string) string {
+	m := fileNamePageID.FindStringSubmatch(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	if m == nil {
+		return ""
+	}
+	return formatPageID(m[1])
+}
+
+// parseLocalPage splits a Markdown document into sections at its headings.
+// The title is the title of the front matter, or a leading # heading as
+// written by backup, or fallbackTitle. Markup is removed so that only the
+// text is indexed.
+func parseLocalPage(path, pageID, fallbackTitle, src string) localPage {
+	page := localPage{Path: path, PageID: pageID}
+	src, page.Title = stripFrontMatter(strings.ReplaceAll(src, "\r\n", "\n"))
+	blocks := parseMarkdown(src)
+	if h, ok := firstBlock(blocks).(*notionapi.Heading1Block); ok && page.Title == "" {
+		page.Title = richTextContent(h.Heading1.RichText)
+	}
+	if page.Title == "" {
+		page.Title = fallbackTitle
+	}
+
+	section := localSection{}
+	var text []string
+	flush := func() {
+		section.Text = strings.Join(text, "\n")
+		if section.Heading != "" || strings.TrimSpace(section.Text) != "" {
+			page.Sections = append(page.Sections, section)
+		}
+		text = nil
+	}
+	var walk func(blocks []notionapi.Block)
+	walk = func(blocks []notionapi.Block) {
+		for _, block := range blocks {
+			if headingLevel(block) > 0 {
+				flush()
+				section = localSection{Heading: localBlockText(block)}
+				continue
+			}
+			if t := localBlockText(block); t != "" {
+				text = append(text, t)
+			}
+			if children := blockChildren(block); children != nil {
+				walk(*children)
+			}
+		}
+	}
+	walk(blocks)
+	flush()
+	return page
+}
+
+// localBlockText は読み込んだ Markdown のブロックのテキストです（表のセル・コードを含む）。
+// 送信前のブロックと同じく plain_text がないため、richTextContent で連結する
+func localBlockText(block notionapi.Block) string {
+	var parts []string
+	switch b := block.(type) {
+	case *notionapi.CodeBlock:
+		parts = append(parts, richTextContent(b.Code.RichText))
+	case *notionapi.ImageBlock:
+		parts = append(parts, richTextContent(b.Image.Caption))
+	case *notionapi.TableBlock:
+		for _, row := range b.Table.Children {
+			parts = append(parts, localBlockText(row))
+		}
+	}
+	for _, rt := range blockRichTexts(block) {
+		parts = append(parts, richTextContent(rt))
+	}
+	return strings.TrimSpace(strings.Join(parts, " "))
+}
+
+// stripFrontMatter は先頭の YAML（---）または TOML（+++）のフロントマターを取り除き、title の値を返します
+func stripFrontMatter(src string) (string, string) {
+	for _, delim := range []string{"---", "+++"} {
+		if !strings.HasPrefix(src, delim+"\n") {
+			continue
+		}
+		end := strings.Index(src[len(delim)+1:], "\n"+delim+"\n")
+		if end < 0 {
+			continue
+		}
+		header := src[len(delim)+1 : len(delim)+1+end]
+		title := ""
+		for _, line := range strings.Split(header, "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				key, value, ok = strings.Cut(line, "=")
+			}
+			if ok && strings.TrimSpace(key) == "title" {
+				title = strings.Trim(strings.TrimSpace(value), `"'`)
+				break
+			}
+		}
+		return src[len(delim)+1+end+len(delim)+2:], title
+	}
+	return src, ""
+}
+
+// newSearchMapping は索引のマッピングです。タイトル・見出し・本文は searchAnalyzer で語に分け、
+// 位置も保存してフレーズの検索に使う。パスとページIDは分けずにそのまま保存する
+func newSearchMapping() (mapping.IndexMapping, error) {
+	m := bleve.NewIndexMapping()
+	err := m.AddCustomAnalyzer(searchAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{cjk.WidthName, lowercase.Name, en.PossessiveName, cjk.BigramName, porter.Name},
+	})
+	if err != nil {
+		return nil, err
+	}
+	text := bleve.NewTextFieldMapping()
+	text.Analyzer = searchAnalyzer
+	keyword := bleve.NewKeywordFieldMapping()
+	keyword.IncludeInAll = false
+
+	doc := bleve.NewDocumentStaticMapping()
+	for _, f := range searchFields {
+		doc.AddFieldMappingsAt(f.name, text)
+	}
+	doc.AddFieldMappingsAt("path", keyword)
+	doc.AddFieldMappingsAt("page_id", keyword)
+	m.DefaultMapping = doc
+	m.DefaultAnalyzer = searchAnalyzer
+	return m, nil
+}
+
+// writeSearchIndex indexes every section of pages into a new bleve index at
+// path and returns the number of sections. The index is built next to path
+// and then replaces it, so that a failed run leaves the previous index.
+func writeSearchIndex(path string, pages []localPage) (int, error) {
+	m, err := newSearchMapping()
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	tmp := path + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return 0, err
+	}
+	index, err := bleve.New(tmp, m)
+	if err != nil {
+		return 0, err
+	}
+	sections, err := indexPages(index, pages)
+	if err == nil {
+		err = index.SetInternal(searchIndexVersionKey, []byte(strconv.Itoa(searchIndexVersion)))
+	}
+	if closeErr := index.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		return 0, err
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return 0, err
+	}
+	return sections, os.Rename(tmp, path)
+}
+
+// indexBatchSize は一度に索引へ書き込む文書の数
+const indexBatchSize = 500
+
+// indexPages はページのセクションを1つずつ文書にして索引に入れます
+func indexPages(index bleve.Index, pages []localPage) (int, error) {
+	batch := index.NewBatch()
+	sections := 0
+	for _, page := range pages {
+		for i, section := range page.Sections {
+			doc := indexDoc{Path: page.Path, PageID: page.PageID, Title: page.Title, Heading: section.Heading, Text: section.Text}
+			if err := batch.Index(page.Path+"#"+strconv.Itoa(i), doc); err != nil {
+				return 0, err
+			}
+			sections++
+			if batch.Size() >= indexBatchSize {
+				if err := index.Batch(batch); err != nil {
+					return 0, err
+				}
+				batch.Reset()
+			}
+		}
+	}
+	return sections, index.Batch(batch)
+}
+
+// openSearchIndex は索引を読み取り専用で開きます
+func openSearchIndex(path string) (*searchIndex, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no index at %s (run `notion-dfs index` first)", path)
+	}
+	index, err := bleve.OpenUsing(path, map[string]interface{}{"read_only": true})
+	if err != nil {
+		return nil, err
+	}
+	version, err := index.GetInternal(searchIndexVersionKey)
+	if err != nil {
+		index.Close()
+		return nil, err
+	}
+	if string(version) != strconv.Itoa(searchIndexVersion) {
+		index.Close()
+		return nil, fmt.Errorf("the index at %s was built by another version (run `notion-dfs index` again)", path)
+	}
+	return &searchIndex{index: index}, nil
+}
+
+func (s *searchIndex) close() error {
+	return s.index.Close()
+}
+
+// writeGzipJSON は v を gzip で圧縮したJSONとして書き出します。
+// 書き込みの途中で失敗しても以前のファイルが残るよう、一時ファイルに書いてから置き換える
+func writeGzipJSON(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	if err := json.NewEncoder(zw).Encode(v); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readGzipJSON(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(zr).Decode(v)
+}
+
+// searchHit は検索結果の1件
+type searchHit struct {
+	Path    string  `json:"path"`
+	PageID  string  `json:"page_id,omitempty"`
+	URL     string  `json:"url,omitempty"`
+	Title   string  `json:"title"`
+	Heading string  `json:"heading,omitempty"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+// search returns the sections that contain every word of the query,
+// ranked by relevance, with matches in the title or heading counting more.
+// Words are matched after stemming, so other forms of a word also match;
+// phrases in double quotes must appear with their words in order.
+func (s *searchIndex) search(q string, limit int) ([]searchHit, error) {
+	sq := s.query(q)
+	if sq == nil {
+		return nil, nil
+	}
+	size := limit
+	if size <= 0 {
+		count, err := s.index.DocCount()
+		if err != nil {
+			return nil, err
+		}
+		size = int(count)
+	}
+	req := bleve.NewSearchRequestOptions(sq, size, 0, false)
+	req.Fields = []string{"path", "page_id", "title", "heading", "text"}
+	req.IncludeLocations = true
+	req.SortBy([]string{"-_score", "path"})
+	res, err := s.index.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []searchHit
+	for _, h := range res.Hits {
+		field := func(name string) string {
+			v, _ := h.Fields[name].(string)
+			return v
+		}
+		hit := searchHit{Path: field("path"), PageID: field("page_id"), Title: field("title"), Heading: field("heading"), Score: math.Round(h.Score*1000) / 1000}
+		// 本文で最初に一致した位置の前後を表示する
+		at := -1
+		for _, locations := range h.Locations["text"] {
+			for _, l := range locations {
+				if at < 0 || int(l.Start) < at {
+					at = int(l.Start)
+				}
+			}
+		}
+		hit.Snippet = searchSnippet(field("text"), max(at, 0))
+		if hit.PageID != "" {
+			hit.URL = "https://www.notion.so/" + compactPageID(hit.PageID)
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// query builds the bleve query for a search: every word and every phrase
+// in double quotes must match in one of the fields. Words that contain no
+// searchable text, such as punctuation, are ignored; nil means nothing is
+// left to search for.
+func (s *searchIndex) query(q string) query.Query {
+	analyzer := s.index.Mapping().AnalyzerNamed(searchAnalyzer)
+	var clauses []query.Query
+	for i, part := range strings.Split(q, `"`) {
+		// 引用符の内側（奇数番目）がフレーズ
+		if i%2 == 1 {
+			if phrase := strings.TrimSpace(part); len(analyzer.Analyze([]byte(phrase))) > 0 {
+				clauses = append(clauses, anyField(func() fieldQuery { return bleve.NewMatchPhraseQuery(phrase) }))
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if len(analyzer.Analyze([]byte(word))) == 0 {
+				continue
+			}
+			clauses = append(clauses, anyField(func() fieldQuery {
+				// 日本語などの語は2文字ずつの組に分かれるため、そのすべてを含む必要がある
+				m := bleve.NewMatchQuery(word)
+				m.SetOperator(query.MatchQueryOperatorAnd)
+				return m
+			}))
+		}
+	}
+	if len(clauses) == 0 {
+		return nil
+	}
+	return bleve.NewConjunctionQuery(clauses...)
+}
+
+// fieldQuery はフィールドと重みを指定できるクエリ（語とフレーズのクエリ）
+type fieldQuery interface {
+	query.FieldableQuery
+	SetBoost(b float64)
+}
+
+// anyField は newQuery のクエリをいずれかのフィールドで一致させ、searchFields の重みを付けます
+func anyField(newQuery func() fieldQuery) query.Query {
+	var queries []query.Query
+	for _, f := range searchFields {
+		q := newQuery()
+		q.SetField(f.name)
+		q.SetBoost(f.boost)
+		queries = append(queries, q)
+	}
+	return bleve.NewDisjunctionQuery(queries...)
+}
+
+// searchSnippetWidth は検索結果に表示する本文の前後の文字数
+const searchSnippetWidth = 40
+
+// searchSnippet は本文の at バイト目（一致した語の位置）の前後を1行にして返します
+func searchSnippet(text string, at int) string {
+	if at > len(text) {
+		at = 0
+	}
+	runes := []rune(text)
+	// 位置を文字の単位にして切り出し、改行や連続した空白を1つの空白にする
+	pos := len([]rune(text[:at]))
+	start := max(0, pos-searchSnippetWidth)
+	end := min(len(runes), pos+2*searchSnippetWidth)
+	snippet := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// runQuery searches the local index built by `index` and prints the best
+// matching sections, without calling the Notion API.
+func runQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	indexPath := fs.String("index", "", "index directory to search (default: search-index.bleve in the cache directory)")
+	limit := fs.Int("limit", 10, "maximum number of results (0 = all)")
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs query [--index dir] [--limit 10] [--json] <query>...")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	if fs.NArg() == 0 {
+		fs.Usage()
+		exit(1)
+	}
+	if *indexPath == "" {
+		path, err := defaultSearchIndexPath()
+		if err != nil {
+			fatal(err)
+		}
+		*indexPath = path
+	}
+
+	index, err := openSearchIndex(*indexPath)
+	if err != nil {
+		fatalf("Error reading index: %v", err)
+	}
+	hits, err := index.search(strings.Join(fs.Args(), " "), *limit)
+	index.close()
+	if err != nil {
+		fatalf("Error searching index: %v", err)
+	}
+	if *asJSON {
+		if hits == nil {
+			hits = []searchHit{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(hits); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if len(hits) == 0 {
+		fmt.Println("no matches")
+		exit(1)
+	}
+	for _, hit := range hits {
+		title := hit.Title
+		if hit.Heading != "" && hit.Heading != hit.Title {
+			title += " › " + hit.Heading
+		}
+		fmt.Printf("%6.2f  %s\n", hit.Score, title)
+		fmt.Printf("        %s\n", hit.Path)
+		if hit.URL != "" {
+			fmt.Printf("        %s\n", hit.URL)
+		}
+		if hit.Snippet != "" {
+			fmt.Printf("        %s\n", hit.Snippet)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSearchIndex(t *testing.T) {
+	pages := []localPage{
+		parseLocalPage("weekly.md", "0123456789abcdef0123456789abcdef", "weekly", "# 週次レポート\n\n## 予算\n\n今期の予算は議事録のとおり承認されました。\n\n## Release notes\n\nWe released the new search engine.\n"),
+		parseLocalPage("other.md", "", "other", "# Other page\n\nSome notes on the release of the budget. 東京都の天気\n"),
+	}
+	path := filepath.Join(t.TempDir(), "index")
+	sections, err := writeSearchIndex(path, pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sections != 4 {
+		t.Errorf("writeSearchIndex() = %d sections, want 4", sections)
+	}
+	index, err := openSearchIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.close()
+
+	tests := []struct {
+		query string
+		// want は一致するセクションの見出し（ページの先頭はタイトル）を順位の順に並べたもの
+		want []string
+	}{
+		{"予算 議事録", []string{"予算"}},
+		{"東京", []string{"Other page"}},
+		{"京都", []string{"Other page"}},
+		{"大阪", nil},
+		// 語幹で比べるため、語形が違っても一致する
+		{"releasing", []string{"Release notes", "Other page"}},
+		{"budgets", []string{"Other page"}},
+		// 見出しでの一致は本文より上になる
+		{"notes", []string{"Release notes", "Other page"}},
+		{`"release notes"`, []string{"Release notes"}},
+		{`"notes release"`, nil},
+		{`"search engine" released`, []string{"Release notes"}},
+		{"!!!", nil},
+	}
+	for _, tt := range tests {
+		hits, err := index.search(tt.query, 0)
+		if err != nil {
+			t.Errorf("search(%q): %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for _, hit := range hits {
+			heading := hit.Heading
+			if heading == "" {
+				heading = hit.Title
+			}
+			got = append(got, heading)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	hits, err := index.search("予算", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].URL != "https://www.notion.so/0123456789abcdef0123456789abcdef" || hits[0].Snippet != "今期の予算は議事録のとおり承認されました。" {
+		t.Errorf("search(%q, 1) = %+v", "予算", hits)
+	}
+}
+
+func TestOpenSearchIndexMissing(t *testing.T) {
+	if _, err := openSearchIndex(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("openSearchIndex() of a missing index succeeded")
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	long := "aaaaaaaaaa bbbbbbbbbb cccccccccc dddddddddd eeeeeeeeee ffffffffff gggggggggg hhhhhhhhhh"
+	tests := []struct {
+		text string
+		at   int
+		want string
+	}{
+		{"short text", 0, "short text"},
+		{"line one\nline  two", 5, "line one line two"},
+		{long, 0, long[:80] + "…"},
+		{long, 66, "…" + long[26:]},
+		{long, 50, "…" + long[11:]},
+		{"日本語の本文", len("日本語の"), "日本語の本文"},
+		{"text", 100, "text"},
+	}
+	for _, tt := range tests {
+		if got := searchSnippet(tt.text, tt.at); got != tt.want {
+			t.Errorf("searchSnippet(%q, %d) = %q, want %q", tt.text, tt.at, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+// 資格情報マネージャーは Windows でのみ使う（keychain_windows.go）
+
+func credentialManagerGet(account string) (string, error) {
+	return "", errKeychainUnsupported
+}
+
+func credentialManagerSet(account, label, secret string) error {
+	return errKeychainUnsupported
+}
+
+func credentialManagerDelete(account string) error {
+	return errKeychainUnsupported
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// linksCheckConcurrency は --check で同時に確かめる外部リンクの数
+const linksCheckConcurrency = 8
+
+// pageLink はページ内のリンク1つ。同じリンクが複数のブロックにある場合は1つにまとめる
+type pageLink struct {
+	// Kind は external（外部のURL）・page（ページへのリンク）・database（データベースへのリンク）
+	Kind string `json:"kind"`
+	// Target は外部のURL、またはリンク先のページ・データベースのID
+	Target string `json:"target"`
+	// Text はリンクのテキスト（最初に見つかったもの）
+	Text   string              `json:"text,omitempty"`
+	Blocks []notionapi.BlockID `json:"blocks"`
+	// Status は --check の結果。外部リンクはHTTPのステータス、内部リンクは ok か取得のエラー
+	Status string `json:"status,omitempty"`
+	Broken bool   `json:"broken,omitempty"`
+}
+
+// linksReport は links の結果
+type linksReport struct {
+	Page    notionapi.BlockID `json:"page"`
+	Title   string            `json:"title"`
+	Links   []*pageLink       `json:"links"`
+	Checked bool              `json:"checked"`
+	Broken  int               `json:"broken"`
+}
+
+// runLinks lists the external URLs and the links to other Notion pages and
+// databases found in a page: rich text links and mentions, bookmarks, embeds
+// and "link to page" blocks. With --check it requests each external URL and
+// fetches each linked page, and exits with status 1 when any link is broken,
+// so that it can keep a wiki free of dead links from a scheduled job.
+func runLinks(args []string) {
+	fs := flag.NewFlagSet("links", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	check := fs.Bool("check", false, "check that external links respond and linked pages are accessible")
+	brokenOnly := fs.Bool("broken-only", false, "with --check, list only the broken links")
+	timeout := fs.Duration("timeout", 15*time.Second, "timeout for each external link check")
+	asJSON := fs.Bool("json", false, "print the links as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs links [--check [--broken-only]] [--json] <page-id>")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(1)
+	}
+	if *brokenOnly && !*check {
+		fatal("--broken-only requires --check")
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	pageID := notionapi.BlockID(formatPageID(fs.Arg(0)))
+	page, err := client.Page.Get(ctx, notionapi.PageID(pageID))
+	if err != nil {
+		exitWithNotionError("Error fetching page", err)
+	}
+	tree, err := fetchPageTree(ctx, client, pageID, fetchLimits{})
+	if err != nil {
+		exitWithNotionError("Error fetching blocks", err)
+	}
+
+	report := linksReport{Page: pageID, Title: propertyTitle(page), Links: collectLinks(tree)}
+	if *check {
+		checkLinks(ctx, client, report.Links, &http.Client{Transport: defaultTransport, Timeout: *timeout})
+		report.Checked = true
+		for _, link := range report.Links {
+			if link.Broken {
+				report.Broken++
+			}
+		}
+		if *brokenOnly {
+			broken := []*pageLink{}
+			for _, link := range report.Links {
+				if link.Broken {
+					broken = append(broken, link)
+				}
+			}
+			report.Links = broken
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fatal(err)
+		}
+	} else {
+		writeLinksReport(report)
+	}
+	if report.Broken > 0 {
+		exit(1)
+	}
+}
+
+// collectLinks はページのツリーからリンクを文書の順に集めます
+func collectLinks(tree *PageTree) []*pageLink {
+	links := []*pageLink{}
+	found := make(map[[2]string]*pageLink)
+	add := func(kind, target, text string, block notionapi.BlockID) {
+		link, ok := found[[2]string{kind, target}]
+		if !ok {
+			link = &pageLink{Kind: kind, Target: target, Text: strings.TrimSpace(text)}
+			found[[2]string{kind, target}] = link
+			links = append(links, link)
+		}
+		if len(link.Blocks) == 0 || link.Blocks[len(link.Blocks)-1] != block {
+			link.Blocks = append(link.Blocks, block)
+		}
+	}
+	addURL := func(rawURL, text string, block notionapi.BlockID) {
+		if id, ok := renderer.LinkedPageID(notionapi.RichText{Text: &notionapi.Text{Link: &notionapi.Link{Url: rawURL}}}); ok {
+			add("page", formatPageID(id), text, block)
+		} else if isExternalURL(rawURL) {
+			add("external", rawURL, text, block)
+		}
+	}
+
+	var walk func(nodes []*BlockNode)
+	walk = func(nodes []*BlockNode) {
+		for _, node := range nodes {
+			id := node.Block.GetID()
+			texts := blockRichTexts(node.Block)
+			switch b := node.Block.(type) {
+			case *notionapi.BookmarkBlock:
+				addURL(b.Bookmark.URL, renderer.PlainText(b.Bookmark.Caption), id)
+			case *notionapi.EmbedBlock:
+				addURL(b.Embed.URL, renderer.PlainText(b.Embed.Caption), id)
+			case *notionapi.LinkPreviewBlock:
+				addURL(b.LinkPreview.URL, "", id)
+			case *notionapi.LinkToPageBlock:
+				if b.LinkToPage.PageID != "" {
+					add("page", string(b.LinkToPage.PageID), "", id)
+				} else if b.LinkToPage.DatabaseID != "" {
+					add("database", string(b.LinkToPage.DatabaseID), "", id)
+				}
+			case *notionapi.ImageBlock:
+				texts = append(texts, b.Image.Caption)
+			case *notionapi.CodeBlock:
+				texts = append(texts, b.Code.Caption)
+			}
+			for _, rt := range texts {
+				for _, text := range rt {
+					switch {
+					case text.Mention != nil && text.Mention.Type == "database" && text.Mention.Database != nil:
+						add("database", string(text.Mention.Database.ID), text.PlainText, id)
+					case text.Mention != nil && text.Mention.Type == "page" && text.Mention.Page != nil:
+						add("page", string(text.Mention.Page.ID), text.PlainText, id)
+					case text.Mention != nil:
+						// ユーザーや日付のメンションはリンクではない
+					case text.Text != nil && text.Text.Link != nil:
+						addURL(text.Text.Link.Url, text.PlainText, id)
+					}
+				}
+			}
+			walk(node.Children)
+		}
+	}
+	walk(tree.Root.Children)
+	return links
+}
+
+// isExternalURL は http・https・mailto などスキームのある絶対URLかを返します。"/<id>" のような Notion 内の相対リンクは含まない
+func isExternalURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "")
+}
+
+// checkLinks fills in the status of each link: external http and https links
+// are requested (HEAD, then GET for servers that do not support HEAD) and
+// linked pages and databases are fetched with the integration's token, so a
+// page that exists but is not shared with the integration is reported too.
+func checkLinks(ctx context.Context, client *notionapi.Client, links []*pageLink, httpClient *http.Client) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, linksCheckConcurrency)
+	for _, link := range links {
+		if link.Kind != "external" {
+			// Notion API のレート制限があるため、内部リンクは順に確かめる
+			checkNotionLink(ctx, client, link)
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(link *pageLink) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			checkExternalLink(ctx, httpClient, link)
+		}(link)
+	}
+	wg.Wait()
+}
+
+func checkNotionLink(ctx context.Context, client *notionapi.Client, link *pageLink) {
+	var err error
+	if link.Kind == "database" {
+		_, err = client.Database.Get(ctx, notionapi.DatabaseID(link.Target))
+	} else {
+		_, err = client.Page.Get(ctx, notionapi.PageID(link.Target))
+	}
+	if err == nil {
+		link.Status = "ok"
+		return
+	}
+	link.Broken = true
+	var apiErr *notionapi.Error
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Code == errCodeObjectNotFound:
+		link.Status = "not found or not shared with the integration"
+	case errors.As(err, &apiErr) && apiErr.Code == errCodeRestrictedResource:
+		link.Status = "restricted"
+	default:
+		link.Status = err.Error()
+	}
+}
+
+func checkExternalLink(ctx context.Context, client *http.Client, link *pageLink) {
+	u, _ := url.Parse(link.Target)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		link.Status = "skipped (" + u.Scheme + ")"
+		return
+	}
+	status, err := requestStatus(ctx, client, http.MethodHead, link.Target)
+	// HEAD に対応していないサーバーや、HEAD を拒否するサーバーがあるため GET で確かめ直す
+	if err != nil || status >= 400 {
+		status, err = requestStatus(ctx, client, http.MethodGet, link.Target)
+	}
+	if err != nil {
+		link.Status = err.Error()
+		link.Broken = true
+		return
+	}
+	link.Status = fmt.Sprintf("%d %s", status, http.StatusText(status))
+	// 401・403 はログインが必要なページのことが多く、リンク切れとは限らないため、リンク切れとして数えない
+	link.Broken = status >= 400 && status != http.StatusUnauthorized && status != http.StatusForbidden
+}
+
+// requestStatus はURLにリクエストし、リダイレクトをたどった後のステータスコードを返します
+func requestStatus(ctx context.Context, client *http.Client, method, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "notion-dfs-links")
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return 0, urlErr.Err
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+func writeLinksReport(report linksReport) {
+	fmt.Printf("page: %s (%s)\n", report.Title, report.Page)
+	headings := map[string]string{
+		"external": "external links:",
+		"page":     "links to pages:",
+		"database": "links to databases:",
+	}
+	for _, kind := range []string{"external", "page", "database"} {
+		var links []*pageLink
+		for _, link := range report.Links {
+			if link.Kind == kind {
+				links = append(links, link)
+			}
+		}
+		if len(links) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s\n", headings[kind])
+		for _, link := range links {
+			line := "  "
+			if report.Checked {
+				mark := "✓"
+				if link.Broken {
+					mark = "✗"
+				}
+				line += mark + " "
+			}
+			line += link.Target
+			if link.Text != "" && link.Text != link.Target {
+				line += "  " + link.Text
+			}
+			if report.Checked {
+				line += "  [" + link.Status + "]"
+			}
+			if link.Broken || !report.Checked {
+				line += fmt.Sprintf("  (block %s", link.Blocks[0])
+				if len(link.Blocks) > 1 {
+					line += fmt.Sprintf(" and %d more", len(link.Blocks)-1)
+				}
+				line += ")"
+			}
+			fmt.Println(line)
+		}
+	}
+	if len(report.Links) == 0 && !report.Checked {
+		fmt.Println("\nno links")
+	}
+	if report.Checked {
+		if report.Broken == 0 {
+			fmt.Println("\n✓ no broken links")
+		} else {
+			fmt.Printf("\n✗ %d broken link(s)\n", report.Broken)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// renderedBlockTypes はすべての出力形式で出力されるブロックの種類。
+// 表の行とカラムは、表とカラムのリストの一部として出力される
+var renderedBlockTypes = map[notionapi.BlockType]bool{
+	notionapi.BlockTypeParagraph: true, notionapi.BlockTypeHeading1: true, notionapi.BlockTypeHeading2: true,
+	notionapi.BlockTypeHeading3: true, notionapi.BlockTypeBulletedListItem: true, notionapi.BlockTypeNumberedListItem: true,
+	notionapi.BlockTypeToDo: true, notionapi.BlockTypeImage: true, notionapi.BlockTypeCode: true,
+	notionapi.BlockQuote: true, notionapi.BlockCallout: true, notionapi.BlockTypeDivider: true,
+	notionapi.BlockTypeToggle: true, notionapi.BlockTypeTableBlock: true, notionapi.BlockTypeTableRowBlock: true,
+	notionapi.BlockTypeChildPage: true, notionapi.BlockTypeColumnList: true, notionapi.BlockTypeColumn: true,
+}
+
+// renderedTextFeatures は出力形式ごとに出力されるリッチテキストの装飾とリンク。
+// ここにない装飾はテキストだけが出力される
+var renderedTextFeatures = map[string][]string{
+	"markdown":   {"bold", "italic", "strikethrough", "code", "link"},
+	"asciidoc":   {"bold", "italic", "strikethrough", "underline", "code", "link"},
+	"rst":        {"bold", "italic", "code", "link"},
+	"slack":      {"bold", "italic", "strikethrough", "code", "link"},
+	"confluence": {"bold", "italic", "strikethrough", "underline", "code", "link", "color"},
+	"pdf":        {},
+	"epub":       {"bold", "italic", "strikethrough", "underline", "code", "link", "color"},
+	"docx":       {"bold", "italic", "strikethrough", "underline", "code", "link"},
+}
+
+// lintFinding は出力されない機能1つと、それを使っているブロック
+type lintFinding struct {
+	Kind    string              `json:"kind"`
+	Feature string              `json:"feature"`
+	Count   int                 `json:"count"`
+	Blocks  []notionapi.BlockID `json:"blocks,omitempty"`
+}
+
+// lintReport は lint の結果
+type lintReport struct {
+	Page     notionapi.BlockID `json:"page"`
+	Title    string            `json:"title"`
+	Format   string            `json:"format"`
+	Blocks   int               `json:"blocks"`
+	Findings []lintFinding     `json:"findings"`
+}
+
+// runLint walks a page and reports the block types, rich text features and
+// properties that the renderer for the given format does not output, so that
+// users know what will be lost before exporting. It exits with status 1 when
+// anything would be lost.
+func runLint(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	format := fs.String("format", "markdown", "output format to check against: markdown, asciidoc, rst, slack, confluence, pdf, epub or docx")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs lint [--format markdown] [--json] <page-id>")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(1)
+	}
+	if _, ok := renderedTextFeatures[*format]; !ok {
+		fatalf("unknown format: %s", *format)
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	pageID := notionapi.BlockID(formatPageID(fs.Arg(0)))
+	page, err := client.Page.Get(ctx, notionapi.PageID(pageID))
+	if err != nil {
+		exitWithNotionError("Error fetching page", err)
+	}
+	tree, err := fetchPageTree(ctx, client, pageID, fetchLimits{})
+	if err != nil {
+		exitWithNotionError("Error fetching blocks", err)
+	}
+
+	report := lintPage(page, tree, *format)
+	report.Page = pageID
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fatal(err)
+		}
+	} else {
+		writeLintReport(report)
+	}
+	if len(report.Findings) > 0 {
+		exit(1)
+	}
+}
+
+// lintPage はページのツリーを調べ、出力されない機能を種類ごとに数えます
+func lintPage(page *notionapi.Page, tree *PageTree, format string) lintReport {
+	// RegisterBlockHandler で登録されたブロックはMarkdownでは出力される
+	markdown := format == "markdown"
+	textFeatures := renderedTextFeatures[format]
+	rendered := make(map[string]bool)
+	for _, f := range textFeatures {
+		rendered[f] = true
+	}
+	report := lintReport{Title: propertyTitle(page), Format: format, Findings: []lintFinding{}}
+	found := make(map[[2]string]*lintFinding)
+	add := func(kind, feature string, block notionapi.BlockID) {
+		f, ok := found[[2]string{kind, feature}]
+		if !ok {
+			f = &lintFinding{Kind: kind, Feature: feature}
+			found[[2]string{kind, feature}] = f
+		}
+		f.Count++
+		if block != "" && (len(f.Blocks) == 0 || f.Blocks[len(f.Blocks)-1] != block) {
+			f.Blocks = append(f.Blocks, block)
+		}
+	}
+
+	var walk func(nodes []*BlockNode)
+	walk = func(nodes []*BlockNode) {
+		for _, node := range nodes {
+			report.Blocks++
+			id := node.Block.GetID()
+			if typ := node.Block.GetType(); !renderedBlockTypes[typ] && !(markdown && renderer.HasBlockHandler(typ)) {
+				add("block", string(typ), id)
+			}
+			for _, rt := range blockRichTexts(node.Block) {
+				for _, text := range rt {
+					for _, feature := range richTextFeatures(text) {
+						if !rendered[feature] {
+							add("rich_text", feature, id)
+						}
+					}
+				}
+			}
+			walk(node.Children)
+		}
+	}
+	walk(tree.Root.Children)
+
+	// ページの出力に含まれるプロパティはタイトルだけ（Markdown と Confluence は --properties で表にできる）
+	for _, name := range sortedPropertyNames(page) {
+		if typ := page.Properties[name].GetType(); typ != notionapi.PropertyTypeTitle {
+			add("property", fmt.Sprintf("%s (%s)", name, typ), "")
+		}
+	}
+
+	for _, f := range found {
+		report.Findings = append(report.Findings, *f)
+	}
+	kindOrder := map[string]int{"block": 0, "rich_text": 1, "property": 2}
+	sort.Slice(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.Kind != b.Kind {
+			return kindOrder[a.Kind] < kindOrder[b.Kind]
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Feature < b.Feature
+	})
+	return report
+}
+
+// richTextFeatures はリッチテキストの要素が使っている装飾・リンク・数式を返します
+func richTextFeatures(text notionapi.RichText) []string {
+	var features []string
+	if a := text.Annotations; a != nil {
+		for _, f := range []struct {
+			name string
+			on   bool
+		}{
+			{"bold", a.Bold}, {"italic", a.Italic}, {"strikethrough", a.Strikethrough},
+			{"underline", a.Underline}, {"code", a.Code}, {"color", a.Color != "" && a.Color != notionapi.ColorDefault},
+		} {
+			if f.on {
+				features = append(features, f.name)
+			}
+		}
+	}
+	if text.Href != "" && text.Mention == nil {
+		features = append(features, "link")
+	}
+	if text.Equation != nil {
+		features = append(features, "equation")
+	}
+	return features
+}
+
+// lintBlockIDLimit は1つの機能につき表示するブロックIDの数
+const lintBlockIDLimit = 5
+
+func writeLintReport(report lintReport) {
+	fmt.Printf("page:   %s (%s)\n", report.Title, report.Page)
+	fmt.Printf("format: %s, %d blocks checked\n", report.Format, report.Blocks)
+	if len(report.Findings) == 0 {
+		fmt.Println("✓ everything on the page is rendered")
+		return
+	}
+	headings := map[string]string{
+		"block":     "block types that are not rendered:",
+		"rich_text": "rich text features rendered as plain text:",
+		"property":  "properties that are not rendered:",
+	}
+	if report.Format == "markdown" || report.Format == "confluence" {
+		headings["property"] = "properties that are not rendered (pass --properties to write them as a table):"
+	}
+	kind := ""
+	for _, f := range report.Findings {
+		if f.Kind != kind {
+			kind = f.Kind
+			fmt.Printf("\n%s\n", headings[kind])
+		}
+		if len(f.Blocks) == 0 {
+			fmt.Printf("  ✗ %s\n", f.Feature)
+			continue
+		}
+		ids := make([]string, 0, lintBlockIDLimit+1)
+		for i, id := range f.Blocks {
+			if i == lintBlockIDLimit {
+				ids = append(ids, fmt.Sprintf("and %d more", len(f.Blocks)-i))
+				break
+			}
+			ids = append(ids, string(id))
+		}
+		fmt.Printf("  ✗ %-16s %4d  %s\n", f.Feature, f.Count, strings.Join(ids, ", "))
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// defaultLLMRetries は --llm-retries を指定しない場合の、OpenAIのAPIの一時的なエラーでの再試行の回数。
+// 待ち時間は0.5秒から倍々に延び（最大8秒、Retry-After があればそれに従う）、5回で約15秒待つ
+const defaultLLMRetries = 5
+
+var (
+	llmRetries = defaultLLMRetries
+	// llmFallbackModels は、一時的なエラーで再試行し尽くした場合に順に試すチャットのモデル（--fallback-models）
+	llmFallbackModels []string
+)
+
+// addLLMFlags は OpenAI のAPIを使うコマンドの fs に --max-cost・--llm-retries・--llm-price・--fallback-models を追加します。
+// デフォルトは NOTION_DFS_MAX_COST・NOTION_DFS_LLM_RETRIES・NOTION_DFS_LLM_PRICES・NOTION_DFS_FALLBACK_MODELS
+func addLLMFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&llmUsage.maxCost, "max-cost", llmUsage.maxCost, "stop before the estimated cost of the OpenAI API calls of this run exceeds this many USD (default: $NOTION_DFS_MAX_COST, no limit)")
+	fs.IntVar(&llmRetries, "llm-retries", llmRetries, "retries with backoff for rate limits, overloads, server and network errors of the OpenAI API (default: $NOTION_DFS_LLM_RETRIES)")
+	fs.Func("llm-price", "price of a model missing from the built-in list, as model=input,output in USD per 1M tokens, or model=<USD>/min for audio transcription; can be repeated (default: $NOTION_DFS_LLM_PRICES, separated by ;)", setPrice)
+	fs.Func("fallback-models", "comma-separated chat models to try in order when a request still fails after the retries, e.g. gpt-4o,gpt-4o-mini (default: $NOTION_DFS_FALLBACK_MODELS)", func(v string) error {
+		llmFallbackModels = splitModels(v)
+		return nil
+	})
+}
+
+// configureLLM は OpenAI のAPIの設定の環境変数を読み込みます
+func configureLLM() error {
+	if v := os.Getenv("NOTION_DFS_MAX_COST"); v != "" {
+		maxCost, err := strconv.ParseFloat(v, 64)
+		if err != nil || maxCost < 0 {
+			return fmt.Errorf("NOTION_DFS_MAX_COST: invalid cost %q", v)
+		}
+		llmUsage.maxCost = maxCost
+	}
+	if v := os.Getenv("NOTION_DFS_LLM_RETRIES"); v != "" {
+		retries, err := strconv.Atoi(v)
+		if err != nil || retries < 0 {
+			return fmt.Errorf("NOTION_DFS_LLM_RETRIES: invalid number of retries %q", v)
+		}
+		llmRetries = retries
+	}
+	llmFallbackModels = splitModels(os.Getenv("NOTION_DFS_FALLBACK_MODELS"))
+	for _, v := range strings.Split(os.Getenv("NOTION_DFS_LLM_PRICES"), ";") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if err := setPrice(v); err != nil {
+			return fmt.Errorf("NOTION_DFS_LLM_PRICES: %w", err)
+		}
+	}
+	return nil
+}
+
+func splitModels(v string) []string {
+	var models []string
+	for _, m := range strings.Split(v, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// newOpenAIClient は --llm-retries の回数だけ再試行する OpenAI のクライアントを作ります
+func newOpenAIClient(apiKey string, opts ...option.RequestOption) openai.Client {
+	return openai.NewClient(append(opts, option.WithAPIKey(apiKey), option.WithMaxRetries(max(llmRetries, 0)))...)
+}
+
+// canFallBack は、別のモデルなら成功しうるエラーかどうかを返します。一時的なエラー（レート制限・過負荷・
+// サーバーエラー・通信エラー）のほか、入力がモデルの上限より長い場合とモデルが使えない場合も次のモデルを試す
+func canFallBack(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errLLMBudget) {
+		return false
+	}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		switch code := apiErr.StatusCode; {
+		case code == http.StatusRequestTimeout || code == http.StatusConflict || code == http.StatusTooManyRequests || code >= http.StatusInternalServerError:
+			return true
+		case code == http.StatusNotFound || apiErr.Code == "model_not_found" || apiErr.Code == "context_length_exceeded":
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// createChatCompletion は params.Model で応答を生成します。一時的なエラーで再試行し尽くした場合などは
+// --fallback-models のモデルで順に試す（canFallBack）。input と extraTokens は --max-cost の見積もりに使う入力で、
+// 使ったモデルのトークン数は llmUsage に記録する
+func createChatCompletion(ctx context.Context, client *openai.Client, params openai.ChatCompletionNewParams, input string, extraTokens int64) (*openai.ChatCompletion, error) {
+	models := []string{params.Model}
+	for _, m := range llmFallbackModels {
+		if m != params.Model {
+			models = append(models, m)
+		}
+	}
+	var lastErr error
+	for i, model := range models {
+		if i > 0 {
+			log.Printf("warning: %s failed (%v); falling back to %s", models[i-1], lastErr, model)
+		}
+		reserved, err := llmUsage.reserve(model, input, extraTokens)
+		if err != nil {
+			return nil, err
+		}
+		params.Model = model
+		resp, err := client.Chat.Completions.New(ctx, params)
+		if err == nil {
+			llmUsage.record(model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, reserved)
+			if len(resp.Choices) == 0 {
+				return nil, errors.New("empty response")
+			}
+			return resp, nil
+		}
+		llmUsage.release(reserved)
+		if !canFallBack(err) {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
@@ -1,24 +1,26 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
+	"text/template"
+	"time"
 
 	"github.com/jomei/notionapi"
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
-	"github.com/openai/openai-go/shared"
-)
-
-var blockChildren = make(map[notionapi.BlockID][]notionapi.Block)
 
-// インデントを使ってブロックの階層を視覚的に表現するための補助関数
-func getIndent(depth int) string {
-	return strings.Repeat("  ", depth)
-}
+	"notion-dfs/renderer"
+)
 
 // NotionのページIDを正しいUUIDフォーマットに変換する
 func formatPageID(id string) string {
@@ -40,257 +42,1082 @@ func formatPageID(id string) string {
 	return id
 }
 
-// getRichTextContent combines multiple rich text blocks into a single string
-func getRichTextContent(richText []notionapi.RichText) string {
-	var content []string
-	for _, text := range richText {
-		content = append(content, text.PlainText)
-	}
-	return strings.Join(content, "")
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: notion-dfs [flags] <page-id>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs doctor [page-id]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs whoami [--json]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs auth <login|logout|status> [notion|openai]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs lint [--format markdown] [--json] <page-id>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs stats [--tokens] [--json] <page-id>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs tree [--pages-only] [--depth N] [--no-child-pages] [--json] <page-id>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs links [--check [--broken-only]] [--json] <page-id>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs graph [--format dot|graphml|json] (<page-id> | --search <query> | --search-all)")
+	fmt.Fprintln(os.Stderr, "       notion-dfs index [--index file] [<dir>...]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs query [--index file] [--limit 10] [--json] <query>...")
+	fmt.Fprintln(os.Stderr, "       notion-dfs embed [--store file] [<dir>...]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs semsearch [--limit 5] [--json] \"<query>\"")
+	fmt.Fprintln(os.Stderr, "       notion-dfs flashcards [--count 20] [--difficulty medium] [-o cards.apkg] <page-id>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs diff [flags] <page-id>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs snapshot <save|list|diff|export> ...")
+	fmt.Fprintln(os.Stderr, "       notion-dfs backup [flags] <page-id>...")
+	fmt.Fprintln(os.Stderr, "       notion-dfs daemon [flags] [-- <command> [args]...]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs serve [--addr :8080] [--grpc --tls-cert <file> --tls-key <file>] [--webhook --webhook-out <dir> | --webhook-summarize]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs digest [flags] <page-id>...")
+	fmt.Fprintln(os.Stderr, "       notion-dfs digest --database <database-id> [--since 7d] [flags]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs merge [flags] (<page-id>... | --database <database-id>)")
+	fmt.Fprintln(os.Stderr, "       notion-dfs feed [flags] <database-id>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs import (--parent <page-id> | --append <page-id>) <file.md>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs append [flags] <page-or-block-id> < input")
+	fmt.Fprintln(os.Stderr, "       notion-dfs db add <database-id> [--prop 'Name=value']...")
+	fmt.Fprintln(os.Stderr, "       notion-dfs db summarize <database-id> (--property <name> | --block)")
+	fmt.Fprintln(os.Stderr, "       notion-dfs db schema <database-id> [--format json|yaml]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs db codegen <database-id> [--package models]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs db export <database-id> [--format jsonl|xlsx] [--stream]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs props set [--dry-run] <page-id> Name=value...")
+	fmt.Fprintln(os.Stderr, "       notion-dfs archive|restore [--dry-run] <page-id>...")
+	fmt.Fprintln(os.Stderr, "       notion-dfs duplicate [flags] <page-id>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs comment [--reply <discussion-id>] <page-id> <text>")
+	fmt.Fprintln(os.Stderr, "       notion-dfs users [--json]")
+	fmt.Fprintln(os.Stderr, "       notion-dfs bench [--count 10] [--formats markdown,...] [--json] <page-id>")
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flag.PrintDefaults()
 }
 
-// printBlock prints a single block in Notion-like format
-func printBlock(block notionapi.Block, depth int) {
-	indent := strings.Repeat("    ", depth) // 4スペースでインデント
-
-	switch b := block.(type) {
-	case *notionapi.ParagraphBlock:
-		fmt.Printf("%s%s\n\n", indent, getRichTextContent(b.Paragraph.RichText))
-
-	case *notionapi.Heading1Block:
-		fmt.Printf("%s# %s\n\n", indent, getRichTextContent(b.Heading1.RichText))
+func main() {
+	// サブコマンドも含め、すべてのAPIクライアントにプロキシ・CA証明書・トレースの設定を適用する
+	if err := configureHTTP(httpOptions{}); err != nil {
+		fatal(err)
+	}
+	configureTracing()
+	// fatal で終了する場合も残りのスパンを送る
+	atExit(shutdownTracing)
+	if err := configureLLM(); err != nil {
+		fatal(err)
+	}
+	// サブコマンドも含め、OpenAIのAPIを使った場合は最後にトークン数と推定料金を表示する（fatal で終了する場合も）
+	atExit(func() { llmUsage.printSummary(os.Stderr) })
+	defer runExitHooks()
+	if addr := os.Getenv("NOTION_DFS_METRICS_ADDR"); addr != "" {
+		if err := serveMetrics(addr); err != nil {
+			fatal(err)
+		}
+	}
+	if err := startProfiling(os.Getenv("NOTION_DFS_CPUPROFILE"), os.Getenv("NOTION_DFS_MEMPROFILE"), os.Getenv("NOTION_DFS_PPROF")); err != nil {
+		fatal(err)
+	}
+	// fatal で終了する場合も、CPUプロファイルを閉じてヒーププロファイルを書き出す
+	atExit(stopProfiling)
+	if err := configureDates("", ""); err != nil {
+		fatal(err)
+	}
+	if notionAPIVersion != "" {
+		if err := validateNotionVersion(notionAPIVersion); err != nil {
+			fatalf("NOTION_DFS_NOTION_VERSION: %v", err)
+		}
+	}
+	if len(os.Args) >= 2 {
+		switch os.Args[1] {
+		case "doctor":
+			runDoctor(os.Args[2:])
+			return
+		case "whoami":
+			runWhoami(os.Args[2:])
+			return
+		case "auth":
+			runAuth(os.Args[2:])
+			return
+		case "lint":
+			runLint(os.Args[2:])
+			return
+		case "stats":
+			runStats(os.Args[2:])
+			return
+		case "links":
+			runLinks(os.Args[2:])
+			return
+		case "graph":
+			runGraph(os.Args[2:])
+			return
+		case "index":
+			runIndex(os.Args[2:])
+			return
+		case "query":
+			runQuery(os.Args[2:])
+			return
+		case "embed":
+			runEmbed(os.Args[2:])
+			return
+		case "semsearch":
+			runSemsearch(os.Args[2:])
+			return
+		case "flashcards":
+			runFlashcards(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "snapshot":
+			runSnapshot(os.Args[2:])
+			return
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "daemon":
+			runDaemon(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "digest":
+			runDigest(os.Args[2:])
+			return
+		case "merge":
+			runMerge(os.Args[2:])
+			return
+		case "feed":
+			runFeed(os.Args[2:])
+			return
+		case "import":
+			runImport(os.Args[2:])
+			return
+		case "append":
+			runAppend(os.Args[2:])
+			return
+		case "db":
+			runDB(os.Args[2:])
+			return
+		case "props":
+			runProps(os.Args[2:])
+			return
+		case "archive":
+			runArchive("archive", os.Args[2:], true)
+			return
+		case "restore":
+			runArchive("restore", os.Args[2:], false)
+			return
+		case "duplicate":
+			runDuplicate(os.Args[2:])
+			return
+		case "comment":
+			runComment(os.Args[2:])
+			return
+		case "users":
+			runUsers(os.Args[2:])
+			return
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		case "tree":
+			runTree(os.Args[2:])
+			return
+		}
+	}
 
-	case *notionapi.Heading2Block:
-		fmt.Printf("%s## %s\n\n", indent, getRichTextContent(b.Heading2.RichText))
+	var opts exportOptions
+	flag.StringVar(&opts.format, "format", "markdown", "output format: markdown, raw (API block objects as JSON), asciidoc, rst, slack, confluence (storage format), pdf, epub, docx, sqlite (the page, its sub-pages and databases as tables; requires -o), or the name of a notion-dfs-<format> plugin")
+	flag.BoolVar(&opts.stream, "stream", false, "render blocks as they are fetched instead of building the whole tree first")
+	flag.IntVar(&opts.limits.MaxDepth, "max-depth", 0, "maximum nesting depth to fetch (1 = top-level blocks only, 0 = unlimited)")
+	flag.IntVar(&opts.limits.MaxBlocks, "max-blocks", 0, "maximum number of blocks to fetch (0 = unlimited)")
+	timezone := flag.String("timezone", "", "show dates and times in this IANA time zone, e.g. Asia/Tokyo or Local (default: as returned by the API, in UTC; subcommands: NOTION_DFS_TIMEZONE)")
+	dateFormat := flag.String("date-format", "", `Go layout for dates and times in properties, date mentions and timestamps, e.g. "2006/01/02 15:04"; dates without a time use the part before the time (subcommands: NOTION_DFS_DATE_FORMAT)`)
+	flag.BoolVar(&opts.stripVolatile, "strip-volatile", false, "omit expiring file URL signatures and timestamps for stable, diffable output")
+	flag.BoolVar(&opts.noSummary, "no-summary", false, "do not append the AI summary")
+	flag.BoolVar(&opts.summarizePerSection, "summarize-per-section", false, "summarize each H1/H2 section separately and compose the overall summary from the section summaries (better on long, multi-topic pages)")
+	flag.StringVar(&opts.summaryFormat, "summary-format", "text", "format of the AI summary: text (bullet points) or json (an object with title, bullets, entities and sentiment; Markdown output, --template and plugins)")
+	flag.BoolVar(&opts.recursive, "recursive", false, "with --format epub, add sub-pages as separate chapters")
+	flag.BoolVar(&opts.includeComments, "include-comments", false, "include the unresolved comments on the page and its blocks (Markdown output only)")
+	flag.StringVar(&opts.commentsStyle, "comments-style", "footnotes", "with --include-comments, how to place the comments: footnotes (anchored to the commented block) or appendix")
+	flag.IntVar(&opts.headingOffset, "heading-offset", 0, "shift Markdown heading levels by N (e.g. 1 turns # into ##; levels are kept between 1 and 6)")
+	flag.BoolVar(&opts.normalizeHeadings, "normalize-headings", false, "promote headings that skip levels (e.g. # followed by ###) so the hierarchy has no gaps, starting at #")
+	flag.BoolVar(&opts.noEscape, "no-escape", false, "write Markdown characters in the text (*, _, #, <, backticks...) as they are instead of escaping them, for pages that contain Markdown source")
+	mdFlavor := flag.String("md-flavor", "gfm", "Markdown dialect for task lists, tables, footnotes, strikethrough and line breaks: gfm, commonmark or multimarkdown")
+	flag.BoolVar(&opts.flattenToggles, "flatten-toggles", false, "write toggles as their title followed by their content instead of collapsible <details> elements (Markdown and EPUB output)")
+	flag.StringVar(&opts.colors, "preserve-colors", "", "write text and background colors in Markdown: mark (backgrounds as <mark> highlights) or html (<span> elements with the color); dropped by default")
+	columnsFlag := flag.String("columns", "flatten", "how to write column layouts in Markdown, EPUB and Confluence: flatten (one after another), sections (one after another with a divider and a <!-- column N --> marker), html (side by side with a flex layout, Confluence column macros) or table (side by side in a one-row table)")
+	renderDiagrams := flag.Bool("render-diagrams", false, "render Mermaid and PlantUML code blocks to SVG images with Kroki (saved next to the pages with --preset, otherwise linked to the Kroki server)")
+	krokiURL := flag.String("kroki-url", defaultKrokiURL, "URL of the Kroki server used by --render-diagrams")
+	describeImages := flag.Bool("describe-images", false, "describe the images that have no caption with a vision model and use the description as their caption and alt text, so the summary covers them")
+	visionModel := flag.String("vision-model", defaultVisionModel, "OpenAI model used by --describe-images")
+	transcribe := flag.Bool("transcribe", false, "transcribe audio blocks and include the transcript (in a callout linking to the audio) in the output and the summary")
+	transcriptionModel := flag.String("transcription-model", defaultTranscriptionModel, "model used by --transcribe")
+	transcribeLanguage := flag.String("transcribe-language", "", "ISO-639-1 language of the audio for --transcribe, e.g. ja (default: detected)")
+	whisperURL := flag.String("whisper-url", "", "with --transcribe, use this OpenAI-compatible server (e.g. a local whisper server at http://localhost:8000/v1) instead of the OpenAI API")
+	pdfText := flag.String("pdf-text", "", "include the text of PDF blocks (in a callout linking to the PDF) in the output and the summary: full (the extracted text) or summary (an AI summary of it)")
+	addLLMFlags(flag.CommandLine)
+	calloutStyleFlag := flag.String("callout-style", "quote", "Markdown syntax for callouts: quote (blockquote with the icon), github (> [!NOTE] alerts), mkdocs (!!! note) or docusaurus (:::note); the kind is chosen from the icon and color")
+	flag.StringVar(&opts.section, "section", "", "output only the content under this heading, up to the next heading of the same level")
+	splitBy := flag.String("split-by", "", "write each section starting at a heading of this level (h1, h2 or h3) into its own Markdown file in the -o directory")
+	var selectExprs stringList
+	flag.Var(&selectExprs, "select", "output only the blocks matching this selector, e.g. 'type=code' or 'heading contains \"API\"' (repeatable; a block matching any is output)")
+	templateFile := flag.String("template", "", "render the page through this Go text/template file, which receives the metadata, the Markdown body and the blocks")
+	flag.IntVar(&opts.relations.depth, "resolve-relations-depth", defaultRelationDepth, "fetch the pages that relation properties point to, down to this many levels, to show their titles (levels past 1 are passed to templates as .Relations); 0 to show IDs without fetching")
+	flag.BoolVar(&opts.relations.links, "relation-links", false, "in --template and plugin properties and --properties tables, write related pages as links to Notion instead of plain titles")
+	flag.BoolVar(&opts.properties, "properties", false, "write a table of the page's database properties (formulas, statuses with their group, relations, ...) before the content; Markdown and Confluence output")
+	flag.BoolVar(&opts.peopleDetails, "people-details", false, "with --properties in Confluence output, show people with their avatar and link their names to their email address")
+	output := flag.String("o", "", "write the output to this file instead of stdout")
+	flag.StringVar(output, "output", "", "same as -o")
+	upload := flag.String("upload", "", "upload the output file to s3://bucket/prefix or gs://bucket/prefix (requires -o)")
+	postSlackTarget := flag.String("post-slack", "", "post the page as Slack mrkdwn to an incoming webhook URL or a channel (channels need SLACK_BOT_TOKEN)")
+	postSlackSummary := flag.Bool("post-slack-summary", false, "with --post-slack, post only the page title and the AI summary")
+	confluenceSpace := flag.String("confluence-space", "", "create or update the page (matched by title) in this Confluence space (needs CONFLUENCE_URL and CONFLUENCE_API_TOKEN)")
+	confluenceParent := flag.String("confluence-parent", "", "with --confluence-space, the ID of the Confluence page to put the page under")
+	preset := flag.String("preset", "", "export a page or database into the -o directory for another tool: hugo, obsidian, docusaurus, mkdocs or meeting")
+	maxConcurrency := flag.Int("max-concurrency", 4, "with --preset, number of pages to fetch and write at the same time (they share the --rate-limit)")
+	filenameTemplate := flag.String("filename-template", "", `with --preset, Go template for the name of each page's file, e.g. "{{.Date}}-{{slug .Title}}.md" (fields: .Title, .Slug, .Date, .CreatedTime, .LastEditedTime, .Parent, .Prop "Name"; functions: slug, date, lower and those of --template)`)
+	assetNames := flag.String("asset-names", "original", "with --preset, how to name downloaded images and files: original (the file name in the URL, numbered on collisions) or hash (the SHA-256 of the content, so identical files are stored once)")
+	imageMaxWidth := flag.Int("image-max-width", 0, "with --preset, scale down downloaded images wider than this many pixels (keeping the aspect ratio)")
+	imageMaxHeight := flag.Int("image-max-height", 0, "with --preset, scale down downloaded images taller than this many pixels")
+	imageFormat := flag.String("image-format", "keep", "with --preset, convert downloaded images to jpeg, png, webp (needs cwebp) or avif (needs avifenc); keep leaves the format as it is")
+	imageQuality := flag.Int("image-quality", 80, "with --image-format jpeg, webp or avif, the encoding quality from 1 to 100")
+	var filterExprs stringList
+	flag.Var(&filterExprs, "filter", "with --preset and a database, export only the rows matching this condition, e.g. 'Status=Published' or 'Date>=2024-01-01' (repeatable; rows must match all)")
+	resume := flag.Bool("resume", false, "with --preset, continue the export that failed or was interrupted in the -o directory instead of starting over")
+	proxy := flag.String("proxy", "", "send API requests through this HTTP(S) proxy, e.g. http://proxy.example.com:8080 (default: NOTION_DFS_PROXY, the config file, then HTTPS_PROXY)")
+	caCert := flag.String("ca-cert", "", "PEM file of additional CA certificates to trust, for proxies that intercept TLS (default: NOTION_DFS_CA_CERT or the config file)")
+	debugHTTP := flag.Bool("debug-http", false, "log every HTTP request (method, URL, status, latency, rate-limit headers, retries) to stderr (default: NOTION_DFS_DEBUG_HTTP=1)")
+	debugHTTPFile := flag.String("debug-http-file", "", "like --debug-http, but append the log to this file (default: NOTION_DFS_DEBUG_HTTP=<file>)")
+	record := flag.String("record", "", "save every Notion API response into this directory, for replaying with --replay (subcommands: NOTION_DFS_RECORD)")
+	replay := flag.String("replay", "", "answer Notion API requests from responses saved with --record instead of the network (subcommands: NOTION_DFS_REPLAY)")
+	cache := flag.Bool("cache", false, "save the Notion API responses, including the content of private pages, in the cache directory (readable only by you), for --offline and for skipping pages not edited since the last run")
+	offline := flag.Bool("offline", false, "render from the responses cached by previous runs with --cache (or the latest snapshot) without using the network; fails if the page is not cached")
+	refresh := flag.Bool("refresh", false, "with --cache, download every block again, even of pages not edited since their blocks were cached by a previous run")
+	rateLimit := flag.String("rate-limit", "", "maximum Notion API requests per second shared by all parallel requests, slowed down automatically on 429 responses; 0 for no limit (default 3; subcommands: NOTION_DFS_RATE_LIMIT)")
+	metricsAddr := flag.String("metrics-addr", "", "serve Prometheus metrics at http://<addr>/metrics while running, e.g. :9090 (subcommands: NOTION_DFS_METRICS_ADDR)")
+	pprofAddr := flag.String("pprof", "", "serve the Go pprof handlers at http://<addr>/debug/pprof/ while running, e.g. :6060 (default: $NOTION_DFS_PPROF)")
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile to this file, for go tool pprof (default: $NOTION_DFS_CPUPROFILE)")
+	memProfile := flag.String("memprofile", "", "write a heap profile to this file when the command finishes, also when it fails (default: $NOTION_DFS_MEMPROFILE)")
+	flag.StringVar(&notionAPIVersion, "notion-version", notionAPIVersion, "Notion-Version header to send, e.g. 2022-06-28 (default: NOTION_DFS_NOTION_VERSION, or the version the client library was written for)")
+	flag.Usage = usage
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	parseFlags(flag.CommandLine, os.Args[1:])
 
-	case *notionapi.Heading3Block:
-		fmt.Printf("%s### %s\n\n", indent, getRichTextContent(b.Heading3.RichText))
+	if notionAPIVersion != "" {
+		if err := validateNotionVersion(notionAPIVersion); err != nil {
+			fatal(err)
+		}
+	}
+	if *metricsAddr != "" && *metricsAddr != os.Getenv("NOTION_DFS_METRICS_ADDR") {
+		if err := serveMetrics(*metricsAddr); err != nil {
+			fatal(err)
+		}
+	}
+	if err := startProfiling(*cpuProfile, *memProfile, *pprofAddr); err != nil {
+		fatal(err)
+	}
 
-	case *notionapi.BulletedListItemBlock:
-		fmt.Printf("%s- %s\n", indent, getRichTextContent(b.BulletedListItem.RichText))
+	if *debugHTTPFile != "" {
+		*debugHTTP = true
+	}
+	trace := *debugHTTPFile
+	if *debugHTTP && trace == "" {
+		trace = "stderr"
+	}
+	if err := configureHTTP(httpOptions{proxy: *proxy, caCert: *caCert, trace: trace, record: *record, replay: *replay, cache: *cache && !*offline, offline: *offline, refresh: *refresh, rateLimit: *rateLimit}); err != nil {
+		fatal(err)
+	}
+	if err := configureDates(*timezone, *dateFormat); err != nil {
+		fatal(err)
+	}
 
-	case *notionapi.NumberedListItemBlock:
-		fmt.Printf("%s1. %s\n", indent, getRichTextContent(b.NumberedListItem.RichText))
+	if flag.NArg() != 1 {
+		flag.Usage()
+		exit(1)
+	}
 
-	case *notionapi.ToDoBlock:
-		checkbox := "[ ]"
-		if b.ToDo.Checked {
-			checkbox = "[x]"
+	switch opts.format {
+	case "markdown", "raw", "asciidoc", "rst", "slack", "confluence", "pdf", "epub", "docx", "sqlite":
+	default:
+		plugin, err := findFormatPlugin(opts.format)
+		if err != nil {
+			fatal(err)
 		}
-		fmt.Printf("%s- %s %s\n", indent, checkbox, getRichTextContent(b.ToDo.RichText))
-
-	case *notionapi.ImageBlock:
-		if b.Image.Type == "external" {
-			fmt.Printf("%s![Image](%s)\n\n", indent, b.Image.External.URL)
-		} else if b.Image.Type == "file" {
-			fmt.Printf("%s![Image](%s)\n\n", indent, b.Image.File.URL)
+		opts.plugin = plugin
+	}
+	if opts.format != "markdown" && opts.stream {
+		fatalf("--stream cannot be used with --format %s", opts.format)
+	}
+	if opts.format == "sqlite" && *output == "" {
+		fatal("--format sqlite requires -o/--output (the database file)")
+	}
+	if *preset != "" {
+		if _, ok := sitePresets[*preset]; !ok {
+			fatalf("unknown preset: %s", *preset)
 		}
-
-	case *notionapi.CodeBlock:
-		fmt.Printf("%s```%s\n", indent, b.Code.Language)
-		fmt.Printf("%s%s\n", indent, getRichTextContent(b.Code.RichText))
-		fmt.Printf("%s```\n\n", indent)
-
-	case *notionapi.QuoteBlock:
-		lines := strings.Split(getRichTextContent(b.Quote.RichText), "\n")
-		for _, line := range lines {
-			fmt.Printf("%s> %s\n", indent, line)
+		if *output == "" {
+			fatal("--preset requires -o/--output (the output directory)")
 		}
-		fmt.Println()
-
-	case *notionapi.CalloutBlock:
-		icon := "💡"
-		if b.Callout.Icon != nil && b.Callout.Icon.Type == "emoji" {
-			icon = string(*b.Callout.Icon.Emoji)
+		if opts.format != "markdown" || opts.stream {
+			fatal("--preset cannot be used with --format raw or --stream")
 		}
-		fmt.Printf("%s> %s %s\n\n", indent, icon, getRichTextContent(b.Callout.RichText))
-
-	case *notionapi.DividerBlock:
-		fmt.Printf("%s---\n\n", indent)
+		if _, ok := sitePresets[*preset]().(siteContentPreparer); ok && *resume {
+			fatalf("--resume cannot be used with --preset %s", *preset)
+		}
+		if *maxConcurrency < 1 {
+			fatal("--max-concurrency must be at least 1")
+		}
+	} else if *resume {
+		fatal("--resume requires --preset")
+	}
+	if *assetNames != "original" {
+		if *assetNames != "hash" {
+			fatalf("invalid --asset-names %q (expected original or hash)", *assetNames)
+		}
+		if *preset == "" {
+			fatal("--asset-names requires --preset")
+		}
+	}
+	switch *imageFormat {
+	case "keep", "jpeg", "png", "webp", "avif":
+	default:
+		fatalf("invalid --image-format %q (expected keep, jpeg, png, webp or avif)", *imageFormat)
+	}
+	if *imageMaxWidth < 0 || *imageMaxHeight < 0 {
+		fatal("--image-max-width and --image-max-height must not be negative")
+	}
+	if *imageQuality < 1 || *imageQuality > 100 {
+		fatal("--image-quality must be from 1 to 100")
+	}
+	if *imageMaxWidth > 0 || *imageMaxHeight > 0 || *imageFormat != "keep" {
+		if *preset == "" {
+			fatal("--image-max-width, --image-max-height and --image-format require --preset")
+		}
+		if err := checkImageEncoder(*imageFormat); err != nil {
+			fatal(err)
+		}
+	}
+	filters, err := parsePropertyConditions(filterExprs)
+	if err != nil {
+		fatal(err)
+	}
+	if len(filters) > 0 && *preset == "" {
+		fatal("--filter requires --preset (and a database)")
+	}
+	var nameTemplate *template.Template
+	if *filenameTemplate != "" {
+		if *preset == "" {
+			fatal("--filename-template requires --preset")
+		}
+		var err error
+		if nameTemplate, err = parseFilenameTemplate(*filenameTemplate); err != nil {
+			fatal(err)
+		}
+	}
+	if *postSlackTarget != "" {
+		if *preset != "" {
+			fatal("--post-slack cannot be used with --preset")
+		}
+		if opts.format != "markdown" && opts.format != "slack" {
+			fatalf("--post-slack cannot be used with --format %s", opts.format)
+		}
+		if opts.stream {
+			fatal("--post-slack cannot be used with --stream")
+		}
+		if *postSlackSummary && opts.noSummary {
+			fatal("--post-slack-summary cannot be used with --no-summary")
+		}
+		opts.format = "slack"
+	} else if *postSlackSummary {
+		fatal("--post-slack-summary requires --post-slack")
+	}
+	if *confluenceSpace != "" {
+		if *preset != "" || *postSlackTarget != "" {
+			fatal("--confluence-space cannot be used with --preset or --post-slack")
+		}
+		if opts.format != "markdown" && opts.format != "confluence" {
+			fatalf("--confluence-space cannot be used with --format %s", opts.format)
+		}
+		if opts.stream {
+			fatal("--confluence-space cannot be used with --stream")
+		}
+		opts.format = "confluence"
+	} else if *confluenceParent != "" {
+		fatal("--confluence-parent requires --confluence-space")
+	}
+	if opts.includeComments {
+		if opts.format != "markdown" || opts.stream || *preset != "" {
+			fatal("--include-comments can only be used with the Markdown output (not with --format, --stream, --preset, --post-slack or --confluence-space)")
+		}
+		if opts.commentsStyle != "footnotes" && opts.commentsStyle != "appendix" {
+			fatalf("unknown comments style: %s", opts.commentsStyle)
+		}
+	}
+	if *offline {
+		if *upload != "" || *postSlackTarget != "" || *confluenceSpace != "" {
+			fatal("--offline cannot be used with --upload, --post-slack or --confluence-space")
+		}
+		// 要約にはOpenAIへの接続が必要
+		opts.noSummary = true
+	}
+	if opts.section != "" && (opts.stream || *preset != "" || opts.format == "epub" || opts.format == "sqlite") {
+		fatal("--section cannot be used with --stream, --preset, --format epub or --format sqlite")
+	}
+	if len(selectExprs) > 0 {
+		if opts.stream || *preset != "" || opts.format == "epub" || opts.format == "sqlite" {
+			fatal("--select cannot be used with --stream, --preset, --format epub or --format sqlite")
+		}
+		for _, expr := range selectExprs {
+			sel, err := parseSelector(expr)
+			if err != nil {
+				fatal(err)
+			}
+			opts.selectors = append(opts.selectors, sel)
+		}
+	}
+	if *templateFile != "" {
+		if opts.format != "markdown" || opts.stream || *preset != "" {
+			fatal("--template cannot be used with --format, --stream, --preset, --post-slack or --confluence-space")
+		}
+		tmpl, err := parsePageTemplate(*templateFile)
+		if err != nil {
+			fatal(err)
+		}
+		opts.template = tmpl
+	}
+	if opts.properties && ((opts.format != "markdown" && opts.format != "confluence") || *preset != "" || opts.template != nil) {
+		fatal("--properties can only be used with the Markdown and Confluence output (not with other --format values, --preset, --post-slack or --template)")
+	}
+	if opts.peopleDetails && (!opts.properties || opts.format != "confluence") {
+		fatal("--people-details requires --properties and the Confluence output (--format confluence or --confluence-space)")
+	}
+	if opts.relations.depth < 0 {
+		fatal("--resolve-relations-depth must not be negative")
+	}
+	if opts.summarizePerSection && (opts.stream || opts.noSummary || *preset != "") {
+		fatal("--summarize-per-section cannot be used with --stream, --no-summary or --preset")
+	}
+	switch opts.summaryFormat {
+	case "text":
+	case "json":
+		if (opts.format != "markdown" && opts.plugin == "") || *preset != "" || opts.noSummary {
+			fatal("--summary-format json can only be used with the Markdown output, --template and plugins (not with other --format values, --preset, --post-slack, --confluence-space or --no-summary)")
+		}
+	default:
+		fatalf("unknown summary format: %s (want text or json)", opts.summaryFormat)
+	}
+	if (opts.headingOffset != 0 || opts.normalizeHeadings) && (opts.format != "markdown" || *preset != "") {
+		fatal("--heading-offset and --normalize-headings can only be used with the Markdown output (not with --format, --preset, --post-slack or --confluence-space)")
+	}
+	if opts.noEscape && (opts.format != "markdown" || *preset != "") {
+		fatal("--no-escape can only be used with the Markdown output (not with --format, --preset, --post-slack or --confluence-space)")
+	}
+	if opts.flattenToggles && ((opts.format != "markdown" && opts.format != "epub") || *preset != "") {
+		fatal("--flatten-toggles can only be used with the Markdown and EPUB output (not with other --format values, --preset, --post-slack or --confluence-space)")
+	}
+	if *mdFlavor != "gfm" {
+		if opts.format != "markdown" || *preset != "" {
+			fatal("--md-flavor can only be used with the Markdown output (not with --format, --preset, --post-slack or --confluence-space)")
+		}
+		flavor, err := renderer.ParseFlavor(*mdFlavor)
+		if err != nil {
+			fatal(err)
+		}
+		if opts.includeComments && opts.commentsStyle == "footnotes" && !flavor.Footnotes {
+			fatalf("--md-flavor %s has no footnotes; use --comments-style appendix with --include-comments", *mdFlavor)
+		}
+		opts.flavor = &flavor
+	}
+	if opts.colors != "" {
+		if opts.format != "markdown" || *preset != "" {
+			fatal("--preserve-colors can only be used with the Markdown output (not with --format, --preset, --post-slack or --confluence-space)")
+		}
+		if opts.colors != "mark" && opts.colors != "html" {
+			fatalf("invalid --preserve-colors %q (expected mark or html)", opts.colors)
+		}
+	}
+	if *columnsFlag != "flatten" {
+		if !columnLayouts[*columnsFlag] {
+			fatalf("invalid --columns %q (expected flatten, sections, html or table)", *columnsFlag)
+		}
+		if (opts.format != "markdown" && opts.format != "epub" && opts.format != "confluence") || *preset != "" {
+			fatal("--columns can only be used with the Markdown, EPUB and Confluence output (not with other --format values, --preset or --post-slack)")
+		}
+		opts.columns = *columnsFlag
+	}
+	if *renderDiagrams {
+		if opts.format != "markdown" {
+			fatal("--render-diagrams can only be used with the Markdown output (not with --format, --post-slack or --confluence-space)")
+		}
+		opts.diagrams = newDiagramRenderer(context.Background(), *krokiURL)
+	}
+	if *describeImages {
+		if opts.stream || *preset != "" || opts.format == "raw" || *offline {
+			fatal("--describe-images cannot be used with --stream, --preset, --format raw or --offline")
+		}
+		describer, err := newImageDescriber(*visionModel)
+		if err != nil {
+			fatal(err)
+		}
+		opts.images = describer
+	}
+	if *transcribe {
+		if opts.stream || *preset != "" || opts.format == "raw" || *offline {
+			fatal("--transcribe cannot be used with --stream, --preset, --format raw or --offline")
+		}
+		transcriber, err := newAudioTranscriber(*transcriptionModel, *transcribeLanguage, *whisperURL)
+		if err != nil {
+			fatal(err)
+		}
+		opts.audio = transcriber
+	} else if *whisperURL != "" || *transcribeLanguage != "" {
+		fatal("--whisper-url and --transcribe-language require --transcribe")
+	}
+	if *pdfText != "" {
+		if opts.stream || *preset != "" || opts.format == "raw" || *offline {
+			fatal("--pdf-text cannot be used with --stream, --preset, --format raw or --offline")
+		}
+		extractor, err := newPDFTextExtractor(*pdfText)
+		if err != nil {
+			fatal(err)
+		}
+		opts.pdfs = extractor
+	}
+	if *calloutStyleFlag != "quote" {
+		if opts.format != "markdown" || *preset != "" {
+			fatal("--callout-style can only be used with the Markdown output (not with --format, --preset, --post-slack or --confluence-space)")
+		}
+		style, err := renderer.ParseCalloutStyle(*calloutStyleFlag)
+		if err != nil {
+			fatal(err)
+		}
+		opts.calloutStyle = style
+	}
+	var splitLevel int
+	if *splitBy != "" {
+		level, err := parseSplitLevel(*splitBy)
+		if err != nil {
+			fatal(err)
+		}
+		if opts.format != "markdown" || opts.stream || *preset != "" || opts.includeComments || *templateFile != "" {
+			fatal("--split-by cannot be used with --format, --stream, --preset, --post-slack, --confluence-space, --include-comments or --template")
+		}
+		if *output == "" {
+			fatal("--split-by requires -o/--output (the output directory)")
+		}
+		splitLevel = level
+	}
+	var target *uploadTarget
+	if *upload != "" {
+		if *output == "" {
+			fatal("--upload requires -o/--output")
+		}
+		t, err := parseUploadTarget(*upload)
+		if err != nil {
+			fatal(err)
+		}
+		target = t
+	}
 
-	case *notionapi.ToggleBlock:
-		fmt.Printf("%s- %s\n", indent, getRichTextContent(b.Toggle.RichText))
+	pageID := notionapi.BlockID(formatPageID(flag.Arg(0)))
+	ctx := context.Background()
+	var offlineSnapshot *string
+	if *offline {
+		offlineSnapshot = checkOfflinePage(pageID, opts.format == "markdown" && *preset == "" && !opts.includeComments)
+	}
 
-	case *notionapi.TableBlock:
-		// テーブルヘッダーとデータは子ブロックとして取得されるため、
-		// ここでは何も出力せず、子ブロックの処理に任せる
+	if *preset != "" {
+		settings := exportSettings{Root: string(pageID), Preset: *preset, FilenameTemplate: *filenameTemplate, Filters: filters}
+		if *assetNames == "hash" {
+			settings.AssetNames = *assetNames
+		}
+		if *imageMaxWidth > 0 || *imageMaxHeight > 0 || *imageFormat != "keep" {
+			settings.ImageMaxWidth, settings.ImageMaxHeight, settings.ImageQuality = *imageMaxWidth, *imageMaxHeight, *imageQuality
+			if *imageFormat != "keep" {
+				settings.ImageFormat = *imageFormat
+			}
+		}
+		cp, err := openExportCheckpoint(*output, settings, *resume)
+		if err != nil {
+			fatal(err)
+		}
+		// Ctrl-C でも進捗を保存してから終了する
+		exportCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		site := sitePresets[*preset]()
+		if nameTemplate != nil {
+			site.(siteNameTemplater).setNameTemplate(nameTemplate)
+		}
+		files, err := exportSite(exportCtx, newNotionClient(), pageID, site, *output, opts.stripVolatile, opts.diagrams, *maxConcurrency, cp)
+		stop()
+		if err != nil {
+			exitWithNotionError("Error exporting site", err)
+		}
+		fmt.Fprintf(os.Stderr, "wrote %d files to %s\n", len(files), *output)
+		if target != nil {
+			if err := target.upload(ctx, *output, files); err != nil {
+				fatalf("Error uploading: %v", err)
+			}
+		}
 		return
+	}
 
-	case *notionapi.TableRowBlock:
-		cells := []string{}
-		for _, cell := range b.TableRow.Cells {
-			cells = append(cells, getRichTextContent(cell))
+	if splitLevel > 0 {
+		files, err := writeSplitPage(ctx, pageID, opts, splitLevel, *output)
+		if err != nil {
+			exitWithNotionError("Error exporting page", err)
+		}
+		fmt.Fprintf(os.Stderr, "wrote %d files to %s\n", len(files), *output)
+		if target != nil {
+			if err := target.upload(ctx, *output, files); err != nil {
+				fatalf("Error uploading: %v", err)
+			}
 		}
-		fmt.Printf("%s| %s |\n", indent, strings.Join(cells, " | "))
+		return
+	}
 
-	case *notionapi.ColumnListBlock, *notionapi.ColumnBlock:
-		// カラムブロックは視覚的な構造のみなので、
-		// 内容は子ブロックとして処理される
+	if *postSlackTarget != "" {
+		postPageToSlack(ctx, pageID, opts, *postSlackTarget, *postSlackSummary, *output, target)
+		return
+	}
+	if *confluenceSpace != "" {
+		publishPageToConfluence(ctx, pageID, opts, *confluenceSpace, *confluenceParent, *output, target)
 		return
 	}
-}
 
-func summarizeContent(content string) (string, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return "", fmt.Errorf("OPENAI_API_KEY is not set")
-	}
-
-	client := openai.NewClient(
-		option.WithAPIKey(apiKey),
-	)
-	resp, err := client.Chat.Completions.New(
-		context.Background(),
-		openai.ChatCompletionNewParams{
-			Messages: []openai.ChatCompletionMessageParamUnion{
-				openai.SystemMessage("あなたは与えられたテキストを要約する専門家です。重要なポイントを箇条書きで3-5個程度にまとめてください。"),
-				openai.UserMessage(content),
-			},
-			Model: shared.ChatModelGPT4,
-		},
-	)
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatalf("Error creating output file: %v", err)
+		}
+		out = f
+	}
 
-	if err != nil {
-		return "", fmt.Errorf("summarization failed: %v", err)
+	if offlineSnapshot != nil {
+		if _, err := io.WriteString(out, *offlineSnapshot); err != nil {
+			fatalf("Error writing output: %v", err)
+		}
+	} else if err := writePage(ctx, out, pageID, opts); err != nil {
+		exitWithNotionError("Error exporting page", err)
 	}
 
-	return resp.Choices[0].Message.Content, nil
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			fatalf("Error writing output file: %v", err)
+		}
+	}
+	if target != nil {
+		if err := target.upload(ctx, filepath.Dir(*output), []string{*output}); err != nil {
+			fatalf("Error uploading: %v", err)
+		}
+	}
 }
 
-func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: go run main.go <page-id>")
-		os.Exit(1)
+// checkOfflinePage は --offline で出力できるか、実行する前に確かめます。
+// ページの応答がキャッシュにあれば nil を、なければ useSnapshot のときは最新のスナップショットの内容を返し、
+// それもなければ終了する
+func checkOfflinePage(pageID notionapi.BlockID, useSnapshot bool) *string {
+	dir, err := responseCacheDir()
+	if err != nil {
+		fatal(err)
 	}
+	// キャッシュはトークンごとに分かれている
+	token, _ := notionTokenCredential.get()
+	if hasRecordedPage(filepath.Join(dir, tokenKey("Bearer "+firstNonEmpty(token, replayToken))), pageID) {
+		return nil
+	}
+	if useSnapshot {
+		store, err := openSnapshotStore(string(pageID))
+		if err != nil {
+			fatal(err)
+		}
+		snap, err := store.latest()
+		if err != nil {
+			fatalf("Error reading snapshots: %v", err)
+		}
+		if snap != nil {
+			content, err := store.read(snap)
+			if err != nil {
+				fatalf("Error reading snapshot: %v", err)
+			}
+			log.Printf("page %s is not in the cache; writing snapshot %s", pageID, snap.ID)
+			return &content
+		}
+	}
+	fatalf("page %s is not cached; export it once with --cache and the same token (or save a snapshot) first", pageID)
+	return nil
+}
 
-	token := os.Getenv("NOTION_API_TOKEN")
-	if token == "" {
-		log.Fatal("NOTION_API_TOKEN is not set")
+// postPageToSlack はページ（summaryOnly なら要約のみ）をSlackに投稿します。
+// -o が指定されていれば、投稿した内容をファイルにも書き出す
+func postPageToSlack(ctx context.Context, pageID notionapi.BlockID, opts exportOptions, slackTarget string, summaryOnly bool, output string, target *uploadTarget) {
+	var message string
+	if summaryOnly {
+		m, err := slackSummaryMessage(ctx, newNotionClient(), pageID, opts.limits)
+		if err != nil {
+			exitWithNotionError("Error summarizing page", err)
+		}
+		message = m
+	} else {
+		var buf bytes.Buffer
+		if err := writePage(ctx, &buf, pageID, opts); err != nil {
+			exitWithNotionError("Error exporting page", err)
+		}
+		message = buf.String()
 	}
 
-	pageID := formatPageID(os.Args[1])
-	client := notionapi.NewClient(notionapi.Token(token))
+	writeOutputFile(ctx, output, []byte(message), target)
+	if err := postSlack(ctx, slackTarget, message); err != nil {
+		fatal(err)
+	}
+	fmt.Fprintln(os.Stderr, "posted to Slack")
+}
 
-	// 表示用の出力
-	err := printBlocksRecursive(client, notionapi.BlockID(pageID), 0, nil)
+// publishPageToConfluence はページをストレージ形式にしてConfluenceのスペースに作成・更新します。
+// 画像はページの添付ファイルとしてアップロードし、-o が指定されていれば本文をファイルにも書き出す
+func publishPageToConfluence(ctx context.Context, pageID notionapi.BlockID, opts exportOptions, space, parentID, output string, target *uploadTarget) {
+	confluence, err := newConfluenceClient()
 	if err != nil {
-		log.Fatalf("Error fetching blocks: %v", err)
+		fatal(err)
 	}
-
-	// 要約用のテキスト収集
-	var contentBuilder strings.Builder
-	err = collectContent(client, notionapi.BlockID(pageID), &contentBuilder)
+	images := newEmbeddedImages(ctx, "")
+	var title string
+	var body bytes.Buffer
+	err = writePageDocument(ctx, &body, newNotionClient(), pageID, opts, func(ctx context.Context, w io.Writer, t string, tree *PageTree, summary string) error {
+		title = t
+		writeConfluence(w, tree, summary, images, opts.columns)
+		return nil
+	})
 	if err != nil {
-		log.Fatalf("Error collecting content: %v", err)
+		exitWithNotionError("Error exporting page", err)
 	}
 
-	content := contentBuilder.String()
-	fmt.Println("\n=== AI による要約 ===\n")
-	summary, err := summarizeContent(content)
+	writeOutputFile(ctx, output, body.Bytes(), target)
+	pageURL, err := confluence.publish(ctx, space, parentID, title, body.String(), images.items)
 	if err != nil {
-		log.Printf("Error generating summary: %v", err)
-	} else {
-		fmt.Println(summary)
+		fatalf("Error publishing to Confluence: %v", err)
 	}
+	fmt.Fprintf(os.Stderr, "published to %s\n", pageURL)
 }
 
-// fetchChildBlocks は指定されたブロックIDの子ブロックを再帰的に取得します
-func fetchChildBlocks(ctx context.Context, blockID notionapi.BlockID, client *notionapi.Client) ([]notionapi.Block, error) {
-	var blocks []notionapi.Block
-	var cursor notionapi.Cursor
+// writeOutputFile は -o が指定されていれば content を書き出し、--upload が指定されていればアップロードします
+func writeOutputFile(ctx context.Context, output string, content []byte, target *uploadTarget) {
+	if output == "" {
+		return
+	}
+	if err := os.WriteFile(output, content, 0o644); err != nil {
+		fatalf("Error writing output file: %v", err)
+	}
+	if target != nil {
+		if err := target.upload(ctx, filepath.Dir(output), []string{output}); err != nil {
+			fatalf("Error uploading: %v", err)
+		}
+	}
+}
+
+// exportOptions はページを出力するメインコマンドの設定
+type exportOptions struct {
+	format        string
+	stream        bool
+	limits        fetchLimits
+	stripVolatile bool
+	noSummary     bool
+	// summaryFormat は要約の形式（--summary-format）。"json" なら structuredSummary を出力する
+	summaryFormat string
+	// summarizePerSection は見出し1・2のセクションごとに要約してから全体を要約する（--summarize-per-section）
+	summarizePerSection bool
+	recursive           bool
+	// includeComments はMarkdownの出力にコメントを含め、commentsStyle（footnotes または appendix）で配置を決める
+	includeComments bool
+	commentsStyle   string
+	// headingOffset と normalizeHeadings はMarkdownの見出しのレベルの調整（--heading-offset・--normalize-headings）
+	headingOffset     int
+	normalizeHeadings bool
+	// noEscape はMarkdownの記号をエスケープせずに出力する（--no-escape）
+	noEscape bool
+	// flavor はMarkdownの方言（--md-flavor）。nil ならGFM
+	flavor *renderer.Flavor
+	// flattenToggles はトグルを <details> にせずに出力する（--flatten-toggles）
+	flattenToggles bool
+	// columns はカラムの出力方法（--columns）。空なら内容を順に並べる
+	columns string
+	// diagrams が設定されている場合、Mermaid・PlantUMLの図を画像として出力する（--render-diagrams）
+	diagrams *diagramRenderer
+	// images が設定されている場合、キャプションのない画像に説明を付ける（--describe-images）
+	images *imageDescriber
+	// audio が設定されている場合、音声ブロックを文字起こしに置き換える（--transcribe）
+	audio *audioTranscriber
+	// pdfs が設定されている場合、PDFのブロックを本文または要約に置き換える（--pdf-text）
+	pdfs *pdfTextExtractor
+	// colors は文字色と背景色の出力方法（--preserve-colors）。空なら出力しない
+	colors string
+	// calloutStyle はコールアウトの記法（--callout-style）。空なら絵文字つきの引用
+	calloutStyle string
+	// section が設定されている場合、その見出しのセクションの内容だけを出力する
+	section string
+	// selectors が設定されている場合、いずれかに一致するブロック（見出しの条件ならそのセクション）だけを出力する
+	selectors []*blockSelector
+	// plugin は組み込みでない --format を出力するプラグインの実行ファイル
+	plugin string
+	// template が設定されている場合、Markdownの本文とページの情報をテンプレートに渡して出力する
+	template *template.Template
+	// token が設定されている場合、NOTION_API_TOKEN の代わりにこのトークンでページを取得する（serve --multi-tenant）
+	token string
+	// relations はプロパティのリレーションの解決方法（--resolve-relations-depth・--relation-links）
+	relations relationOptions
+	// properties はページのプロパティの表を本文の前に出力する（--properties）
+	properties bool
+	// peopleDetails は Confluence のプロパティの表で人物にアバターとメールアドレスを添える（--people-details）
+	peopleDetails bool
+}
+
+// notionClient はページの取得に使うクライアントを作ります
+func (opts exportOptions) notionClient(clientOpts ...notionapi.ClientOption) *notionapi.Client {
+	if opts.token != "" {
+		return newNotionClientWithToken(opts.token, clientOpts...)
+	}
+	return newNotionClient(clientOpts...)
+}
+
+// markdownRenderer は設定に従ったMarkdownのレンダラーを作ります
+func (opts exportOptions) markdownRenderer() *renderer.Markdown {
+	r := newMarkdownRenderer()
+	r.StripVolatile = opts.stripVolatile
+	r.HeadingShift = opts.headingOffset
+	r.NormalizeHeadings = opts.normalizeHeadings
+	r.NoEscape = opts.noEscape
+	r.Flavor = opts.flavor
+	r.FlattenToggles = opts.flattenToggles
+	r.Columns = opts.columns
+	r.Diagram = opts.diagrams.linker(nil)
+	r.Colors = opts.colors
+	r.CalloutStyle = opts.calloutStyle
+	return r
+}
+
+// writePage fetches a page and writes it to w in the configured format,
+// followed by the AI summary unless disabled.
+func writePage(ctx context.Context, w io.Writer, pageID notionapi.BlockID, opts exportOptions) error {
+	ctx, span := startSpan(ctx, "render page", spanKindInternal)
+	span.setAttr("notion.page_id", string(pageID))
+	span.setAttr("format", opts.format)
+	start := time.Now()
+	err := writePageFormat(ctx, w, pageID, opts)
+	span.failed(err != nil)
+	span.end()
+	metrics.observeRender(opts.format, time.Since(start))
+	return err
+}
+
+func writePageFormat(ctx context.Context, w io.Writer, pageID notionapi.BlockID, opts exportOptions) error {
+	if opts.plugin != "" {
+		return writePagePlugin(ctx, w, pageID, opts.format, opts.plugin, opts)
+	}
+	if opts.format == "raw" {
+		// APIのレスポンスをそのまま保持するため、HTTPレベルで本文を記録する
+		capture := newRawCapture(http.DefaultTransport)
+		client := opts.notionClient(notionapi.WithHTTPClient(&http.Client{Transport: capture}))
+		tree, err := fetchExportTree(ctx, client, pageID, opts)
+		if err != nil {
+			return err
+		}
+		return writeRawTree(w, tree, capture, opts.stripVolatile)
+	}
 
-	for {
-		// ページネーションを使用してブロックを取得
-		resp, err := client.Block.GetChildren(ctx, blockID, &notionapi.Pagination{
-			StartCursor: cursor,
-			PageSize:    100,
+	client := opts.notionClient()
+	if opts.template != nil {
+		return writePageTemplate(ctx, w, client, pageID, opts)
+	}
+	if opts.format == "pdf" {
+		return writePageDocument(ctx, w, client, pageID, opts, writePDF)
+	}
+	if opts.format == "docx" {
+		return writePageDocument(ctx, w, client, pageID, opts, writeDOCX)
+	}
+	if opts.format == "epub" {
+		return writePageEPUB(ctx, w, client, pageID, opts)
+	}
+	if opts.format == "sqlite" {
+		return writePageSQLite(ctx, w, client, pageID, opts)
+	}
+	if opts.format == "confluence" {
+		return writePageDocument(ctx, w, client, pageID, opts, func(ctx context.Context, w io.Writer, title string, tree *PageTree, summary string) error {
+			if opts.properties {
+				table, err := fetchPropertyTable(ctx, client, pageID, opts.relations)
+				if err != nil {
+					return err
+				}
+				if table != nil {
+					table.writeHTML(w, opts.peopleDetails)
+				}
+			}
+			writeConfluence(w, tree, summary, nil, opts.columns)
+			return nil
+		})
+	}
+	if opts.format == "asciidoc" || opts.format == "rst" || opts.format == "slack" {
+		writeText := writeAsciiDoc
+		switch opts.format {
+		case "rst":
+			writeText = writeRST
+		case "slack":
+			writeText = writeSlack
+		}
+		return writePageDocument(ctx, w, client, pageID, opts, func(ctx context.Context, w io.Writer, title string, tree *PageTree, summary string) error {
+			return writeText(w, title, tree, summary, opts.stripVolatile)
 		})
+	}
+	r := opts.markdownRenderer()
+	if opts.properties {
+		table, err := fetchPropertyTable(ctx, client, pageID, opts.relations)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get blocks: %v", err)
+			return err
+		}
+		if table != nil {
+			table.writeMarkdown(w, r)
 		}
+	}
 
-		blocks = append(blocks, resp.Results...)
+	var contentBuilder strings.Builder
+	var tree *PageTree
+	if opts.stream {
+		// 取得したブロックをその場で出力し、要約用のテキストだけを保持する
+		err := streamBlocks(ctx, client, pageID, opts.limits, func(block notionapi.Block, depth int) error {
+			r.PrintBlock(w, block, depth)
+			contentBuilder.WriteString(blockText(block))
+			contentBuilder.WriteString("\n\n")
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		r.Finish(w)
+	} else {
+		// ブロックツリーは一度だけ取得し、表示と要約の両方で使う
+		var err error
+		tree, err = fetchExportTree(ctx, client, pageID, opts)
+		if err != nil {
+			return err
+		}
 
-		// 次のページがない場合は終了
-		if !resp.HasMore {
-			break
+		var notes *commentNotes
+		if opts.includeComments {
+			comments, err := fetchComments(ctx, client, pageID, tree)
+			if err != nil {
+				return err
+			}
+			notes = &commentNotes{comments: comments, appendix: opts.commentsStyle == "appendix"}
+			r.Comments = notes
 		}
 
-		// 次のページのカーソルを設定
-		cursor = notionapi.Cursor(resp.NextCursor)
+		// 表示用の出力
+		r.PrintBlocks(w, tree.Root.Children, 0)
+		if notes != nil {
+			notes.write(w)
+		}
 	}
 
-	// 各ブロックの子ブロックを再帰的に取得
-	for _, block := range blocks {
-		if block.GetHasChildren() {
-			childBlocks, err := fetchChildBlocks(ctx, block.GetID(), client)
-			if err != nil {
-				return nil, err
-			}
-			// Store child blocks in the map
-			blockChildren[block.GetID()] = childBlocks
+	if opts.noSummary {
+		return nil
+	}
+
+	content := contentBuilder.String()
+	if tree != nil {
+		var err error
+		if content, err = summaryInput(tree.Root.Children, opts.summarizePerSection); err != nil {
+			log.Printf("Error generating summary: %v", err)
+			return nil
+		}
+	}
+	fmt.Fprint(w, "\n=== AI による要約 ===\n\n")
+	if opts.summaryFormat == "json" {
+		summary, err := summarizeStructured(content)
+		if err != nil {
+			log.Printf("Error generating summary: %v", err)
+			return nil
+		}
+		data, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return err
 		}
+		fmt.Fprintf(w, "```json\n%s\n```\n", data)
+		return nil
 	}
+	summary, err := summarizeContent(content)
+	if err != nil {
+		log.Printf("Error generating summary: %v", err)
+	} else {
+		fmt.Fprintln(w, summary)
+	}
+	return nil
+}
 
-	return blocks, nil
+// fetchExportTree はページのブロックを取得し、--section・--select が指定されていればその部分だけにします。
+// --describe-images・--transcribe・--pdf-text が指定されていれば、残った画像に説明を付け、音声を文字起こしし、PDFのテキストを取り出す
+func fetchExportTree(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, opts exportOptions) (*PageTree, error) {
+	tree, err := fetchPageTree(ctx, client, pageID, opts.limits)
+	if err != nil {
+		return nil, err
+	}
+	if opts.audio != nil {
+		// --section・--select で音声ブロックを選べるよう、先に読み込む
+		if err := resolveAudioBlocks(ctx, client, pageID, tree); err != nil {
+			return nil, err
+		}
+	}
+	if opts.section != "" {
+		if tree, err = sectionBlocks(tree, opts.section); err != nil {
+			return nil, err
+		}
+	}
+	if len(opts.selectors) > 0 {
+		tree = selectBlocks(tree, opts.selectors)
+	}
+	if opts.images != nil {
+		opts.images.describeTree(ctx, tree)
+	}
+	if opts.audio != nil {
+		opts.audio.transcribeTree(ctx, tree)
+	}
+	if opts.pdfs != nil {
+		opts.pdfs.extractTree(ctx, tree)
+	}
+	return tree, nil
 }
 
-// printBlocksRecursive prints blocks recursively with proper indentation
-func printBlocksRecursive(client *notionapi.Client, blockID notionapi.BlockID, depth int, contentBuilder *strings.Builder) error {
-	blocks, err := fetchChildBlocks(context.Background(), blockID, client)
+// writePageDocument は要約を先に生成し、ページ本文と合わせて1つの文書（PDF・DOCX・AsciiDoc など）として出力します
+func writePageDocument(ctx context.Context, w io.Writer, client *notionapi.Client, pageID notionapi.BlockID, opts exportOptions,
+	write func(ctx context.Context, w io.Writer, title string, tree *PageTree, summary string) error) error {
+	title, err := fetchPageTitle(ctx, client, pageID)
+	if err != nil {
+		return err
+	}
+	tree, err := fetchExportTree(ctx, client, pageID, opts)
 	if err != nil {
 		return err
 	}
 
-	for _, block := range blocks {
-		printBlock(block, depth)
-		if _, ok := blockChildren[block.GetID()]; ok {
-			err := printBlocksRecursive(client, block.GetID(), depth+1, contentBuilder)
-			if err != nil {
-				return err
-			}
+	var summary string
+	if !opts.noSummary {
+		content, err := summaryInput(tree.Root.Children, opts.summarizePerSection)
+		if err == nil {
+			summary, err = summarizeContent(content)
+		}
+		if err != nil {
+			log.Printf("Error generating summary: %v", err)
 		}
 	}
-	return nil
+	return write(ctx, w, title, tree, summary)
 }
 
-// collectContent collects text content from blocks for summarization
-func collectContent(client *notionapi.Client, blockID notionapi.BlockID, contentBuilder *strings.Builder) error {
-	blocks, err := fetchChildBlocks(context.Background(), blockID, client)
+// writePageEPUB はページ（--recursive なら子ページを章として含む）をEPUBとして出力します
+func writePageEPUB(ctx context.Context, w io.Writer, client *notionapi.Client, pageID notionapi.BlockID, opts exportOptions) error {
+	root, err := fetchEPUBChapters(ctx, client, pageID, "", opts.limits, opts.recursive)
 	if err != nil {
 		return err
 	}
 
-	for _, block := range blocks {
-		switch b := block.(type) {
-		case *notionapi.ParagraphBlock:
-			contentBuilder.WriteString(getRichTextContent(b.Paragraph.RichText))
-		case *notionapi.Heading1Block:
-			contentBuilder.WriteString(getRichTextContent(b.Heading1.RichText))
-		case *notionapi.Heading2Block:
-			contentBuilder.WriteString(getRichTextContent(b.Heading2.RichText))
-		case *notionapi.Heading3Block:
-			contentBuilder.WriteString(getRichTextContent(b.Heading3.RichText))
-		case *notionapi.BulletedListItemBlock:
-			contentBuilder.WriteString(getRichTextContent(b.BulletedListItem.RichText))
-		case *notionapi.NumberedListItemBlock:
-			contentBuilder.WriteString(getRichTextContent(b.NumberedListItem.RichText))
-		case *notionapi.ToDoBlock:
-			contentBuilder.WriteString(getRichTextContent(b.ToDo.RichText))
-		case *notionapi.QuoteBlock:
-			contentBuilder.WriteString(getRichTextContent(b.Quote.RichText))
-		case *notionapi.CalloutBlock:
-			contentBuilder.WriteString(getRichTextContent(b.Callout.RichText))
-		case *notionapi.ToggleBlock:
-			contentBuilder.WriteString(getRichTextContent(b.Toggle.RichText))
-		}
-		contentBuilder.WriteString("\n\n")
-		if _, ok := blockChildren[block.GetID()]; ok {
-			err := collectContent(client, block.GetID(), contentBuilder)
-			if err != nil {
-				return err
-			}
+	var summary string
+	if !opts.noSummary {
+		var nodes []*BlockNode
+		for _, ch := range root.flatten() {
+			nodes = append(nodes, ch.tree.Root.Children...)
+		}
+		content, err := summaryInput(nodes, opts.summarizePerSection)
+		if err == nil {
+			summary, err = summarizeContent(content)
+		}
+		if err != nil {
+			log.Printf("Error generating summary: %v", err)
 		}
 	}
-	return nil
+	return writeEPUB(ctx, w, root, summary, opts.flattenToggles, opts.columns)
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifestFile は出力先ディレクトリに書くマニフェストのファイル名
+const manifestFile = "manifest.json"
+
+// exportManifest is the manifest.json written next to a site export. It
+// lists every page with its output file, last edited time and the files it
+// references, with the SHA-256 of each file, so that other tools can tell
+// which pages changed since an earlier export and verify that the export is
+// complete.
+type exportManifest struct {
+	// GeneratedAt は --strip-volatile では書かない
+	GeneratedAt string          `json:"generated_at,omitempty"`
+	Root        string          `json:"root"`
+	Preset      string          `json:"preset"`
+	Pages       []manifestPage  `json:"pages"`
+	Files       []manifestEntry `json:"files"`
+}
+
+type manifestPage struct {
+	ID             string `json:"id"`
+	Title          string `json:"title"`
+	Parent         string `json:"parent,omitempty"`
+	LastEditedTime string `json:"last_edited_time"`
+	manifestEntry
+	Assets []manifestEntry `json:"assets"`
+	// MissingBlocks は再試行しても子ブロックを取得しきれなかったブロック。ページの内容はその分欠けている
+	MissingBlocks []string `json:"missing_blocks,omitempty"`
+}
+
+// manifestEntry は出力先ディレクトリからの相対パス（区切りは /）と、内容のハッシュ・サイズ
+type manifestEntry struct {
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// writeExportManifest は書き出したファイルを読み直してハッシュを計算し、outDir/manifest.json に書きます。
+// files はすべての書き出したファイルで、ページと画像など以外（ナビゲーションなど）は files の項目になる
+func writeExportManifest(outDir string, pages []*sitePage, preset sitePreset, cp *exportCheckpoint, files []string, stripVolatile bool) (string, error) {
+	m := exportManifest{Root: cp.Root, Preset: cp.Preset, Pages: make([]manifestPage, 0, len(pages)), Files: []manifestEntry{}}
+	if !stripVolatile {
+		m.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	listed := make(map[string]bool)
+	for _, p := range pages {
+		file := filepath.Join(outDir, preset.pageFile(p))
+		entry, err := newManifestEntry(outDir, file)
+		if err != nil {
+			return "", err
+		}
+		listed[file] = true
+		mp := manifestPage{ID: string(p.ID), Title: p.Title, manifestEntry: entry, Assets: []manifestEntry{}}
+		if p.Parent != nil {
+			mp.Parent = string(p.Parent.ID)
+		}
+		if p.Page != nil {
+			mp.LastEditedTime = p.Page.LastEditedTime.UTC().Format(time.RFC3339)
+		}
+		if c, ok := cp.Pages[p.ID]; ok {
+			for _, asset := range c.Assets {
+				entry, err := newManifestEntry(outDir, asset)
+				if err != nil {
+					return "", err
+				}
+				listed[asset] = true
+				mp.Assets = append(mp.Assets, entry)
+			}
+			for _, id := range c.Missing {
+				mp.MissingBlocks = append(mp.MissingBlocks, string(id))
+			}
+		}
+		m.Pages = append(m.Pages, mp)
+	}
+	for _, file := range files {
+		if listed[file] {
+			continue
+		}
+		entry, err := newManifestEntry(outDir, file)
+		if err != nil {
+			return "", err
+		}
+		listed[file] = true
+		m.Files = append(m.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(outDir, manifestFile)
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func newManifestEntry(outDir, file string) (manifestEntry, error) {
+	rel, err := filepath.Rel(outDir, file)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return manifestEntry{}, err
+	}
+	return manifestEntry{File: filepath.ToSlash(rel), SHA256: hex.EncodeToString(h.Sum(nil)), Size: size}, nil
+}
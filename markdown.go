@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// newMarkdownRenderer は設定ファイルの code_languages・callouts の対応表を使うMarkdownのレンダラーを作ります
+func newMarkdownRenderer() *renderer.Markdown {
+	return &renderer.Markdown{CodeLanguage: codeLanguage, CalloutKind: calloutKind}
+}
+
+// renderPageMarkdown fetches a page and renders its blocks to a Markdown string.
+func renderPageMarkdown(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, r *renderer.Markdown, limits fetchLimits) (string, error) {
+	tree, err := fetchPageTree(ctx, client, pageID, limits)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	r.PrintBlocks(&sb, tree.Root.Children, 0)
+	return sb.String(), nil
+}
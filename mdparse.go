@@ -0,0 +1,575 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jomei/notionapi"
+)
+
+// parseMarkdown converts a Markdown document into Notion blocks. It covers
+// the subset that maps onto Notion blocks: ATX and setext headings,
+// paragraphs, bulleted, numbered and task lists (nested by indentation),
+// fenced code, block quotes, pipe tables, images on their own line and
+// thematic breaks. Quotes starting with an emoji become callouts, as
+// written by the Markdown output. Indented code blocks and raw HTML are not
+// recognized and are imported as text.
+func parseMarkdown(src string) []notionapi.Block {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\t", "    ")
+	return parseMarkdownLines(strings.Split(src, "\n"))
+}
+
+var (
+	mdHeading    = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	mdAnchor     = regexp.MustCompile(`[ \t]*\{#[^}]*\}$`)
+	mdFence      = regexp.MustCompile("^(`{3,}|~{3,})[ \t]*([^`\\s]*)")
+	mdListItem   = regexp.MustCompile(`^( *)([-*+]|\d{1,9}[.)])(?:[ \t]+|$)(.*)$`)
+	mdTask       = regexp.MustCompile(`^\[([ xX])\](?:[ \t]+|$)(.*)$`)
+	mdImage      = regexp.MustCompile(`^!\[([^\]]*)\]\(<?([^)\s>]+)>?(?:[ \t]+"[^"]*")?\)$`)
+	mdTableDelim = regexp.MustCompile(`^\|?(?:[ \t]*:?-+:?[ \t]*\|)*[ \t]*:?-+:?[ \t]*\|?$`)
+	mdBreak      = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	mdSetext     = regexp.MustCompile(`^(=+|-+)[ \t]*$`)
+)
+
+func parseMarkdownLines(lines []string) []notionapi.Block {
+	var blocks []notionapi.Block
+	for i := 0; i < len(lines); {
+		line := strings.TrimRight(lines[i], " ")
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			i++
+			continue
+		}
+
+		if m := mdFence.FindStringSubmatch(trimmed); m != nil {
+			// 閉じるフェンスまで（なければ文書の終わりまで）をそのままコードにする
+			indent := len(line) - len(trimmed)
+			var code []string
+			i++
+			for ; i < len(lines); i++ {
+				if l := strings.TrimSpace(lines[i]); strings.HasPrefix(l, m[1]) && strings.Trim(l, m[1][:1]) == "" {
+					i++
+					break
+				}
+				code = append(code, trimIndent(lines[i], indent))
+			}
+			blocks = append(blocks, codeBlock(strings.Join(code, "\n"), m[2]))
+			continue
+		}
+
+		if m := mdHeading.FindStringSubmatch(trimmed); m != nil {
+			blocks = append(blocks, headingBlock(len(m[1]), mdAnchor.ReplaceAllString(m[2], "")))
+			i++
+			continue
+		}
+
+		if mdBreak.MatchString(trimmed) {
+			blocks = append(blocks, &notionapi.DividerBlock{BasicBlock: basicBlock(notionapi.BlockTypeDivider)})
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, ">") {
+			var quote []string
+			for ; i < len(lines); i++ {
+				l := strings.TrimLeft(lines[i], " ")
+				if !strings.HasPrefix(l, ">") {
+					break
+				}
+				l = strings.TrimPrefix(l, ">")
+				quote = append(quote, strings.TrimPrefix(l, " "))
+			}
+			blocks = append(blocks, quoteBlock(strings.Join(quote, "\n")))
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "|") {
+			var rows []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				rows = append(rows, strings.TrimSpace(lines[i]))
+			}
+			blocks = append(blocks, tableBlock(rows))
+			continue
+		}
+
+		if m := mdImage.FindStringSubmatch(trimmed); m != nil {
+			blocks = append(blocks, imageBlock(m[2], m[1]))
+			i++
+			continue
+		}
+
+		if m := mdListItem.FindStringSubmatch(line); m != nil {
+			// 項目より深くインデントされた行（間の空行を含む）は、その項目の子ブロックになる
+			indent := len(m[1])
+			contentIndent := len(line) - len(m[3])
+			var children []string
+			j := i + 1
+			for ; j < len(lines); j++ {
+				l := lines[j]
+				if strings.TrimSpace(l) == "" {
+					children = append(children, "")
+					continue
+				}
+				if len(l)-len(strings.TrimLeft(l, " ")) <= indent {
+					break
+				}
+				children = append(children, trimIndent(l, contentIndent))
+			}
+			// 末尾の空行は次の兄弟や後続のブロックとの区切りなので子に含めない
+			for len(children) > 0 && children[len(children)-1] == "" {
+				children = children[:len(children)-1]
+				j--
+			}
+			blocks = append(blocks, listItemBlock(m[2], m[3], parseMarkdownLines(children)))
+			i = j
+			continue
+		}
+
+		// 段落は空行か別のブロックの始まりまで。行の区切りはNotionでも改行として残す（行末の "\" による改行も同じ）
+		para := []string{trimmed}
+		for i++; i < len(lines); i++ {
+			l := strings.TrimSpace(lines[i])
+			if m := mdSetext.FindStringSubmatch(l); m != nil {
+				level := 1
+				if m[1][0] == '-' {
+					level = 2
+				}
+				blocks = append(blocks, headingBlock(level, strings.Join(para, " ")))
+				para = nil
+				i++
+				break
+			}
+			if l == "" || startsMarkdownBlock(lines[i]) {
+				break
+			}
+			para = append(para, strings.TrimSuffix(l, "\\"))
+		}
+		if para != nil {
+			blocks = append(blocks, &notionapi.ParagraphBlock{
+				BasicBlock: basicBlock(notionapi.BlockTypeParagraph),
+				Paragraph:  notionapi.Paragraph{RichText: parseInlineMarkdown(strings.Join(para, "\n"))},
+			})
+		}
+	}
+	return blocks
+}
+
+// startsMarkdownBlock は段落の途中で出てきた行が新しいブロックを始めるかを返します
+func startsMarkdownBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return mdFence.MatchString(trimmed) || mdHeading.MatchString(trimmed) || mdBreak.MatchString(trimmed) ||
+		strings.HasPrefix(trimmed, ">") || strings.HasPrefix(trimmed, "|") || mdListItem.MatchString(line)
+}
+
+// trimIndent は行頭から最大 n 個の空白を取り除きます
+func trimIndent(line string, n int) string {
+	i := 0
+	for i < n && i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return line[i:]
+}
+
+func basicBlock(t notionapi.BlockType) notionapi.BasicBlock {
+	return notionapi.BasicBlock{Object: notionapi.ObjectTypeBlock, Type: t}
+}
+
+// headingBlock はNotionに見出し4〜6がないため、それらを見出し3にします
+func headingBlock(level int, text string) notionapi.Block {
+	heading := notionapi.Heading{RichText: parseInlineMarkdown(text)}
+	switch level {
+	case 1:
+		return &notionapi.Heading1Block{BasicBlock: basicBlock(notionapi.BlockTypeHeading1), Heading1: heading}
+	case 2:
+		return &notionapi.Heading2Block{BasicBlock: basicBlock(notionapi.BlockTypeHeading2), Heading2: heading}
+	default:
+		return &notionapi.Heading3Block{BasicBlock: basicBlock(notionapi.BlockTypeHeading3), Heading3: heading}
+	}
+}
+
+func codeBlock(code, language string) notionapi.Block {
+	return &notionapi.CodeBlock{
+		BasicBlock: basicBlock(notionapi.BlockTypeCode),
+		Code:       notionapi.Code{RichText: plainRichText(code), Language: notionCodeLanguage(language)},
+	}
+}
+
+// quoteBlock は絵文字で始まる引用をコールアウトにします（Markdown出力の "> 💡 テキスト" の逆変換）
+func quoteBlock(text string) notionapi.Block {
+	if icon, rest, _ := strings.Cut(text, " "); isEmoji(icon) {
+		emoji := notionapi.Emoji(icon)
+		return &notionapi.CalloutBlock{
+			BasicBlock: basicBlock(notionapi.BlockCallout),
+			Callout: notionapi.Callout{
+				RichText: parseInlineMarkdown(rest),
+				Icon:     &notionapi.Icon{Type: "emoji", Emoji: &emoji},
+			},
+		}
+	}
+	return &notionapi.QuoteBlock{
+		BasicBlock: basicBlock(notionapi.BlockQuote),
+		Quote:      notionapi.Quote{RichText: parseInlineMarkdown(text)},
+	}
+}
+
+// isEmoji は s が1つの絵文字（異体字セレクタや結合子による合成を含む）かを返します
+func isEmoji(s string) bool {
+	if s == "" || utf8.RuneCountInString(s) > 8 {
+		return false
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	if !unicode.Is(unicode.So, first) {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.In(r, unicode.So, unicode.Sk) && r != '\u200d' && r != '\ufe0f' {
+			return false
+		}
+	}
+	return true
+}
+
+// tableBlock は区切り行（|---|---|）があれば先頭行を見出し行として扱います。
+// 区切り行のない表（以前のバージョンのMarkdown出力など）も表として読み込む
+func tableBlock(lines []string) notionapi.Block {
+	var rows [][]string
+	header := false
+	width := 0
+	for i, line := range lines {
+		if mdTableDelim.MatchString(line) {
+			header = header || i == 1
+			continue
+		}
+		cells := splitTableRow(line)
+		width = max(width, len(cells))
+		rows = append(rows, cells)
+	}
+	// 見出し行のない表は、Markdown出力では空の見出し行を付けて書き出している
+	if header && strings.TrimSpace(strings.Join(rows[0], "")) == "" {
+		rows, header = rows[1:], false
+	}
+
+	table := &notionapi.TableBlock{
+		BasicBlock: basicBlock(notionapi.BlockTypeTableBlock),
+		Table:      notionapi.Table{TableWidth: width, HasColumnHeader: header},
+	}
+	for _, cells := range rows {
+		row := &notionapi.TableRowBlock{BasicBlock: basicBlock(notionapi.BlockTypeTableRowBlock)}
+		for i := 0; i < width; i++ {
+			cell := []notionapi.RichText{}
+			if i < len(cells) {
+				cell = parseInlineMarkdown(cells[i])
+			}
+			row.TableRow.Cells = append(row.TableRow.Cells, cell)
+		}
+		table.Table.Children = append(table.Table.Children, row)
+	}
+	return table
+}
+
+// splitTableRow は "| a | b |" をセルに分けます（"\|" はセル内の縦棒）
+func splitTableRow(line string) []string {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// imageBlock はURLの画像を外部ファイルとして埋め込みます。APIではファイルをアップロードできないため、
+// ローカルのパスの場合はその旨のテキストにする
+func imageBlock(src, alt string) notionapi.Block {
+	if !strings.HasPrefix(src, "https://") && !strings.HasPrefix(src, "http://") {
+		text := "[画像: " + src + "]"
+		if alt != "" && alt != "Image" {
+			text = "[画像: " + alt + " (" + src + ")]"
+		}
+		return &notionapi.ParagraphBlock{BasicBlock: basicBlock(notionapi.BlockTypeParagraph), Paragraph: notionapi.Paragraph{RichText: plainRichText(text)}}
+	}
+	image := notionapi.Image{Type: "external", External: &notionapi.FileObject{URL: src}}
+	// Markdown出力は画像の代替テキストに "Image" と書くので、キャプションにはしない
+	if alt != "" && alt != "Image" {
+		image.Caption = plainRichText(alt)
+	}
+	return &notionapi.ImageBlock{BasicBlock: basicBlock(notionapi.BlockTypeImage), Image: image}
+}
+
+func listItemBlock(marker, text string, children []notionapi.Block) notionapi.Block {
+	if marker[0] >= '0' && marker[0] <= '9' {
+		return &notionapi.NumberedListItemBlock{
+			BasicBlock:       basicBlock(notionapi.BlockTypeNumberedListItem),
+			NumberedListItem: notionapi.ListItem{RichText: parseInlineMarkdown(text), Children: children},
+		}
+	}
+	if m := mdTask.FindStringSubmatch(text); m != nil {
+		return &notionapi.ToDoBlock{
+			BasicBlock: basicBlock(notionapi.BlockTypeToDo),
+			ToDo:       notionapi.ToDo{RichText: parseInlineMarkdown(m[2]), Checked: m[1] != " ", Children: children},
+		}
+	}
+	return &notionapi.BulletedListItemBlock{
+		BasicBlock:       basicBlock(notionapi.BlockTypeBulletedListItem),
+		BulletedListItem: notionapi.ListItem{RichText: parseInlineMarkdown(text), Children: children},
+	}
+}
+
+// notionRichTextLimit はリッチテキスト1要素あたりの文字数の上限
+const notionRichTextLimit = 2000
+
+// plainRichText は装飾のないテキストを、上限の文字数ごとに分けたリッチテキストにします
+func plainRichText(text string) []notionapi.RichText {
+	return appendRichText(nil, text, notionapi.Annotations{}, "")
+}
+
+// displayRichText は出力するためのリッチテキストです。出力では plain_text を使うため、
+// APIの応答と同じく text.content と plain_text の両方に入れる（link があればリンクにする）
+func displayRichText(text, link string) []notionapi.RichText {
+	rt := appendRichText(nil, text, notionapi.Annotations{}, link)
+	for i := range rt {
+		rt[i].PlainText = rt[i].Text.Content
+		if link != "" {
+			rt[i].Href = link
+		}
+	}
+	return rt
+}
+
+func appendRichText(rt []notionapi.RichText, text string, ann notionapi.Annotations, link string) []notionapi.RichText {
+	if text == "" {
+		return rt
+	}
+	// 直前の要素と装飾とリンクが同じならつなげる
+	if n := len(rt); n > 0 && *rt[n-1].Annotations == ann && richTextLink(rt[n-1]) == link &&
+		utf8.RuneCountInString(rt[n-1].Text.Content)+utf8.RuneCountInString(text) <= notionRichTextLimit {
+		rt[n-1].Text.Content += text
+		return rt
+	}
+	for text != "" {
+		chunk := text
+		if runes := []rune(text); len(runes) > notionRichTextLimit {
+			chunk = string(runes[:notionRichTextLimit])
+		}
+		text = text[len(chunk):]
+		a := ann
+		t := &notionapi.Text{Content: chunk}
+		if link != "" {
+			t.Link = &notionapi.Link{Url: link}
+		}
+		rt = append(rt, notionapi.RichText{Type: notionapi.ObjectTypeText, Text: t, Annotations: &a})
+	}
+	return rt
+}
+
+// richTextContent はこれから送信するリッチテキストのテキストを連結します（plain_text はAPIが付けるので、まだ空）
+func richTextContent(rt []notionapi.RichText) string {
+	var sb strings.Builder
+	for _, text := range rt {
+		if text.Text != nil {
+			sb.WriteString(text.Text.Content)
+		}
+	}
+	return sb.String()
+}
+
+func richTextLink(rt notionapi.RichText) string {
+	if rt.Text.Link == nil {
+		return ""
+	}
+	return rt.Text.Link.Url
+}
+
+var (
+	mdInlineLink = regexp.MustCompile(`^!?\[((?:[^\[\]\\]|\\.)*)\]\(<?([^)\s>]*)>?(?:[ \t]+"[^"]*")?\)`)
+	mdAutolink   = regexp.MustCompile(`^<(https?://[^>\s]+)>`)
+)
+
+// parseInlineMarkdown は強調・取り消し線・コード・リンクを装飾つきのリッチテキストにします
+func parseInlineMarkdown(text string) []notionapi.RichText {
+	rt := parseInline(nil, text, notionapi.Annotations{}, "")
+	if rt == nil {
+		return []notionapi.RichText{}
+	}
+	return rt
+}
+
+func parseInline(rt []notionapi.RichText, s string, ann notionapi.Annotations, link string) []notionapi.RichText {
+	var plain strings.Builder
+	flush := func() {
+		rt = appendRichText(rt, plain.String(), ann, link)
+		plain.Reset()
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(markdownPunctuation, s[i+1]) >= 0:
+			plain.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			fence := s[i : i+n]
+			if end := strings.Index(s[i+n:], fence); end >= 0 {
+				flush()
+				code := s[i+n : i+n+end]
+				if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				a := ann
+				a.Code = true
+				rt = appendRichText(rt, code, a, link)
+				i += n + end + n
+				continue
+			}
+
+		case c == '[' || (c == '!' && strings.HasPrefix(s[i:], "![")):
+			if m := mdInlineLink.FindStringSubmatch(s[i:]); m != nil && link == "" {
+				flush()
+				// 文中の画像はブロックにできないため、代替テキストから画像へのリンクにする
+				label := m[1]
+				if label == "" {
+					label = m[2]
+				}
+				target := m[2]
+				if !isAbsoluteURL(target) {
+					// 相対リンクやページ内リンクはNotionでは開けないので、テキストだけにする
+					target = ""
+				}
+				rt = parseInline(rt, label, ann, target)
+				i += len(m[0])
+				continue
+			}
+
+		case c == '<':
+			if m := mdAutolink.FindStringSubmatch(s[i:]); m != nil && link == "" {
+				flush()
+				rt = appendRichText(rt, m[1], ann, m[1])
+				i += len(m[0])
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if end, n := closingDelimiter(s, i); end > 0 {
+				flush()
+				a := ann
+				switch {
+				case c == '~':
+					a.Strikethrough = true
+				case n == 2:
+					a.Bold = true
+				case n == 3:
+					a.Bold, a.Italic = true, true
+				default:
+					a.Italic = true
+				}
+				rt = parseInline(rt, s[i+n:end], a, link)
+				i = end + n
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		plain.WriteString(s[i : i+size])
+		i += size
+	}
+	flush()
+	return rt
+}
+
+func isAbsoluteURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "mailto:")
+}
+
+const markdownPunctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// closingDelimiter は s[i] から始まる強調の区切り（*, **, ***, _, __, ~~）に対応する閉じ記号の位置と
+// 区切りの長さを返します。見つからなければ -1 を返す
+func closingDelimiter(s string, i int) (int, int) {
+	c := s[i]
+	n := 1
+	for i+n < len(s) && s[i+n] == c && n < 3 {
+		n++
+	}
+	if c == '~' && n != 2 {
+		return -1, 0
+	}
+	// 開き記号の直後が空白なら強調ではない。"_" は snake_case のような単語中では使われない
+	if i+n >= len(s) || s[i+n] == ' ' {
+		return -1, 0
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return -1, 0
+	}
+	delim := s[i : i+n]
+	for j := i + n + 1; j+n <= len(s); j++ {
+		if s[j:j+n] != delim || s[j-1] == ' ' || s[j-1] == '\\' || s[j-1] == c {
+			continue
+		}
+		// "**" の閉じ記号を探しているときに "***" の一部に一致しないようにする
+		if j+n < len(s) && s[j+n] == c {
+			continue
+		}
+		if c == '_' && j+n < len(s) && isWordByte(s[j+n]) {
+			continue
+		}
+		return j, n
+	}
+	return -1, 0
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// notionCodeLanguages はNotionのコードブロックが受け付ける言語名
+var notionCodeLanguages = map[string]bool{
+	"abap": true, "arduino": true, "bash": true, "basic": true, "c": true, "clojure": true, "coffeescript": true,
+	"c++": true, "c#": true, "css": true, "dart": true, "diff": true, "docker": true, "elixir": true, "elm": true,
+	"erlang": true, "flow": true, "fortran": true, "f#": true, "gherkin": true, "glsl": true, "go": true,
+	"graphql": true, "groovy": true, "haskell": true, "html": true, "java": true, "javascript": true, "json": true,
+	"julia": true, "kotlin": true, "latex": true, "less": true, "lisp": true, "livescript": true, "lua": true,
+	"makefile": true, "markdown": true, "markup": true, "matlab": true, "mermaid": true, "nix": true,
+	"objective-c": true, "ocaml": true, "pascal": true, "perl": true, "php": true, "plain text": true,
+	"powershell": true, "prolog": true, "protobuf": true, "python": true, "r": true, "reason": true, "ruby": true,
+	"rust": true, "sass": true, "scala": true, "scheme": true, "scss": true, "shell": true, "solidity": true,
+	"sql": true, "swift": true, "typescript": true, "vb.net": true, "verilog": true, "vhdl": true,
+	"visual basic": true, "webassembly": true, "xml": true, "yaml": true,
+}
+
+// notionCodeAliases はよく使われる別名からNotionの言語名への対応
+var notionCodeAliases = map[string]string{
+	"js": "javascript", "jsx": "javascript", "ts": "typescript", "tsx": "typescript", "py": "python",
+	"rb": "ruby", "rs": "rust", "golang": "go", "sh": "shell", "zsh": "shell", "console": "shell",
+	"ps1": "powershell", "yml": "yaml", "md": "markdown", "cpp": "c++", "cc": "c++", "cs": "c#",
+	"csharp": "c#", "fsharp": "f#", "objc": "objective-c", "objectivec": "objective-c", "vbnet": "vb.net", "kt": "kotlin", "dockerfile": "docker",
+	"make": "makefile", "tex": "latex", "proto": "protobuf", "wasm": "webassembly", "vb": "visual basic",
+	"text": "plain text", "txt": "plain text", "plaintext": "plain text", "plain": "plain text",
+}
+
+// notionCodeLanguage はフェンスの情報文字列をNotionの言語名にします（不明なものは "plain text"）
+func notionCodeLanguage(info string) string {
+	lang := strings.ToLower(info)
+	if alias, ok := notionCodeAliases[lang]; ok {
+		return alias
+	}
+	if notionCodeLanguages[lang] {
+		return lang
+	}
+	return "plain text"
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jomei/notionapi"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+
+	"notion-dfs/renderer"
+)
+
+// meetingNotesPrompt は議事録から構造化した内容を取り出すプロンプト。返すJSONの形は meetingNotes と同じ
+const meetingNotesPrompt = `あなたは会議の議事録を整理する専門家です。与えられた議事録から次の内容を取り出し、JSONのオブジェクトだけを返してください。
+{
+  "summary": "会議の要約（2〜4文）",
+  "attendees": ["参加者の名前"],
+  "decisions": ["決定事項"],
+  "action_items": [{"task": "やること", "owner": "担当者の名前（不明なら空文字列）", "due": "期限（YYYY-MM-DD、不明なら空文字列）"}]
+}
+議事録に書かれていないことは推測せず、該当するものがなければ空の配列にしてください。値は議事録と同じ言語で書いてください。`
+
+// meetingNotes は議事録から取り出した内容（--preset meeting の JSON）
+type meetingNotes struct {
+	ID          string              `json:"id"`
+	Title       string              `json:"title"`
+	Date        string              `json:"date"`
+	URL         string              `json:"url"`
+	Summary     string              `json:"summary"`
+	Attendees   []string            `json:"attendees"`
+	Decisions   []string            `json:"decisions"`
+	ActionItems []meetingActionItem `json:"action_items"`
+}
+
+type meetingActionItem struct {
+	Task  string `json:"task"`
+	Owner string `json:"owner"`
+	Due   string `json:"due"`
+}
+
+// meetingPreset writes a digest of each meeting page, or of every row of a
+// meeting notes database: the summary, attendees, decisions and action items
+// extracted by the LLM, followed by the notes themselves, as <date>-<slug>.md,
+// and the same extracted data as <date>-<slug>.json.
+type meetingPreset struct {
+	pageNames
+	slugs map[*sitePage]string
+	notes map[*sitePage]*meetingNotes
+}
+
+func (m *meetingPreset) prepare(pages []*sitePage) {
+	m.slugs = m.assign(pages, func(p *sitePage) string {
+		return dateDisplay.in(pageDate(p.Page)).Format("2006-01-02") + "-" + renderer.Slugify(p.Title)
+	}, fileNameText)
+}
+
+// subPages は false。議事録のページ（またはデータベースの各行）だけを書き出す
+func (m *meetingPreset) subPages() bool {
+	return false
+}
+
+func (m *meetingPreset) pageFile(p *sitePage) string {
+	return m.slugs[p] + ".md"
+}
+
+func (m *meetingPreset) assetDir(p *sitePage) string {
+	return "assets"
+}
+
+// prepareContent は各ページの本文を取得し、LLMで議事録の内容を取り出します
+func (m *meetingPreset) prepareContent(ctx context.Context, client *notionapi.Client, pages []*sitePage) error {
+	apiKey, _ := openAIKeyCredential.get()
+	if apiKey == "" {
+		return fmt.Errorf("OPENAI_API_KEY is not set (--preset meeting extracts the notes with the OpenAI API)")
+	}
+	llm := newOpenAIClient(apiKey)
+
+	m.notes = make(map[*sitePage]*meetingNotes, len(pages))
+	for _, p := range pages {
+		if p.tree == nil {
+			tree, err := fetchPageTree(ctx, client, p.ID, fetchLimits{SkipChildPages: true})
+			if err != nil {
+				return err
+			}
+			p.tree = tree
+		}
+		notes, err := extractMeetingNotes(ctx, &llm, p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Title, err)
+		}
+		m.notes[p] = notes
+	}
+	return nil
+}
+
+// extractMeetingNotes はページのプロパティ（日付・参加者など）と本文をLLMに渡し、議事録の内容を取り出します
+func extractMeetingNotes(ctx context.Context, llm *openai.Client, p *sitePage) (*meetingNotes, error) {
+	var input strings.Builder
+	fmt.Fprintf(&input, "タイトル: %s\n", p.Title)
+	for _, name := range sortedPropertyNames(p.Page) {
+		if p.Page.Properties[name].GetType() == notionapi.PropertyTypeTitle {
+			continue
+		}
+		if text := propertyText(p.Page.Properties[name]); text != "" {
+			fmt.Fprintf(&input, "%s: %s\n", name, text)
+		}
+	}
+	input.WriteString("\n")
+	collectContent(p.tree.Root.Children, &input)
+
+	resp, err := createChatCompletion(ctx, llm, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(meetingNotesPrompt),
+			openai.UserMessage(input.String()),
+		},
+		Model:          shared.ChatModelGPT4o,
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{OfJSONObject: &shared.ResponseFormatJSONObjectParam{}},
+	}, meetingNotesPrompt+input.String(), 0)
+	if err != nil {
+		return nil, fmt.Errorf("extracting meeting notes failed: %v", err)
+	}
+	notes := &meetingNotes{}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), notes); err != nil {
+		return nil, fmt.Errorf("extracting meeting notes failed: invalid JSON in the response: %v", err)
+	}
+	notes.ID = string(p.ID)
+	notes.Title = p.Title
+	notes.Date = dateDisplay.in(pageDate(p.Page)).Format("2006-01-02")
+	notes.URL = p.Page.URL
+	// JSON では該当なしを null ではなく空の配列にする
+	if notes.Attendees == nil {
+		notes.Attendees = []string{}
+	}
+	if notes.Decisions == nil {
+		notes.Decisions = []string{}
+	}
+	if notes.ActionItems == nil {
+		notes.ActionItems = []meetingActionItem{}
+	}
+	return notes, nil
+}
+
+// frontMatter は本文の前に置くダイジェスト（要約・参加者・決定事項・アクションアイテム）です
+func (m *meetingPreset) frontMatter(p *sitePage) string {
+	notes := m.notes[p]
+	var sb strings.Builder
+	title := renderer.Escape(notes.Title, false)
+	if p.Emoji != "" {
+		title = p.Emoji + " " + title
+	}
+	fmt.Fprintf(&sb, "# %s\n\n", title)
+	sb.WriteString(pageBanner(p))
+	fmt.Fprintf(&sb, "- 日付: %s\n", notes.Date)
+	if len(notes.Attendees) > 0 {
+		fmt.Fprintf(&sb, "- 参加者: %s\n", renderer.Escape(strings.Join(notes.Attendees, "、"), false))
+	}
+	if notes.URL != "" {
+		fmt.Fprintf(&sb, "- Notion: <%s>\n", notes.URL)
+	}
+	if notes.Summary != "" {
+		fmt.Fprintf(&sb, "\n## 要約\n\n%s\n", renderer.Escape(notes.Summary, true))
+	}
+	if len(notes.Decisions) > 0 {
+		sb.WriteString("\n## 決定事項\n\n")
+		for _, d := range notes.Decisions {
+			fmt.Fprintf(&sb, "- %s\n", renderer.Escape(d, false))
+		}
+	}
+	if len(notes.ActionItems) > 0 {
+		sb.WriteString("\n## アクションアイテム\n\n")
+		for _, item := range notes.ActionItems {
+			line := "- [ ] " + renderer.Escape(item.Task, false)
+			if item.Owner != "" {
+				line += " — **" + renderer.Escape(item.Owner, false) + "**"
+			}
+			if item.Due != "" {
+				line += "（期限: " + item.Due + "）"
+			}
+			sb.WriteString(line + "\n")
+		}
+	}
+	sb.WriteString("\n## 議事録\n\n")
+	return sb.String()
+}
+
+// configureRenderer は本文の見出しを「議事録」の見出しの下の階層にします
+func (m *meetingPreset) configureRenderer(r *renderer.Markdown, p *sitePage) {
+	r.HeadingShift = 2
+}
+
+// finish は各ページの取り出した内容をMarkdownと同じ名前のJSONファイルに書き出します
+func (m *meetingPreset) finish(outDir string, pages []*sitePage) ([]string, error) {
+	var files []string
+	for _, p := range pages {
+		data, err := json.MarshalIndent(m.notes[p], "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		file := filepath.Join(outDir, m.slugs[p]+".json")
+		if err := os.WriteFile(file, append(data, '\n'), 0o644); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+// mergePage は merge で連結するページ1つ
+type mergePage struct {
+	ID    notionapi.BlockID
+	Title string
+}
+
+// runMerge concatenates several pages, given as arguments or as the rows of
+// a database, into one Markdown document. Each page starts with its title as
+// a heading and its own headings are shifted one level down (two with
+// --title), so that chapter pages can be built into a book.
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	databaseID := fs.String("database", "", "merge the rows of this database instead of the page arguments")
+	var sorts stringList
+	fs.Var(&sorts, "sort", "with --database, order the rows by this property (or created_time/last_edited_time), with :desc for descending order (repeatable)")
+	var filters stringList
+	fs.Var(&filters, "filter", "with --database, include only the rows matching this condition, e.g. 'Status=Published' or 'Date>=2024-01-01' (repeatable; rows must match all)")
+	title := fs.String("title", "", "put this title at the top as # and the page titles under it as ##")
+	stripVolatile := fs.Bool("strip-volatile", false, "omit expiring file URL signatures for stable, diffable output")
+	output := fs.String("o", "", "write the document to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs merge [flags] <page-id>...")
+		fmt.Fprintln(os.Stderr, "       notion-dfs merge [flags] --database <database-id> [--sort Property[:desc]]... [--filter 'Property=value']...")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	if (*databaseID == "") == (fs.NArg() == 0) {
+		fs.Usage()
+		exit(1)
+	}
+	if (len(sorts) > 0 || len(filters) > 0) && *databaseID == "" {
+		fatal("--sort and --filter require --database")
+	}
+	sortObjects, err := parseDatabaseSorts(sorts)
+	if err != nil {
+		fatal(err)
+	}
+	conds, err := parsePropertyConditions(filters)
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	var pages []mergePage
+	if *databaseID != "" {
+		id := notionapi.DatabaseID(formatPageID(*databaseID))
+		filter, err := databaseFilter(ctx, client, id, conds)
+		if err != nil {
+			exitWithNotionError("Error fetching database", err)
+		}
+		rows, err := queryDatabaseFiltered(ctx, client, id, filter, sortObjects)
+		if err != nil {
+			exitWithNotionError("Error querying database", err)
+		}
+		for _, row := range rows {
+			pages = append(pages, mergePage{ID: notionapi.BlockID(row.ID), Title: propertyTitle(&row)})
+		}
+	} else {
+		for _, arg := range fs.Args() {
+			id := notionapi.BlockID(formatPageID(arg))
+			t, err := fetchPageTitle(ctx, client, id)
+			if err != nil {
+				exitWithNotionError("Error fetching page", err)
+			}
+			pages = append(pages, mergePage{ID: id, Title: t})
+		}
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fatalf("Error creating output file: %v", err)
+		}
+		out = f
+	}
+	if err := writeMerged(ctx, out, client, *title, pages, *stripVolatile); err != nil {
+		exitWithNotionError("Error exporting page", err)
+	}
+	if *output != "" {
+		if err := out.Close(); err != nil {
+			fatalf("Error writing output file: %v", err)
+		}
+	}
+}
+
+// writeMerged はページを順に取得し、見出しのレベルをずらして1つのMarkdownとして w に書き出します
+func writeMerged(ctx context.Context, w io.Writer, client *notionapi.Client, title string, pages []mergePage, stripVolatile bool) error {
+	shift := 1
+	if title != "" {
+		fmt.Fprintf(w, "# %s\n\n", title)
+		shift = 2
+	}
+	for _, page := range pages {
+		tree, err := fetchPageTree(ctx, client, page.ID, fetchLimits{})
+		if err != nil {
+			return fmt.Errorf("%s: %w", page.ID, err)
+		}
+		r := newMarkdownRenderer()
+		r.StripVolatile = stripVolatile
+		r.HeadingShift = shift
+		fmt.Fprintf(w, "%s %s\n\n", strings.Repeat("#", shift), page.Title)
+		r.PrintBlocks(w, tree.Root.Children, 0)
+	}
+	return nil
+}
+
+// parseDatabaseSorts は "Property" や "Property:desc" の指定をデータベースの並び順にします。
+// created_time と last_edited_time はプロパティではなくページの時刻で並べる
+func parseDatabaseSorts(values []string) ([]notionapi.SortObject, error) {
+	var sorts []notionapi.SortObject
+	for _, v := range values {
+		s := notionapi.SortObject{Property: v, Direction: notionapi.SortOrderASC}
+		// プロパティ名に ":" を含む場合があるため、最後の ":" の後が向きの場合だけ分ける
+		if i := strings.LastIndex(v, ":"); i >= 0 {
+			switch strings.ToLower(v[i+1:]) {
+			case "asc", "ascending":
+				s.Property = v[:i]
+			case "desc", "descending":
+				s.Property = v[:i]
+				s.Direction = notionapi.SortOrderDESC
+			}
+		}
+		switch s.Property {
+		case "":
+			return nil, fmt.Errorf("invalid sort %q (expected Property, Property:asc or Property:desc)", v)
+		case string(notionapi.TimestampCreated), string(notionapi.TimestampLastEdited):
+			s.Timestamp = notionapi.TimestampType(s.Property)
+			s.Property = ""
+		}
+		sorts = append(sorts, s)
+	}
+	return sorts, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pipelineMetrics are the counters exposed at /metrics in the Prometheus
+// text format: API calls, cache lookups and render durations.
+type pipelineMetrics struct {
+	mu sync.Mutex
+	// httpRequests はホスト・メソッド・ステータスコード（通信エラーは "error"）ごとのリクエスト数
+	httpRequests map[[3]string]int
+	httpSeconds  map[string]*durationSummary
+	// cacheLookups はキャッシュの名前と結果（"hit" または "miss"）ごとの参照回数
+	cacheLookups  map[[2]string]int
+	renderSeconds map[string]*durationSummary
+}
+
+// durationSummary は所要時間の合計と回数（Prometheus の summary の _sum と _count）
+type durationSummary struct {
+	count int
+	sum   float64
+}
+
+var metrics = &pipelineMetrics{
+	httpRequests:  make(map[[3]string]int),
+	httpSeconds:   make(map[string]*durationSummary),
+	cacheLookups:  make(map[[2]string]int),
+	renderSeconds: make(map[string]*durationSummary),
+}
+
+func (m *pipelineMetrics) observeHTTP(host, method, status string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.httpRequests[[3]string{host, method, status}]++
+	observe(m.httpSeconds, host, d)
+}
+
+func (m *pipelineMetrics) cacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cacheLookups[[2]string{cache, result}]++
+}
+
+func (m *pipelineMetrics) observeRender(format string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observe(m.renderSeconds, format, d)
+}
+
+func observe(summaries map[string]*durationSummary, key string, d time.Duration) {
+	s, ok := summaries[key]
+	if !ok {
+		s = &durationSummary{}
+		summaries[key] = s
+	}
+	s.count++
+	s.sum += d.Seconds()
+}
+
+// writePrometheus はメトリクスを Prometheus のテキスト形式で書き出します（ラベルの順に並べる）
+func (m *pipelineMetrics) writePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP notion_dfs_http_requests_total HTTP requests to the Notion, OpenAI and other APIs.")
+	fmt.Fprintln(w, "# TYPE notion_dfs_http_requests_total counter")
+	var lines []string
+	for k, v := range m.httpRequests {
+		lines = append(lines, fmt.Sprintf("notion_dfs_http_requests_total{host=%q,method=%q,status=%q} %d", k[0], k[1], k[2], v))
+	}
+	writeSorted(w, lines)
+
+	writeSummary(w, "notion_dfs_http_request_duration_seconds", "Time spent on HTTP requests.", "host", m.httpSeconds)
+
+	fmt.Fprintln(w, "# HELP notion_dfs_cache_lookups_total Lookups in the in-process caches.")
+	fmt.Fprintln(w, "# TYPE notion_dfs_cache_lookups_total counter")
+	lines = nil
+	for k, v := range m.cacheLookups {
+		lines = append(lines, fmt.Sprintf("notion_dfs_cache_lookups_total{cache=%q,result=%q} %d", k[0], k[1], v))
+	}
+	writeSorted(w, lines)
+
+	writeSummary(w, "notion_dfs_render_duration_seconds", "Time spent fetching and rendering a page.", "format", m.renderSeconds)
+}
+
+func writeSummary(w io.Writer, name, help, label string, summaries map[string]*durationSummary) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s summary\n", name)
+	var lines []string
+	for k, s := range summaries {
+		lines = append(lines,
+			fmt.Sprintf("%s_sum{%s=%q} %s", name, label, k, strconv.FormatFloat(s.sum, 'f', -1, 64)),
+			fmt.Sprintf("%s_count{%s=%q} %d", name, label, k, s.count))
+	}
+	writeSorted(w, lines)
+}
+
+func writeSorted(w io.Writer, lines []string) {
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// metricsHandler は /metrics のハンドラー
+func metricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.writePrometheus(w)
+		llmUsage.writePrometheus(w)
+	})
+}
+
+// serveMetrics は addr で /metrics の待ち受けを始めます。プロセスが終了するまでバックグラウンドで動く
+func serveMetrics(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metricsHandler())
+	log.Printf("serving metrics on http://%s/metrics", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			log.Printf("warning: metrics server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// instrumentedTransport はすべてのHTTPリクエストをメトリクスに数え、トレースが有効ならクライアントのスパンを記録します
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, span := startSpan(req.Context(), req.Method+" "+req.URL.Host, spanKindClient)
+	span.setAttr("http.request.method", req.Method)
+	span.setAttr("url.full", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+		span.setAttr("http.response.status_code", resp.StatusCode)
+		span.failed(resp.StatusCode >= 400)
+	} else {
+		span.failed(true)
+	}
+	span.end()
+	metrics.observeHTTP(strings.ToLower(req.URL.Host), req.Method, status, time.Since(start))
+	return resp, err
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jomei/notionapi"
+)
+
+// notionAppendLimit は1回のリクエストで追加できるブロック数の上限
+const notionAppendLimit = 100
+
+// appendBlockTree appends blocks and their children under parentID, after
+// the child block after if it is not empty, and returns the created
+// top-level blocks. The API accepts at most 100 blocks and two levels of
+// nesting per request, so the blocks are sent in chunks and each block's
+// children are appended to it once it has been created. Tables and column
+// lists cannot be created empty, so table rows are sent together with their
+// table, and columns with their first level of content.
+func appendBlockTree(ctx context.Context, client *notionapi.Client, parentID, after notionapi.BlockID, blocks []notionapi.Block) ([]notionapi.Block, error) {
+	var created []notionapi.Block
+	for start := 0; start < len(blocks); start += notionAppendLimit {
+		chunk := blocks[start:min(start+notionAppendLimit, len(blocks))]
+		children := make([][]notionapi.Block, len(chunk))
+		columns := make([][][]notionapi.Block, len(chunk))
+		for i, block := range chunk {
+			children[i] = detachChildren(block)
+			if list, ok := block.(*notionapi.ColumnListBlock); ok {
+				columns[i] = detachColumnContent(list)
+			}
+		}
+		resp, err := client.Block.AppendChildren(ctx, parentID, &notionapi.AppendBlockChildrenRequest{After: after, Children: chunk})
+		if err != nil {
+			return nil, err
+		}
+		// 子ブロックを追加する先は、レスポンスの作成されたブロックのIDで決まる
+		if len(resp.Results) != len(chunk) {
+			return nil, fmt.Errorf("appended %d blocks but got %d in the response", len(chunk), len(resp.Results))
+		}
+		results := resp.Results
+		for i, kids := range children {
+			if len(kids) == 0 {
+				continue
+			}
+			if _, err := appendBlockTree(ctx, client, results[i].GetID(), "", kids); err != nil {
+				return nil, err
+			}
+		}
+		for i, pending := range columns {
+			if pending == nil {
+				continue
+			}
+			if err := appendColumnContent(ctx, client, results[i].GetID(), pending); err != nil {
+				return nil, err
+			}
+		}
+		created = append(created, results...)
+		if after != "" {
+			// 次のまとまりは、いま追加した最後のブロックの後ろに続ける
+			after = results[len(results)-1].GetID()
+		}
+	}
+	return created, nil
+}
+
+// detachChildren はブロックから子ブロックを取り外して返します（表の行は取り外さない）
+func detachChildren(block notionapi.Block) []notionapi.Block {
+	children := blockChildren(block)
+	if children == nil {
+		return nil
+	}
+	detached := *children
+	*children = nil
+	return detached
+}
+
+// detachColumnContent は各カラムの中身のブロックから、さらにその子ブロックを取り外します。
+// 戻り値はカラムごと、中身のブロックごとの子ブロック（取り外すものがなければ nil）
+func detachColumnContent(list *notionapi.ColumnListBlock) [][]notionapi.Block {
+	var pending [][]notionapi.Block
+	found := false
+	for _, col := range list.ColumnList.Children {
+		col, ok := col.(*notionapi.ColumnBlock)
+		if !ok {
+			continue
+		}
+		for _, block := range col.Column.Children {
+			kids := detachChildren(block)
+			found = found || len(kids) > 0
+			pending = append(pending, kids)
+		}
+	}
+	if !found {
+		return nil
+	}
+	return pending
+}
+
+// appendColumnContent は作成されたカラムリストの中身のブロックのIDを取得し、取り外しておいた子ブロックを追加します
+func appendColumnContent(ctx context.Context, client *notionapi.Client, listID notionapi.BlockID, pending [][]notionapi.Block) error {
+	var content []notionapi.BlockID
+	err := eachChildBlock(ctx, client, listID, func(col notionapi.Block) error {
+		return eachChildBlock(ctx, client, col.GetID(), func(block notionapi.Block) error {
+			content = append(content, block.GetID())
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	for i, kids := range pending {
+		if len(kids) == 0 || i >= len(content) {
+			continue
+		}
+		if _, err := appendBlockTree(ctx, client, content[i], "", kids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockChildren は作成後に子ブロックを追加できるブロックの、子ブロックのフィールドを返します
+func blockChildren(block notionapi.Block) *notionapi.Blocks {
+	switch b := block.(type) {
+	case *notionapi.ParagraphBlock:
+		return &b.Paragraph.Children
+	case *notionapi.Heading1Block:
+		return &b.Heading1.Children
+	case *notionapi.Heading2Block:
+		return &b.Heading2.Children
+	case *notionapi.Heading3Block:
+		return &b.Heading3.Children
+	case *notionapi.BulletedListItemBlock:
+		return &b.BulletedListItem.Children
+	case *notionapi.NumberedListItemBlock:
+		return &b.NumberedListItem.Children
+	case *notionapi.ToDoBlock:
+		return &b.ToDo.Children
+	case *notionapi.ToggleBlock:
+		return &b.Toggle.Children
+	case *notionapi.QuoteBlock:
+		return &b.Quote.Children
+	case *notionapi.CalloutBlock:
+		return &b.Callout.Children
+	case *notionapi.SyncedBlock:
+		return &b.SyncedBlock.Children
+	}
+	return nil
+}
+
+// createChildPage creates an empty page titled title under the page parentID.
+func createChildPage(ctx context.Context, client *notionapi.Client, parentID notionapi.PageID, title string) (*notionapi.Page, error) {
+	return client.Page.Create(ctx, &notionapi.PageCreateRequest{
+		Parent: notionapi.Parent{Type: notionapi.ParentTypePageID, PageID: parentID},
+		Properties: notionapi.Properties{
+			"title": notionapi.TitleProperty{Title: plainRichText(title)},
+		},
+	})
+}
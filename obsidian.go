@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"notion-dfs/renderer"
+)
+
+// obsidianAttachments は添付ファイルを保存する Vault 内のフォルダ
+const obsidianAttachments = "attachments"
+
+// obsidianPreset writes pages into an Obsidian vault. Sub-pages become notes
+// in a folder named after their parent, links and mentions of exported pages
+// become [[wikilinks]], and all files go to a shared attachments folder.
+type obsidianPreset struct {
+	pageNames
+	// names はページごとのノート名（Vault 内で重複しない）
+	names map[*sitePage]string
+	// byID はハイフンなしのページIDからノート名への対応
+	byID map[string]string
+}
+
+func (o *obsidianPreset) prepare(pages []*sitePage) {
+	o.names = o.assign(pages, func(p *sitePage) string {
+		return obsidianNoteName(p.Title)
+	}, obsidianNoteName)
+	o.byID = make(map[string]string, len(pages))
+	for _, p := range pages {
+		o.byID[compactPageID(string(p.ID))] = o.names[p]
+	}
+}
+
+func (o *obsidianPreset) subPages() bool {
+	return true
+}
+
+// pageFile は親ページの階層をフォルダとして "親/子.md" の形で返します
+func (o *obsidianPreset) pageFile(p *sitePage) string {
+	parts := []string{o.names[p] + ".md"}
+	for parent := p.Parent; parent != nil; parent = parent.Parent {
+		parts = append([]string{o.names[parent]}, parts...)
+	}
+	return filepath.Join(parts...)
+}
+
+func (o *obsidianPreset) assetDir(p *sitePage) string {
+	return obsidianAttachments
+}
+
+// frontMatter はカバー画像とアイコンがあれば、Banners プラグインの banner・banner_icon（画像のアイコンは icon）を書きます
+func (o *obsidianPreset) frontMatter(p *sitePage) string {
+	if p.Cover == "" && p.Icon == "" && p.Emoji == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	if p.Cover != "" {
+		sb.WriteString("banner: " + strconv.Quote(obsidianEmbed(p.Cover)) + "\n")
+	}
+	if p.Emoji != "" {
+		sb.WriteString("banner_icon: " + strconv.Quote(p.Emoji) + "\n")
+	}
+	if p.Icon != "" {
+		sb.WriteString("icon: " + strconv.Quote(obsidianEmbed(p.Icon)) + "\n")
+	}
+	sb.WriteString("---\n\n")
+	return sb.String()
+}
+
+// obsidianEmbed は保存したファイルへのリンクを [[ファイル名]] にします（添付ファイルのフォルダは共有なので名前は重複しない）。
+// ダウンロードできずURLのままなら、そのまま返す
+func obsidianEmbed(link string) string {
+	if strings.Contains(link, "://") {
+		return link
+	}
+	name := path.Base(link)
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return "[[" + name + "]]"
+}
+
+func (o *obsidianPreset) configureRenderer(r *renderer.Markdown, p *sitePage) {
+	r.PageLink = o.pageLink
+	r.CalloutStyle = "github"
+}
+
+// pageLink はリンクの表示テキストがノート名と異なる場合、[[ノート名|テキスト]] とします
+func (o *obsidianPreset) pageLink(pageID, text string) (string, bool) {
+	name, ok := o.byID[pageID]
+	if !ok {
+		return "", false
+	}
+	// "|" や "]" を含むテキストは wikilink の表示テキストにできない
+	if text == "" || text == name || strings.ContainsAny(text, "|[]") {
+		return "[[" + name + "]]", true
+	}
+	return "[[" + name + "|" + text + "]]", true
+}
+
+// obsidianNoteName はファイル名やwikilinkに使えない文字をタイトルから取り除きます
+func obsidianNoteName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`*"\/<>:|?#^[]`, r) {
+			return ' '
+		}
+		return r
+	}, title)
+	return strings.Join(strings.Fields(name), " ")
+}
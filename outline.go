@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+// outlineNode は tree で表示するページまたは見出し。Blocks はその中のブロックの数（子の分も含む）
+type outlineNode struct {
+	Type     string         `json:"type"`
+	ID       string         `json:"id"`
+	Title    string         `json:"title"`
+	Level    int            `json:"level,omitempty"`
+	Blocks   int            `json:"blocks"`
+	Children []*outlineNode `json:"children,omitempty"`
+	// own はこのノード自体に属する（子のノードに属さない）ブロックの数
+	own int
+}
+
+// runTree prints the hierarchy of a page's sub-pages and headings, like
+// tree(1), with the number of blocks in each, without rendering any content,
+// to understand the structure of a huge page before exporting it. A
+// heading's blocks are those up to the next heading of the same or a higher
+// level, so the counts of a node include those of the nodes under it.
+func runTree(args []string) {
+	fs := flag.NewFlagSet("tree", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	pagesOnly := fs.Bool("pages-only", false, "show only the sub-pages, not the headings")
+	depth := fs.Int("depth", 0, "show only this many levels below the page (0 = all)")
+	noChildPages := fs.Bool("no-child-pages", false, "do not fetch the sub-pages, only show where they are")
+	asJSON := fs.Bool("json", false, "print the hierarchy as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs tree [--pages-only] [--depth N] [--no-child-pages] [--json] <page-id>")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	if fs.NArg() != 1 || *depth < 0 {
+		fs.Usage()
+		exit(1)
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	pageID := notionapi.BlockID(formatPageID(fs.Arg(0)))
+	title, err := fetchPageTitle(ctx, client, pageID)
+	if err != nil {
+		exitWithNotionError("Error fetching page", err)
+	}
+	tree, err := fetchPageTree(ctx, client, pageID, fetchLimits{SkipChildPages: *noChildPages})
+	if err != nil {
+		exitWithNotionError("Error fetching blocks", err)
+	}
+
+	root := &outlineNode{Type: "page", ID: string(pageID), Title: title}
+	buildOutline(root, tree.Root.Children, *pagesOnly)
+	countOutline(root)
+	if *depth > 0 {
+		pruneOutline(root, *depth)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(root); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	fmt.Println(outlineLabel(root))
+	printOutline(root.Children, "")
+	pages, headings := outlineTotals(root)
+	fmt.Printf("\n%s, %s, %s\n", countNoun(pages, "page"), countNoun(headings, "heading"), countNoun(root.Blocks, "block"))
+}
+
+// buildOutline はページ直下のブロックを文書の順にたどり、見出しと子ページのノードを page の下に作ります
+func buildOutline(page *outlineNode, nodes []*BlockNode, pagesOnly bool) {
+	// stack は開いている見出し（先頭はページ）。ブロックは一番内側の見出しに属する
+	stack := []*outlineNode{page}
+	var walk func(nodes []*BlockNode)
+	walk = func(nodes []*BlockNode) {
+		for _, node := range nodes {
+			if child, ok := node.Block.(*notionapi.ChildPageBlock); ok {
+				sub := &outlineNode{Type: "page", ID: string(child.ID), Title: child.ChildPage.Title, own: 1}
+				top := stack[len(stack)-1]
+				top.Children = append(top.Children, sub)
+				buildOutline(sub, node.Children, pagesOnly)
+				continue
+			}
+			if level := headingLevel(node.Block); level > 0 && !pagesOnly {
+				for len(stack) > 1 && stack[len(stack)-1].Level >= level {
+					stack = stack[:len(stack)-1]
+				}
+				heading := &outlineNode{Type: "heading", ID: string(node.Block.GetID()), Title: blockText(node.Block), Level: level}
+				top := stack[len(stack)-1]
+				top.Children = append(top.Children, heading)
+				stack = append(stack, heading)
+			}
+			stack[len(stack)-1].own++
+			// トグル見出しや列の中の見出しも、文書の順で同じ階層に並べる
+			walk(node.Children)
+		}
+	}
+	walk(nodes)
+}
+
+// countOutline は子のノードの分も含めたブロックの数を数えます
+func countOutline(n *outlineNode) int {
+	n.Blocks = n.own
+	for _, child := range n.Children {
+		n.Blocks += countOutline(child)
+	}
+	return n.Blocks
+}
+
+// pruneOutline は depth より深いノードを取り除きます（ブロックの数はそのまま）
+func pruneOutline(n *outlineNode, depth int) {
+	if depth == 0 {
+		n.Children = nil
+		return
+	}
+	for _, child := range n.Children {
+		pruneOutline(child, depth-1)
+	}
+}
+
+func outlineTotals(n *outlineNode) (pages, headings int) {
+	if n.Type == "page" {
+		pages++
+	} else {
+		headings++
+	}
+	for _, child := range n.Children {
+		p, h := outlineTotals(child)
+		pages += p
+		headings += h
+	}
+	return pages, headings
+}
+
+func outlineLabel(n *outlineNode) string {
+	title := n.Title
+	if title == "" {
+		title = "(untitled)"
+	}
+	if n.Type == "heading" {
+		title = strings.Repeat("#", n.Level) + " " + title
+	}
+	return fmt.Sprintf("%s (%s)", title, countNoun(n.Blocks, "block"))
+}
+
+// countNoun は "1 block"・"2 blocks" のように数と名詞を返します
+func countNoun(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func printOutline(nodes []*outlineNode, prefix string) {
+	for i, n := range nodes {
+		branch, indent := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Println(prefix + branch + outlineLabel(n))
+		printOutline(n.Children, prefix+indent)
+	}
+}
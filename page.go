@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// fetchPageTitle returns the title of a page. A page is also a block, and the
+// block endpoint returns its title without needing the page's schema.
+func fetchPageTitle(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID) (string, error) {
+	block, err := client.Block.Get(ctx, pageID)
+	if err != nil {
+		return "", err
+	}
+	page, ok := block.(*notionapi.ChildPageBlock)
+	if !ok {
+		return "", fmt.Errorf("%s is not a page (type %s)", pageID, block.GetType())
+	}
+	return page.ChildPage.Title, nil
+}
+
+// propertyTitle returns the plain text of the page's title property.
+func propertyTitle(page *notionapi.Page) string {
+	for _, prop := range page.Properties {
+		if title, ok := prop.(*notionapi.TitleProperty); ok {
+			return renderer.PlainText(title.Title)
+		}
+	}
+	return ""
+}
+
+// findProperty はいずれかの名前（大文字小文字を区別しない）に一致するプロパティを返します
+func findProperty(page *notionapi.Page, names ...string) notionapi.Property {
+	for _, name := range names {
+		for key, prop := range page.Properties {
+			if strings.EqualFold(key, name) {
+				return prop
+			}
+		}
+	}
+	return nil
+}
+
+// sortedPropertyNames returns the property names in a stable order, since
+// Properties is a map.
+func sortedPropertyNames(page *notionapi.Page) []string {
+	names := make([]string, 0, len(page.Properties))
+	for name := range page.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// propertyText はプロパティの値をプレーンテキストにします。複数の値はカンマ区切りにし、
+// テキストにできない種類（ファイルなど）は空文字列にする。リレーションの関連先のタイトルは
+// pageDirectory.propertyText で表示する（ここでは空文字列）
+func propertyText(prop notionapi.Property) string {
+	switch p := prop.(type) {
+	case *notionapi.TitleProperty:
+		return renderer.PlainText(p.Title)
+	case *notionapi.RichTextProperty:
+		return renderer.PlainText(p.RichText)
+	case *notionapi.NumberProperty:
+		return strconv.FormatFloat(p.Number, 'f', -1, 64)
+	case *notionapi.SelectProperty:
+		return p.Select.Name
+	case *notionapi.StatusProperty:
+		return p.Status.Name
+	case *notionapi.MultiSelectProperty:
+		names := make([]string, 0, len(p.MultiSelect))
+		for _, opt := range p.MultiSelect {
+			names = append(names, opt.Name)
+		}
+		return strings.Join(names, ", ")
+	case *notionapi.DateProperty:
+		if p.Date == nil {
+			return ""
+		}
+		return dateDisplay.dateRange(p.Date.Start, p.Date.End)
+	case *notionapi.CheckboxProperty:
+		return strconv.FormatBool(p.Checkbox)
+	case *notionapi.URLProperty:
+		return p.URL
+	case *notionapi.EmailProperty:
+		return p.Email
+	case *notionapi.PhoneNumberProperty:
+		return p.PhoneNumber
+	case *notionapi.PeopleProperty:
+		names := make([]string, 0, len(p.People))
+		for _, user := range p.People {
+			names = append(names, user.Name)
+		}
+		return strings.Join(names, ", ")
+	case *notionapi.FormulaProperty:
+		return formulaText(p.Formula)
+	case *notionapi.RollupProperty:
+		return rollupText(p.Rollup)
+	case *notionapi.CreatedByProperty:
+		return p.CreatedBy.Name
+	case *notionapi.LastEditedByProperty:
+		return p.LastEditedBy.Name
+	case *notionapi.CreatedTimeProperty:
+		return dateDisplay.timestamp(p.CreatedTime, time.RFC3339)
+	case *notionapi.LastEditedTimeProperty:
+		return dateDisplay.timestamp(p.LastEditedTime, time.RFC3339)
+	}
+	return ""
+}
+
+// compactPageID はページIDからハイフンを取り除きます（URLやファイル名と同じ形式）
+func compactPageID(id string) string {
+	return strings.ReplaceAll(id, "-", "")
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/jomei/notionapi"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"notion-dfs/renderer"
+)
+
+const (
+	pdfFontSize   = 10.5
+	pdfLineHeight = 5.5
+	// pdfIndent は入れ子1段あたりのインデント幅（mm）
+	pdfIndent = 6
+)
+
+// pdfFontCandidates は日本語を含むページのために探すTrueTypeフォント。
+// 埋め込みのGoフォントには日本語のグリフがないため、見つかればこちらを使う
+var pdfFontCandidates = []string{
+	"/usr/share/fonts/truetype/fonts-japanese-gothic.ttf",
+	"/usr/share/fonts/opentype/ipafont-gothic/ipagp.ttf",
+	"/usr/share/fonts/truetype/takao-gothic/TakaoPGothic.ttf",
+	"/System/Library/Fonts/Supplemental/Arial Unicode.ttf",
+	"/Library/Fonts/Arial Unicode.ttf",
+}
+
+// pdfRenderer lays out a page tree on A4 pages.
+type pdfRenderer struct {
+	ctx context.Context
+	pdf *fpdf.Fpdf
+	// font は本文のフォント名（"go" は埋め込みのGoフォント）
+	font string
+	// left はページの左余白。インデントはここからの距離で表す
+	left float64
+	// level は直前のしおり（アウトライン）の階層
+	level  int
+	images int
+}
+
+// writePDF renders a page tree, and the summary if given, as a PDF document.
+func writePDF(ctx context.Context, w io.Writer, title string, tree *PageTree, summary string) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(title, true)
+	pdf.SetCreator("notion-dfs", true)
+	pdf.SetMargins(20, 20, 20)
+	pdf.SetAutoPageBreak(true, 20)
+
+	r := &pdfRenderer{ctx: ctx, pdf: pdf}
+	if err := r.loadFonts(); err != nil {
+		return err
+	}
+	if r.font == "go" {
+		var sb strings.Builder
+		collectContent(tree.Root.Children, &sb)
+		if hasCJK(title + sb.String() + summary) {
+			log.Printf("warning: no Japanese font found, so CJK text will be missing from the PDF; set NOTION_DFS_PDF_FONT to a TrueType (.ttf) font file")
+		}
+	}
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont(r.font, "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("%d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+	r.left, _, _, _ = pdf.GetMargins()
+
+	r.heading(title, 0)
+	r.blocks(tree.Root.Children, 0)
+	if summary != "" {
+		heading := "AI による要約"
+		if r.font == "go" {
+			heading = "AI Summary"
+		}
+		r.heading(heading, 1)
+		r.paragraph(summary, 0)
+	}
+	return pdf.Output(w)
+}
+
+// loadFonts は埋め込みのGoフォントを登録し、日本語フォントがあればそれを本文に使います
+func (r *pdfRenderer) loadFonts() error {
+	r.pdf.AddUTF8FontFromBytes("go", "", goregular.TTF)
+	r.pdf.AddUTF8FontFromBytes("go", "B", gobold.TTF)
+	r.pdf.AddUTF8FontFromBytes("gomono", "", gomono.TTF)
+	r.font = "go"
+
+	path := os.Getenv("NOTION_DFS_PDF_FONT")
+	if path == "" {
+		for _, candidate := range pdfFontCandidates {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+	if path == "" {
+		return r.pdf.Error()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read PDF font: %w", err)
+	}
+	r.pdf.AddUTF8FontFromBytes("custom", "", data)
+	r.pdf.AddUTF8FontFromBytes("custom", "B", data)
+	r.font = "custom"
+	return r.pdf.Error()
+}
+
+// blocks は兄弟ブロックを順に出力します。番号付きリストの番号は連続する項目ごとに数える
+func (r *pdfRenderer) blocks(nodes []*BlockNode, depth int) {
+	number := 0
+	for _, node := range nodes {
+		if _, ok := node.Block.(*notionapi.NumberedListItemBlock); ok {
+			number++
+		} else {
+			number = 0
+		}
+		if r.block(node, depth, number) {
+			r.blocks(node.Children, depth+1)
+		}
+	}
+}
+
+// block は1つのブロックを出力し、子ブロックを続けて出力すべきかを返します
+func (r *pdfRenderer) block(node *BlockNode, depth, number int) bool {
+	switch b := node.Block.(type) {
+	case *notionapi.ParagraphBlock:
+		r.paragraph(renderer.PlainText(b.Paragraph.RichText), depth)
+
+	case *notionapi.Heading1Block:
+		r.heading(toggleMarker(b, "› ")+renderer.PlainText(b.Heading1.RichText), 1)
+
+	case *notionapi.Heading2Block:
+		r.heading(toggleMarker(b, "› ")+renderer.PlainText(b.Heading2.RichText), 2)
+
+	case *notionapi.Heading3Block:
+		r.heading(toggleMarker(b, "› ")+renderer.PlainText(b.Heading3.RichText), 3)
+
+	case *notionapi.BulletedListItemBlock:
+		r.listItem("•", renderer.PlainText(b.BulletedListItem.RichText), depth)
+
+	case *notionapi.NumberedListItemBlock:
+		r.listItem(fmt.Sprintf("%d.", number), renderer.PlainText(b.NumberedListItem.RichText), depth)
+
+	case *notionapi.ToDoBlock:
+		checkbox := "[ ]"
+		if b.ToDo.Checked {
+			checkbox = "[x]"
+		}
+		r.listItem(checkbox, renderer.PlainText(b.ToDo.RichText), depth)
+
+	case *notionapi.ToggleBlock:
+		r.listItem("›", renderer.PlainText(b.Toggle.RichText), depth)
+
+	case *notionapi.ImageBlock:
+		if b.Image.Type == "external" {
+			r.image(b.Image.External.URL, depth)
+		} else if b.Image.Type == "file" {
+			r.image(b.Image.File.URL, depth)
+		}
+
+	case *notionapi.CodeBlock:
+		r.code(renderer.PlainText(b.Code.RichText), depth)
+		if caption := strings.TrimSpace(renderer.PlainText(b.Code.Caption)); caption != "" {
+			r.caption(caption, depth)
+		}
+
+	case *notionapi.QuoteBlock:
+		r.quote(renderer.PlainText(b.Quote.RichText), depth)
+
+	case *notionapi.CalloutBlock:
+		r.callout(renderer.PlainText(b.Callout.RichText), depth)
+
+	case *notionapi.DividerBlock:
+		r.divider()
+
+	case *notionapi.TableBlock:
+		// 行は子ブロックとして取得されるため、ここでまとめて表にする
+		r.table(node.Children, b.Table.HasColumnHeader, depth)
+		return false
+	}
+	return true
+}
+
+func (r *pdfRenderer) setFont(style string, size float64) {
+	r.pdf.SetFont(r.font, style, size)
+}
+
+// indent は左余白を入れ子の深さに合わせ、折り返した行も同じ位置から始まるようにします
+func (r *pdfRenderer) indent(depth int) float64 {
+	x := r.left + float64(depth)*pdfIndent
+	r.pdf.SetLeftMargin(x)
+	r.pdf.SetX(x)
+	return x
+}
+
+func (r *pdfRenderer) heading(text string, level int) {
+	sizes := []float64{20, 16, 14, 12}
+	r.indent(0)
+	r.pdf.Ln(2)
+	size := sizes[level]
+	r.setFont("B", size)
+	// しおりの階層は1段ずつしか深くできない
+	if level > r.level+1 {
+		level = r.level + 1
+	}
+	r.level = level
+	r.pdf.Bookmark(pdfText(text), level, -1)
+	r.pdf.MultiCell(0, size*0.5, pdfText(text), "", "L", false)
+	r.pdf.Ln(2)
+}
+
+func (r *pdfRenderer) paragraph(text string, depth int) {
+	r.indent(depth)
+	r.setFont("", pdfFontSize)
+	r.pdf.MultiCell(0, pdfLineHeight, pdfText(text), "", "L", false)
+	r.pdf.Ln(1.5)
+}
+
+func (r *pdfRenderer) listItem(marker, text string, depth int) {
+	x := r.indent(depth)
+	r.setFont("", pdfFontSize)
+	r.pdf.CellFormat(pdfIndent, pdfLineHeight, marker, "", 0, "L", false, 0, "")
+	r.pdf.SetLeftMargin(x + pdfIndent)
+	r.pdf.MultiCell(0, pdfLineHeight, pdfText(text), "", "L", false)
+	r.pdf.Ln(0.5)
+}
+
+func (r *pdfRenderer) code(text string, depth int) {
+	r.indent(depth)
+	// 等幅のGoフォントには日本語がないため、日本語を含むコードは本文のフォントで出力する
+	font := "gomono"
+	if r.font != "go" && hasCJK(text) {
+		font = r.font
+	}
+	r.pdf.SetFont(font, "", 9)
+	r.pdf.SetFillColor(245, 245, 245)
+	r.pdf.MultiCell(0, 4.5, pdfText(strings.ReplaceAll(text, "\t", "    ")), "", "L", true)
+	r.pdf.Ln(2)
+}
+
+// caption はコードブロックのキャプションを、小さい灰色の文字で出力します（斜体のフォントはない）
+func (r *pdfRenderer) caption(text string, depth int) {
+	r.indent(depth)
+	r.setFont("", 9)
+	r.pdf.SetTextColor(90, 90, 90)
+	r.pdf.MultiCell(0, 4.5, pdfText(text), "", "L", false)
+	r.pdf.SetTextColor(0, 0, 0)
+	r.pdf.Ln(2)
+}
+
+func (r *pdfRenderer) quote(text string, depth int) {
+	x := r.indent(depth)
+	y, page := r.pdf.GetY(), r.pdf.PageNo()
+	r.pdf.SetLeftMargin(x + 4)
+	r.pdf.SetX(x + 4)
+	r.setFont("", pdfFontSize)
+	r.pdf.SetTextColor(90, 90, 90)
+	r.pdf.MultiCell(0, pdfLineHeight, pdfText(text), "", "L", false)
+	r.pdf.SetTextColor(0, 0, 0)
+	// ページをまたいだ場合は線を省略する
+	if r.pdf.PageNo() == page {
+		r.pdf.SetDrawColor(180, 180, 180)
+		r.pdf.SetLineWidth(0.8)
+		r.pdf.Line(x+1, y, x+1, r.pdf.GetY())
+		r.pdf.SetLineWidth(0.2)
+		r.pdf.SetDrawColor(0, 0, 0)
+	}
+	r.pdf.Ln(2)
+}
+
+func (r *pdfRenderer) callout(text string, depth int) {
+	r.indent(depth)
+	r.setFont("", pdfFontSize)
+	r.pdf.SetFillColor(241, 241, 239)
+	r.pdf.MultiCell(0, pdfLineHeight+1, pdfText(text), "", "L", true)
+	r.pdf.Ln(2)
+}
+
+func (r *pdfRenderer) divider() {
+	pageWidth, _ := r.pdf.GetPageSize()
+	_, _, right, _ := r.pdf.GetMargins()
+	y := r.pdf.GetY() + 2
+	r.pdf.SetDrawColor(200, 200, 200)
+	r.pdf.Line(r.left, y, pageWidth-right, y)
+	r.pdf.SetDrawColor(0, 0, 0)
+	r.indent(0)
+	r.pdf.SetY(y + 4)
+}
+
+func (r *pdfRenderer) table(rows []*BlockNode, hasHeader bool, depth int) {
+	cols := 0
+	for _, row := range rows {
+		if tr, ok := row.Block.(*notionapi.TableRowBlock); ok && len(tr.TableRow.Cells) > cols {
+			cols = len(tr.TableRow.Cells)
+		}
+	}
+	if cols == 0 {
+		return
+	}
+
+	x0 := r.indent(depth)
+	pageWidth, pageHeight := r.pdf.GetPageSize()
+	_, _, right, bottom := r.pdf.GetMargins()
+	colWidth := (pageWidth - right - x0) / float64(cols)
+	const lineHeight = 4.5
+
+	y := r.pdf.GetY()
+	for i, row := range rows {
+		tr, ok := row.Block.(*notionapi.TableRowBlock)
+		if !ok {
+			continue
+		}
+		header := hasHeader && i == 0
+		style := ""
+		if header {
+			style = "B"
+		}
+		r.setFont(style, 9)
+
+		// 行の高さは最も行数の多いセルに合わせる
+		cells := make([][]string, cols)
+		lines := 1
+		for c := range cells {
+			if c < len(tr.TableRow.Cells) {
+				cells[c] = r.pdf.SplitText(pdfText(renderer.PlainText(tr.TableRow.Cells[c])), colWidth)
+			}
+			if len(cells[c]) > lines {
+				lines = len(cells[c])
+			}
+		}
+		height := float64(lines)*lineHeight + 2
+		if y+height > pageHeight-bottom {
+			r.pdf.AddPage()
+			y = r.pdf.GetY()
+		}
+
+		r.pdf.SetFillColor(240, 240, 240)
+		for c, text := range cells {
+			x := x0 + float64(c)*colWidth
+			if header {
+				r.pdf.Rect(x, y, colWidth, height, "FD")
+			} else {
+				r.pdf.Rect(x, y, colWidth, height, "D")
+			}
+			for l, line := range text {
+				r.pdf.SetXY(x, y+1+float64(l)*lineHeight)
+				r.pdf.CellFormat(colWidth, lineHeight, line, "", 0, "L", false, 0, "")
+			}
+		}
+		y += height
+	}
+	r.pdf.SetXY(x0, y+3)
+}
+
+// image は画像をダウンロードして埋め込みます。失敗した場合は警告を表示し、URLを本文として出力します
+func (r *pdfRenderer) image(rawURL string, depth int) {
+	data, imageType, width, height, err := fetchRasterImage(r.ctx, rawURL)
+	if err != nil {
+		log.Printf("warning: failed to embed image %s: %v", renderer.StripURLSignature(rawURL), err)
+		r.paragraph("[Image] "+renderer.StripURLSignature(rawURL), depth)
+		return
+	}
+	r.images++
+	name := fmt.Sprintf("image%d", r.images)
+	opts := fpdf.ImageOptions{ImageType: imageType}
+	r.pdf.RegisterImageOptionsReader(name, opts, bytes.NewReader(data))
+
+	// 96dpiとして実寸を求め、ページの幅と高さに収まるよう縮小する
+	x := r.indent(depth)
+	pageWidth, pageHeight := r.pdf.GetPageSize()
+	_, top, right, bottom := r.pdf.GetMargins()
+	w := float64(width) * 25.4 / 96
+	if maxWidth := pageWidth - right - x; w > maxWidth {
+		w = maxWidth
+	}
+	h := w * float64(height) / float64(width)
+	if maxHeight := pageHeight - top - bottom; h > maxHeight {
+		w, h = w*maxHeight/h, maxHeight
+	}
+
+	y := r.pdf.GetY()
+	if y+h > pageHeight-bottom {
+		r.pdf.AddPage()
+		y = r.pdf.GetY()
+	}
+	r.pdf.ImageOptions(name, x, y, w, h, false, opts, 0, "")
+	r.pdf.SetXY(x, y+h+3)
+}
+
+// pdfText はフォントで扱えない基本多言語面の外の文字（絵文字など）を取り除きます
+func pdfText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0xFFFF {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func hasCJK(s string) bool {
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return true
+		}
+	}
+	return false
+}
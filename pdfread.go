@@ -0,0 +1,903 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// extractPDFText returns the text of a PDF file, page by page. It is a small
+// reader for the text of ordinary documents, so that no PDF library is
+// needed: objects are found by scanning the file (including compressed object
+// streams), Flate, ASCIIHex and ASCII85 streams are decoded, and the shown
+// strings of each page's content streams (and form XObjects) are mapped to
+// Unicode with the font's ToUnicode CMap, or as Latin text for simple fonts
+// without one. Line breaks and spaces are inferred from the text positioning.
+// Encrypted PDFs and text drawn as images give an error or no text.
+func extractPDFText(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\r "), []byte("%PDF")) {
+		return "", errors.New("not a PDF file")
+	}
+	doc := &pdfDocument{objects: make(map[int]any), fonts: make(map[pdfRef]*pdfFont)}
+	doc.scanObjects(data)
+	if doc.encrypted {
+		return "", errors.New("the PDF is encrypted")
+	}
+	if doc.catalog == nil {
+		return "", errors.New("no document catalog found in the PDF")
+	}
+
+	var pages []string
+	var walk func(node any, resources pdfDict, depth int)
+	walk = func(node any, resources pdfDict, depth int) {
+		dict, ok := doc.resolve(node).(pdfDict)
+		if !ok || depth > 64 {
+			return
+		}
+		// リソースは親のページツリーのノードから引き継がれる
+		if r, ok := doc.resolve(dict["Resources"]).(pdfDict); ok {
+			resources = r
+		}
+		if kids, ok := doc.resolve(dict["Kids"]).([]any); ok {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		var content []byte
+		switch contents := doc.resolve(dict["Contents"]).(type) {
+		case *pdfStream:
+			content = doc.decode(contents)
+		case []any:
+			for _, c := range contents {
+				if s, ok := doc.resolve(c).(*pdfStream); ok {
+					content = append(append(content, doc.decode(s)...), '\n')
+				}
+			}
+		}
+		var text pdfTextWriter
+		doc.showText(&text, content, resources, 0)
+		pages = append(pages, text.String())
+	}
+	walk(doc.catalog["Pages"], nil, 0)
+	return strings.TrimSpace(strings.Join(pages, "\n\n")), nil
+}
+
+type (
+	pdfDict map[string]any
+	pdfName string
+	pdfRef  struct{ num, gen int }
+	// pdfKeyword はコンテンツストリームの演算子など、値でない語
+	pdfKeyword string
+)
+
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+// pdfDocument はファイル中のオブジェクト（番号ごと）と読み込んだフォントです
+type pdfDocument struct {
+	objects   map[int]any
+	catalog   pdfDict
+	encrypted bool
+	fonts     map[pdfRef]*pdfFont
+}
+
+var pdfObjectStart = regexp.MustCompile(`(?:^|[^0-9])(\d+)\s+(\d+)\s+obj\b`)
+
+// scanObjects はファイル全体から "N G obj" を探してオブジェクトを読み込みます。
+// 相互参照表を使わないため、壊れた相互参照表のファイルも読める（増分更新では後のものが優先される）
+func (doc *pdfDocument) scanObjects(data []byte) {
+	for _, m := range pdfObjectStart.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		p := &pdfParser{data: data, pos: m[1]}
+		obj, err := p.object()
+		if err != nil {
+			continue
+		}
+		if dict, ok := obj.(pdfDict); ok {
+			if stream := p.stream(dict); stream != nil {
+				obj = stream
+			}
+		}
+		doc.objects[num] = obj
+	}
+	// 圧縮されたオブジェクトストリームの中のオブジェクト（直接書かれたものを優先する）
+	for _, obj := range doc.objects {
+		s, ok := obj.(*pdfStream)
+		if !ok || s.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		n, _ := doc.resolve(s.dict["N"]).(int)
+		first, _ := doc.resolve(s.dict["First"]).(int)
+		data := doc.decode(s)
+		if first > len(data) {
+			continue
+		}
+		header := &pdfParser{data: data[:first]}
+		for i := 0; i < n; i++ {
+			num, err1 := header.object()
+			offset, err2 := header.object()
+			objNum, ok1 := num.(int)
+			objOffset, ok2 := offset.(int)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+			if _, exists := doc.objects[objNum]; exists || first+objOffset > len(data) {
+				continue
+			}
+			if obj, err := (&pdfParser{data: data, pos: first + objOffset}).object(); err == nil {
+				doc.objects[objNum] = obj
+			}
+		}
+	}
+	for _, obj := range doc.objects {
+		var dict pdfDict
+		switch o := obj.(type) {
+		case pdfDict:
+			dict = o
+		case *pdfStream:
+			dict = o.dict
+		}
+		if dict["Type"] == pdfName("Catalog") {
+			doc.catalog = dict
+		}
+		// 相互参照ストリームの辞書はトレーラーを兼ねる
+		if _, ok := dict["Encrypt"]; ok && dict["Type"] == pdfName("XRef") {
+			doc.encrypted = true
+		}
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) && pdfTrailerEncrypt.Match(data) {
+		doc.encrypted = true
+	}
+}
+
+var pdfTrailerEncrypt = regexp.MustCompile(`trailer\s*<<[^>]*/Encrypt`)
+
+// resolve は間接参照をたどってオブジェクトを返します
+func (doc *pdfDocument) resolve(v any) any {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = doc.objects[ref.num]
+	}
+	return nil
+}
+
+// decode はストリームのフィルターを順に適用します。対応していないフィルターのストリームは空にする
+func (doc *pdfDocument) decode(s *pdfStream) []byte {
+	var filters []any
+	switch f := doc.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case []any:
+		filters = f
+	}
+	data := s.data
+	for _, f := range filters {
+		switch doc.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil
+			}
+			// 末尾が壊れたストリームも、読めたところまでは使う
+			out, _ := io.ReadAll(zr)
+			data = out
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			hexData := bytes.Map(func(r rune) rune {
+				if strings.ContainsRune("0123456789abcdefABCDEF", r) {
+					return r
+				}
+				return -1
+			}, bytes.TrimSuffix(bytes.TrimSpace(data), []byte(">")))
+			if len(hexData)%2 == 1 {
+				hexData = append(hexData, '0')
+			}
+			out := make([]byte, len(hexData)/2)
+			hex.Decode(out, hexData)
+			data = out
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			src := bytes.TrimSuffix(bytes.TrimSpace(data), []byte("~>"))
+			src = bytes.TrimPrefix(src, []byte("<~"))
+			out := make([]byte, len(src)*4/5+4)
+			n, _, _ := ascii85.Decode(out, src, true)
+			data = out[:n]
+		default:
+			return nil
+		}
+	}
+	return data
+}
+
+// pdfParser はPDFのオブジェクトとコンテンツストリームの字句を読みます
+type pdfParser struct {
+	data []byte
+	pos  int
+}
+
+func pdfIsSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
+}
+
+func pdfIsDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (p *pdfParser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if !pdfIsSpace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+// object は値を1つ読みます。"N G R" は参照に、演算子などは pdfKeyword にする
+func (p *pdfParser) object() (any, error) {
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, io.EOF
+	}
+	c := p.data[p.pos]
+	switch {
+	case c == '/':
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.data) && !pdfIsSpace(p.data[p.pos]) && !pdfIsDelimiter(p.data[p.pos]) {
+			p.pos++
+		}
+		return pdfName(pdfUnescapeName(string(p.data[start:p.pos]))), nil
+	case c == '(':
+		return p.literalString(), nil
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		p.pos += 2
+		dict := pdfDict{}
+		for {
+			p.skipSpace()
+			if p.pos+1 < len(p.data) && p.data[p.pos] == '>' && p.data[p.pos+1] == '>' {
+				p.pos += 2
+				return dict, nil
+			}
+			key, err := p.object()
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(pdfName)
+			if !ok {
+				return nil, fmt.Errorf("invalid dictionary key at %d", p.pos)
+			}
+			value, err := p.object()
+			if err != nil {
+				return nil, err
+			}
+			dict[string(name)] = value
+		}
+	case c == '<':
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.data) && p.data[p.pos] != '>' {
+			p.pos++
+		}
+		hexData := bytes.Map(func(r rune) rune {
+			if pdfIsSpace(byte(r)) {
+				return -1
+			}
+			return r
+		}, p.data[start:p.pos])
+		p.pos++
+		if len(hexData)%2 == 1 {
+			hexData = append(hexData, '0')
+		}
+		out := make([]byte, len(hexData)/2)
+		hex.Decode(out, hexData)
+		return out, nil
+	case c == '[':
+		p.pos++
+		var arr []any
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if p.data[p.pos] == ']' {
+				p.pos++
+				return arr, nil
+			}
+			v, err := p.object()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		p.pos++
+		return pdfKeyword(c), nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.data) && !pdfIsSpace(p.data[p.pos]) && !pdfIsDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	word := string(p.data[start:p.pos])
+	if n, err := strconv.Atoi(word); err == nil {
+		// "N G R" は間接参照
+		save := p.pos
+		if gen, ok := p.integer(); ok {
+			p.skipSpace()
+			if p.pos < len(p.data) && p.data[p.pos] == 'R' && (p.pos+1 == len(p.data) || pdfIsSpace(p.data[p.pos+1]) || pdfIsDelimiter(p.data[p.pos+1])) {
+				p.pos++
+				return pdfRef{n, gen}, nil
+			}
+		}
+		p.pos = save
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if word == "" {
+		p.pos++
+		return pdfKeyword(c), nil
+	}
+	return pdfKeyword(word), nil
+}
+
+func (p *pdfParser) integer() (int, bool) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+		p.pos++
+	}
+	if start == p.pos || (p.pos < len(p.data) && !pdfIsSpace(p.data[p.pos]) && !pdfIsDelimiter(p.data[p.pos])) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(p.data[start:p.pos]))
+	return n, err == nil
+}
+
+// literalString は (...) の文字列を、エスケープと入れ子の括弧を処理して読みます
+func (p *pdfParser) literalString() []byte {
+	p.pos++
+	var out []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return out
+			}
+		case '\\':
+			if p.pos >= len(p.data) {
+				return out
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				// 行末の \ は改行を取り除く
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						n = n*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					out = append(out, byte(n))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// stream は辞書の直後が stream なら、その内容を読みます。/Length が直接の値でなければ endstream を探す
+func (p *pdfParser) stream(dict pdfDict) *pdfStream {
+	p.skipSpace()
+	if !bytes.HasPrefix(p.data[p.pos:], []byte("stream")) {
+		return nil
+	}
+	start := p.pos + len("stream")
+	if start < len(p.data) && p.data[start] == '\r' {
+		start++
+	}
+	if start < len(p.data) && p.data[start] == '\n' {
+		start++
+	}
+	if n, ok := dict["Length"].(int); ok && n >= 0 && start+n <= len(p.data) {
+		rest := bytes.TrimLeft(p.data[start+n:], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			p.pos = start + n
+			return &pdfStream{dict: dict, data: p.data[start : start+n]}
+		}
+	}
+	end := bytes.Index(p.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil
+	}
+	data := bytes.TrimRight(p.data[start:start+end], "\r\n")
+	p.pos = start + end
+	return &pdfStream{dict: dict, data: data}
+}
+
+// pdfUnescapeName は名前の #XX を文字にします
+func pdfUnescapeName(s string) string {
+	if !strings.Contains(s, "#") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '#' && i+2 < len(s) {
+			if b, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				sb.WriteByte(byte(b))
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// pdfTextWriter は取り出したテキストを、行と単語の区切りを整えながらためます
+type pdfTextWriter struct {
+	sb strings.Builder
+	// pending は次のテキストの前に入れる区切り（"" ・" "・"\n"・段落の "\n\n"）
+	pending string
+	// lineY は最後の行の縦位置、lineGap は普段の行間
+	hasLine        bool
+	lineY, lineGap float64
+	// fontSize は文字の大きさ。見出しと本文のように、大きさが変わって改行したところも段落の区切りにする
+	fontSize    float64
+	sizeChanged bool
+}
+
+func (t *pdfTextWriter) setFontSize(size float64) {
+	if size != t.fontSize {
+		t.sizeChanged = t.fontSize != 0
+		t.fontSize = size
+	}
+}
+
+func (t *pdfTextWriter) write(s string) {
+	if s == "" {
+		return
+	}
+	if t.sb.Len() > 0 && t.pending != "" {
+		last := t.sb.String()[t.sb.Len()-1]
+		if !(t.pending == " " && (last == ' ' || last == '\n' || strings.HasPrefix(s, " "))) {
+			t.sb.WriteString(t.pending)
+		}
+	}
+	t.pending = ""
+	t.sb.WriteString(s)
+}
+
+// separate は区切りを予約します。段落の区切りは改行より、改行は空白より優先する
+func (t *pdfTextWriter) separate(sep string) {
+	if len(sep) > len(t.pending) || (sep == "\n" && t.pending == " ") {
+		t.pending = sep
+	}
+}
+
+// line は縦位置 y から行が始まることを記録します。前の行との間隔が普段の行間より大きい場合や、
+// 上に戻った場合（段組みの次の列など）は段落の区切りにする
+func (t *pdfTextWriter) line(y float64) {
+	if !t.hasLine {
+		t.hasLine, t.lineY = true, y
+		t.separate("\n")
+		return
+	}
+	gap := t.lineY - y
+	t.lineY = y
+	sizeChanged := t.sizeChanged
+	t.sizeChanged = false
+	switch {
+	case gap == 0:
+		t.separate(" ")
+	case sizeChanged:
+		t.lineGap = 0
+		t.separate("\n\n")
+	case gap < 0 || (t.lineGap > 0 && gap > t.lineGap*1.5):
+		t.separate("\n\n")
+	default:
+		t.lineGap = gap
+		t.separate("\n")
+	}
+}
+
+func (t *pdfTextWriter) String() string {
+	lines := strings.Split(t.sb.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(pdfBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+var pdfBlankLines = regexp.MustCompile(`\n{3,}`)
+
+// showText はコンテンツストリームを解釈し、表示される文字列をテキストにします
+func (doc *pdfDocument) showText(text *pdfTextWriter, content []byte, resources pdfDict, depth int) {
+	if depth > 8 {
+		return
+	}
+	fonts, _ := doc.resolve(resources["Font"]).(pdfDict)
+	xobjects, _ := doc.resolve(resources["XObject"]).(pdfDict)
+	var font *pdfFont
+	// y はテキスト行列の縦位置、leading は T* の行送り
+	var y, leading float64
+	var operands []any
+	p := &pdfParser{data: content}
+	for {
+		v, err := p.object()
+		if err != nil {
+			break
+		}
+		op, ok := v.(pdfKeyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+		number := func(i int) float64 {
+			if i < 0 || i >= len(operands) {
+				return 0
+			}
+			switch n := operands[i].(type) {
+			case int:
+				return float64(n)
+			case float64:
+				return n
+			}
+			return 0
+		}
+		last := func() any {
+			if len(operands) == 0 {
+				return nil
+			}
+			return operands[len(operands)-1]
+		}
+		switch op {
+		case "BT":
+			y = 0
+			text.separate(" ")
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					font = doc.font(fonts[string(name)])
+				}
+				text.setFontSize(number(len(operands) - 1))
+			}
+		case "Td", "TD":
+			ty := number(len(operands) - 1)
+			if op == "TD" {
+				leading = -ty
+			}
+			if ty != 0 {
+				y += ty
+				text.line(y)
+			} else if number(len(operands)-2) > 0 {
+				text.separate(" ")
+			}
+		case "TL":
+			leading = number(len(operands) - 1)
+		case "Tm":
+			y = number(len(operands) - 1)
+			text.line(y)
+		case "T*":
+			y -= leading
+			text.line(y)
+		case "Tj":
+			if s, ok := last().([]byte); ok {
+				text.write(font.decode(s))
+			}
+		case "'", "\"":
+			y -= leading
+			text.line(y)
+			if s, ok := last().([]byte); ok {
+				text.write(font.decode(s))
+			}
+		case "TJ":
+			arr, _ := last().([]any)
+			for _, item := range arr {
+				switch v := item.(type) {
+				case []byte:
+					text.write(font.decode(v))
+				case int, float64:
+					// 文字幅の1000分の1単位の移動。大きく右に空いていれば単語の区切りとみなす
+					gap := 0.0
+					if n, ok := v.(int); ok {
+						gap = float64(n)
+					} else {
+						gap = v.(float64)
+					}
+					if gap < -200 {
+						text.separate(" ")
+					}
+				}
+			}
+		case "Do":
+			if name, ok := last().(pdfName); ok {
+				if form, ok := doc.resolve(xobjects[string(name)]).(*pdfStream); ok && form.dict["Subtype"] == pdfName("Form") {
+					formResources, ok := doc.resolve(form.dict["Resources"]).(pdfDict)
+					if !ok {
+						formResources = resources
+					}
+					doc.showText(text, doc.decode(form), formResources, depth+1)
+				}
+			}
+		case "BI":
+			// インライン画像のデータは演算子として読まずに飛ばす
+			if end := bytes.Index(content[p.pos:], []byte("EI")); end >= 0 {
+				if id := bytes.Index(content[p.pos:], []byte("ID")); id >= 0 && id < end {
+					for next := p.pos + id + 2; ; {
+						i := bytes.Index(content[next:], []byte("EI"))
+						if i < 0 {
+							p.pos = len(content)
+							break
+						}
+						at := next + i
+						if (at == 0 || pdfIsSpace(content[at-1])) && (at+2 == len(content) || pdfIsSpace(content[at+2])) {
+							p.pos = at + 2
+							break
+						}
+						next = at + 2
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// pdfFont は文字コードからUnicodeへの対応です
+type pdfFont struct {
+	// codeBytes は1文字の文字コードのバイト数（CIDフォントは2）
+	codeBytes int
+	toUnicode map[uint32]string
+	// simple は ToUnicode のない単純なフォント（文字コードをLatin文字として扱う）
+	simple      bool
+	differences map[uint32]string
+}
+
+// font はフォントの辞書を読み込みます（同じフォントは一度だけ読む）
+func (doc *pdfDocument) font(v any) *pdfFont {
+	ref, isRef := v.(pdfRef)
+	if isRef {
+		if f, ok := doc.fonts[ref]; ok {
+			return f
+		}
+	}
+	dict, _ := doc.resolve(v).(pdfDict)
+	f := &pdfFont{codeBytes: 1, toUnicode: make(map[uint32]string)}
+	if dict["Subtype"] == pdfName("Type0") {
+		f.codeBytes = 2
+	}
+	if cmap, ok := doc.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		f.parseCMap(doc.decode(cmap))
+	} else if f.codeBytes == 1 {
+		f.simple = true
+		if enc, ok := doc.resolve(dict["Encoding"]).(pdfDict); ok {
+			if diffs, ok := doc.resolve(enc["Differences"]).([]any); ok {
+				f.differences = make(map[uint32]string)
+				code := 0
+				for _, d := range diffs {
+					switch d := d.(type) {
+					case int:
+						code = d
+					case pdfName:
+						if s := pdfGlyphName(string(d)); s != "" {
+							f.differences[uint32(code)] = s
+						}
+						code++
+					}
+				}
+			}
+		}
+	}
+	if isRef {
+		doc.fonts[ref] = f
+	}
+	return f
+}
+
+// parseCMap は ToUnicode CMap の codespacerange・bfchar・bfrange を読みます
+func (f *pdfFont) parseCMap(data []byte) {
+	p := &pdfParser{data: data}
+	var operands []any
+	for {
+		v, err := p.object()
+		if err != nil {
+			return
+		}
+		op, ok := v.(pdfKeyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			if len(operands) >= 1 {
+				if lo, ok := operands[0].([]byte); ok && len(lo) > 0 {
+					f.codeBytes = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].([]byte)
+				dst, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 {
+					f.toUnicode[pdfCode(src)] = pdfUTF16(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := pdfCode(lo), pdfCode(hi)
+				if end < start || end-start > 0xffff {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case []byte:
+					// 範囲の先頭の文字から、最後の1文字を増やしながら割り当てる
+					units := utf16.Decode(pdfUTF16Units(dst))
+					for code := start; code <= end && len(units) > 0; code++ {
+						f.toUnicode[code] = string(units)
+						units = append([]rune(nil), units...)
+						units[len(units)-1]++
+					}
+				case []any:
+					for j, d := range dst {
+						if b, ok := d.([]byte); ok && start+uint32(j) <= end {
+							f.toUnicode[start+uint32(j)] = pdfUTF16(b)
+						}
+					}
+				}
+			}
+		}
+		if strings.HasPrefix(string(op), "end") || strings.HasPrefix(string(op), "begin") {
+			operands = operands[:0]
+		}
+	}
+}
+
+// decode は表示する文字列をUnicodeにします。対応のわからない文字は出力しない
+func (f *pdfFont) decode(s []byte) string {
+	if f == nil {
+		return pdfLatin(s, nil)
+	}
+	if f.simple {
+		return pdfLatin(s, f.differences)
+	}
+	var sb strings.Builder
+	for i := 0; i+f.codeBytes <= len(s); i += f.codeBytes {
+		if u, ok := f.toUnicode[pdfCode(s[i:i+f.codeBytes])]; ok {
+			sb.WriteString(u)
+		}
+	}
+	return sb.String()
+}
+
+func pdfCode(b []byte) uint32 {
+	var code uint32
+	for _, c := range b {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+func pdfUTF16Units(b []byte) []uint16 {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return units
+}
+
+func pdfUTF16(b []byte) string {
+	return string(utf16.Decode(pdfUTF16Units(b)))
+}
+
+// pdfWinAnsi は WinAnsiEncoding の 0x80〜0x9F の文字（それ以外はLatin-1と同じ）
+var pdfWinAnsi = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ', 0x89: '‰',
+	0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•',
+	0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+// pdfLatin は単純なフォントの文字列を WinAnsiEncoding（と /Differences）で読みます
+func pdfLatin(s []byte, differences map[uint32]string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		if d, ok := differences[uint32(c)]; ok {
+			sb.WriteString(d)
+			continue
+		}
+		if r, ok := pdfWinAnsi[c]; ok {
+			sb.WriteRune(r)
+		} else if c >= 0x20 || c == '\t' {
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+// pdfGlyphNames は /Differences によく使われるグリフ名の文字
+var pdfGlyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%",
+	"ampersand": "&", "quotesingle": "'", "quoteright": "’", "quoteleft": "‘", "parenleft": "(", "parenright": ")",
+	"asterisk": "*", "plus": "+", "comma": ",", "hyphen": "-", "minus": "−", "period": ".", "slash": "/",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6", "seven": "7",
+	"eight": "8", "nine": "9", "colon": ":", "semicolon": ";", "less": "<", "equal": "=", "greater": ">",
+	"question": "?", "at": "@", "bracketleft": "[", "backslash": "\\", "bracketright": "]", "underscore": "_",
+	"braceleft": "{", "bar": "|", "braceright": "}", "asciitilde": "~", "bullet": "•", "endash": "–",
+	"emdash": "—", "quotedblleft": "“", "quotedblright": "”", "ellipsis": "…", "fi": "fi", "fl": "fl",
+	"ff": "ff", "ffi": "ffi", "ffl": "ffl", "degree": "°", "copyright": "©", "registered": "®", "trademark": "™",
+}
+
+// pdfGlyphName はグリフ名を文字にします（"a" のような1文字の名前と "uniXXXX" を含む）
+func pdfGlyphName(name string) string {
+	if s, ok := pdfGlyphNames[name]; ok {
+		return s
+	}
+	if len(name) == 1 {
+		return name
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if n, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return string(rune(n))
+		}
+	}
+	return ""
+}
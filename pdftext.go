@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// pdfTextIcon はPDFの本文・要約を入れるコールアウトの絵文字
+const pdfTextIcon = "📄"
+
+// maxPDFSummaryInput は要約のために送るPDFの本文の上限（文字数）。要約のモデルの入力に収まるよう、長いPDFは先頭だけを使う
+const maxPDFSummaryInput = 6000
+
+// pdfTextExtractor replaces the PDF blocks of a page (and file blocks of
+// PDF files) with a callout that links to the PDF and contains its text, or
+// a summary of the text (--pdf-text), so that pages that are little more
+// than an attached PDF have content in every output format and in the
+// summary. The text is extracted locally by extractPDFText.
+type pdfTextExtractor struct {
+	// summarize は本文の代わりに要約を入れる（--pdf-text summary）
+	summarize bool
+}
+
+// newPDFTextExtractor は --pdf-text の値（full または summary）から作ります
+func newPDFTextExtractor(mode string) (*pdfTextExtractor, error) {
+	switch mode {
+	case "full":
+		return &pdfTextExtractor{}, nil
+	case "summary":
+		if apiKey, _ := openAIKeyCredential.get(); apiKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY is not set (--pdf-text summary summarizes the PDFs with the OpenAI API)")
+		}
+		return &pdfTextExtractor{summarize: true}, nil
+	}
+	return nil, fmt.Errorf("invalid --pdf-text %q (want full or summary)", mode)
+}
+
+// pdfBlockFile はPDFブロック、またはPDFファイルのファイルブロックのファイルとキャプションを返します
+func pdfBlockFile(block notionapi.Block) (string, []notionapi.RichText, bool) {
+	switch b := block.(type) {
+	case *notionapi.PdfBlock:
+		return fileObjectURL(b.Pdf.File, b.Pdf.External), b.Pdf.Caption, true
+	case *notionapi.FileBlock:
+		fileURL := fileObjectURL(b.File.File, b.File.External)
+		if strings.HasSuffix(strings.ToLower(urlFileName(fileURL, "")), ".pdf") {
+			return fileURL, b.File.Caption, true
+		}
+	}
+	return "", nil, false
+}
+
+// fileObjectURL はアップロードされたファイルまたは外部のファイルのURLです
+func fileObjectURL(file, external *notionapi.FileObject) string {
+	if file != nil {
+		return file.URL
+	}
+	if external != nil {
+		return external.URL
+	}
+	return ""
+}
+
+// extractTree はPDFのブロックを本文（または要約）のコールアウトに置き換えます。
+// テキストを取り出せなかったPDF（画像だけのPDFなど）はログに出してそのままにする
+func (x *pdfTextExtractor) extractTree(ctx context.Context, tree *PageTree) {
+	var walk func(nodes []*BlockNode)
+	walk = func(nodes []*BlockNode) {
+		for _, node := range nodes {
+			pdfURL, caption, ok := pdfBlockFile(node.Block)
+			if !ok {
+				walk(node.Children)
+				continue
+			}
+			text, err := x.extract(ctx, pdfURL)
+			if err != nil {
+				log.Printf("Error extracting text from PDF %s: %v", node.Block.GetID(), err)
+				continue
+			}
+			name := strings.TrimSpace(renderer.PlainText(caption))
+			if name == "" {
+				name = urlFileName(pdfURL, "PDF")
+			}
+			label := "PDFの本文: "
+			if x.summarize {
+				label = "PDFの要約: "
+			}
+			emoji := notionapi.Emoji(pdfTextIcon)
+			callout := &notionapi.CalloutBlock{
+				BasicBlock: basicBlock(notionapi.BlockCallout),
+				Callout: notionapi.Callout{
+					RichText: append(displayRichText(label, ""), displayRichText(name, pdfURL)...),
+					Icon:     &notionapi.Icon{Type: "emoji", Emoji: &emoji},
+					Color:    "gray_background",
+				},
+			}
+			// コメントの位置などでブロックを探せるよう、元のブロックのIDを引き継ぐ
+			callout.ID = node.Block.GetID()
+			callout.HasChildren = true
+			node.Block = callout
+			node.Children = nil
+			// 本文は段落ごと（PDFの折り返しの行はつなげる）、要約は行ごとのブロックにする
+			paragraphs := strings.Split(text, "\n\n")
+			if x.summarize {
+				paragraphs = strings.Split(text, "\n")
+			}
+			for _, paragraph := range paragraphs {
+				if paragraph = joinPDFLines(paragraph); paragraph == "" {
+					continue
+				}
+				var block notionapi.Block
+				// 要約は箇条書きで返ってくるため、箇条書きの行はリストにする
+				if item, ok := pdfSummaryItem(paragraph); x.summarize && ok {
+					block = &notionapi.BulletedListItemBlock{
+						BasicBlock:       basicBlock(notionapi.BlockTypeBulletedListItem),
+						BulletedListItem: notionapi.ListItem{RichText: displayRichText(item, "")},
+					}
+				} else {
+					block = &notionapi.ParagraphBlock{
+						BasicBlock: basicBlock(notionapi.BlockTypeParagraph),
+						Paragraph:  notionapi.Paragraph{RichText: displayRichText(paragraph, "")},
+					}
+				}
+				node.Children = append(node.Children, &BlockNode{Block: block, Parent: node})
+			}
+		}
+	}
+	walk(tree.Root.Children)
+}
+
+// joinPDFLines は段落の行をつなげます。英数字どうしの間には空白を入れ、日本語の間には入れない
+func joinPDFLines(paragraph string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(paragraph, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			prev, _ := utf8.DecodeLastRuneInString(sb.String())
+			next, _ := utf8.DecodeRuneInString(line)
+			if prev < utf8.RuneSelf || next < utf8.RuneSelf {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// pdfSummaryItem は "- ..."・"* ..."・"・..." の行の箇条書きの本文を返します
+func pdfSummaryItem(line string) (string, bool) {
+	for _, marker := range []string{"- ", "* ", "• ", "・"} {
+		if item, ok := strings.CutPrefix(line, marker); ok {
+			return strings.TrimSpace(item), true
+		}
+	}
+	return "", false
+}
+
+// extract はPDFをダウンロードしてテキストを取り出し、summary なら要約を返します
+func (x *pdfTextExtractor) extract(ctx context.Context, rawURL string) (string, error) {
+	if rawURL == "" {
+		return "", fmt.Errorf("the PDF has no URL")
+	}
+	data, _, err := fetchURL(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	text, err := extractPDFText(data)
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return "", fmt.Errorf("no text found in the PDF (it may consist of scanned images)")
+	}
+	if !x.summarize {
+		return text, nil
+	}
+	if runes := []rune(text); len(runes) > maxPDFSummaryInput {
+		text = string(runes[:maxPDFSummaryInput])
+	}
+	summary, err := summarizeContent(text)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(summary), nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// pluginPrefix は出力形式のプラグインの実行ファイル名の接頭辞（--format cms なら notion-dfs-cms）
+const pluginPrefix = "notion-dfs-"
+
+// pluginProtocolVersion は標準入力に渡すJSONの形式のバージョン。互換性のない変更をしたら上げる
+const pluginProtocolVersion = 1
+
+// findFormatPlugin looks up the executable for a --format that is not built
+// in: notion-dfs-<format> in NOTION_DFS_PLUGIN_DIR, then on PATH. Plugins are
+// separate programs, in any language, so that exporters for formats such as
+// proprietary CMSs do not have to be compiled into this binary.
+func findFormatPlugin(format string) (string, error) {
+	if strings.ContainsAny(format, `/\`) {
+		return "", fmt.Errorf("unknown format: %s", format)
+	}
+	name := pluginPrefix + format
+	if dir := os.Getenv("NOTION_DFS_PLUGIN_DIR"); dir != "" {
+		if path, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return path, nil
+		}
+	}
+	path, err := exec.LookPath(name)
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("unknown format: %s (no %s plugin found in NOTION_DFS_PLUGIN_DIR or PATH)", format, name)
+	}
+	return path, err
+}
+
+// pluginInput は標準入力からプラグインに渡すページ
+type pluginInput struct {
+	Version int        `json:"version"`
+	Page    pluginPage `json:"page"`
+	// Blocks は --format raw と同じ、APIのブロックオブジェクトに children を入れ子にしたもの
+	Blocks json.RawMessage `json:"blocks"`
+	// Markdown は組み込みのレンダラーで出力したMarkdown（プラグインがそのまま使えるように）
+	Markdown string `json:"markdown"`
+	Summary  string `json:"summary,omitempty"`
+	// StructuredSummary は --summary-format json の要約
+	StructuredSummary *structuredSummary `json:"structured_summary,omitempty"`
+}
+
+type pluginPage struct {
+	ID             string            `json:"id"`
+	Title          string            `json:"title"`
+	URL            string            `json:"url"`
+	CreatedTime    time.Time         `json:"created_time"`
+	LastEditedTime time.Time         `json:"last_edited_time"`
+	Properties     map[string]string `json:"properties"`
+}
+
+// writePagePlugin はページをJSONにしてプラグインの標準入力に渡し、プラグインの標準出力を w に書き出します
+func writePagePlugin(ctx context.Context, w io.Writer, pageID notionapi.BlockID, format, plugin string, opts exportOptions) error {
+	capture := newRawCapture(http.DefaultTransport)
+	client := opts.notionClient(notionapi.WithHTTPClient(&http.Client{Transport: capture}))
+	page, err := client.Page.Get(ctx, notionapi.PageID(pageID))
+	if err != nil {
+		return err
+	}
+	tree, err := fetchExportTree(ctx, client, pageID, opts)
+	if err != nil {
+		return err
+	}
+
+	input := pluginInput{
+		Version: pluginProtocolVersion,
+		Page: pluginPage{
+			ID:             string(pageID),
+			Title:          propertyTitle(page),
+			URL:            page.URL,
+			CreatedTime:    page.CreatedTime,
+			LastEditedTime: page.LastEditedTime,
+			Properties:     pageProperties(ctx, client, page, opts.relations),
+		},
+	}
+	var blocks bytes.Buffer
+	if err := writeRawTree(&blocks, tree, capture, opts.stripVolatile); err != nil {
+		return err
+	}
+	input.Blocks = blocks.Bytes()
+	var markdown strings.Builder
+	opts.markdownRenderer().PrintBlocks(&markdown, tree.Root.Children, 0)
+	input.Markdown = markdown.String()
+	if !opts.noSummary {
+		content, err := summaryInput(tree.Root.Children, opts.summarizePerSection)
+		switch {
+		case err != nil:
+			log.Printf("Error generating summary: %v", err)
+		case opts.summaryFormat == "json":
+			if input.StructuredSummary, err = summarizeStructured(content); err != nil {
+				log.Printf("Error generating summary: %v", err)
+			} else {
+				input.Summary = input.StructuredSummary.text()
+			}
+		default:
+			if input.Summary, err = summarizeContent(content); err != nil {
+				log.Printf("Error generating summary: %v", err)
+			}
+		}
+	}
+
+	data, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, plugin)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(pluginEnv(), "NOTION_DFS_FORMAT="+format)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("plugin %s failed: %w", filepath.Base(plugin), err)
+	}
+	return nil
+}
+
+// pluginEnv はプラグインに渡す環境変数。プラグインはAPIを呼ぶ必要がないため、トークンは渡さない
+func pluginEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if name == notionTokenCredential.env || name == openAIKeyCredential.env {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
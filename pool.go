@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// workPool runs tasks on at most n goroutines; tasks may add more tasks.
+// The first error cancels the context of the other tasks and is returned by
+// wait. With n == 1 each task runs right away in the goroutine that adds it,
+// so the work happens in the same order as plain recursion.
+type workPool struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+func newWorkPool(ctx context.Context, n int) *workPool {
+	ctx, cancel := context.WithCancel(ctx)
+	return &workPool{ctx: ctx, cancel: cancel, sem: make(chan struct{}, n)}
+}
+
+func (w *workPool) add(task func(ctx context.Context) error) {
+	if cap(w.sem) == 1 {
+		w.run(task)
+		return
+	}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		select {
+		case w.sem <- struct{}{}:
+		case <-w.ctx.Done():
+			w.fail(w.ctx.Err())
+			return
+		}
+		defer func() { <-w.sem }()
+		w.run(task)
+	}()
+}
+
+func (w *workPool) run(task func(ctx context.Context) error) {
+	if err := w.ctx.Err(); err != nil {
+		w.fail(err)
+		return
+	}
+	if err := task(w.ctx); err != nil {
+		w.fail(err)
+	}
+}
+
+// fail は最初のエラーを記録し、残りのタスクを止めます
+func (w *workPool) fail(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+		w.cancel()
+	}
+}
+
+// wait はすべてのタスクが終わるのを待ち、最初のエラーを返します
+func (w *workPool) wait() error {
+	w.wg.Wait()
+	w.cancel()
+	return w.err
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sync"
+)
+
+// profiler は --cpuprofile・--memprofile・--pprof で始めたプロファイリング
+type profiler struct {
+	mu      sync.Mutex
+	cpuFile string
+	cpu     *os.File
+	memFile string
+	addr    string
+}
+
+var activeProfiler profiler
+
+// startProfiling starts writing a CPU profile to cpuFile, arranges for a
+// heap profile to be written to memFile when the command finishes, and
+// serves the net/http/pprof handlers on addr, so that the memory growth and
+// the hot paths of the export of a large workspace can be examined with
+// go tool pprof. Empty arguments, and profiling already started with the
+// same setting (from the NOTION_DFS_* environment variables), are skipped.
+func startProfiling(cpuFile, memFile, addr string) error {
+	p := &activeProfiler
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cpuFile != "" && cpuFile != p.cpuFile {
+		if p.cpu != nil {
+			return fmt.Errorf("a CPU profile is already being written to %s", p.cpuFile)
+		}
+		f, err := os.Create(cpuFile)
+		if err != nil {
+			return fmt.Errorf("failed to create the CPU profile: %w", err)
+		}
+		if err := runtimepprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to start the CPU profile: %w", err)
+		}
+		p.cpuFile, p.cpu = cpuFile, f
+	}
+	if memFile != "" {
+		p.memFile = memFile
+	}
+	if addr != "" && addr != p.addr {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for pprof: %w", err)
+		}
+		// http.DefaultServeMux には登録しない（serve などのハンドラーと混ざらないように）
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		log.Printf("serving pprof on http://%s/debug/pprof/", ln.Addr())
+		go func() {
+			if err := http.Serve(ln, mux); err != nil {
+				log.Printf("warning: pprof server stopped: %v", err)
+			}
+		}()
+		p.addr = addr
+	}
+	return nil
+}
+
+// addProfilingFlags adds --pprof, --cpuprofile and --memprofile to a
+// subcommand, like the flags of the main command. Profiling starts as soon
+// as the flag is parsed.
+func addProfilingFlags(fs *flag.FlagSet) {
+	fs.Func("pprof", "serve the Go pprof handlers at http://<addr>/debug/pprof/ while running, e.g. :6060 (default: $NOTION_DFS_PPROF)", func(v string) error {
+		return startProfiling("", "", v)
+	})
+	fs.Func("cpuprofile", "write a CPU profile to this file, for go tool pprof (default: $NOTION_DFS_CPUPROFILE)", func(v string) error {
+		return startProfiling(v, "", "")
+	})
+	fs.Func("memprofile", "write a heap profile to this file when the command finishes, also when it fails (default: $NOTION_DFS_MEMPROFILE)", func(v string) error {
+		return startProfiling("", v, "")
+	})
+}
+
+// stopProfiling は CPU プロファイルを閉じ、ヒーププロファイルを書き出します。何度呼んでもよい
+func stopProfiling() {
+	p := &activeProfiler
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cpu != nil {
+		runtimepprof.StopCPUProfile()
+		if err := p.cpu.Close(); err != nil {
+			log.Printf("warning: failed to write the CPU profile: %v", err)
+		}
+		p.cpu = nil
+	}
+	if p.memFile != "" {
+		if err := writeHeapProfile(p.memFile); err != nil {
+			log.Printf("warning: failed to write the memory profile: %v", err)
+		}
+		p.memFile = ""
+	}
+}
+
+func writeHeapProfile(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	// 直近のGCの後の状態を記録するため、先にGCする
+	runtime.GC()
+	if err := runtimepprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
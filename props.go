@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// runProps handles the page property subcommands.
+func runProps(args []string) {
+	fs := flag.NewFlagSet("props set", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "print the Notion API request that would update the page instead of sending it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs props set [--dry-run] <page-id> Name=value...")
+		fmt.Fprintln(os.Stderr, "\nValues are converted according to the property type (select, status, date, number, checkbox, ...).")
+		fmt.Fprintln(os.Stderr, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "set" {
+		fs.Usage()
+		exit(1)
+	}
+	positional := parseInterspersed(fs, args[1:])
+	if len(positional) < 2 {
+		fs.Usage()
+		exit(1)
+	}
+	if *dryRun {
+		enableDryRun()
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	pageID := notionapi.PageID(formatPageID(positional[0]))
+	page, err := client.Page.Get(ctx, pageID)
+	if err != nil {
+		exitWithNotionError("Error fetching page", err)
+	}
+	properties := notionapi.Properties{}
+	if err := pagePropertyTypes(page).setProperties(positional[1:], properties); err != nil {
+		fatal(err)
+	}
+	page, err = client.Page.Update(ctx, pageID, &notionapi.PageUpdateRequest{Properties: properties})
+	if err != nil {
+		exitWithNotionError("Error updating page", err)
+	}
+	fmt.Println(page.URL)
+}
+
+// propertyValue is a property value to send to the API. The notionapi types
+// cannot express every value (a date without a time, or clearing a
+// property with null), so the value is written as the JSON the API expects.
+type propertyValue struct {
+	typ   notionapi.PropertyType
+	value any
+}
+
+func (p propertyValue) GetID() string                   { return "" }
+func (p propertyValue) GetType() notionapi.PropertyType { return p.typ }
+
+func (p propertyValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{string(p.typ): p.value})
+}
+
+// propertyTypes はプロパティ名から種類への対応（データベースのスキーマ、またはページのプロパティから作る）
+type propertyTypes map[string]notionapi.PropertyConfigType
+
+func schemaPropertyTypes(schema notionapi.PropertyConfigs) propertyTypes {
+	types := make(propertyTypes, len(schema))
+	for name, config := range schema {
+		types[name] = config.GetType()
+	}
+	return types
+}
+
+func pagePropertyTypes(page *notionapi.Page) propertyTypes {
+	types := make(propertyTypes, len(page.Properties))
+	for name, prop := range page.Properties {
+		types[name] = notionapi.PropertyConfigType(prop.GetType())
+	}
+	return types
+}
+
+// lookup はプロパティ名で種類を探します。完全一致がなければ大文字小文字を区別せずに探し、
+// "title" はタイトルのプロパティの名前が何であってもそれに一致する
+func (t propertyTypes) lookup(name string) (string, notionapi.PropertyConfigType, bool) {
+	if typ, ok := t[name]; ok {
+		return name, typ, true
+	}
+	for key, typ := range t {
+		if strings.EqualFold(key, name) {
+			return key, typ, true
+		}
+	}
+	if strings.EqualFold(name, "title") {
+		for key, typ := range t {
+			if typ == notionapi.PropertyConfigTypeTitle {
+				return key, typ, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// unknownPropertyError はあるプロパティの名前を添えたエラーを返します
+func (t propertyTypes) unknownPropertyError(name string) error {
+	names := make([]string, 0, len(t))
+	for key := range t {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown property %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// setProperties は "Name=value" の形式の値を種類に従って変換し、properties に設定します
+func (t propertyTypes) setProperties(props []string, properties notionapi.Properties) error {
+	for _, prop := range props {
+		// 値には "=" を含められるが、名前には含められない
+		name, value, ok := strings.Cut(prop, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid property %q: expected Name=value", prop)
+		}
+		key, typ, ok := t.lookup(name)
+		if !ok {
+			return t.unknownPropertyError(name)
+		}
+		p, err := parsePropertyValue(typ, splitPropertyValues(typ, value))
+		if err != nil {
+			return fmt.Errorf("property %q: %w", key, err)
+		}
+		properties[key] = p
+	}
+	return nil
+}
+
+// parsePropertyValue converts values given on the command line into a value
+// for a property of type typ. Properties that hold lists (multi-select,
+// relation, people and files) take one value per element; the others take
+// a single value, and an empty value clears the property where the API
+// allows it.
+func parsePropertyValue(typ notionapi.PropertyConfigType, values []string) (notionapi.Property, error) {
+	p := propertyValue{typ: notionapi.PropertyType(typ)}
+	single := strings.TrimSpace(strings.Join(values, ","))
+	switch typ {
+	case notionapi.PropertyConfigTypeTitle, notionapi.PropertyConfigTypeRichText:
+		p.value = plainRichText(strings.Join(values, ","))
+
+	case notionapi.PropertyConfigTypeNumber:
+		if single != "" {
+			n, err := strconv.ParseFloat(single, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q", single)
+			}
+			p.value = n
+		}
+
+	case notionapi.PropertyConfigTypeSelect, notionapi.PropertyConfigStatus:
+		if single != "" {
+			p.value = map[string]string{"name": single}
+		}
+
+	case notionapi.PropertyConfigTypeMultiSelect:
+		options := []map[string]string{}
+		for _, v := range values {
+			options = append(options, map[string]string{"name": v})
+		}
+		p.value = options
+
+	case notionapi.PropertyConfigTypeDate:
+		if single != "" {
+			date, err := parseDateValue(single)
+			if err != nil {
+				return nil, err
+			}
+			p.value = date
+		}
+
+	case notionapi.PropertyConfigTypeCheckbox:
+		b, err := parseBoolValue(single)
+		if err != nil {
+			return nil, err
+		}
+		p.value = b
+
+	case notionapi.PropertyConfigTypeURL, notionapi.PropertyConfigTypeEmail, notionapi.PropertyConfigTypePhoneNumber:
+		if single != "" {
+			p.value = single
+		}
+
+	case notionapi.PropertyConfigTypePeople:
+		people := []map[string]string{}
+		for _, v := range values {
+			people = append(people, map[string]string{"object": "user", "id": formatPageID(v)})
+		}
+		p.value = people
+
+	case notionapi.PropertyConfigTypeRelation:
+		pages := []map[string]string{}
+		for _, v := range values {
+			pages = append(pages, map[string]string{"id": formatPageID(v)})
+		}
+		p.value = pages
+
+	case notionapi.PropertyConfigTypeFiles:
+		// APIではファイルをアップロードできないため、外部のURLとして設定する
+		files := []map[string]any{}
+		for _, v := range values {
+			files = append(files, map[string]any{"name": path.Base(v), "type": "external", "external": map[string]string{"url": v}})
+		}
+		p.value = files
+
+	default:
+		return nil, fmt.Errorf("%s properties cannot be set", typ)
+	}
+	return p, nil
+}
+
+// splitPropertyValues はコマンドラインの値をカンマで要素に分けます（リストを持つプロパティのみ）
+func splitPropertyValues(typ notionapi.PropertyConfigType, value string) []string {
+	switch typ {
+	case notionapi.PropertyConfigTypeMultiSelect, notionapi.PropertyConfigTypeRelation,
+		notionapi.PropertyConfigTypePeople, notionapi.PropertyConfigTypeFiles:
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+	return []string{value}
+}
+
+// parseDateValue は "2024-01-02"、"2024-01-02 15:04"、RFC 3339 の日時と、"start/end" 形式の期間を受け付けます
+func parseDateValue(value string) (map[string]any, error) {
+	start, end, isRange := strings.Cut(value, "/")
+	s, err := parseDatePart(start)
+	if err != nil {
+		return nil, err
+	}
+	date := map[string]any{"start": s}
+	if isRange {
+		if date["end"], err = parseDatePart(end); err != nil {
+			return nil, err
+		}
+	}
+	return date, nil
+}
+
+// parseDatePart は日付はそのまま、日時は RFC 3339 にします。タイムゾーンのない日時はローカルのタイムゾーンとして扱う
+func parseDatePart(v string) (string, error) {
+	v = strings.TrimSpace(v)
+	if _, err := time.Parse("2006-01-02", v); err == nil {
+		return v, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Format(time.RFC3339), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", v, time.Local)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q (use YYYY-MM-DD, YYYY-MM-DD HH:MM or RFC 3339)", v)
+	}
+	return t.Format(time.RFC3339), nil
+}
+
+func parseBoolValue(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "y", "on", "✓", "✔":
+		return true, nil
+	case "no", "n", "off", "":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid checkbox value %q (use true or false)", value)
+	}
+	return b, nil
+}
+
+// stringList は繰り返し指定できるフラグの値
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ", ") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// parseInterspersed はフラグと位置引数が混在していても（"db add <id> --prop ..." のように）すべてのフラグを解析し、
+// 位置引数を返します
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		parseFlags(fs, args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
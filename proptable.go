@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// pagePropertyTable is the table of a database row's properties written
+// before the content with --properties. Each row is the property name and
+// its value as rich text, so that the Markdown and HTML renderers handle the
+// escaping, links and colors (of select and status options) as they do for
+// table blocks.
+type pagePropertyTable struct {
+	rows [][][]notionapi.RichText
+	// people は人物のプロパティの行の番号から、そのユーザー（writeHTML でアバターとメールアドレスを出力するため）
+	people map[int][]notionapi.User
+}
+
+// fetchPropertyTable はページのプロパティ（タイトル以外、名前順）の表を作ります。プロパティがなければ nil
+func fetchPropertyTable(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, opts relationOptions) (*pagePropertyTable, error) {
+	page, err := client.Page.Get(ctx, notionapi.PageID(pageID))
+	if err != nil {
+		return nil, err
+	}
+	names := sortedPropertyNames(page)
+	if len(names) <= 1 {
+		return nil, nil
+	}
+	groups := statusGroups(ctx, client, page)
+	workspaceUsers(client).resolvePeople(ctx, client, page)
+	d := workspacePages(client)
+	d.resolve(ctx, client, page, opts.depth)
+
+	t := &pagePropertyTable{
+		rows:   [][][]notionapi.RichText{{displayRichText("プロパティ", ""), displayRichText("値", "")}},
+		people: make(map[int][]notionapi.User),
+	}
+	for _, name := range names {
+		prop := page.Properties[name]
+		if prop.GetType() == notionapi.PropertyTypeTitle {
+			continue
+		}
+		if p, ok := prop.(*notionapi.PeopleProperty); ok {
+			t.people[len(t.rows)] = p.People
+		}
+		t.rows = append(t.rows, [][]notionapi.RichText{displayRichText(name, ""), d.propertyRichText(prop, opts, groups)})
+	}
+	return t, nil
+}
+
+// statusGroups はページのデータベースのステータスのプロパティについて、選択肢のIDからグループ名への対応を返します。
+// ステータスのプロパティがないか、データベースを取得できなければ nil
+func statusGroups(ctx context.Context, client *notionapi.Client, page *notionapi.Page) map[notionapi.ObjectID]string {
+	hasStatus := false
+	for _, prop := range page.Properties {
+		if _, ok := prop.(*notionapi.StatusProperty); ok {
+			hasStatus = true
+		}
+	}
+	if !hasStatus || page.Parent.DatabaseID == "" {
+		return nil
+	}
+	db, err := client.Database.Get(ctx, page.Parent.DatabaseID)
+	if err != nil {
+		log.Printf("warning: could not fetch the database for the groups of status properties: %v", err)
+		return nil
+	}
+	groups := make(map[notionapi.ObjectID]string)
+	for _, config := range db.Properties {
+		status, ok := config.(*notionapi.StatusPropertyConfig)
+		if !ok {
+			continue
+		}
+		for _, group := range status.Status.Groups {
+			for _, id := range group.OptionIDs {
+				groups[id] = group.Name
+			}
+		}
+	}
+	return groups
+}
+
+// propertyRichText はプロパティの値をリッチテキストにします。セレクト・ステータスの選択肢は Notion の色を付け、
+// ステータスはグループ名を添え、リレーションは links なら関連先へのリンクにする
+func (d *pageDirectory) propertyRichText(prop notionapi.Property, opts relationOptions, groups map[notionapi.ObjectID]string) []notionapi.RichText {
+	switch p := prop.(type) {
+	case *notionapi.SelectProperty:
+		if p.Select.Name == "" {
+			return nil
+		}
+		return coloredRichText(p.Select.Name, p.Select.Color)
+	case *notionapi.MultiSelectProperty:
+		var rt []notionapi.RichText
+		for i, opt := range p.MultiSelect {
+			if i > 0 {
+				rt = append(rt, displayRichText(", ", "")...)
+			}
+			rt = append(rt, coloredRichText(opt.Name, opt.Color)...)
+		}
+		return rt
+	case *notionapi.StatusProperty:
+		if p.Status.Name == "" {
+			return nil
+		}
+		text := p.Status.Name
+		if group := groups[notionapi.ObjectID(p.Status.ID)]; group != "" && group != p.Status.Name {
+			text += " (" + group + ")"
+		}
+		return coloredRichText(text, p.Status.Color)
+	case *notionapi.RelationProperty:
+		if !opts.links || opts.depth <= 0 {
+			break
+		}
+		var rt []notionapi.RichText
+		for i, r := range p.Relation {
+			if i > 0 {
+				rt = append(rt, displayRichText(", ", "")...)
+			}
+			link := ""
+			if target, ok := d.cached(r.ID); ok {
+				link = target.URL
+			}
+			rt = append(rt, displayRichText(d.relationTitle(r.ID, false), link)...)
+		}
+		return rt
+	}
+	return displayRichText(d.propertyText(prop, relationOptions{depth: opts.depth}), "")
+}
+
+// coloredRichText は選択肢の色（"default" 以外）を文字色にしたテキストです
+func coloredRichText(s string, color notionapi.Color) []notionapi.RichText {
+	rt := displayRichText(s, "")
+	if color != notionapi.ColorDefault {
+		for i := range rt {
+			rt[i].Annotations = &notionapi.Annotations{Color: color}
+		}
+	}
+	return rt
+}
+
+// writeMarkdown は表を Markdown のテーブル（--md-flavor で表がなければHTML）として書きます
+func (t *pagePropertyTable) writeMarkdown(w io.Writer, r *renderer.Markdown) {
+	r.PrintTable(w, t.rows, true, true)
+}
+
+// writeHTML は表をHTMLの <table> として書きます（Confluence のストレージ形式）。
+// people なら人物のプロパティにアバターを添え、名前をメールアドレスへのリンクにする
+func (t *pagePropertyTable) writeHTML(w io.Writer, people bool) {
+	fmt.Fprintln(w, "<table><tbody>")
+	for i, row := range t.rows {
+		var sb strings.Builder
+		for j, cell := range row {
+			tag := "td"
+			if i == 0 || j == 0 {
+				tag = "th"
+			}
+			html := htmlRichText(cell)
+			if users, ok := t.people[i]; ok && people && j == 1 {
+				html = peopleHTML(users)
+			}
+			fmt.Fprintf(&sb, "<%s>%s</%s>", tag, html, tag)
+		}
+		fmt.Fprintf(w, "<tr>%s</tr>\n", sb.String())
+	}
+	fmt.Fprintln(w, "</tbody></table>")
+}
+
+// peopleHTML はユーザーを、アバター（あれば）と名前（メールアドレスがあれば mailto: のリンク）のカンマ区切りにします
+func peopleHTML(users []notionapi.User) string {
+	parts := make([]string, 0, len(users))
+	for _, user := range users {
+		var s string
+		if user.AvatarURL != "" {
+			s = fmt.Sprintf("<ac:image ac:height=\"16\" ac:alt=\"\"><ri:url ri:value=\"%s\"/></ac:image> ", renderer.EscapeHTML(user.AvatarURL))
+		}
+		name := renderer.EscapeHTML(firstNonEmpty(user.Name, string(user.ID)))
+		if user.Person != nil && user.Person.Email != "" {
+			name = fmt.Sprintf("<a href=\"mailto:%s\">%s</a>", renderer.EscapeHTML(user.Person.Email), name)
+		}
+		parts = append(parts, s+name)
+	}
+	return strings.Join(parts, ", ")
+}
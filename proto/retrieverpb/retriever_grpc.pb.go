@@ -0,0 +1,250 @@
+// notion-dfs の gRPC API（notion-dfs serve --grpc）。
+// サーバーは proto/retrieverpb に生成したコードで実装しています。変更したら go generate で作り直してください。
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: retriever.proto
+
+package retrieverpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Retriever_GetPage_FullMethodName       = "/notiondfs.v1.Retriever/GetPage"
+	Retriever_RenderPage_FullMethodName    = "/notiondfs.v1.Retriever/RenderPage"
+	Retriever_SummarizePage_FullMethodName = "/notiondfs.v1.Retriever/SummarizePage"
+	Retriever_ExportTree_FullMethodName    = "/notiondfs.v1.Retriever/ExportTree"
+)
+
+// RetrieverClient is the client API for Retriever service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RetrieverClient interface {
+	// GetPage はページのタイトル・URL・日時・プロパティを返します
+	GetPage(ctx context.Context, in *GetPageRequest, opts ...grpc.CallOption) (*Page, error)
+	// RenderPage はページを指定した形式で出力します
+	RenderPage(ctx context.Context, in *RenderPageRequest, opts ...grpc.CallOption) (*RenderPageResponse, error)
+	// SummarizePage はページのAIによる要約を返します
+	SummarizePage(ctx context.Context, in *SummarizePageRequest, opts ...grpc.CallOption) (*SummarizePageResponse, error)
+	// ExportTree はページとその子ページをMarkdownで、親から子の順に1ページずつ返します
+	ExportTree(ctx context.Context, in *ExportTreeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExportedPage], error)
+}
+
+type retrieverClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRetrieverClient(cc grpc.ClientConnInterface) RetrieverClient {
+	return &retrieverClient{cc}
+}
+
+func (c *retrieverClient) GetPage(ctx context.Context, in *GetPageRequest, opts ...grpc.CallOption) (*Page, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Page)
+	err := c.cc.Invoke(ctx, Retriever_GetPage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *retrieverClient) RenderPage(ctx context.Context, in *RenderPageRequest, opts ...grpc.CallOption) (*RenderPageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RenderPageResponse)
+	err := c.cc.Invoke(ctx, Retriever_RenderPage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *retrieverClient) SummarizePage(ctx context.Context, in *SummarizePageRequest, opts ...grpc.CallOption) (*SummarizePageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SummarizePageResponse)
+	err := c.cc.Invoke(ctx, Retriever_SummarizePage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *retrieverClient) ExportTree(ctx context.Context, in *ExportTreeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExportedPage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Retriever_ServiceDesc.Streams[0], Retriever_ExportTree_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportTreeRequest, ExportedPage]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Retriever_ExportTreeClient = grpc.ServerStreamingClient[ExportedPage]
+
+// RetrieverServer is the server API for Retriever service.
+// All implementations must embed UnimplementedRetrieverServer
+// for forward compatibility.
+type RetrieverServer interface {
+	// GetPage はページのタイトル・URL・日時・プロパティを返します
+	GetPage(context.Context, *GetPageRequest) (*Page, error)
+	// RenderPage はページを指定した形式で出力します
+	RenderPage(context.Context, *RenderPageRequest) (*RenderPageResponse, error)
+	// SummarizePage はページのAIによる要約を返します
+	SummarizePage(context.Context, *SummarizePageRequest) (*SummarizePageResponse, error)
+	// ExportTree はページとその子ページをMarkdownで、親から子の順に1ページずつ返します
+	ExportTree(*ExportTreeRequest, grpc.ServerStreamingServer[ExportedPage]) error
+	mustEmbedUnimplementedRetrieverServer()
+}
+
+// UnimplementedRetrieverServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRetrieverServer struct{}
+
+func (UnimplementedRetrieverServer) GetPage(context.Context, *GetPageRequest) (*Page, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPage not implemented")
+}
+func (UnimplementedRetrieverServer) RenderPage(context.Context, *RenderPageRequest) (*RenderPageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenderPage not implemented")
+}
+func (UnimplementedRetrieverServer) SummarizePage(context.Context, *SummarizePageRequest) (*SummarizePageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SummarizePage not implemented")
+}
+func (UnimplementedRetrieverServer) ExportTree(*ExportTreeRequest, grpc.ServerStreamingServer[ExportedPage]) error {
+	return status.Errorf(codes.Unimplemented, "method ExportTree not implemented")
+}
+func (UnimplementedRetrieverServer) mustEmbedUnimplementedRetrieverServer() {}
+func (UnimplementedRetrieverServer) testEmbeddedByValue()                   {}
+
+// UnsafeRetrieverServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RetrieverServer will
+// result in compilation errors.
+type UnsafeRetrieverServer interface {
+	mustEmbedUnimplementedRetrieverServer()
+}
+
+func RegisterRetrieverServer(s grpc.ServiceRegistrar, srv RetrieverServer) {
+	// If the following call pancis, it indicates UnimplementedRetrieverServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Retriever_ServiceDesc, srv)
+}
+
+func _Retriever_GetPage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RetrieverServer).GetPage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Retriever_GetPage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RetrieverServer).GetPage(ctx, req.(*GetPageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Retriever_RenderPage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenderPageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RetrieverServer).RenderPage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Retriever_RenderPage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RetrieverServer).RenderPage(ctx, req.(*RenderPageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Retriever_SummarizePage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SummarizePageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RetrieverServer).SummarizePage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Retriever_SummarizePage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RetrieverServer).SummarizePage(ctx, req.(*SummarizePageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Retriever_ExportTree_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportTreeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RetrieverServer).ExportTree(m, &grpc.GenericServerStream[ExportTreeRequest, ExportedPage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Retriever_ExportTreeServer = grpc.ServerStreamingServer[ExportedPage]
+
+// Retriever_ServiceDesc is the grpc.ServiceDesc for Retriever service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Retriever_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "notiondfs.v1.Retriever",
+	HandlerType: (*RetrieverServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPage",
+			Handler:    _Retriever_GetPage_Handler,
+		},
+		{
+			MethodName: "RenderPage",
+			Handler:    _Retriever_RenderPage_Handler,
+		},
+		{
+			MethodName: "SummarizePage",
+			Handler:    _Retriever_SummarizePage_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExportTree",
+			Handler:       _Retriever_ExportTree_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "retriever.proto",
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// httpConfig is the network setup for corporate environments: an egress
+// proxy and a CA bundle for proxies that intercept TLS.
+type httpConfig struct {
+	// Proxy は http://proxy.example.com:8080 の形式。空なら HTTPS_PROXY などの環境変数に従う
+	Proxy string `json:"proxy"`
+	// CACert はシステムの証明書に加えて信頼するCA証明書（PEM）のファイル
+	CACert string `json:"ca_cert"`
+}
+
+// defaultTransport は設定を適用する前の http.DefaultTransport（configureHTTP を何度呼んでも同じ状態から始める）
+var defaultTransport = http.DefaultTransport.(*http.Transport)
+
+// networkTransport は configureHTTP が最後に作った、プロキシとCA証明書だけを適用したトランスポート
+// （レート制限・キャッシュ・計測・トレースなし）。Notion 以外への送信に使う
+var (
+	networkMu        sync.Mutex
+	networkTransport http.RoundTripper = defaultTransport
+)
+
+// directTransport は networkTransport を返します
+func directTransport() http.RoundTripper {
+	networkMu.Lock()
+	defer networkMu.Unlock()
+	return networkTransport
+}
+
+// httpOptions はコマンドラインのフラグで指定されたHTTPの設定。空の項目は環境変数や設定ファイルから補う
+type httpOptions struct {
+	proxy  string
+	caCert string
+	// trace は --debug-http の出力先（"stderr" またはファイル）
+	trace string
+	// record と replay は Notion API の応答を記録・再生するディレクトリ
+	record string
+	replay string
+	// cache はNotion APIの応答を --offline のためにキャッシュへ保存し、offline はキャッシュだけから応答する
+	cache   bool
+	offline bool
+	// refresh は前回から更新されていないページのブロックもキャッシュから読まずに取得する（--refresh）
+	refresh bool
+	// rateLimit は Notion API へのリクエストの上限（リクエスト/秒、--rate-limit）。"0" なら制限しない
+	rateLimit string
+}
+
+// defaultRateLimit は Notion API の平均的なレート制限（1秒あたり3リクエスト）
+const defaultRateLimit = 3
+
+// configureHTTP applies the proxy, CA, tracing, record/replay and dry-run
+// settings, and the instrumentation for metrics, to http.DefaultTransport,
+// which every client in this program (Notion, OpenAI, Slack, Confluence,
+// uploads and asset downloads) uses. Options given as flags take precedence over the
+// NOTION_DFS_* environment variables, which take precedence over the "http"
+// section of the configuration file.
+func configureHTTP(opts httpOptions) error {
+	cfg, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+	proxy := firstNonEmpty(opts.proxy, os.Getenv("NOTION_DFS_PROXY"), cfg.HTTP.Proxy)
+	caCert := firstNonEmpty(opts.caCert, os.Getenv("NOTION_DFS_CA_CERT"), cfg.HTTP.CACert)
+	trace := firstNonEmpty(opts.trace, os.Getenv("NOTION_DFS_DEBUG_HTTP"))
+	record := firstNonEmpty(opts.record, os.Getenv("NOTION_DFS_RECORD"))
+	replay := firstNonEmpty(opts.replay, os.Getenv("NOTION_DFS_REPLAY"))
+	if record != "" && replay != "" {
+		return fmt.Errorf("recording and replaying cannot be used together")
+	}
+	if opts.offline && (record != "" || replay != "") {
+		return fmt.Errorf("--offline cannot be used with --record or --replay")
+	}
+	rate := float64(defaultRateLimit)
+	if v := firstNonEmpty(opts.rateLimit, os.Getenv("NOTION_DFS_RATE_LIMIT")); v != "" {
+		rate, err = strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 {
+			return fmt.Errorf("invalid rate limit %q (expected requests per second, or 0 for no limit)", v)
+		}
+	}
+
+	transport := defaultTransport.Clone()
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid proxy URL %q (expected http://host:port)", proxy)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no PEM certificates found in %s", caCert)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	networkMu.Lock()
+	networkTransport = transport
+	networkMu.Unlock()
+	// すべてのクライアントとゴルーチンが1つのレート制限を共有する
+	var network http.RoundTripper = transport
+	if rate > 0 {
+		network = rateLimitedTransport{next: transport, limiter: newRateLimiter(rate)}
+	}
+	var base http.RoundTripper = network
+	subtreeCache = nil
+	switch {
+	case opts.offline:
+		dir, err := responseCacheDir()
+		if err != nil {
+			return err
+		}
+		base = &fixtureTransport{dir: dir, replay: true, perToken: true, next: offlineTransport{}}
+		replaying = true
+	case replay != "":
+		base = &fixtureTransport{dir: replay, replay: true, next: network}
+		replaying = true
+	default:
+		if opts.cache {
+			dir, err := responseCacheDir()
+			if err != nil {
+				return err
+			}
+			base = &fixtureTransport{dir: dir, next: base, cache: true, perToken: true}
+			if !opts.refresh {
+				subtreeCache = &pageValidators{dir: filepath.Join(dir, "pages")}
+			}
+		}
+		if record != "" {
+			base = &fixtureTransport{dir: record, next: base}
+		}
+	}
+	http.DefaultTransport = instrumentedTransport{next: base}
+	if trace != "" {
+		w, err := openHTTPTrace(trace)
+		if err != nil {
+			return err
+		}
+		http.DefaultTransport = &httpTracer{next: http.DefaultTransport, w: w, retries: make(map[string]int)}
+	}
+	// NOTION_DFS_DRY_RUN はすべてのサブコマンドの --dry-run と同じ。送らない書き込みはトレースにも記録しない
+	if v := os.Getenv("NOTION_DFS_DRY_RUN"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid NOTION_DFS_DRY_RUN %q (expected 1 or 0)", v)
+		}
+		dryRunning = dryRunning || on
+	}
+	if dryRunning {
+		enableDryRun()
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// rateLimitBurst は間を空けずに送れるリクエストの数（しばらくリクエストがなかった後）
+	rateLimitBurst = 10
+	// minRateLimit は 429 で下げる速度の下限（リクエスト/秒）
+	minRateLimit = 0.5
+	// rateLimitRecovery は 429 がなければ速度を上げ直す間隔
+	rateLimitRecovery = 10 * time.Second
+)
+
+// rateLimiter spaces out the requests of every client and goroutine sharing
+// it to an average rate, allowing short bursts. It adapts to the limit Notion
+// actually enforces: each 429 halves the rate and holds all requests back for
+// the Retry-After time, and the rate creeps back up to the configured one
+// after a while without 429s.
+type rateLimiter struct {
+	mu sync.Mutex
+	// max は設定した速度、rate は現在の速度（リクエスト/秒）
+	max  float64
+	rate float64
+	// next は次のリクエストを送れる理論上の時刻
+	next time.Time
+	// limited は最後に 429 を受け取った時刻、または最後に速度を上げた時刻
+	limited time.Time
+	// throttles は 429 を受け取った回数（待っている間に受け取ったかを知るため）
+	throttles int
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{max: rate, rate: rate}
+}
+
+// wait は次のリクエストを送れるまで待ちます
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		throttles := l.throttles
+		slot := l.reserve(time.Now())
+		l.mu.Unlock()
+
+		if d := time.Until(slot); d > 0 {
+			t := time.NewTimer(d)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+		}
+		l.mu.Lock()
+		again := l.throttles != throttles
+		l.mu.Unlock()
+		if !again {
+			return nil
+		}
+		// 待っている間に 429 を受け取ったので、止めている時間の後に並び直す
+	}
+}
+
+// reserve は次のリクエストの時刻を決めます。l.mu を持って呼ぶ
+func (l *rateLimiter) reserve(now time.Time) time.Time {
+	if l.rate < l.max && now.Sub(l.limited) >= rateLimitRecovery {
+		l.rate = min(l.max, l.rate*1.25)
+		l.limited = now
+	}
+	interval := time.Duration(float64(time.Second) / l.rate)
+	slot := l.next
+	if earliest := now.Add(-rateLimitBurst * interval); slot.Before(earliest) {
+		slot = earliest
+	}
+	l.next = slot.Add(interval)
+	return slot
+}
+
+// throttled は 429 を受け取ったときに、速度を半分にして Retry-After の間はすべてのリクエストを止めます
+func (l *rateLimiter) throttled(retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.limited) >= time.Second {
+		// 同時に送ったリクエストがまとめて 429 になっても、速度を下げるのは1回だけ
+		l.rate = max(minRateLimit, l.rate/2)
+		log.Printf("warning: rate limited by Notion; slowing down to %.1f requests/s", l.rate)
+	}
+	l.limited = now
+	l.throttles++
+	// 待っているリクエストは予約した時刻を捨てて並び直すため、次の時刻は止めている時間の後から数え直す。
+	// 再開した後は1件ずつ送り、止めている間に溜まったリクエストがまとめて送られることはない
+	l.next = now.Add(retryAfter)
+}
+
+// rateLimitedTransport applies the limiter to the requests to the Notion API.
+type rateLimitedTransport struct {
+	next    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != notionAPIHost {
+		return t.next.RoundTrip(req)
+	}
+	if err := t.limiter.wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		retryAfter := time.Second
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+			retryAfter = time.Duration(s) * time.Second
+		}
+		t.limiter.throttled(retryAfter)
+	}
+	return resp, err
+}
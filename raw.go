@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// rawCapture is an http.RoundTripper that keeps the block objects returned by
+// the children endpoint byte-for-byte, keyed by block ID.
+type rawCapture struct {
+	next http.RoundTripper
+
+	mu     sync.Mutex
+	blocks map[notionapi.BlockID]json.RawMessage
+}
+
+func newRawCapture(next http.RoundTripper) *rawCapture {
+	return &rawCapture{next: next, blocks: make(map[notionapi.BlockID]json.RawMessage)}
+}
+
+func (c *rawCapture) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := c.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || !strings.HasSuffix(req.URL.Path, "/children") {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// notionapi 側でもう一度読めるように本文を戻しておく
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	var list struct {
+		Results []json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return resp, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, raw := range list.Results {
+		var b struct {
+			ID notionapi.BlockID `json:"id"`
+		}
+		if json.Unmarshal(raw, &b) == nil {
+			c.blocks[b.ID] = raw
+		}
+	}
+	return resp, nil
+}
+
+// writeRawTree writes the captured block objects as a JSON array, with each
+// block's descendants nested under a "children" key. With stripVolatile,
+// timestamps and expiring file URL signatures are removed and object keys are
+// sorted so that the output only changes when the content does.
+func writeRawTree(w io.Writer, tree *PageTree, capture *rawCapture, stripVolatile bool) error {
+	var buf bytes.Buffer
+	if err := capture.appendNodes(&buf, tree.Root.Children, stripVolatile); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(w)
+	return err
+}
+
+func (c *rawCapture) appendNodes(buf *bytes.Buffer, nodes []*BlockNode, stripVolatile bool) error {
+	buf.WriteByte('[')
+	for i, node := range nodes {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		c.mu.Lock()
+		raw, ok := c.blocks[node.Block.GetID()]
+		c.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("raw response for block %s was not captured", node.Block.GetID())
+		}
+		if stripVolatile {
+			stripped, err := stripVolatileJSON(raw)
+			if err != nil {
+				return err
+			}
+			raw = stripped
+		}
+
+		// 元のバイト列を保ったまま、閉じ括弧の直前に children を差し込む
+		obj := bytes.TrimSpace(raw)
+		buf.Write(obj[:len(obj)-1])
+		buf.WriteString(`,"children":`)
+		if err := c.appendNodes(buf, node.Children, stripVolatile); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// volatileKeys は内容が変わらなくても実行ごとに変わりうるフィールド
+var volatileKeys = []string{"created_time", "last_edited_time", "expiry_time"}
+
+// stripVolatileJSON removes volatile fields from a block object. Notion-hosted
+// files carry an expiry_time next to a signed URL; the URL keeps only its
+// stable part without the signature query.
+func stripVolatileJSON(raw json.RawMessage) (json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	stripVolatileValue(v)
+	// map のキーは json.Marshal によってソートされるため、順序も安定する
+	return json.Marshal(v)
+}
+
+func stripVolatileValue(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if _, ok := v["expiry_time"]; ok {
+			if s, ok := v["url"].(string); ok {
+				v["url"] = renderer.StripURLSignature(s)
+			}
+		}
+		for _, key := range volatileKeys {
+			delete(v, key)
+		}
+		for _, child := range v {
+			stripVolatileValue(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			stripVolatileValue(child)
+		}
+	}
+}
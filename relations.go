@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// relationOptions はリレーションのプロパティの解決方法（--resolve-relations-depth・--relation-links）
+type relationOptions struct {
+	// depth はリレーションをたどる深さ。0 なら関連先のページを取得しない
+	depth int
+	// links は関連先のタイトルを Markdown のリンクにする
+	links bool
+}
+
+// defaultRelationDepth は関連先のページのタイトルだけを取得する深さ
+const defaultRelationDepth = 1
+
+// relatedPage is a page that a relation property points to, as passed to
+// templates. Properties and Relations are those of the related page itself,
+// filled in only while the depth allows it.
+type relatedPage struct {
+	ID    string
+	Title string
+	URL   string
+	// Properties と Relations は深さが残っている場合だけ設定する（関連先のページのプロパティとリレーション）
+	Properties map[string]string
+	Relations  map[string][]*relatedPage
+}
+
+// pageDirectory caches the pages that relation properties point to for the
+// whole run. Rows of a database usually relate to the same few pages (a
+// project, an owner's page), so each of them is fetched at most once.
+type pageDirectory struct {
+	mu sync.Mutex
+	// pages は取得したページ。nil はインテグレーションに共有されていないなどで取得できなかったページ
+	pages map[notionapi.PageID]*notionapi.Page
+	// warned は取得できないページがあることを一度だけ警告するため
+	warned  bool
+	expires time.Time
+}
+
+var (
+	pageDirectoriesMu sync.Mutex
+	// pageDirectories は実行全体で共有する関連先のページのキャッシュ。共有されているページはインテグレーションごとに
+	// 異なるため、トークンごとに分ける（serve --multi-tenant では要求ごとにトークンが異なる）
+	pageDirectories = make(map[notionapi.Token]*pageDirectory)
+)
+
+// workspacePages は client のトークンの関連先のページのキャッシュを返します。directoryTTL を過ぎたキャッシュは捨てる
+func workspacePages(client *notionapi.Client) *pageDirectory {
+	pageDirectoriesMu.Lock()
+	defer pageDirectoriesMu.Unlock()
+	now := time.Now()
+	for token, d := range pageDirectories {
+		if now.After(d.expires) {
+			delete(pageDirectories, token)
+		}
+	}
+	d, ok := pageDirectories[client.Token]
+	if !ok {
+		d = &pageDirectory{pages: make(map[notionapi.PageID]*notionapi.Page), expires: now.Add(directoryTTL)}
+		pageDirectories[client.Token] = d
+	}
+	return d
+}
+
+// page は関連先のページを返します。取得できなければ nil
+func (d *pageDirectory) page(ctx context.Context, client *notionapi.Client, id notionapi.PageID) *notionapi.Page {
+	id = notionapi.PageID(formatPageID(string(id)))
+	d.mu.Lock()
+	page, ok := d.pages[id]
+	d.mu.Unlock()
+	if ok {
+		return page
+	}
+	page, err := client.Page.Get(ctx, id)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		page = nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if page == nil && !d.warned {
+		d.warned = true
+		log.Printf("warning: could not fetch the related page %s (%v); relations to pages not shared with the integration are shown as IDs", id, err)
+	}
+	d.pages[id] = page
+	return page
+}
+
+// cached は取得済みの関連先のページを返します
+func (d *pageDirectory) cached(id notionapi.PageID) (*notionapi.Page, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	page, ok := d.pages[notionapi.PageID(formatPageID(string(id)))]
+	return page, ok && page != nil
+}
+
+// relationIDs はリレーションのプロパティ（ロールアップで表示するリレーションを含む）の関連先のIDを返します
+func relationIDs(prop notionapi.Property) []notionapi.PageID {
+	switch p := prop.(type) {
+	case *notionapi.RelationProperty:
+		ids := make([]notionapi.PageID, 0, len(p.Relation))
+		for _, r := range p.Relation {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	case *notionapi.RollupProperty:
+		var ids []notionapi.PageID
+		for _, item := range p.Rollup.Array {
+			ids = append(ids, relationIDs(item)...)
+		}
+		return ids
+	}
+	return nil
+}
+
+// resolve はページのリレーションの関連先を depth の深さまで取得し、キャッシュに入れます
+func (d *pageDirectory) resolve(ctx context.Context, client *notionapi.Client, page *notionapi.Page, depth int) {
+	if depth <= 0 {
+		return
+	}
+	for _, prop := range page.Properties {
+		for _, id := range relationIDs(prop) {
+			if related := d.page(ctx, client, id); related != nil {
+				d.resolve(ctx, client, related, depth-1)
+			}
+		}
+	}
+}
+
+// related はページのリレーションを、プロパティ名から関連先のページへの対応にします（resolve で取得したページだけを使う）
+func (d *pageDirectory) related(page *notionapi.Page, opts relationOptions) map[string][]*relatedPage {
+	relations := make(map[string][]*relatedPage)
+	for name, prop := range page.Properties {
+		if _, ok := prop.(*notionapi.RelationProperty); !ok {
+			continue
+		}
+		pages := []*relatedPage{}
+		for _, id := range relationIDs(prop) {
+			r := &relatedPage{ID: compactPageID(string(id)), Title: formatPageID(string(id))}
+			if target, ok := d.cached(id); ok && opts.depth > 0 {
+				r.Title, r.URL = propertyTitle(target), target.URL
+				if opts.depth > 1 {
+					next := relationOptions{depth: opts.depth - 1, links: opts.links}
+					r.Properties = d.propertyTexts(target, next)
+					r.Relations = d.related(target, next)
+				}
+			}
+			pages = append(pages, r)
+		}
+		relations[name] = pages
+	}
+	return relations
+}
+
+// propertyTexts はすべてのプロパティの値をテキストにします。リレーションは関連先のタイトル（links なら Markdown のリンク）にする
+func (d *pageDirectory) propertyTexts(page *notionapi.Page, opts relationOptions) map[string]string {
+	texts := make(map[string]string, len(page.Properties))
+	for name, prop := range page.Properties {
+		texts[name] = d.propertyText(prop, opts)
+	}
+	return texts
+}
+
+// propertyText はリレーションとロールアップの値を関連先のタイトルで表し、それ以外は propertyText と同じにします
+func (d *pageDirectory) propertyText(prop notionapi.Property, opts relationOptions) string {
+	switch p := prop.(type) {
+	case *notionapi.RelationProperty:
+		titles := make([]string, 0, len(p.Relation))
+		for _, r := range p.Relation {
+			if opts.depth <= 0 {
+				titles = append(titles, formatPageID(string(r.ID)))
+				continue
+			}
+			titles = append(titles, d.relationTitle(r.ID, opts.links))
+		}
+		return strings.Join(titles, ", ")
+	case *notionapi.RollupProperty:
+		if p.Rollup.Type != "array" {
+			return propertyText(prop)
+		}
+		items := make([]string, 0, len(p.Rollup.Array))
+		for _, item := range p.Rollup.Array {
+			if text := d.propertyText(item, opts); text != "" {
+				items = append(items, text)
+			}
+		}
+		return strings.Join(items, ", ")
+	}
+	return propertyText(prop)
+}
+
+// relationTitle は関連先のページのタイトルを返します。取得できなかったページはID
+func (d *pageDirectory) relationTitle(id notionapi.PageID, link bool) string {
+	target, ok := d.cached(id)
+	if !ok {
+		return formatPageID(string(id))
+	}
+	title := propertyTitle(target)
+	if !link || target.URL == "" {
+		return title
+	}
+	return "[" + renderer.Escape(title, false) + "](" + target.URL + ")"
+}
+
+// pageProperties はページのリレーションを opts に従って解決し、人物の名前を補って、すべてのプロパティの値をテキストにします
+func pageProperties(ctx context.Context, client *notionapi.Client, page *notionapi.Page, opts relationOptions) map[string]string {
+	workspaceUsers(client).resolvePeople(ctx, client, page)
+	d := workspacePages(client)
+	d.resolve(ctx, client, page, opts.depth)
+	return d.propertyTexts(page, opts)
+}
+
+// rollupText はロールアップの数値・日付・配列（各要素をテキストにしてカンマ区切り）をテキストにします
+func rollupText(rollup notionapi.Rollup) string {
+	switch rollup.Type {
+	case "number":
+		return strconv.FormatFloat(rollup.Number, 'f', -1, 64)
+	case "date":
+		if rollup.Date == nil {
+			return ""
+		}
+		return dateDisplay.dateRange(rollup.Date.Start, rollup.Date.End)
+	case "array":
+		items := make([]string, 0, len(rollup.Array))
+		for _, item := range rollup.Array {
+			if text := propertyText(item); text != "" {
+				items = append(items, text)
+			}
+		}
+		return strings.Join(items, ", ")
+	}
+	// "incomplete"（関連先が多すぎて API が計算しなかった）や "unsupported" は表示しない
+	return ""
+}
+
+// formulaText は数式の結果（文字列・数値・真偽値・日付）をテキストにします
+func formulaText(formula notionapi.Formula) string {
+	switch formula.Type {
+	case notionapi.FormulaTypeString:
+		return formula.String
+	case notionapi.FormulaTypeNumber:
+		return strconv.FormatFloat(formula.Number, 'f', -1, 64)
+	case notionapi.FormulaTypeBoolean:
+		return strconv.FormatBool(formula.Boolean)
+	case notionapi.FormulaTypeDate:
+		if formula.Date == nil {
+			return ""
+		}
+		return dateDisplay.dateRange(formula.Date.Start, formula.Date.End)
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package renderer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+// CalloutKinds are the kinds of callout: the five kinds of GitHub alerts. The
+// other callout styles map them to their own names.
+var CalloutKinds = []string{"note", "tip", "important", "warning", "caution"}
+
+// defaultCalloutIcons と defaultCalloutColors は、アイコンの絵文字・背景色からコールアウトの種類を決める既定の対応表。
+// アイコンが表にあればアイコンを、なければ色を使い、どちらもなければ note にする
+var (
+	defaultCalloutIcons = map[string]string{
+		"💡": "tip", "✅": "tip", "👍": "tip",
+		"ℹ": "note", "📝": "note", "📌": "note", "🗒": "note",
+		"❗": "important", "‼": "important", "⭐": "important", "📣": "important",
+		"⚠": "warning", "🚧": "warning", "⏳": "warning",
+		"🚨": "caution", "⛔": "caution", "🛑": "caution", "❌": "caution", "🔥": "caution",
+	}
+	defaultCalloutColors = map[string]string{
+		"blue": "note", "gray": "note", "green": "tip", "purple": "important", "pink": "important",
+		"yellow": "warning", "orange": "warning", "brown": "warning", "red": "caution",
+	}
+)
+
+// calloutStyle is how a callout is written in Markdown: the opening lines for
+// the kind and the text, the prefix of the lines of the content, including
+// child blocks, and the line that closes it.
+type calloutStyle struct {
+	// names はコールアウトの種類ごとの、その記法での名前
+	names map[string]string
+	open  func(name, text string) string
+	// prefix は内容の各行の先頭に付ける文字列、close はコールアウトを閉じる行
+	prefix string
+	close  string
+}
+
+var calloutStyles = map[string]calloutStyle{
+	// GitHub・GitLab・Obsidian のアラート
+	"github": {
+		names: map[string]string{"note": "NOTE", "tip": "TIP", "important": "IMPORTANT", "warning": "WARNING", "caution": "CAUTION"},
+		open: func(name, text string) string {
+			if text == "" {
+				return "> [!" + name + "]\n"
+			}
+			return "> [!" + name + "]\n" + quoteLines(text)
+		},
+		prefix: "> ",
+		close:  "\n",
+	},
+	// MkDocs（admonition 拡張）
+	"mkdocs": {
+		names: map[string]string{"note": "note", "tip": "tip", "important": "info", "warning": "warning", "caution": "danger"},
+		open: func(name, text string) string {
+			if text == "" {
+				return "!!! " + name + "\n\n"
+			}
+			return "!!! " + name + "\n\n" + indentLines(text, "    ") + "\n\n"
+		},
+		prefix: "    ",
+	},
+	// Docusaurus
+	"docusaurus": {
+		names: map[string]string{"note": "note", "tip": "tip", "important": "info", "warning": "warning", "caution": "danger"},
+		open: func(name, text string) string {
+			if text == "" {
+				return ":::" + name + "\n\n"
+			}
+			return ":::" + name + "\n\n" + text + "\n\n"
+		},
+		close: ":::\n\n",
+	},
+}
+
+// calloutStyleNames は --callout-style で選べる値
+const calloutStyleNames = "quote, github, mkdocs or docusaurus"
+
+// ParseCalloutStyle checks a callout style for Markdown.CalloutStyle, as given
+// to --callout-style. quote is the default emoji quote.
+func ParseCalloutStyle(name string) (string, error) {
+	if _, ok := calloutStyles[name]; !ok && name != "quote" {
+		return "", fmt.Errorf("unknown callout style: %s (expected %s)", name, calloutStyleNames)
+	}
+	return name, nil
+}
+
+// CalloutKind returns the kind of a callout from its icon, then its color,
+// looked up first in overrides (keyed by CalloutKey) and then in the default
+// tables.
+func CalloutKind(callout notionapi.Callout, overrides map[string]string) string {
+	var keys []string
+	if callout.Icon != nil && callout.Icon.Type == "emoji" && callout.Icon.Emoji != nil {
+		keys = append(keys, CalloutKey(string(*callout.Icon.Emoji)))
+	}
+	if color := strings.TrimSuffix(callout.Color, "_background"); color != "" && color != "default" {
+		keys = append(keys, color)
+	}
+	for _, table := range []map[string]string{overrides, defaultCalloutIcons, defaultCalloutColors} {
+		for _, key := range keys {
+			if kind, ok := table[key]; ok {
+				return kind
+			}
+		}
+	}
+	return "note"
+}
+
+// CalloutKey returns the key of an emoji or a Notion color name in the
+// callout tables: variation selectors and the _background suffix of colors
+// are removed, so that red also matches red_background.
+func CalloutKey(key string) string {
+	key = strings.ReplaceAll(key, "\ufe0f", "")
+	return strings.TrimSuffix(strings.ToLower(key), "_background")
+}
+
+// quoteLines は各行の先頭に "> " を付けます（空行は ">"）
+func quoteLines(text string) string {
+	var sb strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			sb.WriteString(">\n")
+		} else {
+			sb.WriteString("> " + line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// indentLines は空行以外の各行の先頭に indent を付けます
+func indentLines(text, indent string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
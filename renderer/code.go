@@ -0,0 +1,70 @@
+package renderer
+
+import (
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+// defaultCodeLanguages は Notion のコードブロックの言語名から、ハイライト（highlight.js・Prism・Pygments・Rouge など）が
+// 受け付ける識別子への既定の対応。ここにない言語名は空白を除いてそのまま使う
+var defaultCodeLanguages = map[string]string{
+	"plain text": "text", "c++": "cpp", "c#": "csharp", "f#": "fsharp", "objective-c": "objectivec",
+	"vb.net": "vbnet", "visual basic": "vb", "docker": "dockerfile", "markup": "html", "webassembly": "wasm",
+	"java/c/c++/c#": "java",
+}
+
+// CodeLanguage returns the identifier to write for the language of a Notion
+// code block, looked up first in aliases (keyed by the lower-case Notion
+// name), so that a site can match its own highlighter, and then in the
+// default table.
+func CodeLanguage(language string, aliases map[string]string) string {
+	language = strings.ToLower(language)
+	if language == "" {
+		language = "plain text"
+	}
+	if id, ok := aliases[language]; ok {
+		return id
+	}
+	if id, ok := defaultCodeLanguages[language]; ok {
+		return id
+	}
+	return strings.ReplaceAll(language, " ", "")
+}
+
+// italicRichText はリッチテキストのすべての要素を斜体にしたコピーを返します（コードブロックのキャプションの行に使う）
+func italicRichText(richText []notionapi.RichText) []notionapi.RichText {
+	italic := make([]notionapi.RichText, len(richText))
+	for i, text := range richText {
+		a := notionapi.Annotations{}
+		if text.Annotations != nil {
+			a = *text.Annotations
+		}
+		a.Italic = true
+		text.Annotations = &a
+		italic[i] = text
+	}
+	return italic
+}
+
+// plantUMLStarts はPlantUMLの図の先頭の行（Notion の言語名にPlantUMLはないため、内容で判別する）
+var plantUMLStarts = []string{"@startuml", "@startmindmap", "@startgantt", "@startwbs", "@startsalt", "@startjson", "@startyaml"}
+
+// DiagramType returns the diagram language of a code block: "mermaid" for
+// Mermaid code blocks and "plantuml" for code that starts with @startuml and
+// the like, or "" for ordinary code.
+func DiagramType(code notionapi.Code) string {
+	switch strings.ToLower(code.Language) {
+	case "mermaid":
+		return "mermaid"
+	case "plantuml":
+		return "plantuml"
+	}
+	source := strings.TrimSpace(PlainText(code.RichText))
+	for _, start := range plantUMLStarts {
+		if strings.HasPrefix(source, start) {
+			return "plantuml"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package renderer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Flavor is the Markdown dialect the output is written for. The dialects
+// differ in the extensions to CommonMark they support, so the constructs
+// outside the common core are written the way the consuming renderer
+// understands them, or as HTML when the dialect has no syntax.
+type Flavor struct {
+	// TaskLists は "- [ ]" のタスクリスト。ない場合は ☐・☑ の記号にする
+	TaskLists bool
+	// Tables はパイプ区切りの表。ない場合はHTMLの表にする
+	Tables bool
+	// Footnotes は "[^1]" の脚注。ない場合はコメントを appendix の形式でしか出力できない
+	Footnotes bool
+	// Strikethrough は "~~" の取り消し線。ない場合は <del> にする
+	Strikethrough bool
+	// HardBreak は段落の中の改行の前に付ける記号（"\" または行末の2つの空白）
+	HardBreak string
+}
+
+// flavors は --md-flavor で選べる方言
+var flavors = map[string]Flavor{
+	"gfm":           {TaskLists: true, Tables: true, Footnotes: true, Strikethrough: true, HardBreak: `\`},
+	"commonmark":    {HardBreak: `\`},
+	"multimarkdown": {Tables: true, Footnotes: true, HardBreak: "  "},
+}
+
+// defaultFlavor は方言を指定しない場合の GitHub Flavored Markdown
+var defaultFlavor = flavors["gfm"]
+
+// ParseFlavor returns the dialect named gfm, commonmark or multimarkdown
+// (also mmd), as given to --md-flavor.
+func ParseFlavor(name string) (Flavor, error) {
+	name = strings.ToLower(name)
+	if name == "mmd" {
+		name = "multimarkdown"
+	}
+	flavor, ok := flavors[name]
+	if !ok {
+		names := make([]string, 0, len(flavors))
+		for n := range flavors {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Flavor{}, fmt.Errorf("unknown Markdown flavor: %s (expected %s)", name, strings.Join(names, ", "))
+	}
+	return flavor, nil
+}
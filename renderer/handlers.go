@@ -0,0 +1,47 @@
+package renderer
+
+import (
+	"io"
+	"sync"
+
+	"github.com/jomei/notionapi"
+)
+
+// BlockHandler renders one block as Markdown in place of the built-in
+// rendering. indent is the prefix for every line at the block's depth, and
+// text converts rich text the way the renderer does (escaping, page links,
+// comment references). Returning false falls back to the built-in rendering, so a
+// handler can take over only some blocks of a type. Child blocks are still
+// rendered afterwards, one level deeper.
+type BlockHandler func(w io.Writer, block notionapi.Block, indent string, text func([]notionapi.RichText) string) bool
+
+var (
+	blockHandlersMu sync.RWMutex
+	blockHandlers   = make(map[notionapi.BlockType]BlockHandler)
+)
+
+// RegisterBlockHandler registers h for blocks of type typ in the Markdown
+// output of every Markdown renderer, including the --preset exports, diff and
+// snapshots of notion-dfs. Registering a type again replaces the previous
+// handler, and a nil h removes it. Handlers are usually registered from init.
+func RegisterBlockHandler(typ notionapi.BlockType, h BlockHandler) {
+	blockHandlersMu.Lock()
+	defer blockHandlersMu.Unlock()
+	if h == nil {
+		delete(blockHandlers, typ)
+		return
+	}
+	blockHandlers[typ] = h
+}
+
+// HasBlockHandler reports whether a handler is registered for blocks of type typ.
+func HasBlockHandler(typ notionapi.BlockType) bool {
+	return blockHandler(typ) != nil
+}
+
+// blockHandler は typ に登録されたハンドラーを返します
+func blockHandler(typ notionapi.BlockType) BlockHandler {
+	blockHandlersMu.RLock()
+	defer blockHandlersMu.RUnlock()
+	return blockHandlers[typ]
+}
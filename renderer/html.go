@@ -0,0 +1,76 @@
+package renderer
+
+import (
+	"html"
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+// HTMLText converts rich text to HTML with its annotations and links. With
+// colors false, text and background colors are left out.
+func HTMLText(richText []notionapi.RichText, colors bool) string {
+	var sb strings.Builder
+	for _, text := range richText {
+		s := strings.ReplaceAll(EscapeHTML(text.PlainText), "\n", "<br/>")
+		if a := text.Annotations; a != nil {
+			if a.Code {
+				s = "<code>" + s + "</code>"
+			}
+			if a.Bold {
+				s = "<strong>" + s + "</strong>"
+			}
+			if a.Italic {
+				s = "<em>" + s + "</em>"
+			}
+			if a.Strikethrough {
+				s = "<del>" + s + "</del>"
+			}
+			if a.Underline {
+				s = "<u>" + s + "</u>"
+			}
+			if style := ColorStyle(a.Color); colors && style != "" {
+				s = `<span style="` + style + `">` + s + "</span>"
+			}
+		}
+		// ワークスペース内へのリンク（"/" で始まる）は外部からは開けないため、テキストのみにする
+		if text.Href != "" && !strings.HasPrefix(text.Href, "/") {
+			s = "<a href=\"" + EscapeHTML(text.Href) + "\">" + s + "</a>"
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+// notionColors は Notion の文字色と背景色（"red_background" など）の色。Notion のライトテーマの値
+var notionColors = map[notionapi.Color]string{
+	notionapi.ColorGray: "#787774", notionapi.ColorBrown: "#9F6B53", notionapi.ColorOrange: "#D9730D",
+	notionapi.ColorYellow: "#CB912F", notionapi.ColorGreen: "#448361", notionapi.ColorBlue: "#337EA9",
+	notionapi.ColorPurple: "#9065B0", notionapi.ColorPink: "#C14C8A", notionapi.ColorRed: "#D44C47",
+	notionapi.ColorGrayBackground: "#F1F1EF", notionapi.ColorBrownBackground: "#F4EEEE", notionapi.ColorOrangeBackground: "#FBECDD",
+	notionapi.ColorYellowBackground: "#FBF3DB", notionapi.ColorGreenBackground: "#EDF3EC", notionapi.ColorBlueBackground: "#E7F3F8",
+	notionapi.ColorPurpleBackground: "#F6F3F9", notionapi.ColorPinkBackground: "#FAF1F5", notionapi.ColorRedBackground: "#FDEBEC",
+}
+
+// ColorStyle は色の注釈をCSSの宣言（"color: #D44C47" など）にします。デフォルトの色では空
+func ColorStyle(color notionapi.Color) string {
+	value, ok := notionColors[color]
+	if !ok {
+		return ""
+	}
+	if strings.HasSuffix(string(color), "_background") {
+		return "background-color: " + value
+	}
+	return "color: " + value
+}
+
+// EscapeHTML はHTMLの特殊文字をエスケープし、XMLで使えない制御文字を取り除きます
+func EscapeHTML(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	return html.EscapeString(s)
+}
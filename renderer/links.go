@@ -0,0 +1,54 @@
+package renderer
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/jomei/notionapi"
+)
+
+// notionURLPageID は "Title-<32桁のID>" や "<32桁のID>" で終わるパスにマッチします
+var notionURLPageID = regexp.MustCompile(`(?:^|-)([0-9a-f]{32})$`)
+
+// LinkedPageID returns the compact ID of the page that a rich text element
+// mentions or links to, such as "/<id>" or "https://www.notion.so/Title-<id>".
+func LinkedPageID(text notionapi.RichText) (string, bool) {
+	if text.Mention != nil && text.Mention.Type == "page" && text.Mention.Page != nil {
+		return strings.ReplaceAll(string(text.Mention.Page.ID), "-", ""), true
+	}
+	if text.Text == nil || text.Text.Link == nil {
+		return "", false
+	}
+	u, err := url.Parse(text.Text.Link.Url)
+	if err != nil {
+		return "", false
+	}
+	if u.Host != "" && !strings.HasSuffix(u.Host, "notion.so") && !strings.HasSuffix(u.Host, "notion.site") {
+		return "", false
+	}
+	m := notionURLPageID.FindStringSubmatch(path.Base(u.Path))
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// Slugify turns a title into a string usable in file names and URLs.
+// Letters and digits of any script are kept, so Japanese titles stay readable.
+func Slugify(s string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "-")
+}
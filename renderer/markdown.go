@@ -0,0 +1,806 @@
+// Package renderer renders Notion blocks as Markdown, the format that
+// notion-dfs exports pages to by default. Library users can change how
+// particular block types are written with RegisterBlockHandler, without
+// replacing the whole renderer.
+package renderer
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/jomei/notionapi"
+)
+
+// Markdown renders blocks as Markdown. The zero value writes GitHub
+// Flavored Markdown; the fields change the output. A Markdown also holds the
+// state of the output being written (open tables, toggles and callouts, and
+// the heading anchors used so far), so a new one is used for each page.
+type Markdown struct {
+	// StripVolatile は実行のたびに変わる値（有効期限つきのファイルURLなど）を出力しない
+	StripVolatile bool
+	// Localize が設定されている場合、Notion上のファイルのURLを戻り値（ダウンロードしたファイルのパスなど）に置き換える
+	Localize func(rawURL string) string
+	// PageLink が設定されている場合、ページへのリンクやメンションを戻り値のリンクに置き換える
+	PageLink func(pageID, text string) (string, bool)
+	// HeadingAnchors が true の場合、見出しに {#anchor} 形式の明示的なIDを付ける
+	HeadingAnchors bool
+	anchors        map[string]bool
+	// HeadingShift は見出しのレベルに加える数（ページタイトルを # にする場合は 1）。6を超えるレベルは6にする
+	HeadingShift int
+	// NormalizeHeadings が true の場合、見出しのレベルが飛ばないよう直前の見出しの1つ下までに上げる
+	// （最初の見出しはレベル1）。lastHeading は直前に出力した見出しのレベル
+	NormalizeHeadings bool
+	lastHeading       int
+	// Comments が設定されている場合、コメントの付いたブロックにその参照（脚注など）を付ける
+	Comments Comments
+	// NoEscape が true の場合、テキストのMarkdownの記号をエスケープせずに出力する（テーブルのセルの | は除く）
+	NoEscape bool
+	// Flavor は出力するMarkdownの方言。nil ならGFM
+	Flavor *Flavor
+	// table は出力中のテーブル。行は子ブロックとして届くため、テーブルのブロックで始めて最後の行の後で閉じる
+	table *markdownTable
+	// FlattenToggles が true の場合、トグルを <details> にせず、見出しの段落と内容をそのまま並べる
+	FlattenToggles bool
+	// Diagram が設定されている場合、Mermaid・PlantUMLのコードブロックを、戻り値のURLの画像として出力する。
+	// エラーの場合は警告を出してコードブロックとして出力する
+	Diagram func(typ, source string) (string, error)
+	// Colors は文字色と背景色の出力方法（--preserve-colors）。"mark" なら背景色を <mark>、
+	// "html" なら両方を style 付きの <span> にする。空なら出力しない
+	Colors string
+	// CalloutStyle はコールアウトの記法（ParseCalloutStyle で確かめた値）。空または "quote" なら絵文字つきの引用にする
+	CalloutStyle string
+	// CalloutKind はコールアウトの種類（CalloutKinds のいずれか）を決める。nil なら既定の対応表で決める
+	CalloutKind func(callout notionapi.Callout) string
+	// CodeLanguage はコードブロックの言語名を、フェンスに書く識別子にする。nil なら既定の対応表を使う
+	CodeLanguage func(language string) string
+	// Columns はカラムの出力方法（--columns）。"sections"・"html"・"table" のいずれかで、空なら内容を順に並べる
+	Columns string
+	// containers は出力中のトグルやコールアウトなど、子ブロックを中に入れるブロック
+	containers []*markdownContainer
+}
+
+// Comments adds references to the comments on blocks to the output, such as
+// footnote references. PrintBlocks calls Begin before and End after writing
+// each block, and the references that Refs returns are written after the
+// rich text of the block.
+type Comments interface {
+	Begin(block notionapi.Block)
+	End(block notionapi.Block)
+	Refs() string
+}
+
+// markdownContainer is a block whose child blocks are written inside it, such
+// as a toggle or a callout. Children are indented relative to the container
+// and every line of them starts with prefix ("> " inside a quote, spaces for
+// an indented admonition). Because children arrive one by one, the container
+// stays open until a block that is not deeper than it, or Finish.
+type markdownContainer struct {
+	depth  int
+	prefix string
+	// lead はコンテナの本文と最初の子ブロックの間に書く行（引用の中の空行など）
+	lead string
+	// closePrefix と close はコンテナを閉じる行（"</details>" など）とその前に付ける文字列
+	closePrefix string
+	close       string
+	started     bool
+	// column はカラムのリストで、これまでに始めたカラムの数
+	column int
+	// cells は --columns table のカラムのリストで、カラムごとの内容（表のセルになる）
+	cells []*strings.Builder
+	// out が設定されている場合、内容を w ではなくここに書く（表のセルにするカラム）
+	out *strings.Builder
+}
+
+// markdownTable は出力中のテーブルの状態
+type markdownTable struct {
+	indent string
+	// prefix はテーブルを入れたコンテナの prefix。行はコンテナの中で出力されるが、閉じる行は endTable が直接書く
+	prefix       string
+	width        int
+	columnHeader bool
+	rowHeader    bool
+	rows         int
+}
+
+// PlainText combines multiple rich text blocks into a single string
+func PlainText(richText []notionapi.RichText) string {
+	var content []string
+	for _, text := range richText {
+		content = append(content, text.PlainText)
+	}
+	return strings.Join(content, "")
+}
+
+// RichText converts rich text to Markdown with its annotations (bold,
+// italic, strikethrough, code) and links. The Markdown characters of the text
+// are escaped, and with PageLink set, links and mentions of pages are
+// replaced.
+func (r *Markdown) RichText(richText []notionapi.RichText) string {
+	return r.inline(richText, r.dialect().HardBreak+"\n")
+}
+
+// inline は RichText と同じですが、テキストの中の改行を newline に置き換えます
+func (r *Markdown) inline(richText []notionapi.RichText, newline string) string {
+	var sb strings.Builder
+	for _, text := range richText {
+		if r.PageLink != nil {
+			if id, ok := LinkedPageID(text); ok {
+				if link, ok := r.PageLink(id, text.PlainText); ok {
+					sb.WriteString(link)
+					continue
+				}
+			}
+		}
+		// 記号の内側の先頭と末尾に空白があると書式として扱われないため、外に出す
+		body := strings.TrimSpace(text.PlainText)
+		if body == "" {
+			sb.WriteString(strings.ReplaceAll(text.PlainText, "\n", newline))
+			continue
+		}
+		lead := text.PlainText[:strings.Index(text.PlainText, body)]
+		trail := text.PlainText[len(lead)+len(body):]
+
+		a := text.Annotations
+		if a == nil {
+			a = &notionapi.Annotations{}
+		}
+		var s string
+		switch {
+		case a.Code:
+			s = codeSpan(body)
+		case r.NoEscape:
+			s = body
+		default:
+			s = Escape(body, atLineStart(sb.String()+lead))
+		}
+		if a.Bold {
+			s = "**" + s + "**"
+		}
+		if a.Italic {
+			s = "*" + s + "*"
+		}
+		if a.Strikethrough {
+			if r.dialect().Strikethrough {
+				s = "~~" + s + "~~"
+			} else {
+				s = "<del>" + s + "</del>"
+			}
+		}
+		s = r.colorSpan(s, a.Color)
+		// ワークスペース内へのリンク（"/" で始まる）は外部からは開けないため、テキストのみにする
+		if text.Href != "" && !strings.HasPrefix(text.Href, "/") {
+			href := text.Href
+			if strings.ContainsAny(href, " ()") {
+				href = "<" + href + ">"
+			}
+			s = "[" + s + "](" + href + ")"
+		}
+		sb.WriteString(strings.ReplaceAll(lead+s+trail, "\n", newline))
+	}
+	if r.Comments != nil {
+		sb.WriteString(r.Comments.Refs())
+	}
+	return sb.String()
+}
+
+// colorSpan は Colors に従って、色の注釈を付けたテキストをHTMLの要素で囲みます
+func (r *Markdown) colorSpan(s string, color notionapi.Color) string {
+	style := ColorStyle(color)
+	switch {
+	case style == "":
+	case r.Colors == "html":
+		return `<span style="` + style + `">` + s + "</span>"
+	case r.Colors == "mark" && strings.HasSuffix(string(color), "_background"):
+		return "<mark>" + s + "</mark>"
+	}
+	return s
+}
+
+// htmlText はHTMLの要素の中（<summary> やHTMLの表）に書くリッチテキストです
+func (r *Markdown) htmlText(richText []notionapi.RichText) string {
+	return HTMLText(richText, r.Colors == "html")
+}
+
+// dialect は出力するMarkdownの方言を返します（未設定ならGFM）
+func (r *Markdown) dialect() Flavor {
+	if r.Flavor == nil {
+		return defaultFlavor
+	}
+	return *r.Flavor
+}
+
+// atLineStart は s の後に続くテキストが行頭（空白のみの後を含む）になるかを返します
+func atLineStart(s string) bool {
+	return strings.TrimLeft(s[strings.LastIndex(s, "\n")+1:], " \t") == ""
+}
+
+// codeSpan はテキストをインラインコードにします。テキストに含まれるより長いバッククォートで囲む
+func codeSpan(s string) string {
+	longest, run := 0, 0
+	for _, c := range s {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	// バッククォートで始まる・終わるテキストは、囲みと区別するため空白を挟む
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
+
+// codeFence はコードブロックを囲む記号です。コードの中にある行頭の ``` より長くする
+func codeFence(code string) string {
+	longest := 0
+	for _, line := range strings.Split(code, "\n") {
+		line = strings.TrimLeft(line, " \t")
+		longest = max(longest, len(line)-len(strings.TrimLeft(line, "`")))
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// Escape escapes the characters of plain text that Markdown would
+// read as formatting: emphasis, strikethrough (GFM), code spans, links,
+// HTML and entity references (&amp;) anywhere, and headings, quotes and list markers at the start of a line
+// (lineStart tells whether s itself starts a line). Underscores inside words, as in
+// snake_case, are left alone since they never start emphasis.
+func Escape(s string, lineStart bool) string {
+	var sb strings.Builder
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		if lineStart {
+			for i < len(rs) && (rs[i] == ' ' || rs[i] == '\t') {
+				sb.WriteRune(rs[i])
+				i++
+			}
+			if i == len(rs) {
+				break
+			}
+			r = rs[i]
+			lineStart = false
+			switch {
+			case r == '#' || r == '>':
+				sb.WriteByte('\\')
+			case r == '-' || r == '+' || r == '=':
+				// リストの記号、区切り線、Setext形式の見出しの下線になる場合
+				if i+1 == len(rs) || rs[i+1] == ' ' || rs[i+1] == '\t' || rs[i+1] == r || rs[i+1] == '\n' {
+					sb.WriteByte('\\')
+				}
+			case r >= '0' && r <= '9':
+				// "1. " や "1) " は番号付きリストになるため、数字の後の記号をエスケープする
+				j := i
+				for j < len(rs) && rs[j] >= '0' && rs[j] <= '9' {
+					j++
+				}
+				if j < len(rs) && (rs[j] == '.' || rs[j] == ')') && (j+1 == len(rs) || rs[j+1] == ' ' || rs[j+1] == '\n') {
+					sb.WriteString(string(rs[i:j]))
+					sb.WriteByte('\\')
+					i = j
+					r = rs[j]
+				}
+			}
+		}
+		switch r {
+		case '\\', '`', '*', '~', '[', ']', '<', '&':
+			sb.WriteByte('\\')
+		case '_':
+			if i == 0 || i+1 == len(rs) || !isWordRune(rs[i-1]) || !isWordRune(rs[i+1]) {
+				sb.WriteByte('\\')
+			}
+		case '\n':
+			lineStart = true
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// imageAltText は画像の代替テキストです。キャプションがあれば1行にしてそれを使い、なければ "Image" にする
+func imageAltText(caption []notionapi.RichText) string {
+	alt := strings.Join(strings.Fields(PlainText(caption)), " ")
+	if alt == "" {
+		return "Image"
+	}
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(alt)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tableCell はテーブルのセルの区切りにならないよう、セルの中の | をエスケープします
+func tableCell(text string) string {
+	return strings.ReplaceAll(text, "|", `\|`)
+}
+
+// headingText は見出しのテキストを返し、HeadingAnchors が有効ならページ内で重複しないアンカーを付けます
+func (r *Markdown) headingText(richText []notionapi.RichText) string {
+	text := r.RichText(richText)
+	if !r.HeadingAnchors {
+		return text
+	}
+	base := Slugify(PlainText(richText))
+	if base == "" {
+		return text
+	}
+	if r.anchors == nil {
+		r.anchors = make(map[string]bool)
+	}
+	anchor := base
+	for i := 1; r.anchors[anchor]; i++ {
+		anchor = fmt.Sprintf("%s-%d", base, i)
+	}
+	r.anchors[anchor] = true
+	return text + " {#" + anchor + "}"
+}
+
+// headingMarker は見出しのレベルを NormalizeHeadings で詰め、HeadingShift だけずらした "##" などの記号を返します
+func (r *Markdown) headingMarker(level int) string {
+	if r.NormalizeHeadings {
+		level = min(level, r.lastHeading+1)
+		r.lastHeading = level
+	}
+	return strings.Repeat("#", max(1, min(level+r.HeadingShift, 6)))
+}
+
+// PrintBlock writes a single block at depth. Blocks can be written one by one
+// as they are fetched, children after their parent one level deeper; Finish
+// must then be called after the last one.
+func (r *Markdown) PrintBlock(w io.Writer, block notionapi.Block, depth int) {
+	if _, ok := block.(*notionapi.TableRowBlock); !ok {
+		r.endTable(w)
+	}
+	// ストリーミングでは、コンテナの内容はコンテナより浅いブロックが届いた時点で終わる
+	r.closeContainers(w, depth)
+	n := len(r.containers)
+	if n == 0 {
+		r.renderBlock(w, block, depth, strings.Repeat("    ", depth), "")
+		return
+	}
+	// コンテナの中のブロックはコンテナからの深さで字下げし、各行にコンテナの prefix を付ける
+	c := r.containers[n-1]
+	var sb strings.Builder
+	if !c.started {
+		sb.WriteString(c.lead)
+		c.started = true
+	}
+	r.renderBlock(&sb, block, depth, strings.Repeat("    ", depth-c.depth-1), c.prefix)
+	writePrefixed(r.output(w), c.prefix, sb.String())
+}
+
+// output はブロックを書き出す先です。表のセルにするカラムの中では、そのカラムの内容
+func (r *Markdown) output(w io.Writer) io.Writer {
+	for i := len(r.containers) - 1; i >= 0; i-- {
+		if out := r.containers[i].out; out != nil {
+			return out
+		}
+	}
+	return w
+}
+
+// renderBlock は PrintBlock の本体です。indent は行の先頭の字下げ、prefix はその前に付くコンテナの prefix
+// （ブロックが新しいコンテナを始める場合に使う）
+func (r *Markdown) renderBlock(w io.Writer, block notionapi.Block, depth int, indent, prefix string) {
+	if h := blockHandler(block.GetType()); h != nil && h(w, block, indent, r.RichText) {
+		return
+	}
+
+	switch b := block.(type) {
+	case *notionapi.ParagraphBlock:
+		fmt.Fprintf(w, "%s%s\n\n", indent, r.RichText(b.Paragraph.RichText))
+
+	case *notionapi.Heading1Block:
+		r.printHeading(w, indent, prefix, depth, 1, b.Heading1.RichText, b.Heading1.IsToggleable)
+
+	case *notionapi.Heading2Block:
+		r.printHeading(w, indent, prefix, depth, 2, b.Heading2.RichText, b.Heading2.IsToggleable)
+
+	case *notionapi.Heading3Block:
+		r.printHeading(w, indent, prefix, depth, 3, b.Heading3.RichText, b.Heading3.IsToggleable)
+
+	case *notionapi.BulletedListItemBlock:
+		fmt.Fprintf(w, "%s- %s\n", indent, r.RichText(b.BulletedListItem.RichText))
+
+	case *notionapi.NumberedListItemBlock:
+		fmt.Fprintf(w, "%s1. %s\n", indent, r.RichText(b.NumberedListItem.RichText))
+
+	case *notionapi.ToDoBlock:
+		checkbox := "[ ]"
+		if b.ToDo.Checked {
+			checkbox = "[x]"
+		}
+		if !r.dialect().TaskLists {
+			checkbox = "☐"
+			if b.ToDo.Checked {
+				checkbox = "☑"
+			}
+		}
+		fmt.Fprintf(w, "%s- %s %s\n", indent, checkbox, r.RichText(b.ToDo.RichText))
+
+	case *notionapi.ImageBlock:
+		if b.Image.Type == "external" {
+			fmt.Fprintf(w, "%s![%s](%s)\n\n", indent, imageAltText(b.Image.Caption), b.Image.External.URL)
+		} else if b.Image.Type == "file" {
+			fmt.Fprintf(w, "%s![%s](%s)\n\n", indent, imageAltText(b.Image.Caption), r.fileURL(b.Image.File.URL))
+		}
+
+	case *notionapi.CodeBlock:
+		code := PlainText(b.Code.RichText)
+		language := r.codeLanguage(b.Code.Language)
+		if typ := DiagramType(b.Code); typ != "" {
+			if r.printDiagram(w, indent, typ, code, b.Code.Caption) {
+				break
+			}
+			// GitHub・GitLab・Docusaurus・MkDocs（Material）などは ```mermaid・```plantuml を図として表示する
+			language = typ
+		}
+		fence := codeFence(code)
+		// フェンスと同じ字下げは読み込み時に取り除かれるため、すべての行に付けるとコードがそのまま残る
+		fmt.Fprintf(w, "%s%s%s\n%s\n%s%s\n\n", indent, fence, language, indentLines(code, indent), indent, fence)
+		// キャプションはコードの後に斜体の行として出力する
+		if len(b.Code.Caption) > 0 {
+			fmt.Fprintf(w, "%s%s\n\n", indent, strings.TrimSpace(r.RichText(italicRichText(b.Code.Caption))))
+		}
+
+	case *notionapi.QuoteBlock:
+		lines := strings.Split(r.RichText(b.Quote.RichText), "\n")
+		for _, line := range lines {
+			fmt.Fprintf(w, "%s> %s\n", indent, line)
+		}
+		fmt.Fprintln(w)
+
+	case *notionapi.CalloutBlock:
+		r.printCallout(w, indent, prefix, depth, b.Callout)
+
+	case *notionapi.DividerBlock:
+		fmt.Fprintf(w, "%s---\n\n", indent)
+
+	case *notionapi.ToggleBlock:
+		r.openToggle(w, indent, prefix, depth)
+		if r.FlattenToggles {
+			fmt.Fprintf(w, "%s%s\n\n", indent, r.RichText(b.Toggle.RichText))
+		} else {
+			fmt.Fprintf(w, "%s<summary>%s</summary>\n\n", indent, r.htmlText(b.Toggle.RichText))
+		}
+
+	case *notionapi.TableBlock:
+		// テーブルヘッダーとデータは子ブロックとして取得されるため、
+		// ここでは状態だけを用意し、行の出力は子ブロックの処理に任せる
+		r.table = &markdownTable{indent: indent, prefix: prefix, width: b.Table.TableWidth, columnHeader: b.Table.HasColumnHeader, rowHeader: b.Table.HasRowHeader}
+		if !r.dialect().Tables {
+			fmt.Fprintf(w, "%s<table>\n", indent)
+		}
+		return
+
+	case *notionapi.TableRowBlock:
+		r.printTableRow(w, b.TableRow.Cells)
+
+	case *notionapi.ChildPageBlock:
+		// 子ページは別のファイルとして書き出される場合のみ、そのページへのリンクを出力する
+		if r.PageLink != nil {
+			if link, ok := r.PageLink(strings.ReplaceAll(string(b.ID), "-", ""), b.ChildPage.Title); ok {
+				fmt.Fprintf(w, "%s%s\n\n", indent, link)
+			}
+		}
+
+	case *notionapi.ColumnListBlock:
+		// カラムの内容は子ブロックとして処理される
+		r.openColumnList(w, indent, prefix, depth)
+
+	case *notionapi.ColumnBlock:
+		r.openColumn(w, indent, prefix, depth)
+	}
+}
+
+// PrintBlocks writes blocks and their children, the top-level ones at depth.
+func (r *Markdown) PrintBlocks(w io.Writer, nodes []*Node, depth int) {
+	for _, node := range nodes {
+		if r.Comments != nil {
+			r.Comments.Begin(node.Block)
+		}
+		r.PrintBlock(w, node.Block, depth)
+		if r.Comments != nil {
+			r.Comments.End(node.Block)
+		}
+		r.PrintBlocks(w, node.Children, depth+1)
+		if _, ok := node.Block.(*notionapi.TableBlock); ok {
+			r.endTable(w)
+		}
+		r.closeContainers(w, depth)
+	}
+}
+
+// printHeading は見出しを出力します。トグル見出しは toggle と同じく <details> にし、
+// 見出しを <summary> に入れる
+func (r *Markdown) printHeading(w io.Writer, indent, prefix string, depth, level int, richText []notionapi.RichText, toggleable bool) {
+	marker := r.headingMarker(level)
+	if !toggleable {
+		fmt.Fprintf(w, "%s%s %s\n\n", indent, marker, r.headingText(richText))
+		return
+	}
+	r.openToggle(w, indent, prefix, depth)
+	if r.FlattenToggles {
+		fmt.Fprintf(w, "%s%s %s\n\n", indent, marker, r.headingText(richText))
+	} else {
+		fmt.Fprintf(w, "%s<summary><h%d>%s</h%d></summary>\n\n", indent, len(marker), r.htmlText(richText), len(marker))
+	}
+}
+
+// openToggle はトグルを始めます。以降の子ブロックは、閉じるまでトグルと同じ深さに出力する
+func (r *Markdown) openToggle(w io.Writer, indent, prefix string, depth int) {
+	c := &markdownContainer{depth: depth, prefix: prefix + indent}
+	if !r.FlattenToggles {
+		fmt.Fprintf(w, "%s<details>\n", indent)
+		c.closePrefix, c.close = prefix+indent, "</details>\n\n"
+	}
+	r.containers = append(r.containers, c)
+}
+
+// printCallout はコールアウトを CalloutStyle の記法で出力します。子ブロックはコールアウトの中に入れる
+func (r *Markdown) printCallout(w io.Writer, indent, prefix string, depth int, callout notionapi.Callout) {
+	text := r.RichText(callout.RichText)
+	style, ok := calloutStyles[r.CalloutStyle]
+	if !ok {
+		icon := "💡"
+		if callout.Icon != nil && callout.Icon.Type == "emoji" {
+			icon = string(*callout.Icon.Emoji)
+		}
+		fmt.Fprint(w, indentLines(quoteLines(icon+" "+text), indent))
+		r.containers = append(r.containers, &markdownContainer{
+			depth: depth, prefix: prefix + indent + "> ", lead: "\n", closePrefix: prefix + indent, close: "\n",
+		})
+		return
+	}
+	fmt.Fprint(w, indentLines(style.open(style.names[r.calloutKind(callout)], text), indent))
+	c := &markdownContainer{depth: depth, prefix: prefix + indent + style.prefix, closePrefix: prefix + indent, close: style.close}
+	if style.prefix == "> " {
+		c.lead = "\n"
+	}
+	r.containers = append(r.containers, c)
+}
+
+// closeContainers は depth 以上の深さで始めたコンテナを閉じます
+func (r *Markdown) closeContainers(w io.Writer, depth int) {
+	for len(r.containers) > 0 && r.containers[len(r.containers)-1].depth >= depth {
+		c := r.containers[len(r.containers)-1]
+		r.containers = r.containers[:len(r.containers)-1]
+		text := c.close
+		if c.cells != nil {
+			text = r.columnsTable(c.cells)
+		}
+		writePrefixed(r.output(w), c.closePrefix, text)
+	}
+}
+
+// openColumnList はカラムのリストを始めます。カラムの内容はリストと同じ深さに出力する
+func (r *Markdown) openColumnList(w io.Writer, indent, prefix string, depth int) {
+	c := &markdownContainer{depth: depth, prefix: prefix + indent, closePrefix: prefix + indent}
+	switch r.Columns {
+	case "html":
+		fmt.Fprintf(w, "%s<div style=\"display: flex; gap: 1em;\">\n\n", indent)
+		c.close = "</div>\n\n"
+	case "table":
+		c.cells = []*strings.Builder{}
+	}
+	r.containers = append(r.containers, c)
+}
+
+// openColumn はカラムを1つ始めます
+func (r *Markdown) openColumn(w io.Writer, indent, prefix string, depth int) {
+	c := &markdownContainer{depth: depth, prefix: prefix + indent, closePrefix: prefix + indent}
+	var list *markdownContainer
+	if n := len(r.containers); n > 0 {
+		list = r.containers[n-1]
+		list.column++
+	}
+	switch {
+	case list == nil:
+		// カラムのリストなしにカラムだけを出力する場合は、内容を並べる
+	case r.Columns == "html":
+		fmt.Fprintf(w, "%s<div style=\"flex: 1; min-width: 0;\">\n\n", indent)
+		c.close = "</div>\n\n"
+	case r.Columns == "sections":
+		// カラムの間に区切り線を入れ、各カラムの先頭に目印のコメントを付ける
+		if list.column > 1 {
+			fmt.Fprintf(w, "%s---\n\n", indent)
+		}
+		fmt.Fprintf(w, "%s<!-- column %d -->\n\n", indent, list.column)
+	case list.cells != nil:
+		c.out = &strings.Builder{}
+		c.prefix, c.closePrefix = "", ""
+		list.cells = append(list.cells, c.out)
+	}
+	r.containers = append(r.containers, c)
+}
+
+// columnsTable はカラムの内容を横に並べた1行の表にします。パイプ区切りの表ではセルの改行を <br> にし、
+// パイプ区切りの表がない方言では、セルの中にMarkdownを書けるHTMLの表にする
+func (r *Markdown) columnsTable(cells []*strings.Builder) string {
+	var sb strings.Builder
+	if !r.dialect().Tables {
+		sb.WriteString("<table>\n<tr>\n")
+		for _, cell := range cells {
+			fmt.Fprintf(&sb, "<td>\n\n%s\n\n</td>\n", strings.TrimSpace(cell.String()))
+		}
+		sb.WriteString("</tr>\n</table>\n\n")
+		return sb.String()
+	}
+	texts := make([]string, len(cells))
+	for i, cell := range cells {
+		texts[i] = tableCell(strings.ReplaceAll(strings.TrimSpace(cell.String()), "\n", "<br>"))
+	}
+	fmt.Fprintf(&sb, "|%s\n|%s\n| %s |\n\n", strings.Repeat("  |", len(cells)), strings.Repeat(" --- |", len(cells)), strings.Join(texts, " | "))
+	return sb.String()
+}
+
+// Finish closes the table, toggles and callouts still open. It is needed
+// after writing blocks one by one with PrintBlock.
+func (r *Markdown) Finish(w io.Writer) {
+	r.endTable(w)
+	r.closeContainers(w, 0)
+}
+
+// writePrefixed は text の各行の先頭に prefix を付けて書き出します。空行には prefix の末尾の空白を付けない
+func writePrefixed(w io.Writer, prefix, text string) {
+	if prefix == "" {
+		io.WriteString(w, text)
+		return
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		switch line {
+		case "":
+		case "\n":
+			io.WriteString(w, strings.TrimRight(prefix, " ")+"\n")
+		default:
+			io.WriteString(w, prefix+line)
+		}
+	}
+}
+
+// printDiagram は Diagram が設定されている場合に図を画像として出力します。失敗した場合は警告を出して false を返し、
+// コードブロックとして出力させる
+func (r *Markdown) printDiagram(w io.Writer, indent, typ, source string, caption []notionapi.RichText) bool {
+	if r.Diagram == nil {
+		return false
+	}
+	link, err := r.Diagram(typ, source)
+	if err != nil {
+		log.Printf("warning: failed to render %s diagram: %v", typ, err)
+		return false
+	}
+	alt := strings.TrimSpace(PlainText(caption))
+	if alt == "" {
+		alt = typ + " diagram"
+	}
+	fmt.Fprintf(w, "%s![%s](%s)\n\n", indent, Escape(alt, false), link)
+	return true
+}
+
+// printTableRow はテーブルの行を出力します。パイプ区切りの表では、見出し行の後
+// （見出し行のない表では空の見出し行の後）に区切り行を書く
+func (r *Markdown) printTableRow(w io.Writer, row [][]notionapi.RichText) {
+	t := r.table
+	if t == nil {
+		// テーブルのブロックなしに行だけを出力する場合
+		t = &markdownTable{}
+		r.table = t
+		if !r.dialect().Tables {
+			fmt.Fprint(w, "<table>\n")
+		}
+	}
+	width := max(t.width, len(row))
+	if !r.dialect().Tables {
+		fmt.Fprintf(w, "%s<tr>", t.indent)
+		for i := 0; i < width; i++ {
+			cell := "td"
+			if (t.columnHeader && t.rows == 0) || (t.rowHeader && i == 0) {
+				cell = "th"
+			}
+			var text []notionapi.RichText
+			if i < len(row) {
+				text = row[i]
+			}
+			fmt.Fprintf(w, "<%s>%s</%s>", cell, r.htmlText(text), cell)
+		}
+		fmt.Fprint(w, "</tr>\n")
+		t.rows++
+		return
+	}
+
+	delimiter := t.indent + "|" + strings.Repeat(" --- |", width) + "\n"
+	if t.rows == 0 && !t.columnHeader {
+		fmt.Fprintf(w, "%s|%s\n%s", t.indent, strings.Repeat("  |", width), delimiter)
+	}
+	cells := make([]string, width)
+	for i := range cells {
+		if i < len(row) {
+			cells[i] = tableCell(r.inline(row[i], "<br>"))
+		}
+	}
+	fmt.Fprintf(w, "%s| %s |\n", t.indent, strings.Join(cells, " | "))
+	if t.rows == 0 && t.columnHeader {
+		fmt.Fprint(w, delimiter)
+	}
+	t.rows++
+}
+
+// PrintTable writes rows of rich text cells as a table of its own, such as a
+// table of page properties. With columnHeader the first row is the header
+// row, and with rowHeader the cells of the first column are headers too
+// (shown only by the HTML tables of dialects without pipe tables).
+func (r *Markdown) PrintTable(w io.Writer, rows [][][]notionapi.RichText, columnHeader, rowHeader bool) {
+	r.endTable(w)
+	r.table = &markdownTable{columnHeader: columnHeader, rowHeader: rowHeader}
+	for _, row := range rows {
+		r.table.width = max(r.table.width, len(row))
+	}
+	if !r.dialect().Tables {
+		fmt.Fprint(w, "<table>\n")
+	}
+	for _, row := range rows {
+		r.printTableRow(w, row)
+	}
+	r.endTable(w)
+}
+
+// endTable は出力中のテーブルを閉じます。テーブルの後のブロックの出力前と、Finish で呼ぶ
+func (r *Markdown) endTable(w io.Writer) {
+	if r.table == nil {
+		return
+	}
+	end := "\n"
+	if !r.dialect().Tables {
+		end = r.table.indent + "</table>\n\n"
+	}
+	writePrefixed(r.output(w), r.table.prefix, end)
+	r.table = nil
+}
+
+// codeLanguage はコードブロックの言語名を CodeLanguage で、設定されていなければ既定の対応表で識別子にします
+func (r *Markdown) codeLanguage(language string) string {
+	if r.CodeLanguage != nil {
+		return r.CodeLanguage(language)
+	}
+	return CodeLanguage(language, nil)
+}
+
+// calloutKind はコールアウトの種類を CalloutKind で、設定されていなければ既定の対応表で決めます
+func (r *Markdown) calloutKind(callout notionapi.Callout) string {
+	if r.CalloutKind != nil {
+		return r.CalloutKind(callout)
+	}
+	return CalloutKind(callout, nil)
+}
+
+// fileURL returns the URL of a file hosted by Notion. Such URLs are signed and
+// expire after an hour, so the file is either downloaded next to the output,
+// or with StripVolatile the signature query is dropped and only the stable
+// part of the URL is kept.
+func (r *Markdown) fileURL(rawURL string) string {
+	if r.Localize != nil {
+		return r.Localize(rawURL)
+	}
+	if !r.StripVolatile {
+		return rawURL
+	}
+	return StripURLSignature(rawURL)
+}
+
+// StripURLSignature removes the query string (the expiring signature) from a URL.
+func StripURLSignature(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery = ""
+	return u.String()
+}
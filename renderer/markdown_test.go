@@ -0,0 +1,159 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jomei/notionapi"
+)
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		lineStart bool
+		want      string
+	}{
+		{"plain", "hello world", true, "hello world"},
+		{"emphasis", "*bold* and ~strike~", false, `\*bold\* and \~strike\~`},
+		{"code span", "use `go test`", false, "use \\`go test\\`"},
+		{"link", "[text](url)", false, `\[text\](url)`},
+		{"html", "<b>tag</b>", false, `\<b>tag\</b>`},
+		{"entity", "AT&amp;T", false, `AT\&amp;T`},
+		{"ampersand", "R&D", false, `R\&D`},
+		{"backslash", `C:\path`, false, `C:\\path`},
+		{"snake case", "snake_case_name", false, "snake_case_name"},
+		{"underscore emphasis", "_word_", false, `\_word\_`},
+		{"heading", "# title", true, `\# title`},
+		{"heading mid-line", "# title", false, "# title"},
+		{"quote", "> quoted", true, `\> quoted`},
+		{"indented heading", "  # title", true, `  \# title`},
+		{"bullet", "- item", true, `\- item`},
+		{"hyphenated", "-word", true, "-word"},
+		{"rule", "---", true, `\---`},
+		{"setext underline", "text\n===", true, "text\n\\==="},
+		{"ordered list", "1. first", true, `1\. first`},
+		{"ordered list paren", "12) twelfth", true, `12\) twelfth`},
+		{"number", "3.14 is pi", true, "3.14 is pi"},
+		{"second line", "a\n# b", false, "a\n\\# b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Escape(tt.in, tt.lineStart); got != tt.want {
+				t.Errorf("Escape(%q, %v) = %q, want %q", tt.in, tt.lineStart, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableCell(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"a", "a"},
+		{"a|b", `a\|b`},
+		{"||", `\|\|`},
+	}
+	for _, tt := range tests {
+		if got := tableCell(tt.in); got != tt.want {
+			t.Errorf("tableCell(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	tests := []struct {
+		code, want string
+	}{
+		{"print(1)", "```"},
+		{"```\nnested\n```", "````"},
+		{"  ````go", "`````"},
+		{"inline ``` is not a fence", "```"},
+	}
+	for _, tt := range tests {
+		if got := codeFence(tt.code); got != tt.want {
+			t.Errorf("codeFence(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCodeSpan(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"x", "`x`"},
+		{"a`b", "``a`b``"},
+		{"a``b", "```a``b```"},
+		{"`x", "`` `x ``"},
+		{"x`", "`` x` ``"},
+	}
+	for _, tt := range tests {
+		if got := codeSpan(tt.in); got != tt.want {
+			t.Errorf("codeSpan(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderCodeBlock(t *testing.T) {
+	text := func(s string) []notionapi.RichText {
+		return []notionapi.RichText{{Type: "text", Text: &notionapi.Text{Content: s}, PlainText: s}}
+	}
+	code := func(language, s string) *Node {
+		return &Node{Block: &notionapi.CodeBlock{
+			BasicBlock: notionapi.BasicBlock{Type: notionapi.BlockTypeCode},
+			Code:       notionapi.Code{Language: language, RichText: text(s)},
+		}}
+	}
+	python := "def f():\n    if x:\n\n        return 1"
+	tests := []struct {
+		name  string
+		nodes []*Node
+		want  string
+	}{
+		{
+			"top level",
+			[]*Node{code("python", python)},
+			"```python\ndef f():\n    if x:\n\n        return 1\n```\n\n",
+		},
+		{
+			"fence in code",
+			[]*Node{code("markdown", "```go\nx\n```")},
+			"````markdown\n```go\nx\n```\n````\n\n",
+		},
+		{
+			// リストの中ではフェンスと同じだけ字下げし、空行には字下げを付けない
+			"in a list",
+			[]*Node{{
+				Block: &notionapi.BulletedListItemBlock{
+					BasicBlock:       notionapi.BasicBlock{Type: notionapi.BlockTypeBulletedListItem},
+					BulletedListItem: notionapi.ListItem{RichText: text("item")},
+				},
+				Children: []*Node{code("python", python)},
+			}},
+			"- item\n    ```python\n    def f():\n        if x:\n\n            return 1\n    ```\n\n",
+		},
+		{
+			// コールアウト（引用）の中では各行に "> " を付け、コードの字下げは変えない
+			"in a callout",
+			[]*Node{{
+				Block: &notionapi.CalloutBlock{
+					BasicBlock: notionapi.BasicBlock{Type: notionapi.BlockCallout},
+					Callout:    notionapi.Callout{RichText: text("note")},
+				},
+				Children: []*Node{code("yaml", "a:\n  - b")},
+			}},
+			"> 💡 note\n>\n> ```yaml\n> a:\n>   - b\n> ```\n>\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sb strings.Builder
+			r := &Markdown{}
+			r.PrintBlocks(&sb, tt.nodes, 0)
+			r.Finish(&sb)
+			if got := sb.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package renderer
+
+import "github.com/jomei/notionapi"
+
+// Node is a block together with its parent and child links, as rendered by
+// Markdown.PrintBlocks.
+type Node struct {
+	Block    notionapi.Block
+	Parent   *Node
+	Children []*Node
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// rstRenderer renders a block tree as reStructuredText (for Sphinx/docutils).
+// Nesting is expressed with indentation as in Notion; sections only exist at
+// the top level, so nested headings become rubrics.
+type rstRenderer struct {
+	stripVolatile bool
+}
+
+// rstAdornments は見出しのレベル（1〜3）ごとの下線の記号（ページタイトルは = の上下線）
+var rstAdornments = []string{"=", "-", "~"}
+
+// writeRST writes the page title, the page's blocks and the summary if given
+// as a reStructuredText document.
+func writeRST(w io.Writer, title string, tree *PageTree, summary string, stripVolatile bool) error {
+	r := &rstRenderer{stripVolatile: stripVolatile}
+	title = rstEscape(strings.ReplaceAll(title, "\n", " "))
+	line := strings.Repeat("=", displayWidth(title))
+	fmt.Fprintf(w, "%s\n%s\n%s\n\n", line, title, line)
+	r.blocks(w, tree.Root.Children, "")
+	if summary != "" {
+		r.section(w, 1, "AI による要約")
+		for _, para := range strings.Split(strings.TrimSpace(summary), "\n\n") {
+			rstLines(w, "", "", rstParagraph(rstEscape(para)))
+		}
+	}
+	return nil
+}
+
+// rstSectionBreak は前後に区切り線（transition）を置けないブロック
+func rstSectionBreak(block notionapi.Block) bool {
+	switch block.(type) {
+	case *notionapi.Heading1Block, *notionapi.Heading2Block, *notionapi.Heading3Block,
+		*notionapi.ChildPageBlock, *notionapi.DividerBlock:
+		return true
+	}
+	return false
+}
+
+// blocks は兄弟ブロックを indent で字下げして出力します
+func (r *rstRenderer) blocks(w io.Writer, nodes []*BlockNode, indent string) {
+	for i, node := range nodes {
+		if _, ok := node.Block.(*notionapi.DividerBlock); ok {
+			// 区切り線は最上位にしか置けず、文書や節の先頭・末尾にも置けない
+			if indent != "" || i == 0 || i == len(nodes)-1 ||
+				rstSectionBreak(nodes[i-1].Block) || rstSectionBreak(nodes[i+1].Block) {
+				continue
+			}
+			fmt.Fprint(w, "----------\n\n")
+			continue
+		}
+		r.block(w, node, indent)
+	}
+}
+
+func (r *rstRenderer) block(w io.Writer, node *BlockNode, indent string) {
+	// children は子ブロックを字下げする位置（空なら同じ位置に続ける）
+	children := indent + "   "
+	switch b := node.Block.(type) {
+	case *notionapi.ParagraphBlock:
+		if len(b.Paragraph.RichText) > 0 {
+			rstLines(w, indent, indent, rstParagraph(r.richText(b.Paragraph.RichText)))
+		}
+
+	case *notionapi.Heading1Block:
+		r.heading(w, 1, b.Heading1.RichText, indent)
+		children = indent
+
+	case *notionapi.Heading2Block:
+		r.heading(w, 2, b.Heading2.RichText, indent)
+		children = indent
+
+	case *notionapi.Heading3Block:
+		r.heading(w, 3, b.Heading3.RichText, indent)
+		children = indent
+
+	case *notionapi.BulletedListItemBlock:
+		rstLines(w, indent+"- ", indent+"  ", rstParagraph(r.richText(b.BulletedListItem.RichText)))
+		children = indent + "  "
+
+	case *notionapi.NumberedListItemBlock:
+		rstLines(w, indent+"#. ", indent+"   ", rstParagraph(r.richText(b.NumberedListItem.RichText)))
+
+	case *notionapi.ToDoBlock:
+		checkbox := "☐ "
+		if b.ToDo.Checked {
+			checkbox = "☑ "
+		}
+		rstLines(w, indent+"- ", indent+"  ", rstParagraph(checkbox+r.richText(b.ToDo.RichText)))
+		children = indent + "  "
+
+	case *notionapi.ImageBlock:
+		src := ""
+		if b.Image.Type == "external" {
+			src = b.Image.External.URL
+		} else if b.Image.Type == "file" {
+			src = b.Image.File.URL
+			if r.stripVolatile {
+				src = renderer.StripURLSignature(src)
+			}
+		}
+		fmt.Fprintf(w, "%s.. image:: %s\n", indent, src)
+		if alt := renderer.PlainText(b.Image.Caption); alt != "" {
+			fmt.Fprintf(w, "%s   :alt: %s\n", indent, strings.ReplaceAll(alt, "\n", " "))
+		}
+		fmt.Fprintln(w)
+
+	case *notionapi.CodeBlock:
+		// 内容のない code-block はエラーになるため出力しない
+		if code := renderer.PlainText(b.Code.RichText); code != "" {
+			// 図は sphinxcontrib-mermaid・sphinxcontrib-plantuml のディレクティブにする
+			switch renderer.DiagramType(b.Code) {
+			case "mermaid":
+				fmt.Fprintf(w, "%s.. mermaid::\n", indent)
+			case "plantuml":
+				fmt.Fprintf(w, "%s.. uml::\n", indent)
+			default:
+				fmt.Fprintf(w, "%s.. code-block:: %s\n", indent, codeLanguage(b.Code.Language))
+			}
+			if caption := strings.TrimSpace(renderer.PlainText(b.Code.Caption)); caption != "" {
+				fmt.Fprintf(w, "%s   :caption: %s\n", indent, strings.ReplaceAll(caption, "\n", " "))
+			}
+			fmt.Fprintln(w)
+			rstLines(w, children, children, code)
+		}
+
+	case *notionapi.QuoteBlock:
+		// 空のコメントで直前のリストや段落と切り離し、字下げしたブロックを引用にする
+		fmt.Fprintf(w, "%s..\n\n", indent)
+		rstLines(w, children, children, rstParagraph(r.richText(b.Quote.RichText)))
+
+	case *notionapi.CalloutBlock:
+		icon := "💡"
+		if b.Callout.Icon != nil && b.Callout.Icon.Type == "emoji" {
+			icon = string(*b.Callout.Icon.Emoji)
+		}
+		fmt.Fprintf(w, "%s.. %s::\n\n", indent, calloutKind(b.Callout))
+		rstLines(w, children, children, rstParagraph(icon+" "+r.richText(b.Callout.RichText)))
+
+	case *notionapi.ToggleBlock:
+		fmt.Fprintf(w, "%s.. container:: toggle\n\n", indent)
+		rstLines(w, children, children, rstParagraph(r.richText(b.Toggle.RichText)))
+
+	case *notionapi.TableBlock:
+		r.table(w, node.Children, b.Table.HasColumnHeader, indent)
+		return
+
+	case *notionapi.ChildPageBlock:
+		r.heading(w, 1, []notionapi.RichText{{PlainText: b.ChildPage.Title}}, indent)
+		children = indent
+
+	case *notionapi.ColumnListBlock, *notionapi.ColumnBlock:
+		children = indent
+	}
+	r.blocks(w, node.Children, children)
+}
+
+// heading は見出しを出力します。字下げの中では節を作れないため rubric にする
+func (r *rstRenderer) heading(w io.Writer, level int, richText []notionapi.RichText, indent string) {
+	text := strings.ReplaceAll(r.richText(richText), "\n", " ")
+	if indent != "" {
+		fmt.Fprintf(w, "%s.. rubric:: %s\n\n", indent, text)
+		return
+	}
+	r.section(w, level, text)
+}
+
+func (r *rstRenderer) section(w io.Writer, level int, text string) {
+	fmt.Fprintf(w, "%s\n%s\n\n", text, strings.Repeat(rstAdornments[level-1], displayWidth(text)))
+}
+
+func (r *rstRenderer) table(w io.Writer, rows []*BlockNode, hasHeader bool, indent string) {
+	fmt.Fprintf(w, "%s.. list-table::\n", indent)
+	if hasHeader {
+		fmt.Fprintf(w, "%s   :header-rows: 1\n", indent)
+	}
+	fmt.Fprintln(w)
+	for _, row := range rows {
+		tr, ok := row.Block.(*notionapi.TableRowBlock)
+		if !ok {
+			continue
+		}
+		for i, cell := range tr.TableRow.Cells {
+			marker := indent + "   * - "
+			if i > 0 {
+				marker = indent + "     - "
+			}
+			text := r.richText(cell)
+			if text == "" {
+				fmt.Fprintln(w, strings.TrimRight(marker, " "))
+				continue
+			}
+			for j, line := range strings.Split(text, "\n") {
+				if j > 0 {
+					marker = indent + "       "
+				}
+				fmt.Fprintln(w, marker+line)
+			}
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// richText はリッチテキストを装飾（太字・斜体・コード）とリンクを含むreSTにします。
+// 取り消し線と下線は reST に記法がないため、テキストのみにする
+func (r *rstRenderer) richText(richText []notionapi.RichText) string {
+	var sb strings.Builder
+	// separate は直前がインラインマークアップで、単語の途中で終わらないよう区切りが必要なこと
+	separate := false
+	for _, text := range richText {
+		if text.PlainText == "" {
+			continue
+		}
+		// マークアップの内側の先頭と末尾に空白を置けないため、外に出す
+		body := strings.TrimSpace(text.PlainText)
+		lead := text.PlainText[:strings.Index(text.PlainText, body)]
+		trail := text.PlainText[len(lead)+len(body):]
+
+		markup := ""
+		s := rstEscape(body)
+		if a := text.Annotations; a != nil && body != "" {
+			switch {
+			case a.Code:
+				s, markup = "``"+body+"``", "code"
+			case a.Bold:
+				s, markup = "**"+s+"**", "bold"
+			case a.Italic:
+				s, markup = "*"+s+"*", "italic"
+			}
+		}
+		// ワークスペース内へのリンク（"/" で始まる）は外部からは開けないため、テキストのみにする
+		if text.Href != "" && !strings.HasPrefix(text.Href, "/") && body != "" {
+			s, markup = "`"+strings.NewReplacer("`", `\`+"`", "<", `\<`).Replace(body)+" <"+text.Href+">`__", "link"
+		}
+
+		if lead == "" && separate {
+			sb.WriteString(`\ `)
+		}
+		sb.WriteString(rstEscape(lead))
+		if markup != "" && lead == "" && !separate && sb.Len() > 0 && !strings.HasSuffix(sb.String(), " ") {
+			sb.WriteString(`\ `)
+		}
+		sb.WriteString(s)
+		sb.WriteString(rstEscape(trail))
+		separate = markup != "" && trail == ""
+	}
+	return sb.String()
+}
+
+// rstEscape は reST のインラインマークアップとして解釈される記号をエスケープします
+var rstEscape = strings.NewReplacer(`\`, `\\`, "*", `\*`, "`", "\\`", "|", `\|`, "_", `\_`).Replace
+
+// rstBlockStart は行頭にあるとリストや見出しの下線などと解釈される記法
+var rstBlockStart = regexp.MustCompile(`^([-+#:=~^.'"]|\d+[.)]|[A-Za-z][.)]\s|\(\w+\))`)
+
+// rstParagraph は段落の各行を、行頭の記号がブロックの記法と解釈されないようにします
+func rstParagraph(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if rstBlockStart.MatchString(line) {
+			lines[i] = `\` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rstLines はテキストを、1行目は first、2行目以降は rest を前に付けて出力し、空行で終えます
+func rstLines(w io.Writer, first, rest, text string) {
+	for i, line := range strings.Split(text, "\n") {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		if line == "" {
+			prefix = strings.TrimRight(prefix, " ")
+		}
+		fmt.Fprintln(w, prefix+line)
+	}
+	fmt.Fprintln(w)
+}
+
+// displayWidth は等幅で表示したときの幅を返します（全角文字と絵文字は2文字分）
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul),
+			r >= 0x3000 && r <= 0x303F, r >= 0xFF01 && r <= 0xFF60, r >= 0xFFE0 && r <= 0xFFE6, r >= 0x1F300:
+			width += 2
+		default:
+			width++
+		}
+	}
+	return max(width, 1)
+}
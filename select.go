@@ -0,0 +1,279 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jomei/notionapi"
+)
+
+// blockSelector is one --select expression: conditions joined by "and" that
+// a block has to satisfy. A condition on the heading field matches headings
+// and selects their whole section.
+type blockSelector struct {
+	conds []selectorCond
+}
+
+// selectorCond は "field op value" の形の条件1つ
+type selectorCond struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+// selectorFields は条件に使えるフィールド
+var selectorFields = map[string]bool{"type": true, "text": true, "language": true, "heading": true, "id": true}
+
+// parseSelector は `type=code` や `heading contains "API" and type=heading_2` のような式を解析します
+func parseSelector(expr string) (*blockSelector, error) {
+	tokens, err := selectorTokens(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", expr, err)
+	}
+	sel := &blockSelector{}
+	for i := 0; i < len(tokens); {
+		if len(sel.conds) > 0 {
+			if !strings.EqualFold(tokens[i], "and") {
+				return nil, fmt.Errorf("invalid selector %q: expected \"and\" before %q", expr, tokens[i])
+			}
+			i++
+		}
+		if len(tokens)-i < 3 {
+			return nil, fmt.Errorf("invalid selector %q: expected <field> <op> <value>", expr)
+		}
+		cond := selectorCond{field: strings.ToLower(tokens[i]), op: strings.ToLower(tokens[i+1]), value: tokens[i+2]}
+		i += 3
+		if !selectorFields[cond.field] {
+			return nil, fmt.Errorf("invalid selector %q: unknown field %q (expected type, text, language, heading or id)", expr, cond.field)
+		}
+		switch cond.op {
+		case "=", "!=", "contains":
+		case "~":
+			re, err := regexp.Compile(cond.value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid selector %q: %w", expr, err)
+			}
+			cond.re = re
+		default:
+			return nil, fmt.Errorf("invalid selector %q: unknown operator %q (expected =, !=, contains or ~)", expr, cond.op)
+		}
+		sel.conds = append(sel.conds, cond)
+	}
+	if len(sel.conds) == 0 {
+		return nil, fmt.Errorf("invalid selector %q: empty", expr)
+	}
+	return sel, nil
+}
+
+// selectorTokens は式を単語・演算子・引用符で囲まれた文字列に分けます
+func selectorTokens(expr string) ([]string, error) {
+	var tokens []string
+	rs := []rune(expr)
+	for i := 0; i < len(rs); {
+		switch r := rs[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				if rs[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(rs) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			s, err := strconv.Unquote(string(rs[i : j+1]))
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, s)
+			i = j + 1
+		case r == '=' || r == '~':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '!' && i+1 < len(rs) && rs[i+1] == '=':
+			tokens = append(tokens, "!=")
+			i += 2
+		default:
+			j := i
+			for j < len(rs) && !unicode.IsSpace(rs[j]) && !strings.ContainsRune(`"=~!`, rs[j]) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("unexpected %q", r)
+			}
+			tokens = append(tokens, string(rs[i:j]))
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// section は見出しの条件を含み、一致した見出しのセクション全体を選ぶかを返します
+func (s *blockSelector) section() bool {
+	for _, c := range s.conds {
+		if c.field == "heading" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *blockSelector) matches(block notionapi.Block) bool {
+	for _, c := range s.conds {
+		var value string
+		switch c.field {
+		case "type":
+			value = string(block.GetType())
+			// "heading" はすべての見出しのレベルに一致させる
+			if c.value == "heading" && headingLevel(block) > 0 {
+				value = "heading"
+			}
+		case "text":
+			value = blockText(block)
+		case "language":
+			code, ok := block.(*notionapi.CodeBlock)
+			if !ok {
+				return false
+			}
+			value = code.Code.Language
+		case "heading":
+			if headingLevel(block) == 0 {
+				return false
+			}
+			value = blockText(block)
+		case "id":
+			value = compactPageID(string(block.GetID()))
+			c.value = compactPageID(c.value)
+		}
+		if !c.match(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c selectorCond) match(value string) bool {
+	switch c.op {
+	case "=":
+		return strings.EqualFold(value, c.value)
+	case "!=":
+		return !strings.EqualFold(value, c.value)
+	case "contains":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(c.value))
+	default:
+		return c.re.MatchString(value)
+	}
+}
+
+// headingLevel は見出しのブロックならそのレベル（1〜3）を、それ以外なら0を返します
+func headingLevel(block notionapi.Block) int {
+	switch block.(type) {
+	case *notionapi.Heading1Block:
+		return 1
+	case *notionapi.Heading2Block:
+		return 2
+	case *notionapi.Heading3Block:
+		return 3
+	}
+	return 0
+}
+
+// toggleableHeading は子ブロックを折りたためる見出し（トグル見出し）かを返します
+func toggleableHeading(block notionapi.Block) bool {
+	switch b := block.(type) {
+	case *notionapi.Heading1Block:
+		return b.Heading1.IsToggleable
+	case *notionapi.Heading2Block:
+		return b.Heading2.IsToggleable
+	case *notionapi.Heading3Block:
+		return b.Heading3.IsToggleable
+	}
+	return false
+}
+
+// toggleMarker はトグル見出しなら marker を、それ以外なら空文字列を返します。
+// 折りたためない形式で、トグル見出しの内容が字下げされている理由が分かるように見出しに付ける
+func toggleMarker(block notionapi.Block, marker string) string {
+	if toggleableHeading(block) {
+		return marker
+	}
+	return ""
+}
+
+// selectBlocks returns a tree with only the blocks that match any of the
+// selectors, in document order. A matching block keeps its children, and a
+// heading matched by a heading condition keeps its section: the following
+// siblings up to the next heading of the same or a higher level. Matches
+// nested inside non-matching blocks are moved to the top level.
+func selectBlocks(tree *PageTree, selectors []*blockSelector) *PageTree {
+	selected := &PageTree{Root: &BlockNode{}, nodes: tree.nodes}
+	var walk func(nodes []*BlockNode)
+	walk = func(nodes []*BlockNode) {
+		for i := 0; i < len(nodes); i++ {
+			node := nodes[i]
+			var match *blockSelector
+			for _, sel := range selectors {
+				if sel.matches(node.Block) {
+					match = sel
+					break
+				}
+			}
+			if match == nil {
+				walk(node.Children)
+				continue
+			}
+			selected.Root.Children = append(selected.Root.Children, node)
+			if level := headingLevel(node.Block); level > 0 && match.section() {
+				for i+1 < len(nodes) {
+					if l := headingLevel(nodes[i+1].Block); l > 0 && l <= level {
+						break
+					}
+					i++
+					selected.Root.Children = append(selected.Root.Children, nodes[i])
+				}
+			}
+		}
+	}
+	walk(tree.Root.Children)
+	return selected
+}
+
+// sectionBlocks returns a tree with the content of the first heading whose
+// text is title (ignoring case and surrounding spaces): the heading's own
+// children, for toggleable headings, and the following siblings up to the
+// next heading of the same or a higher level. The heading itself is not
+// included.
+func sectionBlocks(tree *PageTree, title string) (*PageTree, error) {
+	title = strings.TrimSpace(title)
+	var find func(nodes []*BlockNode) []*BlockNode
+	find = func(nodes []*BlockNode) []*BlockNode {
+		for i, node := range nodes {
+			level := headingLevel(node.Block)
+			if level > 0 && strings.EqualFold(strings.TrimSpace(blockText(node.Block)), title) {
+				content := append([]*BlockNode{}, node.Children...)
+				for _, next := range nodes[i+1:] {
+					if l := headingLevel(next.Block); l > 0 && l <= level {
+						break
+					}
+					content = append(content, next)
+				}
+				return content
+			}
+			if content := find(node.Children); content != nil {
+				return content
+			}
+		}
+		return nil
+	}
+	content := find(tree.Root.Children)
+	if content == nil {
+		return nil, fmt.Errorf("section %q not found", title)
+	}
+	return &PageTree{Root: &BlockNode{Children: content}, nodes: tree.nodes}, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// serveFormats は GET /pages/{id} の ?format= で選べる形式と Content-Type
+var serveFormats = map[string]string{
+	"markdown":   "text/markdown; charset=utf-8",
+	"asciidoc":   "text/asciidoc; charset=utf-8",
+	"rst":        "text/x-rst; charset=utf-8",
+	"slack":      "text/plain; charset=utf-8",
+	"confluence": "application/xhtml+xml; charset=utf-8",
+	"raw":        "application/json",
+}
+
+// runServe serves rendered pages over HTTP, with the Prometheus metrics at
+// /metrics, and with --webhook receives the callbacks of Notion webhooks and
+// automations to re-export or summarize the changed pages.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	addLLMFlags(fs)
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on (use :8080 to accept connections from other hosts, as Notion webhooks need)")
+	secret := fs.String("secret", os.Getenv("NOTION_DFS_SERVE_SECRET"), "secret that requests to GET /pages/{id} and the gRPC service must send as Authorization: Bearer <secret>; without it (or --multi-tenant) pages are not served (default: $NOTION_DFS_SERVE_SECRET)")
+	webhook := fs.Bool("webhook", false, "accept Notion webhook and automation callbacks at POST /webhook")
+	webhookSecret := fs.String("webhook-secret", os.Getenv("NOTION_DFS_WEBHOOK_SECRET"), "verification token of the Notion webhook subscription, or the secret header value of an automation (default: $NOTION_DFS_WEBHOOK_SECRET)")
+	out := fs.String("webhook-out", "", "re-export each changed page as Markdown into this directory")
+	summarize := fs.Bool("webhook-summarize", false, "write the AI summary of each changed page as a callout at the end of the page")
+	blockTitle := fs.String("block-title", "AI summary", "with --webhook-summarize, text of the summary callout; an existing callout with this text is replaced")
+	dryRun := fs.Bool("dry-run", false, "with --webhook-summarize, print the Notion API requests that would write the summaries instead of sending them")
+	delay := fs.Duration("webhook-delay", 10*time.Second, "wait this long after the last event of a page before processing it, to coalesce bursts of edits")
+	concurrency := fs.Int("concurrency", 4, "number of pages to process at the same time")
+	multiTenant := fs.Bool("multi-tenant", false, "fetch the pages of GET /pages and gRPC calls with the Notion token in the Authorization header of each request instead of NOTION_API_TOKEN")
+	grpc := fs.Bool("grpc", false, "serve the gRPC Retriever service of proto/retriever.proto (needs --tls-cert and --tls-key)")
+	tlsCert := fs.String("tls-cert", "", "serve HTTPS (and HTTP/2) with this certificate file (PEM)")
+	tlsKey := fs.String("tls-key", "", "private key file (PEM) of --tls-cert")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs serve [flags]")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		exit(1)
+	}
+	if !*webhook && (*out != "" || *summarize) {
+		fatal("--webhook-out and --webhook-summarize need --webhook")
+	}
+	if *webhook && *out == "" && !*summarize {
+		fatal("--webhook needs --webhook-out or --webhook-summarize")
+	}
+	if *dryRun && !*summarize {
+		fatal("--dry-run needs --webhook-summarize")
+	}
+	if *concurrency < 1 {
+		fatal("--concurrency must be at least 1")
+	}
+	if *dryRun {
+		enableDryRun()
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fatal("--tls-cert and --tls-key must be given together")
+	}
+	if *grpc && *tlsCert == "" {
+		// net/http は TLS なしの HTTP/2（h2c）を話さないため、gRPC のクライアントとつながらない
+		fatal("--grpc needs --tls-cert and --tls-key: gRPC runs over HTTP/2, which is served only over TLS")
+	}
+
+	if *multiTenant && *secret != "" {
+		fatal("--secret cannot be used with --multi-tenant: the Authorization header carries the Notion token of each request")
+	}
+	// ページを返すエンドポイントは、誰でも読めないよう --secret か --multi-tenant のトークンで認証する
+	auth := serveAuth{secret: *secret, multiTenant: *multiTenant}
+	if *grpc && !auth.enabled() {
+		fatal("--grpc needs --secret (or NOTION_DFS_SERVE_SECRET) or --multi-tenant")
+	}
+
+	if *multiTenant && replaying {
+		// 記録した応答はトークンを区別しないため、ほかのワークスペースのページを返してしまう
+		fatal("--multi-tenant cannot be used with --replay or --offline")
+	}
+
+	// --multi-tenant ではサーバーのトークンは Webhook だけに使う
+	var client *notionapi.Client
+	if !*multiTenant || *webhook {
+		client = newNotionClient()
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metricsHandler())
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	if auth.enabled() {
+		mux.Handle("GET /pages/{id}", pageHandler{auth: auth})
+	} else if !*webhook {
+		log.Print("warning: GET /pages/{id} is not served without --secret (or NOTION_DFS_SERVE_SECRET) or --multi-tenant")
+	}
+	handler := http.Handler(mux)
+	if *grpc {
+		handler = withGRPC(newGRPCServer(auth), mux)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var hooks *webhookReceiver
+	if *webhook {
+		hooks = &webhookReceiver{
+			secret: *webhookSecret,
+			delay:  *delay,
+			sem:    make(chan struct{}, *concurrency),
+			timers: make(map[notionapi.BlockID]*time.Timer),
+			busy:   make(map[notionapi.BlockID]bool),
+			again:  make(map[notionapi.BlockID]bool),
+			ctx:    ctx,
+			outDir: *out,
+		}
+		if *summarize {
+			state, err := openSummaryState("webhook")
+			if err != nil {
+				fatal(err)
+			}
+			hooks.summarizer = &dbSummarizer{client: client, blockTitle: *blockTitle, state: state}
+		}
+		if *out != "" {
+			if err := os.MkdirAll(*out, 0o755); err != nil {
+				fatal(err)
+			}
+		}
+		if hooks.secret == "" {
+			log.Print("warning: no --webhook-secret: only the verification request of a new webhook subscription is accepted until it is set")
+		}
+		mux.Handle("POST /webhook", hooks)
+	}
+
+	server := &http.Server{Addr: *addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), daemonStopTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	var err error
+	if *tlsCert != "" {
+		log.Printf("serving on https://%s", *addr)
+		err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		log.Printf("serving on http://%s", *addr)
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fatal(err)
+	}
+	if hooks != nil {
+		hooks.wait()
+	}
+}
+
+// serveAuth authenticates the requests for pages (GET /pages/{id} and the
+// gRPC service). With multiTenant the bearer token is the Notion token the
+// page is fetched with; otherwise it must be the server's secret, so that
+// nobody who merely reaches the port can read the pages of the integration
+// or spend the OpenAI key on summaries.
+type serveAuth struct {
+	secret      string
+	multiTenant bool
+}
+
+// enabled はページを返すエンドポイントを提供できるか（シークレットかリクエストごとのトークンがあるか）を返します
+func (a serveAuth) enabled() bool {
+	return a.multiTenant || a.secret != ""
+}
+
+// authorize はリクエストの Authorization ヘッダー（gRPC では authorization メタデータ）の値を確かめ、
+// ページの取得に使うNotionのトークンを返します（--multi-tenant でなければ空）。認証できなければ失敗の理由を返す
+func (a serveAuth) authorize(authorization string) (token string, reason string) {
+	given, ok := bearerToken(authorization)
+	if a.multiTenant {
+		if !ok {
+			return "", "a Notion token is required: Authorization: Bearer <token>"
+		}
+		return given, ""
+	}
+	if !ok || a.secret == "" || subtle.ConstantTimeCompare([]byte(given), []byte(a.secret)) != 1 {
+		return "", "the secret of the server is required: Authorization: Bearer <secret>"
+	}
+	return "", ""
+}
+
+// pageHandler は GET /pages/{id}?format=markdown&summary=1 でページを出力します。
+// 要約は summary=1 の場合だけ付ける
+type pageHandler struct {
+	auth serveAuth
+}
+
+func (h pageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "markdown"
+	}
+	contentType, ok := serveFormats[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported format %q", format), http.StatusBadRequest)
+		return
+	}
+	opts := exportOptions{format: format, noSummary: r.URL.Query().Get("summary") != "1", summaryFormat: "text", relations: relationOptions{depth: defaultRelationDepth}}
+	token, reason := h.auth.authorize(r.Header.Get("Authorization"))
+	if reason != "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="notion-dfs"`)
+		http.Error(w, reason, http.StatusUnauthorized)
+		return
+	}
+	opts.token = token
+	// 共有のキャッシュやプロキシに応答（ほかのワークスペースのページかもしれない）を保存させない
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Vary", "Authorization")
+	var buf bytes.Buffer
+	if err := writePage(r.Context(), &buf, notionapi.BlockID(formatPageID(r.PathValue("id"))), opts); err != nil {
+		writeNotionHTTPError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buf.Bytes())
+}
+
+// bearerToken は Authorization の値 "Bearer <token>" のトークンを返します
+func bearerToken(authorization string) (string, bool) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	token = strings.TrimSpace(token)
+	return token, ok && token != ""
+}
+
+// writeNotionHTTPError は Notion API のエラーのステータスをそのまま返します（ページがない場合の404など）
+func writeNotionHTTPError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	var apiErr *notionapi.Error
+	var rateLimited *notionapi.RateLimitedError
+	switch {
+	case errors.As(err, &rateLimited):
+		status = http.StatusTooManyRequests
+	case errors.As(err, &apiErr) && apiErr.Status >= 400 && apiErr.Status < 500:
+		status = apiErr.Status
+	}
+	log.Printf("warning: %v", err)
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// sitePage is a page written by a site export, with its metadata and its
+// place in the page hierarchy.
+type sitePage struct {
+	ID       notionapi.BlockID
+	Title    string
+	Page     *notionapi.Page
+	Parent   *sitePage
+	Children []*sitePage
+
+	// tree は子ページを探すために取得したブロックツリー（書き出し時に再利用する）
+	tree *PageTree
+
+	// Cover・Icon は保存したカバー画像・アイコンの画像への、Markdown ファイルからのリンク。
+	// Emoji は絵文字のアイコン。いずれも書き出す直前に writeSitePage が設定する
+	Cover, Icon, Emoji string
+}
+
+// displayTitle はアイコンの絵文字をタイトルの前に付けます（Notion の見た目に合わせる）
+func (p *sitePage) displayTitle() string {
+	if p.Emoji == "" {
+		return p.Title
+	}
+	return p.Emoji + " " + p.Title
+}
+
+// setPageImages はページのカバー画像とアイコンの画像を保存し、リンクを p に設定します
+func setPageImages(p *sitePage, assets *assetDownloader) {
+	if p.Page == nil {
+		return
+	}
+	if cover := p.Page.Cover; cover != nil && cover.GetURL() != "" {
+		p.Cover = assets.localize(cover.GetURL())
+	}
+	if icon := p.Page.Icon; icon != nil {
+		if icon.Emoji != nil {
+			p.Emoji = string(*icon.Emoji)
+		} else if icon.GetURL() != "" {
+			p.Icon = assets.localize(icon.GetURL())
+		}
+	}
+}
+
+// pageBanner はカバー画像とアイコンの画像を本文の先頭に置く Markdown です（フロントマターで指定できないプリセット用）
+func pageBanner(p *sitePage) string {
+	var sb strings.Builder
+	if p.Cover != "" {
+		sb.WriteString("![](" + p.Cover + ")\n\n")
+	}
+	if p.Icon != "" {
+		sb.WriteString("![](" + p.Icon + ")\n\n")
+	}
+	return sb.String()
+}
+
+// sitePreset decides where and how each page is written for a particular
+// static site generator or note-taking tool.
+type sitePreset interface {
+	// prepare はすべてのページを収集した後、書き出す前に一度だけ呼ばれます（スラッグの割り当てなど）
+	prepare(pages []*sitePage)
+	// pageFile は出力先ディレクトリからの Markdown ファイルの相対パスを返します
+	pageFile(p *sitePage) string
+	// assetDir は出力先ディレクトリからの、ページの画像などの保存先を返します
+	assetDir(p *sitePage) string
+	// frontMatter は Markdown の先頭に付けるフロントマターを返します（不要なら空文字列）
+	frontMatter(p *sitePage) string
+	// subPages が true の場合、子ページもたどって階層ごと書き出します
+	subPages() bool
+}
+
+// siteRendererConfigurer is implemented by presets that change how a page is
+// rendered, such as rewriting links to other exported pages.
+type siteRendererConfigurer interface {
+	configureRenderer(r *renderer.Markdown, p *sitePage)
+}
+
+// siteFinisher is implemented by presets that write extra files, such as
+// navigation, after all pages are written. It returns the written paths.
+type siteFinisher interface {
+	finish(outDir string, pages []*sitePage) ([]string, error)
+}
+
+// siteContentPreparer is implemented by presets that need the content of
+// every page before any page is written, such as to extract data from it.
+// It runs after prepare and may fill in each page's tree.
+type siteContentPreparer interface {
+	prepareContent(ctx context.Context, client *notionapi.Client, pages []*sitePage) error
+}
+
+// sitePresets は --preset で選択できるプリセット
+var sitePresets = map[string]func() sitePreset{
+	"hugo":       func() sitePreset { return &hugoPreset{} },
+	"obsidian":   func() sitePreset { return &obsidianPreset{} },
+	"docusaurus": func() sitePreset { return &docusaurusPreset{} },
+	"mkdocs":     func() sitePreset { return &mkdocsPreset{} },
+	"meeting":    func() sitePreset { return &meetingPreset{} },
+}
+
+// exportSite writes a page, or every row of a database, into outDir using the
+// preset's layout. It returns the paths of all written files. Progress is
+// saved in cp, so that a failed or interrupted export can be resumed; the
+// checkpoint is removed when the export succeeds. Up to concurrency pages are
+// fetched and written at the same time; the requests of all of them share
+// the rate limit of the Notion API (--rate-limit).
+func exportSite(ctx context.Context, client *notionapi.Client, rootID notionapi.BlockID, preset sitePreset, outDir string, stripVolatile bool, diagrams *diagramRenderer, concurrency int, cp *exportCheckpoint) ([]string, error) {
+	files, err := exportSitePages(ctx, client, rootID, preset, outDir, stripVolatile, diagrams, concurrency, cp)
+	if err != nil {
+		if saveErr := cp.save(true); saveErr != nil {
+			log.Printf("warning: failed to save the checkpoint: %v", saveErr)
+		} else {
+			log.Printf("saved the progress in %s; run the same command with --resume to continue", cp.path)
+		}
+		return nil, err
+	}
+	if err := cp.remove(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func exportSitePages(ctx context.Context, client *notionapi.Client, rootID notionapi.BlockID, preset sitePreset, outDir string, stripVolatile bool, diagrams *diagramRenderer, concurrency int, cp *exportCheckpoint) ([]string, error) {
+	var roots []*sitePage
+	if cp.Roots != nil {
+		for _, id := range cp.Roots {
+			roots = append(roots, cp.sitePage(id, nil))
+		}
+	} else {
+		var err error
+		roots, err = collectSitePages(ctx, client, rootID, cp.Filters)
+		if err != nil {
+			return nil, err
+		}
+		cp.Roots = make([]notionapi.BlockID, len(roots))
+		for i, root := range roots {
+			cp.Roots[i] = root.ID
+			cp.addPage(root)
+		}
+		if err := cp.save(true); err != nil {
+			return nil, err
+		}
+	}
+	if preset.subPages() {
+		pool := newWorkPool(ctx, concurrency)
+		for _, root := range roots {
+			pool.add(func(ctx context.Context) error {
+				return expandSubPages(ctx, client, root, cp, pool)
+			})
+		}
+		if err := pool.wait(); err != nil {
+			return nil, err
+		}
+	}
+	pages := flattenSitePages(roots)
+	if cp.Pending == nil {
+		cp.Pending = make([]notionapi.BlockID, len(pages))
+		for i, p := range pages {
+			cp.Pending[i] = p.ID
+		}
+		if err := cp.save(true); err != nil {
+			return nil, err
+		}
+	}
+	pending := make(map[notionapi.BlockID]bool, len(cp.Pending))
+	for _, id := range cp.Pending {
+		pending[id] = true
+	}
+	preset.prepare(pages)
+	if c, ok := preset.(siteContentPreparer); ok {
+		if err := c.prepareContent(ctx, client, pages); err != nil {
+			return nil, err
+		}
+	}
+
+	// 保存先が同じページどうしでファイル名が衝突しないよう、ファイル名の対応は保存先ごとに共有する。
+	// 再開した場合は、書き出し済みのページが保存したファイル名を使い続ける
+	downloaders := make(map[string]*assetDownloader)
+	optimizer := newImageOptimizer(cp.exportSettings)
+	pool := newWorkPool(ctx, concurrency)
+	for _, p := range pages {
+		if !pending[p.ID] {
+			continue
+		}
+		shared, ok := downloaders[preset.assetDir(p)]
+		if !ok {
+			shared = newAssetDownloader(ctx, filepath.Join(outDir, preset.assetDir(p)), "")
+			if cp.AssetNames == "hash" {
+				shared.useContentHashes()
+			}
+			if optimizer != nil {
+				shared.optimizeImages(optimizer)
+			}
+			shared.restoreFileNames(cp.assets(preset.assetDir(p)))
+			downloaders[preset.assetDir(p)] = shared
+			cp.trackAssets(preset.assetDir(p), shared)
+		}
+		pool.add(func(ctx context.Context) error {
+			assets := shared.forPage("")
+			pageCtx, span := startSpan(ctx, "render page", spanKindInternal)
+			span.setAttr("notion.page_id", string(p.ID))
+			span.setAttr("format", "markdown")
+			start := time.Now()
+			file, missing, err := writeSitePage(pageCtx, client, p, preset, filepath.Join(outDir, preset.pageFile(p)), assets, stripVolatile, diagrams)
+			span.failed(err != nil)
+			span.end()
+			metrics.observeRender("markdown", time.Since(start))
+			if err != nil {
+				return err
+			}
+			cp.written(p.ID, append([]string{file}, assets.files...), assets.refs, missing)
+			return cp.save(false)
+		})
+	}
+	if err := pool.wait(); err != nil {
+		return nil, err
+	}
+	if optimizer != nil {
+		if summary := optimizer.summary(); summary != "" {
+			fmt.Fprintln(os.Stderr, summary)
+		}
+	}
+
+	files := cp.Files
+	if f, ok := preset.(siteFinisher); ok {
+		written, err := f.finish(outDir, pages)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, written...)
+	}
+
+	manifest, err := writeExportManifest(outDir, pages, preset, cp, files, stripVolatile)
+	if err != nil {
+		return nil, err
+	}
+	if n := cp.incomplete(); n > 0 {
+		log.Printf("warning: %d pages were exported with missing blocks; see missing_blocks in %s", n, manifest)
+	}
+	return append(files, manifest), nil
+}
+
+// writeSitePage はページを書き出し、子ブロックを取得しきれなかったブロックのIDを返します
+func writeSitePage(ctx context.Context, client *notionapi.Client, p *sitePage, preset sitePreset, file string, assets *assetDownloader, stripVolatile bool, diagrams *diagramRenderer) (string, []notionapi.BlockID, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return "", nil, err
+	}
+
+	// 画像へのリンクは Markdown ファイルからの相対パスで書く
+	link, err := filepath.Rel(filepath.Dir(file), assets.dir)
+	if err != nil {
+		return "", nil, err
+	}
+	if link == "." {
+		link = ""
+	}
+	assets.link = filepath.ToSlash(link)
+
+	tree := p.tree
+	if tree == nil {
+		tree, err = fetchPageTree(ctx, client, p.ID, fetchLimits{SkipChildPages: true})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	setPageImages(p, assets)
+	var sb strings.Builder
+	sb.WriteString(preset.frontMatter(p))
+	r := newMarkdownRenderer()
+	r.StripVolatile = stripVolatile
+	if assets != nil {
+		r.Localize = assets.localize
+	}
+	r.Diagram = diagrams.linker(assets)
+	if c, ok := preset.(siteRendererConfigurer); ok {
+		c.configureRenderer(r, p)
+	}
+	r.PrintBlocks(&sb, tree.Root.Children, 0)
+
+	if err := os.WriteFile(file, []byte(sb.String()), 0o644); err != nil {
+		return "", nil, err
+	}
+	return file, tree.Missing, nil
+}
+
+// collectSitePages はIDがデータベースならその全行（conds があれば一致する行）を、ページならそのページ自体を返します
+func collectSitePages(ctx context.Context, client *notionapi.Client, rootID notionapi.BlockID, conds []propertyCondition) ([]*sitePage, error) {
+	block, err := client.Block.Get(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.(type) {
+	case *notionapi.ChildDatabaseBlock:
+		filter, err := databaseFilter(ctx, client, notionapi.DatabaseID(rootID), conds)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := queryDatabaseFiltered(ctx, client, notionapi.DatabaseID(rootID), filter, nil)
+		if err != nil {
+			return nil, err
+		}
+		pages := make([]*sitePage, 0, len(rows))
+		for i := range rows {
+			row := &rows[i]
+			pages = append(pages, &sitePage{ID: notionapi.BlockID(row.ID), Title: propertyTitle(row), Page: row})
+		}
+		return pages, nil
+
+	case *notionapi.ChildPageBlock:
+		if len(conds) > 0 {
+			return nil, fmt.Errorf("--filter can only be used with a database, and %s is a page", rootID)
+		}
+		page, err := client.Page.Get(ctx, notionapi.PageID(rootID))
+		if err != nil {
+			return nil, err
+		}
+		return []*sitePage{{ID: rootID, Title: propertyTitle(page), Page: page}}, nil
+
+	default:
+		return nil, fmt.Errorf("%s is neither a page nor a database (type %s)", rootID, block.GetType())
+	}
+}
+
+// expandSubPages はページのブロックツリーを取得し、その中の子ページを Children に加えて、子ページも pool で展開します。
+// チェックポイントに子ページが記録されているページは取得し直さない
+func expandSubPages(ctx context.Context, client *notionapi.Client, p *sitePage, cp *exportCheckpoint, pool *workPool) error {
+	if p.Page == nil {
+		page, err := client.Page.Get(ctx, notionapi.PageID(p.ID))
+		if err != nil {
+			return err
+		}
+		p.Page = page
+		cp.setPage(p)
+	}
+	if ids, ok := cp.expanded(p.ID); ok {
+		for _, id := range ids {
+			p.Children = append(p.Children, cp.sitePage(id, p))
+		}
+	} else {
+		tree, err := fetchPageTree(ctx, client, p.ID, fetchLimits{SkipChildPages: true})
+		if err != nil {
+			return err
+		}
+		p.tree = tree
+		for _, child := range tree.ChildPages() {
+			p.Children = append(p.Children, &sitePage{ID: child.ID, Title: child.ChildPage.Title, Parent: p})
+		}
+		cp.setChildren(p)
+		if err := cp.save(false); err != nil {
+			return err
+		}
+	}
+
+	// 子ページの Page と Children はそれぞれのタスクだけが書き換え、すべてのタスクが終わった後に読む
+	for _, sub := range p.Children {
+		pool.add(func(ctx context.Context) error {
+			return expandSubPages(ctx, client, sub, cp, pool)
+		})
+	}
+	return nil
+}
+
+// flattenSitePages はページの階層を親から子の順に並べます
+func flattenSitePages(pages []*sitePage) []*sitePage {
+	var flat []*sitePage
+	for _, p := range pages {
+		flat = append(flat, p)
+		flat = append(flat, flattenSitePages(p.Children)...)
+	}
+	return flat
+}
+
+// uniqueSlugs はページごとに重複しないスラッグを割り当てます。
+// 重複した場合は後のページに連番を付けます。大文字と小文字を区別しないファイルシステムのため、大文字小文字だけの違いも重複とみなす
+func uniqueSlugs(pages []*sitePage, slugOf func(p *sitePage) string) map[*sitePage]string {
+	slugs := make(map[*sitePage]string, len(pages))
+	used := make(map[string]bool, len(pages))
+	for _, p := range pages {
+		base := slugOf(p)
+		if base == "" {
+			base = compactPageID(string(p.ID))
+		}
+		slug := base
+		for i := 2; used[strings.ToLower(slug)]; i++ {
+			slug = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[strings.ToLower(slug)] = true
+		slugs[p] = slug
+	}
+	return slugs
+}
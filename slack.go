@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// slackRenderer renders a block tree as Slack mrkdwn. Slack has no headings,
+// tables or nested lists, so headings become bold lines, tables become
+// preformatted text and nesting is shown with indentation.
+// https://api.slack.com/reference/surfaces/formatting
+type slackRenderer struct {
+	stripVolatile bool
+}
+
+// writeSlack writes the page title, the page's blocks and the summary if
+// given as Slack mrkdwn.
+func writeSlack(w io.Writer, title string, tree *PageTree, summary string, stripVolatile bool) error {
+	r := &slackRenderer{stripVolatile: stripVolatile}
+	fmt.Fprintf(w, "*%s*\n\n", slackEscape(title))
+	r.blocks(w, tree.Root.Children, 0)
+	if summary != "" {
+		fmt.Fprintf(w, "\n*AI による要約*\n%s\n", slackEscape(strings.TrimSpace(summary)))
+	}
+	return nil
+}
+
+func (r *slackRenderer) blocks(w io.Writer, nodes []*BlockNode, depth int) {
+	number := 0
+	list := false
+	for _, node := range nodes {
+		if _, ok := node.Block.(*notionapi.NumberedListItemBlock); ok {
+			number++
+		} else {
+			number = 0
+		}
+		// リスト項目は空行を挟まずに並べ、リストの後に空行を1つ入れる
+		item := slackListItem(node.Block)
+		if list && !item {
+			fmt.Fprintln(w)
+		}
+		list = item
+		if r.block(w, node, depth, number) {
+			r.blocks(w, node.Children, depth+1)
+		}
+	}
+	if list && depth == 0 {
+		fmt.Fprintln(w)
+	}
+}
+
+func slackListItem(block notionapi.Block) bool {
+	switch block.(type) {
+	case *notionapi.BulletedListItemBlock, *notionapi.NumberedListItemBlock, *notionapi.ToDoBlock:
+		return true
+	}
+	return false
+}
+
+// block は1つのブロックを出力し、子ブロックを続けて出力すべきかを返します
+func (r *slackRenderer) block(w io.Writer, node *BlockNode, depth, number int) bool {
+	indent := strings.Repeat("    ", depth)
+	switch b := node.Block.(type) {
+	case *notionapi.ParagraphBlock:
+		fmt.Fprintf(w, "%s%s\n\n", indent, r.richText(b.Paragraph.RichText))
+
+	case *notionapi.Heading1Block:
+		fmt.Fprintf(w, "%s%s*%s*\n\n", indent, toggleMarker(b, "▸ "), slackEscape(renderer.PlainText(b.Heading1.RichText)))
+
+	case *notionapi.Heading2Block:
+		fmt.Fprintf(w, "%s%s*%s*\n\n", indent, toggleMarker(b, "▸ "), slackEscape(renderer.PlainText(b.Heading2.RichText)))
+
+	case *notionapi.Heading3Block:
+		fmt.Fprintf(w, "%s%s*%s*\n\n", indent, toggleMarker(b, "▸ "), slackEscape(renderer.PlainText(b.Heading3.RichText)))
+
+	case *notionapi.BulletedListItemBlock:
+		fmt.Fprintf(w, "%s• %s\n", indent, r.richText(b.BulletedListItem.RichText))
+
+	case *notionapi.NumberedListItemBlock:
+		fmt.Fprintf(w, "%s%d. %s\n", indent, number, r.richText(b.NumberedListItem.RichText))
+
+	case *notionapi.ToDoBlock:
+		checkbox := "☐"
+		if b.ToDo.Checked {
+			checkbox = "☑"
+		}
+		fmt.Fprintf(w, "%s%s %s\n", indent, checkbox, r.richText(b.ToDo.RichText))
+
+	case *notionapi.ImageBlock:
+		src := ""
+		if b.Image.Type == "external" {
+			src = b.Image.External.URL
+		} else if b.Image.Type == "file" {
+			src = b.Image.File.URL
+			if r.stripVolatile {
+				src = renderer.StripURLSignature(src)
+			}
+		}
+		label := renderer.PlainText(b.Image.Caption)
+		if label == "" {
+			label = "Image"
+		}
+		fmt.Fprintf(w, "%s<%s|%s>\n\n", indent, src, slackEscape(label))
+
+	case *notionapi.CodeBlock:
+		fmt.Fprintf(w, "```\n%s\n```\n\n", slackEscape(renderer.PlainText(b.Code.RichText)))
+		if caption := strings.TrimSpace(renderer.PlainText(b.Code.Caption)); caption != "" {
+			fmt.Fprintf(w, "_%s_\n\n", slackEscape(caption))
+		}
+
+	case *notionapi.QuoteBlock:
+		for _, line := range strings.Split(r.richText(b.Quote.RichText), "\n") {
+			fmt.Fprintf(w, "%s> %s\n", indent, line)
+		}
+		fmt.Fprintln(w)
+
+	case *notionapi.CalloutBlock:
+		icon := "💡"
+		if b.Callout.Icon != nil && b.Callout.Icon.Type == "emoji" {
+			icon = string(*b.Callout.Icon.Emoji)
+		}
+		fmt.Fprintf(w, "%s> %s %s\n\n", indent, icon, r.richText(b.Callout.RichText))
+
+	case *notionapi.DividerBlock:
+		fmt.Fprintf(w, "%s──────────\n\n", indent)
+
+	case *notionapi.ToggleBlock:
+		fmt.Fprintf(w, "%s▸ %s\n", indent, r.richText(b.Toggle.RichText))
+
+	case *notionapi.TableBlock:
+		r.table(w, node.Children)
+		return false
+
+	case *notionapi.ChildPageBlock:
+		fmt.Fprintf(w, "*%s*\n\n", slackEscape(b.ChildPage.Title))
+		r.blocks(w, node.Children, depth)
+		return false
+
+	case *notionapi.ColumnListBlock, *notionapi.ColumnBlock:
+		r.blocks(w, node.Children, depth)
+		return false
+	}
+	return true
+}
+
+// table は表を列をそろえた整形済みテキストにします
+func (r *slackRenderer) table(w io.Writer, rows []*BlockNode) {
+	var cells [][]string
+	var widths []int
+	for _, row := range rows {
+		tr, ok := row.Block.(*notionapi.TableRowBlock)
+		if !ok {
+			continue
+		}
+		var line []string
+		for i, cell := range tr.TableRow.Cells {
+			text := strings.ReplaceAll(renderer.PlainText(cell), "\n", " ")
+			line = append(line, text)
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], displayWidth(text))
+		}
+		cells = append(cells, line)
+	}
+	fmt.Fprintln(w, "```")
+	for _, line := range cells {
+		for i, text := range line {
+			if i < len(line)-1 {
+				text += strings.Repeat(" ", widths[i]-displayWidth(text)) + " | "
+			}
+			fmt.Fprint(w, slackEscape(text))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprint(w, "```\n\n")
+}
+
+// richText はリッチテキストを装飾（太字・斜体・取り消し線・コード）とリンクを含むmrkdwnにします
+func (r *slackRenderer) richText(richText []notionapi.RichText) string {
+	var sb strings.Builder
+	for _, text := range richText {
+		// 記号の内側の先頭と末尾に空白があると書式として扱われないため、外に出す
+		body := strings.TrimSpace(text.PlainText)
+		if body == "" {
+			sb.WriteString(text.PlainText)
+			continue
+		}
+		lead := text.PlainText[:strings.Index(text.PlainText, body)]
+		trail := text.PlainText[len(lead)+len(body):]
+
+		s := slackEscape(body)
+		if a := text.Annotations; a != nil {
+			if a.Code {
+				s = "`" + s + "`"
+			}
+			if a.Bold {
+				s = "*" + s + "*"
+			}
+			if a.Italic {
+				s = "_" + s + "_"
+			}
+			if a.Strikethrough {
+				s = "~" + s + "~"
+			}
+		}
+		// ワークスペース内へのリンク（"/" で始まる）は外部からは開けないため、テキストのみにする
+		if text.Href != "" && !strings.HasPrefix(text.Href, "/") {
+			s = "<" + text.Href + "|" + s + ">"
+		}
+		sb.WriteString(lead + s + trail)
+	}
+	return sb.String()
+}
+
+// slackEscape はmrkdwnで制御文字として扱われる &, <, > をエスケープします
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+
+// slackMessageLimit はSlackが1つのメッセージで受け付けるテキストの長さ（40,000文字）に余裕を持たせたもの
+const slackMessageLimit = 39000
+
+// splitSlackMessage は長いテキストを行単位で複数のメッセージに分けます。
+// コードブロックの途中で分けた場合は、前後のメッセージでブロックを閉じ直す
+func splitSlackMessage(text string) []string {
+	var messages []string
+	var sb strings.Builder
+	inCode := false
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if sb.Len() > 0 && sb.Len()+len(line) > slackMessageLimit {
+			if inCode {
+				sb.WriteString("\n```")
+			}
+			messages = append(messages, sb.String())
+			sb.Reset()
+			if inCode {
+				sb.WriteString("```\n")
+			}
+		}
+		sb.WriteString(line)
+		if strings.HasPrefix(line, "```") {
+			inCode = !inCode
+		}
+	}
+	if strings.TrimSpace(sb.String()) != "" {
+		messages = append(messages, sb.String())
+	}
+	return messages
+}
+
+// postSlack posts text to Slack. target is either an incoming webhook URL or
+// a channel name or ID, which is posted to with chat.postMessage using the
+// bot token in SLACK_BOT_TOKEN.
+func postSlack(ctx context.Context, target, text string) error {
+	webhook := strings.HasPrefix(target, "https://")
+	token := os.Getenv("SLACK_BOT_TOKEN")
+	if !webhook && token == "" {
+		return fmt.Errorf("SLACK_BOT_TOKEN must be set to post to channel %s (or pass an incoming webhook URL)", target)
+	}
+
+	for _, message := range splitSlackMessage(text) {
+		payload := map[string]any{"text": message, "unfurl_links": false}
+		u := target
+		if !webhook {
+			payload["channel"] = strings.TrimPrefix(target, "#")
+			u = "https://slack.com/api/chat.postMessage"
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		if !webhook {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if err := doSlackRequest(req, webhook); err != nil {
+			return fmt.Errorf("failed to post to Slack: %w", err)
+		}
+	}
+	return nil
+}
+
+// doSlackRequest はリクエストを送信します。Web API はエラーでも 200 を返すため、本文の ok を確認する
+func doSlackRequest(req *http.Request, webhook bool) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if webhook {
+		return nil
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(msg, &result); err != nil {
+		return fmt.Errorf("unexpected response: %s", strings.TrimSpace(string(msg)))
+	}
+	if !result.OK {
+		return fmt.Errorf("%s", result.Error)
+	}
+	return nil
+}
+
+// slackSummaryMessage は --post-slack-summary で投稿する、ページのタイトルとAIによる要約だけのメッセージを作ります
+func slackSummaryMessage(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, limits fetchLimits) (string, error) {
+	title, err := fetchPageTitle(ctx, client, pageID)
+	if err != nil {
+		return "", err
+	}
+	tree, err := fetchPageTree(ctx, client, pageID, limits)
+	if err != nil {
+		return "", err
+	}
+	var contentBuilder strings.Builder
+	collectContent(tree.Root.Children, &contentBuilder)
+	summary, err := summarizeContent(contentBuilder.String())
+	if err != nil {
+		return "", fmt.Errorf("error generating summary: %w", err)
+	}
+	return fmt.Sprintf("*%s*\n%s\n", slackEscape(title), slackEscape(strings.TrimSpace(summary))), nil
+}
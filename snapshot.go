@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// snapshotIDFormat はスナップショットのIDに使う時刻の書式（UTC）
+const snapshotIDFormat = "20060102T150405Z"
+
+// snapshot is one stored rendering of a page.
+type snapshot struct {
+	ID   string
+	Time time.Time
+	path string
+}
+
+// snapshotStore keeps timestamped Markdown renderings of a single page in the
+// local cache directory.
+type snapshotStore struct {
+	dir string
+}
+
+func openSnapshotStore(pageID string) (*snapshotStore, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshotStore{dir: filepath.Join(dir, "snapshots", pageID)}, nil
+}
+
+// list returns the stored snapshots from oldest to newest.
+func (s *snapshotStore) list() ([]snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snaps []snapshot
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".md")
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(snapshotIDFormat, id)
+		if err != nil {
+			continue
+		}
+		snaps = append(snaps, snapshot{ID: id, Time: t, path: filepath.Join(s.dir, e.Name())})
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Time.Before(snaps[j].Time) })
+	return snaps, nil
+}
+
+// latest returns the newest snapshot, or nil if there are none.
+func (s *snapshotStore) latest() (*snapshot, error) {
+	snaps, err := s.list()
+	if err != nil || len(snaps) == 0 {
+		return nil, err
+	}
+	return &snaps[len(snaps)-1], nil
+}
+
+// resolve finds a snapshot by "latest", its full ID, or a unique ID prefix.
+func (s *snapshotStore) resolve(ref string) (*snapshot, error) {
+	snaps, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	if ref == "latest" {
+		if len(snaps) == 0 {
+			return nil, fmt.Errorf("no snapshots found")
+		}
+		return &snaps[len(snaps)-1], nil
+	}
+
+	var found []snapshot
+	for _, snap := range snaps {
+		if strings.HasPrefix(snap.ID, ref) {
+			found = append(found, snap)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("snapshot %q not found", ref)
+	case 1:
+		return &found[0], nil
+	default:
+		return nil, fmt.Errorf("snapshot %q is ambiguous (%d matches)", ref, len(found))
+	}
+}
+
+func (s *snapshotStore) read(snap *snapshot) (string, error) {
+	data, err := os.ReadFile(snap.path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// save stores content as a new snapshot taken at t.
+func (s *snapshotStore) save(content string, t time.Time) (*snapshot, error) {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return nil, err
+	}
+	t = t.UTC().Truncate(time.Second)
+	id := t.Format(snapshotIDFormat)
+	path := filepath.Join(s.dir, id+".md")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		return nil, err
+	}
+	return &snapshot{ID: id, Time: t, path: path}, nil
+}
+
+// runSnapshot dispatches the snapshot subcommands.
+func runSnapshot(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs snapshot save <page-id>")
+		fmt.Fprintln(os.Stderr, "       notion-dfs snapshot list <page-id>")
+		fmt.Fprintln(os.Stderr, "       notion-dfs snapshot diff <page-id> <snapshot> [<snapshot>]")
+		fmt.Fprintln(os.Stderr, "       notion-dfs snapshot export [-o file] <page-id> <snapshot>")
+		fmt.Fprintln(os.Stderr, "\n<snapshot> is a snapshot ID (or a unique prefix of it) or \"latest\".")
+	}
+	if len(args) < 1 {
+		usage()
+		exit(1)
+	}
+
+	fs := flag.NewFlagSet("snapshot "+args[0], flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	fs.Usage = usage
+	output := fs.String("o", "", "write the exported snapshot to this file instead of stdout")
+	parseFlags(fs, args[1:])
+	if fs.NArg() < 1 {
+		usage()
+		exit(1)
+	}
+
+	pageID := formatPageID(fs.Arg(0))
+	store, err := openSnapshotStore(pageID)
+	if err != nil {
+		fatal(err)
+	}
+
+	switch args[0] {
+	case "save":
+		client := newNotionClient()
+		r := newMarkdownRenderer()
+		r.StripVolatile = true
+		content, err := renderPageMarkdown(context.Background(), client, notionapi.BlockID(pageID), r, fetchLimits{})
+		if err != nil {
+			exitWithNotionError("Error fetching blocks", err)
+		}
+		snap, saved, err := saveSnapshotIfChanged(store, content)
+		if err != nil {
+			fatalf("Error saving snapshot: %v", err)
+		}
+		if saved {
+			fmt.Printf("Saved snapshot %s\n", snap.ID)
+		} else {
+			fmt.Printf("Unchanged since snapshot %s\n", snap.ID)
+		}
+
+	case "list":
+		snaps, err := store.list()
+		if err != nil {
+			fatalf("Error listing snapshots: %v", err)
+		}
+		for _, snap := range snaps {
+			content, err := store.read(&snap)
+			if err != nil {
+				fatalf("Error reading snapshot: %v", err)
+			}
+			fmt.Printf("%s  %s  %d lines\n", snap.ID, snap.Time.Local().Format("2006-01-02 15:04:05"), len(splitLines(content)))
+		}
+
+	case "diff":
+		if fs.NArg() < 2 || fs.NArg() > 3 {
+			usage()
+			exit(1)
+		}
+		toRef := "latest"
+		if fs.NArg() == 3 {
+			toRef = fs.Arg(2)
+		}
+		from, fromContent := mustReadSnapshot(store, fs.Arg(1))
+		to, toContent := mustReadSnapshot(store, toRef)
+		diff := unifiedDiff(from.ID, to.ID, fromContent, toContent, 3)
+		if diff == "" {
+			fmt.Fprintln(os.Stderr, "No changes.")
+		}
+		fmt.Print(diff)
+
+	case "export":
+		if fs.NArg() != 2 {
+			usage()
+			exit(1)
+		}
+		_, content := mustReadSnapshot(store, fs.Arg(1))
+		if *output == "" {
+			fmt.Print(content)
+		} else if err := os.WriteFile(*output, []byte(content), 0o644); err != nil {
+			fatalf("Error writing snapshot: %v", err)
+		}
+
+	default:
+		usage()
+		exit(1)
+	}
+}
+
+// saveSnapshotIfChanged は直前のスナップショットと内容が異なる場合のみ保存します。
+// 保存しなかった場合は直前のスナップショットを返します
+func saveSnapshotIfChanged(store *snapshotStore, content string) (*snapshot, bool, error) {
+	last, err := store.latest()
+	if err != nil {
+		return nil, false, err
+	}
+	if last != nil {
+		previous, err := store.read(last)
+		if err != nil {
+			return nil, false, err
+		}
+		if previous == content {
+			return last, false, nil
+		}
+	}
+	snap, err := store.save(content, time.Now())
+	return snap, err == nil, err
+}
+
+func mustReadSnapshot(store *snapshotStore, ref string) (*snapshot, string) {
+	snap, err := store.resolve(ref)
+	if err != nil {
+		fatal(err)
+	}
+	content, err := store.read(snap)
+	if err != nil {
+		fatalf("Error reading snapshot: %v", err)
+	}
+	return snap, content
+}
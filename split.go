@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// splitSection はファイル1つ分のセクション。見出しより前の内容では heading が nil
+type splitSection struct {
+	heading *BlockNode
+	nodes   []*BlockNode
+}
+
+// parseSplitLevel は --split-by の値（h1・h2・h3）を見出しのレベルにします
+func parseSplitLevel(value string) (int, error) {
+	switch strings.ToLower(value) {
+	case "h1":
+		return 1, nil
+	case "h2":
+		return 2, nil
+	case "h3":
+		return 3, nil
+	}
+	return 0, fmt.Errorf("invalid --split-by %q (expected h1, h2 or h3)", value)
+}
+
+// splitSections はトップレベルのブロックを、level 以上の見出しごとのセクションに分けます
+func splitSections(nodes []*BlockNode, level int) []splitSection {
+	sections := []splitSection{{}}
+	for _, node := range nodes {
+		if l := headingLevel(node.Block); l > 0 && l <= level {
+			sections = append(sections, splitSection{heading: node})
+		}
+		last := &sections[len(sections)-1]
+		last.nodes = append(last.nodes, node)
+	}
+	if len(sections[0].nodes) == 0 {
+		sections = sections[1:]
+	}
+	return sections
+}
+
+// writeSplitPage writes each section of a page, split at the top-level
+// headings of the given level, into its own Markdown file in dir named after
+// the heading. Content before the first heading goes into index.md. It
+// returns the written files.
+func writeSplitPage(ctx context.Context, pageID notionapi.BlockID, opts exportOptions, level int, dir string) ([]string, error) {
+	tree, err := fetchExportTree(ctx, newNotionClient(), pageID, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	used := make(map[string]bool)
+	for _, section := range splitSections(tree.Root.Children, level) {
+		base := "index"
+		if section.heading != nil {
+			if base = renderer.Slugify(blockText(section.heading.Block)); base == "" {
+				base = compactPageID(string(section.heading.Block.GetID()))
+			}
+		}
+		name := base
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		used[name] = true
+
+		var sb strings.Builder
+		opts.markdownRenderer().PrintBlocks(&sb, section.nodes, 0)
+		file := filepath.Join(dir, name+".md")
+		if err := os.WriteFile(file, []byte(sb.String()), 0o644); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
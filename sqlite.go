@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// sqlitePageSize は書き出すデータベースファイルのページサイズ
+const sqlitePageSize = 4096
+
+// sqliteTable is a table written by writeSQLite: its CREATE TABLE statement
+// and its rows. Values may be nil, int64, int, float64, bool, string or
+// []byte.
+type sqliteTable struct {
+	Name string
+	SQL  string
+	// Key は INTEGER PRIMARY KEY の列の番号（なければ -1）。この列の値が行の rowid になる
+	Key  int
+	Rows [][]any
+}
+
+// writeSQLite writes a new SQLite 3 database file containing the tables, with
+// no indexes. It is a small writer for files that are created once and then
+// opened by other tools, so that no SQLite library (and no cgo) is needed:
+// every table is written as a balanced table b-tree, large values spill into
+// overflow pages, and the schema is stored in sqlite_master on page 1.
+func writeSQLite(w io.Writer, tables []sqliteTable) error {
+	db := &sqliteWriter{pages: [][]byte{nil}} // 1ページ目は sqlite_master のために空けておく
+	master := make([][]any, 0, len(tables))
+	for _, t := range tables {
+		cells, err := db.tableCells(t)
+		if err != nil {
+			return fmt.Errorf("table %s: %w", t.Name, err)
+		}
+		root := db.buildTree(cells, 0)
+		master = append(master, []any{"table", t.Name, t.Name, int64(root), t.SQL})
+	}
+	cells, err := db.tableCells(sqliteTable{Name: "sqlite_master", Key: -1, Rows: master})
+	if err != nil {
+		return err
+	}
+	db.buildTree(cells, 1)
+
+	header := db.pages[0][:100]
+	copy(header, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(header[16:], sqlitePageSize)
+	header[18], header[19] = 1, 1                   // ジャーナルモード（ロールバック）
+	header[21], header[22], header[23] = 64, 32, 32 // ペイロードの割合（固定値）
+	binary.BigEndian.PutUint32(header[24:], 1)      // 変更カウンター
+	binary.BigEndian.PutUint32(header[28:], uint32(len(db.pages)))
+	binary.BigEndian.PutUint32(header[40:], 1) // スキーマクッキー
+	binary.BigEndian.PutUint32(header[44:], 4) // スキーマフォーマット
+	binary.BigEndian.PutUint32(header[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(header[92:], 1)
+	binary.BigEndian.PutUint32(header[96:], 3045000)
+	for _, page := range db.pages {
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteWriter は書き出すページを番号順（1始まり）に持ちます
+type sqliteWriter struct {
+	pages [][]byte
+}
+
+// sqliteCell はb-treeのページに置くセルと、そのキー（rowid）です
+type sqliteCell struct {
+	rowid int64
+	data  []byte
+}
+
+func (db *sqliteWriter) allocate() (int, []byte) {
+	page := make([]byte, sqlitePageSize)
+	db.pages = append(db.pages, page)
+	return len(db.pages), page
+}
+
+// tableCells は表の各行をrowid順のリーフセルにします。収まらないペイロードはオーバーフローページに書き出す
+func (db *sqliteWriter) tableCells(t sqliteTable) ([]sqliteCell, error) {
+	cells := make([]sqliteCell, 0, len(t.Rows))
+	seen := make(map[int64]bool, len(t.Rows))
+	for i, row := range t.Rows {
+		rowid := int64(i + 1)
+		values := row
+		if t.Key >= 0 {
+			key, ok := sqliteInteger(row[t.Key])
+			if !ok {
+				return nil, fmt.Errorf("row %d: the INTEGER PRIMARY KEY must be an integer", i+1)
+			}
+			rowid = key
+			// rowid の別名の列はレコードには NULL として保存する
+			values = append([]any(nil), row...)
+			values[t.Key] = nil
+		}
+		if seen[rowid] {
+			return nil, fmt.Errorf("duplicate rowid %d", rowid)
+		}
+		seen[rowid] = true
+		payload, err := sqliteRecord(values)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i+1, err)
+		}
+		cells = append(cells, sqliteCell{rowid: rowid, data: db.leafCell(rowid, payload)})
+	}
+	sort.Slice(cells, func(i, j int) bool { return cells[i].rowid < cells[j].rowid })
+	return cells, nil
+}
+
+// leafCell はテーブルのリーフセルを作ります。ページに収まる分の長さの決め方はSQLiteのファイル形式の仕様どおり
+func (db *sqliteWriter) leafCell(rowid int64, payload []byte) []byte {
+	const usable = sqlitePageSize
+	maxLocal := usable - 35
+	minLocal := (usable-12)*32/255 - 23
+	local := len(payload)
+	if local > maxLocal {
+		local = minLocal + (len(payload)-minLocal)%(usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	cell := sqliteVarint(nil, uint64(len(payload)))
+	cell = sqliteVarint(cell, uint64(rowid))
+	cell = append(cell, payload[:local]...)
+	if local == len(payload) {
+		return cell
+	}
+	// 残りはオーバーフローページの連結リストに書く（各ページの先頭4バイトが次のページ番号）
+	rest := payload[local:]
+	first, prev := 0, []byte(nil)
+	for len(rest) > 0 {
+		n, page := db.allocate()
+		if prev == nil {
+			first = n
+		} else {
+			binary.BigEndian.PutUint32(prev, uint32(n))
+		}
+		k := copy(page[4:], rest)
+		rest = rest[k:]
+		prev = page
+	}
+	return binary.BigEndian.AppendUint32(cell, uint32(first))
+}
+
+// buildTree はセルをリーフページに詰め、必要なら内部ページを重ねて、ルートのページ番号を返します。
+// root が 0 でなければルートをそのページに書く（sqlite_master は常に1ページ目）
+func (db *sqliteWriter) buildTree(cells []sqliteCell, root int) int {
+	type child struct {
+		page   int
+		maxKey int64
+	}
+	rootCapacity := sqlitePageSize
+	if root == 1 {
+		rootCapacity -= 100
+	}
+
+	if sqlitePageFits(cells, rootCapacity, 8) {
+		return db.writePage(root, 0x0d, cells, 0)
+	}
+	var level []child
+	for _, group := range sqliteGroupCells(cells, sqlitePageSize, 8) {
+		level = append(level, child{db.writePage(0, 0x0d, group, 0), group[len(group)-1].rowid})
+	}
+	for {
+		// 内部ページのセルは左の子のページ番号とその子の最大のrowid。最後の子は右端のポインターにする
+		var keys []sqliteCell
+		for _, c := range level {
+			data := binary.BigEndian.AppendUint32(nil, uint32(c.page))
+			keys = append(keys, sqliteCell{rowid: c.maxKey, data: sqliteVarint(data, uint64(c.maxKey))})
+		}
+		if sqlitePageFits(keys[:len(keys)-1], rootCapacity, 12) {
+			last := level[len(level)-1]
+			return db.writePage(root, 0x05, keys[:len(keys)-1], last.page)
+		}
+		// 子を均等に分けて内部ページを作り、すべてのリーフを同じ深さにする
+		maxCell := 0
+		for _, k := range keys {
+			maxCell = max(maxCell, len(k.data))
+		}
+		perPage := (sqlitePageSize-12)/(maxCell+2) + 1
+		groups := (len(level) + perPage - 1) / perPage
+		var next []child
+		for g := 0; g < groups; g++ {
+			from, to := g*len(level)/groups, (g+1)*len(level)/groups
+			right := level[to-1]
+			next = append(next, child{db.writePage(0, 0x05, keys[from:to-1], right.page), right.maxKey})
+		}
+		level = next
+	}
+}
+
+// sqlitePageFits はセルがすべてページに収まるかを返します（header はページヘッダーの長さ）
+func sqlitePageFits(cells []sqliteCell, capacity, header int) bool {
+	size := header
+	for _, c := range cells {
+		size += len(c.data) + 2
+	}
+	return size <= capacity
+}
+
+// sqliteGroupCells はセルを先頭から、1ページに収まるだけずつに分けます
+func sqliteGroupCells(cells []sqliteCell, capacity, header int) [][]sqliteCell {
+	var groups [][]sqliteCell
+	size, start := header, 0
+	for i, c := range cells {
+		if size+len(c.data)+2 > capacity && i > start {
+			groups = append(groups, cells[start:i])
+			size, start = header, i
+		}
+		size += len(c.data) + 2
+	}
+	return append(groups, cells[start:])
+}
+
+// writePage はb-treeのページを書き、そのページ番号を返します。セルはページの末尾から詰める
+func (db *sqliteWriter) writePage(n int, kind byte, cells []sqliteCell, rightChild int) int {
+	var page []byte
+	if n == 0 {
+		n, page = db.allocate()
+	} else {
+		if db.pages[n-1] == nil {
+			db.pages[n-1] = make([]byte, sqlitePageSize)
+		}
+		page = db.pages[n-1]
+	}
+	offset := 0
+	if n == 1 {
+		offset = 100
+	}
+	header := page[offset:]
+	header[0] = kind
+	binary.BigEndian.PutUint16(header[3:], uint16(len(cells)))
+	pointers := 8
+	if kind == 0x05 {
+		binary.BigEndian.PutUint32(header[8:], uint32(rightChild))
+		pointers = 12
+	}
+	end := sqlitePageSize
+	for i, c := range cells {
+		end -= len(c.data)
+		copy(page[end:], c.data)
+		binary.BigEndian.PutUint16(header[pointers+2*i:], uint16(end))
+	}
+	// セルの開始位置（65536 は 0 で表す）
+	binary.BigEndian.PutUint16(header[5:], uint16(end%65536))
+	return n
+}
+
+// sqliteRecord は値の並びをSQLiteのレコード形式にします
+func sqliteRecord(values []any) ([]byte, error) {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = sqliteVarint(types, 0)
+		case string:
+			types = sqliteVarint(types, uint64(len(v))*2+13)
+			body = append(body, v...)
+		case []byte:
+			types = sqliteVarint(types, uint64(len(v))*2+12)
+			body = append(body, v...)
+		case float64:
+			types = sqliteVarint(types, 7)
+			body = binary.BigEndian.AppendUint64(body, math.Float64bits(v))
+		default:
+			n, ok := sqliteInteger(v)
+			if !ok {
+				return nil, fmt.Errorf("unsupported value type %T", v)
+			}
+			typ, size := sqliteIntegerType(n)
+			types = sqliteVarint(types, typ)
+			for i := size - 1; i >= 0; i-- {
+				body = append(body, byte(n>>(8*i)))
+			}
+		}
+	}
+	// ヘッダーの長さにはその長さ自体のvarintも含む
+	size := len(types) + 1
+	for len(sqliteVarint(nil, uint64(size))) != size-len(types) {
+		size++
+	}
+	record := sqliteVarint(nil, uint64(size))
+	record = append(record, types...)
+	return append(record, body...), nil
+}
+
+func sqliteInteger(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sqliteIntegerType は整数を保存する最小のシリアル型とバイト数を返します（0 と 1 は値を持たない型）
+func sqliteIntegerType(n int64) (uint64, int) {
+	switch {
+	case n == 0:
+		return 8, 0
+	case n == 1:
+		return 9, 0
+	case n >= -1<<7 && n < 1<<7:
+		return 1, 1
+	case n >= -1<<15 && n < 1<<15:
+		return 2, 2
+	case n >= -1<<23 && n < 1<<23:
+		return 3, 3
+	case n >= -1<<31 && n < 1<<31:
+		return 4, 4
+	case n >= -1<<47 && n < 1<<47:
+		return 5, 6
+	}
+	return 6, 8
+}
+
+// sqliteVarint はSQLiteの可変長整数（ビッグエンディアン、最大9バイト）を追加します
+func sqliteVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		// 9バイト目は8ビットすべてを使う
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	i := len(buf) - 1
+	buf[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		buf[i] = byte(v&0x7f) | 0x80
+	}
+	return append(b, buf[i:]...)
+}
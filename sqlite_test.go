@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSQLiteVarint(t *testing.T) {
+	tests := []struct {
+		v    uint64
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{1, []byte{0x01}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x81, 0x00}},
+		{300, []byte{0x82, 0x2c}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x81, 0x80, 0x00}},
+		{1<<56 - 1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{1 << 56, []byte{0x80, 0xc0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x00}},
+		{1<<64 - 1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, tt := range tests {
+		if got := sqliteVarint(nil, tt.v); !bytes.Equal(got, tt.want) {
+			t.Errorf("sqliteVarint(%d) = % x, want % x", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestSQLiteIntegerType(t *testing.T) {
+	tests := []struct {
+		n        int64
+		typ      uint64
+		wantSize int
+	}{
+		{0, 8, 0},
+		{1, 9, 0},
+		{2, 1, 1},
+		{-1, 1, 1},
+		{127, 1, 1},
+		{-128, 1, 1},
+		{128, 2, 2},
+		{-32768, 2, 2},
+		{32768, 3, 3},
+		{1 << 23, 4, 4},
+		{-1 << 31, 4, 4},
+		{1 << 31, 5, 6},
+		{1 << 47, 6, 8},
+		{-1 << 63, 6, 8},
+	}
+	for _, tt := range tests {
+		typ, size := sqliteIntegerType(tt.n)
+		if typ != tt.typ || size != tt.wantSize {
+			t.Errorf("sqliteIntegerType(%d) = %d, %d, want %d, %d", tt.n, typ, size, tt.typ, tt.wantSize)
+		}
+	}
+}
+
+func TestSQLiteRecord(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []any
+		want   []byte
+	}{
+		{"empty", nil, []byte{0x01}},
+		{"null", []any{nil}, []byte{0x02, 0x00}},
+		{"zero and one", []any{int64(0), true}, []byte{0x03, 0x08, 0x09}},
+		{"small integers", []any{2, int64(-1)}, []byte{0x03, 0x01, 0x01, 0x02, 0xff}},
+		{"integer", []any{int64(300)}, []byte{0x02, 0x02, 0x01, 0x2c}},
+		{"text", []any{"ab"}, []byte{0x02, 0x11, 'a', 'b'}},
+		{"blob", []any{[]byte{0xde, 0xad}}, []byte{0x02, 0x10, 0xde, 0xad}},
+		{"float", []any{1.5}, []byte{0x02, 0x07, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sqliteRecord(tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("sqliteRecord(%v) = % x, want % x", tt.values, got, tt.want)
+			}
+		})
+	}
+
+	// 列が多くヘッダーの長さが2バイトのvarintになる場合は、その長さ自体も含める
+	values := make([]any, 127)
+	record, err := sqliteRecord(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x81, 0x01}; !bytes.Equal(record[:2], want) {
+		t.Errorf("header length of 127 NULLs = % x, want % x", record[:2], want)
+	}
+
+	if _, err := sqliteRecord([]any{struct{}{}}); err == nil {
+		t.Error("sqliteRecord with an unsupported type: want an error")
+	}
+}
+
+func TestWriteSQLiteErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		table sqliteTable
+	}{
+		{"duplicate rowid", sqliteTable{Name: "t", SQL: "CREATE TABLE t(id INTEGER PRIMARY KEY)", Key: 0, Rows: [][]any{{1}, {1}}}},
+		{"text key", sqliteTable{Name: "t", SQL: "CREATE TABLE t(id INTEGER PRIMARY KEY)", Key: 0, Rows: [][]any{{"1"}}}},
+		{"unsupported value", sqliteTable{Name: "t", SQL: "CREATE TABLE t(v)", Key: -1, Rows: [][]any{{[]string{"a"}}}}},
+	}
+	for _, tt := range tests {
+		if err := writeSQLite(&bytes.Buffer{}, []sqliteTable{tt.table}); err == nil {
+			t.Errorf("%s: want an error", tt.name)
+		}
+	}
+}
+
+func TestWriteSQLite(t *testing.T) {
+	rows := make([][]any, 2000)
+	for i := range rows {
+		rows[i] = []any{int64(i * 3), strings.Repeat("x", i%50), float64(i) / 2, i%2 == 0}
+	}
+	tables := []sqliteTable{
+		{Name: "rows", SQL: "CREATE TABLE rows(id INTEGER PRIMARY KEY, name TEXT, half REAL, even INTEGER)", Key: 0, Rows: rows},
+		// ページに収まらない値はオーバーフローページに書く
+		{Name: "big", SQL: "CREATE TABLE big(body TEXT)", Key: -1, Rows: [][]any{{strings.Repeat("y", 3*sqlitePageSize)}, {nil}}},
+		{Name: "empty", SQL: "CREATE TABLE empty(v)", Key: -1},
+	}
+	var buf bytes.Buffer
+	if err := writeSQLite(&buf, tables); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte("SQLite format 3\x00")) {
+		t.Fatalf("missing header: %q", data[:16])
+	}
+	if len(data)%sqlitePageSize != 0 {
+		t.Fatalf("file size %d is not a multiple of the page size", len(data))
+	}
+	if pages := binary.BigEndian.Uint32(data[28:]); int(pages) != len(data)/sqlitePageSize {
+		t.Errorf("header page count = %d, want %d", pages, len(data)/sqlitePageSize)
+	}
+
+	// sqlite3 があれば、ファイルが壊れておらず値が読めることを確かめる
+	sqlite3, err := exec.LookPath("sqlite3")
+	if err != nil {
+		t.Skip("sqlite3 not found")
+	}
+	path := filepath.Join(t.TempDir(), "test.db")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	queries := []struct {
+		sql, want string
+	}{
+		{"PRAGMA integrity_check", "ok"},
+		{"SELECT count(*), sum(id), sum(length(name)), sum(half), sum(even) FROM rows", "2000|5997000|49000|999500.0|1000"},
+		{"SELECT name, half, even FROM rows WHERE id = 27", "xxxxxxxxx|4.5|0"},
+		{"SELECT length(body), substr(body, -3) FROM big WHERE rowid = 1", "12288|yyy"},
+		{"SELECT count(*) FROM big WHERE body IS NULL", "1"},
+		{"SELECT count(*) FROM empty", "0"},
+	}
+	for _, q := range queries {
+		out, err := exec.Command(sqlite3, path, q.sql).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v: %s", q.sql, err, out)
+		}
+		if got := strings.TrimSpace(string(out)); got != q.want {
+			t.Errorf("%s = %q, want %q", q.sql, got, q.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// sqliteMirrorSchema は --format sqlite で書き出すテーブル。writeSQLite はインデックスを作らないため
+// ID の列も PRIMARY KEY にはしない（必要なら開いた後に CREATE INDEX する）
+var sqliteMirrorSchema = []sqliteTable{
+	{Name: "pages", Key: -1, SQL: "CREATE TABLE pages (id text not null, title text not null, url text, parent_type text, parent_id text, database_id text, created_time text, last_edited_time text, archived integer not null, properties text not null)"},
+	{Name: "blocks", Key: -1, SQL: "CREATE TABLE blocks (id text not null, page_id text not null, parent_id text not null, position integer not null, depth integer not null, type text not null, text text, has_children integer not null, created_time text, last_edited_time text, json text not null)"},
+	{Name: "databases", Key: -1, SQL: "CREATE TABLE databases (id text not null, title text not null, url text, parent_id text, properties text not null)"},
+	{Name: "properties", Key: -1, SQL: "CREATE TABLE properties (page_id text not null, name text not null, type text not null, value, json text)"},
+	{Name: "relations", Key: -1, SQL: "CREATE TABLE relations (page_id text not null, property text not null, related_id text not null, position integer not null)"},
+}
+
+// sqliteMirror collects the pages, blocks and database rows under a page into
+// the rows of the tables of sqliteMirrorSchema. Sub-pages and databases are
+// followed wherever they appear, and the rows of a database are stored as
+// pages of their own with their content, so that the file mirrors the whole
+// tree.
+type sqliteMirror struct {
+	client *notionapi.Client
+	opts   exportOptions
+	dir    *pageDirectory
+	// tables は sqliteMirrorSchema と同じ順のテーブルの行
+	pages, blocks, databases, properties, relations [][]any
+	seen                                            map[string]bool
+}
+
+// writePageSQLite はページ（またはデータベース）とその下のすべてのページ・ブロック・データベースの行を
+// SQLite のデータベースファイルとして書きます
+func writePageSQLite(ctx context.Context, w io.Writer, client *notionapi.Client, rootID notionapi.BlockID, opts exportOptions) error {
+	m := &sqliteMirror{client: client, opts: opts, dir: workspacePages(client), seen: make(map[string]bool)}
+	block, err := client.Block.Get(ctx, rootID)
+	if err != nil {
+		return err
+	}
+	switch block.(type) {
+	case *notionapi.ChildDatabaseBlock:
+		err = m.addDatabase(ctx, notionapi.DatabaseID(rootID), "")
+	case *notionapi.ChildPageBlock:
+		var page *notionapi.Page
+		if page, err = client.Page.Get(ctx, notionapi.PageID(rootID)); err == nil {
+			err = m.addPage(ctx, page)
+		}
+	default:
+		return fmt.Errorf("%s is neither a page nor a database (type %s)", rootID, block.GetType())
+	}
+	if err != nil {
+		return err
+	}
+
+	tables := append([]sqliteTable(nil), sqliteMirrorSchema...)
+	for i, rows := range [][][]any{m.pages, m.blocks, m.databases, m.properties, m.relations} {
+		tables[i].Rows = rows
+	}
+	return writeSQLite(w, tables)
+}
+
+// addPage はページ、そのプロパティとブロックを加え、ブロックの中の子ページとデータベースをたどります
+func (m *sqliteMirror) addPage(ctx context.Context, page *notionapi.Page) error {
+	id := formatPageID(string(page.ID))
+	if m.seen[id] {
+		return nil
+	}
+	m.seen[id] = true
+
+	m.dir.resolve(ctx, m.client, page, m.opts.relations.depth)
+	values := make(map[string]any, len(page.Properties))
+	for _, name := range sortedPropertyNames(page) {
+		prop := page.Properties[name]
+		value := m.dir.propertyValue(prop, m.opts.relations)
+		values[name] = value
+		m.properties = append(m.properties, []any{id, name, string(prop.GetType()), m.dir.sqliteValue(prop, m.opts.relations), sqliteJSON(value)})
+		if rel, ok := prop.(*notionapi.RelationProperty); ok {
+			for i, r := range rel.Relation {
+				m.relations = append(m.relations, []any{id, name, formatPageID(string(r.ID)), int64(i)})
+			}
+		}
+	}
+	parentType, parentID := sqliteParent(page.Parent)
+	var databaseID any
+	if page.Parent.Type == notionapi.ParentTypeDatabaseID {
+		databaseID = parentID
+	}
+	m.pages = append(m.pages, []any{id, propertyTitle(page), page.URL, parentType, parentID, databaseID,
+		sqliteTime(page.CreatedTime), sqliteTime(page.LastEditedTime), page.Archived, sqliteJSON(values)})
+
+	limits := m.opts.limits
+	limits.SkipChildPages = true
+	tree, err := fetchPageTree(ctx, m.client, notionapi.BlockID(page.ID), limits)
+	if err != nil {
+		return err
+	}
+	return m.addBlocks(ctx, id, id, tree.Root.Children, 0)
+}
+
+// addBlocks はブロックを親の中の順番と深さとともに加えます
+func (m *sqliteMirror) addBlocks(ctx context.Context, pageID, parentID string, nodes []*BlockNode, depth int) error {
+	for i, node := range nodes {
+		b := node.Block
+		id := formatPageID(string(b.GetID()))
+		var created, edited any
+		if t := b.GetCreatedTime(); t != nil {
+			created = sqliteTime(*t)
+		}
+		if t := b.GetLastEditedTime(); t != nil {
+			edited = sqliteTime(*t)
+		}
+		m.blocks = append(m.blocks, []any{id, pageID, parentID, int64(i), int64(depth), string(b.GetType()), sqliteText(blockText(b)),
+			b.GetHasChildren(), created, edited, sqliteJSON(b)})
+
+		switch b := b.(type) {
+		case *notionapi.ChildPageBlock:
+			page, err := m.client.Page.Get(ctx, notionapi.PageID(b.ID))
+			if err != nil {
+				return err
+			}
+			if err := m.addPage(ctx, page); err != nil {
+				return err
+			}
+		case *notionapi.ChildDatabaseBlock:
+			if err := m.addDatabase(ctx, notionapi.DatabaseID(b.ID), pageID); err != nil {
+				return err
+			}
+		}
+		if err := m.addBlocks(ctx, pageID, id, node.Children, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addDatabase はデータベースのスキーマと、すべての行をページとして加えます
+func (m *sqliteMirror) addDatabase(ctx context.Context, databaseID notionapi.DatabaseID, parentID string) error {
+	id := formatPageID(string(databaseID))
+	if m.seen[id] {
+		return nil
+	}
+	m.seen[id] = true
+
+	schema, err := fetchDatabaseSchema(ctx, m.client, databaseID)
+	if err != nil {
+		return err
+	}
+	rows, err := queryDatabase(ctx, m.client, databaseID, nil)
+	if err != nil {
+		return err
+	}
+	m.databases = append(m.databases, []any{id, schema.Title, schema.URL, sqliteText(parentID), sqliteJSON(schema.Properties)})
+	for i := range rows {
+		if err := m.addPage(ctx, &rows[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqliteValue はプロパティの値を SQL で比べられる1つの値にします。数値は REAL、チェックボックスは 0/1、
+// 日付は開始日の ISO 8601 の文字列、それ以外は表示用のテキスト（リレーションは関連先のタイトル）
+func (d *pageDirectory) sqliteValue(prop notionapi.Property, opts relationOptions) any {
+	switch p := prop.(type) {
+	case *notionapi.NumberProperty:
+		return p.Number
+	case *notionapi.CheckboxProperty:
+		return p.Checkbox
+	case *notionapi.DateProperty:
+		if p.Date == nil || p.Date.Start == nil {
+			return nil
+		}
+		return isoDate(*p.Date.Start)
+	case *notionapi.FormulaProperty:
+		switch p.Formula.Type {
+		case notionapi.FormulaTypeNumber:
+			return p.Formula.Number
+		case notionapi.FormulaTypeBoolean:
+			return p.Formula.Boolean
+		}
+	case *notionapi.RollupProperty:
+		if p.Rollup.Type == "number" {
+			return p.Rollup.Number
+		}
+	}
+	return sqliteText(d.propertyText(prop, opts))
+}
+
+// sqliteParent はページの親の種類とIDを返します
+func sqliteParent(parent notionapi.Parent) (string, any) {
+	switch parent.Type {
+	case notionapi.ParentTypePageID:
+		return string(parent.Type), formatPageID(string(parent.PageID))
+	case notionapi.ParentTypeDatabaseID:
+		return string(parent.Type), formatPageID(string(parent.DatabaseID))
+	case notionapi.ParentTypeBlockID:
+		return string(parent.Type), formatPageID(string(parent.BlockID))
+	}
+	return string(parent.Type), nil
+}
+
+// sqliteText は空の文字列を NULL にします
+func sqliteText(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// sqliteJSON は値を JSON の文字列にします。SQL から json_extract で読むため、HTML の文字はエスケープしない
+func sqliteJSON(v any) string {
+	var sb strings.Builder
+	enc := json.NewEncoder(&sb)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "null"
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// 読了時間の目安に使う1分あたりの語数（英語など）と文字数（日本語・中国語・韓国語）
+const (
+	statsWordsPerMinute = 230
+	statsCJKPerMinute   = 500
+)
+
+// textStats はテキストの量
+type textStats struct {
+	// Words は空白で区切られた語の数。日本語などの文字は1文字を1語として数える
+	Words int `json:"words"`
+	// Characters は空白を除いた文字数
+	Characters int `json:"characters"`
+	// cjk は Characters のうち日本語・中国語・韓国語の文字の数
+	cjk int
+}
+
+// add はテキストを数えます
+func (s *textStats) add(text string) {
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			inWord = false
+			continue
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			s.Words++
+			s.cjk++
+			inWord = false
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			// 記号は語を始めないが、語の途中の記号（snake_case・3.14 など）では区切らない
+		case !inWord:
+			s.Words++
+			inWord = true
+		}
+		s.Characters++
+	}
+}
+
+func (s *textStats) merge(o textStats) {
+	s.Words += o.Words
+	s.Characters += o.Characters
+	s.cjk += o.cjk
+}
+
+// readingMinutes は読了時間の目安（分、切り上げ）
+func (s textStats) readingMinutes() int {
+	minutes := float64(s.Words-s.cjk)/statsWordsPerMinute + float64(s.cjk)/statsCJKPerMinute
+	return int(math.Ceil(minutes))
+}
+
+// estimatedTokens はLLMのトークン数の目安です。英語などは約4文字で1トークン、日本語などは1文字で約1トークンとして数える
+// （モデルのトークナイザーによって実際の数は異なる）
+func (s textStats) estimatedTokens() int {
+	return s.cjk + int(math.Ceil(float64(s.Characters-s.cjk)/4))
+}
+
+// pageStats は stats の結果
+type pageStats struct {
+	Page  notionapi.BlockID `json:"page"`
+	Title string            `json:"title"`
+	textStats
+	ReadingMinutes int            `json:"reading_minutes"`
+	Tokens         int            `json:"estimated_tokens,omitempty"`
+	Blocks         int            `json:"blocks"`
+	BlockTypes     map[string]int `json:"block_types"`
+	Images         int            `json:"images"`
+	Outline        []statsHeading `json:"outline"`
+	Sections       []statsSection `json:"sections"`
+}
+
+// statsHeading は見出しの一覧の1項目
+type statsHeading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+// statsSection is a part of the page between top-level headings or
+// dividers, the places where a page would naturally be cut into chunks.
+type statsSection struct {
+	// Title は先頭の見出しのテキスト。区切り線で始まるセクションやページの先頭では空
+	Title string `json:"title"`
+	// Divider は区切り線で始まるセクションか
+	Divider bool `json:"divider"`
+	Blocks  int  `json:"blocks"`
+	textStats
+	ReadingMinutes int `json:"reading_minutes"`
+	Tokens         int `json:"estimated_tokens,omitempty"`
+}
+
+// runStats reports how much content a page has: words, characters, blocks
+// by type, images, the heading outline, the reading time and, with
+// --tokens, an estimate of the LLM tokens, overall and for each section
+// between top-level headings and dividers. It helps to decide how to chunk
+// or summarize a page before doing so.
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	tokens := fs.Bool("tokens", false, "also estimate the number of LLM tokens (about 4 characters per token, 1 per CJK character)")
+	asJSON := fs.Bool("json", false, "print the statistics as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs stats [--tokens] [--json] <page-id>")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, parseInterspersed(fs, args))
+	if fs.NArg() != 1 {
+		fs.Usage()
+		exit(1)
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	pageID := notionapi.BlockID(formatPageID(fs.Arg(0)))
+	page, err := client.Page.Get(ctx, notionapi.PageID(pageID))
+	if err != nil {
+		exitWithNotionError("Error fetching page", err)
+	}
+	tree, err := fetchPageTree(ctx, client, pageID, fetchLimits{})
+	if err != nil {
+		exitWithNotionError("Error fetching blocks", err)
+	}
+
+	stats := collectPageStats(tree, *tokens)
+	stats.Page = pageID
+	stats.Title = propertyTitle(page)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(stats); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	writePageStats(stats, *tokens)
+}
+
+// collectPageStats はページのツリーを数えます
+func collectPageStats(tree *PageTree, tokens bool) pageStats {
+	stats := pageStats{BlockTypes: make(map[string]int), Outline: []statsHeading{}, Sections: []statsSection{}}
+	var walk func(nodes []*BlockNode, section *statsSection)
+	walk = func(nodes []*BlockNode, section *statsSection) {
+		for _, node := range nodes {
+			stats.Blocks++
+			section.Blocks++
+			stats.BlockTypes[string(node.Block.GetType())]++
+			if _, ok := node.Block.(*notionapi.ImageBlock); ok {
+				stats.Images++
+			}
+			if level := headingLevel(node.Block); level > 0 {
+				stats.Outline = append(stats.Outline, statsHeading{Level: level, Text: blockText(node.Block)})
+			}
+			var text textStats
+			for _, rt := range blockRichTexts(node.Block) {
+				text.add(renderer.PlainText(rt))
+			}
+			if code, ok := node.Block.(*notionapi.CodeBlock); ok {
+				text.add(renderer.PlainText(code.Code.RichText))
+			}
+			stats.merge(text)
+			section.merge(text)
+			walk(node.Children, section)
+		}
+	}
+
+	for _, node := range tree.Root.Children {
+		_, divider := node.Block.(*notionapi.DividerBlock)
+		heading := headingLevel(node.Block) > 0
+		if len(stats.Sections) == 0 || heading || divider {
+			section := statsSection{Divider: divider}
+			if heading {
+				section.Title = blockText(node.Block)
+			}
+			stats.Sections = append(stats.Sections, section)
+		}
+		walk([]*BlockNode{node}, &stats.Sections[len(stats.Sections)-1])
+	}
+
+	stats.ReadingMinutes = stats.readingMinutes()
+	for i := range stats.Sections {
+		stats.Sections[i].ReadingMinutes = stats.Sections[i].readingMinutes()
+	}
+	if tokens {
+		stats.Tokens = stats.estimatedTokens()
+		for i := range stats.Sections {
+			stats.Sections[i].Tokens = stats.Sections[i].estimatedTokens()
+		}
+	}
+	return stats
+}
+
+func writePageStats(stats pageStats, tokens bool) {
+	fmt.Printf("page:         %s (%s)\n", stats.Title, stats.Page)
+	fmt.Printf("words:        %d\n", stats.Words)
+	fmt.Printf("characters:   %d\n", stats.Characters)
+	fmt.Printf("reading time: %d min\n", stats.ReadingMinutes)
+	if tokens {
+		fmt.Printf("tokens:       ~%d (estimate)\n", stats.Tokens)
+	}
+	fmt.Printf("images:       %d\n", stats.Images)
+	fmt.Printf("blocks:       %d\n", stats.Blocks)
+
+	types := make([]string, 0, len(stats.BlockTypes))
+	for typ := range stats.BlockTypes {
+		types = append(types, typ)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if stats.BlockTypes[types[i]] != stats.BlockTypes[types[j]] {
+			return stats.BlockTypes[types[i]] > stats.BlockTypes[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	for _, typ := range types {
+		fmt.Printf("  %-20s %5d\n", typ, stats.BlockTypes[typ])
+	}
+
+	if len(stats.Outline) > 0 {
+		fmt.Println("\noutline:")
+		for _, h := range stats.Outline {
+			fmt.Printf("  %s%s %s\n", strings.Repeat("  ", h.Level-1), strings.Repeat("#", h.Level), h.Text)
+		}
+	}
+
+	fmt.Println("\nsections (split at top-level headings and dividers):")
+	for i, s := range stats.Sections {
+		title := s.Title
+		switch {
+		case title != "":
+		case s.Divider:
+			title = "(after divider)"
+		default:
+			title = "(start of page)"
+		}
+		// 日本語の見出しでも列がそろうよう、表示幅で埋める
+		title += strings.Repeat(" ", max(0, 30-displayWidth(title)))
+		line := fmt.Sprintf("  %3d  %s %6d words  %4d blocks  %3d min", i+1, title, s.Words, s.Blocks, s.ReadingMinutes)
+		if tokens {
+			line += fmt.Sprintf("  ~%d tokens", s.Tokens)
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/jomei/notionapi"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+
+	"notion-dfs/renderer"
+)
+
+// summaryPrompt は要約のシステムプロンプト
+const summaryPrompt = "あなたは与えられたテキストを要約する専門家です。重要なポイントを箇条書きで3-5個程度にまとめてください。"
+
+// structuredSummaryPrompt は --summary-format json の要約のシステムプロンプト
+const structuredSummaryPrompt = `あなたは与えられたテキストを要約する専門家です。次の項目をJSONで返してください。
+- title: 内容を表す短いタイトル
+- bullets: 重要なポイントの箇条書き（3-5個程度）
+- entities: 登場する人・組織・場所・製品・イベント・日付などの固有の名前と種類
+- sentiment: 全体の論調（positive・neutral・negative・mixed）
+各項目はテキストと同じ言語で書いてください。`
+
+// structuredSummaryModel は --summary-format json の要約のモデル（Structured Outputs に対応したモデル）
+const structuredSummaryModel = shared.ChatModelGPT4o
+
+// structuredSummary is the summary of --summary-format json: the same bullets
+// as the text summary plus a title, the named entities and the overall
+// sentiment, generated against structuredSummarySchema so that downstream
+// tools can rely on the shape.
+type structuredSummary struct {
+	Title     string          `json:"title"`
+	Bullets   []string        `json:"bullets"`
+	Entities  []summaryEntity `json:"entities"`
+	Sentiment string          `json:"sentiment"`
+}
+
+type summaryEntity struct {
+	Name string `json:"name"`
+	// Type は person・organization・place・product・event・date・other のいずれか
+	Type string `json:"type"`
+}
+
+// structuredSummarySchema は structuredSummary のJSON Schema（Structured Outputs の strict モードの形式）
+var structuredSummarySchema = map[string]any{
+	"type":                 "object",
+	"additionalProperties": false,
+	"required":             []string{"title", "bullets", "entities", "sentiment"},
+	"properties": map[string]any{
+		"title":   map[string]any{"type": "string"},
+		"bullets": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		"entities": map[string]any{"type": "array", "items": map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"required":             []string{"name", "type"},
+			"properties": map[string]any{
+				"name": map[string]any{"type": "string"},
+				"type": map[string]any{"type": "string", "enum": []string{"person", "organization", "place", "product", "event", "date", "other"}},
+			},
+		}},
+		"sentiment": map[string]any{"type": "string", "enum": []string{"positive", "neutral", "negative", "mixed"}},
+	},
+}
+
+var (
+	summaryCacheOnce sync.Once
+	summaryCache     *resultCache
+)
+
+// summaryCacheKey は要約のキャッシュのキー。モデル・プロンプト・内容のどれかが変われば別の要約になる
+func summaryCacheKey(model, prompt, content string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + prompt + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+func summarizeContent(content string) (string, error) {
+	return generateSummary(content, summaryPrompt, openai.ChatCompletionNewParams{Model: shared.ChatModelGPT4})
+}
+
+// summarizeStructured は内容を structuredSummary の形で要約します（--summary-format json）
+func summarizeStructured(content string) (*structuredSummary, error) {
+	params := openai.ChatCompletionNewParams{
+		Model: structuredSummaryModel,
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+			JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   "page_summary",
+				Strict: openai.Bool(true),
+				Schema: structuredSummarySchema,
+			},
+		}},
+	}
+	data, err := generateSummary(content, structuredSummaryPrompt, params)
+	if err != nil {
+		return nil, err
+	}
+	summary := &structuredSummary{}
+	if err := json.Unmarshal([]byte(data), summary); err != nil {
+		return nil, fmt.Errorf("summarization failed: invalid JSON in the response: %v", err)
+	}
+	// 該当なしを null ではなく空の配列にする
+	if summary.Bullets == nil {
+		summary.Bullets = []string{}
+	}
+	if summary.Entities == nil {
+		summary.Entities = []summaryEntity{}
+	}
+	return summary, nil
+}
+
+// text は箇条書きの要約を、テキストの要約と同じ形（"- " で始まる行）で返します
+func (s *structuredSummary) text() string {
+	var sb strings.Builder
+	for _, b := range s.Bullets {
+		fmt.Fprintf(&sb, "- %s\n", b)
+	}
+	return sb.String()
+}
+
+// generateSummary は prompt と params のモデルで内容をAIで要約し、応答を返します。要約はキャッシュディレクトリの
+// summaries ディレクトリにモデル・プロンプト・内容のハッシュごとに保存し、変更のないページの要約はAPIを呼ばずに返す
+func generateSummary(content, prompt string, params openai.ChatCompletionNewParams) (string, error) {
+	summaryCacheOnce.Do(func() {
+		var err error
+		if summaryCache, err = openResultCache("summaries"); err != nil {
+			log.Printf("warning: summary cache disabled: %v", err)
+		}
+	})
+	key := summaryCacheKey(params.Model, prompt, content)
+	if summaryCache != nil {
+		if cached, ok := summaryCache.get(key); ok {
+			metrics.cacheLookup("summaries", true)
+			return cached, nil
+		}
+		metrics.cacheLookup("summaries", false)
+	}
+
+	apiKey, _ := openAIKeyCredential.get()
+	if apiKey == "" {
+		return "", fmt.Errorf("OPENAI_API_KEY is not set")
+	}
+
+	client := newOpenAIClient(apiKey)
+	params.Messages = []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(prompt),
+		openai.UserMessage(content),
+	}
+	resp, err := createChatCompletion(context.Background(), &client, params, prompt+content, 0)
+	if err != nil {
+		return "", fmt.Errorf("summarization failed: %v", err)
+	}
+
+	summary := resp.Choices[0].Message.Content
+	if summaryCache != nil {
+		if err := summaryCache.put(key, summary); err != nil {
+			log.Printf("warning: failed to save summary cache: %v", err)
+		}
+	}
+	return summary, nil
+}
+
+// sectionSummariesIntro は --summarize-per-section で、全体の要約に渡すセクションの要約の前置き
+const sectionSummariesIntro = "以下は長いページを見出し（H1・H2）のセクションごとに要約したものです。ページ全体の要約を作ってください。\n\n"
+
+// sectionSummaryConcurrency は同時に要約するセクションの数
+const sectionSummaryConcurrency = 4
+
+// summaryInput はページのブロックから要約に渡すテキストを作ります。perSection なら、トップレベルの見出し1・2で
+// 区切ったセクションをそれぞれ要約し、セクションの要約を並べたものにする（--summarize-per-section）。
+// 長く複数の話題があるページでも、1つのプロンプトで全体を要約するより話題が漏れにくい。
+// セクションの要約も内容ごとにキャッシュされるため、再実行では変更したセクションだけを要約し直す
+func summaryInput(nodes []*BlockNode, perSection bool) (string, error) {
+	sections := splitSummarySections(nodes)
+	if !perSection || len(sections) <= 1 {
+		var content strings.Builder
+		collectContent(nodes, &content)
+		return content.String(), nil
+	}
+
+	summaries := make([]string, len(sections))
+	errs := make([]error, len(sections))
+	sem := make(chan struct{}, sectionSummaryConcurrency)
+	var wg sync.WaitGroup
+	for i, section := range sections {
+		var content strings.Builder
+		collectContent(section.nodes, &content)
+		if strings.TrimSpace(content.String()) == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, content string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			summaries[i], errs[i] = summarizeContent(content)
+		}(i, content.String())
+	}
+	wg.Wait()
+
+	var sb strings.Builder
+	sb.WriteString(sectionSummariesIntro)
+	for i, section := range sections {
+		if errs[i] != nil {
+			return "", fmt.Errorf("section %q: %w", section.heading, errs[i])
+		}
+		if summaries[i] == "" {
+			continue
+		}
+		heading := section.heading
+		if heading == "" {
+			heading = "（最初の見出しの前）"
+		}
+		fmt.Fprintf(&sb, "## %s\n%s\n\n", heading, strings.TrimSpace(summaries[i]))
+	}
+	return sb.String(), nil
+}
+
+// summarySection はトップレベルの見出し1・2から次の見出し1・2の前までのブロック（最初の見出しの前は heading が空）
+type summarySection struct {
+	heading string
+	nodes   []*BlockNode
+}
+
+func splitSummarySections(nodes []*BlockNode) []summarySection {
+	var sections []summarySection
+	for _, node := range nodes {
+		switch node.Block.(type) {
+		case *notionapi.Heading1Block, *notionapi.Heading2Block:
+			sections = append(sections, summarySection{heading: strings.TrimSpace(blockText(node.Block))})
+		default:
+			if len(sections) == 0 {
+				sections = append(sections, summarySection{})
+			}
+		}
+		last := &sections[len(sections)-1]
+		last.nodes = append(last.nodes, node)
+	}
+	return sections
+}
+
+// collectContent collects text content from blocks for summarization
+func collectContent(nodes []*BlockNode, contentBuilder *strings.Builder) {
+	for _, node := range nodes {
+		contentBuilder.WriteString(blockText(node.Block))
+		contentBuilder.WriteString("\n\n")
+		collectContent(node.Children, contentBuilder)
+	}
+}
+
+// blockText returns the plain text of a block that is used as summary input
+func blockText(block notionapi.Block) string {
+	switch b := block.(type) {
+	case *notionapi.ParagraphBlock:
+		return renderer.PlainText(b.Paragraph.RichText)
+	case *notionapi.Heading1Block:
+		return renderer.PlainText(b.Heading1.RichText)
+	case *notionapi.Heading2Block:
+		return renderer.PlainText(b.Heading2.RichText)
+	case *notionapi.Heading3Block:
+		return renderer.PlainText(b.Heading3.RichText)
+	case *notionapi.BulletedListItemBlock:
+		return renderer.PlainText(b.BulletedListItem.RichText)
+	case *notionapi.NumberedListItemBlock:
+		return renderer.PlainText(b.NumberedListItem.RichText)
+	case *notionapi.ToDoBlock:
+		return renderer.PlainText(b.ToDo.RichText)
+	case *notionapi.QuoteBlock:
+		return renderer.PlainText(b.Quote.RichText)
+	case *notionapi.CalloutBlock:
+		return renderer.PlainText(b.Callout.RichText)
+	case *notionapi.ToggleBlock:
+		return renderer.PlainText(b.Toggle.RichText)
+	case *notionapi.ImageBlock:
+		// 画像はキャプション（--describe-images の説明を含む）を要約の対象にする
+		return renderer.PlainText(b.Image.Caption)
+	}
+	return ""
+}
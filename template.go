@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// templatePage is the data passed to a --template: the page metadata, the
+// rendered Markdown body and the block tree for templates that lay out
+// individual blocks themselves.
+type templatePage struct {
+	ID             string
+	Title          string
+	URL            string
+	CreatedTime    time.Time
+	LastEditedTime time.Time
+	// Properties はプロパティの値をプレーンテキストにしたもの（名前がキー）。リレーションは関連先のタイトル
+	Properties map[string]string
+	// Relations はリレーションのプロパティの関連先のページ（名前がキー）
+	Relations map[string][]*relatedPage
+	// Body はページ全体をMarkdownにしたもの（--include-comments ならコメントを含む）
+	Body string
+	// Summary はAIの要約。--no-summary の場合や生成に失敗した場合は空
+	Summary string
+	// SummaryData は --summary-format json の要約（タイトル・箇条書き・固有名・論調）。それ以外では nil
+	SummaryData *structuredSummary
+	// Blocks はトップレベルのブロック
+	Blocks []*templateBlock
+}
+
+// templateBlock はテンプレートから参照するブロック
+type templateBlock struct {
+	ID       string
+	Type     string
+	Text     string
+	Children []*templateBlock
+
+	node *BlockNode
+	md   *renderer.Markdown
+}
+
+// Markdown はブロックを子ブロックも含めてMarkdownにします
+func (b *templateBlock) Markdown() string {
+	var sb strings.Builder
+	b.md.PrintBlock(&sb, b.node.Block, 0)
+	b.md.PrintBlocks(&sb, b.node.Children, 1)
+	b.md.Finish(&sb)
+	return sb.String()
+}
+
+// BlocksOfType はページ内のすべての階層から、いずれかの種類（"heading_2" など）のブロックを文書の順に返します
+func (p *templatePage) BlocksOfType(types ...string) []*templateBlock {
+	var found []*templateBlock
+	var walk func(blocks []*templateBlock)
+	walk = func(blocks []*templateBlock) {
+		for _, b := range blocks {
+			for _, typ := range types {
+				if b.Type == typ {
+					found = append(found, b)
+					break
+				}
+			}
+			walk(b.Children)
+		}
+	}
+	walk(p.Blocks)
+	return found
+}
+
+// Headings は見出しのブロックを文書の順に返します
+func (p *templatePage) Headings() []*templateBlock {
+	return p.BlocksOfType("heading_1", "heading_2", "heading_3")
+}
+
+// templateFuncs はテンプレートで使える関数
+var templateFuncs = template.FuncMap{
+	// date は時刻を Go の書式（"2006-01-02" など）で整形する
+	"date": func(layout string, t time.Time) string { return t.Format(layout) },
+	// indent は空行以外の各行の先頭に n 個の空白を付ける
+	"indent": func(n int, s string) string {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			if line != "" {
+				lines[i] = strings.Repeat(" ", n) + line
+			}
+		}
+		return strings.Join(lines, "\n")
+	},
+	"join":    func(sep string, items []string) string { return strings.Join(items, sep) },
+	"split":   func(sep, s string) []string { return strings.Split(s, sep) },
+	"trim":    strings.TrimSpace,
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+}
+
+// parsePageTemplate は --template のファイルを読み込みます。実行前に構文の誤りを見つけるため、フラグの解析時に呼ぶ
+func parsePageTemplate(file string) (*template.Template, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(file)).Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// writePageTemplate はページを取得し、テンプレートに渡して出力します
+func writePageTemplate(ctx context.Context, w io.Writer, client *notionapi.Client, pageID notionapi.BlockID, opts exportOptions) error {
+	page, err := client.Page.Get(ctx, notionapi.PageID(pageID))
+	if err != nil {
+		return err
+	}
+	tree, err := fetchExportTree(ctx, client, pageID, opts)
+	if err != nil {
+		return err
+	}
+
+	data := &templatePage{
+		ID:             string(pageID),
+		Title:          propertyTitle(page),
+		URL:            page.URL,
+		CreatedTime:    dateDisplay.in(page.CreatedTime),
+		LastEditedTime: dateDisplay.in(page.LastEditedTime),
+		Properties:     pageProperties(ctx, client, page, opts.relations),
+		Relations:      workspacePages(client).related(page, opts.relations),
+	}
+
+	r := opts.markdownRenderer()
+	var notes *commentNotes
+	if opts.includeComments {
+		comments, err := fetchComments(ctx, client, pageID, tree)
+		if err != nil {
+			return err
+		}
+		notes = &commentNotes{comments: comments, appendix: opts.commentsStyle == "appendix"}
+		r.Comments = notes
+	}
+	var body strings.Builder
+	r.PrintBlocks(&body, tree.Root.Children, 0)
+	if notes != nil {
+		notes.write(&body)
+	}
+	data.Body = body.String()
+	// ブロックごとの出力にはコメントの脚注を付けない
+	blockRenderer := opts.markdownRenderer()
+	data.Blocks = templateBlocks(tree.Root.Children, blockRenderer)
+
+	if !opts.noSummary {
+		content, err := summaryInput(tree.Root.Children, opts.summarizePerSection)
+		switch {
+		case err != nil:
+			log.Printf("Error generating summary: %v", err)
+		case opts.summaryFormat == "json":
+			if data.SummaryData, err = summarizeStructured(content); err != nil {
+				log.Printf("Error generating summary: %v", err)
+			} else {
+				data.Summary = data.SummaryData.text()
+			}
+		default:
+			if data.Summary, err = summarizeContent(content); err != nil {
+				log.Printf("Error generating summary: %v", err)
+			}
+		}
+	}
+	return opts.template.Execute(w, data)
+}
+
+func templateBlocks(nodes []*BlockNode, md *renderer.Markdown) []*templateBlock {
+	blocks := make([]*templateBlock, 0, len(nodes))
+	for _, node := range nodes {
+		blocks = append(blocks, &templateBlock{
+			ID:       string(node.Block.GetID()),
+			Type:     string(node.Block.GetType()),
+			Text:     blockText(node.Block),
+			Children: templateBlocks(node.Children, md),
+			node:     node,
+			md:       md,
+		})
+	}
+	return blocks
+}
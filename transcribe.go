@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jomei/notionapi"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+
+	"notion-dfs/renderer"
+)
+
+// defaultTranscriptionModel は --transcription-model を指定しない場合の文字起こしのモデル
+const defaultTranscriptionModel = "whisper-1"
+
+// maxTranscriptionSize は文字起こしのAPIに送れる音声ファイルの大きさの上限（25MB）
+const maxTranscriptionSize = 25 << 20
+
+// transcriptIcon は文字起こしを入れるコールアウトの絵文字
+const transcriptIcon = "🎙️"
+
+// audioTranscriber replaces the audio blocks of a page with a callout that
+// links to the audio and contains its transcript (--transcribe), so that the
+// transcript is part of every output format and of the summary input. It
+// uses the OpenAI audio API, or any server with the same API such as a local
+// whisper server. Transcripts are cached by the hash of the audio.
+type audioTranscriber struct {
+	client   *openai.Client
+	model    string
+	language string
+	cache    *resultCache
+	// local は --whisper-url のサーバーを使うことを表す。料金はかからないため --max-cost では数えない
+	local bool
+}
+
+// newAudioTranscriber は文字起こしのクライアントを作ります。baseURL を指定すると、OpenAI の代わりに
+// 同じAPIのサーバー（ローカルの whisper サーバーなど）を使い、APIキーは不要になる
+func newAudioTranscriber(model, language, baseURL string) (*audioTranscriber, error) {
+	var opts []option.RequestOption
+	apiKey, _ := openAIKeyCredential.get()
+	if baseURL != "" {
+		opts = append(opts, option.WithBaseURL(strings.TrimSuffix(baseURL, "/")+"/"))
+		if apiKey == "" {
+			apiKey = "local"
+		}
+	} else if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is not set (--transcribe uses the OpenAI audio API; set --whisper-url for a local server)")
+	}
+	cache, err := openResultCache("transcripts")
+	if err != nil {
+		return nil, err
+	}
+	client := newOpenAIClient(apiKey, opts...)
+	return &audioTranscriber{client: &client, model: model, language: language, cache: cache, local: baseURL != ""}, nil
+}
+
+// resolveAudioBlocks は音声ブロックを AudioBlock にします。notionapi は音声ブロックを読み込めず、
+// 中身のない UnsupportedBlock にするため、そのようなブロックを含む親の子ブロックをJSONのまま取得し直して
+// 同じ位置のブロックを読み込む
+func resolveAudioBlocks(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, tree *PageTree) error {
+	var walk func(parent *BlockNode, parentID notionapi.BlockID) error
+	walk = func(parent *BlockNode, parentID notionapi.BlockID) error {
+		var raw []json.RawMessage
+		for i, node := range parent.Children {
+			if _, ok := node.Block.(*notionapi.UnsupportedBlock); ok {
+				if raw == nil {
+					var err error
+					if raw, err = fetchRawChildren(ctx, client, parentID); err != nil {
+						return err
+					}
+				}
+				if i < len(raw) {
+					var b notionapi.AudioBlock
+					if json.Unmarshal(raw[i], &b) == nil && b.Type == "audio" {
+						node.Block = &b
+					}
+				}
+			}
+			if err := walk(node, node.Block.GetID()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(tree.Root, pageID)
+}
+
+// fetchRawChildren はブロックの子ブロックを、notionapi で読み込まずにJSONのまま返します
+func fetchRawChildren(ctx context.Context, client *notionapi.Client, blockID notionapi.BlockID) ([]json.RawMessage, error) {
+	version := notionAPIVersion
+	if version == "" {
+		version = "2022-06-28"
+	}
+	var results []json.RawMessage
+	cursor := ""
+	for {
+		u := "https://" + notionAPIHost + "/v1/blocks/" + url.PathEscape(string(blockID)) + "/children?page_size=100"
+		if cursor != "" {
+			u += "&start_cursor=" + url.QueryEscape(cursor)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+client.Token.String())
+		req.Header.Set("Notion-Version", version)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get blocks: %w", err)
+		}
+		var list struct {
+			Results    []json.RawMessage `json:"results"`
+			HasMore    bool              `json:"has_more"`
+			NextCursor string            `json:"next_cursor"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to get blocks: unexpected status %s", resp.Status)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get blocks: %w", err)
+		}
+		results = append(results, list.Results...)
+		if !list.HasMore || list.NextCursor == "" {
+			return results, nil
+		}
+		cursor = list.NextCursor
+	}
+}
+
+// transcribeTree は音声ブロックを文字起こしのコールアウトに置き換えます。
+// 文字起こしできなかった音声はログに出してそのままにする
+func (t *audioTranscriber) transcribeTree(ctx context.Context, tree *PageTree) {
+	var walk func(nodes []*BlockNode)
+	walk = func(nodes []*BlockNode) {
+		for _, node := range nodes {
+			b, ok := node.Block.(*notionapi.AudioBlock)
+			if !ok {
+				walk(node.Children)
+				continue
+			}
+			audioURL := b.Audio.GetURL()
+			transcript, err := t.transcribe(ctx, audioURL)
+			if err != nil {
+				log.Printf("Error transcribing audio %s: %v", b.ID, err)
+				continue
+			}
+			name := strings.TrimSpace(renderer.PlainText(b.Audio.Caption))
+			if name == "" {
+				name = urlFileName(audioURL, "audio")
+			}
+			emoji := notionapi.Emoji(transcriptIcon)
+			callout := &notionapi.CalloutBlock{
+				BasicBlock: basicBlock(notionapi.BlockCallout),
+				Callout: notionapi.Callout{
+					RichText: append(displayRichText("音声の文字起こし: ", ""), displayRichText(name, audioURL)...),
+					Icon:     &notionapi.Icon{Type: "emoji", Emoji: &emoji},
+					Color:    "gray_background",
+				},
+			}
+			// コメントの位置などでブロックを探せるよう、元の音声ブロックのIDを引き継ぐ
+			callout.ID = b.ID
+			callout.HasChildren = true
+			node.Block = callout
+			for _, line := range strings.Split(transcript, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					paragraph := &notionapi.ParagraphBlock{
+						BasicBlock: basicBlock(notionapi.BlockTypeParagraph),
+						Paragraph:  notionapi.Paragraph{RichText: displayRichText(line, "")},
+					}
+					node.Children = append(node.Children, &BlockNode{Block: paragraph, Parent: node})
+				}
+			}
+		}
+	}
+	walk(tree.Root.Children)
+}
+
+// transcribe は音声をダウンロードして文字起こしのAPIに送り、テキストを返します
+func (t *audioTranscriber) transcribe(ctx context.Context, rawURL string) (string, error) {
+	if rawURL == "" {
+		return "", fmt.Errorf("the audio has no URL")
+	}
+	data, contentType, err := fetchURL(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxTranscriptionSize {
+		return "", fmt.Errorf("the audio is %d MB (the transcription API accepts up to 25 MB)", len(data)>>20)
+	}
+	sum := sha256.Sum256(data)
+	key := t.model + ":" + t.language + ":" + hex.EncodeToString(sum[:])
+	if cached, ok := t.cache.get(key); ok {
+		return cached, nil
+	}
+
+	params := openai.AudioTranscriptionNewParams{
+		// APIはファイル名の拡張子で音声の形式を判断する
+		File:  openai.File(bytes.NewReader(data), urlFileName(rawURL, "audio"), contentType),
+		Model: openai.AudioModel(t.model),
+	}
+	if t.language != "" {
+		params.Language = openai.String(t.language)
+	}
+	// 文字起こしはトークンではなく音声の長さで課金される
+	duration, _ := audioDuration(data)
+	var reserved float64
+	if !t.local {
+		if reserved, err = llmUsage.reserveAudio(t.model, duration.Seconds()); err != nil {
+			return "", err
+		}
+	}
+	resp, err := t.client.Audio.Transcriptions.New(ctx, params)
+	if err != nil {
+		llmUsage.release(reserved)
+		return "", fmt.Errorf("transcription failed: %v", err)
+	}
+	if !t.local {
+		llmUsage.recordAudio(t.model, duration.Seconds(), reserved)
+	}
+	transcript := strings.TrimSpace(resp.Text)
+	if err := t.cache.put(key, transcript); err != nil {
+		return "", err
+	}
+	return transcript, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jomei/notionapi"
+
+	"notion-dfs/renderer"
+)
+
+// PageTree is the block hierarchy of a single page, fetched once per run.
+// Each run owns its own tree, so several pages can be fetched concurrently.
+type PageTree struct {
+	// Root はページ自体を表すノード。Block は nil で、Children がトップレベルのブロック
+	Root *BlockNode
+	// Missing は再試行しても子ブロックを取得しきれなかったブロック（ページ自体を含む）のID。
+	// これらのブロックの子は途中まで、または1つもツリーにない
+	Missing []notionapi.BlockID
+	nodes   map[notionapi.BlockID]*BlockNode
+}
+
+// BlockNode is a block together with its parent and child links.
+type BlockNode = renderer.Node
+
+// Node returns the node for the given block ID, or nil if it is not in the tree.
+func (t *PageTree) Node(id notionapi.BlockID) *BlockNode {
+	return t.nodes[id]
+}
+
+// ChildPages returns the sub-pages embedded anywhere in the tree, in document order.
+func (t *PageTree) ChildPages() []*notionapi.ChildPageBlock {
+	var pages []*notionapi.ChildPageBlock
+	var walk func(nodes []*BlockNode)
+	walk = func(nodes []*BlockNode) {
+		for _, node := range nodes {
+			if page, ok := node.Block.(*notionapi.ChildPageBlock); ok {
+				pages = append(pages, page)
+			}
+			walk(node.Children)
+		}
+	}
+	walk(t.Root.Children)
+	return pages
+}
+
+// fetchLimits はブロック取得時の上限。0 は無制限を表します
+type fetchLimits struct {
+	// MaxDepth は取得するネストの深さ（1 ならトップレベルのブロックのみ）
+	MaxDepth int
+	// MaxBlocks は1ページあたりに取得するブロック数
+	MaxBlocks int
+	// SkipChildPages は子ページの中身をたどらない（子ページを別のページとして扱う場合に使う）
+	SkipChildPages bool
+}
+
+// errBlockLimit は MaxBlocks に達したため取得を打ち切ったことを表します
+var errBlockLimit = errors.New("block limit reached")
+
+// blockFetchRetries は子ブロックの1ページ分の取得を再試行する回数。待ち時間は1秒から倍々にする
+const blockFetchRetries = 3
+
+// blockRetryDelay は最初の再試行までの待ち時間
+var blockRetryDelay = time.Second
+
+// fetchPageTree はページ配下のブロックを深さ優先で取得し、PageTree を構築します
+func fetchPageTree(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, limits fetchLimits) (*PageTree, error) {
+	tree := &PageTree{
+		Root:  &BlockNode{},
+		nodes: make(map[notionapi.BlockID]*BlockNode),
+	}
+
+	// 深さ優先の前順でブロックが届くため、各深さの直近のノードが次の親になる
+	parents := []*BlockNode{tree.Root}
+	missing, err := walkBlocks(ctx, client, pageID, limits, func(block notionapi.Block, depth int) error {
+		parents = parents[:depth+1]
+		parent := parents[depth]
+		node := &BlockNode{Block: block, Parent: parent}
+		parent.Children = append(parent.Children, node)
+		tree.nodes[block.GetID()] = node
+		parents = append(parents, node)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	tree.Missing = missing
+	return tree, nil
+}
+
+// streamBlocks はブロックを取得しながら深さ優先で visit を呼び出します。
+// ツリー全体をメモリに保持しないため、巨大なページでもメモリ使用量が一定に保たれます。
+// 上限に達した場合は警告を出し、それまでに取得したブロックだけで正常終了します。
+// 子ブロックを取得しきれなかったブロックも警告を出して飛ばします
+func streamBlocks(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, limits fetchLimits, visit func(block notionapi.Block, depth int) error) error {
+	_, err := walkBlocks(ctx, client, pageID, limits, visit)
+	return err
+}
+
+// walkBlocks は streamBlocks と同じく走査し、子ブロックを取得しきれなかったブロックのIDを返します
+func walkBlocks(ctx context.Context, client *notionapi.Client, pageID notionapi.BlockID, limits fetchLimits, visit func(block notionapi.Block, depth int) error) ([]notionapi.BlockID, error) {
+	w := &blockWalker{client: client, limits: limits, visit: visit, root: pageID}
+	err := w.walkPage(ctx, pageID, 0)
+	if w.depthLimited > 0 {
+		log.Printf("warning: --max-depth %d reached; deeper nested blocks were not fetched", limits.MaxDepth)
+	}
+	if errors.Is(err, errBlockLimit) {
+		log.Printf("warning: --max-blocks %d reached; remaining blocks were not fetched", limits.MaxBlocks)
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return w.missing, nil
+}
+
+// blockWalker は1回の走査における取得済みブロック数などの状態を保持します
+type blockWalker struct {
+	client *notionapi.Client
+	limits fetchLimits
+	visit  func(block notionapi.Block, depth int) error
+	root   notionapi.BlockID
+	count  int
+	// depthLimited は MaxDepth のために子を取得しなかったブロックの数
+	depthLimited int
+	// missing は子ブロックを取得しきれなかったブロック
+	missing []notionapi.BlockID
+}
+
+func (w *blockWalker) walk(ctx context.Context, blockID notionapi.BlockID, depth int) error {
+	fetched := 0
+	list := eachChildBlock
+	if key, ok := sharedListKey(ctx, blockID); ok {
+		list = func(ctx context.Context, client *notionapi.Client, blockID notionapi.BlockID, fn func(block notionapi.Block) error) error {
+			return eachSharedChildBlock(ctx, client, blockID, key, fn)
+		}
+	}
+	err := list(ctx, w.client, blockID, func(block notionapi.Block) error {
+		fetched++
+		if w.limits.MaxBlocks > 0 && w.count >= w.limits.MaxBlocks {
+			return errBlockLimit
+		}
+		w.count++
+
+		workspaceUsers(w.client).resolveMentions(ctx, w.client, block)
+		formatDateMentions(block)
+		if err := w.visit(block, depth); err != nil {
+			return err
+		}
+		if !block.GetHasChildren() {
+			return nil
+		}
+		_, isPage := block.(*notionapi.ChildPageBlock)
+		if isPage && w.limits.SkipChildPages {
+			return nil
+		}
+		if w.limits.MaxDepth > 0 && depth+1 >= w.limits.MaxDepth {
+			w.depthLimited++
+			return nil
+		}
+		if isPage {
+			return w.walkPage(ctx, block.GetID(), depth+1)
+		}
+		if synced, ok := block.(*notionapi.SyncedBlock); ok {
+			syncedCtx := ctx
+			if synced.SyncedBlock.SyncedFrom != nil {
+				// 同期元のページの編集ではこのページの last_edited_time は変わらない
+				syncedCtx = withCachedSubtree(ctx, false)
+			}
+			// テンプレートなどで同じ同期ブロックが何度も出てきても、中身は1回だけ取得する
+			return w.walk(withSyncedBlock(syncedCtx, synced), block.GetID(), depth+1)
+		}
+		return w.walk(ctx, block.GetID(), depth+1)
+	})
+	var fetchErr *blockFetchError
+	if !errors.As(err, &fetchErr) || fetchErr.block != blockID || ctx.Err() != nil {
+		return err
+	}
+	if blockID == w.root && fetched == 0 {
+		// ページ自体を取得できない（存在しない・権限がないなど）場合は出力するものがない
+		return err
+	}
+	// このブロックの残りの子を飛ばして、ページのほかの部分の取得を続ける
+	log.Printf("warning: %v; the output is missing the rest of the children of block %s", err, blockID)
+	w.missing = append(w.missing, blockID)
+	return nil
+}
+
+// blockFetchError は子ブロックの取得に（再試行しても）失敗したことを表します
+type blockFetchError struct {
+	block notionapi.BlockID
+	err   error
+}
+
+func (e *blockFetchError) Error() string {
+	return fmt.Sprintf("failed to get blocks: %v", e.err)
+}
+
+func (e *blockFetchError) Unwrap() error { return e.err }
+
+// retryableFetchError は一時的な失敗（レート制限・サーバーエラー・通信の失敗）かを返します。
+// 存在しない・権限がないなどのエラーは再試行しても変わらない
+func retryableFetchError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *notionapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Status == http.StatusTooManyRequests || apiErr.Status >= 500 || apiErr.Status == 0
+	}
+	return true
+}
+
+// eachChildBlock は直下の子ブロックをページネーションしながら1つずつ fn に渡します
+func eachChildBlock(ctx context.Context, client *notionapi.Client, blockID notionapi.BlockID, fn func(block notionapi.Block) error) error {
+	var cursor notionapi.Cursor
+
+	for {
+		// ページネーションを使用してブロックを取得。一時的な失敗はそのページだけを取得し直す
+		var resp *notionapi.GetChildrenResponse
+		var err error
+		delay := blockRetryDelay
+		for attempt := 0; ; attempt++ {
+			resp, err = client.Block.GetChildren(ctx, blockID, &notionapi.Pagination{
+				StartCursor: cursor,
+				PageSize:    100,
+			})
+			if err == nil || attempt == blockFetchRetries || !retryableFetchError(err) {
+				break
+			}
+			log.Printf("warning: failed to get the children of block %s (%v); retrying in %s", blockID, err, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			delay *= 2
+		}
+		if err != nil {
+			return &blockFetchError{block: blockID, err: err}
+		}
+
+		for _, block := range resp.Results {
+			if err := fn(block); err != nil {
+				return err
+			}
+		}
+
+		// 次のページがない場合は終了
+		if !resp.HasMore {
+			return nil
+		}
+
+		// 次のページのカーソルを設定
+		cursor = notionapi.Cursor(resp.NextCursor)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// uploadTarget is an object storage location such as s3://bucket/prefix or
+// gs://bucket/prefix.
+type uploadTarget struct {
+	scheme string
+	bucket string
+	prefix string
+}
+
+func parseUploadTarget(s string) (*uploadTarget, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload target %q: %w", s, err)
+	}
+	if u.Scheme != "s3" && u.Scheme != "gs" {
+		return nil, fmt.Errorf("invalid upload target %q: must start with s3:// or gs://", s)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid upload target %q: bucket is missing", s)
+	}
+	return &uploadTarget{scheme: u.Scheme, bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+}
+
+// upload pushes files to the target. Paths relative to baseDir are kept as
+// object keys below the prefix.
+func (t *uploadTarget) upload(ctx context.Context, baseDir string, files []string) error {
+	// gcloud の起動は遅く、ファイルごとに呼ぶと大きなエクスポートでは時間がかかるため、トークンは1回だけ取得する
+	var gcsToken string
+	if t.scheme == "gs" && len(files) > 0 {
+		var err error
+		if gcsToken, err = gcsAccessToken(ctx); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		rel, err := filepath.Rel(baseDir, file)
+		if err != nil {
+			return err
+		}
+		key := path.Join(t.prefix, filepath.ToSlash(rel))
+
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(file))
+		if strings.EqualFold(filepath.Ext(file), ".md") {
+			contentType = "text/markdown; charset=utf-8"
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		switch t.scheme {
+		case "s3":
+			err = putS3Object(ctx, t.bucket, key, body, contentType)
+		case "gs":
+			err = putGCSObject(ctx, gcsToken, t.bucket, key, body, contentType)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", rel, err)
+		}
+		fmt.Fprintf(os.Stderr, "uploaded %s://%s/%s\n", t.scheme, t.bucket, key)
+	}
+	return nil
+}
+
+// putS3Object uploads an object with a SigV4-signed PUT request. Credentials
+// and region come from the standard AWS environment variables, and
+// AWS_ENDPOINT_URL_S3 / AWS_ENDPOINT_URL select an S3-compatible endpoint.
+func putS3Object(ctx context.Context, bucket, key string, body []byte, contentType string) error {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	region := firstNonEmpty(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+
+	// 独自エンドポイント（MinIOなど）ではパス形式、AWSではバーチャルホスト形式を使う
+	var host, objectPath, scheme string
+	if endpoint := firstNonEmpty(os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL")); endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid S3 endpoint: %w", err)
+		}
+		scheme, host = u.Scheme, u.Host
+		objectPath = "/" + bucket + "/" + key
+	} else {
+		scheme = "https"
+		host = fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, region)
+		objectPath = "/" + key
+	}
+	canonicalURI := awsURIEncode(objectPath)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, scheme+"://"+host+canonicalURI, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	payloadHash := sha256Hex(body)
+
+	headers := map[string]string{
+		"content-type":         contentType,
+		"host":                 host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format("20060102T150405Z"),
+	}
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		headers["x-amz-security-token"] = token
+	}
+
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Authorization", sigV4Authorization(http.MethodPut, canonicalURI, headers, payloadHash, accessKey, secretKey, region, now))
+
+	return doUploadRequest(req)
+}
+
+// sigV4Authorization returns the Authorization header value for an S3 request
+// signed with all of the given (lower-case) headers.
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func sigV4Authorization(method, canonicalURI string, headers map[string]string, payloadHash, accessKey, secretKey, region string, now time.Time) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		method, canonicalURI, "", canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	date := now.Format("20060102")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", now.Format("20060102T150405Z"), scope, sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature)
+}
+
+// gcsAccessToken は Cloud Storage のアクセストークンを GOOGLE_OAUTH_ACCESS_TOKEN から、なければ gcloud で取得します
+func gcsAccessToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	out, err := exec.CommandContext(ctx, "gcloud", "auth", "print-access-token").Output()
+	if err != nil {
+		return "", fmt.Errorf("GOOGLE_OAUTH_ACCESS_TOKEN is not set and gcloud auth print-access-token failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// putGCSObject uploads an object with the Cloud Storage JSON API, using an
+// access token from gcsAccessToken.
+func putGCSObject(ctx context.Context, token, bucket, key string, body []byte, contentType string) error {
+	u := fmt.Sprintf("https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		url.PathEscape(bucket), url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+	return doUploadRequest(req)
+}
+
+func doUploadRequest(req *http.Request) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// awsURIEncode は SigV4 の正規URIの規則に従い、非予約文字と "/" 以外をエンコードします
+func awsURIEncode(p string) string {
+	var sb strings.Builder
+	for _, b := range []byte(p) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
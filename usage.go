@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// llmPrices は1Mトークンあたりの料金（USD、入力と出力）。バージョン付きのモデル名は最も長く一致する名前の料金にする
+var llmPrices = map[string][2]float64{
+	"gpt-4":                  {30, 60},
+	"gpt-4-turbo":            {10, 30},
+	"gpt-4o":                 {2.5, 10},
+	"gpt-4o-mini":            {0.15, 0.6},
+	"gpt-4.1":                {2, 8},
+	"gpt-4.1-mini":           {0.4, 1.6},
+	"gpt-4.1-nano":           {0.1, 0.4},
+	"gpt-3.5-turbo":          {0.5, 1.5},
+	"o1":                     {15, 60},
+	"o3-mini":                {1.1, 4.4},
+	"text-embedding-3-small": {0.02, 0},
+	"text-embedding-3-large": {0.13, 0},
+	"text-embedding-ada-002": {0.1, 0},
+}
+
+// audioPrices は音声の文字起こしのモデルの1分あたりの料金（USD）。文字起こしはトークンではなく音声の長さで課金される
+var audioPrices = map[string]float64{
+	"whisper-1":              0.006,
+	"gpt-4o-transcribe":      0.006,
+	"gpt-4o-mini-transcribe": 0.003,
+}
+
+// expectedCompletionTokens は --max-cost の判定で、応答のトークン数として見込む数
+const expectedCompletionTokens = 500
+
+// errLLMBudget は、上限を超えるか料金がわからないため --max-cost がリクエストを送らなかったことを表します
+var errLLMBudget = errors.New("OpenAI request refused by --max-cost")
+
+// llmUsageTracker counts the tokens of the OpenAI API calls of this process
+// by model, estimates their cost from llmPrices, and refuses to send a
+// request when the estimate including that request would exceed the budget
+// (--max-cost), so that a batch over hundreds of pages stops at the budget
+// instead of after it.
+type llmUsageTracker struct {
+	mu     sync.Mutex
+	models map[string]*llmModelUsage
+	// maxCost は推定料金の上限（USD）。0 なら上限なし
+	maxCost float64
+	// pending は送信中のリクエストの推定料金の合計。並行して送るリクエストがそれぞれ上限の判定を
+	// 通り抜けないよう、応答が届いて record（失敗なら release）するまで使ったものとして数える
+	pending float64
+}
+
+type llmModelUsage struct {
+	requests         int
+	promptTokens     int64
+	completionTokens int64
+	// audioSeconds は文字起こしした音声の長さの合計
+	audioSeconds float64
+}
+
+var llmUsage = &llmUsageTracker{models: make(map[string]*llmModelUsage)}
+
+// llmPrice はモデルの料金を返します。料金のわからないモデルは ok が false
+func llmPrice(model string) (price [2]float64, ok bool) {
+	best := modelPriceName(model, llmPrices)
+	if best == "" {
+		return price, false
+	}
+	return llmPrices[best], true
+}
+
+// audioPrice は文字起こしのモデルの1分あたりの料金を返します。料金のわからないモデルは ok が false
+func audioPrice(model string) (perMinute float64, ok bool) {
+	best := modelPriceName(model, audioPrices)
+	if best == "" {
+		return 0, false
+	}
+	return audioPrices[best], true
+}
+
+// modelPriceName は prices の中で model に最も長く一致する名前を返します（"gpt-4o-2024-08-06" なら "gpt-4o"）
+func modelPriceName[V any](model string, prices map[string]V) string {
+	best := ""
+	for name := range prices {
+		if (model == name || strings.HasPrefix(model, name+"-")) && len(name) > len(best) {
+			best = name
+		}
+	}
+	return best
+}
+
+func tokenCost(model string, prompt, completion int64) float64 {
+	price, _ := llmPrice(model)
+	return (float64(prompt)*price[0] + float64(completion)*price[1]) / 1e6
+}
+
+func audioCost(model string, seconds float64) float64 {
+	perMinute, _ := audioPrice(model)
+	return seconds / 60 * perMinute
+}
+
+// cost はモデルの利用量の推定料金です。料金のわからない分は含めず、ok を false にする
+func (m *llmModelUsage) cost(model string) (cost float64, ok bool) {
+	ok = true
+	if m.promptTokens > 0 || m.completionTokens > 0 {
+		_, priced := llmPrice(model)
+		ok = ok && priced
+		cost += tokenCost(model, m.promptTokens, m.completionTokens)
+	}
+	if m.audioSeconds > 0 {
+		_, priced := audioPrice(model)
+		ok = ok && priced
+		cost += audioCost(model, m.audioSeconds)
+	}
+	return cost, ok
+}
+
+// setPrice は --llm-price の "model=input,output"（1Mトークンあたりの入力と出力の料金）または
+// "model=<料金>/min"（文字起こしの1分あたりの料金）で、モデルの料金を設定します
+func setPrice(v string) error {
+	model, price, ok := strings.Cut(v, "=")
+	model = strings.TrimSpace(model)
+	if !ok || model == "" {
+		return fmt.Errorf("invalid price %q (expected model=input,output in USD per 1M tokens, or model=<USD>/min)", v)
+	}
+	if perMinute, ok := strings.CutSuffix(strings.TrimSpace(price), "/min"); ok {
+		p, err := strconv.ParseFloat(perMinute, 64)
+		if err != nil || p < 0 {
+			return fmt.Errorf("invalid price %q (expected model=<USD>/min)", v)
+		}
+		audioPrices[model] = p
+		return nil
+	}
+	in, out, _ := strings.Cut(price, ",")
+	pin, err := strconv.ParseFloat(strings.TrimSpace(in), 64)
+	if err != nil || pin < 0 {
+		return fmt.Errorf("invalid price %q (expected model=input,output in USD per 1M tokens)", v)
+	}
+	var pout float64
+	if out != "" {
+		if pout, err = strconv.ParseFloat(strings.TrimSpace(out), 64); err != nil || pout < 0 {
+			return fmt.Errorf("invalid price %q (expected model=input,output in USD per 1M tokens)", v)
+		}
+	}
+	llmPrices[model] = [2]float64{pin, pout}
+	return nil
+}
+
+// errUnpriced は、料金のわからないモデルのため --max-cost を守れないことを表すエラーを作ります
+func errUnpriced(model, example string) error {
+	return fmt.Errorf("%w: the price of %s is unknown, so the cost cannot be limited (set it with --llm-price %s=%s or NOTION_DFS_LLM_PRICES)", errLLMBudget, model, model, example)
+}
+
+// reserve はリクエストを送る前に、input（とほかの入力のトークン数 extraTokens）を送った場合の推定料金が
+// 上限を超えないことを確かめ、その分を送信中として確保します。トークン数は3バイトを1トークンとして見積もる
+// （英語ではやや多め、日本語ではほぼ同じ）。戻り値の確保した料金は、応答が届いたら record に、失敗したら release に渡す
+func (u *llmUsageTracker) reserve(model, input string, extraTokens int64) (float64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.maxCost <= 0 {
+		return 0, nil
+	}
+	price, ok := llmPrice(model)
+	if !ok {
+		return 0, errUnpriced(model, "<input>,<output>")
+	}
+	var completion int64
+	if price[1] > 0 {
+		completion = expectedCompletionTokens
+	}
+	return u.reserveLocked(model, tokenCost(model, int64(len(input)/3)+extraTokens, completion))
+}
+
+// reserveAudio は reserve の文字起こし版で、seconds 秒の音声の料金を確保します
+func (u *llmUsageTracker) reserveAudio(model string, seconds float64) (float64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.maxCost <= 0 {
+		return 0, nil
+	}
+	if _, ok := audioPrice(model); !ok {
+		return 0, errUnpriced(model, "<USD>/min")
+	}
+	return u.reserveLocked(model, audioCost(model, seconds))
+}
+
+func (u *llmUsageTracker) reserveLocked(model string, estimate float64) (float64, error) {
+	spent := u.costLocked() + u.pending
+	if spent+estimate > u.maxCost {
+		return 0, fmt.Errorf("%w: $%.4f spent or in flight, this %s request is estimated at $%.4f, limit $%.2f", errLLMBudget, spent, model, estimate, u.maxCost)
+	}
+	u.pending += estimate
+	return estimate, nil
+}
+
+// release は送信に失敗したリクエストの、reserve で確保した料金を戻します
+func (u *llmUsageTracker) release(reserved float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.pending = max(u.pending-reserved, 0)
+}
+
+// record はリクエストのトークン数（APIの応答の usage）を記録し、reserve で確保した料金を実際の料金に置き換えます
+func (u *llmUsageTracker) record(model string, prompt, completion int64, reserved float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.pending = max(u.pending-reserved, 0)
+	m := u.modelLocked(model)
+	m.requests++
+	m.promptTokens += prompt
+	m.completionTokens += completion
+}
+
+// recordAudio は record の文字起こし版で、文字起こしした音声の長さを記録します
+func (u *llmUsageTracker) recordAudio(model string, seconds float64, reserved float64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.pending = max(u.pending-reserved, 0)
+	m := u.modelLocked(model)
+	m.requests++
+	m.audioSeconds += seconds
+}
+
+func (u *llmUsageTracker) modelLocked(model string) *llmModelUsage {
+	m, ok := u.models[model]
+	if !ok {
+		m = &llmModelUsage{}
+		u.models[model] = m
+	}
+	return m
+}
+
+func (u *llmUsageTracker) costLocked() float64 {
+	var total float64
+	for model, m := range u.models {
+		cost, _ := m.cost(model)
+		total += cost
+	}
+	return total
+}
+
+// printSummary はモデルごとのリクエスト数・トークン数と推定料金を書き出します。APIを使わなかった場合は何も書かない
+func (u *llmUsageTracker) printSummary(w io.Writer) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.models) == 0 {
+		return
+	}
+	models := make([]string, 0, len(u.models))
+	for model := range u.models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	fmt.Fprintln(w, "OpenAI usage:")
+	unpriced := false
+	for _, model := range models {
+		m := u.models[model]
+		cost := "cost unknown"
+		if c, ok := m.cost(model); ok {
+			cost = fmt.Sprintf("$%.4f", c)
+		} else {
+			unpriced = true
+		}
+		if m.audioSeconds > 0 {
+			fmt.Fprintf(w, "  %s: %d requests, %.1f minutes of audio, %s\n", model, m.requests, m.audioSeconds/60, cost)
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %d requests, %d prompt + %d completion tokens, %s\n", model, m.requests, m.promptTokens, m.completionTokens, cost)
+	}
+	total := fmt.Sprintf("  estimated total: $%.4f", u.costLocked())
+	if unpriced {
+		total += " (excluding the models with unknown cost)"
+	}
+	fmt.Fprintln(w, total)
+}
+
+// writePrometheus はモデルごとのトークン数と推定料金を Prometheus のテキスト形式で書き出します
+func (u *llmUsageTracker) writePrometheus(w io.Writer) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	fmt.Fprintln(w, "# HELP notion_dfs_llm_tokens_total Tokens of the OpenAI API requests.")
+	fmt.Fprintln(w, "# TYPE notion_dfs_llm_tokens_total counter")
+	var lines []string
+	for model, m := range u.models {
+		lines = append(lines,
+			fmt.Sprintf("notion_dfs_llm_tokens_total{model=%q,kind=\"prompt\"} %d", model, m.promptTokens),
+			fmt.Sprintf("notion_dfs_llm_tokens_total{model=%q,kind=\"completion\"} %d", model, m.completionTokens))
+	}
+	writeSorted(w, lines)
+
+	fmt.Fprintln(w, "# HELP notion_dfs_llm_cost_usd_total Estimated cost of the OpenAI API requests in USD.")
+	fmt.Fprintln(w, "# TYPE notion_dfs_llm_cost_usd_total counter")
+	lines = nil
+	for model, m := range u.models {
+		cost, _ := m.cost(model)
+		lines = append(lines, fmt.Sprintf("notion_dfs_llm_cost_usd_total{model=%q} %s", model, strconv.FormatFloat(cost, 'f', -1, 64)))
+	}
+	writeSorted(w, lines)
+
+	fmt.Fprintln(w, "# HELP notion_dfs_llm_audio_seconds_total Length of the audio transcribed with the OpenAI API.")
+	fmt.Fprintln(w, "# TYPE notion_dfs_llm_audio_seconds_total counter")
+	lines = nil
+	for model, m := range u.models {
+		if m.audioSeconds > 0 {
+			lines = append(lines, fmt.Sprintf("notion_dfs_llm_audio_seconds_total{model=%q} %s", model, strconv.FormatFloat(m.audioSeconds, 'f', -1, 64)))
+		}
+	}
+	writeSorted(w, lines)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// runUsers lists the users of the workspace with their IDs, for use with
+// people properties (db add, props set) and for checking who can be mentioned.
+func runUsers(args []string) {
+	fs := flag.NewFlagSet("users", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	asJSON := fs.Bool("json", false, "print the API user objects as JSON instead of tab-separated lines")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs users [--json]")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		exit(1)
+	}
+
+	users, err := listUsers(context.Background(), newNotionClient())
+	if err != nil {
+		exitWithNotionError("Error listing users", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(users); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	// ID・種類（person または bot）・名前・メールアドレスをタブ区切りで出力する
+	for _, user := range users {
+		email := ""
+		if user.Person != nil {
+			email = user.Person.Email
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", user.ID, user.Type, user.Name, email)
+	}
+}
+
+// listUsers はワークスペースのすべてのユーザー（ゲストを除く）をページネーションしながら取得し、名前をキャッシュに加えます
+func listUsers(ctx context.Context, client *notionapi.Client) ([]notionapi.User, error) {
+	var users []notionapi.User
+	var cursor notionapi.Cursor
+	for {
+		resp, err := client.User.List(ctx, &notionapi.Pagination{StartCursor: cursor, PageSize: 100})
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, resp.Results...)
+		if !resp.HasMore {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+	for _, user := range users {
+		workspaceUsers(client).add(user)
+	}
+	return users, nil
+}
+
+// userDirectory caches users by ID for the whole run. Comment authors,
+// mentions and people properties often carry only the user ID, and the same
+// few users appear on every page, so each user is looked up at most once.
+type userDirectory struct {
+	mu sync.Mutex
+	// users は取得したユーザー。名前が空なら取得できなかったユーザー
+	users map[notionapi.UserID]notionapi.User
+	// unavailable はインテグレーションにユーザー情報を読み取る権限がないことが分かった後、APIを呼ばないようにする
+	unavailable bool
+	expires     time.Time
+}
+
+// directoryTTL はトークンごとのユーザーと関連先のページのキャッシュを使い回す時間。serve のように長く動くプロセスで、
+// 名前の変更や権限の変化がいつまでも反映されないことや、使われなくなったトークンのキャッシュが残り続けることがないようにする
+const directoryTTL = 10 * time.Minute
+
+var (
+	userDirectoriesMu sync.Mutex
+	// userDirectories は実行全体で共有するユーザーのキャッシュ。ワークスペースの間で名前や権限の有無が
+	// 混ざらないよう、トークンごとに分ける（serve --multi-tenant では要求ごとにトークンが異なる）
+	userDirectories = make(map[notionapi.Token]*userDirectory)
+)
+
+// workspaceUsers は client のトークンのユーザーのキャッシュを返します。directoryTTL を過ぎたキャッシュは捨てる
+func workspaceUsers(client *notionapi.Client) *userDirectory {
+	userDirectoriesMu.Lock()
+	defer userDirectoriesMu.Unlock()
+	now := time.Now()
+	for token, d := range userDirectories {
+		if now.After(d.expires) {
+			delete(userDirectories, token)
+		}
+	}
+	d, ok := userDirectories[client.Token]
+	if !ok {
+		d = &userDirectory{users: make(map[notionapi.UserID]notionapi.User), expires: now.Add(directoryTTL)}
+		userDirectories[client.Token] = d
+	}
+	return d
+}
+
+func (d *userDirectory) add(user notionapi.User) {
+	if user.Name == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.users[user.ID] = user
+}
+
+// lookup はユーザーを返します。user に名前が含まれていなければ Users API で取得し、
+// 取得できない場合は false を返す
+func (d *userDirectory) lookup(ctx context.Context, client *notionapi.Client, user notionapi.User) (notionapi.User, bool) {
+	if user.Name != "" {
+		return user, true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cached, ok := d.users[user.ID]
+	metrics.cacheLookup("users", ok)
+	if ok {
+		return cached, cached.Name != ""
+	}
+	if d.unavailable {
+		return user, false
+	}
+
+	got, err := client.User.Get(ctx, user.ID)
+	var apiErr *notionapi.Error
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Code == errCodeRestrictedResource:
+		log.Printf("warning: the integration cannot read user information; showing user IDs instead of names")
+		d.unavailable = true
+		return user, false
+	case err != nil:
+		log.Printf("warning: could not look up user %s: %v", user.ID, err)
+		got = &user
+	}
+	d.users[user.ID] = *got
+	return *got, got.Name != ""
+}
+
+// name はユーザーの名前を返します。取得できない場合はIDを返す
+func (d *userDirectory) name(ctx context.Context, client *notionapi.Client, user notionapi.User) string {
+	if got, ok := d.lookup(ctx, client, user); ok {
+		return got.Name
+	}
+	return string(user.ID)
+}
+
+// fill は user に名前が含まれていなければ名前・アバター・メールアドレスを補い、名前が分かったかどうかを返します
+func (d *userDirectory) fill(ctx context.Context, client *notionapi.Client, user *notionapi.User) bool {
+	got, ok := d.lookup(ctx, client, *user)
+	if !ok {
+		return false
+	}
+	*user = got
+	return true
+}
+
+// resolveMentions は名前の含まれていないユーザーのメンションに名前を補います
+func (d *userDirectory) resolveMentions(ctx context.Context, client *notionapi.Client, block notionapi.Block) {
+	for _, rt := range blockRichTexts(block) {
+		for i := range rt {
+			m := rt[i].Mention
+			if m == nil || m.Type != "user" || m.User == nil || m.User.Name != "" {
+				continue
+			}
+			if d.fill(ctx, client, m.User) {
+				rt[i].PlainText = "@" + m.User.Name
+			}
+		}
+	}
+}
+
+// resolvePeople は人物・作成者・最終更新者のプロパティのユーザーに名前を補います
+func (d *userDirectory) resolvePeople(ctx context.Context, client *notionapi.Client, page *notionapi.Page) {
+	for _, prop := range page.Properties {
+		switch p := prop.(type) {
+		case *notionapi.PeopleProperty:
+			for i := range p.People {
+				d.fill(ctx, client, &p.People[i])
+			}
+		case *notionapi.CreatedByProperty:
+			d.fill(ctx, client, &p.CreatedBy)
+		case *notionapi.LastEditedByProperty:
+			d.fill(ctx, client, &p.LastEditedBy)
+		}
+	}
+}
+
+// blockRichTexts はブロックのリッチテキストを返します（表の行はセルごと）。
+// 返すスライスはブロックと要素を共有するため、書き換えるとブロックに反映される
+func blockRichTexts(block notionapi.Block) [][]notionapi.RichText {
+	switch b := block.(type) {
+	case *notionapi.ParagraphBlock:
+		return [][]notionapi.RichText{b.Paragraph.RichText}
+	case *notionapi.Heading1Block:
+		return [][]notionapi.RichText{b.Heading1.RichText}
+	case *notionapi.Heading2Block:
+		return [][]notionapi.RichText{b.Heading2.RichText}
+	case *notionapi.Heading3Block:
+		return [][]notionapi.RichText{b.Heading3.RichText}
+	case *notionapi.BulletedListItemBlock:
+		return [][]notionapi.RichText{b.BulletedListItem.RichText}
+	case *notionapi.NumberedListItemBlock:
+		return [][]notionapi.RichText{b.NumberedListItem.RichText}
+	case *notionapi.ToDoBlock:
+		return [][]notionapi.RichText{b.ToDo.RichText}
+	case *notionapi.QuoteBlock:
+		return [][]notionapi.RichText{b.Quote.RichText}
+	case *notionapi.CalloutBlock:
+		return [][]notionapi.RichText{b.Callout.RichText}
+	case *notionapi.ToggleBlock:
+		return [][]notionapi.RichText{b.Toggle.RichText}
+	case *notionapi.TableRowBlock:
+		return b.TableRow.Cells
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// maxWebhookBody は受け付けるWebhookの本文の最大サイズ
+const maxWebhookBody = 1 << 20
+
+// webhookEvent is the body of a Notion webhook event, of the verification
+// request of a new subscription, or of the "Send webhook" action of a
+// database automation (which has the page in data).
+type webhookEvent struct {
+	VerificationToken string `json:"verification_token"`
+	Type              string `json:"type"`
+	Entity            struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"entity"`
+	Data struct {
+		Object string `json:"object"`
+		ID     string `json:"id"`
+		// PageID はコメントのイベントのページ
+		PageID string `json:"page_id"`
+	} `json:"data"`
+}
+
+// pageID はイベントの対象のページを返します。ページに関係しないイベント（データベースの変更など）は空
+func (e *webhookEvent) pageID() string {
+	switch {
+	case e.Type == "page.deleted":
+		return ""
+	case e.Entity.Type == "page":
+		return e.Entity.ID
+	case e.Data.PageID != "":
+		return e.Data.PageID
+	case e.Entity.Type == "" && e.Data.Object == "page":
+		return e.Data.ID
+	}
+	return ""
+}
+
+// webhookReceiver handles POST /webhook. Events are verified with the
+// secret, coalesced per page for delay (an edit session sends many events),
+// and then the page is re-exported and/or summarized, one run per page at a
+// time.
+type webhookReceiver struct {
+	secret string
+	delay  time.Duration
+	// outDir が設定されていれば、ページをMarkdownとして <outDir>/<ページID>.md に書き出す
+	outDir string
+	// summarizer が設定されていれば、ページの要約をコールアウトとして書き込む
+	summarizer *dbSummarizer
+	sem        chan struct{}
+	ctx        context.Context
+
+	mu     sync.Mutex
+	timers map[notionapi.BlockID]*time.Timer
+	// busy は処理中のページ、again は処理中に新しいイベントが届いたページ
+	busy  map[notionapi.BlockID]bool
+	again map[notionapi.BlockID]bool
+	wg    sync.WaitGroup
+}
+
+func (h *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var event webhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if event.VerificationToken != "" {
+		// 新しいサブスクリプションの確認のリクエスト（ほかに何もしない）。トークンをNotionの画面に入力し、--webhook-secret に設定する
+		log.Printf("received the verification token of a webhook subscription: %s (enter it in Notion and set it as --webhook-secret or NOTION_DFS_WEBHOOK_SECRET)", event.VerificationToken)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !h.verify(r, body) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	id := event.pageID()
+	if id == "" {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+	pageID := notionapi.BlockID(formatPageID(id))
+	h.schedule(pageID)
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued", "page_id": string(pageID)})
+}
+
+// verify は、Webhookのサブスクリプションの X-Notion-Signature（本文の HMAC-SHA256）か、
+// オートメーションで設定したヘッダー（Authorization: Bearer <secret> または X-Webhook-Secret）を確かめます
+func (h *webhookReceiver) verify(r *http.Request, body []byte) bool {
+	if h.secret == "" {
+		return false
+	}
+	if sig := r.Header.Get("X-Notion-Signature"); sig != "" {
+		mac := hmac.New(sha256.New, []byte(h.secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(sig), []byte(expected))
+	}
+	given := r.Header.Get("X-Webhook-Secret")
+	if auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		given = auth
+	}
+	return given != "" && subtle.ConstantTimeCompare([]byte(given), []byte(h.secret)) == 1
+}
+
+// schedule はページの処理を delay 後に予約します。予約済みなら待ち時間を延ばし、処理中なら終わった後にもう一度処理する
+func (h *webhookReceiver) schedule(pageID notionapi.BlockID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ctx.Err() != nil {
+		return
+	}
+	if h.busy[pageID] {
+		h.again[pageID] = true
+		return
+	}
+	if t, ok := h.timers[pageID]; ok {
+		if t.Stop() {
+			t.Reset(h.delay)
+		} else {
+			// 待ち時間が終わって処理を始めるところ
+			h.again[pageID] = true
+		}
+		return
+	}
+	h.wg.Add(1)
+	h.timers[pageID] = time.AfterFunc(h.delay, func() { h.process(pageID) })
+}
+
+func (h *webhookReceiver) process(pageID notionapi.BlockID) {
+	defer h.wg.Done()
+	h.mu.Lock()
+	delete(h.timers, pageID)
+	h.busy[pageID] = true
+	h.mu.Unlock()
+
+	h.sem <- struct{}{}
+	if h.ctx.Err() == nil {
+		if err := h.handlePage(h.ctx, pageID); err != nil {
+			log.Printf("webhook: %s: %v", pageID, err)
+		}
+	}
+	<-h.sem
+
+	h.mu.Lock()
+	delete(h.busy, pageID)
+	again := h.again[pageID]
+	delete(h.again, pageID)
+	h.mu.Unlock()
+	if again {
+		h.schedule(pageID)
+	}
+}
+
+// handlePage はページを書き出し、要約を書き込みます
+func (h *webhookReceiver) handlePage(ctx context.Context, pageID notionapi.BlockID) error {
+	if h.outDir != "" {
+		path := filepath.Join(h.outDir, compactPageID(string(pageID))+".md")
+		if err := exportPageFile(ctx, pageID, path); err != nil {
+			return err
+		}
+		log.Printf("webhook: exported %s to %s", pageID, path)
+	}
+	if h.summarizer != nil {
+		page, err := h.summarizer.client.Page.Get(ctx, notionapi.PageID(pageID))
+		if err != nil {
+			return err
+		}
+		// 要約のコールアウトを書き込んだこと自体のイベントでは要約し直さない
+		if h.summarizer.state.done(page) {
+			return nil
+		}
+		if err := h.summarizer.summarizeRow(ctx, page); err != nil {
+			return err
+		}
+		log.Printf("webhook: summarized %s", propertyTitle(page))
+	}
+	return nil
+}
+
+// exportPageFile はページをMarkdown（要約なし）として path に書き出します。書き出しに失敗しても前の内容は壊さない
+func exportPageFile(ctx context.Context, pageID notionapi.BlockID, path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := writePage(ctx, tmp, pageID, exportOptions{format: "markdown", noSummary: true}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// wait は予約済みと処理中のページが終わるのを待ちます（停止するとき）
+func (h *webhookReceiver) wait() {
+	h.mu.Lock()
+	for pageID, t := range h.timers {
+		if t.Stop() {
+			delete(h.timers, pageID)
+			h.wg.Done()
+		}
+	}
+	h.mu.Unlock()
+	h.wg.Wait()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
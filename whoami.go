@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jomei/notionapi"
+)
+
+// whoamiInfo は whoami が表示するインテグレーションの情報
+type whoamiInfo struct {
+	ID        notionapi.UserID `json:"id"`
+	Name      string           `json:"name"`
+	Workspace string           `json:"workspace,omitempty"`
+	// Owner はインテグレーションの所有者（"workspace" または "user"）
+	Owner        string          `json:"owner,omitempty"`
+	Capabilities map[string]bool `json:"capabilities"`
+}
+
+// runWhoami prints the integration behind NOTION_API_TOKEN and the
+// capabilities that can be checked without changing anything. It exits with
+// a non-zero status when the token is invalid, so that CI pipelines can
+// check the token before a long export.
+func runWhoami(args []string) {
+	fs := flag.NewFlagSet("whoami", flag.ContinueOnError)
+	addDiagnosticFlags(fs)
+	asJSON := fs.Bool("json", false, "print the information as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: notion-dfs whoami [--json]")
+		fs.PrintDefaults()
+	}
+	parseFlags(fs, args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		exit(1)
+	}
+
+	ctx := context.Background()
+	client := newNotionClient()
+	me, err := client.User.Me(ctx)
+	if err != nil {
+		exitWithNotionError("Error validating token", err)
+	}
+	info := whoamiInfo{ID: me.ID, Name: me.Name, Capabilities: make(map[string]bool)}
+	if me.Bot != nil {
+		info.Workspace = me.Bot.WorkspaceName
+		info.Owner = me.Bot.Owner.Type
+	}
+
+	// 機能は /users/me からは分からないため、読み取り専用のAPIを呼んで確かめる
+	_, err = client.Search.Do(ctx, &notionapi.SearchRequest{PageSize: 1})
+	if info.Capabilities["read_content"], err = capabilityAvailable(err); err != nil {
+		exitWithNotionError("Error checking capabilities", err)
+	}
+	users, err := client.User.List(ctx, &notionapi.Pagination{PageSize: 100})
+	if info.Capabilities["read_user_information"], err = capabilityAvailable(err); err != nil {
+		exitWithNotionError("Error checking capabilities", err)
+	}
+	if info.Capabilities["read_user_information"] {
+		// メールアドレスの読み取りは、人のユーザーのメールアドレスが含まれているかで判断する
+		for _, user := range users.Results {
+			if user.Person != nil {
+				info.Capabilities["read_user_email"] = user.Person.Email != ""
+				break
+			}
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(info); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	fmt.Printf("integration: %s (%s)\n", info.Name, info.ID)
+	if info.Workspace != "" {
+		fmt.Printf("workspace:   %s\n", info.Workspace)
+	}
+	if info.Owner != "" {
+		fmt.Printf("owner:       %s\n", info.Owner)
+	}
+	fmt.Println("capabilities:")
+	for _, c := range []struct{ key, label string }{
+		{"read_content", "read content"},
+		{"read_user_information", "read user information"},
+		{"read_user_email", "read user information including email addresses"},
+	} {
+		available, ok := info.Capabilities[c.key]
+		switch {
+		case !ok:
+			continue
+		case available:
+			fmt.Printf("  ✓ %s\n", c.label)
+		default:
+			fmt.Printf("  ✗ %s\n", c.label)
+		}
+	}
+	fmt.Println("  (insert/update content and comment capabilities cannot be checked without making changes)")
+}
+
+// capabilityAvailable は、APIの呼び出しが権限不足で失敗した場合は false を、
+// それ以外の理由で失敗した場合はそのエラーを返します
+func capabilityAvailable(err error) (bool, error) {
+	var apiErr *notionapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == errCodeRestrictedResource {
+		return false, nil
+	}
+	return err == nil, err
+}
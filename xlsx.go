@@ -0,0 +1,266 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"notion-dfs/renderer"
+)
+
+// xlsxCellLimit は Excel のセル1つあたりの文字数の上限（UTF-16 のコード単位で数える）
+const xlsxCellLimit = 32767
+
+// xlsxSheet is a worksheet of a workbook written by writeXLSX: a header row
+// of column names, then the rows. Cells keep their types, so that Excel
+// sorts and filters numbers and dates as such.
+type xlsxSheet struct {
+	name    string
+	columns []string
+	// rows のセルは nil（空のセル）・string・float64・bool・time.Time のいずれか。
+	// time.Time は dateOnly なら日付、そうでなければ日時の書式にする
+	rows [][]any
+}
+
+// スタイル（styles.xml の cellXfs の番号）
+const (
+	xlsxStyleDate     = 1
+	xlsxStyleDateTime = 2
+	xlsxStyleHeader   = 3
+)
+
+// writeXLSX writes the sheets as an Excel workbook.
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	names := xlsxSheetNames(sheets)
+	var contentTypes, workbook, rels strings.Builder
+	for i, name := range names {
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", i+1)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, renderer.EscapeHTML(name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", i+1, i+1)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`+"\n", len(names)+1)
+
+	zw := zip.NewWriter(w)
+	files := []struct{ name, content string }{
+		{"[Content_Types].xml", fmt.Sprintf(xlsxContentTypes, contentTypes.String())},
+		{"_rels/.rels", xlsxPackageRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, workbook.String())},
+		{"xl/_rels/workbook.xml.rels", fmt.Sprintf(xlsxWorkbookRels, rels.String())},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, sheet := range sheets {
+		files = append(files, struct{ name, content string }{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheet.xml()})
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// xml はワークシートのXMLを作ります。見出しの行は太字にして、スクロールしても見えるよう固定する
+func (s xlsxSheet) xml() string {
+	var sb strings.Builder
+	sb.WriteString(xlsxWorksheetStart)
+	if len(s.rows) > 0 {
+		sb.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+	sb.WriteString("<sheetData>\n")
+	header := make([]any, len(s.columns))
+	for i, name := range s.columns {
+		header[i] = name
+	}
+	writeXLSXRow(&sb, 1, header, xlsxStyleHeader)
+	for i, row := range s.rows {
+		writeXLSXRow(&sb, i+2, row, 0)
+	}
+	sb.WriteString("</sheetData>\n</worksheet>\n")
+	return sb.String()
+}
+
+// truncateXLSXCell は v を xlsxCellLimit に収まるように切り詰めます。絵文字などの
+// BMP 外の文字は Excel では2文字（サロゲートペア）と数えるため、ペアを分けないように切る。
+// utf16.RuneLen は go1.23 からのため同じ計算をここで行う
+func truncateXLSXCell(v string) string {
+	n := 0
+	for i, r := range v {
+		n++
+		if r > 0xFFFF {
+			n++
+		}
+		if n > xlsxCellLimit {
+			return v[:i]
+		}
+	}
+	return v
+}
+
+// xlsxEscapeControl は XML 1.0 で使えない制御文字と U+FFFE・U+FFFF を、Excel が読み込み時に元の文字へ戻す
+// _xHHHH_ の形にします。そのままではブック全体が開けなくなる。元から _xHHHH_ の形の文字列は、
+// 戻されないよう先頭の _ を _x005F_ にする
+func xlsxEscapeControl(v string) string {
+	if !strings.ContainsFunc(v, func(r rune) bool { return r == '_' || xlsxInvalidXMLChar(r) }) {
+		return v
+	}
+	var sb strings.Builder
+	for i, r := range v {
+		switch {
+		case xlsxInvalidXMLChar(r):
+			fmt.Fprintf(&sb, "_x%04X_", r)
+		case r == '_' && xlsxEscapedChar(v[i:]):
+			sb.WriteString("_x005F_")
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+func xlsxInvalidXMLChar(r rune) bool {
+	return r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xFFFE || r == 0xFFFF
+}
+
+// xlsxEscapedChar は s が _xHHHH_ で始まるかを返します
+func xlsxEscapedChar(s string) bool {
+	if len(s) < 7 || s[1] != 'x' || s[6] != '_' {
+		return false
+	}
+	for _, c := range s[2:6] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeXLSXRow(sb *strings.Builder, n int, cells []any, style int) {
+	fmt.Fprintf(sb, `<row r="%d">`, n)
+	for i, cell := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(n)
+		attr := ""
+		if style != 0 {
+			attr = fmt.Sprintf(` s="%d"`, style)
+		}
+		switch v := cell.(type) {
+		case string:
+			v = truncateXLSXCell(v)
+			fmt.Fprintf(sb, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, ref, attr, renderer.EscapeHTML(xlsxEscapeControl(v)))
+		case float64:
+			fmt.Fprintf(sb, `<c r="%s"%s><v>%s</v></c>`, ref, attr, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			b := "0"
+			if v {
+				b = "1"
+			}
+			fmt.Fprintf(sb, `<c r="%s" t="b"%s><v>%s</v></c>`, ref, attr, b)
+		case time.Time:
+			style := xlsxStyleDateTime
+			if dateOnly(v) {
+				style = xlsxStyleDate
+			}
+			fmt.Fprintf(sb, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(xlsxSerial(v), 'f', -1, 64))
+		}
+	}
+	sb.WriteString("</row>\n")
+}
+
+// xlsxSerial は時刻を Excel の日付のシリアル値（1899-12-30 からの日数）にします。Excel の日時には
+// タイムゾーンがないため、--timezone の時刻（指定がなければ UTC）の日付と時刻をそのまま使う
+func xlsxSerial(t time.Time) float64 {
+	if dateDisplay.loc == nil && !dateOnly(t) {
+		t = t.UTC()
+	}
+	t = dateDisplay.in(t)
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return wall.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+}
+
+// xlsxColumn は0から数えた列の番号を "A"・"Z"・"AA" の形にします
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxSheetNames はシートの名前を、Excel で使えない文字を除いて31文字までにし、重複しないようにします
+func xlsxSheetNames(sheets []xlsxSheet) []string {
+	used := make(map[string]bool)
+	names := make([]string, len(sheets))
+	for i, sheet := range sheets {
+		base := strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`[]:*?/\`, r) {
+				return '_'
+			}
+			return r
+		}, strings.Trim(sheet.name, "'"))
+		base = firstNonEmpty(strings.TrimSpace(base), "Sheet")
+		name := truncateRunes(base, 31)
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			suffix := fmt.Sprintf(" (%d)", n)
+			name = truncateRunes(base, 31-len(suffix)) + suffix
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+%s</Types>
+`
+
+const xlsxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>
+`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>%s</sheets>
+</workbook>
+`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+%s</Relationships>
+`
+
+const xlsxWorksheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+`
+
+// xlsxStyles は標準・日付・日時・見出し（太字）のセルのスタイル
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="2"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/><numFmt numFmtId="165" formatCode="yyyy-mm-dd hh:mm"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="4"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>
+<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>
+</styleSheet>
+`
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestXLSXColumn(t *testing.T) {
+	tests := []struct {
+		i    int
+		want string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := xlsxColumn(tt.i); got != tt.want {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXSerial(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want float64
+	}{
+		{time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC), 2},
+		{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 45292},
+		{time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), 45292.5},
+		// --timezone の指定がなければ UTC の時刻にする
+		{time.Date(2024, 1, 1, 9, 0, 0, 0, time.FixedZone("JST", 9*3600)), 45292},
+	}
+	for _, tt := range tests {
+		if got := xlsxSerial(tt.t); got != tt.want {
+			t.Errorf("xlsxSerial(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateXLSXCell(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int // 切り詰めた後のバイト数
+	}{
+		{"short", "abc", 3},
+		{"limit", strings.Repeat("a", xlsxCellLimit), xlsxCellLimit},
+		{"over", strings.Repeat("a", xlsxCellLimit+5), xlsxCellLimit},
+		{"multibyte", strings.Repeat("あ", xlsxCellLimit+1), 3 * xlsxCellLimit},
+		// 絵文字は2文字と数え、サロゲートペアを分けない
+		{"emoji", strings.Repeat("😀", xlsxCellLimit/2+1), 4 * (xlsxCellLimit / 2)},
+		{"emoji after odd", "a" + strings.Repeat("😀", xlsxCellLimit/2+1), 1 + 4*(xlsxCellLimit/2)},
+	}
+	for _, tt := range tests {
+		if got := truncateXLSXCell(tt.in); len(got) != tt.want || !strings.HasPrefix(tt.in, got) {
+			t.Errorf("%s: truncateXLSXCell returned %d bytes, want %d", tt.name, len(got), tt.want)
+		}
+	}
+}
+
+func TestXLSXEscapeControl(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"tab\tnewline\ncr\r", "tab\tnewline\ncr\r"},
+		{"a\x00b", "a_x0000_b"},
+		{"\x08\x0b\x0c\x1f", "_x0008__x000B__x000C__x001F_"},
+		{"￾￿", "_xFFFE__xFFFF_"},
+		{"snake_case", "snake_case"},
+		// 元から _xHHHH_ の形の文字列は、Excel で戻されないようにする
+		{"_x0041_", "_x005F_x0041_"},
+		{"_x00_", "_x00_"},
+		{"_xGGGG_", "_xGGGG_"},
+	}
+	for _, tt := range tests {
+		if got := xlsxEscapeControl(tt.in); got != tt.want {
+			t.Errorf("xlsxEscapeControl(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXSheetNames(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{[]string{"Tasks"}, []string{"Tasks"}},
+		{[]string{"a/b:c?"}, []string{"a_b_c_"}},
+		{[]string{"'quoted'"}, []string{"quoted"}},
+		{[]string{"", "  "}, []string{"Sheet", "Sheet (2)"}},
+		{[]string{"Tasks", "tasks", "TASKS"}, []string{"Tasks", "tasks (2)", "TASKS (3)"}},
+		{[]string{strings.Repeat("長", 40)}, []string{strings.Repeat("長", 31)}},
+		{[]string{strings.Repeat("x", 40), strings.Repeat("x", 40)}, []string{strings.Repeat("x", 31), strings.Repeat("x", 27) + " (2)"}},
+	}
+	for _, tt := range tests {
+		sheets := make([]xlsxSheet, len(tt.names))
+		for i, name := range tt.names {
+			sheets[i].name = name
+		}
+		got := xlsxSheetNames(sheets)
+		if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+			t.Errorf("xlsxSheetNames(%q) = %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestWriteXLSXRow(t *testing.T) {
+	tests := []struct {
+		name  string
+		cells []any
+		style int
+		want  string
+	}{
+		{"empty", []any{nil}, 0, `<row r="2"></row>`},
+		{"text", []any{"a<b&c"}, 0, `<row r="2"><c r="A2" t="inlineStr"><is><t xml:space="preserve">a&lt;b&amp;c</t></is></c></row>`},
+		{"control", []any{"a\x01"}, 0, `<row r="2"><c r="A2" t="inlineStr"><is><t xml:space="preserve">a_x0001_</t></is></c></row>`},
+		{"number", []any{nil, 1.5}, 0, `<row r="2"><c r="B2"><v>1.5</v></c></row>`},
+		{"bool", []any{true, false}, 0, `<row r="2"><c r="A2" t="b"><v>1</v></c><c r="B2" t="b"><v>0</v></c></row>`},
+		{"date", []any{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}, 0, `<row r="2"><c r="A2" s="1"><v>45292</v></c></row>`},
+		{"date time", []any{time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC)}, 0, `<row r="2"><c r="A2" s="2"><v>45292.25</v></c></row>`},
+		{"header", []any{"Name"}, xlsxStyleHeader, `<row r="2"><c r="A2" t="inlineStr" s="3"><is><t xml:space="preserve">Name</t></is></c></row>`},
+	}
+	for _, tt := range tests {
+		var sb strings.Builder
+		writeXLSXRow(&sb, 2, tt.cells, tt.style)
+		if got := strings.TrimSuffix(sb.String(), "\n"); got != tt.want {
+			t.Errorf("%s: writeXLSXRow = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	sheets := []xlsxSheet{
+		{name: "Tasks", columns: []string{"Name", "Done"}, rows: [][]any{{"a\x00b", true}, {"<c>", nil}}},
+		{name: "Tasks", columns: []string{"Date"}},
+	}
+	var buf bytes.Buffer
+	if err := writeXLSX(&buf, sheets); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"[Content_Types].xml":        true,
+		"_rels/.rels":                true,
+		"xl/workbook.xml":            true,
+		"xl/_rels/workbook.xml.rels": true,
+		"xl/styles.xml":              true,
+		"xl/worksheets/sheet1.xml":   true,
+		"xl/worksheets/sheet2.xml":   true,
+	}
+	for _, f := range zr.File {
+		if !want[f.Name] {
+			t.Errorf("unexpected file %s", f.Name)
+		}
+		delete(want, f.Name)
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// どのファイルも XML として読めること（制御文字が含まれると Excel はブックを開けない）
+		d := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := d.Token(); err != nil {
+				if !errors.Is(err, io.EOF) {
+					t.Errorf("%s: %v", f.Name, err)
+				}
+				break
+			}
+		}
+		if f.Name == "xl/workbook.xml" && !strings.Contains(string(data), `name="Tasks (2)"`) {
+			t.Errorf("workbook.xml does not rename the duplicate sheet: %s", data)
+		}
+	}
+	for name := range want {
+		t.Errorf("missing file %s", name)
+	}
+}